@@ -0,0 +1,114 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// requestIDHeader carries the request ID; a client-supplied ID is kept when well-formed
+const requestIDHeader = "X-Request-ID"
+
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// sensitiveFields are never written to logs: balances, attribute values and private witness material
+var sensitiveFields = []string{
+	"amount", "balance", "balances", "value", "values", "score", "salt", "threshold", "witness", "secret", "password", "token", "consentToken", "access_token",
+}
+
+var (
+	redactedValue = "[REDACTED]"
+
+	// "field": value in JSON, field=value in key/value text and Field:value in %+v struct output
+	jsonFieldPattern  = regexp.MustCompile(`(?i)("(?:` + strings.Join(sensitiveFields, "|") + `)"\s*:\s*)("(?:[^"\\]|\\.)*"|[^,}\]\s]+)`)
+	textFieldPattern  = regexp.MustCompile(`(?i)\b((?:` + strings.Join(sensitiveFields, "|") + `)(?:\s*=\s*|:))([^\s,}\]]+)`)
+	bearerPattern     = regexp.MustCompile(`(?i)(Bearer\s+)\S+`)
+	unsatisfiedDetail = regexp.MustCompile(`(?i)(is not satisfied)\b.*`)
+)
+
+// redact scrubs sensitive values from a log line. gnark solver errors are cut after
+// "is not satisfied" because they print the offending witness values.
+func redact(s string) string {
+	s = jsonFieldPattern.ReplaceAllString(s, `${1}"`+redactedValue+`"`)
+	s = textFieldPattern.ReplaceAllString(s, "${1}"+redactedValue)
+	s = bearerPattern.ReplaceAllString(s, "${1}"+redactedValue)
+	s = unsatisfiedDetail.ReplaceAllString(s, "${1}: "+redactedValue)
+	return s
+}
+
+// redactingWriter applies redact to everything written through the standard logger
+type redactingWriter struct {
+	out io.Writer
+}
+
+func (w redactingWriter) Write(p []byte) (int, error) {
+	if _, err := w.out.Write([]byte(redact(string(p)))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// statusRecorder captures the status code and body size written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += n
+	return n, err
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// logRequests writes one access log line per request with method, path, status, latency and request ID.
+// Query strings and bodies are never logged, since they may carry balances or witness values.
+func logRequests(logger *log.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		rec := &statusRecorder{ResponseWriter: w}
+		start := time.Now()
+		defer func() {
+			status := rec.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			logger.Printf("method=%s path=%s status=%d latency=%s bytes=%d request_id=%s",
+				r.Method, r.URL.Path, status, time.Since(start).Round(time.Microsecond), rec.bytes, id)
+		}()
+
+		next.ServeHTTP(rec, r)
+	})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		leaked   string
+		expected string
+	}{
+		{"JSON number", `{"id":"alice","amount":1500}`, "1500", `{"id":"alice","amount":"[REDACTED]"}`},
+		{"JSON string", `{"salt": "98765", "id": "bob"}`, "98765", `{"salt": "[REDACTED]", "id": "bob"}`},
+		{"Key value", "stored balance=4200 for alice", "4200", "stored balance=[REDACTED] for alice"},
+		{"Struct", "request {ID:alice Amount:4200}", "4200", "request {ID:alice Amount:[REDACTED]}"},
+		{"Bearer token", "Authorization: Bearer s3cr3t", "s3cr3t", "Authorization: Bearer [REDACTED]"},
+		{"Solver error", "constraint #3 is not satisfied: 150 ≤ 100", "150", "constraint #3 is not satisfied: [REDACTED]"},
+		{"Nothing sensitive", "method=GET path=/health status=200", "", "method=GET path=/health status=200"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := redact(tt.input)
+			if got != tt.expected {
+				t.Errorf("redact(%q) = %q, want %q", tt.input, got, tt.expected)
+			}
+			if tt.leaked != "" && strings.Contains(got, tt.leaked) {
+				t.Errorf("Expected %q to be redacted from %q", tt.leaked, got)
+			}
+		})
+	}
+}
+
+func TestRedactingWriter(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.New(redactingWriter{out: &buf}, "", 0)
+	logger.Printf("store %s", `{"id":"alice","amount":31337}`)
+
+	if strings.Contains(buf.String(), "31337") {
+		t.Errorf("Expected amount to be redacted, got %q", buf.String())
+	}
+}
+
+func TestLogRequests(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.New(redactingWriter{out: &buf}, "", 0)
+
+	handler := logRequests(logger, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "balance not found", http.StatusNotFound)
+	}))
+
+	t.Run("Generated request ID", func(t *testing.T) {
+		buf.Reset()
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("POST", "/store/sum?amount=777", strings.NewReader(`{"id":"a","amount":555}`)))
+
+		id := rr.Header().Get(requestIDHeader)
+		if id == "" {
+			t.Fatal("Expected a generated request ID")
+		}
+		line := buf.String()
+		for _, want := range []string{"method=POST", "path=/store/sum ", "status=404", "request_id=" + id, "latency="} {
+			if !strings.Contains(line, want) {
+				t.Errorf("Expected %q in log line %q", want, line)
+			}
+		}
+		for _, leaked := range []string{"777", "555"} {
+			if strings.Contains(line, leaked) {
+				t.Errorf("Expected %q not to be logged, got %q", leaked, line)
+			}
+		}
+	})
+
+	t.Run("Client request ID", func(t *testing.T) {
+		buf.Reset()
+		req := httptest.NewRequest("GET", "/health", nil)
+		req.Header.Set(requestIDHeader, "trace-123")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Header().Get(requestIDHeader) != "trace-123" || !strings.Contains(buf.String(), "request_id=trace-123") {
+			t.Errorf("Expected client request ID to be kept, got %q", buf.String())
+		}
+	})
+
+	t.Run("Malformed client request ID", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/health", nil)
+		req.Header.Set(requestIDHeader, "bad id\nforged=1")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if strings.Contains(rr.Header().Get(requestIDHeader), "forged") {
+			t.Error("Expected malformed request ID to be replaced")
+		}
+	})
+}
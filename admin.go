@@ -0,0 +1,37 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// requireAdmin guards admin endpoints with a bearer token read from the secret provider.
+// Admin endpoints are disabled entirely when no token is configured.
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, err := secrets.Secret(r.Context(), adminTokenSecret)
+		if errors.Is(err, errSecretNotFound) {
+			writeError(w, errs.Errorf(errs.Forbidden, "admin API disabled"))
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to read admin token: %v", err)
+			writeError(w, errs.Errorf(errs.Unavailable, "admin API temporarily unavailable"))
+			return
+		}
+
+		provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			writeError(w, errs.Errorf(errs.Unauthorized, "unauthorized"))
+			return
+		}
+
+		next(w, r)
+	}
+}
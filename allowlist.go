@@ -0,0 +1,205 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr/mimc"
+	"github.com/consensys/gnark/frontend"
+	stdmimc "github.com/consensys/gnark/std/hash/mimc"
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// allowlistDepth is the depth of allowlist Merkle trees, bounding lists to 2^allowlistDepth members
+const allowlistDepth = 10
+
+var (
+	errAllowlistNotFound = errs.New(errs.NotFound, "allowlist_not_found", "allowlist not found")
+	errNotAllowlisted    = errs.New(errs.Unprocessable, "not_allowlisted", "id is not on the allowlist")
+)
+
+// Allowlist is a named set of user ids committed to by a MiMC Merkle root
+type Allowlist struct {
+	Name    string
+	Members []string
+	levels  [][]fr.Element // levels[0] are the leaves, levels[allowlistDepth] the root
+}
+
+var (
+	allowlists   = make(map[string]*Allowlist)
+	allowlistsMu sync.RWMutex
+)
+
+// allowlistLeaf maps an id to its Merkle leaf, MiMC(sha256(id) mod r)
+func allowlistLeaf(id string) fr.Element {
+	sum := sha256.Sum256([]byte(id))
+	var e fr.Element
+	e.SetBytes(sum[:])
+	return mimcHash(e)
+}
+
+// mimcHash hashes field elements with native MiMC, matching stdmimc in-circuit
+func mimcHash(elements ...fr.Element) fr.Element {
+	h := mimc.NewMiMC()
+	for _, e := range elements {
+		b := e.Bytes()
+		h.Write(b[:])
+	}
+	var out fr.Element
+	out.SetBytes(h.Sum(nil))
+	return out
+}
+
+// newAllowlist builds the Merkle tree over members, padding unused leaves with zero
+func newAllowlist(name string, members []string) (*Allowlist, error) {
+	if len(members) > 1<<allowlistDepth {
+		return nil, fmt.Errorf("allowlist may have at most %d members", 1<<allowlistDepth)
+	}
+
+	members = slices.Clone(members)
+	slices.Sort(members)
+	members = slices.Compact(members)
+
+	leaves := make([]fr.Element, 1<<allowlistDepth)
+	for i, m := range members {
+		leaves[i] = allowlistLeaf(m)
+	}
+
+	levels := [][]fr.Element{leaves}
+	for d := 0; d < allowlistDepth; d++ {
+		prev := levels[d]
+		next := make([]fr.Element, len(prev)/2)
+		for i := range next {
+			next[i] = mimcHash(prev[2*i], prev[2*i+1])
+		}
+		levels = append(levels, next)
+	}
+
+	return &Allowlist{Name: name, Members: members, levels: levels}, nil
+}
+
+func fieldToBig(e fr.Element) *big.Int {
+	return e.BigInt(new(big.Int))
+}
+
+// Root returns the Merkle root of the allowlist
+func (a *Allowlist) Root() fr.Element {
+	return a.levels[allowlistDepth][0]
+}
+
+// membership returns the in-circuit assignment proving that id is on the list
+func (a *Allowlist) membership(id string) (membershipGadget, error) {
+	index, found := slices.BinarySearch(a.Members, id)
+	if !found {
+		return membershipGadget{}, errNotAllowlisted
+	}
+
+	g := membershipGadget{Leaf: fieldToBig(a.levels[0][index]), Root: fieldToBig(a.Root())}
+	for d := 0; d < allowlistDepth; d++ {
+		g.Path[d] = fieldToBig(a.levels[d][index^1])
+		g.Directions[d] = index & 1
+		index >>= 1
+	}
+	return g, nil
+}
+
+func lookupAllowlist(name string) (*Allowlist, error) {
+	allowlistsMu.RLock()
+	defer allowlistsMu.RUnlock()
+
+	list, ok := allowlists[name]
+	if !ok {
+		return nil, errAllowlistNotFound
+	}
+	return list, nil
+}
+
+// membershipGadget proves that Leaf is in the Merkle tree with the public Root.
+// Directions[d] is 1 when the running node is the right child at depth d.
+type membershipGadget struct {
+	Leaf       frontend.Variable                 `gnark:",private"`
+	Path       [allowlistDepth]frontend.Variable `gnark:",private"`
+	Directions [allowlistDepth]frontend.Variable `gnark:",private"`
+	Root       frontend.Variable                 `gnark:",public"`
+}
+
+func (g *membershipGadget) define(api frontend.API) error {
+	h, err := stdmimc.NewMiMC(api)
+	if err != nil {
+		return err
+	}
+
+	node := g.Leaf
+	for d := 0; d < allowlistDepth; d++ {
+		api.AssertIsBoolean(g.Directions[d])
+		left := api.Select(g.Directions[d], g.Path[d], node)
+		right := api.Select(g.Directions[d], node, g.Path[d])
+
+		h.Reset()
+		h.Write(left, right)
+		node = h.Sum()
+	}
+	api.AssertIsEqual(node, g.Root)
+	return nil
+}
+
+// publicMembership returns the verifier-side assignment for a root, with private wires zeroed
+func publicMembership(root fr.Element) membershipGadget {
+	g := membershipGadget{Leaf: 0, Root: fieldToBig(root)}
+	for d := 0; d < allowlistDepth; d++ {
+		g.Path[d], g.Directions[d] = 0, 0
+	}
+	return g
+}
+
+type AllowlistRequest struct {
+	Members []string `json:"members"`
+}
+
+type AllowlistResponse struct {
+	Name    string `json:"name"`
+	Root    string `json:"root"`
+	Members int    `json:"members"`
+}
+
+// putAllowlist creates or replaces the allowlist named in the path
+func putAllowlist(w http.ResponseWriter, r *http.Request) {
+	var req AllowlistRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	name := r.PathValue("name")
+	list, err := newAllowlist(name, req.Members)
+	if err != nil {
+		writeError(w, errs.Wrap(errs.Invalid, err))
+		return
+	}
+
+	allowlistsMu.Lock()
+	allowlists[name] = list
+	allowlistsMu.Unlock()
+
+	audit.record(AuditEvent{Type: auditAllowlistUpdated, Subject: name, Detail: fmt.Sprintf("%d members", len(list.Members))})
+
+	root := list.Root()
+	writeJSON(w, AllowlistResponse{Name: name, Root: root.String(), Members: len(list.Members)})
+}
+
+// getAllowlist returns the root of an allowlist without disclosing its members
+func getAllowlist(w http.ResponseWriter, r *http.Request) {
+	list, err := lookupAllowlist(r.PathValue("name"))
+	if err != nil {
+		writeError(w, errs.Wrap(errs.NotFound, err))
+		return
+	}
+
+	root := list.Root()
+	writeJSON(w, AllowlistResponse{Name: list.Name, Root: root.String(), Members: len(list.Members)})
+}
@@ -2,10 +2,13 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+
+	"github.com/korjavin/zkTest1/circuits"
 )
 
 func TestStoreBalance(t *testing.T) {
@@ -206,6 +209,24 @@ func TestGenerateProof(t *testing.T) {
 	}
 }
 
+func TestGenerateProofCancelled(t *testing.T) {
+	helper := NewTestHelper(t)
+	helper.SetupCleanBalances()
+	helper.StoreBalance("user1", 150)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	body, _ := json.Marshal(ProofRequest{ID: "user1", NeededAmount: 100})
+	req := httptest.NewRequest("POST", "/get/proof/neededAmount", bytes.NewReader(body)).WithContext(ctx)
+	rr := httptest.NewRecorder()
+	generateProof(rr, req)
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 for a cancelled request, got %d", rr.Code)
+	}
+}
+
 func TestValidateProof(t *testing.T) {
 	if testing.Short() {
 		t.Skip("Skipping slow proof validation test")
@@ -248,6 +269,55 @@ func TestValidateProof(t *testing.T) {
 	t.Log("Proof generation test completed - validation would require proper proof serialization")
 }
 
+func TestValidateDryRun(t *testing.T) {
+	SkipIfShort(t, "bucket proof generation")
+
+	setup, err := loadSetup(bucketCircuitName, &circuits.BucketCircuit{})
+	if err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+	assignment := &circuits.BucketCircuit{Balance: 1500, Lower: 1000, Upper: 10000}
+	proof, err := setup.prove(context.Background(), assignment)
+	if err != nil {
+		t.Fatalf("Prove failed: %v", err)
+	}
+	proofJSON, _ := json.Marshal(proof)
+	public, err := encodePublicWitness(defaultCurve, assignment)
+	if err != nil {
+		t.Fatalf("Failed to encode public witness: %v", err)
+	}
+
+	validate := func(dryRun bool) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(ValidateRequest{Proof: proofJSON, PublicWitness: public, Circuit: bucketCircuitName, DryRun: dryRun})
+		rr := httptest.NewRecorder()
+		validateProof(rr, httptest.NewRequest("POST", "/validate", bytes.NewReader(body)))
+		return rr
+	}
+
+	before := audit.seq
+	rr := validate(true)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for a dry run, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get(dryRunHeader) != "true" {
+		t.Errorf("Expected %s: true", dryRunHeader)
+	}
+	if events := audit.since(before); len(events) != 0 {
+		t.Errorf("Expected a dry run to audit nothing, got %v", events)
+	}
+
+	rr = validate(false)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get(dryRunHeader) != "" {
+		t.Errorf("Expected no %s header outside dry runs", dryRunHeader)
+	}
+	if events := audit.since(before); len(events) != 1 || events[0].Type != auditProofVerified {
+		t.Errorf("Expected one %s event, got %v", auditProofVerified, events)
+	}
+}
+
 // Note: Additional endpoint validation tests could be added here
 // Currently focusing on functional tests that verify the core ZK proof functionality
 
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// artifactProof is the kind of the generated proofs kept in the artifact store
+const artifactProof = "proofs"
+
+var (
+	errArtifactNotFound     = errs.New(errs.NotFound, "artifact_not_found", "artifact not found")
+	errArtifactCorrupt      = errs.New(errs.Internal, "artifact_corrupt", "artifact content does not match its digest")
+	errSignedURLUnsupported = errs.New(errs.NotImplemented, "signed_url_unsupported", "signed URLs are not supported by this artifact store")
+)
+
+var digestPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// ArtifactStore keeps large binary artifacts, such as proofs, addressed by their SHA-256 digest
+type ArtifactStore interface {
+	Put(ctx context.Context, kind string, data []byte) (digest string, err error)
+	Get(ctx context.Context, kind, digest string) ([]byte, error)
+	SignedURL(kind, digest string, ttl time.Duration) (string, error)
+	Delete(ctx context.Context, kind, digest string) error // deleting a missing artifact is not an error
+	Ping(ctx context.Context) error                        // checks that the backend is reachable and writable
+}
+
+// artifacts is the process-wide artifact store, replaced from configuration at startup
+var artifacts ArtifactStore = newMemoryArtifactStore()
+
+// ArtifactConfig selects and configures the artifact store backend
+type ArtifactConfig struct {
+	Backend string // "memory", "file" or "s3"
+	Dir     string
+	S3      S3Config
+}
+
+func newArtifactStore(cfg ArtifactConfig) (ArtifactStore, error) {
+	switch cfg.Backend {
+	case "", "memory":
+		return newMemoryArtifactStore(), nil
+	case "file":
+		return newFileArtifactStore(cfg.Dir)
+	case "s3":
+		return newS3ArtifactStore(cfg.S3)
+	default:
+		return nil, fmt.Errorf("unknown artifact backend %q", cfg.Backend)
+	}
+}
+
+func artifactDigest(data []byte) string {
+	return hashHex(data)
+}
+
+func validateArtifactRef(kind, digest string) error {
+	switch kind {
+	case artifactProof:
+	default:
+		return fmt.Errorf("unknown artifact kind %q", kind)
+	}
+	if !digestPattern.MatchString(digest) {
+		return errors.New("digest must be 64 lowercase hex characters")
+	}
+	return nil
+}
+
+// checkArtifact verifies fetched content against the digest it was addressed by
+func checkArtifact(digest string, data []byte) ([]byte, error) {
+	if artifactDigest(data) != digest {
+		return nil, errArtifactCorrupt
+	}
+	return data, nil
+}
+
+// memoryArtifactStore keeps artifacts in process memory
+type memoryArtifactStore struct {
+	mu    sync.RWMutex
+	items map[string][]byte
+}
+
+func newMemoryArtifactStore() *memoryArtifactStore {
+	return &memoryArtifactStore{items: make(map[string][]byte)}
+}
+
+func (s *memoryArtifactStore) Put(_ context.Context, kind string, data []byte) (string, error) {
+	digest := artifactDigest(data)
+	s.mu.Lock()
+	s.items[kind+"/"+digest] = append([]byte(nil), data...)
+	s.mu.Unlock()
+	return digest, nil
+}
+
+func (s *memoryArtifactStore) Get(_ context.Context, kind, digest string) ([]byte, error) {
+	s.mu.RLock()
+	data, ok := s.items[kind+"/"+digest]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, errArtifactNotFound
+	}
+	return data, nil
+}
+
+func (s *memoryArtifactStore) Delete(_ context.Context, kind, digest string) error {
+	s.mu.Lock()
+	delete(s.items, kind+"/"+digest)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memoryArtifactStore) SignedURL(string, string, time.Duration) (string, error) {
+	return "", errSignedURLUnsupported
+}
+
+func (s *memoryArtifactStore) Ping(context.Context) error { return nil }
+
+// fileArtifactStore keeps artifacts on local disk under dir/kind/digest
+type fileArtifactStore struct {
+	dir string
+}
+
+func newFileArtifactStore(dir string) (*fileArtifactStore, error) {
+	if dir == "" {
+		return nil, errors.New("artifact directory is required for the file backend")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &fileArtifactStore{dir: dir}, nil
+}
+
+func (s *fileArtifactStore) Put(_ context.Context, kind string, data []byte) (string, error) {
+	digest := artifactDigest(data)
+	path := filepath.Join(s.dir, kind, digest)
+
+	// Content addressing makes existing files immutable duplicates
+	if _, err := os.Stat(path); err == nil {
+		return digest, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return "", err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return "", err
+	}
+	return digest, os.Rename(tmp, path)
+}
+
+func (s *fileArtifactStore) Get(_ context.Context, kind, digest string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, kind, digest))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errArtifactNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return checkArtifact(digest, data)
+}
+
+func (s *fileArtifactStore) Delete(_ context.Context, kind, digest string) error {
+	err := os.Remove(filepath.Join(s.dir, kind, digest))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *fileArtifactStore) SignedURL(string, string, time.Duration) (string, error) {
+	return "", errSignedURLUnsupported
+}
+
+// Ping creates and removes a probe file to check the directory is still writable
+func (s *fileArtifactStore) Ping(context.Context) error {
+	f, err := os.CreateTemp(s.dir, ".ping-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// signedURLTTL is how long redirect URLs handed out by getArtifact stay valid
+const signedURLTTL = 5 * time.Minute
+
+// getArtifact serves an artifact by digest, redirecting to a signed URL when the backend supports it
+func getArtifact(w http.ResponseWriter, r *http.Request) {
+	kind, digest := r.PathValue("kind"), r.PathValue("digest")
+	if err := validateArtifactRef(kind, digest); err != nil {
+		writeError(w, errs.Wrap(errs.Invalid, err))
+		return
+	}
+
+	url, err := artifacts.SignedURL(kind, digest, signedURLTTL)
+	if err == nil {
+		http.Redirect(w, r, url, http.StatusTemporaryRedirect)
+		return
+	}
+	if !errors.Is(err, errSignedURLUnsupported) {
+		writeError(w, err)
+		return
+	}
+
+	data, err := artifacts.Get(r.Context(), kind, digest)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("ETag", `"`+digest+`"`)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	_, _ = w.Write(data)
+}
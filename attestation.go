@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// AttestationConfig bounds how long a bank attestation backs proofs
+type AttestationConfig struct {
+	TTL      time.Duration // attestations expire this long after the balance was fetched; 0 means never
+	Reminder time.Duration // attestation.expiring is notified this long before expiry; 0 disables reminders
+}
+
+// attestationPolicy is the configured expiry, read when attestations are issued
+var attestationPolicy = AttestationConfig{TTL: 30 * 24 * time.Hour, Reminder: 72 * time.Hour}
+
+// auditAttestationExpiring is only notified to subscriptions and never audited, as it names the user
+const auditAttestationExpiring = "attestation.expiring"
+
+var errAttestationExpired = errs.New(errs.Forbidden, "attestation_expired", "balance attestation has expired; reconnect the bank account to prove it")
+
+// remindedAttestations holds the expiry each user was last reminded of, guarded by balancesMu
+var remindedAttestations = make(map[string]time.Time)
+
+// attestationExpiry is when an attestation fetched at fetchedAt stops backing proofs, nil for never
+func attestationExpiry(fetchedAt time.Time) *time.Time {
+	if attestationPolicy.TTL <= 0 {
+		return nil
+	}
+	expires := fetchedAt.Add(attestationPolicy.TTL)
+	return &expires
+}
+
+func (a BalanceAttestation) expired(now time.Time) bool {
+	return a.ExpiresAt != nil && !now.Before(*a.ExpiresAt)
+}
+
+// expiredAttestationLocked reports whether id's balance is attested and the attestation has expired;
+// callers must hold balancesMu
+func expiredAttestationLocked(id string, now time.Time) bool {
+	a, ok := balanceAttestations[id]
+	return ok && a.expired(now)
+}
+
+// checkBalanceAttestation fails with errAttestationExpired when id's bank-attested balance may
+// no longer be proven. Self-reported balances have no attestation and never expire.
+func checkBalanceAttestation(id string, now time.Time) error {
+	balancesMu.Lock()
+	defer balancesMu.Unlock()
+	if expiredAttestationLocked(id, now) {
+		return fmt.Errorf("%w (expired %s)", errAttestationExpired, balanceAttestations[id].ExpiresAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// remindExpiringAttestations notifies subscribers once about each attestation that expires within
+// the reminder window, so integrators can ask the user to reconnect their bank in time
+func remindExpiringAttestations(now time.Time, window time.Duration) (int, error) {
+	var due []AuditEvent
+
+	balancesMu.Lock()
+	for id, a := range balanceAttestations {
+		if a.ExpiresAt == nil || a.expired(now) || a.ExpiresAt.Sub(now) > window {
+			continue
+		}
+		if remindedAttestations[id].Equal(*a.ExpiresAt) {
+			continue
+		}
+		remindedAttestations[id] = *a.ExpiresAt
+		due = append(due, AuditEvent{
+			Time:    now.UTC(),
+			Type:    auditAttestationExpiring,
+			Subject: id,
+			Detail:  fmt.Sprintf("%s attestation expires at %s", a.Source, a.ExpiresAt.Format(time.RFC3339)),
+		})
+	}
+	for id, expires := range remindedAttestations {
+		if a, ok := balanceAttestations[id]; !ok || a.ExpiresAt == nil || !a.ExpiresAt.Equal(expires) {
+			delete(remindedAttestations, id)
+		}
+	}
+	balancesMu.Unlock()
+
+	if notifications != nil {
+		for _, e := range due {
+			notifications.enqueue(e)
+		}
+	}
+	return len(due), nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+)
+
+// storeAttestedBalance stores a bank-attested balance that expires at expires
+func storeAttestedBalance(id string, amount int, expires time.Time) {
+	balancesMu.Lock()
+	setBalanceLocked(id, amount, time.Now())
+	balanceAttestations[id] = BalanceAttestation{ID: id, Source: "plaid", AccountID: "checking", ExpiresAt: &expires}
+	balancesMu.Unlock()
+}
+
+func TestAttestationExpiry(t *testing.T) {
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+
+	now := time.Now()
+	storeAttestedBalance("attested_current", 1000, now.Add(time.Hour))
+	storeAttestedBalance("attested_expired", 1000, now.Add(-time.Minute))
+	h.StoreBalance("self_reported", 1000)
+
+	tests := []struct {
+		id      string
+		expired bool
+	}{
+		{"attested_current", false},
+		{"attested_expired", true},
+		{"self_reported", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			if err := checkBalanceAttestation(tt.id, now); errors.Is(err, errAttestationExpired) != tt.expired {
+				t.Errorf("Expected expired=%v, got %v", tt.expired, err)
+			}
+			if _, ok := attributeValues(tt.id)["balance"]; ok == tt.expired {
+				t.Errorf("Expected the balance attribute to be present=%v", !tt.expired)
+			}
+		})
+	}
+
+	if _, _, err := proveBalance(context.Background(), ecc.BN254, "attested_expired", 10); !errors.Is(err, errAttestationExpired) {
+		t.Errorf("Expected proving an expired attested balance to fail with %v, got %v", errAttestationExpired, err)
+	}
+}
+
+func TestRemindExpiringAttestations(t *testing.T) {
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+	d := withNotifications(t, map[string]Notifier{})
+	t.Cleanup(func() {
+		balancesMu.Lock()
+		clear(remindedAttestations)
+		balancesMu.Unlock()
+	})
+
+	now := time.Now()
+	storeAttestedBalance("expiring_soon", 10, now.Add(time.Hour))
+	storeAttestedBalance("expiring_later", 10, now.Add(30*24*time.Hour))
+	storeAttestedBalance("already_expired", 10, now.Add(-time.Hour))
+
+	if n, _ := remindExpiringAttestations(now, 72*time.Hour); n != 1 {
+		t.Fatalf("Expected one reminder, got %d", n)
+	}
+	e := <-d.queue
+	if e.Type != auditAttestationExpiring || e.Subject != "expiring_soon" {
+		t.Errorf("Unexpected reminder %+v", e)
+	}
+	if n, _ := remindExpiringAttestations(now.Add(time.Minute), 72*time.Hour); n != 0 {
+		t.Errorf("Expected each attestation to be reminded once, got %d reminders", n)
+	}
+
+	// Re-attesting starts a new expiry, which is reminded again when it draws near
+	storeAttestedBalance("expiring_soon", 10, now.Add(2*time.Hour))
+	if n, _ := remindExpiringAttestations(now, 72*time.Hour); n != 1 {
+		t.Errorf("Expected the renewed attestation to be reminded, got %d reminders", n)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// userAttributes holds per-user attributes other than the balance, keyed by id then attribute name
+var (
+	userAttributes   = make(map[string]map[string]int64)
+	userAttributesMu sync.Mutex
+)
+
+type AttributeRequest struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Value int64  `json:"value"`
+}
+
+type CreditScoreRequest struct {
+	ID    string `json:"id"`
+	Score int    `json:"score"`
+}
+
+func setAttribute(id, name string, value int64) {
+	userAttributesMu.Lock()
+	defer userAttributesMu.Unlock()
+
+	attrs, ok := userAttributes[id]
+	if !ok {
+		attrs = make(map[string]int64)
+		userAttributes[id] = attrs
+	}
+	attrs[name] = value
+}
+
+// storeAttribute stores a named attribute (e.g. "age") for a user
+func storeAttribute(w http.ResponseWriter, r *http.Request) {
+	var req AttributeRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := checkSessionUser(r, req.ID); err != nil {
+		writeError(w, err)
+		return
+	}
+	if req.Name == "" || req.Name == "balance" {
+		writeError(w, errs.Errorf(errs.Invalid, "attribute name must be set and must not be %q", "balance"))
+		return
+	}
+
+	setAttribute(req.ID, req.Name, req.Value)
+	w.WriteHeader(http.StatusOK)
+}
+
+func storeCreditScore(w http.ResponseWriter, r *http.Request) {
+	var req CreditScoreRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := checkSessionUser(r, req.ID); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	setAttribute(req.ID, "creditScore", int64(req.Score))
+	w.WriteHeader(http.StatusOK)
+}
+
+// attributeValues returns the stored attributes of id, including its balance; unset attributes are omitted
+func attributeValues(id string) map[string]int64 {
+	values := make(map[string]int64)
+
+	userAttributesMu.Lock()
+	for name, v := range userAttributes[id] {
+		values[name] = v
+	}
+	userAttributesMu.Unlock()
+
+	balancesMu.Lock()
+	if b, ok := balances[id]; ok && !expiredAttestationLocked(id, time.Now()) {
+		values["balance"] = int64(b)
+	}
+	balancesMu.Unlock()
+
+	return values
+}
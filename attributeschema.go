@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// Types of schema attributes. Circuits compare integers, so dates and enums are stored encoded:
+// a date as the integer YYYYMMDD, which orders like the date, and an enum as the index of its
+// value in the schema, so the values compare in the order they are listed.
+const (
+	attributeInteger = "integer"
+	attributeDate    = "date"
+	attributeEnum    = "enum"
+)
+
+const (
+	// maxSchemaFields bounds the attributes of one schema
+	maxSchemaFields = 32
+	// maxEnumValues bounds the values of one enum attribute
+	maxEnumValues = 64
+)
+
+var (
+	errSchemaNotFound = errs.New(errs.NotFound, "schema_not_found", "attribute schema not found")
+	errNoAttributes   = errs.New(errs.NotFound, "attributes_not_found", "no attribute document stored for id")
+
+	// attributeNamePattern matches the attribute names predicate expressions can name
+	attributeNamePattern = regexp.MustCompile(`^[A-Za-z]+$`)
+)
+
+// AttributeField is one typed attribute of a schema
+type AttributeField struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`          // integer, date or enum
+	Min      *int64   `json:"min,omitempty"` // bounds of an integer; integers are never negative
+	Max      *int64   `json:"max,omitempty"`
+	Values   []string `json:"values,omitempty"` // values of an enum, in the order they compare in
+	Required bool     `json:"required,omitempty"`
+}
+
+// AttributeSchema types the attribute documents of users
+type AttributeSchema struct {
+	Name   string           `json:"name"`
+	Fields []AttributeField `json:"fields"`
+}
+
+// AttributeDocument holds the typed attributes of one user, validated against a registered schema.
+// Values are the attributes as circuits compare them and are set by the server.
+type AttributeDocument struct {
+	Schema     string                     `json:"schema"`
+	Attributes map[string]json.RawMessage `json:"attributes"`
+	Values     map[string]int64           `json:"values,omitempty"`
+}
+
+var (
+	attributeSchemas   = make(map[string]*AttributeSchema)
+	attributeSchemasMu sync.RWMutex
+
+	// attributeDocuments holds the last document stored for each user; its values are kept
+	// with the other attributes in userAttributes
+	attributeDocuments = make(map[string]*AttributeDocument)
+)
+
+func (s *AttributeSchema) check() error {
+	if s.Name == "" {
+		return errors.New("schema name must be set")
+	}
+	if len(s.Fields) == 0 || len(s.Fields) > maxSchemaFields {
+		return fmt.Errorf("a schema has 1 to %d fields", maxSchemaFields)
+	}
+	seen := make(map[string]bool, len(s.Fields))
+	for _, f := range s.Fields {
+		if !attributeNamePattern.MatchString(f.Name) {
+			return fmt.Errorf("field name %q must be letters only", f.Name)
+		}
+		if f.Name == "balance" || f.Name == "allowlist" {
+			return fmt.Errorf("field name %q is reserved", f.Name)
+		}
+		if seen[f.Name] {
+			return fmt.Errorf("duplicate field %q", f.Name)
+		}
+		seen[f.Name] = true
+
+		if f.Type != attributeInteger && (f.Min != nil || f.Max != nil) {
+			return fmt.Errorf("%s: only integers take min and max", f.Name)
+		}
+		if f.Type != attributeEnum && len(f.Values) > 0 {
+			return fmt.Errorf("%s: only enums take values", f.Name)
+		}
+		switch f.Type {
+		case attributeInteger:
+			if f.Min != nil && *f.Min < 0 {
+				return fmt.Errorf("%s: min must not be negative", f.Name)
+			}
+			if f.Min != nil && f.Max != nil && *f.Min > *f.Max {
+				return fmt.Errorf("%s: min is above max", f.Name)
+			}
+		case attributeDate:
+		case attributeEnum:
+			if len(f.Values) == 0 || len(f.Values) > maxEnumValues {
+				return fmt.Errorf("%s: an enum has 1 to %d values", f.Name, maxEnumValues)
+			}
+			for i, v := range f.Values {
+				if v == "" || slices.Contains(f.Values[:i], v) {
+					return fmt.Errorf("%s: enum values must be distinct and non-empty", f.Name)
+				}
+			}
+		default:
+			return fmt.Errorf("%s: unknown type %q, expected integer, date or enum", f.Name, f.Type)
+		}
+	}
+	return nil
+}
+
+// encode validates the attributes of a document and returns them as circuits compare them
+func (s *AttributeSchema) encode(attributes map[string]json.RawMessage) (map[string]int64, error) {
+	for name := range attributes {
+		if !slices.ContainsFunc(s.Fields, func(f AttributeField) bool { return f.Name == name }) {
+			return nil, fmt.Errorf("schema %q has no field %q", s.Name, name)
+		}
+	}
+	values := make(map[string]int64, len(attributes))
+	for _, f := range s.Fields {
+		raw, ok := attributes[f.Name]
+		if !ok {
+			if f.Required {
+				return nil, fmt.Errorf("%s is required", f.Name)
+			}
+			continue
+		}
+		v, err := f.encode(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		values[f.Name] = v
+	}
+	return values, nil
+}
+
+// encode validates one attribute value and returns it as circuits compare it
+func (f AttributeField) encode(raw json.RawMessage) (int64, error) {
+	switch f.Type {
+	case attributeInteger:
+		var v int64
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return 0, errors.New("expected an integer")
+		}
+		if v < 0 || f.Min != nil && v < *f.Min || f.Max != nil && v > *f.Max {
+			return 0, fmt.Errorf("%d is out of range", v)
+		}
+		return v, nil
+
+	case attributeDate:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return 0, errors.New("expected a date as YYYY-MM-DD")
+		}
+		d, err := time.Parse(time.DateOnly, s)
+		if err != nil {
+			return 0, errors.New("expected a date as YYYY-MM-DD")
+		}
+		return int64(d.Year()*10000 + int(d.Month())*100 + d.Day()), nil
+
+	default:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return 0, fmt.Errorf("expected one of %s", strings.Join(f.Values, ", "))
+		}
+		i := slices.Index(f.Values, s)
+		if i < 0 {
+			return 0, fmt.Errorf("expected one of %s", strings.Join(f.Values, ", "))
+		}
+		return int64(i), nil
+	}
+}
+
+func lookupAttributeSchema(name string) (*AttributeSchema, error) {
+	attributeSchemasMu.RLock()
+	defer attributeSchemasMu.RUnlock()
+
+	s, ok := attributeSchemas[name]
+	if !ok {
+		return nil, errSchemaNotFound
+	}
+	return s, nil
+}
+
+// schemaAttribute reports whether a registered schema has an attribute called name
+func schemaAttribute(name string) bool {
+	attributeSchemasMu.RLock()
+	defer attributeSchemasMu.RUnlock()
+
+	for _, s := range attributeSchemas {
+		if slices.ContainsFunc(s.Fields, func(f AttributeField) bool { return f.Name == name }) {
+			return true
+		}
+	}
+	return false
+}
+
+// putAttributeSchema registers or replaces an attribute schema. Documents already stored keep
+// their values until they are stored again.
+func putAttributeSchema(w http.ResponseWriter, r *http.Request) {
+	var s AttributeSchema
+	if err := decodeJSON(w, r, &s); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	s.Name = r.PathValue("name")
+	if err := s.check(); err != nil {
+		writeError(w, errs.Wrap(errs.Invalid, err))
+		return
+	}
+
+	attributeSchemasMu.Lock()
+	attributeSchemas[s.Name] = &s
+	attributeSchemasMu.Unlock()
+
+	audit.record(AuditEvent{Type: auditSchemaUpdated, Subject: s.Name})
+
+	writeJSON(w, &s)
+}
+
+func getAttributeSchema(w http.ResponseWriter, r *http.Request) {
+	s, err := lookupAttributeSchema(r.PathValue("name"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, s)
+}
+
+// putAttributes stores the typed attributes of a user, replacing the attributes of the
+// document stored before. The values are what composite proofs and statements compare.
+func putAttributes(w http.ResponseWriter, r *http.Request) {
+	var doc AttributeDocument
+	if err := decodeJSON(w, r, &doc); err != nil {
+		writeError(w, err)
+		return
+	}
+	id := r.PathValue("userID")
+	if err := checkSessionUser(r, id); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	schema, err := lookupAttributeSchema(doc.Schema)
+	if err != nil {
+		// The schema is named in the request body rather than the path
+		writeError(w, errs.Errorf(errs.Invalid, "%w", err))
+		return
+	}
+	if doc.Values, err = schema.encode(doc.Attributes); err != nil {
+		writeError(w, errs.Wrap(errs.Invalid, err))
+		return
+	}
+
+	userAttributesMu.Lock()
+	attrs, ok := userAttributes[id]
+	if !ok {
+		attrs = make(map[string]int64)
+		userAttributes[id] = attrs
+	}
+	if previous, ok := attributeDocuments[id]; ok {
+		for name := range previous.Values {
+			delete(attrs, name)
+		}
+	}
+	for name, v := range doc.Values {
+		attrs[name] = v
+	}
+	attributeDocuments[id] = &doc
+	userAttributesMu.Unlock()
+
+	writeJSON(w, &doc)
+}
+
+// getAttributes returns the document last stored for a user, to that user only
+func getAttributes(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("userID")
+	if err := checkReader(r, id); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	userAttributesMu.Lock()
+	doc, ok := attributeDocuments[id]
+	userAttributesMu.Unlock()
+	if !ok {
+		writeError(w, errNoAttributes)
+		return
+	}
+	writeJSON(w, doc)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func int64p(v int64) *int64 { return &v }
+
+func TestAttributeSchemaCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		field       AttributeField
+		expectError bool
+	}{
+		{"Integer", AttributeField{Name: "age", Type: "integer", Min: int64p(0), Max: int64p(150)}, false},
+		{"Date", AttributeField{Name: "licenseExpiry", Type: "date", Required: true}, false},
+		{"Enum", AttributeField{Name: "tier", Type: "enum", Values: []string{"basic", "gold"}}, false},
+		{"Unknown type", AttributeField{Name: "age", Type: "float"}, true},
+		{"Reserved name", AttributeField{Name: "balance", Type: "integer"}, true},
+		{"Name not usable in predicates", AttributeField{Name: "credit_score", Type: "integer"}, true},
+		{"Negative min", AttributeField{Name: "age", Type: "integer", Min: int64p(-1)}, true},
+		{"Inverted bounds", AttributeField{Name: "age", Type: "integer", Min: int64p(10), Max: int64p(5)}, true},
+		{"Date with bounds", AttributeField{Name: "born", Type: "date", Max: int64p(5)}, true},
+		{"Enum without values", AttributeField{Name: "tier", Type: "enum"}, true},
+		{"Repeated enum value", AttributeField{Name: "tier", Type: "enum", Values: []string{"gold", "gold"}}, true},
+		{"Integer with values", AttributeField{Name: "age", Type: "integer", Values: []string{"1"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := AttributeSchema{Name: "kyc", Fields: []AttributeField{tt.field}}
+			if err := s.check(); (err != nil) != tt.expectError {
+				t.Errorf("check() error = %v, expectError %v", err, tt.expectError)
+			}
+		})
+	}
+
+	duplicate := AttributeSchema{Name: "kyc", Fields: []AttributeField{{Name: "age", Type: "integer"}, {Name: "age", Type: "date"}}}
+	if err := duplicate.check(); err == nil {
+		t.Error("Expected duplicate fields to be rejected")
+	}
+}
+
+func putAttributesRequest(t *testing.T, handler http.HandlerFunc, method, path, key, value string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, path, bytes.NewReader(data))
+	req.SetPathValue(key, value)
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	return rr
+}
+
+func TestAttributeDocuments(t *testing.T) {
+	h := NewTestHelper(t)
+	t.Cleanup(func() {
+		attributeSchemas = make(map[string]*AttributeSchema)
+		attributeDocuments = make(map[string]*AttributeDocument)
+		userAttributes = make(map[string]map[string]int64)
+	})
+
+	schema := AttributeSchema{Fields: []AttributeField{
+		{Name: "age", Type: "integer", Max: int64p(150), Required: true},
+		{Name: "licenseExpiry", Type: "date"},
+		{Name: "tier", Type: "enum", Values: []string{"basic", "silver", "gold"}},
+	}}
+	rr := putAttributesRequest(t, putAttributeSchema, "PUT", "/admin/attribute-schemas/kyc", "name", "kyc", schema)
+	h.AssertStatusCode(rr, http.StatusOK, "registering a schema")
+	rr = putAttributesRequest(t, getAttributeSchema, "GET", "/attribute-schemas/kyc", "name", "kyc", nil)
+	h.AssertStatusCode(rr, http.StatusOK, "getting a schema")
+
+	doc := AttributeDocument{Schema: "kyc", Attributes: map[string]json.RawMessage{
+		"age":           json.RawMessage(`41`),
+		"licenseExpiry": json.RawMessage(`"2027-03-31"`),
+		"tier":          json.RawMessage(`"silver"`),
+	}}
+	rr = putAttributesRequest(t, putAttributes, "PUT", "/attributes/erin", "userID", "erin", doc)
+	h.AssertStatusCode(rr, http.StatusOK, "storing a document")
+	values := attributeValues("erin")
+	if values["age"] != 41 || values["licenseExpiry"] != 20270331 || values["tier"] != 1 {
+		t.Errorf("Expected encoded attributes, got %v", values)
+	}
+
+	// A new document replaces the attributes of the previous one
+	doc.Attributes = map[string]json.RawMessage{"age": json.RawMessage(`42`)}
+	rr = putAttributesRequest(t, putAttributes, "PUT", "/attributes/erin", "userID", "erin", doc)
+	h.AssertStatusCode(rr, http.StatusOK, "replacing a document")
+	if values := attributeValues("erin"); len(values) != 1 || values["age"] != 42 {
+		t.Errorf("Expected only the new attributes, got %v", values)
+	}
+	// Documents are only read for their user, here with a token issued to them
+	readAs := func(subject string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			getAttributes(w, r.WithContext(withAccessToken(r.Context(), &accessToken{Subject: subject})))
+		}
+	}
+	rr = putAttributesRequest(t, readAs("erin"), "GET", "/attributes/erin", "userID", "erin", nil)
+	h.AssertStatusCode(rr, http.StatusOK, "getting a document")
+	var stored AttributeDocument
+	if err := json.Unmarshal(rr.Body.Bytes(), &stored); err != nil || string(stored.Attributes["age"]) != "42" || stored.Values["age"] != 42 {
+		t.Errorf("Expected the stored document, got %s", rr.Body.String())
+	}
+	rr = putAttributesRequest(t, readAs("frank"), "GET", "/attributes/frank", "userID", "frank", nil)
+	h.AssertStatusCode(rr, http.StatusNotFound, "user without a document")
+	rr = putAttributesRequest(t, readAs("frank"), "GET", "/attributes/erin", "userID", "erin", nil)
+	h.AssertStatusCode(rr, http.StatusForbidden, "another user's document")
+	rr = putAttributesRequest(t, getAttributes, "GET", "/attributes/erin", "userID", "erin", nil)
+	h.AssertStatusCode(rr, http.StatusUnauthorized, "an anonymous read")
+
+	invalid := map[string]AttributeDocument{
+		"Unknown schema":    {Schema: "other", Attributes: map[string]json.RawMessage{"age": json.RawMessage(`41`)}},
+		"Unknown attribute": {Schema: "kyc", Attributes: map[string]json.RawMessage{"age": json.RawMessage(`41`), "height": json.RawMessage(`180`)}},
+		"Missing required":  {Schema: "kyc", Attributes: map[string]json.RawMessage{"tier": json.RawMessage(`"gold"`)}},
+		"Above max":         {Schema: "kyc", Attributes: map[string]json.RawMessage{"age": json.RawMessage(`151`)}},
+		"Negative":          {Schema: "kyc", Attributes: map[string]json.RawMessage{"age": json.RawMessage(`-1`)}},
+		"Not a date":        {Schema: "kyc", Attributes: map[string]json.RawMessage{"age": json.RawMessage(`41`), "licenseExpiry": json.RawMessage(`"31/03/2027"`)}},
+		"Not an enum value": {Schema: "kyc", Attributes: map[string]json.RawMessage{"age": json.RawMessage(`41`), "tier": json.RawMessage(`"platinum"`)}},
+	}
+	for name, doc := range invalid {
+		rr := putAttributesRequest(t, putAttributes, "PUT", "/attributes/erin", "userID", "erin", doc)
+		h.AssertStatusCode(rr, http.StatusBadRequest, name)
+	}
+
+	// Schema attributes are threshold predicates of composite proofs
+	policy, err := parseCompositePolicy([]PredicateSpec{{Name: "tier", Threshold: 1}, {Name: "age", Threshold: 18}})
+	if err != nil {
+		t.Fatalf("Expected schema attributes to be predicates, got %v", err)
+	}
+	if got := policy.circuitName(); got != "composite/age+tier" {
+		t.Errorf("Unexpected circuit name %q", got)
+	}
+	if _, err := parseCompositePolicy([]PredicateSpec{{Name: "height", Threshold: 1}}); err == nil {
+		t.Error("Expected an attribute of no schema to be rejected")
+	}
+}
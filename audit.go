@@ -0,0 +1,373 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// Audit event types
+const (
+	auditProofIssued      = "proof.issued"
+	auditProofVerified    = "proof.verified"
+	auditProofRejected    = "proof.rejected"
+	auditProofRevoked     = "proof.revoked"
+	auditPolicyAccepted   = "policy.accepted"
+	auditPolicyDenied     = "policy.denied"
+	auditPolicyUpdated    = "policy.updated"
+	auditAllowlistUpdated = "allowlist.updated"
+	auditFlagUpdated      = "flag.updated"
+	auditBalanceDeleted   = "balance.deleted"
+	auditBalanceRestored  = "balance.restored"
+	auditBalanceStored    = "balance.stored"
+	auditLedgerPosted     = "ledger.posted"
+	auditPeerUpdated      = "peer.updated"
+	auditStatementUpdated = "statement.updated"
+	auditSchemaUpdated    = "schema.updated"
+	auditConsentGranted   = "consent.granted"
+	auditConsentRevoked   = "consent.revoked"
+	auditPeerRemoved      = "peer.removed"
+	auditKeyRotated       = "key.rotated"
+	auditUserErased       = "user.erased"
+	auditProbeSuspected   = "probe.suspected"
+)
+
+// auditCapacity is the number of most recent events kept for export
+const auditCapacity = 10000
+
+// AuditEvent is one security-relevant event. Events never carry balances, thresholds or user ids.
+type AuditEvent struct {
+	Seq     int64     `json:"seq"`
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Circuit string    `json:"circuit,omitempty"`
+	Digest  string    `json:"digest,omitempty"`  // proof digest
+	Subject string    `json:"subject,omitempty"` // policy or allowlist name
+	Detail  string    `json:"detail,omitempty"`
+}
+
+// auditLog keeps the most recent events in memory and forwards every event to its sinks
+type auditLog struct {
+	mu     sync.Mutex
+	events []AuditEvent // ring buffer of at most max events
+	next   int
+	seq    int64
+	max    int
+	sinks  []func(AuditEvent)
+}
+
+func newAuditLog(max int) *auditLog {
+	return &auditLog{max: max}
+}
+
+var audit = newAuditLog(auditCapacity)
+
+// record timestamps and numbers an event, keeps it and passes it to the sinks
+func (a *auditLog) record(e AuditEvent) {
+	a.mu.Lock()
+	a.seq++
+	e.Seq = a.seq
+	e.Time = time.Now().UTC()
+	if len(a.events) < a.max {
+		a.events = append(a.events, e)
+	} else {
+		a.events[a.next] = e
+		a.next = (a.next + 1) % a.max
+	}
+	sinks := a.sinks
+	a.mu.Unlock()
+
+	for _, sink := range sinks {
+		sink(e)
+	}
+}
+
+// addSink forwards every future event to sink, which must not block
+func (a *auditLog) addSink(sink func(AuditEvent)) {
+	a.mu.Lock()
+	a.sinks = append(a.sinks, sink)
+	a.mu.Unlock()
+}
+
+// redact replaces digests and subjects of the kept events by what replacements maps them to and
+// returns how many events changed. Events already passed to sinks are not recalled.
+func (a *auditLog) redact(replacements map[string]string) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	changed := 0
+	for i := range a.events {
+		e := &a.events[i]
+		digest, redactDigest := replacements[e.Digest]
+		subject, redactSubject := replacements[e.Subject]
+		if redactDigest {
+			e.Digest = digest
+		}
+		if redactSubject {
+			e.Subject = subject
+		}
+		if redactDigest || redactSubject {
+			changed++
+		}
+	}
+	return changed
+}
+
+// since returns the kept events with a sequence number greater than after, oldest first
+func (a *auditLog) since(after int64) []AuditEvent {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ordered := append(append([]AuditEvent(nil), a.events[a.next:]...), a.events[:a.next]...)
+	for i, e := range ordered {
+		if e.Seq > after {
+			return ordered[i:]
+		}
+	}
+	return nil
+}
+
+// latest returns the n most recent kept events, newest first
+func (a *auditLog) latest(n int) []AuditEvent {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	n = min(n, len(a.events))
+	events := make([]AuditEvent, 0, n)
+	for i := 1; i <= n; i++ {
+		events = append(events, a.events[(a.next-i+len(a.events))%len(a.events)])
+	}
+	return events
+}
+
+// auditVerification records the outcome of verifying a proof
+func auditVerification(circuit string, proof groth16.Proof, err error) {
+	e := AuditEvent{Type: auditProofVerified, Circuit: circuit}
+	e.Digest, _ = proofDigest(proof)
+	if err != nil {
+		e.Type = auditProofRejected
+		e.Detail = err.Error()
+	}
+	audit.record(e)
+}
+
+// auditCSVHeader lists the CSV export columns
+var auditCSVHeader = []string{"seq", "time", "type", "circuit", "digest", "subject", "detail"}
+
+func writeAuditCSV(w io.Writer, events []AuditEvent) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(auditCSVHeader); err != nil {
+		return err
+	}
+	for _, e := range events {
+		if err := cw.Write([]string{
+			strconv.FormatInt(e.Seq, 10), e.Time.Format(time.RFC3339Nano), e.Type, e.Circuit, e.Digest, e.Subject, e.Detail,
+		}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Syslog facility "log audit" (13) with informational or warning severity
+const (
+	syslogFacilityAudit = 13
+	syslogInfo          = 6
+	syslogWarning       = 4
+)
+
+var syslogParamEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+// formatSyslog renders an event as an RFC 5424 message with the fields as structured data
+func formatSyslog(e AuditEvent, hostname string) string {
+	severity := syslogInfo
+	if e.Type == auditProofRejected || e.Type == auditPolicyDenied {
+		severity = syslogWarning
+	}
+
+	var sd strings.Builder
+	sd.WriteString("[audit@32473")
+	for _, p := range [][2]string{
+		{"seq", strconv.FormatInt(e.Seq, 10)}, {"type", e.Type}, {"circuit", e.Circuit}, {"digest", e.Digest}, {"subject", e.Subject},
+	} {
+		if p[1] != "" {
+			fmt.Fprintf(&sd, ` %s="%s"`, p[0], syslogParamEscaper.Replace(p[1]))
+		}
+	}
+	sd.WriteString("]")
+
+	msg := e.Type
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	return fmt.Sprintf("<%d>1 %s %s zktest1 %d %s %s %s",
+		syslogFacilityAudit*8+severity, e.Time.Format(time.RFC3339Nano), hostname, os.Getpid(), e.Type, sd.String(), msg)
+}
+
+// exportAudit returns audit events as JSON, CSV or syslog lines, optionally only those after a sequence number
+func exportAudit(w http.ResponseWriter, r *http.Request) {
+	var after int64
+	if v := r.URL.Query().Get("after"); v != "" {
+		var err error
+		if after, err = strconv.ParseInt(v, 10, 64); err != nil {
+			writeError(w, errs.Errorf(errs.Invalid, "after must be a sequence number"))
+			return
+		}
+	}
+	events := audit.since(after)
+
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+		if events == nil {
+			events = []AuditEvent{}
+		}
+		writeJSON(w, events)
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="audit.csv"`)
+		if err := writeAuditCSV(w, events); err != nil {
+			log.Printf("Failed to write audit export: %v", err)
+		}
+	case "syslog":
+		hostname, _ := os.Hostname()
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, e := range events {
+			fmt.Fprintln(w, formatSyslog(e, hostname))
+		}
+	default:
+		writeError(w, errs.Errorf(errs.Invalid, "format must be json, csv or syslog"))
+	}
+}
+
+// AuditShipConfig configures forwarding of audit events to a SIEM collector
+type AuditShipConfig struct {
+	URL    string // tcp://host:port or udp://host:port; empty disables shipping
+	Format string // "syslog" (RFC 5424) or "json" (one object per line)
+}
+
+// auditShipQueue bounds the events waiting to be shipped; newer events are dropped when it is full
+const auditShipQueue = 1024
+
+// auditShipper sends audit events to a collector over TCP or UDP, reconnecting as needed
+type auditShipper struct {
+	network, addr string
+	format        func(AuditEvent) ([]byte, error)
+	queue         chan AuditEvent
+	dropped       atomic.Int64
+	dialTimeout   time.Duration
+	retryDelay    time.Duration
+}
+
+func newAuditShipper(cfg AuditShipConfig) (*auditShipper, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "tcp" && u.Scheme != "udp") || u.Host == "" {
+		return nil, fmt.Errorf("audit ship URL must be tcp://host:port or udp://host:port, got %q", cfg.URL)
+	}
+
+	s := &auditShipper{
+		network:     u.Scheme,
+		addr:        u.Host,
+		queue:       make(chan AuditEvent, auditShipQueue),
+		dialTimeout: 5 * time.Second,
+		retryDelay:  time.Second,
+	}
+	switch cfg.Format {
+	case "", "syslog":
+		hostname, _ := os.Hostname()
+		s.format = func(e AuditEvent) ([]byte, error) { return []byte(formatSyslog(e, hostname) + "\n"), nil }
+	case "json":
+		s.format = func(e AuditEvent) ([]byte, error) {
+			data, err := json.Marshal(e)
+			return append(data, '\n'), err
+		}
+	default:
+		return nil, fmt.Errorf("unknown audit ship format %q", cfg.Format)
+	}
+	return s, nil
+}
+
+// enqueue is the audit log sink; it never blocks request handling
+func (s *auditShipper) enqueue(e AuditEvent) {
+	select {
+	case s.queue <- e:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// run ships queued events until stop is closed. An event that cannot be written is
+// retried once on a fresh connection, then dropped.
+func (s *auditShipper) run(stop <-chan struct{}) {
+	var conn net.Conn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case e := <-s.queue:
+			line, err := s.format(e)
+			if err != nil {
+				s.dropped.Add(1)
+				continue
+			}
+			for attempt := 0; ; attempt++ {
+				if conn == nil {
+					if conn, err = net.DialTimeout(s.network, s.addr, s.dialTimeout); err != nil {
+						conn = nil
+					}
+				}
+				if conn != nil {
+					if _, err = conn.Write(line); err == nil {
+						break
+					}
+					conn.Close()
+					conn = nil
+				}
+				if attempt == 1 {
+					s.dropped.Add(1)
+					log.Printf("Dropping audit event %d: %v", e.Seq, err)
+					break
+				}
+				select {
+				case <-stop:
+					return
+				case <-time.After(s.retryDelay):
+				}
+			}
+		}
+	}
+}
+
+// auditShip is the running shipper, nil when shipping is disabled
+var auditShip *auditShipper
+
+// startAuditShipper forwards audit events to the configured collector until stop is closed
+func startAuditShipper(cfg AuditShipConfig, stop <-chan struct{}) (*auditShipper, error) {
+	s, err := newAuditShipper(cfg)
+	if err != nil {
+		return nil, err
+	}
+	audit.addSink(s.enqueue)
+	go s.run(stop)
+	return s, nil
+}
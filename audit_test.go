@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditLogRing(t *testing.T) {
+	a := newAuditLog(3)
+	var shipped []string
+	a.addSink(func(e AuditEvent) { shipped = append(shipped, e.Type) })
+
+	for _, typ := range []string{"a", "b", "c", "d", "e"} {
+		a.record(AuditEvent{Type: typ})
+	}
+
+	events := a.since(0)
+	if len(events) != 3 || events[0].Type != "c" || events[2].Type != "e" || events[2].Seq != 5 {
+		t.Errorf("Expected the 3 most recent events in order, got %+v", events)
+	}
+	if got := a.since(4); len(got) != 1 || got[0].Type != "e" {
+		t.Errorf("Expected only events after seq 4, got %+v", got)
+	}
+	if got := a.since(5); got != nil {
+		t.Errorf("Expected no events after the latest, got %+v", got)
+	}
+	if got := a.latest(2); len(got) != 2 || got[0].Type != "e" || got[1].Type != "d" {
+		t.Errorf("Expected the 2 latest events newest first, got %+v", got)
+	}
+	if got := newAuditLog(3).latest(2); got == nil || len(got) != 0 {
+		t.Errorf("Expected no latest events from an empty log, got %+v", got)
+	}
+	if len(shipped) != 5 {
+		t.Errorf("Expected every event to reach the sink, got %v", shipped)
+	}
+}
+
+func TestFormatSyslog(t *testing.T) {
+	e := AuditEvent{
+		Seq:     7,
+		Time:    time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC),
+		Type:    auditPolicyDenied,
+		Subject: `kyc "strict"]`,
+		Detail:  "proof has expired",
+	}
+	got := formatSyslog(e, "zk-1")
+
+	if !strings.HasPrefix(got, "<108>1 2025-03-01T12:00:00Z zk-1 zktest1 ") {
+		t.Errorf("Expected an RFC 5424 header with warning severity, got %q", got)
+	}
+	if !strings.Contains(got, ` policy.denied [audit@32473 seq="7" type="policy.denied" subject="kyc \"strict\"\]"] policy.denied: proof has expired`) {
+		t.Errorf("Expected escaped structured data and message, got %q", got)
+	}
+}
+
+func TestExportAudit(t *testing.T) {
+	previous := audit
+	t.Cleanup(func() { audit = previous })
+	audit = newAuditLog(10)
+
+	audit.record(AuditEvent{Type: auditProofIssued, Circuit: "balance", Digest: strings.Repeat("a", 64)})
+	audit.record(AuditEvent{Type: auditProofRejected, Circuit: "balance", Detail: "invalid proof, retry"})
+
+	tests := []struct {
+		query       string
+		wantStatus  int
+		contentType string
+	}{
+		{"", http.StatusOK, "application/json"},
+		{"?format=csv", http.StatusOK, "text/csv"},
+		{"?format=syslog&after=1", http.StatusOK, "text/plain; charset=utf-8"},
+		{"?format=xml", http.StatusBadRequest, ""},
+		{"?after=yesterday", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			exportAudit(rr, httptest.NewRequest("GET", "/admin/audit"+tt.query, nil))
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, rr.Code, rr.Body.String())
+			}
+			if tt.contentType != "" && rr.Header().Get("Content-Type") != tt.contentType {
+				t.Errorf("Expected content type %s, got %s", tt.contentType, rr.Header().Get("Content-Type"))
+			}
+		})
+	}
+
+	rr := httptest.NewRecorder()
+	exportAudit(rr, httptest.NewRequest("GET", "/admin/audit?format=csv", nil))
+	records, err := csv.NewReader(rr.Body).ReadAll()
+	if err != nil || len(records) != 3 || records[2][2] != auditProofRejected || records[2][6] != "invalid proof, retry" {
+		t.Errorf("Unexpected CSV export: %v, %v", records, err)
+	}
+
+	rr = httptest.NewRecorder()
+	exportAudit(rr, httptest.NewRequest("GET", "/admin/audit?format=syslog&after=1", nil))
+	if lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n"); len(lines) != 1 || !strings.Contains(lines[0], "proof.rejected") {
+		t.Errorf("Expected one syslog line after seq 1, got %q", rr.Body.String())
+	}
+}
+
+func TestAuditShipper(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	received := make(chan string, 2)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			received <- scanner.Text()
+		}
+	}()
+
+	shipper, err := newAuditShipper(AuditShipConfig{URL: "tcp://" + ln.Addr().String(), Format: "json"})
+	if err != nil {
+		t.Fatalf("Failed to create shipper: %v", err)
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go shipper.run(stop)
+
+	shipper.enqueue(AuditEvent{Seq: 1, Type: auditProofRevoked, Digest: strings.Repeat("b", 64)})
+
+	select {
+	case line := <-received:
+		var e AuditEvent
+		if err := json.Unmarshal([]byte(line), &e); err != nil || e.Type != auditProofRevoked {
+			t.Errorf("Unexpected shipped line %q: %v", line, err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the event to be shipped")
+	}
+
+	for _, bad := range []AuditShipConfig{{URL: "http://siem:514"}, {URL: "tcp://siem:514", Format: "cef"}} {
+		if _, err := newAuditShipper(bad); err == nil {
+			t.Errorf("Expected %+v to be rejected", bad)
+		}
+	}
+}
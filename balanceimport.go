@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// Limits of one bulk import
+const (
+	maxImportBytes = 32 << 20
+	maxImportRows  = 100000
+)
+
+// BalanceImportRow is one row of a bulk import; in CSV, the header names the columns "id" and "amount"
+type BalanceImportRow struct {
+	ID     string `json:"id"`
+	Amount int    `json:"amount"`
+}
+
+// ImportRowResult reports what happened to one row; rows are numbered from 1 in upload order, without the CSV header and blank lines
+type ImportRowResult struct {
+	Row    int    `json:"row"`
+	ID     string `json:"id,omitempty"`
+	Status string `json:"status"` // "imported" or "rejected"
+	Error  string `json:"error,omitempty"`
+}
+
+// BalanceImportResponse is returned by POST /admin/balances/import
+type BalanceImportResponse struct {
+	Imported int               `json:"imported"`
+	Rejected int               `json:"rejected"`
+	Rows     []ImportRowResult `json:"rows"`
+}
+
+// importRow is a parsed row, or the reason it could not be parsed
+type importRow struct {
+	BalanceImportRow
+	err error
+}
+
+// parseImportCSV reads rows from CSV with an "id,amount" header, in either order
+func parseImportCSV(r io.Reader) ([]importRow, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading the CSV header: %w", err)
+	}
+	idCol, amountCol := -1, -1
+	for i, name := range header {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "id":
+			idCol = i
+		case "amount":
+			amountCol = i
+		}
+	}
+	if idCol < 0 || amountCol < 0 {
+		return nil, errors.New(`the CSV header must name the columns "id" and "amount"`)
+	}
+
+	var rows []importRow
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if len(rows) == maxImportRows {
+			return nil, fmt.Errorf("an import takes at most %d rows", maxImportRows)
+		}
+		var row importRow
+		switch {
+		case err != nil:
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, err
+			}
+			row.err = parseErr.Err
+		case len(record) != len(header):
+			row.err = fmt.Errorf("expected %d fields, got %d", len(header), len(record))
+		default:
+			row.ID = strings.TrimSpace(record[idCol])
+			if row.Amount, err = strconv.Atoi(strings.TrimSpace(record[amountCol])); err != nil {
+				row.err = errors.New("amount must be an integer")
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+// parseImportJSONLines reads one JSON object per line; blank lines are skipped
+func parseImportJSONLines(r io.Reader) ([]importRow, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), 64<<10)
+
+	var rows []importRow
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if len(rows) == maxImportRows {
+			return nil, fmt.Errorf("an import takes at most %d rows", maxImportRows)
+		}
+		var row importRow
+		row.err = unmarshalStrict(line, &row.BalanceImportRow)
+		rows = append(rows, row)
+	}
+	return rows, scanner.Err()
+}
+
+// checkImportRow validates a parsed row; ids seen earlier in the same upload are rejected
+func checkImportRow(row importRow, seen map[string]int) error {
+	switch {
+	case row.err != nil:
+		return row.err
+	case row.ID == "":
+		return errors.New("id is required")
+	case isSystemAccount(row.ID):
+		return errors.New("system accounts cannot be imported")
+	case row.Amount < 0:
+		return errors.New("amount must not be negative")
+	}
+	if first, ok := seen[row.ID]; ok {
+		return fmt.Errorf("id already imported from row %d", first)
+	}
+	return nil
+}
+
+// importBalances stores balances from a CSV (text/csv) or JSON-lines (application/x-ndjson)
+// upload. Valid rows are stored like /store/sum, replacing existing balances; invalid rows are
+// reported and skipped.
+func importBalances(w http.ResponseWriter, r *http.Request) {
+	body := http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var rows []importRow
+	var err error
+	switch mediaType {
+	case "text/csv":
+		rows, err = parseImportCSV(body)
+	case "application/x-ndjson", "application/jsonl", "application/json":
+		rows, err = parseImportJSONLines(body)
+	default:
+		writeError(w, errs.Errorf(errs.Invalid, "Content-Type must be text/csv or application/x-ndjson"))
+		return
+	}
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, errs.Errorf(errs.Invalid, "an import takes at most %d bytes", maxImportBytes))
+			return
+		}
+		writeError(w, errs.Wrap(errs.Invalid, err))
+		return
+	}
+
+	resp := BalanceImportResponse{Rows: make([]ImportRowResult, len(rows))}
+	seen := make(map[string]int, len(rows))
+	now := time.Now()
+
+	balancesMu.Lock()
+	for i, row := range rows {
+		result := ImportRowResult{Row: i + 1, ID: row.ID}
+		if err := checkImportRow(row, seen); err != nil {
+			result.Status, result.Error = "rejected", err.Error()
+			resp.Rejected++
+		} else {
+			setBalanceLocked(row.ID, row.Amount, now)
+			delete(balanceAttestations, row.ID) // imported balances are not attested
+			seen[row.ID] = i + 1
+			result.Status = "imported"
+			resp.Imported++
+		}
+		resp.Rows[i] = result
+	}
+	balancesMu.Unlock()
+
+	if resp.Imported > 0 {
+		audit.record(AuditEvent{Type: auditBalanceStored, Detail: fmt.Sprintf("imported %d", resp.Imported)})
+	}
+	writeJSON(w, resp)
+}
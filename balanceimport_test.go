@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func postImport(t *testing.T, contentType, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/admin/balances/import", strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	rr := httptest.NewRecorder()
+	importBalances(rr, req)
+	return rr
+}
+
+func TestImportBalances(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		imported    map[string]int
+		rejected    map[int]string // row to error fragment
+	}{
+		{
+			name:        "CSV",
+			contentType: "text/csv",
+			body:        "amount,id\n1000,imp_alice\n250, imp_bob\n",
+			imported:    map[string]int{"imp_alice": 1000, "imp_bob": 250},
+		},
+		{
+			name:        "JSON lines",
+			contentType: "application/x-ndjson",
+			body:        `{"id": "imp_alice", "amount": 1000}` + "\n\n" + `{"id": "imp_bob", "amount": 250}`,
+			imported:    map[string]int{"imp_alice": 1000, "imp_bob": 250},
+		},
+		{
+			name:        "CSV row errors",
+			contentType: "text/csv; charset=utf-8",
+			body:        "id,amount\nimp_alice,1000\nimp_bob,lots\n,5\nimp_carol,-1\nimp_alice,7\n@adjustment,1\nimp_dave\n",
+			imported:    map[string]int{"imp_alice": 1000},
+			rejected: map[int]string{
+				2: "integer", 3: "id is required", 4: "negative", 5: "from row 1", 6: "system accounts", 7: "expected 2 fields",
+			},
+		},
+		{
+			name:        "JSON lines row errors",
+			contentType: "application/x-ndjson",
+			body:        `{"id": "imp_alice", "amount": 1000}` + "\n" + `{"id": "imp_bob", "amount": 1, "extra": true}` + "\n" + `not json`,
+			imported:    map[string]int{"imp_alice": 1000},
+			rejected:    map[int]string{2: "extra", 3: "malformed JSON"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewTestHelper(t)
+			h.SetupCleanBalances()
+
+			rr := postImport(t, tt.contentType, tt.body)
+			h.AssertStatusCode(rr, http.StatusOK, "importing balances")
+			var resp BalanceImportResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.Imported != len(tt.imported) || resp.Rejected != len(tt.rejected) {
+				t.Errorf("Expected %d imported and %d rejected, got %+v", len(tt.imported), len(tt.rejected), resp)
+			}
+			for _, row := range resp.Rows {
+				want, rejected := tt.rejected[row.Row]
+				if rejected != (row.Status == "rejected") || !strings.Contains(row.Error, want) {
+					t.Errorf("Unexpected result for row %d: %+v", row.Row, row)
+				}
+			}
+			for id, amount := range tt.imported {
+				h.AssertBalanceStored(id, amount)
+			}
+		})
+	}
+}
+
+func TestImportBalancesRefused(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+	}{
+		{"Unknown content type", "application/xml", "<balances/>"},
+		{"CSV without amount column", "text/csv", "id,balance\nimp_alice,10\n"},
+		{"Empty CSV", "text/csv", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rr := postImport(t, tt.contentType, tt.body); rr.Code != http.StatusBadRequest {
+				t.Errorf("Expected 400, got %d: %s", rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// anyVersion is the expected version of "If-Match: *", which matches any existing balance
+const anyVersion = -1
+
+// balanceVersions holds the version of every stored balance; guarded by balancesMu.
+// Versions come from one counter, so a deleted and re-created balance never reuses a version.
+var (
+	balanceVersions    = make(map[string]int64)
+	lastBalanceVersion int64
+)
+
+// requireBalancePrecondition makes If-Match (or expectedVersion) mandatory when updating an existing balance
+var requireBalancePrecondition bool
+
+var (
+	errVersionConflict      = errs.New(errs.Conflict, "version_conflict", "balance was modified by another client")
+	errPreconditionRequired = errs.New(errs.PreconditionRequired, "precondition_required", "updating a balance requires If-Match or expectedVersion")
+)
+
+// setBalanceLocked sets the balance of id to amount, posting the difference against the adjustment
+// account, and returns its new version; callers must hold balancesMu
+func setBalanceLocked(id string, amount int, now time.Time) int64 {
+	if diff := amount - ledgerBalances[id]; diff != 0 {
+		appendLedgerLocked("balance set", []LedgerEntry{{Account: id, Amount: diff}, {Account: adjustmentAccount, Amount: -diff}}, now)
+	}
+	return projectBalanceLocked(id, amount, now)
+}
+
+// projectBalanceLocked updates the stored balance of id and returns its new version; callers must hold balancesMu
+func projectBalanceLocked(id string, amount int, now time.Time) int64 {
+	lastBalanceVersion++
+	balances[id] = amount
+	balanceUpdated[id] = now
+	balanceVersions[id] = lastBalanceVersion
+	return lastBalanceVersion
+}
+
+// checkBalanceVersionLocked compares the version an update expects with the stored one; callers must hold balancesMu.
+// An expected version of 0 only matches when no balance is stored.
+func checkBalanceVersionLocked(id string, expected int64, given bool) error {
+	current, exists := balanceVersions[id]
+	switch {
+	case !given:
+		if exists && requireBalancePrecondition {
+			return errPreconditionRequired
+		}
+		return nil
+	case expected == anyVersion:
+		if !exists {
+			return errVersionConflict
+		}
+		return nil
+	case expected != current:
+		return errVersionConflict
+	}
+	return nil
+}
+
+func balanceETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// expectedBalanceVersion reads the version an update expects from If-Match or the request body.
+// given is false when the client supplied neither.
+func expectedBalanceVersion(r *http.Request, body *int64) (expected int64, given bool, err error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		if body == nil {
+			return 0, false, nil
+		}
+		return *body, true, nil
+	}
+
+	if header == "*" {
+		expected = anyVersion
+	} else {
+		unquoted, ok := strings.CutPrefix(header, `"`)
+		unquoted, closed := strings.CutSuffix(unquoted, `"`)
+		if expected, err = strconv.ParseInt(unquoted, 10, 64); !ok || !closed || err != nil || expected < 0 {
+			return 0, false, fmt.Errorf("If-Match must be a balance ETag such as \"3\" or *")
+		}
+	}
+	if body != nil && *body != expected {
+		return 0, false, errors.New("If-Match and expectedVersion disagree")
+	}
+	return expected, true, nil
+}
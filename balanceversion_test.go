@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func storeWithIfMatch(t *testing.T, id string, amount int, ifMatch string) *httptest.ResponseRecorder {
+	t.Helper()
+	body, _ := json.Marshal(BalanceRequest{ID: id, Amount: amount})
+	req := httptest.NewRequest("POST", "/store/sum", bytes.NewBuffer(body))
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	rr := httptest.NewRecorder()
+	storeBalance(rr, req)
+	return rr
+}
+
+func TestBalanceOptimisticConcurrency(t *testing.T) {
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+
+	first := h.StoreBalance("occ_user", 100)
+	h.AssertStatusCode(first, http.StatusOK, "creating balance")
+	etag := first.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("Expected an ETag on the stored balance")
+	}
+
+	// Two clients read the same version; only the first update wins
+	rr := storeWithIfMatch(t, "occ_user", 150, etag)
+	h.AssertStatusCode(rr, http.StatusOK, "first update")
+	if rr.Header().Get("ETag") == etag {
+		t.Error("Expected the update to change the ETag")
+	}
+	rr = storeWithIfMatch(t, "occ_user", 50, etag)
+	h.AssertStatusCode(rr, http.StatusConflict, "stale update")
+	h.AssertBalanceStored("occ_user", 150)
+
+	tests := []struct {
+		name           string
+		id             string
+		ifMatch        string
+		expectedStatus int
+	}{
+		{"Wildcard on existing", "occ_user", "*", http.StatusOK},
+		{"Wildcard on missing", "new_user", "*", http.StatusConflict},
+		{"Unquoted tag", "occ_user", "7", http.StatusBadRequest},
+		{"Create-only on existing", "occ_user", `"0"`, http.StatusConflict},
+		{"Create-only on missing", "new_user", `"0"`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := storeWithIfMatch(t, tt.id, 10, tt.ifMatch)
+			h.AssertStatusCode(rr, tt.expectedStatus, tt.name)
+		})
+	}
+}
+
+func TestBalanceExpectedVersionInBody(t *testing.T) {
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+	h.StoreBalance("occ_user", 100)
+
+	balancesMu.Lock()
+	current := balanceVersions["occ_user"]
+	balancesMu.Unlock()
+
+	stale := current - 1
+	rr := postJSON(t, storeBalance, "/store/sum", BalanceRequest{ID: "occ_user", Amount: 1, ExpectedVersion: &stale})
+	h.AssertStatusCode(rr, http.StatusConflict, "stale expectedVersion")
+
+	rr = postJSON(t, storeBalance, "/store/sum", BalanceRequest{ID: "occ_user", Amount: 1, ExpectedVersion: &current})
+	h.AssertStatusCode(rr, http.StatusOK, "current expectedVersion")
+}
+
+func TestBalancePreconditionRequired(t *testing.T) {
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+	requireBalancePrecondition = true
+	t.Cleanup(func() { requireBalancePrecondition = false })
+
+	h.AssertStatusCode(h.StoreBalance("occ_user", 100), http.StatusOK, "creating without a precondition")
+	h.AssertStatusCode(h.StoreBalance("occ_user", 200), http.StatusPreconditionRequired, "updating without a precondition")
+	h.AssertBalanceStored("occ_user", 100)
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// Names of the secrets used by the bank connectors
+const (
+	bankClientIDSecret = "bank-client-id"
+	bankSecretSecret   = "bank-secret"
+)
+
+var (
+	errConsentRejected  = errs.New(errs.Forbidden, "consent_rejected", "consent token was rejected by the bank")
+	errAccountNotFound  = errs.New(errs.NotFound, "account_not_found", "account not found for consent token")
+	errBankNotConnected = errs.New(errs.Unavailable, "bank_not_connected", "no bank connector is configured")
+)
+
+// BankBalance is an account balance reported by a bank, in whole currency units
+type BankBalance struct {
+	AccountID   string
+	Institution string
+	Currency    string
+	Amount      int
+}
+
+// BankConnector fetches a user's real account balance with a consent token the user granted.
+// It returns errConsentRejected for invalid or expired consent and errAccountNotFound when
+// accountID is not covered by the consent.
+type BankConnector interface {
+	Name() string
+	FetchBalance(ctx context.Context, consentToken, accountID string) (BankBalance, error)
+}
+
+// bankConnector is the configured connector; nil disables /connect/balance
+var bankConnector BankConnector
+
+// BankConfig selects the Open Banking connector
+type BankConfig struct {
+	Connector   string // "" (disabled) or "plaid"
+	URL         string // API base URL, e.g. the Plaid sandbox
+	HTTPTimeout time.Duration
+}
+
+func newBankConnector(cfg BankConfig, p SecretProvider) (BankConnector, error) {
+	switch cfg.Connector {
+	case "":
+		return nil, nil
+	case "plaid":
+		clientID, err := p.Secret(context.Background(), bankClientIDSecret)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", bankClientIDSecret, err)
+		}
+		secret, err := p.Secret(context.Background(), bankSecretSecret)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", bankSecretSecret, err)
+		}
+		return &plaidConnector{
+			url:      strings.TrimRight(cfg.URL, "/"),
+			clientID: clientID,
+			secret:   secret,
+			client:   &http.Client{Timeout: cfg.HTTPTimeout},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown bank connector %q", cfg.Connector)
+	}
+}
+
+// plaidConnector reads balances through a Plaid-style /accounts/balance/get API,
+// where the consent token is the access token of the user's linked item
+type plaidConnector struct {
+	url      string
+	clientID string
+	secret   string
+	client   *http.Client
+}
+
+func (c *plaidConnector) Name() string { return "plaid" }
+
+type plaidBalanceResponse struct {
+	Accounts []struct {
+		AccountID string `json:"account_id"`
+		Balances  struct {
+			Available *float64 `json:"available"`
+			Current   *float64 `json:"current"`
+			Currency  string   `json:"iso_currency_code"`
+		} `json:"balances"`
+	} `json:"accounts"`
+	Item struct {
+		InstitutionID string `json:"institution_id"`
+	} `json:"item"`
+}
+
+type plaidError struct {
+	ErrorType string `json:"error_type"`
+	ErrorCode string `json:"error_code"`
+}
+
+func (c *plaidConnector) FetchBalance(ctx context.Context, consentToken, accountID string) (BankBalance, error) {
+	params := map[string]interface{}{
+		"client_id":    c.clientID,
+		"secret":       c.secret,
+		"access_token": consentToken,
+	}
+	if accountID != "" {
+		params["options"] = map[string][]string{"account_ids": {accountID}}
+	}
+	body, err := json.Marshal(params)
+	if err != nil {
+		return BankBalance{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url+"/accounts/balance/get", bytes.NewReader(body))
+	if err != nil {
+		return BankBalance{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return BankBalance{}, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return BankBalance{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var pe plaidError
+		_ = json.Unmarshal(data, &pe)
+		switch {
+		case pe.ErrorType == "ITEM_ERROR" || pe.ErrorCode == "INVALID_ACCESS_TOKEN":
+			return BankBalance{}, errConsentRejected
+		case pe.ErrorCode == "INVALID_ACCOUNT_ID":
+			return BankBalance{}, errAccountNotFound
+		}
+		return BankBalance{}, fmt.Errorf("plaid balance: %s %s", resp.Status, pe.ErrorCode)
+	}
+
+	var out plaidBalanceResponse
+	if err := json.Unmarshal(data, &out); err != nil {
+		return BankBalance{}, fmt.Errorf("plaid balance: %w", err)
+	}
+
+	for _, account := range out.Accounts {
+		if accountID != "" && account.AccountID != accountID {
+			continue
+		}
+		// The available balance excludes pending debits, so it is the safer figure to prove against
+		amount := account.Balances.Available
+		if amount == nil {
+			amount = account.Balances.Current
+		}
+		if amount == nil {
+			return BankBalance{}, fmt.Errorf("plaid balance: account %s reports no balance", account.AccountID)
+		}
+		return BankBalance{
+			AccountID:   account.AccountID,
+			Institution: out.Item.InstitutionID,
+			Currency:    account.Balances.Currency,
+			Amount:      int(math.Floor(*amount)),
+		}, nil
+	}
+	return BankBalance{}, errAccountNotFound
+}
+
+// BalanceAttestation records that a stored balance was fetched from a bank rather than self-reported
+type BalanceAttestation struct {
+	ID          string     `json:"id"`
+	Source      string     `json:"source"`
+	Institution string     `json:"institution,omitempty"`
+	AccountID   string     `json:"accountId"`
+	Currency    string     `json:"currency,omitempty"`
+	FetchedAt   time.Time  `json:"fetchedAt"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"` // the balance can no longer be proven from then on
+	Issuer      string     `json:"issuer,omitempty"`    // DID of the server; kid names its key
+	KeyID       string     `json:"kid,omitempty"`
+	Signature   []byte     `json:"signature,omitempty"` // ES256 over the attestation without kid and signature
+}
+
+// balanceAttestations holds the attestation of each bank-sourced balance, guarded by balancesMu.
+// Storing a balance through /store/sum removes its attestation.
+var balanceAttestations = make(map[string]BalanceAttestation)
+
+// signAttestation signs the attestation with the server signing key when one is configured
+func signAttestation(a *BalanceAttestation) error {
+	if signer == nil {
+		return nil
+	}
+	a.Issuer = issuerDID
+	unsigned := *a
+	unsigned.KeyID, unsigned.Signature = "", nil
+	payload, err := json.Marshal(unsigned)
+	if err != nil {
+		return err
+	}
+	if a.Signature, err = signMessage(signer, payload); err != nil {
+		return err
+	}
+	a.KeyID = signer.KeyID()
+	return nil
+}
+
+// lookupBalanceAttestation returns the attestation of id's balance, if it came from a bank
+func lookupBalanceAttestation(id string) (BalanceAttestation, bool) {
+	balancesMu.Lock()
+	defer balancesMu.Unlock()
+	a, ok := balanceAttestations[id]
+	return a, ok
+}
+
+type ConnectBalanceRequest struct {
+	ID           string `json:"id"`
+	ConsentToken string `json:"consentToken"`
+	AccountID    string `json:"accountId,omitempty"` // first account of the consent when empty
+}
+
+// connectBalance fetches a user's balance from the bank and stores it as an attested balance
+func connectBalance(w http.ResponseWriter, r *http.Request) {
+	if bankConnector == nil {
+		writeError(w, errBankNotConnected)
+		return
+	}
+
+	var req ConnectBalanceRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := checkSessionUser(r, req.ID); err != nil {
+		writeError(w, err)
+		return
+	}
+	if req.ID == "" || req.ConsentToken == "" {
+		writeError(w, errs.Errorf(errs.Invalid, "id and consentToken are required"))
+		return
+	}
+
+	balance, err := bankConnector.FetchBalance(r.Context(), req.ConsentToken, req.AccountID)
+	switch {
+	case errors.Is(err, errConsentRejected), errors.Is(err, errAccountNotFound):
+		writeError(w, err)
+		return
+	case err != nil:
+		log.Printf("Bank balance fetch failed: %v", err)
+		writeError(w, errs.Errorf(errs.BadGateway, "bank is unavailable"))
+		return
+	}
+
+	fetchedAt := time.Now().UTC().Truncate(time.Second)
+	attestation := BalanceAttestation{
+		ID:          req.ID,
+		Source:      bankConnector.Name(),
+		Institution: balance.Institution,
+		AccountID:   balance.AccountID,
+		Currency:    balance.Currency,
+		FetchedAt:   fetchedAt,
+		ExpiresAt:   attestationExpiry(fetchedAt),
+	}
+	if err := signAttestation(&attestation); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	balancesMu.Lock()
+	version := setBalanceLocked(req.ID, balance.Amount, time.Now())
+	balanceAttestations[req.ID] = attestation
+	balancesMu.Unlock()
+	audit.record(AuditEvent{Type: auditBalanceStored, Detail: "bank-attested"})
+
+	w.Header().Set("ETag", balanceETag(version))
+	writeJSON(w, attestation)
+}
+
+// getBalanceAttestation reports where a user's balance came from, without revealing the amount
+func getBalanceAttestation(w http.ResponseWriter, r *http.Request) {
+	attestation, ok := lookupBalanceAttestation(r.PathValue("id"))
+	if !ok {
+		writeError(w, errs.Errorf(errs.NotFound, "balance is not attested"))
+		return
+	}
+	writeJSON(w, attestation)
+}
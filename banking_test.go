@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakePlaid serves /accounts/balance/get for the access token "access-sandbox-ok"
+func fakePlaid(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ClientID    string `json:"client_id"`
+			Secret      string `json:"secret"`
+			AccessToken string `json:"access_token"`
+			Options     struct {
+				AccountIDs []string `json:"account_ids"`
+			} `json:"options"`
+		}
+		if r.URL.Path != "/accounts/balance/get" || json.NewDecoder(r.Body).Decode(&req) != nil || req.ClientID != "client" || req.Secret != "secret" {
+			http.Error(w, `{"error_type":"INVALID_REQUEST"}`, http.StatusBadRequest)
+			return
+		}
+		if req.AccessToken != "access-sandbox-ok" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error_type":"INVALID_INPUT","error_code":"INVALID_ACCESS_TOKEN"}`))
+			return
+		}
+		if len(req.Options.AccountIDs) > 0 && req.Options.AccountIDs[0] != "checking" && req.Options.AccountIDs[0] != "savings" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error_type":"INVALID_INPUT","error_code":"INVALID_ACCOUNT_ID"}`))
+			return
+		}
+		w.Write([]byte(`{
+			"accounts": [
+				{"account_id": "checking", "balances": {"available": 1250.75, "current": 1300, "iso_currency_code": "USD"}},
+				{"account_id": "savings", "balances": {"available": null, "current": 5000, "iso_currency_code": "USD"}}
+			],
+			"item": {"institution_id": "ins_109508"}
+		}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestPlaidConnector(t *testing.T) {
+	server := fakePlaid(t)
+	connector, err := newBankConnector(BankConfig{Connector: "plaid", URL: server.URL, HTTPTimeout: time.Second},
+		mapSecrets{bankClientIDSecret: "client", bankSecretSecret: "secret"})
+	if err != nil {
+		t.Fatalf("Failed to create connector: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		token     string
+		account   string
+		wantErr   error
+		wantTotal int
+	}{
+		{"First account, available balance rounded down", "access-sandbox-ok", "", nil, 1250},
+		{"Current balance when available is unknown", "access-sandbox-ok", "savings", nil, 5000},
+		{"Rejected consent", "access-sandbox-revoked", "", errConsentRejected, 0},
+		{"Account outside the consent", "access-sandbox-ok", "brokerage", errAccountNotFound, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			balance, err := connector.FetchBalance(context.Background(), tt.token, tt.account)
+			if err != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && (balance.Amount != tt.wantTotal || balance.Institution != "ins_109508" || balance.Currency != "USD") {
+				t.Errorf("Unexpected balance: %+v", balance)
+			}
+		})
+	}
+
+	if _, err := newBankConnector(BankConfig{Connector: "plaid"}, mapSecrets{}); err == nil {
+		t.Error("Expected missing credentials to be reported")
+	}
+	if c, err := newBankConnector(BankConfig{}, mapSecrets{}); c != nil || err != nil {
+		t.Errorf("Expected no connector by default, got %v, %v", c, err)
+	}
+}
+
+func TestConnectBalance(t *testing.T) {
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+
+	previousConnector, previousSigner := bankConnector, signer
+	t.Cleanup(func() { bankConnector, signer = previousConnector, previousSigner })
+
+	bankConnector = nil
+	rr := postJSON(t, connectBalance, "/connect/balance", ConnectBalanceRequest{ID: "bank_user", ConsentToken: "access-sandbox-ok"})
+	h.AssertStatusCode(rr, http.StatusServiceUnavailable, "connecting without a connector")
+
+	server := fakePlaid(t)
+	bankConnector, _ = newBankConnector(BankConfig{Connector: "plaid", URL: server.URL, HTTPTimeout: time.Second},
+		mapSecrets{bankClientIDSecret: "client", bankSecretSecret: "secret"})
+	signer, _ = newLocalSigner(mapSecrets{})
+
+	rr = postJSON(t, connectBalance, "/connect/balance", ConnectBalanceRequest{ID: "bank_user", ConsentToken: "access-sandbox-revoked"})
+	h.AssertStatusCode(rr, http.StatusForbidden, "connecting with a rejected consent")
+
+	rr = postJSON(t, connectBalance, "/connect/balance", ConnectBalanceRequest{ID: "bank_user", ConsentToken: "access-sandbox-ok"})
+	h.AssertStatusCode(rr, http.StatusOK, "connecting a bank balance")
+	h.AssertBalanceStored("bank_user", 1250)
+
+	var attestation BalanceAttestation
+	if err := json.Unmarshal(rr.Body.Bytes(), &attestation); err != nil {
+		t.Fatalf("Failed to decode attestation: %v", err)
+	}
+	if attestation.Source != "plaid" || attestation.AccountID != "checking" || attestation.KeyID != signer.KeyID() {
+		t.Errorf("Unexpected attestation: %+v", attestation)
+	}
+	if attestation.ExpiresAt == nil || !attestation.ExpiresAt.Equal(attestation.FetchedAt.Add(attestationPolicy.TTL)) {
+		t.Errorf("Expected the attestation to expire %s after it was fetched, got %v", attestationPolicy.TTL, attestation.ExpiresAt)
+	}
+
+	// The signature covers the attestation without kid and signature
+	unsigned := attestation
+	unsigned.KeyID, unsigned.Signature = "", nil
+	payload, _ := json.Marshal(unsigned)
+	digest := sha256.Sum256(payload)
+	if !ecdsa.VerifyASN1(signer.Public().(*ecdsa.PublicKey), digest[:], attestation.Signature) {
+		t.Error("Expected the attestation signature to verify")
+	}
+
+	req := httptest.NewRequest("GET", "/balances/bank_user/attestation", nil)
+	req.SetPathValue("id", "bank_user")
+	rr = httptest.NewRecorder()
+	getBalanceAttestation(rr, req)
+	h.AssertStatusCode(rr, http.StatusOK, "fetching the attestation")
+
+	// A self-reported balance replaces the attested one and drops its attestation
+	h.StoreBalance("bank_user", 99999)
+	rr = httptest.NewRecorder()
+	getBalanceAttestation(rr, req)
+	h.AssertStatusCode(rr, http.StatusNotFound, "fetching the attestation of a self-reported balance")
+}
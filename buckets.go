@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/korjavin/zkTest1/circuits"
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// Identity of the bucketed range circuit
+const (
+	bucketCircuitName    = circuits.BucketName
+	bucketCircuitVersion = 2
+)
+
+// unboundedUpper is the exclusive upper bound used in-circuit for the topmost bucket
+var unboundedUpper = uint64(math.MaxInt64) + 1
+
+// Bucket is a half-open balance range [Lower, Upper); Upper is nil for the topmost bucket
+type Bucket struct {
+	Lower int64  `json:"lower"`
+	Upper *int64 `json:"upper,omitempty"`
+	Label string `json:"label"`
+}
+
+// bucketBoundaries holds the ascending lower bounds of the disclosure buckets
+var bucketBoundaries = powerOfTwoBoundaries()
+
+// powerOfTwoBoundaries returns 0, 1, 2, 4, ... up to 2^62
+func powerOfTwoBoundaries() []int64 {
+	boundaries := []int64{0}
+	for b := int64(1); b > 0 && b <= math.MaxInt64/2+1; b <<= 1 {
+		boundaries = append(boundaries, b)
+	}
+	return boundaries
+}
+
+// parseBucketBoundaries parses a comma-separated, strictly ascending list of lower bounds
+func parseBucketBoundaries(values []string) ([]int64, error) {
+	boundaries := make([]int64, 0, len(values))
+	for _, v := range values {
+		b, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || b < 0 {
+			return nil, fmt.Errorf("invalid bucket boundary %q", v)
+		}
+		if len(boundaries) > 0 && b <= boundaries[len(boundaries)-1] {
+			return nil, errors.New("bucket boundaries must be strictly ascending")
+		}
+		boundaries = append(boundaries, b)
+	}
+	if len(boundaries) == 0 {
+		return nil, errors.New("at least one bucket boundary is required")
+	}
+	return boundaries, nil
+}
+
+// bucketAt returns the i-th bucket of the configured boundaries
+func bucketAt(i int) Bucket {
+	bucket := Bucket{Lower: bucketBoundaries[i]}
+	if i+1 < len(bucketBoundaries) {
+		upper := bucketBoundaries[i+1]
+		bucket.Upper = &upper
+		bucket.Label = fmt.Sprintf("%d-%d", bucket.Lower, upper-1)
+	} else {
+		bucket.Label = fmt.Sprintf("%d+", bucket.Lower)
+	}
+	return bucket
+}
+
+// bucketFor returns the bucket containing balance
+func bucketFor(balance int64) (Bucket, bool) {
+	i, found := slices.BinarySearch(bucketBoundaries, balance)
+	if !found {
+		i--
+	}
+	if i < 0 {
+		return Bucket{}, false
+	}
+	return bucketAt(i), true
+}
+
+// roundThresholds makes balance proofs state the lowest bucket boundary at or above the requested
+// threshold instead of the threshold itself
+var roundThresholds bool
+
+// provedThresholdHeader names the threshold a balance proof states when thresholds are rounded
+const provedThresholdHeader = "X-Proved-Threshold"
+
+// roundThreshold returns the threshold a proof of neededAmount states. Rounding up keeps the proof
+// at least as strong as requested while only boundaries are ever disclosed.
+func roundThreshold(neededAmount int) (int, error) {
+	if !roundThresholds {
+		return neededAmount, nil
+	}
+	i, _ := slices.BinarySearch(bucketBoundaries, int64(neededAmount))
+	if i == len(bucketBoundaries) {
+		return 0, errs.Errorf(errs.Invalid, "neededAmount is above the highest bucket boundary and cannot be rounded")
+	}
+	return int(bucketBoundaries[i]), nil
+}
+
+// isConfiguredBucket reports whether lower/upper match one of the configured buckets
+func isConfiguredBucket(lower int64, upper *int64) bool {
+	i, found := slices.BinarySearch(bucketBoundaries, lower)
+	if !found {
+		return false
+	}
+	b := bucketAt(i)
+	if b.Upper == nil || upper == nil {
+		return b.Upper == nil && upper == nil
+	}
+	return *b.Upper == *upper
+}
+
+func (b Bucket) assignment(balance interface{}) *circuits.BucketCircuit {
+	var upper interface{} = unboundedUpper
+	if b.Upper != nil {
+		upper = *b.Upper
+	}
+	return &circuits.BucketCircuit{Balance: balance, Lower: b.Lower, Upper: upper}
+}
+
+type BucketProofRequest struct {
+	ID string `json:"id"`
+}
+
+type BucketProofResponse struct {
+	Bucket Bucket        `json:"bucket"`
+	Proof  groth16.Proof `json:"proof"`
+}
+
+type BucketValidateRequest struct {
+	Lower int64           `json:"lower"`
+	Upper *int64          `json:"upper"`
+	Proof json.RawMessage `json:"proof"`
+	Curve string          `json:"curve,omitempty"` // curve the proof was made on; bn254 when empty
+}
+
+// listBuckets returns the configured disclosure buckets
+func listBuckets(w http.ResponseWriter, r *http.Request) {
+	buckets := make([]Bucket, len(bucketBoundaries))
+	for i := range bucketBoundaries {
+		buckets[i] = bucketAt(i)
+	}
+	writeJSON(w, buckets)
+}
+
+// generateBucketProof proves which bucket the stored balance falls into without revealing it
+func generateBucketProof(w http.ResponseWriter, r *http.Request) {
+	var req BucketProofRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := checkTenantAccess(r, bucketCircuitName); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := checkSessionUser(r, req.ID); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := checkUserIssuance(req.ID); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	balance, ledgerTx, exists := lookupBalance(req.ID)
+
+	if !exists {
+		writeError(w, errBalanceNotFound)
+		return
+	}
+	if err := checkBalanceAttestation(req.ID, time.Now()); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	bucket, ok := bucketFor(int64(balance))
+	if !ok {
+		writeError(w, errs.Errorf(errs.Unprocessable, "balance is below the lowest configured bucket"))
+		return
+	}
+
+	curve := proofCurve(r, bucketCircuitName)
+	setup, err := loadCurveSetup(curve, bucketCircuitName, &circuits.BucketCircuit{})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	assignment := bucket.assignment(balance)
+	proof, err := setup.prove(r.Context(), assignment)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	publicInputs := map[string]string{"lower": strconv.FormatInt(bucket.Lower, 10)}
+	if bucket.Upper != nil {
+		publicInputs["upper"] = strconv.FormatInt(*bucket.Upper, 10)
+	}
+	digest, err := persistProof(r.Context(), proof, ProofRecord{
+		Circuit:        bucketCircuitName,
+		CircuitVersion: bucketCircuitVersion,
+		Curve:          recordedCurve(curve),
+		LedgerTx:       ledgerTx,
+		PublicInputs:   publicInputs,
+		Holder:         req.ID,
+	})
+	if err != nil {
+		log.Printf("Failed to persist proof: %v", err)
+	}
+	if digest != "" {
+		w.Header().Set("X-Proof-Digest", digest)
+	}
+	setProofHeaders(w, curve, assignment)
+	signIssuedProof(w, curve, bucketCircuitName, map[string]*int64{"lower": &bucket.Lower, "upper": bucket.Upper}, proof, assignment)
+
+	writeProof(w, r, proof, BucketProofResponse{Bucket: bucket, Proof: proof})
+}
+
+// validateBucketProof verifies that a proof places the balance in the given configured bucket
+func validateBucketProof(w http.ResponseWriter, r *http.Request) {
+	var req BucketValidateRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if !isConfiguredBucket(req.Lower, req.Upper) {
+		writeError(w, errs.Errorf(errs.Invalid, "not a configured bucket"))
+		return
+	}
+	if err := checkTenantAccess(r, bucketCircuitName, req.Lower); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	curve, err := verifyCurve(req.Curve, bucketCircuitName)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	proof, err := decodeProofJSON(curve, req.Proof)
+	if err != nil {
+		writeError(w, fmt.Errorf("%w: %v", errMalformedProof, err))
+		return
+	}
+
+	setup, err := loadCurveSetup(curve, bucketCircuitName, &circuits.BucketCircuit{})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	bucket := Bucket{Lower: req.Lower, Upper: req.Upper}
+	err = setup.verify(r.Context(), proof, bucket.assignment(0))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
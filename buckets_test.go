@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"testing"
+)
+
+func withBuckets(t *testing.T, boundaries []int64) {
+	t.Helper()
+	previous := bucketBoundaries
+	bucketBoundaries = boundaries
+	t.Cleanup(func() { bucketBoundaries = previous })
+}
+
+func TestBucketFor(t *testing.T) {
+	withBuckets(t, []int64{0, 1000, 10000})
+
+	tests := []struct {
+		balance       int64
+		expectedLabel string
+		expectFound   bool
+	}{
+		{-5, "", false},
+		{0, "0-999", true},
+		{999, "0-999", true},
+		{1000, "1000-9999", true},
+		{5000, "1000-9999", true},
+		{10000, "10000+", true},
+		{1 << 40, "10000+", true},
+	}
+
+	for _, tt := range tests {
+		bucket, found := bucketFor(tt.balance)
+		if found != tt.expectFound || bucket.Label != tt.expectedLabel {
+			t.Errorf("bucketFor(%d) = %q, %v; want %q, %v", tt.balance, bucket.Label, found, tt.expectedLabel, tt.expectFound)
+		}
+	}
+}
+
+func TestDefaultBucketsArePowersOfTwo(t *testing.T) {
+	boundaries := powerOfTwoBoundaries()
+	if len(boundaries) != 64 {
+		t.Fatalf("Expected 64 boundaries (0 and 2^0..2^62), got %d", len(boundaries))
+	}
+	for i := 2; i < len(boundaries); i++ {
+		if boundaries[i] != 2*boundaries[i-1] {
+			t.Fatalf("Boundary %d is %d, expected %d", i, boundaries[i], 2*boundaries[i-1])
+		}
+	}
+}
+
+func TestParseBucketBoundaries(t *testing.T) {
+	if _, err := parseBucketBoundaries([]string{"0", "1000", "500"}); err == nil {
+		t.Error("Expected descending boundaries to be rejected")
+	}
+	if _, err := parseBucketBoundaries([]string{"-1", "10"}); err == nil {
+		t.Error("Expected negative boundaries to be rejected")
+	}
+	got, err := parseBucketBoundaries([]string{"0", "1000", "10000"})
+	if err != nil || len(got) != 3 {
+		t.Errorf("Expected 3 boundaries, got %v, %v", got, err)
+	}
+}
+
+func TestBucketProofWorkflow(t *testing.T) {
+	SkipIfShort(t, "bucket proof generation")
+	withBuckets(t, []int64{0, 1000, 10000})
+
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+	h.StoreBalance("bucket_user", 4200)
+	h.StoreBalance("whale", math.MaxInt32)
+
+	rr := postJSON(t, generateBucketProof, "/get/proof/bucket", BucketProofRequest{ID: "bucket_user"})
+	h.AssertStatusCode(rr, http.StatusOK, "generating bucket proof")
+
+	var resp struct {
+		Bucket Bucket          `json:"bucket"`
+		Proof  json.RawMessage `json:"proof"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Bucket.Label != "1000-9999" {
+		t.Fatalf("Expected bucket 1000-9999, got %q", resp.Bucket.Label)
+	}
+
+	upper := int64(10000)
+	otherUpper := int64(1000)
+	tests := []struct {
+		name           string
+		request        BucketValidateRequest
+		expectedStatus int
+	}{
+		{"Correct bucket", BucketValidateRequest{Lower: 1000, Upper: &upper, Proof: resp.Proof}, http.StatusOK},
+		{"Wrong bucket", BucketValidateRequest{Lower: 0, Upper: &otherUpper, Proof: resp.Proof}, http.StatusUnauthorized},
+		{"Unconfigured bucket", BucketValidateRequest{Lower: 4000, Upper: &upper, Proof: resp.Proof}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h.AssertStatusCode(postJSON(t, validateBucketProof, "/validate/bucket", tt.request), tt.expectedStatus, tt.name)
+		})
+	}
+
+	t.Run("Topmost unbounded bucket", func(t *testing.T) {
+		rr := postJSON(t, generateBucketProof, "/get/proof/bucket", BucketProofRequest{ID: "whale"})
+		h.AssertStatusCode(rr, http.StatusOK, "generating top bucket proof")
+
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		valid := postJSON(t, validateBucketProof, "/validate/bucket", BucketValidateRequest{Lower: 10000, Proof: resp.Proof})
+		h.AssertStatusCode(valid, http.StatusOK, "validating top bucket proof")
+	})
+}
+
+func TestRoundThreshold(t *testing.T) {
+	withBuckets(t, []int64{0, 1000, 10000})
+	if got, err := roundThreshold(4200); err != nil || got != 4200 {
+		t.Errorf("Expected thresholds to be kept without rounding, got %d, %v", got, err)
+	}
+
+	roundThresholds = true
+	t.Cleanup(func() { roundThresholds = false })
+	for neededAmount, want := range map[int]int{-5: 0, 0: 0, 1: 1000, 1000: 1000, 4200: 10000} {
+		if got, err := roundThreshold(neededAmount); err != nil || got != want {
+			t.Errorf("Expected %d to be rounded to %d, got %d, %v", neededAmount, want, got, err)
+		}
+	}
+	if _, err := roundThreshold(10001); err == nil {
+		t.Error("Expected a threshold above the highest boundary to be rejected")
+	}
+}
+
+func TestRoundedThresholdProof(t *testing.T) {
+	SkipIfShort(t, "proof generation")
+	withBuckets(t, []int64{0, 1000, 10000, 100000})
+	roundThresholds = true
+	t.Cleanup(func() { roundThresholds = false })
+
+	// Strict proofs, as their keys are kept between requests
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+	t.Cleanup(h.SetupCleanBalances)
+	h.AssertStatusCode(h.StoreBalance("rounded_user", 12000), http.StatusOK, "storing a balance")
+
+	rr := postJSON(t, generateProof, "/get/proof/neededAmount", ProofRequest{ID: "rounded_user", NeededAmount: 4200, Comparison: comparisonAbove})
+	h.AssertStatusCode(rr, http.StatusOK, "proving a rounded threshold")
+	if got := rr.Header().Get(provedThresholdHeader); got != "10000" {
+		t.Fatalf("Expected 4200 to be proven as 10000, got %q", got)
+	}
+
+	proof := json.RawMessage(rr.Body.Bytes())
+	rr = postJSON(t, validateProof, "/validate", ValidateRequest{ID: "rounded_user", NeededAmount: 10000, Proof: proof, Comparison: comparisonAbove})
+	h.AssertStatusCode(rr, http.StatusOK, "validating with the proven threshold")
+	rr = postJSON(t, validateProof, "/validate", ValidateRequest{ID: "rounded_user", NeededAmount: 4200, Proof: proof, Comparison: comparisonAbove})
+	h.AssertStatusCode(rr, http.StatusUnauthorized, "validating with the requested threshold")
+
+	// The boundary above the balance is out of reach even though the threshold is not
+	rr = postJSON(t, generateProof, "/get/proof/neededAmount", ProofRequest{ID: "rounded_user", NeededAmount: 11000, Comparison: comparisonAbove})
+	if rr.Code == http.StatusOK {
+		t.Error("Expected 11000 to be proven as 100000 and fail")
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/korjavin/zkTest1/circuits"
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// constraintBudget is the most constraints a circuit may have on any curve; 0 means no limit
+var constraintBudget int
+
+var errConstraintBudget = errs.New(errs.Invalid, "constraint_budget_exceeded", "circuit exceeds the constraint budget")
+
+// checkConstraintBudget compiles circuit for curve, or takes its size from an earlier compile,
+// and fails when it has more constraints than the budget allows
+func checkConstraintBudget(curve ecc.ID, name string, circuit frontend.Circuit) error {
+	if constraintBudget <= 0 {
+		return nil
+	}
+	shape, err := shapeOf(curve, name, circuit)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if shape.constraints > constraintBudget {
+		return fmt.Errorf("%w: %s has %d constraints on %s, ZK_MAX_CONSTRAINTS is %d",
+			errConstraintBudget, name, shape.constraints, curve, constraintBudget)
+	}
+	return nil
+}
+
+// checkCircuitBudgets checks every registered circuit on each curve it is configured for, so a
+// circuit too large to prove in reasonable time stops the server at startup
+func checkCircuitBudgets() error {
+	for _, name := range circuits.Names() {
+		for _, curve := range curveSelection.configuredCurves(name) {
+			circuit, err := circuits.New(name)
+			if err != nil {
+				return err
+			}
+			if err := checkConstraintBudget(curve, name, circuit); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
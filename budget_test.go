@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/korjavin/zkTest1/circuits"
+)
+
+func withConstraintBudget(t *testing.T, budget int) {
+	t.Helper()
+	previous := constraintBudget
+	constraintBudget = budget
+	t.Cleanup(func() { constraintBudget = previous })
+}
+
+func TestCheckCircuitBudgets(t *testing.T) {
+	withConstraintBudget(t, 0)
+	if err := checkCircuitBudgets(); err != nil {
+		t.Fatalf("Expected no budget by default, got %v", err)
+	}
+
+	withConstraintBudget(t, 1_000_000)
+	if err := checkCircuitBudgets(); err != nil {
+		t.Fatalf("Expected the built-in circuits to fit, got %v", err)
+	}
+
+	withConstraintBudget(t, 10)
+	err := checkCircuitBudgets()
+	if !errors.Is(err, errConstraintBudget) || !strings.Contains(err.Error(), "ZK_MAX_CONSTRAINTS is 10") {
+		t.Fatalf("Expected %v naming the budget, got %v", errConstraintBudget, err)
+	}
+	if err := checkConstraintBudget(defaultCurve, circuits.BalanceName, &circuits.BalanceCircuit{}); !errors.Is(err, errConstraintBudget) {
+		t.Errorf("Expected the balance circuit to exceed 10 constraints, got %v", err)
+	}
+}
+
+func TestStatementConstraintBudget(t *testing.T) {
+	withConstraintBudget(t, 10)
+	statement := Statement{Predicates: []StatementPredicate{{Attribute: "age", Op: ">=", Value: 18}}}
+	rr := postStatement(t, putStatement, "PUT", "over-budget", statement)
+	NewTestHelper(t).AssertStatusCode(rr, http.StatusBadRequest, "registering a statement over budget")
+	if !strings.Contains(rr.Body.String(), errConstraintBudget.Code) {
+		t.Errorf("Expected %s, got %s", errConstraintBudget.Code, rr.Body.String())
+	}
+	if _, err := lookupStatement("over-budget"); err == nil {
+		t.Error("Expected the statement not to be registered")
+	}
+}
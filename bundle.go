@@ -0,0 +1,542 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/consensys/gnark"
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/korjavin/zkTest1/circuits"
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// bundleVersion is the version of the bundle format written into every header
+const bundleVersion = 1
+
+// maxBundleMembers bounds the number of proofs verified per bundle
+const maxBundleMembers = 16
+
+// compositeEnvelopeCircuit names composite proofs in envelopes; the predicates select the actual circuit
+const compositeEnvelopeCircuit = "composite"
+
+var errManifestMismatch = errs.New(errs.Invalid, "manifest_mismatch", "bundle manifest does not match its contents")
+
+// ProofEnvelope is one proven statement: the circuit, its public inputs and the proof.
+// Inputs take the fields of the circuit's validate request without the proof, e.g.
+// {"neededAmount": 100} for "balance" or {"predicates": [...]} for "composite".
+type ProofEnvelope struct {
+	Circuit       string          `json:"circuit"`
+	Inputs        json.RawMessage `json:"inputs"`
+	Proof         json.RawMessage `json:"proof"`
+	GnarkVersion  string          `json:"gnarkVersion,omitempty"`  // release the proof was serialized with
+	PublicWitness []byte          `json:"publicWitness,omitempty"` // base64 gnark public witness, checked against inputs
+	Curve         string          `json:"curve,omitempty"`         // curve the proof was made on; bn254 when empty
+	Backend       string          `json:"backend,omitempty"`       // proving system; groth16 when empty
+	Metrics       *ProofMetrics   `json:"metrics,omitempty"`       // costs reported when the proof was issued; not in the manifest
+	// Issuer, KeyID and Signature attribute the envelope to the server that issued it; they are
+	// not in the manifest, so signed envelopes can be forwarded into bundles of other servers
+	Issuer    string `json:"issuer,omitempty"` // DID of the server that signed the envelope
+	KeyID     string `json:"kid,omitempty"`
+	Signature []byte `json:"signature,omitempty"` // over the envelope's digest
+}
+
+// BundleHeader is shared by all members of a bundle
+type BundleHeader struct {
+	Version  int       `json:"version"`
+	Subject  string    `json:"subject,omitempty"` // reference to the holder all members were issued for, such as a DID
+	Audience string    `json:"audience,omitempty"`
+	Issuer   string    `json:"issuer,omitempty"` // DID of the server that assembled the bundle
+	IssuedAt time.Time `json:"issuedAt"`
+}
+
+// ProofBundle packages several proof envelopes for the same holder.
+// Manifest is the hex SHA-256 over the header and every member, in order.
+// Signature is the issuer's signature over the manifest, made with key KeyID of its DID.
+type ProofBundle struct {
+	Header    BundleHeader    `json:"header"`
+	Members   []ProofEnvelope `json:"members"`
+	Manifest  string          `json:"manifest"`
+	KeyID     string          `json:"kid,omitempty"`
+	Signature []byte          `json:"signature,omitempty"`
+}
+
+// manifest hashes the header, then the circuit, the hashes of the compacted inputs and proof
+// and the gnark version, public witness hash, curve and backend, when set, of each member
+func (b *ProofBundle) manifest() (string, error) {
+	h, err := newManifestHash(b.Header)
+	if err != nil {
+		return "", err
+	}
+	for i, m := range b.Members {
+		if err := h.add(i, m); err != nil {
+			return "", err
+		}
+	}
+	return h.sum(), nil
+}
+
+// manifestHash computes a manifest member by member, so streamed bundles need not be held in memory
+type manifestHash struct {
+	hash.Hash
+}
+
+func newManifestHash(header BundleHeader) (*manifestHash, error) {
+	data, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	h := &manifestHash{sha256.New()}
+	h.Write(data)
+	return h, nil
+}
+
+// add hashes member i
+func (h *manifestHash) add(i int, m ProofEnvelope) error {
+	inputs, err := compactJSON(m.Inputs)
+	if err != nil {
+		return fmt.Errorf("member %d inputs: %w", i, err)
+	}
+	proof, err := compactJSON(m.Proof)
+	if err != nil {
+		return fmt.Errorf("member %d proof: %w", i, err)
+	}
+	fmt.Fprintf(h, "\n%s\n%s\n%s", m.Circuit, hashHex(inputs), hashHex(proof))
+	if m.GnarkVersion != "" {
+		fmt.Fprintf(h, "\ngnark %s", m.GnarkVersion)
+	}
+	if len(m.PublicWitness) > 0 {
+		fmt.Fprintf(h, "\nwitness %s", hashHex(m.PublicWitness))
+	}
+	if m.Curve != "" {
+		fmt.Fprintf(h, "\ncurve %s", m.Curve)
+	}
+	if m.Backend != "" {
+		fmt.Fprintf(h, "\nbackend %s", m.Backend)
+	}
+	return nil
+}
+
+func (h *manifestHash) sum() string {
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// digest is what the signature of an envelope covers: the envelope hashed as a manifest member
+func (m ProofEnvelope) digest() (string, error) {
+	h := &manifestHash{sha256.New()}
+	h.Write([]byte("envelope"))
+	if err := h.add(0, m); err != nil {
+		return "", err
+	}
+	return h.sum(), nil
+}
+
+// signedEnvelopeHeader carries the signed envelope of an issued proof, as JSON without its proof
+const signedEnvelopeHeader = "X-Signed-Envelope"
+
+// signIssuedProof signs the envelope of a proof this server has just made for circuit and the
+// public inputs it was proven against, and returns it without the proof in X-Signed-Envelope.
+// Only issued proofs are signed, so the server's DID never vouches for an envelope it did not
+// prove. Like persisting, a failure here must not fail proving.
+func signIssuedProof(w http.ResponseWriter, curve ecc.ID, circuit string, inputs any, proof groth16.Proof, assignment frontend.Circuit) {
+	if signer == nil || issuerDID == "" {
+		return
+	}
+	m, err := issuedEnvelope(curve, circuit, inputs, proof, assignment)
+	if err == nil {
+		err = signEnvelope(&m)
+	}
+	var fields []byte
+	if err == nil {
+		fields, err = envelopeFields(m)
+	}
+	if err != nil {
+		log.Printf("Failed to sign the envelope of an issued proof: %v", err)
+		return
+	}
+	w.Header().Set(signedEnvelopeHeader, string(fields))
+}
+
+// issuedEnvelope describes a proof made by this server on curve
+func issuedEnvelope(curve ecc.ID, circuit string, inputs any, proof groth16.Proof, assignment frontend.Circuit) (ProofEnvelope, error) {
+	in, err := json.Marshal(inputs)
+	if err != nil {
+		return ProofEnvelope{}, err
+	}
+	encoded, err := json.Marshal(proof)
+	if err != nil {
+		return ProofEnvelope{}, err
+	}
+	witness, err := encodePublicWitness(curve, assignment)
+	if err != nil {
+		return ProofEnvelope{}, err
+	}
+	return ProofEnvelope{
+		Circuit:       circuit,
+		Inputs:        in,
+		Proof:         encoded,
+		GnarkVersion:  gnark.Version.String(),
+		PublicWitness: witness,
+		Curve:         curve.String(),
+		Backend:       proofBackend,
+	}, nil
+}
+
+// signEnvelope signs m as issued by this server
+func signEnvelope(m *ProofEnvelope) error {
+	digest, err := m.digest()
+	if err != nil {
+		return err
+	}
+	if m.Signature, err = signMessage(signer, []byte(digest)); err != nil {
+		return err
+	}
+	m.Issuer, m.KeyID = issuerDID, signer.KeyID()
+	return nil
+}
+
+// checkEnvelopeSignature verifies the signature of an envelope with its issuer's DID, returning
+// the issuer. Unsigned envelopes are accepted without one.
+func checkEnvelopeSignature(ctx context.Context, m ProofEnvelope) (string, error) {
+	if len(m.Signature) == 0 {
+		return "", nil
+	}
+	digest, err := m.digest()
+	if err != nil {
+		return "", err
+	}
+	if err := verifyDIDSignature(ctx, m.Issuer, m.KeyID, []byte(digest), m.Signature); err != nil {
+		return "", err
+	}
+	return m.Issuer, nil
+}
+
+func compactJSON(data json.RawMessage) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (b *ProofBundle) check() error {
+	if len(b.Members) == 0 {
+		return errors.New("bundle has no members")
+	}
+	if len(b.Members) > maxBundleMembers {
+		return fmt.Errorf("bundle may have at most %d members", maxBundleMembers)
+	}
+	if b.Header.Version != bundleVersion {
+		return fmt.Errorf("unsupported bundle version %d", b.Header.Version)
+	}
+	return nil
+}
+
+// verifyEnvelope verifies one member against its public inputs.
+// It returns errInvalidProof when the proof does not verify.
+func verifyEnvelope(ctx context.Context, m ProofEnvelope) error {
+	if m.Backend != "" && m.Backend != proofBackend {
+		return fmt.Errorf("unsupported backend %q", m.Backend)
+	}
+	curve, err := verifyCurve(m.Curve, m.Circuit)
+	if err != nil {
+		return err
+	}
+	proof, err := decodeProof(curve, m.GnarkVersion, m.Proof)
+	if err != nil {
+		return err
+	}
+
+	switch m.Circuit {
+	case balanceCircuitName:
+		var in struct {
+			NeededAmount int `json:"neededAmount"`
+		}
+		if err := unmarshalStrict(m.Inputs, &in); err != nil {
+			return err
+		}
+		if err := checkPublicWitness(curve, m.PublicWitness, &circuits.BalanceCircuit{NeededAmount: in.NeededAmount}); err != nil {
+			return err
+		}
+		return verifyBalance(ctx, curve, proof, in.NeededAmount)
+
+	case strictBalanceCircuitName:
+		var in struct {
+			NeededAmount int `json:"neededAmount"`
+		}
+		if err := unmarshalStrict(m.Inputs, &in); err != nil {
+			return err
+		}
+		if err := checkPublicWitness(curve, m.PublicWitness, &circuits.StrictBalanceCircuit{NeededAmount: in.NeededAmount}); err != nil {
+			return err
+		}
+		return verifyStrictBalance(ctx, curve, proof, in.NeededAmount)
+
+	case committedCircuitName:
+		var in struct {
+			Commitment string `json:"commitment"`
+		}
+		if err := unmarshalStrict(m.Inputs, &in); err != nil {
+			return err
+		}
+		commitment, err := parseFieldElement(in.Commitment)
+		if err != nil {
+			return err
+		}
+		public := &circuits.CommittedBalanceCircuit{Commitment: commitment}
+		if err := checkPublicWitness(curve, m.PublicWitness, public); err != nil {
+			return err
+		}
+		return verifyWithSetup(ctx, curve, committedCircuitName, &circuits.CommittedBalanceCircuit{}, proof, public)
+
+	case bucketCircuitName:
+		var in struct {
+			Lower int64  `json:"lower"`
+			Upper *int64 `json:"upper"`
+		}
+		if err := unmarshalStrict(m.Inputs, &in); err != nil {
+			return err
+		}
+		if !isConfiguredBucket(in.Lower, in.Upper) {
+			return errors.New("not a configured bucket")
+		}
+		public := Bucket{Lower: in.Lower, Upper: in.Upper}.assignment(0)
+		if err := checkPublicWitness(curve, m.PublicWitness, public); err != nil {
+			return err
+		}
+		return verifyWithSetup(ctx, curve, bucketCircuitName, &circuits.BucketCircuit{}, proof, public)
+
+	case predicateCircuitName:
+		var in struct {
+			Predicate string `json:"predicate"`
+		}
+		if err := unmarshalStrict(m.Inputs, &in); err != nil {
+			return err
+		}
+		clauses, err := parsePredicate(in.Predicate)
+		if err != nil {
+			return err
+		}
+		public := predicateAssignment(clauses, nil)
+		if err := checkPublicWitness(curve, m.PublicWitness, public); err != nil {
+			return err
+		}
+		return verifyWithSetup(ctx, curve, predicateCircuitName, &circuits.PredicateCircuit{}, proof, public)
+
+	case timeLockCircuitName:
+		var in struct {
+			NeededAmount int       `json:"neededAmount"`
+			NotBefore    time.Time `json:"notBefore"`
+		}
+		if err := unmarshalStrict(m.Inputs, &in); err != nil {
+			return err
+		}
+		if err := checkNotBefore(in.NotBefore); err != nil {
+			return err
+		}
+		public := &circuits.TimeLockedBalanceCircuit{NeededAmount: in.NeededAmount, NotBefore: in.NotBefore.Unix()}
+		if err := checkPublicWitness(curve, m.PublicWitness, public); err != nil {
+			return err
+		}
+		return verifyTimeLocked(ctx, curve, proof, in.NeededAmount, in.NotBefore, time.Now())
+
+	case compositeEnvelopeCircuit:
+		var in struct {
+			Predicates []PredicateSpec `json:"predicates"`
+		}
+		if err := unmarshalStrict(m.Inputs, &in); err != nil {
+			return err
+		}
+		policy, err := parseCompositePolicy(in.Predicates)
+		if err != nil {
+			return err
+		}
+		public, err := policy.assignment("")
+		if err != nil {
+			return err
+		}
+		if err := checkPublicWitness(curve, m.PublicWitness, public); err != nil {
+			return err
+		}
+		return policy.verify(ctx, proof)
+
+	default:
+		if _, err := circuits.New(m.Circuit); err != nil {
+			return fmt.Errorf("unknown circuit %q", m.Circuit)
+		}
+		// Circuits registered by embedding programs have no modelled inputs, only their witness
+		if len(m.PublicWitness) == 0 {
+			return fmt.Errorf("circuit %q is verified against its publicWitness, which is missing", m.Circuit)
+		}
+		_, err := verifyAgainstWitness(ctx, curve, m.Circuit, proof, m.PublicWitness, time.Now())
+		return err
+	}
+}
+
+// envelopeThresholds returns the amount thresholds named by the inputs of an envelope, for
+// tenant access checks. Inputs that do not decode name none; they fail verification anyway.
+func envelopeThresholds(m ProofEnvelope) []int64 {
+	var in struct {
+		NeededAmount *int64          `json:"neededAmount"`
+		Lower        *int64          `json:"lower"`
+		Predicate    string          `json:"predicate"`
+		Predicates   []PredicateSpec `json:"predicates"`
+	}
+	if err := json.Unmarshal(m.Inputs, &in); err != nil {
+		return nil
+	}
+	var thresholds []int64
+	for _, v := range []*int64{in.NeededAmount, in.Lower} {
+		if v != nil {
+			thresholds = append(thresholds, *v)
+		}
+	}
+	if clauses, err := parsePredicate(in.Predicate); err == nil {
+		thresholds = append(thresholds, clauseThresholds(clauses)...)
+	}
+	return append(thresholds, compositePolicy(in.Predicates).thresholds()...)
+}
+
+// verifyWithSetup verifies proof against the public part of assignment with the cached keys of a circuit on curve
+func verifyWithSetup(ctx context.Context, curve ecc.ID, name string, circuit frontend.Circuit, proof groth16.Proof, assignment frontend.Circuit) error {
+	setup, err := loadCurveSetup(curve, name, circuit)
+	if err != nil {
+		return err
+	}
+	return setup.verify(ctx, proof, assignment)
+}
+
+// BundleMemberResult is the verification outcome of one bundle member
+type BundleMemberResult struct {
+	Index   int    `json:"index"`
+	Circuit string `json:"circuit"`
+	Valid   bool   `json:"valid"`
+	Error   string `json:"error,omitempty"`
+	Issuer  string `json:"issuer,omitempty"` // DID whose signature over the envelope verified
+	// VerifyingMs is the time taken to check the member, including decoding its proof
+	VerifyingMs float64 `json:"verifyingMs"`
+}
+
+// BundleValidateResponse is the combined result of /validate/bundle; Valid is true only when every member verifies
+type BundleValidateResponse struct {
+	Manifest string               `json:"manifest"`
+	Issuer   string               `json:"issuer,omitempty"` // DID whose signature over the manifest verified
+	Valid    bool                 `json:"valid"`
+	Members  []BundleMemberResult `json:"members"`
+}
+
+// createBundle assembles envelopes into a bundle, stamping the version, issue time and manifest.
+// Members without a gnark version, curve or backend are taken to come from this server's defaults.
+// Member signatures are passed through as given; the server signs envelopes when it issues
+// their proofs, never when bundling them, so unsigned members stay unsigned.
+func createBundle(w http.ResponseWriter, r *http.Request) {
+	var bundle ProofBundle
+	if err := decodeJSON(w, r, &bundle); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	bundle.Header.Version = bundleVersion
+	bundle.Header.IssuedAt = time.Now().UTC().Truncate(time.Second)
+	bundle.Header.Issuer = issuerDID
+	bundle.KeyID, bundle.Signature = "", nil
+	for i := range bundle.Members {
+		m := &bundle.Members[i]
+		if m.GnarkVersion == "" {
+			m.GnarkVersion = gnark.Version.String()
+		}
+		if m.Curve == "" {
+			m.Curve = defaultCurve.String()
+		}
+		if m.Backend == "" {
+			m.Backend = proofBackend
+		}
+	}
+	if err := bundle.check(); err != nil {
+		writeError(w, errs.Wrap(errs.Invalid, err))
+		return
+	}
+
+	manifest, err := bundle.manifest()
+	if err != nil {
+		writeError(w, errs.Wrap(errs.Invalid, err))
+		return
+	}
+	bundle.Manifest = manifest
+	if signer != nil && issuerDID != "" {
+		if bundle.Signature, err = signMessage(signer, []byte(manifest)); err != nil {
+			writeError(w, err)
+			return
+		}
+		bundle.KeyID = signer.KeyID()
+	}
+
+	writeJSON(w, bundle)
+}
+
+// validateBundle checks the manifest of a bundle and verifies all of its members
+func validateBundle(w http.ResponseWriter, r *http.Request) {
+	var bundle ProofBundle
+	if err := decodeJSON(w, r, &bundle); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := bundle.check(); err != nil {
+		writeError(w, errs.Wrap(errs.Invalid, err))
+		return
+	}
+
+	manifest, err := bundle.manifest()
+	if err != nil {
+		writeError(w, errs.Wrap(errs.Invalid, err))
+		return
+	}
+	if manifest != bundle.Manifest {
+		writeError(w, errManifestMismatch)
+		return
+	}
+
+	resp := BundleValidateResponse{Manifest: manifest, Valid: true, Members: make([]BundleMemberResult, len(bundle.Members))}
+	// Unsigned bundles are still accepted; a signature, once present, must verify
+	if len(bundle.Signature) > 0 {
+		if err := verifyDIDSignature(r.Context(), bundle.Header.Issuer, bundle.KeyID, []byte(manifest), bundle.Signature); err != nil {
+			writeError(w, err)
+			return
+		}
+		resp.Issuer = bundle.Header.Issuer
+	}
+	for i, m := range bundle.Members {
+		result := BundleMemberResult{Index: i, Circuit: m.Circuit, Valid: true}
+		start := time.Now()
+		err := checkTenantAccess(r, m.Circuit, envelopeThresholds(m)...)
+		if err == nil {
+			result.Issuer, err = checkEnvelopeSignature(r.Context(), m)
+		}
+		if err == nil {
+			err = verifyEnvelope(r.Context(), m)
+		}
+		result.VerifyingMs = milliseconds(time.Since(start))
+		if err != nil {
+			result.Valid = false
+			result.Error = err.Error()
+			resp.Valid = false
+		}
+		resp.Members[i] = result
+	}
+
+	if !resp.Valid {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+	writeJSON(w, resp)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestBundleManifest(t *testing.T) {
+	bundle := ProofBundle{
+		Header: BundleHeader{Version: bundleVersion, Subject: "holder-1"},
+		Members: []ProofEnvelope{
+			{Circuit: "balance", Inputs: json.RawMessage(`{"neededAmount": 100}`), Proof: json.RawMessage(`{"Ar": 1}`)},
+		},
+	}
+	manifest, err := bundle.manifest()
+	if err != nil {
+		t.Fatalf("manifest failed: %v", err)
+	}
+
+	// Whitespace in the embedded JSON does not change the manifest
+	reformatted := bundle
+	reformatted.Members = []ProofEnvelope{
+		{Circuit: "balance", Inputs: json.RawMessage(`{"neededAmount":100}`), Proof: json.RawMessage("{\n  \"Ar\": 1\n}")},
+	}
+	if got, _ := reformatted.manifest(); got != manifest {
+		t.Error("Expected the manifest to ignore JSON formatting")
+	}
+
+	tampered := bundle
+	tampered.Members = []ProofEnvelope{
+		{Circuit: "balance", Inputs: json.RawMessage(`{"neededAmount": 10}`), Proof: json.RawMessage(`{"Ar": 1}`)},
+	}
+	if got, _ := tampered.manifest(); got == manifest {
+		t.Error("Expected changed inputs to change the manifest")
+	}
+
+	relabeled := bundle
+	relabeled.Header.Subject = "holder-2"
+	if got, _ := relabeled.manifest(); got == manifest {
+		t.Error("Expected a changed header to change the manifest")
+	}
+}
+
+func TestValidateBundleRejectsMalformedBundles(t *testing.T) {
+	h := NewTestHelper(t)
+	member := ProofEnvelope{Circuit: "balance", Inputs: json.RawMessage(`{"neededAmount": 100}`), Proof: json.RawMessage(`{}`)}
+
+	rr := postJSON(t, createBundle, "/bundle", ProofBundle{Header: BundleHeader{Subject: "holder-1"}, Members: []ProofEnvelope{member}})
+	h.AssertStatusCode(rr, http.StatusOK, "creating a bundle")
+	var bundle ProofBundle
+	if err := json.Unmarshal(rr.Body.Bytes(), &bundle); err != nil {
+		t.Fatalf("Failed to decode bundle: %v", err)
+	}
+	if bundle.Header.Version != bundleVersion || bundle.Header.IssuedAt.IsZero() || len(bundle.Manifest) != 64 {
+		t.Errorf("Expected version, issue time and manifest to be stamped, got %+v", bundle)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(b *ProofBundle)
+		want   string
+	}{
+		{"Empty", func(b *ProofBundle) { b.Members = nil }, "no members"},
+		{"Unsupported version", func(b *ProofBundle) { b.Header.Version = 2 }, "unsupported bundle version"},
+		{"Manifest mismatch", func(b *ProofBundle) { b.Header.Subject = "someone-else" }, errManifestMismatch.Error()},
+		{"Too many members", func(b *ProofBundle) {
+			for len(b.Members) <= maxBundleMembers {
+				b.Members = append(b.Members, member)
+			}
+		}, "at most"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := bundle
+			b.Members = append([]ProofEnvelope(nil), bundle.Members...)
+			tt.modify(&b)
+			rr := postJSON(t, validateBundle, "/validate/bundle", b)
+			h.AssertStatusCode(rr, http.StatusBadRequest, tt.name)
+			if !strings.Contains(rr.Body.String(), tt.want) {
+				t.Errorf("Expected error containing %q, got %q", tt.want, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestVerifyEnvelopeRejectsBadInputs(t *testing.T) {
+	tests := []struct {
+		name     string
+		envelope ProofEnvelope
+	}{
+		{"Unknown circuit", ProofEnvelope{Circuit: "age", Inputs: json.RawMessage(`{}`), Proof: json.RawMessage(`{}`)}},
+		{"Unknown input field", ProofEnvelope{Circuit: "balance", Inputs: json.RawMessage(`{"amount": 1}`), Proof: json.RawMessage(`{}`)}},
+		{"Malformed proof", ProofEnvelope{Circuit: "balance", Inputs: json.RawMessage(`{}`), Proof: json.RawMessage(`"proof"`)}},
+		{"Unconfigured bucket", ProofEnvelope{Circuit: "balance-bucket", Inputs: json.RawMessage(`{"lower": 3, "upper": 5}`), Proof: json.RawMessage(`{}`)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verifyEnvelope(context.Background(), tt.envelope); err == nil {
+				t.Error("Expected the envelope to be rejected")
+			}
+		})
+	}
+}
+
+func TestBundleWorkflow(t *testing.T) {
+	SkipIfShort(t, "bundle proof generation")
+	withBuckets(t, []int64{0, 1000, 10000})
+
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+	h.StoreBalance("bundle_user", 4200)
+	postJSON(t, storeCreditScore, "/store/credit-score", CreditScoreRequest{ID: "bundle_user", Score: 720})
+
+	rr := postJSON(t, generateBucketProof, "/get/proof/bucket", BucketProofRequest{ID: "bundle_user"})
+	h.AssertStatusCode(rr, http.StatusOK, "generating bucket proof")
+	var bucketResp struct {
+		Bucket Bucket          `json:"bucket"`
+		Proof  json.RawMessage `json:"proof"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &bucketResp)
+
+	rr = postJSON(t, generatePredicateProof, "/get/proof/predicate", PredicateProofRequest{ID: "bundle_user", Predicate: "balance >= 100000 || creditScore >= 700"})
+	h.AssertStatusCode(rr, http.StatusOK, "generating predicate proof")
+	var predicateResp struct {
+		Predicate string          `json:"predicate"`
+		Proof     json.RawMessage `json:"proof"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &predicateResp)
+
+	bucketInputs, _ := json.Marshal(map[string]interface{}{"lower": bucketResp.Bucket.Lower, "upper": bucketResp.Bucket.Upper})
+	predicateInputs, _ := json.Marshal(map[string]string{"predicate": predicateResp.Predicate})
+
+	rr = postJSON(t, createBundle, "/bundle", ProofBundle{
+		Header: BundleHeader{Subject: "holder-1", Audience: "lender.example"},
+		Members: []ProofEnvelope{
+			{Circuit: bucketCircuitName, Inputs: bucketInputs, Proof: bucketResp.Proof},
+			{Circuit: predicateCircuitName, Inputs: predicateInputs, Proof: predicateResp.Proof},
+		},
+	})
+	h.AssertStatusCode(rr, http.StatusOK, "creating a bundle")
+	var bundle ProofBundle
+	json.Unmarshal(rr.Body.Bytes(), &bundle)
+
+	rr = postJSON(t, validateBundle, "/validate/bundle", bundle)
+	h.AssertStatusCode(rr, http.StatusOK, "validating a bundle")
+	var result BundleValidateResponse
+	json.Unmarshal(rr.Body.Bytes(), &result)
+	if !result.Valid || len(result.Members) != 2 || result.Manifest != bundle.Manifest {
+		t.Errorf("Expected every member to verify, got %+v", result)
+	}
+
+	// Swapping proofs between members is caught per member, under a freshly computed manifest
+	bundle.Members[0].Proof, bundle.Members[1].Proof = bundle.Members[1].Proof, bundle.Members[0].Proof
+	bundle.Manifest, _ = bundle.manifest()
+	rr = postJSON(t, validateBundle, "/validate/bundle", bundle)
+	h.AssertStatusCode(rr, http.StatusUnauthorized, "validating a bundle with swapped proofs")
+	json.Unmarshal(rr.Body.Bytes(), &result)
+	if result.Valid || result.Members[0].Valid || result.Members[1].Valid {
+		t.Errorf("Expected both members to fail, got %+v", result)
+	}
+}
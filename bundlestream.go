@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// maxStreamedMembers bounds the members of one streamed bundle; memory does not grow with them
+const maxStreamedMembers = 10000
+
+// streamMemberTimeout is how long each member may take to arrive and verify
+const streamMemberTimeout = 30 * time.Second
+
+// BundleStreamSummary is the last event of a streamed validation
+type BundleStreamSummary struct {
+	Manifest string `json:"manifest"`
+	Issuer   string `json:"issuer,omitempty"`
+	Valid    bool   `json:"valid"`
+	Members  int    `json:"members"`
+	Invalid  int    `json:"invalid"`
+	Error    string `json:"error,omitempty"` // why the bundle as a whole was rejected, such as a manifest mismatch
+}
+
+// eventStream writes server-sent events, flushing after each one
+type eventStream struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+func newEventStream(w http.ResponseWriter) *eventStream {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	rc := http.NewResponseController(w)
+	// HTTP/1 stops reading the request body once the response starts, unless asked not to
+	_ = rc.EnableFullDuplex()
+	w.WriteHeader(http.StatusOK)
+	return &eventStream{w: w, rc: rc}
+}
+
+func (s *eventStream) send(event string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	if err := s.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
+
+// extend pushes the connection deadlines past the server's timeouts for the next member
+func (s *eventStream) extend() {
+	deadline := time.Now().Add(streamMemberTimeout)
+	_ = s.rc.SetReadDeadline(deadline)
+	_ = s.rc.SetWriteDeadline(deadline)
+}
+
+// validateBundleStream verifies a bundle sent as JSON lines: first the bundle without members
+// (header, manifest and signature), then one member envelope per line. Each member's result is
+// sent as a "member" event as soon as it is verified, and a "summary" event closes the stream.
+// Members are not kept, so bundles of any size verify in constant memory.
+func validateBundleStream(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/x-ndjson" && mediaType != "application/jsonl" {
+		writeError(w, errs.Errorf(errs.Invalid, "Content-Type must be application/x-ndjson"))
+		return
+	}
+	lines := bufio.NewScanner(r.Body)
+	lines.Buffer(make([]byte, 0, 64<<10), maxRequestBodyBytes)
+
+	// The bundle line is checked before anything is streamed, so its errors are plain responses
+	var bundle ProofBundle
+	if !nextLine(lines) {
+		writeError(w, errs.Errorf(errs.Invalid, "the first line must be the bundle without its members"))
+		return
+	}
+	if err := unmarshalStrict(lines.Bytes(), &bundle); err != nil {
+		writeError(w, errs.Wrap(errs.Invalid, err))
+		return
+	}
+	if len(bundle.Members) > 0 {
+		writeError(w, errs.Errorf(errs.Invalid, "members follow the bundle line, one per line"))
+		return
+	}
+	if bundle.Header.Version != bundleVersion {
+		writeError(w, errs.Errorf(errs.Invalid, "unsupported bundle version %d", bundle.Header.Version))
+		return
+	}
+	// The signature covers the claimed manifest, which must match the members once they are all read
+	var issuer string
+	if len(bundle.Signature) > 0 {
+		if err := verifyDIDSignature(r.Context(), bundle.Header.Issuer, bundle.KeyID, []byte(bundle.Manifest), bundle.Signature); err != nil {
+			writeError(w, err)
+			return
+		}
+		issuer = bundle.Header.Issuer
+	}
+	manifest, err := newManifestHash(bundle.Header)
+	if err != nil {
+		writeError(w, errs.Wrap(errs.Invalid, err))
+		return
+	}
+
+	summary := BundleStreamSummary{Valid: true}
+	stream := newEventStream(w)
+	fail := func(reason string) {
+		summary.Valid, summary.Error = false, reason
+		_ = stream.send("summary", summary)
+	}
+	// ZK_REQUEST_TIMEOUT would end a long stream, so each member gets its own time instead;
+	// a client that goes away is noticed when reading or writing fails
+	base := context.WithoutCancel(r.Context())
+	for stream.extend(); nextLine(lines); stream.extend() {
+		i := summary.Members
+		if i == maxStreamedMembers {
+			fail(fmt.Sprintf("a streamed bundle may have at most %d members", maxStreamedMembers))
+			return
+		}
+		summary.Members++
+
+		var m ProofEnvelope
+		result := BundleMemberResult{Index: i, Valid: true}
+		err := unmarshalStrict(lines.Bytes(), &m)
+		if err == nil {
+			err = manifest.add(i, m)
+		}
+		if err != nil {
+			// A member that cannot be hashed makes the manifest unverifiable
+			fail(fmt.Sprintf("member %d: %v", i, err))
+			return
+		}
+		result.Circuit = m.Circuit
+		ctx, cancel := context.WithTimeout(base, streamMemberTimeout)
+		start := time.Now()
+		err = checkTenantAccess(r, m.Circuit, envelopeThresholds(m)...)
+		if err == nil {
+			result.Issuer, err = checkEnvelopeSignature(ctx, m)
+		}
+		if err == nil {
+			err = verifyEnvelope(ctx, m)
+		}
+		result.VerifyingMs = milliseconds(time.Since(start))
+		cancel()
+		if err != nil {
+			result.Valid, result.Error = false, err.Error()
+			summary.Valid = false
+			summary.Invalid++
+		}
+		if err := stream.send("member", result); err != nil {
+			return
+		}
+	}
+	if err := lines.Err(); err != nil {
+		fail(fmt.Sprintf("reading member %d: %v", summary.Members, err))
+		return
+	}
+
+	summary.Manifest = manifest.sum()
+	switch {
+	case summary.Members == 0:
+		fail("bundle has no members")
+	case summary.Manifest != bundle.Manifest:
+		fail(errManifestMismatch.Error())
+	default:
+		summary.Issuer = issuer
+		_ = stream.send("summary", summary)
+	}
+}
+
+// nextLine advances to the next non-blank line
+func nextLine(lines *bufio.Scanner) bool {
+	for lines.Scan() {
+		if len(bytes.TrimSpace(lines.Bytes())) > 0 {
+			return true
+		}
+	}
+	return false
+}
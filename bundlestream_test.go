@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type sseEvent struct {
+	event string
+	data  string
+}
+
+func readEvents(t *testing.T, body io.Reader) []sseEvent {
+	t.Helper()
+	var events []sseEvent
+	var current sseEvent
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			current.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			current.data = strings.TrimPrefix(line, "data: ")
+		case line == "" && current.event != "":
+			events = append(events, current)
+			current = sseEvent{}
+		}
+	}
+	return events
+}
+
+// streamBody writes a bundle as JSON lines: the bundle without members, then each member
+func streamBody(t *testing.T, bundle ProofBundle) string {
+	t.Helper()
+	members := bundle.Members
+	bundle.Members = nil
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	if err := enc.Encode(bundle); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range members {
+		if err := enc.Encode(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return b.String()
+}
+
+func TestValidateBundleStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(validateBundleStream))
+	t.Cleanup(server.Close)
+
+	members := make([]ProofEnvelope, 5)
+	for i := range members {
+		members[i] = ProofEnvelope{Circuit: "balance", Inputs: json.RawMessage(`{"neededAmount": 100}`), Proof: json.RawMessage(`{"Ar": 1}`)}
+	}
+	bundle := ProofBundle{Header: BundleHeader{Version: bundleVersion, Subject: "holder-1"}, Members: members}
+	manifest, err := bundle.manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		manifest string
+		error    string
+	}{
+		{"Members reported one by one", manifest, ""},
+		{"Manifest mismatch", strings.Repeat("0", 64), "manifest"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bundle.Manifest = tt.manifest
+			resp, err := http.Post(server.URL, "application/x-ndjson", strings.NewReader(streamBody(t, bundle)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+				t.Fatalf("Expected an event stream, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+			}
+
+			events := readEvents(t, resp.Body)
+			if len(events) != len(members)+1 {
+				t.Fatalf("Expected %d member events and a summary, got %+v", len(members), events)
+			}
+			for i, e := range events[:len(members)] {
+				var result BundleMemberResult
+				if err := json.Unmarshal([]byte(e.data), &result); err != nil || e.event != "member" || result.Index != i || result.Valid {
+					t.Errorf("Unexpected event %d: %+v", i, e)
+				}
+			}
+			var summary BundleStreamSummary
+			last := events[len(events)-1]
+			if err := json.Unmarshal([]byte(last.data), &summary); err != nil || last.event != "summary" {
+				t.Fatalf("Expected a summary, got %+v", last)
+			}
+			if summary.Valid || summary.Members != len(members) || summary.Invalid != len(members) || summary.Manifest != manifest {
+				t.Errorf("Unexpected summary %+v", summary)
+			}
+			if !strings.Contains(summary.Error, tt.error) || (tt.error == "") != (summary.Error == "") {
+				t.Errorf("Expected error %q, got %q", tt.error, summary.Error)
+			}
+		})
+	}
+}
+
+func TestValidateBundleStreamRejects(t *testing.T) {
+	header := `{"header": {"version": 1}, "manifest": "00"}`
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		error       string // summary error when the stream started
+	}{
+		{"Not JSON lines", "application/json", header, http.StatusBadRequest, ""},
+		{"Empty", "application/x-ndjson", "\n\n", http.StatusBadRequest, ""},
+		{"Unsupported version", "application/x-ndjson", `{"header": {"version": 7}}`, http.StatusBadRequest, ""},
+		{"Inline members", "application/x-ndjson", `{"header": {"version": 1}, "members": [{"circuit": "balance"}]}`, http.StatusBadRequest, ""},
+		{"No members", "application/x-ndjson", header, http.StatusOK, "no members"},
+		{"Malformed member", "application/x-ndjson", header + "\n{\"circuit\": 1}", http.StatusOK, "member 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/validate/bundle/stream", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rr := httptest.NewRecorder()
+			validateBundleStream(rr, req)
+			if rr.Code != tt.status {
+				t.Fatalf("Expected %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+			if tt.error == "" {
+				return
+			}
+			events := readEvents(t, rr.Body)
+			var summary BundleStreamSummary
+			if len(events) == 0 || json.Unmarshal([]byte(events[len(events)-1].data), &summary) != nil {
+				t.Fatalf("Expected a summary, got %+v", events)
+			}
+			if summary.Valid || !strings.Contains(summary.Error, tt.error) {
+				t.Errorf("Expected a failed summary with %q, got %+v", tt.error, summary)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+	"github.com/nats-io/nats.go"
+)
+
+// MessageBus is the minimal publish/subscribe interface needed by the proof request consumer.
+// NATS is provided; other brokers (e.g. Kafka) can be plugged in by implementing it.
+type MessageBus interface {
+	Subscribe(topic string, handler func(data []byte)) error
+	Publish(topic string, data []byte) error
+	Ping() error // reports whether the broker is currently reachable
+	Close() error
+}
+
+// BusConfig configures the optional message-bus integration
+type BusConfig struct {
+	URL          string // broker URL; the integration is disabled when empty
+	RequestTopic string
+	ReplyTopic   string
+	QueueGroup   string        // consumers in the same group share the request load
+	Timeout      time.Duration // bounds proving one request; 0 means no limit
+}
+
+// BusProofRequest is a proof request received from the message bus
+type BusProofRequest struct {
+	RequestID    string `json:"requestId"`
+	ID           string `json:"id"`
+	NeededAmount int    `json:"neededAmount"`
+	ReplyTo      string `json:"replyTo,omitempty"` // overrides the configured reply topic
+}
+
+// BusProofResult is published in reply to a BusProofRequest
+type BusProofResult struct {
+	RequestID    string          `json:"requestId"`
+	ID           string          `json:"id"`
+	NeededAmount int             `json:"neededAmount"` // threshold the proof states, rounded up with ZK_ROUND_THRESHOLDS
+	Status       string          `json:"status"`       // "ok" or "error"
+	Proof        json.RawMessage `json:"proof,omitempty"`
+	Digest       string          `json:"digest,omitempty"`
+	Error        string          `json:"error,omitempty"`
+	Code         string          `json:"code,omitempty"` // same codes as HTTP error responses
+	GeneratedAt  time.Time       `json:"generatedAt"`
+}
+
+// natsBus implements MessageBus on top of a NATS connection
+type natsBus struct {
+	conn  *nats.Conn
+	queue string
+}
+
+func newNATSBus(url, queue string) (*natsBus, error) {
+	conn, err := nats.Connect(url, nats.Name("zkTest1"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, err
+	}
+	return &natsBus{conn: conn, queue: queue}, nil
+}
+
+func (b *natsBus) Subscribe(topic string, handler func(data []byte)) error {
+	_, err := b.conn.QueueSubscribe(topic, b.queue, func(msg *nats.Msg) {
+		handler(msg.Data)
+	})
+	return err
+}
+
+func (b *natsBus) Publish(topic string, data []byte) error {
+	return b.conn.Publish(topic, data)
+}
+
+func (b *natsBus) Ping() error {
+	if !b.conn.IsConnected() {
+		return fmt.Errorf("nats connection is %s", b.conn.Status())
+	}
+	return b.conn.FlushTimeout(2 * time.Second)
+}
+
+func (b *natsBus) Close() error {
+	return b.conn.Drain()
+}
+
+// proofConsumer turns proof requests read from the bus into published proof results
+type proofConsumer struct {
+	bus        MessageBus
+	replyTopic string
+	timeout    time.Duration
+}
+
+// startProofConsumer subscribes to the request topic and answers on the reply topic
+func startProofConsumer(bus MessageBus, cfg BusConfig) error {
+	c := &proofConsumer{bus: bus, replyTopic: cfg.ReplyTopic, timeout: cfg.Timeout}
+	return bus.Subscribe(cfg.RequestTopic, c.handle)
+}
+
+func (c *proofConsumer) handle(data []byte) {
+	var req BusProofRequest
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		log.Printf("Dropping malformed bus proof request: %v", describeDecodeError(err))
+		return
+	}
+
+	result := BusProofResult{
+		RequestID:    req.RequestID,
+		ID:           req.ID,
+		NeededAmount: req.NeededAmount,
+		Status:       "ok",
+	}
+
+	// Requests off the bus are bulk work and wait behind interactive proofs
+	ctx := withProvingLane(context.Background(), laneBatch)
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	if err := c.prove(ctx, req, &result); err != nil {
+		result.Status = "error"
+		result.Error = err.Error()
+		result.Code = errs.Code(err)
+	}
+	result.GeneratedAt = time.Now().UTC()
+
+	payload, err := json.Marshal(result)
+	if err != nil {
+		log.Printf("Failed to encode bus proof result %s: %v", req.RequestID, err)
+		return
+	}
+
+	topic := c.replyTopic
+	if req.ReplyTo != "" {
+		topic = req.ReplyTo
+	}
+	if err := c.bus.Publish(topic, payload); err != nil {
+		log.Printf("Failed to publish bus proof result %s: %v", req.RequestID, err)
+	}
+}
+
+func (c *proofConsumer) prove(ctx context.Context, req BusProofRequest, result *BusProofResult) error {
+	if req.RequestID == "" {
+		return errors.New("requestId is required")
+	}
+
+	neededAmount, err := roundThreshold(req.NeededAmount)
+	if err != nil {
+		return err
+	}
+	result.NeededAmount = neededAmount
+	if err := checkUserIssuance(req.ID); err != nil {
+		return err
+	}
+	observeThreshold("", req.ID, balanceCircuitName, int64(neededAmount))
+	proof, digest, err := proveBalance(ctx, defaultCurve, req.ID, neededAmount)
+	if err != nil {
+		return err
+	}
+
+	result.Digest = digest
+	result.Proof, err = json.Marshal(proof)
+	return err
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+// memoryBus is an in-process MessageBus delivering messages synchronously
+type memoryBus struct {
+	mu        sync.Mutex
+	handlers  map[string]func([]byte)
+	published map[string][][]byte
+}
+
+func newMemoryBus() *memoryBus {
+	return &memoryBus{
+		handlers:  make(map[string]func([]byte)),
+		published: make(map[string][][]byte),
+	}
+}
+
+func (b *memoryBus) Subscribe(topic string, handler func([]byte)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[topic] = handler
+	return nil
+}
+
+func (b *memoryBus) Publish(topic string, data []byte) error {
+	b.mu.Lock()
+	b.published[topic] = append(b.published[topic], data)
+	handler := b.handlers[topic]
+	b.mu.Unlock()
+
+	if handler != nil {
+		handler(data)
+	}
+	return nil
+}
+
+func (b *memoryBus) Ping() error { return nil }
+
+func (b *memoryBus) Close() error { return nil }
+
+func (b *memoryBus) lastResult(t *testing.T, topic string) BusProofResult {
+	t.Helper()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	messages := b.published[topic]
+	if len(messages) == 0 {
+		t.Fatalf("Expected a message on %s", topic)
+	}
+
+	var result BusProofResult
+	if err := json.Unmarshal(messages[len(messages)-1], &result); err != nil {
+		t.Fatalf("Failed to decode result: %v", err)
+	}
+	return result
+}
+
+var testBusConfig = BusConfig{RequestTopic: "requests", ReplyTopic: "results"}
+
+func TestProofConsumerErrors(t *testing.T) {
+	NewTestHelper(t).SetupCleanBalances()
+
+	bus := newMemoryBus()
+	if err := startProofConsumer(bus, testBusConfig); err != nil {
+		t.Fatalf("Failed to start consumer: %v", err)
+	}
+
+	t.Run("Unknown balance", func(t *testing.T) {
+		_ = bus.Publish("requests", []byte(`{"requestId": "r1", "id": "nobody", "neededAmount": 10}`))
+
+		result := bus.lastResult(t, "results")
+		if result.RequestID != "r1" || result.Status != "error" || result.Error != errBalanceNotFound.Error() {
+			t.Errorf("Unexpected result %+v", result)
+		}
+	})
+
+	t.Run("Missing request ID", func(t *testing.T) {
+		_ = bus.Publish("requests", []byte(`{"id": "nobody", "neededAmount": 10, "replyTo": "custom"}`))
+
+		result := bus.lastResult(t, "custom")
+		if result.Status != "error" {
+			t.Errorf("Expected error status, got %+v", result)
+		}
+	})
+
+	t.Run("Malformed request is dropped", func(t *testing.T) {
+		before := len(bus.published["results"])
+		_ = bus.Publish("requests", []byte(`{"requestId": "r2", "amount": 10}`))
+
+		if after := len(bus.published["results"]); after != before {
+			t.Errorf("Expected no reply for a malformed request, got %d new", after-before)
+		}
+	})
+}
+
+func TestProofConsumerProves(t *testing.T) {
+	SkipIfShort(t, "bus proof generation")
+
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+	h.AssertStatusCode(h.StoreBalance("bus_user", 150), http.StatusOK, "storing balance")
+
+	bus := newMemoryBus()
+	if err := startProofConsumer(bus, testBusConfig); err != nil {
+		t.Fatalf("Failed to start consumer: %v", err)
+	}
+
+	_ = bus.Publish("requests", []byte(`{"requestId": "r1", "id": "bus_user", "neededAmount": 100}`))
+
+	result := bus.lastResult(t, "results")
+	if result.Status != "ok" || len(result.Proof) == 0 {
+		t.Errorf("Expected proof in result, got %+v", result)
+	}
+}
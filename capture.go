@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/korjavin/zkTest1/internal/capture"
+)
+
+// maxCapturedResponse bounds the part of a response kept to read its outcome
+const maxCapturedResponse = 64 << 10
+
+// captured reports whether a request is written to the capture file. Only verification
+// requests are: their bodies are proofs and public inputs, never balances or witnesses.
+// Streamed bundles are left out because their outcome is only known at the end of the stream.
+func captured(r *http.Request) bool {
+	return r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/validate") && !strings.HasSuffix(r.URL.Path, "/stream")
+}
+
+// captureRecorder keeps the status and the start of the body written by a handler
+type captureRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *captureRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *captureRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	if room := maxCapturedResponse - r.body.Len(); room > 0 {
+		r.body.Write(p[:min(len(p), room)])
+	}
+	return r.ResponseWriter.Write(p)
+}
+
+func (r *captureRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// captureRequests writes every verification request with its outcome to out, so that
+// zkctl replay can send the same traffic to another instance and compare the answers.
+// Bodies are captured as sent; credentials and signatures are not.
+func captureRequests(out *capture.Writer, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !captured(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Read no more than a handler accepts; the rest is left for it to reject
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBodyBytes+1))
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		if err != nil || len(body) > maxRequestBodyBytes {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &captureRecorder{ResponseWriter: w}
+		start := time.Now()
+		next.ServeHTTP(rec, r)
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		err = out.Write(capture.Record{
+			Time:        start.UTC(),
+			RequestID:   w.Header().Get(requestIDHeader),
+			Method:      r.Method,
+			Path:        r.URL.Path,
+			Query:       r.URL.RawQuery,
+			ContentType: r.Header.Get("Content-Type"),
+			Body:        body,
+			Outcome:     capture.OutcomeOf(status, rec.body.Bytes()),
+		})
+		if err != nil {
+			log.Printf("Failed to capture request: %v", err)
+		}
+	})
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/korjavin/zkTest1/internal/capture"
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+func TestCaptureRequests(t *testing.T) {
+	var buf bytes.Buffer
+	handler := withRequestID(captureRequests(capture.NewWriter(&buf), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), "proof") {
+			writeError(w, errs.Errorf(errs.Invalid, "handler did not get the body"))
+			return
+		}
+		if r.URL.Path == "/validate" {
+			writeError(w, errInvalidProof)
+			return
+		}
+		writeJSON(w, map[string]any{"valid": true})
+	})))
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest("POST", "/validate?curve=bn254", strings.NewReader(`{"proof": {}}`)),
+		httptest.NewRequest("POST", "/validate/bundle", strings.NewReader(`{"members": [{"proof": {}}]}`)),
+		httptest.NewRequest("POST", "/balance", strings.NewReader(`{"proof": "not captured"}`)),
+		httptest.NewRequest("POST", "/validate/bundle/stream", strings.NewReader(`{"proof": "not captured"}`)),
+	} {
+		req.Header.Set("Content-Type", "application/json")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	var records []capture.Record
+	if err := capture.Read(&buf, func(r capture.Record) error { records = append(records, r); return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected the two verification requests to be captured, got %+v", records)
+	}
+	first := records[0]
+	if first.Path != "/validate" || first.Query != "curve=bn254" || string(first.Body) != `{"proof": {}}` || first.ContentType != "application/json" || first.RequestID == "" {
+		t.Errorf("Unexpected record %+v", first)
+	}
+	if first.Status != http.StatusUnauthorized || first.Code != "proof_invalid" {
+		t.Errorf("Expected an invalid proof outcome, got %s", first.Outcome)
+	}
+	if second := records[1]; second.Status != http.StatusOK || second.Valid == nil || !*second.Valid {
+		t.Errorf("Expected a valid outcome, got %s", second.Outcome)
+	}
+}
@@ -7,11 +7,12 @@ import (
 	"github.com/consensys/gnark/backend/groth16"
 	"github.com/consensys/gnark/frontend"
 	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/korjavin/zkTest1/circuits"
 )
 
 func TestBalanceCircuit_Compilation(t *testing.T) {
 	// Test that the circuit compiles successfully
-	circuit := &BalanceCircuit{}
+	circuit := &circuits.BalanceCircuit{}
 
 	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, circuit)
 	if err != nil {
@@ -33,7 +34,7 @@ func TestBalanceCircuit_Compilation(t *testing.T) {
 
 func TestBalanceCircuit_CompileAndSetup(t *testing.T) {
 	// Test that the circuit compiles successfully
-	circuit := &BalanceCircuit{}
+	circuit := &circuits.BalanceCircuit{}
 
 	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, circuit)
 	if err != nil {
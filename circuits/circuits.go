@@ -0,0 +1,454 @@
+// Package circuits defines the fixed-shape zero-knowledge circuits shared by the server
+// and the offline keygen, prove and verify commands.
+package circuits
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/bits"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	bn254mimc "github.com/consensys/gnark-crypto/ecc/bn254/fr/mimc"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/constraint"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/consensys/gnark/frontend/cs/scs"
+	"github.com/consensys/gnark/frontend/schema"
+	stdmimc "github.com/consensys/gnark/std/hash/mimc"
+	stdbits "github.com/consensys/gnark/std/math/bits"
+	"github.com/consensys/gnark/std/rangecheck"
+)
+
+// Names under which the circuits are registered, also used to name their key files
+const (
+	BalanceName   = "balance"
+	CommittedName = "balance-committed"
+	BucketName    = "balance-bucket"
+	PredicateName = "predicate-or"
+	TimeLockName  = "balance-timelock"
+	StrictName    = "balance-strict"
+	FastName      = "balance-fast"
+	CompactName   = "balance-compact"
+)
+
+// ValueBits is the width balances, amounts and thresholds are range checked to
+const ValueBits = 64
+
+// FastValueBits is the narrower width of FastBalanceCircuit
+const FastValueBits = 32
+
+// Comparator compares unsigned integers of a known width with gnark's range checker. It uses
+// a commitment-based lookup argument when the builder supports commitments, as the Groth16 and
+// PLONK builders do, and bit decomposition otherwise. Checking both operands and their
+// difference this way costs far fewer constraints than api.AssertIsLessOrEqual, which
+// decomposes both over the full width of the field.
+type Comparator struct {
+	api     frontend.API
+	checker frontend.Rangechecker
+}
+
+func NewComparator(api frontend.API) *Comparator {
+	return &Comparator{api: api, checker: rangecheck.New(api)}
+}
+
+// NewBinaryComparator returns a comparator that always range checks by bit decomposition. It
+// takes more constraints than NewComparator, but adds no commitment to Groth16 proofs.
+func NewBinaryComparator(api frontend.API) *Comparator {
+	return &Comparator{api: api, checker: binaryChecker{api}}
+}
+
+type binaryChecker struct{ api frontend.API }
+
+// Check asserts 0 ≤ v < 2^bits by decomposing v into bits bits
+func (c binaryChecker) Check(v frontend.Variable, bits int) {
+	stdbits.ToBinary(c.api, v, stdbits.WithNbDigits(bits))
+}
+
+// Check asserts 0 ≤ v < 2^bits
+func (c *Comparator) Check(v frontend.Variable, bits int) {
+	c.checker.Check(v, bits)
+}
+
+// AssertIsLessOrEqual asserts a ≤ b. Both must have been checked to below 2^bits: b - a is then
+// below 2^bits exactly when a ≤ b, and wraps around to a field element far above it otherwise.
+func (c *Comparator) AssertIsLessOrEqual(a, b frontend.Variable, bits int) {
+	c.checker.Check(c.api.Sub(b, a), bits)
+}
+
+// BalanceCircuit proves balance ≥ neededAmount
+type BalanceCircuit struct {
+	Balance      frontend.Variable `gnark:",secret"`
+	NeededAmount frontend.Variable `gnark:",public"`
+}
+
+func (circuit *BalanceCircuit) Define(api frontend.API) error {
+	cmp := NewComparator(api)
+	cmp.Check(circuit.Balance, ValueBits)
+	cmp.Check(circuit.NeededAmount, ValueBits)
+	cmp.AssertIsLessOrEqual(circuit.NeededAmount, circuit.Balance, ValueBits)
+	return nil
+}
+
+// StrictBalanceCircuit proves balance > neededAmount, for integrators whose threshold must
+// itself not be enough
+type StrictBalanceCircuit struct {
+	Balance      frontend.Variable `gnark:",secret"`
+	NeededAmount frontend.Variable `gnark:",public"`
+}
+
+// Define asserts neededAmount + 1 ≤ balance. Both are below 2^ValueBits, so the difference
+// balance - neededAmount - 1 is in range exactly when balance > neededAmount.
+func (circuit *StrictBalanceCircuit) Define(api frontend.API) error {
+	cmp := NewComparator(api)
+	cmp.Check(circuit.Balance, ValueBits)
+	cmp.Check(circuit.NeededAmount, ValueBits)
+	cmp.AssertIsLessOrEqual(api.Add(circuit.NeededAmount, 1), circuit.Balance, ValueBits)
+	return nil
+}
+
+// FastBalanceCircuit proves balance ≥ neededAmount for values below 2^FastValueBits. Its range
+// checks are half as wide as BalanceCircuit's, so it proves faster; balances or thresholds too
+// large for it cannot be proven.
+type FastBalanceCircuit struct {
+	Balance      frontend.Variable `gnark:",secret"`
+	NeededAmount frontend.Variable `gnark:",public"`
+}
+
+func (circuit *FastBalanceCircuit) Define(api frontend.API) error {
+	cmp := NewComparator(api)
+	cmp.Check(circuit.Balance, FastValueBits)
+	cmp.Check(circuit.NeededAmount, FastValueBits)
+	cmp.AssertIsLessOrEqual(circuit.NeededAmount, circuit.Balance, FastValueBits)
+	return nil
+}
+
+// CompactBalanceCircuit proves what BalanceCircuit does with range checks by bit decomposition,
+// so its Groth16 proofs carry no commitment and are smaller, at the cost of proving time
+type CompactBalanceCircuit struct {
+	Balance      frontend.Variable `gnark:",secret"`
+	NeededAmount frontend.Variable `gnark:",public"`
+}
+
+func (circuit *CompactBalanceCircuit) Define(api frontend.API) error {
+	cmp := NewBinaryComparator(api)
+	cmp.Check(circuit.Balance, ValueBits)
+	cmp.Check(circuit.NeededAmount, ValueBits)
+	cmp.AssertIsLessOrEqual(circuit.NeededAmount, circuit.Balance, ValueBits)
+	return nil
+}
+
+// CommittedBalanceCircuit proves balance ≥ threshold while only a MiMC commitment
+// to the threshold is public, so the requested amount never appears in the proof.
+type CommittedBalanceCircuit struct {
+	Balance    frontend.Variable `gnark:",secret"`
+	Threshold  frontend.Variable `gnark:",secret"`
+	Salt       frontend.Variable `gnark:",secret"`
+	Commitment frontend.Variable `gnark:",public"`
+}
+
+func (circuit *CommittedBalanceCircuit) Define(api frontend.API) error {
+	h, err := stdmimc.NewMiMC(api)
+	if err != nil {
+		return err
+	}
+	h.Write(circuit.Threshold, circuit.Salt)
+	api.AssertIsEqual(h.Sum(), circuit.Commitment)
+
+	cmp := NewComparator(api)
+	cmp.Check(circuit.Balance, ValueBits)
+	cmp.Check(circuit.Threshold, ValueBits)
+	cmp.AssertIsLessOrEqual(circuit.Threshold, circuit.Balance, ValueBits)
+	return nil
+}
+
+// BucketCircuit proves lower ≤ balance < upper, disclosing only the bucket bounds
+type BucketCircuit struct {
+	Balance frontend.Variable `gnark:",secret"`
+	Lower   frontend.Variable `gnark:",public"`
+	Upper   frontend.Variable `gnark:",public"` // exclusive
+}
+
+func (circuit *BucketCircuit) Define(api frontend.API) error {
+	cmp := NewComparator(api)
+	last := api.Sub(circuit.Upper, 1)
+	for _, v := range []frontend.Variable{circuit.Lower, circuit.Balance, last} {
+		cmp.Check(v, ValueBits)
+	}
+	cmp.AssertIsLessOrEqual(circuit.Lower, circuit.Balance, ValueBits)
+	cmp.AssertIsLessOrEqual(circuit.Balance, last, ValueBits)
+	return nil
+}
+
+// TimestampBits bounds NotBefore to Unix seconds below 2^40, well past the year 30000
+const TimestampBits = 40
+
+// TimeLockedBalanceCircuit proves balance ≥ neededAmount for a proof that verifiers accept only
+// from NotBefore (Unix seconds) on. NotBefore is a public input, so it cannot be changed without
+// invalidating the proof; the verifier compares it with its own clock.
+type TimeLockedBalanceCircuit struct {
+	Balance      frontend.Variable `gnark:",secret"`
+	NeededAmount frontend.Variable `gnark:",public"`
+	NotBefore    frontend.Variable `gnark:",public"`
+}
+
+func (circuit *TimeLockedBalanceCircuit) Define(api frontend.API) error {
+	cmp := NewComparator(api)
+	cmp.Check(circuit.NotBefore, TimestampBits)
+	cmp.Check(circuit.Balance, ValueBits)
+	cmp.Check(circuit.NeededAmount, ValueBits)
+	cmp.AssertIsLessOrEqual(circuit.NeededAmount, circuit.Balance, ValueBits)
+	return nil
+}
+
+// MaxPredicateClauses is the number of clause slots in PredicateCircuit
+const MaxPredicateClauses = 4
+
+// PredicateAttributes are the attributes predicates can refer to, encoded in-circuit by their index
+var PredicateAttributes = []string{"balance", "creditScore"}
+
+// PredicateCircuit proves that at least one enabled clause "attribute ≥ threshold" holds.
+// Private selector wires pick the satisfied clause, so the verifier does not learn which one.
+type PredicateCircuit struct {
+	Values    [MaxPredicateClauses]frontend.Variable `gnark:",secret"`
+	Selectors [MaxPredicateClauses]frontend.Variable `gnark:",secret"`
+	Enabled   [MaxPredicateClauses]frontend.Variable `gnark:",public"`
+	Attribute [MaxPredicateClauses]frontend.Variable `gnark:",public"`
+	Threshold [MaxPredicateClauses]frontend.Variable `gnark:",public"`
+}
+
+func (circuit *PredicateCircuit) Define(api frontend.API) error {
+	cmp := NewComparator(api)
+	attributeBits := bits.Len(uint(len(PredicateAttributes) - 1))
+	selected := frontend.Variable(0)
+	for i := 0; i < MaxPredicateClauses; i++ {
+		api.AssertIsBoolean(circuit.Enabled[i])
+		api.AssertIsBoolean(circuit.Selectors[i])
+		cmp.Check(circuit.Attribute[i], attributeBits)
+		cmp.Check(api.Sub(len(PredicateAttributes)-1, circuit.Attribute[i]), attributeBits)
+
+		// A selector may only point at an enabled clause
+		api.AssertIsEqual(api.Mul(circuit.Selectors[i], api.Sub(1, circuit.Enabled[i])), 0)
+
+		// Selected clauses must hold; unselected ones compare the threshold with itself
+		value := api.Select(circuit.Selectors[i], circuit.Values[i], circuit.Threshold[i])
+		cmp.Check(circuit.Threshold[i], ValueBits)
+		cmp.Check(value, ValueBits)
+		cmp.AssertIsLessOrEqual(circuit.Threshold[i], value, ValueBits)
+
+		selected = api.Add(selected, circuit.Selectors[i])
+	}
+	api.AssertIsDifferent(selected, 0)
+	return nil
+}
+
+// registry maps circuit names to constructors of empty circuits
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]func() frontend.Circuit{
+		BalanceName:   func() frontend.Circuit { return &BalanceCircuit{} },
+		CommittedName: func() frontend.Circuit { return &CommittedBalanceCircuit{} },
+		BucketName:    func() frontend.Circuit { return &BucketCircuit{} },
+		PredicateName: func() frontend.Circuit { return &PredicateCircuit{} },
+		TimeLockName:  func() frontend.Circuit { return &TimeLockedBalanceCircuit{} },
+		StrictName:    func() frontend.Circuit { return &StrictBalanceCircuit{} },
+		FastName:      func() frontend.Circuit { return &FastBalanceCircuit{} },
+		CompactName:   func() frontend.Circuit { return &CompactBalanceCircuit{} },
+	}
+)
+
+// validName keeps registered names usable in URL paths and key file names
+var validName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// Register adds a circuit defined outside this package under name. Programs embedding the
+// server register their circuits before it starts, from an init function or a plugin; the
+// server then sets up keys for them and verifies their proofs against a public witness.
+// Circuits that also implement Assigner can be proven from stored user attributes.
+func Register(name string, newCircuit func() frontend.Circuit) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("circuit name %q must be lowercase letters, digits and dashes", name)
+	}
+	if newCircuit == nil {
+		return fmt.Errorf("circuit %q has no constructor", name)
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[name]; ok {
+		return fmt.Errorf("circuit %q is already registered", name)
+	}
+	registry[name] = newCircuit
+	return nil
+}
+
+// Assigner is implemented by registered circuits the server can prove for a user. Assign is
+// called on an empty circuit with the user's stored attributes, including "balance", and the
+// inputs of the proof request, and returns the full assignment.
+type Assigner interface {
+	Assign(attributes map[string]int64, inputs json.RawMessage) (frontend.Circuit, error)
+}
+
+// Sampler is implemented by circuits with a known satisfying assignment. The server proves it
+// as a canary with newly generated keys before using them. Sample returns nil when it has no
+// assignment on curve.
+type Sampler interface {
+	Sample(curve ecc.ID) frontend.Circuit
+}
+
+func (*BalanceCircuit) Sample(ecc.ID) frontend.Circuit {
+	return &BalanceCircuit{Balance: 2, NeededAmount: 1}
+}
+
+func (*StrictBalanceCircuit) Sample(ecc.ID) frontend.Circuit {
+	return &StrictBalanceCircuit{Balance: 2, NeededAmount: 1}
+}
+
+func (*FastBalanceCircuit) Sample(ecc.ID) frontend.Circuit {
+	return &FastBalanceCircuit{Balance: 2, NeededAmount: 1}
+}
+
+func (*CompactBalanceCircuit) Sample(ecc.ID) frontend.Circuit {
+	return &CompactBalanceCircuit{Balance: 2, NeededAmount: 1}
+}
+
+// Sample commits to the threshold with MiMC, which is only computed natively over BN254
+func (*CommittedBalanceCircuit) Sample(curve ecc.ID) frontend.Circuit {
+	if curve != ecc.BN254 {
+		return nil
+	}
+	var threshold, salt fr.Element
+	threshold.SetUint64(1)
+	salt.SetUint64(7)
+	h := bn254mimc.NewMiMC()
+	tb, sb := threshold.Bytes(), salt.Bytes()
+	h.Write(tb[:])
+	h.Write(sb[:])
+	return &CommittedBalanceCircuit{Balance: 2, Threshold: 1, Salt: 7, Commitment: h.Sum(nil)}
+}
+
+func (*BucketCircuit) Sample(ecc.ID) frontend.Circuit {
+	return &BucketCircuit{Balance: 2, Lower: 1, Upper: 4}
+}
+
+func (*TimeLockedBalanceCircuit) Sample(ecc.ID) frontend.Circuit {
+	return &TimeLockedBalanceCircuit{Balance: 2, NeededAmount: 1, NotBefore: 1}
+}
+
+// Sample enables the first clause only and selects it
+func (*PredicateCircuit) Sample(ecc.ID) frontend.Circuit {
+	var c PredicateCircuit
+	for i := range MaxPredicateClauses {
+		c.Values[i], c.Selectors[i], c.Enabled[i], c.Attribute[i], c.Threshold[i] = 0, 0, 0, 0, 0
+	}
+	c.Values[0], c.Selectors[0], c.Enabled[0], c.Threshold[0] = 2, 1, 1, 1
+	return &c
+}
+
+// New returns an empty circuit of the given name, ready to compile or to receive a witness
+func New(name string) (frontend.Circuit, error) {
+	registryMu.RLock()
+	newCircuit, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown circuit %q", name)
+	}
+	return newCircuit(), nil
+}
+
+// Names lists the registered circuits in sorted order
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Compile compiles a circuit to an R1CS over the BN254 scalar field
+func Compile(circuit frontend.Circuit) (constraint.ConstraintSystem, error) {
+	return frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, circuit)
+}
+
+// CompileSparse compiles a circuit to a PLONK constraint system over the BN254 scalar field
+func CompileSparse(circuit frontend.Circuit) (constraint.ConstraintSystem, error) {
+	return frontend.Compile(ecc.BN254.ScalarField(), scs.NewBuilder, circuit)
+}
+
+// ParseWitness reads a witness from JSON keyed by the circuit's field names, e.g.
+// {"Balance": 100, "NeededAmount": 50}. With publicOnly, secret fields may be omitted.
+func ParseWitness(circuit frontend.Circuit, data []byte, publicOnly bool) (witness.Witness, error) {
+	s, err := frontend.NewSchema(circuit)
+	if err != nil {
+		return nil, err
+	}
+	w, err := witness.New(ecc.BN254.ScalarField())
+	if err != nil {
+		return nil, err
+	}
+	if err := w.FromJSON(s, data); err != nil {
+		return nil, err
+	}
+	if publicOnly {
+		return w.Public()
+	}
+	return w, nil
+}
+
+// PublicInput is one public input of a circuit, in the order of the public witness
+type PublicInput struct {
+	Index    int    `json:"index"`
+	Name     string `json:"name"`               // gnark's name, e.g. "Threshold_2" for Threshold[2]
+	Field    string `json:"field"`              // struct field holding the input, the key in JSON witnesses
+	Position *int   `json:"position,omitempty"` // index within Field when it is an array
+	Type     string `json:"type"`
+}
+
+// inputTypes tells clients how to encode public inputs, by struct field; other fields are raw field elements
+var inputTypes = map[string]string{
+	"NeededAmount": "uint",
+	"Lower":        "uint",
+	"Upper":        "uint",
+	"Threshold":    "uint",
+	"NotBefore":    "unix-seconds",
+	"Enabled":      "bool",
+	"Attribute":    "attribute-index",
+}
+
+// PublicInputs lists the public inputs of a circuit in witness order
+func PublicInputs(circuit frontend.Circuit) ([]PublicInput, error) {
+	s, err := frontend.NewSchema(circuit)
+	if err != nil {
+		return nil, err
+	}
+
+	var inputs []PublicInput
+	for _, f := range s.Fields {
+		if f.Visibility != schema.Public {
+			continue
+		}
+		typ, ok := inputTypes[f.Name]
+		if !ok {
+			typ = "field"
+		}
+		switch f.Type {
+		case schema.Leaf:
+			inputs = append(inputs, PublicInput{Index: len(inputs), Name: f.FullName, Field: f.Name, Type: typ})
+		case schema.Array:
+			for i := 0; i < f.ArraySize; i++ {
+				position := i
+				inputs = append(inputs, PublicInput{Index: len(inputs), Name: fmt.Sprintf("%s_%d", f.Name, i), Field: f.Name, Position: &position, Type: typ})
+			}
+		default:
+			return nil, fmt.Errorf("public input %s: nested structs are not supported", f.Name)
+		}
+	}
+	return inputs, nil
+}
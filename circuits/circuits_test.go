@@ -0,0 +1,241 @@
+package circuits
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/test"
+)
+
+func TestNew(t *testing.T) {
+	for _, name := range Names() {
+		if _, err := New(name); err != nil {
+			t.Errorf("Expected %s to be registered: %v", name, err)
+		}
+	}
+	if _, err := New("composite/age"); err == nil {
+		t.Error("Expected an unknown circuit to be rejected")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	newCircuit := func() frontend.Circuit { return &BalanceCircuit{} }
+	// Registrations cannot be undone, so repeated runs need a fresh name
+	name := fmt.Sprintf("register-test-%d", len(Names()))
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{name, false},
+		{name, true},
+		{BalanceName, true},
+		{"Upper-Case", true},
+		{"composite/age", true},
+		{"", true},
+	}
+	for _, tt := range tests {
+		if err := Register(tt.name, newCircuit); (err != nil) != tt.wantErr {
+			t.Errorf("Register(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+	if _, err := New(name); err != nil {
+		t.Errorf("Expected the registered circuit to be available: %v", err)
+	}
+}
+
+func TestSamplesSatisfyCircuits(t *testing.T) {
+	for _, name := range []string{BalanceName, CommittedName, BucketName, PredicateName, TimeLockName, StrictName, FastName, CompactName} {
+		for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_381} {
+			circuit, _ := New(name)
+			sampler, ok := circuit.(Sampler)
+			if !ok {
+				t.Errorf("Expected %s to have a sample assignment", name)
+				continue
+			}
+			sample := sampler.Sample(curve)
+			if sample == nil {
+				continue
+			}
+			if err := test.IsSolved(circuit, sample, curve.ScalarField()); err != nil {
+				t.Errorf("Sample of %s on %s does not satisfy the circuit: %v", name, curve, err)
+			}
+		}
+	}
+}
+
+func TestComparisonBoundary(t *testing.T) {
+	tests := []struct {
+		name       string
+		circuit    frontend.Circuit
+		assignment frontend.Circuit
+		holds      bool
+	}{
+		{"Inclusive at the threshold", &BalanceCircuit{}, &BalanceCircuit{Balance: 100, NeededAmount: 100}, true},
+		{"Inclusive below", &BalanceCircuit{}, &BalanceCircuit{Balance: 99, NeededAmount: 100}, false},
+		{"Strict above", &StrictBalanceCircuit{}, &StrictBalanceCircuit{Balance: 101, NeededAmount: 100}, true},
+		{"Strict at the threshold", &StrictBalanceCircuit{}, &StrictBalanceCircuit{Balance: 100, NeededAmount: 100}, false},
+		{"Strict below", &StrictBalanceCircuit{}, &StrictBalanceCircuit{Balance: 0, NeededAmount: 100}, false},
+		{"Strict at the largest threshold", &StrictBalanceCircuit{}, &StrictBalanceCircuit{Balance: uint64(1<<ValueBits - 1), NeededAmount: uint64(1<<ValueBits - 1)}, false},
+		{"Fast at the threshold", &FastBalanceCircuit{}, &FastBalanceCircuit{Balance: 100, NeededAmount: 100}, true},
+		{"Fast below", &FastBalanceCircuit{}, &FastBalanceCircuit{Balance: 99, NeededAmount: 100}, false},
+		{"Fast beyond its width", &FastBalanceCircuit{}, &FastBalanceCircuit{Balance: uint64(1 << FastValueBits), NeededAmount: 1}, false},
+		{"Compact at the threshold", &CompactBalanceCircuit{}, &CompactBalanceCircuit{Balance: 100, NeededAmount: 100}, true},
+		{"Compact below", &CompactBalanceCircuit{}, &CompactBalanceCircuit{Balance: 99, NeededAmount: 100}, false},
+		{"Compact at the largest balance", &CompactBalanceCircuit{}, &CompactBalanceCircuit{Balance: uint64(1<<ValueBits - 1), NeededAmount: 1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := test.IsSolved(tt.circuit, tt.assignment, ecc.BN254.ScalarField())
+			if (err == nil) != tt.holds {
+				t.Errorf("Expected the comparison to hold: %v, got %v", tt.holds, err)
+			}
+		})
+	}
+}
+
+func TestParseWitness(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       string
+		publicOnly bool
+		wantErr    bool
+	}{
+		{"Full witness", `{"Balance": 100, "NeededAmount": 50}`, false, false},
+		{"Public inputs only", `{"NeededAmount": 50}`, true, false},
+		{"Missing public input", `{"Balance": 100}`, false, true},
+		{"Unknown field", `{"NeededAmount": 50, "Amount": 1}`, true, true},
+		{"Malformed JSON", `{"NeededAmount": }`, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseWitness(&BalanceCircuit{}, []byte(tt.data), tt.publicOnly)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestProveFromParsedWitness(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping proof generation in short mode")
+	}
+
+	ccs, err := Compile(&BalanceCircuit{})
+	if err != nil {
+		t.Fatalf("Failed to compile circuit: %v", err)
+	}
+	pk, vk, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+
+	witness, err := ParseWitness(&BalanceCircuit{}, []byte(`{"Balance": 100, "NeededAmount": 50}`), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := groth16.Prove(ccs, pk, witness)
+	if err != nil {
+		t.Fatalf("Prove failed: %v", err)
+	}
+
+	public, _ := ParseWitness(&BalanceCircuit{}, []byte(`{"NeededAmount": 50}`), true)
+	if err := groth16.Verify(proof, vk, public); err != nil {
+		t.Errorf("Expected proof to verify: %v", err)
+	}
+	other, _ := ParseWitness(&BalanceCircuit{}, []byte(`{"NeededAmount": 60}`), true)
+	if err := groth16.Verify(proof, vk, other); err == nil {
+		t.Error("Expected proof not to verify against different public inputs")
+	}
+}
+
+func TestPublicInputsFollowWitnessOrder(t *testing.T) {
+	tests := []struct {
+		name       string
+		assignment frontend.Circuit
+	}{
+		{"Bucket", &BucketCircuit{Balance: 5, Lower: 1, Upper: 10}},
+		{"Time lock", &TimeLockedBalanceCircuit{Balance: 5, NeededAmount: 2, NotBefore: 1700000000}},
+		{"Predicate", &PredicateCircuit{
+			Values:    [MaxPredicateClauses]frontend.Variable{0, 0, 0, 0},
+			Selectors: [MaxPredicateClauses]frontend.Variable{0, 0, 0, 0},
+			Enabled:   [MaxPredicateClauses]frontend.Variable{1, 1, 0, 0},
+			Attribute: [MaxPredicateClauses]frontend.Variable{0, 1, 0, 0},
+			Threshold: [MaxPredicateClauses]frontend.Variable{100, 650, 7, 8},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inputs, err := PublicInputs(tt.assignment)
+			if err != nil {
+				t.Fatalf("PublicInputs failed: %v", err)
+			}
+			w, err := frontend.NewWitness(tt.assignment, ecc.BN254.ScalarField(), frontend.PublicOnly())
+			if err != nil {
+				t.Fatalf("Failed to build witness: %v", err)
+			}
+			vector := w.Vector().(fr.Vector)
+			if len(vector) != len(inputs) {
+				t.Fatalf("Expected %d inputs, witness has %d", len(inputs), len(vector))
+			}
+
+			// Each described input must hold the value assigned to its field at its position
+			value := reflect.ValueOf(tt.assignment).Elem()
+			for i, in := range inputs {
+				field := value.FieldByName(in.Field)
+				if in.Position != nil {
+					field = field.Index(*in.Position)
+				}
+				var want fr.Element
+				want.SetInterface(field.Interface())
+				if !vector[i].Equal(&want) {
+					t.Errorf("Input %d (%s) holds %s, expected %s", i, in.Name, vector[i].String(), want.String())
+				}
+			}
+		})
+	}
+
+	inputs, _ := PublicInputs(&PredicateCircuit{})
+	if last := inputs[len(inputs)-1]; last.Name != "Threshold_3" || last.Type != "uint" || *last.Position != 3 {
+		t.Errorf("Expected the last predicate input to be Threshold[3], got %+v", last)
+	}
+}
+
+func TestBalancePresetShapes(t *testing.T) {
+	sizes := make(map[string]int)
+	constraints := make(map[string]int)
+	for _, name := range []string{BalanceName, FastName, CompactName} {
+		circuit, _ := New(name)
+		ccs, err := Compile(circuit)
+		if err != nil {
+			t.Fatalf("Failed to compile %s: %v", name, err)
+		}
+		pk, _, err := groth16.Setup(ccs)
+		if err != nil {
+			t.Fatalf("Setup of %s failed: %v", name, err)
+		}
+		w, _ := frontend.NewWitness(circuit.(Sampler).Sample(ecc.BN254), ecc.BN254.ScalarField())
+		proof, err := groth16.Prove(ccs, pk, w)
+		if err != nil {
+			t.Fatalf("Failed to prove %s: %v", name, err)
+		}
+		var buf bytes.Buffer
+		proof.WriteTo(&buf)
+		sizes[name] = buf.Len()
+		constraints[name] = ccs.GetNbConstraints()
+	}
+	if constraints[FastName] >= constraints[BalanceName] {
+		t.Errorf("Expected %s to have fewer constraints than %s, got %v", FastName, BalanceName, constraints)
+	}
+	if sizes[CompactName] >= sizes[BalanceName] {
+		t.Errorf("Expected proofs of %s to be smaller than those of %s, got %v", CompactName, BalanceName, sizes)
+	}
+}
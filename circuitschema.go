@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/korjavin/zkTest1/circuits"
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// publicWitnessEncoding describes how public inputs are serialized, the same for every circuit
+var publicWitnessEncoding = WitnessEncoding{
+	JSON:   "object keyed by field, arrays as JSON arrays, values as decimal numbers or strings",
+	Binary: "gnark witness: uint32 public count, uint32 secret count (0), uint32 element count, then each input in index order as a 32-byte big-endian field element",
+}
+
+// WitnessEncoding describes the JSON and binary forms of a public witness
+type WitnessEncoding struct {
+	JSON   string `json:"json"`
+	Binary string `json:"binary"`
+}
+
+// CircuitSchema describes the public inputs of a circuit so clients can build public witnesses
+type CircuitSchema struct {
+	Circuit      string                 `json:"circuit"`
+	Curve        string                 `json:"curve"`
+	ScalarField  string                 `json:"scalarField"` // modulus of the field inputs are reduced into
+	PublicInputs []circuits.PublicInput `json:"publicInputs"`
+	Encoding     WitnessEncoding        `json:"encoding"`
+	Presets      map[string]string      `json:"presets,omitempty"` // circuit proving each preset of the circuit
+}
+
+// getCircuitSchema returns the ordered public inputs of a registered circuit on the curve
+// named by the curve query parameter, bn254 by default
+func getCircuitSchema(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	circuit, err := circuits.New(name)
+	if err != nil {
+		writeError(w, errs.Wrap(errs.NotFound, err))
+		return
+	}
+	curve, err := verifyCurve(r.URL.Query().Get("curve"), name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	inputs, err := circuits.PublicInputs(circuit)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, CircuitSchema{
+		Circuit:      name,
+		Curve:        curve.String(),
+		ScalarField:  curve.ScalarField().String(),
+		PublicInputs: inputs,
+		Encoding:     publicWitnessEncoding,
+		Presets:      circuitPresets[name],
+	})
+}
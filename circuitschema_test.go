@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/korjavin/zkTest1/circuits"
+)
+
+func TestGetCircuitSchema(t *testing.T) {
+	tests := []struct {
+		circuit string
+		status  int
+		inputs  []string
+	}{
+		{circuits.BalanceName, http.StatusOK, []string{"NeededAmount"}},
+		{circuits.TimeLockName, http.StatusOK, []string{"NeededAmount", "NotBefore"}},
+		{circuits.BucketName, http.StatusOK, []string{"Lower", "Upper"}},
+		{"teleport", http.StatusNotFound, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.circuit, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/circuits/"+tt.circuit+"/schema", nil)
+			req.SetPathValue("name", tt.circuit)
+			rr := httptest.NewRecorder()
+			getCircuitSchema(rr, req)
+
+			if rr.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d", tt.status, rr.Code)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var schema CircuitSchema
+			if err := json.NewDecoder(rr.Body).Decode(&schema); err != nil {
+				t.Fatalf("Failed to decode schema: %v", err)
+			}
+			if schema.Curve != "bn254" || schema.ScalarField == "" {
+				t.Errorf("Expected the BN254 scalar field, got %q %q", schema.Curve, schema.ScalarField)
+			}
+			if len(schema.PublicInputs) != len(tt.inputs) {
+				t.Fatalf("Expected %d public inputs, got %+v", len(tt.inputs), schema.PublicInputs)
+			}
+			for i, name := range tt.inputs {
+				if got := schema.PublicInputs[i]; got.Index != i || got.Name != name {
+					t.Errorf("Expected input %d to be %s, got %+v", i, name, got)
+				}
+			}
+		})
+	}
+}
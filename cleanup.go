@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// CleanupConfig configures the background sweeps that prune expired data
+type CleanupConfig struct {
+	Interval         time.Duration // time between sweeps; 0 disables the scheduler
+	BalanceTTL       time.Duration // balances not updated for this long are soft-deleted; 0 keeps them
+	DeletedRetention time.Duration // soft-deleted balances are restorable for this long
+	ProofRetention   time.Duration // issued proofs older than this are removed; 0 keeps them
+}
+
+// SweepStatus reports the removals made by one cleanup task
+type SweepStatus struct {
+	Name         string     `json:"name"`
+	Runs         int        `json:"runs"`
+	LastRunAt    *time.Time `json:"lastRunAt,omitempty"`
+	LastRemoved  int        `json:"lastRemoved"`
+	TotalRemoved int        `json:"totalRemoved"`
+	LastError    string     `json:"lastError,omitempty"`
+}
+
+type cleanupTask struct {
+	name   string
+	sweep  func(now time.Time) (removed int, err error)
+	status SweepStatus
+}
+
+// cleanupScheduler periodically runs the registered sweeps
+type cleanupScheduler struct {
+	mu    sync.Mutex
+	tasks []*cleanupTask
+}
+
+var cleanup = &cleanupScheduler{}
+
+// register adds a named sweep; registering a name again replaces its sweep
+func (c *cleanupScheduler) register(name string, sweep func(now time.Time) (int, error)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, t := range c.tasks {
+		if t.name == name {
+			t.sweep = sweep
+			return
+		}
+	}
+	c.tasks = append(c.tasks, &cleanupTask{name: name, sweep: sweep, status: SweepStatus{Name: name}})
+}
+
+// run performs one sweep of every task and records how many items each removed
+func (c *cleanupScheduler) run(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, t := range c.tasks {
+		removed, err := t.sweep(now)
+
+		at := now.UTC()
+		t.status.Runs++
+		t.status.LastRunAt = &at
+		t.status.LastRemoved = removed
+		t.status.TotalRemoved += removed
+		t.status.LastError = ""
+		if err != nil {
+			t.status.LastError = err.Error()
+			log.Printf("Cleanup of %s failed: %v", t.name, err)
+		}
+		if removed > 0 {
+			log.Printf("🧹 Cleanup removed %d %s", removed, t.name)
+		}
+	}
+}
+
+// start sweeps every interval until stop is closed
+func (c *cleanupScheduler) start(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				c.run(now)
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+func (c *cleanupScheduler) snapshot() []SweepStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	statuses := make([]SweepStatus, len(c.tasks))
+	for i, t := range c.tasks {
+		statuses[i] = t.status
+	}
+	return statuses
+}
+
+// registerCleanupTasks wires the sweeps enabled by the configuration
+func registerCleanupTasks(cfg CleanupConfig) {
+	if cfg.BalanceTTL > 0 {
+		cleanup.register("balances", func(now time.Time) (int, error) {
+			return pruneBalances(now, cfg.BalanceTTL), nil
+		})
+	}
+	if cfg.DeletedRetention > 0 {
+		cleanup.register("deleted-balances", func(now time.Time) (int, error) {
+			return purgeDeletedBalances(now, cfg.DeletedRetention), nil
+		})
+	}
+	if cfg.ProofRetention > 0 {
+		cleanup.register("proofs", func(now time.Time) (int, error) {
+			// A sweep must not overrun the next one
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.Interval)
+			defer cancel()
+			return pruneProofs(ctx, now, cfg.ProofRetention)
+		})
+	}
+}
+
+// pruneBalances soft-deletes balances that have not been stored again within ttl
+func pruneBalances(now time.Time, ttl time.Duration) int {
+	balancesMu.Lock()
+	defer balancesMu.Unlock()
+
+	removed := 0
+	for id, updated := range balanceUpdated {
+		if now.Sub(updated) > ttl && softDeleteLocked(id, now) {
+			audit.record(AuditEvent{Type: auditBalanceDeleted, Detail: "expired"})
+			removed++
+		}
+	}
+	return removed
+}
+
+// pruneProofs removes indexed proofs older than retention from the index and the artifact store.
+// Revocations are kept so a removed proof presented again is still rejected.
+func pruneProofs(ctx context.Context, now time.Time, retention time.Duration) (int, error) {
+	proofIndexMu.RLock()
+	var expired []string
+	for digest, record := range proofIndex {
+		if now.Sub(record.CreatedAt) > retention {
+			expired = append(expired, digest)
+		}
+	}
+	proofIndexMu.RUnlock()
+
+	removed := 0
+	var errs []error
+	for _, digest := range expired {
+		// Index entries are only dropped once the artifact is gone, so failures are retried
+		if err := artifacts.Delete(ctx, artifactProof, digest); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", digest, err))
+			continue
+		}
+		proofIndexMu.Lock()
+		delete(proofIndex, digest)
+		proofIndexMu.Unlock()
+		removed++
+	}
+	return removed, errors.Join(errs...)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// failingDeleteStore is an artifact store whose deletes always fail
+type failingDeleteStore struct {
+	*memoryArtifactStore
+}
+
+func (failingDeleteStore) Delete(context.Context, string, string) error {
+	return errors.New("bucket is read-only")
+}
+
+func TestPruneBalances(t *testing.T) {
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+	h.StoreBalance("fresh", 10)
+	h.StoreBalance("stale", 20)
+
+	now := time.Now()
+	balancesMu.Lock()
+	balanceUpdated["stale"] = now.Add(-2 * time.Hour)
+	balancesMu.Unlock()
+
+	if removed := pruneBalances(now, time.Hour); removed != 1 {
+		t.Errorf("Expected 1 balance removed, got %d", removed)
+	}
+
+	balancesMu.Lock()
+	_, fresh := balances["fresh"]
+	_, stale := balances["stale"]
+	balancesMu.Unlock()
+	if !fresh || stale {
+		t.Errorf("Expected only the stale balance to be removed, have fresh=%v stale=%v", fresh, stale)
+	}
+
+	if err := restoreBalance("stale"); err != nil {
+		t.Errorf("Expected the expired balance to be restorable, got %v", err)
+	}
+}
+
+func TestPruneProofs(t *testing.T) {
+	previous := artifacts
+	t.Cleanup(func() { artifacts = previous })
+	store := newMemoryArtifactStore()
+	artifacts = store
+
+	now := time.Now()
+	oldDigest, _ := artifacts.Put(context.Background(), artifactProof, []byte("old proof"))
+	newDigest, _ := artifacts.Put(context.Background(), artifactProof, []byte("new proof"))
+
+	proofIndexMu.Lock()
+	proofIndex[oldDigest] = ProofRecord{Digest: oldDigest, CreatedAt: now.Add(-48 * time.Hour)}
+	proofIndex[newDigest] = ProofRecord{Digest: newDigest, CreatedAt: now}
+	proofIndexMu.Unlock()
+	t.Cleanup(func() {
+		proofIndexMu.Lock()
+		delete(proofIndex, oldDigest)
+		delete(proofIndex, newDigest)
+		proofIndexMu.Unlock()
+	})
+
+	// Failed deletes keep the index entry so the next sweep retries
+	artifacts = failingDeleteStore{store}
+	if removed, err := pruneProofs(context.Background(), now, 24*time.Hour); removed != 0 || err == nil {
+		t.Errorf("Expected no removals and an error, got %d, %v", removed, err)
+	}
+	if _, ok := lookupProofRecord(oldDigest); !ok {
+		t.Error("Expected the index entry to be kept after a failed delete")
+	}
+
+	artifacts = store
+	if removed, err := pruneProofs(context.Background(), now, 24*time.Hour); removed != 1 || err != nil {
+		t.Fatalf("Expected 1 proof removed, got %d, %v", removed, err)
+	}
+	if _, ok := lookupProofRecord(oldDigest); ok {
+		t.Error("Expected the old proof to be removed from the index")
+	}
+	if _, err := store.Get(context.Background(), artifactProof, oldDigest); err != errArtifactNotFound {
+		t.Errorf("Expected the old proof artifact to be deleted, got %v", err)
+	}
+	if _, ok := lookupProofRecord(newDigest); !ok {
+		t.Error("Expected the recent proof to be kept")
+	}
+}
+
+func TestCleanupScheduler(t *testing.T) {
+	c := &cleanupScheduler{}
+	calls := 0
+	c.register("nonces", func(time.Time) (int, error) {
+		calls++
+		return 3, nil
+	})
+	c.register("jobs", func(time.Time) (int, error) {
+		return 0, errors.New("store unavailable")
+	})
+
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	c.run(now)
+	c.run(now.Add(time.Minute))
+
+	statuses := c.snapshot()
+	if len(statuses) != 2 {
+		t.Fatalf("Expected 2 tasks, got %d", len(statuses))
+	}
+	nonces, jobs := statuses[0], statuses[1]
+	if nonces.Runs != 2 || nonces.LastRemoved != 3 || nonces.TotalRemoved != 6 || calls != 2 {
+		t.Errorf("Unexpected nonce sweep status: %+v", nonces)
+	}
+	if !nonces.LastRunAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("Expected last run at %v, got %v", now.Add(time.Minute), nonces.LastRunAt)
+	}
+	if !strings.Contains(jobs.LastError, "store unavailable") {
+		t.Errorf("Expected the sweep error to be reported, got %+v", jobs)
+	}
+
+	stop := make(chan struct{})
+	c.start(time.Millisecond, stop)
+	deadline := time.Now().Add(time.Second)
+	for c.snapshot()[0].Runs < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	close(stop)
+	if c.snapshot()[0].Runs < 3 {
+		t.Error("Expected the scheduler to sweep on its interval")
+	}
+}
@@ -0,0 +1,64 @@
+// Command keygen compiles circuits, runs the Groth16 setup and writes the keys
+// to a directory the server can load with ZK_KEY_DIR.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/korjavin/zkTest1/circuits"
+	"github.com/korjavin/zkTest1/keys"
+)
+
+func main() {
+	dir := flag.String("keys", "./keys", "directory to write keys to")
+	names := flag.String("circuit", strings.Join(circuits.Names(), ","), "comma-separated circuits to set up")
+	force := flag.Bool("force", false, "replace keys that already exist")
+	flag.Parse()
+	log.SetFlags(0)
+
+	// Proving keys are encrypted when ZK_KEY_PASSPHRASE is set, matching ZK_KEY_ENCRYPTION on the server
+	store, err := keys.Open(*dir, os.Getenv("ZK_KEY_PASSPHRASE"))
+	if err != nil {
+		log.Fatalf("Failed to open key directory: %v", err)
+	}
+	// Checksums are signed when ZK_KEY_SIGNING_KEY is set, matching ZK_KEY_SIGNING on the server
+	store.SignWith(os.Getenv("ZK_KEY_SIGNING_KEY"))
+
+	for _, name := range strings.Split(*names, ",") {
+		name = strings.TrimSpace(name)
+		circuit, err := circuits.New(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		ccs, err := circuits.Compile(circuit)
+		if err != nil {
+			log.Fatalf("%s: compile: %v", name, err)
+		}
+
+		if !*force {
+			if _, vk, found, err := store.Load(name); err != nil || found {
+				if err == nil {
+					err = store.Verify(name, ccs, vk)
+				}
+				if err != nil {
+					log.Fatalf("%s: %v (use -force to replace)", name, err)
+				}
+				log.Printf("%s: keys exist, skipping (use -force to replace)", name)
+				continue
+			}
+		}
+		pk, vk, err := groth16.Setup(ccs)
+		if err != nil {
+			log.Fatalf("%s: setup: %v", name, err)
+		}
+		if err := store.Save(name, ccs, pk, vk); err != nil {
+			log.Fatalf("%s: writing keys: %v", name, err)
+		}
+		log.Printf("%s: wrote keys for %d constraints", name, ccs.GetNbConstraints())
+	}
+}
@@ -0,0 +1,77 @@
+// Command prove generates a proof locally from a JSON witness file, using keys
+// written by keygen or the server, without running the HTTP server.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/korjavin/zkTest1/circuits"
+	"github.com/korjavin/zkTest1/keys"
+)
+
+func main() {
+	dir := flag.String("keys", "./keys", "directory holding the circuit keys")
+	name := flag.String("circuit", circuits.BalanceName, "circuit to prove")
+	witnessPath := flag.String("witness", "", "JSON witness file with public and private inputs, e.g. {\"Balance\": 100, \"NeededAmount\": 50}")
+	out := flag.String("out", "", "file to write the JSON proof to (default stdout)")
+	flag.Parse()
+	log.SetFlags(0)
+
+	if *witnessPath == "" {
+		log.Fatal("-witness is required")
+	}
+
+	circuit, err := circuits.New(*name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	data, err := os.ReadFile(*witnessPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	witness, err := circuits.ParseWitness(circuit, data, false)
+	if err != nil {
+		log.Fatalf("Invalid witness: %v", err)
+	}
+
+	store, err := keys.Open(*dir, os.Getenv("ZK_KEY_PASSPHRASE"))
+	if err != nil {
+		log.Fatalf("Failed to open key directory: %v", err)
+	}
+	store.SignWith(os.Getenv("ZK_KEY_SIGNING_KEY"))
+	pk, vk, found, err := store.Load(*name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !found {
+		log.Fatalf("No keys for %s in %s, run keygen first", *name, *dir)
+	}
+
+	ccs, err := circuits.Compile(circuit)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := store.Verify(*name, ccs, vk); err != nil {
+		log.Fatalf("%v, run keygen -force to replace the keys", err)
+	}
+	proof, err := groth16.Prove(ccs, pk, witness)
+	if err != nil {
+		log.Fatalf("Failed to generate proof: %v", err)
+	}
+
+	proofJSON, err := json.Marshal(proof)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *out == "" {
+		os.Stdout.Write(append(proofJSON, '\n'))
+		return
+	}
+	if err := os.WriteFile(*out, proofJSON, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
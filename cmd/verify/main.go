@@ -0,0 +1,108 @@
+// Command verify checks a JSON proof against its public inputs and a verifying key,
+// without running the HTTP server. It exits with status 1 when the proof is invalid.
+// The public inputs are read from a JSON file or taken as the base64 public witness
+// the server returns in X-Public-Witness.
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/frontend"
+	"github.com/korjavin/zkTest1/circuits"
+	"github.com/korjavin/zkTest1/keys"
+)
+
+func main() {
+	dir := flag.String("keys", "./keys", "directory holding the circuit keys")
+	name := flag.String("circuit", circuits.BalanceName, "circuit the proof was made for")
+	proofPath := flag.String("proof", "", "JSON proof file, as written by prove or returned by the server")
+	publicPath := flag.String("public", "", "JSON file with the public inputs, e.g. {\"NeededAmount\": 50}")
+	publicWitness := flag.String("public-witness", "", "base64 gnark public witness, as returned in X-Public-Witness")
+	flag.Parse()
+	log.SetFlags(0)
+
+	if *proofPath == "" || (*publicPath == "") == (*publicWitness == "") {
+		log.Fatal("-proof and one of -public or -public-witness are required")
+	}
+
+	circuit, err := circuits.New(*name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	public, err := readPublicWitness(circuit, *publicPath, *publicWitness)
+	if err != nil {
+		log.Fatalf("Invalid public inputs: %v", err)
+	}
+
+	data, err := os.ReadFile(*proofPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	proof := groth16.NewProof(ecc.BN254)
+	if err := json.Unmarshal(data, proof); err != nil {
+		log.Fatalf("Invalid proof format: %v", err)
+	}
+
+	// The verifying key is never encrypted, so no passphrase is needed
+	store, err := keys.Open(*dir, "")
+	if err != nil {
+		log.Fatalf("Failed to open key directory: %v", err)
+	}
+	store.SignWith(os.Getenv("ZK_KEY_SIGNING_KEY"))
+	vk, err := store.LoadVerifyingKey(*name)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := groth16.Verify(proof, vk, public); err != nil {
+		log.Fatalf("Proof is invalid: %v", err)
+	}
+	log.Printf("Proof is valid for %s", describeInputs(circuit, public))
+}
+
+// readPublicWitness reads the public inputs from a JSON file, or decodes an encoded public witness
+func readPublicWitness(circuit frontend.Circuit, path, encoded string) (witness.Witness, error) {
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return circuits.ParseWitness(circuit, data, true)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	w, err := witness.New(ecc.BN254.ScalarField())
+	if err != nil {
+		return nil, err
+	}
+	if err := w.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// describeInputs lists the proven public inputs by name, since an encoded witness does not show them
+func describeInputs(circuit frontend.Circuit, public witness.Witness) string {
+	inputs, err := circuits.PublicInputs(circuit)
+	vector, ok := public.Vector().(fr.Vector)
+	if err != nil || !ok || len(vector) != len(inputs) {
+		return "its public inputs"
+	}
+	parts := make([]string, len(inputs))
+	for i, in := range inputs {
+		parts[i] = in.Name + "=" + vector[i].String()
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,93 @@
+//go:build js && wasm
+
+// Command wasm-prover is the circuit prover compiled to WebAssembly for client-side proving
+// in the browser. Build it with make wasm; it registers a global zkProve function:
+//
+//	zkProve(circuit, provingKey, witnessJSON) -> Promise<{proof, publicWitness}>
+//
+// provingKey is the Uint8Array served by GET /wasm/keys/{circuit}, witnessJSON is keyed by
+// the circuit's field names as for cmd/prove, proof is the JSON proof and publicWitness the
+// base64 binary public witness /validate accepts.
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"syscall/js"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/korjavin/zkTest1/circuits"
+)
+
+func main() {
+	js.Global().Set("zkProve", js.FuncOf(prove))
+	select {} // keep the exported function alive
+}
+
+// prove runs a proof off the JavaScript event loop and settles a promise with the result
+func prove(this js.Value, args []js.Value) any {
+	if len(args) != 3 {
+		return rejected(fmt.Errorf("zkProve takes the circuit, proving key and witness JSON"))
+	}
+	name, witnessJSON := args[0].String(), args[2].String()
+	pkData := make([]byte, args[1].Get("length").Int())
+	js.CopyBytesToGo(pkData, args[1])
+
+	return js.Global().Get("Promise").New(js.FuncOf(func(_ js.Value, settle []js.Value) any {
+		resolve, reject := settle[0], settle[1]
+		go func() {
+			proof, publicWitness, err := proveCircuit(name, pkData, []byte(witnessJSON))
+			if err != nil {
+				reject.Invoke(js.Global().Get("Error").New(err.Error()))
+				return
+			}
+			resolve.Invoke(map[string]any{"proof": proof, "publicWitness": publicWitness})
+		}()
+		return nil
+	}))
+}
+
+func proveCircuit(name string, pkData, witnessJSON []byte) (proofJSON, publicWitness string, err error) {
+	circuit, err := circuits.New(name)
+	if err != nil {
+		return "", "", err
+	}
+	witness, err := circuits.ParseWitness(circuit, witnessJSON, false)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid witness: %w", err)
+	}
+	ccs, err := circuits.Compile(circuit)
+	if err != nil {
+		return "", "", err
+	}
+
+	pk := groth16.NewProvingKey(ecc.BN254)
+	if _, err := pk.ReadFrom(bytes.NewReader(pkData)); err != nil {
+		return "", "", fmt.Errorf("reading proving key: %w", err)
+	}
+	proof, err := groth16.Prove(ccs, pk, witness)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate proof: %w", err)
+	}
+
+	data, err := json.Marshal(proof)
+	if err != nil {
+		return "", "", err
+	}
+	public, err := witness.Public()
+	if err != nil {
+		return "", "", err
+	}
+	publicData, err := public.MarshalBinary()
+	if err != nil {
+		return "", "", err
+	}
+	return string(data), base64.StdEncoding.EncodeToString(publicData), nil
+}
+
+func rejected(err error) any {
+	return js.Global().Get("Promise").Call("reject", js.Global().Get("Error").New(err.Error()))
+}
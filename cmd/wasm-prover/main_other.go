@@ -0,0 +1,13 @@
+//go:build !(js && wasm)
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	fmt.Fprintln(os.Stderr, "wasm-prover runs in the browser; build it with make wasm (GOOS=js GOARCH=wasm)")
+	os.Exit(1)
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/consensys/gnark"
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	groth16bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	"github.com/consensys/gnark/constraint"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/korjavin/zkTest1/circuits"
+	"github.com/korjavin/zkTest1/keys"
+)
+
+// errResetup marks keys that cannot be carried over and need a new trusted setup
+var errResetup = errors.New("new setup required")
+
+// keysMigrate reads the keys of each circuit with this gnark release and writes them back
+// in its format, reporting the circuits whose keys cannot be carried over
+func keysMigrate(args []string) {
+	fs := flag.NewFlagSet("keys migrate", flag.ExitOnError)
+	dir := fs.String("keys", "./keys", "key directory to migrate")
+	names := fs.String("circuit", strings.Join(circuits.Names(), ","), "comma-separated circuits to migrate")
+	dryRun := fs.Bool("dry-run", false, "report what would be rewritten without writing")
+	fs.Parse(args)
+
+	// Proving keys are encrypted when ZK_KEY_PASSPHRASE is set, matching ZK_KEY_ENCRYPTION on the server
+	store, err := keys.Open(*dir, os.Getenv("ZK_KEY_PASSPHRASE"))
+	if err != nil {
+		log.Fatalf("Failed to open key directory: %v", err)
+	}
+	// Checksums are signed when ZK_KEY_SIGNING_KEY is set, matching ZK_KEY_SIGNING on the server
+	store.SignWith(os.Getenv("ZK_KEY_SIGNING_KEY"))
+
+	var resetup, failed []string
+	for _, name := range strings.Split(*names, ",") {
+		name = strings.TrimSpace(name)
+		msg, err := migrateKeys(store, name, *dryRun)
+		switch {
+		case errors.Is(err, errResetup):
+			resetup = append(resetup, name)
+		case err != nil:
+			failed = append(failed, name)
+		}
+		if err != nil {
+			msg = err.Error()
+		}
+		log.Printf("%s: %s", name, msg)
+	}
+
+	if len(resetup) > 0 {
+		log.Printf("Run keygen -force -circuit %s, then reissue proofs made with the old keys", strings.Join(resetup, ","))
+	}
+	if len(resetup)+len(failed) > 0 {
+		os.Exit(1)
+	}
+}
+
+// migrateKeys migrates the keys of one circuit and describes what it did
+func migrateKeys(store *keys.Store, name string, dryRun bool) (string, error) {
+	circuit, err := circuits.New(name)
+	if err != nil {
+		return "", err
+	}
+	ccs, err := circuits.Compile(circuit)
+	if err != nil {
+		return "", fmt.Errorf("compile: %w", err)
+	}
+
+	from, err := store.GnarkVersion(name)
+	if err != nil {
+		return "", err
+	}
+	pk, vk, found, err := store.Load(name)
+	if errors.Is(err, keys.ErrDecrypt) {
+		return "", err
+	}
+	if err != nil {
+		return "", fmt.Errorf("%w: gnark %s cannot read the keys: %v", errResetup, gnark.Version, err)
+	}
+	if !found {
+		return "no keys, skipping", nil
+	}
+
+	if err := store.Verify(name, ccs, vk); err != nil {
+		return "", fmt.Errorf("%w: %v", errResetup, err)
+	}
+	// Rewriting stamps the circuit's fingerprint, so keys without one must at least have its shape
+	if fp, _ := store.StoredFingerprint(name); fp == "" && !sameShape(ccs, pk) {
+		return "", fmt.Errorf("%w: proving key does not have the dimensions of the circuit", errResetup)
+	}
+
+	if from == gnark.Version.String() {
+		return "already in the gnark " + from + " format", nil
+	}
+	if from == "" {
+		from = "an unrecorded release"
+	}
+	if dryRun {
+		return fmt.Sprintf("would rewrite keys from %s in the gnark %s format", from, gnark.Version), nil
+	}
+	// Keys still in the grace window of a rotation are rewritten with the current ones
+	retired, err := store.LoadRetired(name)
+	if err != nil {
+		return "", fmt.Errorf("%w: gnark %s cannot read the retired keys: %v", errResetup, gnark.Version, err)
+	}
+	if err := store.SaveRotation(name, ccs, pk, vk, retired); err != nil {
+		return "", fmt.Errorf("writing keys: %w", err)
+	}
+	return fmt.Sprintf("rewrote keys from %s in the gnark %s format", from, gnark.Version), nil
+}
+
+// sameShape reports whether a proving key has the wire count and FFT domain of ccs
+func sameShape(ccs constraint.ConstraintSystem, pk groth16.ProvingKey) bool {
+	bpk, ok := pk.(*groth16bn254.ProvingKey)
+	if !ok {
+		return false
+	}
+	nbWires := ccs.GetNbInternalVariables() + ccs.GetNbSecretVariables() + ccs.GetNbPublicVariables()
+	return len(bpk.InfinityA) == nbWires && bpk.Domain.Cardinality == ecc.NextPowerOfTwo(uint64(ccs.GetNbConstraints()))
+}
+
+// inspectCurves are the curves keys inspect looks for keys on besides BN254
+var inspectCurves = []ecc.ID{ecc.BLS12_381}
+
+// keysInspect prints what is persisted for the keys of each circuit, so key directories of
+// different environments can be compared. It exits with status 1 when keys cannot be read or
+// were set up for a different version of their circuit.
+func keysInspect(args []string) {
+	fs := flag.NewFlagSet("keys inspect", flag.ExitOnError)
+	dir := fs.String("keys", "./keys", "key directory to inspect")
+	names := fs.String("circuit", strings.Join(circuits.Names(), ","), "comma-separated circuits to inspect; name@curve selects keys on one curve")
+	fs.Parse(args)
+
+	store, err := keys.Open(*dir, os.Getenv("ZK_KEY_PASSPHRASE"))
+	if err != nil {
+		log.Fatalf("Failed to open key directory: %v", err)
+	}
+	store.SignWith(os.Getenv("ZK_KEY_SIGNING_KEY"))
+
+	mismatched := false
+	for _, name := range strings.Split(*names, ",") {
+		name = strings.TrimSpace(name)
+		keyNames := []string{name}
+		if !strings.Contains(name, "@") {
+			for _, curve := range inspectCurves {
+				// Keys on other curves are only listed when they exist
+				if _, err := store.SavedAt(keys.CurveName(name, curve)); err == nil {
+					keyNames = append(keyNames, keys.CurveName(name, curve))
+				}
+			}
+		}
+		for _, keyName := range keyNames {
+			if err := inspectKeys(os.Stdout, store, keyName); err != nil {
+				fmt.Printf("  error        %v\n", err)
+				mismatched = true
+			}
+			fmt.Println()
+		}
+	}
+	if mismatched {
+		os.Exit(1)
+	}
+}
+
+// inspectKeys prints the details of the keys kept under name: the curve and scheme, the gnark
+// release that wrote them, when, the key ID the server reports, their sizes and the fingerprint
+// of the circuit they were set up for next to that of the circuit compiled by this build
+func inspectKeys(w io.Writer, store *keys.Store, name string) error {
+	fmt.Fprintln(w, name)
+	curve, err := keys.CurveOf(name)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "  curve        %s\n", curve)
+	fmt.Fprintf(w, "  scheme       groth16\n")
+
+	saved, err := store.SavedAt(name)
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintf(w, "  keys         none\n")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	version, err := store.GnarkVersion(name)
+	if err != nil {
+		return err
+	}
+	if version == "" {
+		version = "unrecorded"
+	}
+	fmt.Fprintf(w, "  gnark        %s (this build: %s)\n", version, gnark.Version)
+	fmt.Fprintf(w, "  saved        %s\n", saved.UTC().Format(time.RFC3339))
+
+	if pkPath, encrypted, err := store.ProvingKeyFile(name); err != nil {
+		fmt.Fprintf(w, "  proving key  missing\n")
+	} else if info, err := os.Stat(pkPath); err == nil {
+		state := "plaintext"
+		if encrypted {
+			state = "encrypted"
+		}
+		fmt.Fprintf(w, "  proving key  %d bytes, %s\n", info.Size(), state)
+	}
+
+	vk, err := store.LoadVerifyingKey(name)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if _, err := vk.WriteTo(&buf); err != nil {
+		return err
+	}
+	digest := sha256.Sum256(buf.Bytes())
+	fmt.Fprintf(w, "  verifying    %d bytes, %d public witness values\n", buf.Len(), vk.NbPublicWitness())
+	fmt.Fprintf(w, "  key ID       %s\n", hex.EncodeToString(digest[:8]))
+	fmt.Fprintf(w, "  key digest   %s\n", hex.EncodeToString(digest[:]))
+
+	stored, err := store.StoredFingerprint(name)
+	if err != nil {
+		return err
+	}
+	if stored == "" {
+		stored = "unrecorded"
+	}
+	fmt.Fprintf(w, "  fingerprint  %s\n", stored)
+
+	base, _, _ := strings.Cut(name, "@")
+	circuit, err := circuits.New(base)
+	if err != nil {
+		return err
+	}
+	ccs, err := frontend.Compile(curve.ScalarField(), r1cs.NewBuilder, circuit)
+	if err != nil {
+		return fmt.Errorf("compile: %w", err)
+	}
+	fp, err := keys.Fingerprint(ccs)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "  circuit      %s, %d constraints, %d public, %d secret, %d internal variables\n",
+		fp, ccs.GetNbConstraints(), ccs.GetNbPublicVariables()-1, ccs.GetNbSecretVariables(), ccs.GetNbInternalVariables())
+	return store.Verify(name, ccs, vk)
+}
@@ -0,0 +1,40 @@
+// Command zkctl administers the files of a zkTest1 deployment offline and replays captured traffic.
+//
+//	zkctl keys migrate [-keys dir] [-circuit names] [-dry-run]
+//	zkctl keys inspect [-keys dir] [-circuit names]
+//	zkctl replay -capture file [-target url] [-token token] [-retries n] [-breaker n]
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+)
+
+const usage = `usage: zkctl <command> [flags]
+
+commands:
+  keys migrate   rewrite persisted keys in the format of this gnark release
+  keys inspect   print the curve, gnark release, sizes and fingerprints of persisted keys
+  replay         send captured verification requests to an instance and compare the outcomes`
+
+func main() {
+	log.SetFlags(0)
+
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch {
+	case os.Args[1] == "replay":
+		replay(os.Args[2:])
+	case len(os.Args) > 2 && os.Args[1]+" "+os.Args[2] == "keys migrate":
+		keysMigrate(os.Args[3:])
+	case len(os.Args) > 2 && os.Args[1]+" "+os.Args[2] == "keys inspect":
+		keysInspect(os.Args[3:])
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
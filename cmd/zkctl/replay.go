@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/korjavin/zkTest1/internal/capture"
+	"github.com/korjavin/zkTest1/sdk"
+)
+
+// replay sends every request of a capture written with ZK_CAPTURE_FILE to another instance
+// and reports the requests whose status, error code or validity changed
+func replay(args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	file := fs.String("capture", "", "capture file written by the server with ZK_CAPTURE_FILE")
+	target := fs.String("target", "http://localhost:8080", "base URL of the instance to replay against")
+	token := fs.String("token", os.Getenv("ZK_REPLAY_TOKEN"), "bearer token sent with every request, for instances that require one")
+	timeout := fs.Duration("timeout", 30*time.Second, "time allowed for each request")
+	retries := fs.Int("retries", 0, "times a request answered 429, 502, 503 or 504 or failing on the network is repeated")
+	breaker := fs.Int("breaker", 0, "failures in a row after which no requests are sent for 30s, 0 to keep sending")
+	verbose := fs.Bool("v", false, "also report requests with the same outcome")
+	fs.Parse(args)
+	if *file == "" {
+		log.Fatal("replay: -capture is required")
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		log.Fatalf("Failed to open capture: %v", err)
+	}
+	defer f.Close()
+
+	transport := &sdk.Transport{Retry: sdk.DefaultRetryPolicy}
+	transport.Retry.MaxAttempts = *retries + 1
+	transport.Retry.AttemptTimeout = *timeout
+	if *breaker > 0 {
+		transport.Breaker = sdk.NewCircuitBreaker(*breaker, 30*time.Second)
+	}
+	client := &http.Client{Transport: transport}
+	base := strings.TrimSuffix(*target, "/")
+	var total, changed, failed int
+	err = capture.Read(f, func(rec capture.Record) error {
+		total++
+		name := rec.Method + " " + rec.Path
+		if rec.RequestID != "" {
+			name += " (" + rec.RequestID + ")"
+		}
+		got, err := send(client, base, *token, fmt.Sprintf("replay-%d-%s", total, rec.RequestID), rec)
+		switch {
+		case err != nil:
+			failed++
+			log.Printf("%s: %v", name, err)
+		case !got.Equal(rec.Outcome):
+			changed++
+			log.Printf("%s: was %s, now %s", name, rec.Outcome, got)
+		case *verbose:
+			log.Printf("%s: %s", name, got)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Failed to read capture: %v", err)
+	}
+
+	log.Printf("Replayed %d requests against %s: %d changed, %d failed", total, base, changed, failed)
+	if changed+failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// send repeats one captured request and returns the outcome of the answer. Validations issue
+// nothing, so a repeat only adds another audit event and verification count; the request carries
+// idempotencyKey so that the transport retries it.
+func send(client *http.Client, base, token, idempotencyKey string, rec capture.Record) (capture.Outcome, error) {
+	url := base + rec.Path
+	if rec.Query != "" {
+		url += "?" + rec.Query
+	}
+	req, err := http.NewRequest(rec.Method, url, bytes.NewReader(rec.Body))
+	if err != nil {
+		return capture.Outcome{}, err
+	}
+	if rec.ContentType != "" {
+		req.Header.Set("Content-Type", rec.ContentType)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("Idempotency-Key", idempotencyKey)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return capture.Outcome{}, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return capture.Outcome{}, fmt.Errorf("reading response: %w", err)
+	}
+	return capture.OutcomeOf(resp.StatusCode, body), nil
+}
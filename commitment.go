@@ -0,0 +1,226 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr/mimc"
+	"github.com/korjavin/zkTest1/circuits"
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// Identity of the committed-threshold circuit
+const (
+	committedCircuitName    = circuits.CommittedName
+	committedCircuitVersion = 2
+)
+
+var errInvalidCommitment = errs.New(errs.Invalid, "invalid_commitment", "commitment must be a decimal field element")
+
+// commitThreshold computes MiMC(threshold, salt) over the BN254 scalar field
+func commitThreshold(threshold int, salt *big.Int) *big.Int {
+	var t, s fr.Element
+	t.SetInt64(int64(threshold))
+	s.SetBigInt(salt)
+
+	h := mimc.NewMiMC()
+	tb, sb := t.Bytes(), s.Bytes()
+	h.Write(tb[:])
+	h.Write(sb[:])
+
+	return new(big.Int).SetBytes(h.Sum(nil))
+}
+
+// parseFieldElement parses a decimal string that must be a canonical BN254 scalar
+func parseFieldElement(s string) (*big.Int, error) {
+	v, ok := new(big.Int).SetString(s, 10)
+	if !ok || v.Sign() < 0 || v.Cmp(ecc.BN254.ScalarField()) >= 0 {
+		return nil, errInvalidCommitment
+	}
+	return v, nil
+}
+
+type CommitThresholdRequest struct {
+	Threshold int `json:"threshold"`
+}
+
+type CommitThresholdResponse struct {
+	Commitment string `json:"commitment"`
+	Salt       string `json:"salt"`
+}
+
+type CommittedProofRequest struct {
+	ID         string `json:"id"`
+	Commitment string `json:"commitment"`
+	Threshold  int    `json:"threshold"`
+	Salt       string `json:"salt"`
+}
+
+type CommittedValidateRequest struct {
+	Commitment string          `json:"commitment"`
+	Proof      json.RawMessage `json:"proof"`
+}
+
+// commitToThreshold is a convenience for relying parties that cannot compute MiMC locally:
+// it draws a random salt and returns the commitment to hand to the prover.
+func commitToThreshold(w http.ResponseWriter, r *http.Request) {
+	var req CommitThresholdRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	if req.Threshold < 0 {
+		writeError(w, errs.Errorf(errs.Invalid, "threshold must not be negative"))
+		return
+	}
+	if err := checkTenantAccess(r, committedCircuitName, int64(req.Threshold)); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	salt, err := rand.Int(rand.Reader, ecc.BN254.ScalarField())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, CommitThresholdResponse{
+		Commitment: commitThreshold(req.Threshold, salt).String(),
+		Salt:       salt.String(),
+	})
+}
+
+// generateCommittedProof proves the stored balance covers a committed threshold.
+// The threshold and salt are private inputs and are never logged or echoed back.
+func generateCommittedProof(w http.ResponseWriter, r *http.Request) {
+	var req CommittedProofRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := checkSessionUser(r, req.ID); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	commitment, err := parseFieldElement(req.Commitment)
+	if err != nil {
+		writeError(w, errs.Wrap(errs.Invalid, err))
+		return
+	}
+	salt, err := parseFieldElement(req.Salt)
+	if err != nil {
+		writeError(w, errs.Errorf(errs.Invalid, "salt must be a decimal field element"))
+		return
+	}
+	if req.Threshold < 0 || commitThreshold(req.Threshold, salt).Cmp(commitment) != 0 {
+		writeError(w, errs.Errorf(errs.Invalid, "threshold and salt do not open the commitment"))
+		return
+	}
+	if err := checkTenantAccess(r, committedCircuitName, int64(req.Threshold)); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := checkUserIssuance(req.ID); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	balance, ledgerTx, exists := lookupBalance(req.ID)
+
+	if !exists {
+		writeError(w, errBalanceNotFound)
+		return
+	}
+	if err := checkBalanceAttestation(req.ID, time.Now()); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	setup, err := loadSetup(committedCircuitName, &circuits.CommittedBalanceCircuit{})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	assignment := &circuits.CommittedBalanceCircuit{
+		Balance:    balance,
+		Threshold:  req.Threshold,
+		Salt:       salt,
+		Commitment: commitment,
+	}
+	proof, err := setup.prove(r.Context(), assignment)
+	if err != nil {
+		if !isContextError(err) && !errors.Is(err, errProvingUnavailable) {
+			// Solver errors include witness values, so they must not reach the client or the logs
+			err = errs.Errorf(errs.Unprocessable, "balance does not satisfy the committed threshold")
+		}
+		writeError(w, err)
+		return
+	}
+
+	digest, err := persistProof(r.Context(), proof, ProofRecord{
+		Circuit:        committedCircuitName,
+		CircuitVersion: committedCircuitVersion,
+		LedgerTx:       ledgerTx,
+		PublicInputs:   map[string]string{"commitment": commitment.String()},
+		Holder:         req.ID,
+	})
+	if err != nil {
+		log.Printf("Failed to persist proof: %v", err)
+	}
+	if digest != "" {
+		w.Header().Set("X-Proof-Digest", digest)
+	}
+	setProofHeaders(w, defaultCurve, assignment)
+	signIssuedProof(w, defaultCurve, committedCircuitName, map[string]string{"commitment": commitment.String()}, proof, assignment)
+
+	writeProof(w, r, proof, nil)
+}
+
+// validateCommittedProof verifies a committed-threshold proof against the public commitment
+func validateCommittedProof(w http.ResponseWriter, r *http.Request) {
+	var req CommittedValidateRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := checkTenantAccess(r, committedCircuitName); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	commitment, err := parseFieldElement(req.Commitment)
+	if err != nil {
+		writeError(w, errs.Wrap(errs.Invalid, err))
+		return
+	}
+
+	proof, err := decodeProofJSON(defaultCurve, req.Proof)
+	if err != nil {
+		writeError(w, fmt.Errorf("%w: %v", errMalformedProof, err))
+		return
+	}
+
+	setup, err := loadSetup(committedCircuitName, &circuits.CommittedBalanceCircuit{})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	err = setup.verify(r.Context(), proof, &circuits.CommittedBalanceCircuit{Commitment: commitment})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func postJSON(t *testing.T, handler http.HandlerFunc, path string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("Failed to marshal request: %v", err)
+	}
+	req := httptest.NewRequest("POST", path, bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	return rr
+}
+
+func TestCommitThreshold(t *testing.T) {
+	salt := big.NewInt(42)
+
+	if commitThreshold(100, salt).Cmp(commitThreshold(100, salt)) != 0 {
+		t.Error("Expected commitment to be deterministic")
+	}
+	if commitThreshold(100, salt).Cmp(commitThreshold(101, salt)) == 0 {
+		t.Error("Expected different thresholds to commit differently")
+	}
+	if commitThreshold(100, salt).Cmp(commitThreshold(100, big.NewInt(43))) == 0 {
+		t.Error("Expected different salts to commit differently")
+	}
+
+	rr := postJSON(t, commitToThreshold, "/threshold/commit", CommitThresholdRequest{Threshold: 100})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rr.Code)
+	}
+
+	var resp CommitThresholdResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	s, err := parseFieldElement(resp.Salt)
+	if err != nil {
+		t.Fatalf("Invalid salt: %v", err)
+	}
+	if commitThreshold(100, s).String() != resp.Commitment {
+		t.Error("Expected returned commitment to open with returned salt")
+	}
+}
+
+func TestCommittedProofRejectsBadOpening(t *testing.T) {
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+	h.StoreBalance("committed_user", 150)
+
+	salt := big.NewInt(7)
+	commitment := commitThreshold(100, salt).String()
+
+	tests := []struct {
+		name           string
+		request        CommittedProofRequest
+		expectedStatus int
+	}{
+		{"Wrong threshold", CommittedProofRequest{ID: "committed_user", Commitment: commitment, Threshold: 99, Salt: "7"}, http.StatusBadRequest},
+		{"Wrong salt", CommittedProofRequest{ID: "committed_user", Commitment: commitment, Threshold: 100, Salt: "8"}, http.StatusBadRequest},
+		{"Malformed commitment", CommittedProofRequest{ID: "committed_user", Commitment: "0x12", Threshold: 100, Salt: "7"}, http.StatusBadRequest},
+		{"Unknown user", CommittedProofRequest{ID: "nobody", Commitment: commitment, Threshold: 100, Salt: "7"}, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := postJSON(t, generateCommittedProof, "/get/proof/committed", tt.request)
+			h.AssertStatusCode(rr, tt.expectedStatus, tt.name)
+		})
+	}
+}
+
+func TestCommittedProofWorkflow(t *testing.T) {
+	SkipIfShort(t, "committed threshold proof")
+
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+	h.StoreBalance("committed_user", 150)
+
+	salt := big.NewInt(123456789)
+	commitment := commitThreshold(100, salt).String()
+
+	rr := postJSON(t, generateCommittedProof, "/get/proof/committed", CommittedProofRequest{
+		ID: "committed_user", Commitment: commitment, Threshold: 100, Salt: salt.String(),
+	})
+	h.AssertStatusCode(rr, http.StatusOK, "generating committed proof")
+
+	if strings.Contains(rr.Body.String(), `"100"`) {
+		t.Error("Expected the threshold not to appear in the response")
+	}
+
+	t.Run("Valid against the commitment", func(t *testing.T) {
+		resp := postJSON(t, validateCommittedProof, "/validate/committed", CommittedValidateRequest{
+			Commitment: commitment, Proof: rr.Body.Bytes(),
+		})
+		h.AssertStatusCode(resp, http.StatusOK, "validating committed proof")
+	})
+
+	t.Run("Invalid against another commitment", func(t *testing.T) {
+		resp := postJSON(t, validateCommittedProof, "/validate/committed", CommittedValidateRequest{
+			Commitment: commitThreshold(100, big.NewInt(1)).String(), Proof: rr.Body.Bytes(),
+		})
+		h.AssertStatusCode(resp, http.StatusUnauthorized, "validating against wrong commitment")
+	})
+
+	t.Run("Insufficient balance", func(t *testing.T) {
+		resp := postJSON(t, generateCommittedProof, "/get/proof/committed", CommittedProofRequest{
+			ID: "committed_user", Commitment: commitThreshold(200, salt).String(), Threshold: 200, Salt: salt.String(),
+		})
+		h.AssertStatusCode(resp, http.StatusUnprocessableEntity, "proving above balance")
+		if strings.Contains(resp.Body.String(), "150") {
+			t.Error("Expected the error not to leak the balance")
+		}
+	})
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/constraint"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/test/unsafekzg"
+	"github.com/korjavin/zkTest1/circuits"
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// Proving schemes compared by POST /admin/compare
+const (
+	schemeGroth16 = "groth16"
+	schemePlonk   = "plonk"
+)
+
+// defaultCompareWitness is used when a comparison of the balance circuit omits the witness
+var defaultCompareWitness = json.RawMessage(`{"Balance": 150, "NeededAmount": 100}`)
+
+type CompareRequest struct {
+	Circuit string          `json:"circuit"`
+	Witness json.RawMessage `json:"witness"` // keyed by circuit field names, e.g. {"Balance": 150, "NeededAmount": 100}
+}
+
+// SchemeMetrics are the costs of proving one witness under one scheme
+type SchemeMetrics struct {
+	Scheme            string  `json:"scheme"`
+	Constraints       int     `json:"constraints"`
+	SetupMs           float64 `json:"setupMs"`
+	ProvingMs         float64 `json:"provingMs"`
+	VerifyingMs       float64 `json:"verifyingMs"`
+	ProofBytes        int     `json:"proofBytes"`
+	VerifyingKeyBytes int     `json:"verifyingKeyBytes"`
+}
+
+// CompareResponse is returned by POST /admin/compare
+type CompareResponse struct {
+	Circuit string          `json:"circuit"`
+	Schemes []SchemeMetrics `json:"schemes"`
+}
+
+// schemeRun compiles, sets up, proves and verifies a circuit under one scheme
+type schemeRun struct {
+	name    string
+	compile func(frontend.Circuit) (constraint.ConstraintSystem, error)
+	run     func(ccs constraint.ConstraintSystem, full, public witness.Witness, m *SchemeMetrics) error
+}
+
+var schemeRuns = []schemeRun{
+	{name: schemeGroth16, compile: circuits.Compile, run: runGroth16},
+	{name: schemePlonk, compile: circuits.CompileSparse, run: runPlonk},
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// encodedSize returns the length of the binary encoding of a gnark object
+func encodedSize(v io.WriterTo) (int, error) {
+	var buf bytes.Buffer
+	if _, err := v.WriteTo(&buf); err != nil {
+		return 0, err
+	}
+	return buf.Len(), nil
+}
+
+func runGroth16(ccs constraint.ConstraintSystem, full, public witness.Witness, m *SchemeMetrics) error {
+	start := time.Now()
+	pk, vk, err := groth16.Setup(ccs)
+	if err != nil {
+		return err
+	}
+	m.SetupMs = milliseconds(time.Since(start))
+
+	start = time.Now()
+	proof, err := groth16.Prove(ccs, pk, full)
+	if err != nil {
+		return errWitnessUnsatisfied
+	}
+	m.ProvingMs = milliseconds(time.Since(start))
+
+	start = time.Now()
+	if err := groth16.Verify(proof, vk, public); err != nil {
+		return err
+	}
+	m.VerifyingMs = milliseconds(time.Since(start))
+
+	if m.ProofBytes, err = encodedSize(proof); err != nil {
+		return err
+	}
+	m.VerifyingKeyBytes, err = encodedSize(vk)
+	return err
+}
+
+// runPlonk uses a KZG SRS generated in-process; it is fine for measuring costs but not for real proofs
+func runPlonk(ccs constraint.ConstraintSystem, full, public witness.Witness, m *SchemeMetrics) error {
+	start := time.Now()
+	srs, srsLagrange, err := unsafekzg.NewSRS(ccs)
+	if err != nil {
+		return err
+	}
+	pk, vk, err := plonk.Setup(ccs, srs, srsLagrange)
+	if err != nil {
+		return err
+	}
+	m.SetupMs = milliseconds(time.Since(start))
+
+	start = time.Now()
+	proof, err := plonk.Prove(ccs, pk, full)
+	if err != nil {
+		return errWitnessUnsatisfied
+	}
+	m.ProvingMs = milliseconds(time.Since(start))
+
+	start = time.Now()
+	if err := plonk.Verify(proof, vk, public); err != nil {
+		return err
+	}
+	m.VerifyingMs = milliseconds(time.Since(start))
+
+	if m.ProofBytes, err = encodedSize(proof); err != nil {
+		return err
+	}
+	m.VerifyingKeyBytes, err = encodedSize(vk)
+	return err
+}
+
+var (
+	// errWitnessUnsatisfied hides solver errors, which include witness values
+	errWitnessUnsatisfied = errs.New(errs.Unprocessable, "witness_unsatisfied", "witness does not satisfy the circuit")
+	errCompareInput       = errs.New(errs.Invalid, "invalid_comparison", "invalid comparison request")
+)
+
+// compareSchemes proves the same witness of the named circuit under every scheme
+func compareSchemes(ctx context.Context, name string, witnessJSON []byte) (*CompareResponse, error) {
+	circuit, err := circuits.New(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errCompareInput, err)
+	}
+	full, err := circuits.ParseWitness(circuit, witnessJSON, false)
+	if err != nil {
+		return nil, fmt.Errorf("%w: witness: %v", errCompareInput, err)
+	}
+	public, err := full.Public()
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &CompareResponse{Circuit: name}
+	for _, s := range schemeRuns {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		ccs, err := s.compile(circuit)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", s.name, err)
+		}
+		m := SchemeMetrics{Scheme: s.name, Constraints: ccs.GetNbConstraints()}
+		if err := s.run(ccs, full, public, &m); err != nil {
+			return nil, fmt.Errorf("%s: %w", s.name, err)
+		}
+		resp.Schemes = append(resp.Schemes, m)
+	}
+	return resp, nil
+}
+
+// compareBackends reports side-by-side Groth16 and PLONK costs for one circuit and witness
+func compareBackends(w http.ResponseWriter, r *http.Request) {
+	var req CompareRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	if req.Circuit == "" {
+		req.Circuit = balanceCircuitName
+	}
+	if len(req.Witness) == 0 || string(req.Witness) == "null" {
+		if req.Circuit != balanceCircuitName {
+			writeError(w, errs.Errorf(errs.Invalid, "witness is required"))
+			return
+		}
+		req.Witness = defaultCompareWitness
+	}
+
+	resp, err := compareSchemes(r.Context(), req.Circuit, req.Witness)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, resp)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestCompareRejectsBadInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		circuit string
+		witness string
+		wantErr error
+	}{
+		{"Unknown circuit", "teleport", `{}`, errCompareInput},
+		{"Malformed witness", balanceCircuitName, `{"Balance": "lots"}`, errCompareInput},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := compareSchemes(context.Background(), tt.circuit, []byte(tt.witness)); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	rr := postJSON(t, compareBackends, "/admin/compare", CompareRequest{Circuit: bucketCircuitName})
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without a witness for a non-default circuit, got %d", rr.Code)
+	}
+}
+
+func TestCompareBackends(t *testing.T) {
+	SkipIfShort(t, "Groth16 and PLONK setup")
+
+	rr := postJSON(t, compareBackends, "/admin/compare", CompareRequest{})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var resp CompareResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Schemes) != 2 || resp.Schemes[0].Scheme != schemeGroth16 || resp.Schemes[1].Scheme != schemePlonk {
+		t.Fatalf("Expected groth16 and plonk metrics, got %+v", resp.Schemes)
+	}
+	for _, m := range resp.Schemes {
+		if m.Constraints == 0 || m.ProofBytes == 0 || m.VerifyingKeyBytes == 0 {
+			t.Errorf("Expected non-zero metrics for %s, got %+v", m.Scheme, m)
+		}
+	}
+
+	_, err := compareSchemes(context.Background(), balanceCircuitName, []byte(`{"Balance": 50, "NeededAmount": 100}`))
+	if !errors.Is(err, errWitnessUnsatisfied) {
+		t.Errorf("Expected an unsatisfied witness to be reported, got %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/korjavin/zkTest1/circuits"
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// Comparisons a balance proof can state about neededAmount. A strict proof is made with its own
+// circuit rather than by proving neededAmount + 1, so its circuit name says what it proves.
+const (
+	comparisonAtLeast = "gte" // balance ≥ neededAmount, the default
+	comparisonAbove   = "gt"  // balance > neededAmount
+)
+
+// Identity of the strict balance circuit
+const (
+	strictBalanceCircuitName    = circuits.StrictName
+	strictBalanceCircuitVersion = 1
+)
+
+// balanceCircuitVersions are the versions recorded with proofs of the balance circuits other
+// than the default one, bumped whenever their constraints change
+var balanceCircuitVersions = map[string]int{
+	strictBalanceCircuitName: strictBalanceCircuitVersion,
+	circuits.FastName:        1,
+	circuits.CompactName:     1,
+}
+
+// balanceCircuitFor returns the balance circuit proving comparison with preset; empty selects
+// the defaults
+func balanceCircuitFor(comparison, preset string) (string, error) {
+	var circuit string
+	switch comparison {
+	case "", comparisonAtLeast:
+		circuit = balanceCircuitName
+	case comparisonAbove:
+		circuit = strictBalanceCircuitName
+	default:
+		return "", errs.Errorf(errs.Invalid, "comparison must be %q or %q", comparisonAtLeast, comparisonAbove)
+	}
+	return presetCircuit(circuit, preset)
+}
+
+// balanceAssignment returns the public part of a balance circuit's assignment
+func balanceAssignment(circuit string, neededAmount int) frontend.Circuit {
+	return balanceWitness(circuit, nil, neededAmount)
+}
+
+// balanceWitness returns the assignment of a balance circuit; balance is nil for the public part,
+// and both are nil for the empty circuit
+func balanceWitness(circuit string, balance, neededAmount frontend.Variable) frontend.Circuit {
+	switch circuit {
+	case strictBalanceCircuitName:
+		return &circuits.StrictBalanceCircuit{Balance: balance, NeededAmount: neededAmount}
+	case circuits.FastName:
+		return &circuits.FastBalanceCircuit{Balance: balance, NeededAmount: neededAmount}
+	case circuits.CompactName:
+		return &circuits.CompactBalanceCircuit{Balance: balance, NeededAmount: neededAmount}
+	}
+	return &circuits.BalanceCircuit{Balance: balance, NeededAmount: neededAmount}
+}
+
+// proveComparison proves the stored balance of id against neededAmount with a balance circuit
+func proveComparison(ctx context.Context, curve ecc.ID, circuit, id string, neededAmount int) (groth16.Proof, string, error) {
+	if err := checkUserIssuance(id); err != nil {
+		return nil, "", err
+	}
+	if circuit == balanceCircuitName {
+		return proveBalance(ctx, curve, id, neededAmount)
+	}
+	return proveBalanceCircuit(ctx, curve, circuit, id, neededAmount)
+}
+
+// comparisonVerifier returns how proofs of a balance circuit are verified; dry runs are
+// neither counted nor audited
+func comparisonVerifier(circuit string, dryRun bool) func(context.Context, ecc.ID, groth16.Proof, int) error {
+	switch {
+	case circuit == balanceCircuitName && dryRun:
+		return checkBalance
+	case circuit == balanceCircuitName:
+		return verifyBalance
+	case dryRun:
+		return func(ctx context.Context, curve ecc.ID, proof groth16.Proof, neededAmount int) error {
+			return checkBalanceCircuit(ctx, curve, circuit, proof, neededAmount)
+		}
+	}
+	return func(ctx context.Context, curve ecc.ID, proof groth16.Proof, neededAmount int) error {
+		return verifyBalanceCircuit(ctx, curve, circuit, proof, neededAmount)
+	}
+}
+
+// proveBalanceCircuit generates a proof on curve with one of the balance circuits other than the
+// default, e.g. that the stored balance of id exceeds neededAmount. The returned digest
+// identifies the stored proof and is empty if it could not be persisted.
+func proveBalanceCircuit(ctx context.Context, curve ecc.ID, circuit, id string, neededAmount int) (groth16.Proof, string, error) {
+	if circuit == circuits.FastName && int64(neededAmount) >= int64(1)<<circuits.FastValueBits {
+		return nil, "", errs.Errorf(errs.Invalid, "neededAmount must be below 2^%d with preset %s", circuits.FastValueBits, presetFast)
+	}
+	balance, ledgerTx, exists := lookupBalance(id)
+	if !exists {
+		return nil, "", errBalanceNotFound
+	}
+	if err := checkBalanceAttestation(id, time.Now()); err != nil {
+		return nil, "", err
+	}
+
+	setup, err := loadCurveSetup(curve, circuit, balanceWitness(circuit, nil, nil))
+	if err != nil {
+		return nil, "", err
+	}
+	proof, err := setup.prove(ctx, balanceWitness(circuit, balance, neededAmount))
+	if err != nil {
+		if !isContextError(err) && !errors.Is(err, errProvingUnavailable) {
+			// Solver errors include witness values, so they must not reach the client or the logs
+			switch circuit {
+			case strictBalanceCircuitName:
+				err = errs.Errorf(errs.Unprocessable, "balance does not exceed neededAmount")
+			case circuits.FastName:
+				err = errs.Errorf(errs.Unprocessable, "balance is below neededAmount or too large for preset %s", presetFast)
+			default:
+				err = errs.Errorf(errs.Unprocessable, "balance is below neededAmount")
+			}
+		}
+		return nil, "", err
+	}
+
+	digest, err := persistProof(ctx, proof, ProofRecord{
+		Circuit:        circuit,
+		CircuitVersion: balanceCircuitVersions[circuit],
+		Curve:          recordedCurve(curve),
+		LedgerTx:       ledgerTx,
+		PublicInputs:   map[string]string{"neededAmount": strconv.Itoa(neededAmount)},
+		Holder:         id,
+	})
+	if err != nil {
+		log.Printf("Failed to persist proof: %v", err)
+	}
+	return proof, digest, nil
+}
+
+// verifyBalanceCircuit checks a proof of a balance circuit other than the default on curve
+// against the public neededAmount. It returns errInvalidProof when the proof does not verify.
+func verifyBalanceCircuit(ctx context.Context, curve ecc.ID, circuit string, proof groth16.Proof, neededAmount int) error {
+	return verifyWithSetup(ctx, curve, circuit, balanceWitness(circuit, nil, nil), proof, balanceAssignment(circuit, neededAmount))
+}
+
+// checkBalanceCircuit is verifyBalanceCircuit without counting or auditing the attempt, for dry runs
+func checkBalanceCircuit(ctx context.Context, curve ecc.ID, circuit string, proof groth16.Proof, neededAmount int) error {
+	setup, err := loadCurveSetup(curve, circuit, balanceWitness(circuit, nil, nil))
+	if err != nil {
+		return err
+	}
+	publicWitness, err := frontend.NewWitness(balanceAssignment(circuit, neededAmount), curve.ScalarField(), frontend.PublicOnly())
+	if err != nil {
+		return fmt.Errorf("public witness: %w", err)
+	}
+	return setup.checkWitness(ctx, proof, publicWitness)
+}
+
+// verifyStrictBalance checks a strict proof on curve against the public neededAmount.
+// It returns errInvalidProof when the proof does not verify.
+func verifyStrictBalance(ctx context.Context, curve ecc.ID, proof groth16.Proof, neededAmount int) error {
+	return verifyBalanceCircuit(ctx, curve, strictBalanceCircuitName, proof, neededAmount)
+}
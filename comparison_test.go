@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestStrictComparison(t *testing.T) {
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+	t.Cleanup(h.SetupCleanBalances)
+	h.AssertStatusCode(h.StoreBalance("strict_user", 100), http.StatusOK, "storing a balance")
+
+	// The inclusive boundary: a balance equal to the threshold is not above it
+	rr := postJSON(t, generateProof, "/get/proof/neededAmount", ProofRequest{ID: "strict_user", NeededAmount: 100, Comparison: comparisonAbove})
+	h.AssertStatusCode(rr, http.StatusUnprocessableEntity, "strict proof at the threshold")
+
+	rr = postJSON(t, generateProof, "/get/proof/neededAmount", ProofRequest{ID: "strict_user", NeededAmount: 99, Comparison: comparisonAbove})
+	h.AssertStatusCode(rr, http.StatusOK, "strict proof below the balance")
+	digest := rr.Header().Get("X-Proof-Digest")
+	if record, ok := lookupProofRecord(digest); !ok || record.Circuit != strictBalanceCircuitName {
+		t.Errorf("Expected the proof to be recorded as %s, got %+v", strictBalanceCircuitName, record)
+	}
+	proof := json.RawMessage(rr.Body.Bytes())
+
+	rr = postJSON(t, validateProof, "/validate", ValidateRequest{NeededAmount: 99, Proof: proof, Comparison: comparisonAbove})
+	h.AssertStatusCode(rr, http.StatusOK, "validating a strict proof")
+	rr = postJSON(t, validateProof, "/validate", ValidateRequest{NeededAmount: 98, Proof: proof, Comparison: comparisonAbove})
+	h.AssertStatusCode(rr, http.StatusUnauthorized, "validating a strict proof against another threshold")
+	rr = postJSON(t, validateProof, "/validate", ValidateRequest{NeededAmount: 99, Proof: proof})
+	h.AssertStatusCode(rr, http.StatusUnauthorized, "validating a strict proof as an inclusive one")
+
+	rr = postJSON(t, generateProof, "/get/proof/neededAmount", ProofRequest{ID: "strict_user", NeededAmount: 1, Comparison: ">="})
+	h.AssertStatusCode(rr, http.StatusBadRequest, "unknown comparison")
+	rr = postJSON(t, validateProof, "/validate", ValidateRequest{NeededAmount: 99, Proof: proof, Comparison: comparisonAbove, Circuit: strictBalanceCircuitName})
+	h.AssertStatusCode(rr, http.StatusBadRequest, "comparison with a circuit")
+}
+
+func TestInclusiveComparison(t *testing.T) {
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+	t.Cleanup(h.SetupCleanBalances)
+	h.AssertStatusCode(h.StoreBalance("inclusive_user", 100), http.StatusOK, "storing a balance")
+
+	rr := postJSON(t, generateProof, "/get/proof/neededAmount", ProofRequest{ID: "inclusive_user", NeededAmount: 101})
+	h.AssertStatusCode(rr, http.StatusUnprocessableEntity, "proof above the balance")
+
+	// Proofs verify against the keys they were made with, as the setup is shared
+	rr = postJSON(t, generateProof, "/get/proof/neededAmount", ProofRequest{ID: "inclusive_user", NeededAmount: 100})
+	h.AssertStatusCode(rr, http.StatusOK, "proof at the balance")
+	proof := json.RawMessage(rr.Body.Bytes())
+	rr = postJSON(t, validateProof, "/validate", ValidateRequest{NeededAmount: 100, Proof: proof})
+	h.AssertStatusCode(rr, http.StatusOK, "validating a proof at the balance")
+	rr = postJSON(t, validateProof, "/validate", ValidateRequest{NeededAmount: 99, Proof: proof})
+	h.AssertStatusCode(rr, http.StatusUnauthorized, "validating a proof against another threshold")
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/korjavin/zkTest1/circuits"
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// Identity of the composite (AND) circuits; each combination of predicates is its own circuit
+const (
+	compositeCircuitPrefix  = "composite/"
+	compositeCircuitVersion = 2
+)
+
+// maxCompositePredicates bounds the size, and number of cached combinations, of composite circuits
+const maxCompositePredicates = 8
+
+type predicateKind int
+
+const (
+	thresholdPredicate predicateKind = iota
+	membershipPredicate
+)
+
+// RegisteredPredicate is a statement that can be combined into a composite proof
+type RegisteredPredicate struct {
+	Kind      predicateKind
+	Attribute string // attribute compared by threshold predicates
+}
+
+// predicateRegistry lists the predicates available to composite proofs by name
+var predicateRegistry = map[string]RegisteredPredicate{
+	"balance":   {Kind: thresholdPredicate, Attribute: "balance"},
+	"age":       {Kind: thresholdPredicate, Attribute: "age"},
+	"allowlist": {Kind: membershipPredicate},
+}
+
+// PredicateSpec requests one predicate of a composite proof
+type PredicateSpec struct {
+	Name      string `json:"name"`
+	Threshold int64  `json:"threshold,omitempty"` // threshold predicates
+	List      string `json:"list,omitempty"`      // membership predicates
+}
+
+// lookupPredicate returns the predicate called name. Besides the predicates of the registry,
+// every attribute of a registered schema is a threshold predicate over itself.
+func lookupPredicate(name string) (RegisteredPredicate, bool) {
+	if registered, ok := predicateRegistry[name]; ok {
+		return registered, true
+	}
+	if schemaAttribute(name) {
+		return RegisteredPredicate{Kind: thresholdPredicate, Attribute: name}, true
+	}
+	return RegisteredPredicate{}, false
+}
+
+func (p PredicateSpec) String() string {
+	if registered, _ := lookupPredicate(p.Name); registered.Kind == membershipPredicate {
+		return fmt.Sprintf("%s(%s)", p.Name, p.List)
+	}
+	return fmt.Sprintf("%s >= %d", p.Name, p.Threshold)
+}
+
+// thresholdGadget proves Value ≥ Threshold
+type thresholdGadget struct {
+	Value     frontend.Variable `gnark:",private"`
+	Threshold frontend.Variable `gnark:",public"`
+}
+
+// CompositeCircuit is the conjunction of its threshold and membership gadgets
+type CompositeCircuit struct {
+	Thresholds  []thresholdGadget
+	Memberships []membershipGadget
+}
+
+func (circuit *CompositeCircuit) Define(api frontend.API) error {
+	cmp := circuits.NewComparator(api)
+	for _, t := range circuit.Thresholds {
+		cmp.Check(t.Threshold, circuits.ValueBits)
+		cmp.Check(t.Value, circuits.ValueBits)
+		cmp.AssertIsLessOrEqual(t.Threshold, t.Value, circuits.ValueBits)
+	}
+	for i := range circuit.Memberships {
+		if err := circuit.Memberships[i].define(api); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compositePolicy is a validated, canonically ordered list of predicates
+type compositePolicy []PredicateSpec
+
+// thresholds returns the thresholds of the policy's threshold predicates
+func (p compositePolicy) thresholds() []int64 {
+	var thresholds []int64
+	for _, spec := range p {
+		if registered, _ := lookupPredicate(spec.Name); registered.Kind == thresholdPredicate {
+			thresholds = append(thresholds, spec.Threshold)
+		}
+	}
+	return thresholds
+}
+
+// parseCompositePolicy validates specs against the registry and sorts them canonically
+func parseCompositePolicy(specs []PredicateSpec) (compositePolicy, error) {
+	if len(specs) == 0 {
+		return nil, errors.New("at least one predicate is required")
+	}
+	if len(specs) > maxCompositePredicates {
+		return nil, fmt.Errorf("at most %d predicates can be combined", maxCompositePredicates)
+	}
+
+	policy := make(compositePolicy, len(specs))
+	for i, spec := range specs {
+		registered, ok := lookupPredicate(spec.Name)
+		if !ok {
+			return nil, fmt.Errorf("unknown predicate %q", spec.Name)
+		}
+		switch registered.Kind {
+		case thresholdPredicate:
+			if spec.List != "" || spec.Threshold < 0 {
+				return nil, fmt.Errorf("predicate %q takes a non-negative threshold", spec.Name)
+			}
+		case membershipPredicate:
+			if spec.List == "" || spec.Threshold != 0 {
+				return nil, fmt.Errorf("predicate %q takes a list", spec.Name)
+			}
+		}
+		policy[i] = spec
+	}
+
+	sort.Slice(policy, func(i, j int) bool {
+		return policy[i].String() < policy[j].String()
+	})
+	return policy, nil
+}
+
+// circuitName identifies the compiled circuit for this combination of predicates
+func (p compositePolicy) circuitName() string {
+	names := make([]string, len(p))
+	for i, spec := range p {
+		names[i] = spec.Name
+	}
+	return compositeCircuitPrefix + strings.Join(names, "+")
+}
+
+func (p compositePolicy) String() string {
+	parts := make([]string, len(p))
+	for i, spec := range p {
+		parts[i] = spec.String()
+	}
+	return strings.Join(parts, " && ")
+}
+
+// compositeCircuitFor returns the empty composite circuit of a circuit name made by circuitName.
+// Thresholds and allowlist roots are public inputs, so the predicate names fix the circuit.
+func compositeCircuitFor(name string) (*CompositeCircuit, bool) {
+	names, ok := strings.CutPrefix(name, compositeCircuitPrefix)
+	if !ok {
+		return nil, false
+	}
+	var p compositePolicy
+	for _, n := range strings.Split(names, "+") {
+		if _, ok := lookupPredicate(n); !ok || len(p) == maxCompositePredicates {
+			return nil, false
+		}
+		p = append(p, PredicateSpec{Name: n})
+	}
+	return p.circuit(), true
+}
+
+// circuit returns an empty composite circuit sized for this combination
+func (p compositePolicy) circuit() *CompositeCircuit {
+	var circuit CompositeCircuit
+	for _, spec := range p {
+		if registered, _ := lookupPredicate(spec.Name); registered.Kind == membershipPredicate {
+			circuit.Memberships = append(circuit.Memberships, membershipGadget{})
+		} else {
+			circuit.Thresholds = append(circuit.Thresholds, thresholdGadget{})
+		}
+	}
+	return &circuit
+}
+
+// assignment builds the witness for id, or only its public part when id is empty
+func (p compositePolicy) assignment(id string) (*CompositeCircuit, error) {
+	var values map[string]int64
+	if id != "" {
+		values = attributeValues(id)
+	}
+
+	var assignment CompositeCircuit
+	for _, spec := range p {
+		registered, _ := lookupPredicate(spec.Name)
+
+		if registered.Kind == thresholdPredicate {
+			g := thresholdGadget{Value: 0, Threshold: spec.Threshold}
+			if id != "" {
+				v, ok := values[registered.Attribute]
+				if !ok || v < spec.Threshold {
+					return nil, errPredicateNotSatisfied
+				}
+				g.Value = v
+			}
+			assignment.Thresholds = append(assignment.Thresholds, g)
+			continue
+		}
+
+		list, err := lookupAllowlist(spec.List)
+		if err != nil {
+			return nil, err
+		}
+		g := publicMembership(list.Root())
+		if id != "" {
+			if g, err = list.membership(id); err != nil {
+				return nil, errPredicateNotSatisfied
+			}
+		}
+		assignment.Memberships = append(assignment.Memberships, g)
+	}
+	return &assignment, nil
+}
+
+// verify checks a composite proof against the public inputs of the policy.
+// It returns errInvalidProof when the proof does not verify.
+func (p compositePolicy) verify(ctx context.Context, proof groth16.Proof) error {
+	assignment, err := p.assignment("")
+	if err != nil {
+		return err
+	}
+
+	setup, err := loadSetup(p.circuitName(), p.circuit())
+	if err != nil {
+		return err
+	}
+	return setup.verify(ctx, proof, assignment)
+}
+
+type CompositeProofRequest struct {
+	ID         string          `json:"id"`
+	Predicates []PredicateSpec `json:"predicates"`
+	Audience   string          `json:"audience,omitempty"` // relying party the proof is issued for
+}
+
+type CompositeProofResponse struct {
+	Policy string        `json:"policy"`
+	Proof  groth16.Proof `json:"proof"`
+}
+
+type CompositeValidateRequest struct {
+	Predicates []PredicateSpec `json:"predicates"`
+	Proof      json.RawMessage `json:"proof"`
+}
+
+// generateCompositeProof proves all requested predicates for a user in a single proof
+func generateCompositeProof(w http.ResponseWriter, r *http.Request) {
+	var req CompositeProofRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := checkSessionUser(r, req.ID); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	policy, err := parseCompositePolicy(req.Predicates)
+	if err != nil {
+		writeError(w, errs.Wrap(errs.Invalid, err))
+		return
+	}
+	if err := checkTenantAccess(r, compositeEnvelopeCircuit, policy.thresholds()...); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if err := checkConsent(req.ID, req.Audience, compositeEnvelopeCircuit, policy.String(), time.Now()); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := checkUserIssuance(req.ID); err != nil {
+		writeError(w, err)
+		return
+	}
+	if len(attributeValues(req.ID)) == 0 {
+		writeError(w, errs.Errorf(errs.NotFound, "no attributes stored for id"))
+		return
+	}
+
+	assignment, err := policy.assignment(req.ID)
+	if errors.Is(err, errAllowlistNotFound) {
+		// The list is named in the request body rather than the path
+		writeError(w, errs.Errorf(errs.Invalid, "%w", err))
+		return
+	}
+	if err != nil {
+		writeError(w, errs.Wrap(errs.Unprocessable, err))
+		return
+	}
+
+	setup, err := loadSetup(policy.circuitName(), policy.circuit())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	proof, err := setup.prove(r.Context(), assignment)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	digest, err := persistProof(r.Context(), proof, ProofRecord{
+		Circuit:        policy.circuitName(),
+		CircuitVersion: compositeCircuitVersion,
+		PublicInputs:   map[string]string{"policy": policy.String()},
+		Audience:       req.Audience,
+		Holder:         req.ID,
+	})
+	if err != nil {
+		log.Printf("Failed to persist proof: %v", err)
+	}
+	if digest != "" {
+		w.Header().Set("X-Proof-Digest", digest)
+	}
+	setProofHeaders(w, defaultCurve, assignment)
+	signIssuedProof(w, defaultCurve, compositeEnvelopeCircuit, map[string][]PredicateSpec{"predicates": req.Predicates}, proof, assignment)
+
+	writeProof(w, r, proof, CompositeProofResponse{Policy: policy.String(), Proof: proof})
+}
+
+// validateCompositeProof verifies a composite proof against the requested predicates
+func validateCompositeProof(w http.ResponseWriter, r *http.Request) {
+	var req CompositeValidateRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	policy, err := parseCompositePolicy(req.Predicates)
+	if err != nil {
+		writeError(w, errs.Wrap(errs.Invalid, err))
+		return
+	}
+	if err := checkTenantAccess(r, compositeEnvelopeCircuit, policy.thresholds()...); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	proof, err := decodeProofJSON(defaultCurve, req.Proof)
+	if err != nil {
+		writeError(w, fmt.Errorf("%w: %v", errMalformedProof, err))
+		return
+	}
+
+	err = policy.verify(r.Context(), proof)
+	if errors.Is(err, errAllowlistNotFound) {
+		// The list is named in the request body rather than the path
+		writeError(w, errs.Errorf(errs.Invalid, "%w", err))
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/test"
+)
+
+func withAllowlist(t *testing.T, name string, members ...string) *Allowlist {
+	t.Helper()
+	list, err := newAllowlist(name, members)
+	if err != nil {
+		t.Fatalf("Failed to build allowlist: %v", err)
+	}
+	allowlistsMu.Lock()
+	allowlists[name] = list
+	allowlistsMu.Unlock()
+	t.Cleanup(func() {
+		allowlistsMu.Lock()
+		delete(allowlists, name)
+		allowlistsMu.Unlock()
+	})
+	return list
+}
+
+func TestAllowlistMembershipCircuit(t *testing.T) {
+	members := make([]string, 0, 5)
+	for i := 0; i < 5; i++ {
+		members = append(members, fmt.Sprintf("member-%d", i))
+	}
+	list := withAllowlist(t, "circuit-test", members...)
+
+	policy, err := parseCompositePolicy([]PredicateSpec{{Name: "allowlist", List: "circuit-test"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, m := range members {
+		g, err := list.membership(m)
+		if err != nil {
+			t.Fatalf("Expected %s to be a member: %v", m, err)
+		}
+		assignment := &CompositeCircuit{Memberships: []membershipGadget{g}}
+		if err := test.IsSolved(policy.circuit(), assignment, ecc.BN254.ScalarField()); err != nil {
+			t.Errorf("Membership of %s not satisfied: %v", m, err)
+		}
+	}
+
+	g, _ := list.membership("member-0")
+	g.Leaf = fieldToBig(allowlistLeaf("outsider"))
+	assignment := &CompositeCircuit{Memberships: []membershipGadget{g}}
+	if err := test.IsSolved(policy.circuit(), assignment, ecc.BN254.ScalarField()); err == nil {
+		t.Error("Expected a foreign leaf not to satisfy the circuit")
+	}
+
+	if _, err := list.membership("outsider"); err != errNotAllowlisted {
+		t.Errorf("Expected errNotAllowlisted, got %v", err)
+	}
+}
+
+func TestParseCompositePolicy(t *testing.T) {
+	policy, err := parseCompositePolicy([]PredicateSpec{
+		{Name: "balance", Threshold: 100},
+		{Name: "allowlist", List: "vip"},
+		{Name: "age", Threshold: 18},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := policy.String(); got != "age >= 18 && allowlist(vip) && balance >= 100" {
+		t.Errorf("Unexpected canonical policy %q", got)
+	}
+	if got := policy.circuitName(); got != "composite/age+allowlist+balance" {
+		t.Errorf("Unexpected circuit name %q", got)
+	}
+
+	invalid := [][]PredicateSpec{
+		nil,
+		{{Name: "height", Threshold: 1}},
+		{{Name: "allowlist"}},
+		{{Name: "balance", List: "vip"}},
+		{{Name: "age", Threshold: -1}},
+	}
+	for _, specs := range invalid {
+		if _, err := parseCompositePolicy(specs); err == nil {
+			t.Errorf("Expected %+v to be rejected", specs)
+		}
+	}
+}
+
+func TestCompositeProofWorkflow(t *testing.T) {
+	SkipIfShort(t, "composite proof generation")
+
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+	h.StoreBalance("and_user", 500)
+	postJSON(t, storeAttribute, "/store/attribute", AttributeRequest{ID: "and_user", Name: "age", Value: 30})
+	h.StoreBalance("outsider", 500)
+	postJSON(t, storeAttribute, "/store/attribute", AttributeRequest{ID: "outsider", Name: "age", Value: 30})
+	withAllowlist(t, "vip", "alice", "and_user", "bob")
+
+	predicates := []PredicateSpec{
+		{Name: "balance", Threshold: 100},
+		{Name: "age", Threshold: 18},
+		{Name: "allowlist", List: "vip"},
+	}
+	rr := postJSON(t, generateCompositeProof, "/get/proof/composite", CompositeProofRequest{ID: "and_user", Predicates: predicates})
+	h.AssertStatusCode(rr, http.StatusOK, "generating composite proof")
+
+	var resp struct {
+		Policy string          `json:"policy"`
+		Proof  json.RawMessage `json:"proof"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		predicates     []PredicateSpec
+		expectedStatus int
+	}{
+		{"Same predicates", predicates, http.StatusOK},
+		{"Reordered predicates", []PredicateSpec{predicates[2], predicates[0], predicates[1]}, http.StatusOK},
+		{"Higher threshold", []PredicateSpec{{Name: "balance", Threshold: 1000}, predicates[1], predicates[2]}, http.StatusUnauthorized},
+		{"Unknown allowlist", []PredicateSpec{predicates[0], predicates[1], {Name: "allowlist", List: "nope"}}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			valid := postJSON(t, validateCompositeProof, "/validate/composite", CompositeValidateRequest{Predicates: tt.predicates, Proof: resp.Proof})
+			h.AssertStatusCode(valid, tt.expectedStatus, tt.name)
+		})
+	}
+
+	t.Run("Not on allowlist", func(t *testing.T) {
+		rr := postJSON(t, generateCompositeProof, "/get/proof/composite", CompositeProofRequest{ID: "outsider", Predicates: predicates})
+		h.AssertStatusCode(rr, http.StatusUnprocessableEntity, "proving for non-member")
+	})
+}
@@ -0,0 +1,480 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds runtime settings read from the environment at startup
+type Config struct {
+	Addr            string
+	DevMode         bool
+	AccessLog       bool
+	CaptureFile     string // verification requests are appended here for zkctl replay; empty disables capture
+	Faults          FaultConfig
+	Bus             BusConfig
+	Artifacts       ArtifactConfig
+	Secrets         SecretsConfig
+	Keys            KeyStoreConfig
+	Signing         SigningConfig
+	Cleanup         CleanupConfig
+	Bank            BankConfig
+	AuditShip       AuditShipConfig
+	Notify          NotifyConfig
+	KeyRotation     KeyRotationConfig
+	Proxy           ProxyConfig
+	Attestation     AttestationConfig
+	Seed            SeedConfig
+	Gate            GateConfig
+	Quota           QuotaConfig
+	UserProofs      UserProofLimit
+	Probes          ProbeConfig
+	RateLimit       RateLimitConfig
+	Curves          CurveConfig
+	TenantAccess    TenantAccessConfig
+	APIKeys         map[string]bool // tenant IDs of the accepted X-API-Keys
+	OIDC            OIDCConfig
+	OAuth           OAuthConfig
+	HMAC            HMACConfig
+	Nonces          NonceConfig
+	Limits          ResourceLimits
+	VerifyCache     VerifyCacheConfig
+	Features        []string      // feature flags enabled at startup
+	RequestTimeout  time.Duration // bounds the work done for one request; 0 means no limit
+	ProvingWorkers  int           // proofs computed at once, others wait in line; 0 means no limit
+	ReservedWorkers int           // proving workers only interactive proofs may take
+	ProvingMemory   int64         // estimated bytes proofs may hold at once; 0 means no limit
+	ProvingGC       int           // GOGC while proofs run; 0 keeps the runtime's setting
+	MaxConstraints  int           // constraints a circuit may have; 0 means no limit
+	RequireIfMatch  bool          // balance updates must name the version they replace
+	RequireConsent  bool          // proofs issued for an audience need their user's consent
+	RoundThresholds bool          // balance proofs state the next bucket boundary up
+	Buckets         []int64       // lower bounds of disclosure buckets; nil means powers of two
+	Tiers           []Tier        // balance tiers of tier certificates; nil keeps the defaults
+	StatementsFile  string        // JSON array of statements registered at startup
+	CircuitPlugins  []string      // Go plugins registering circuits, loaded at startup
+}
+
+// loadConfig reads the server configuration from ZK_* environment variables
+func loadConfig() (Config, error) {
+	var err error
+	cfg := Config{
+		Addr: envString("ZK_ADDR", ":8080"),
+	}
+
+	if cfg.DevMode, err = envBool("ZK_DEV_MODE", false); err != nil {
+		return cfg, err
+	}
+	if cfg.AccessLog, err = envBool("ZK_ACCESS_LOG", true); err != nil {
+		return cfg, err
+	}
+	cfg.CaptureFile = os.Getenv("ZK_CAPTURE_FILE")
+	if cfg.RequestTimeout, err = envDuration("ZK_REQUEST_TIMEOUT", 15*time.Second); err != nil {
+		return cfg, err
+	}
+	// Defaults follow the container's cgroup limits rather than the CPUs of the host
+	cfg.Limits = detectLimits(os.DirFS(cgroupRoot))
+	if cfg.ProvingWorkers, err = envInt("ZK_PROVING_WORKERS", cfg.Limits.provingWorkers()); err != nil {
+		return cfg, err
+	}
+	if cfg.ProvingWorkers < 0 {
+		return cfg, fmt.Errorf("ZK_PROVING_WORKERS must not be negative")
+	}
+	provingMemory, err := envInt("ZK_PROVING_MEMORY", int(cfg.Limits.provingMemory()))
+	if err != nil {
+		return cfg, err
+	}
+	if cfg.ProvingMemory = int64(provingMemory); cfg.ProvingMemory < 0 {
+		return cfg, fmt.Errorf("ZK_PROVING_MEMORY must not be negative")
+	}
+	if cfg.ProvingGC, err = envInt("ZK_PROVING_GC_PERCENT", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.ProvingGC < 0 {
+		return cfg, fmt.Errorf("ZK_PROVING_GC_PERCENT must not be negative")
+	}
+	if cfg.MaxConstraints, err = envInt("ZK_MAX_CONSTRAINTS", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxConstraints < 0 {
+		return cfg, fmt.Errorf("ZK_MAX_CONSTRAINTS must not be negative")
+	}
+	if cfg.ReservedWorkers, err = envInt("ZK_PROVING_RESERVED_INTERACTIVE", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.ReservedWorkers < 0 || cfg.ReservedWorkers > 0 && cfg.ReservedWorkers >= cfg.ProvingWorkers {
+		return cfg, fmt.Errorf("ZK_PROVING_RESERVED_INTERACTIVE must leave batch proofs at least one of ZK_PROVING_WORKERS")
+	}
+
+	if cfg.VerifyCache.TTL, err = envDuration("ZK_VERIFY_CACHE_TTL", time.Minute); err != nil {
+		return cfg, err
+	}
+	if cfg.VerifyCache.Capacity, err = envInt("ZK_VERIFY_CACHE_SIZE", 10000); err != nil {
+		return cfg, err
+	}
+
+	cfg.Faults.Paths = envList("ZK_FAULT_PATHS")
+	if cfg.Faults.Latency, err = envDuration("ZK_FAULT_LATENCY", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.Faults.ErrorRate, err = envRate("ZK_FAULT_ERROR_RATE"); err != nil {
+		return cfg, err
+	}
+	if cfg.Faults.TruncateRate, err = envRate("ZK_FAULT_TRUNCATE_RATE"); err != nil {
+		return cfg, err
+	}
+
+	cfg.Bus = BusConfig{
+		URL:          os.Getenv("ZK_BUS_URL"),
+		RequestTopic: envString("ZK_BUS_REQUEST_TOPIC", "zk.proof.requests"),
+		ReplyTopic:   envString("ZK_BUS_REPLY_TOPIC", "zk.proof.results"),
+		QueueGroup:   envString("ZK_BUS_QUEUE_GROUP", "zktest1-provers"),
+		Timeout:      cfg.RequestTimeout,
+	}
+
+	cfg.Artifacts = ArtifactConfig{
+		Backend: envString("ZK_ARTIFACT_BACKEND", "memory"),
+		Dir:     envString("ZK_ARTIFACT_DIR", "./data/artifacts"),
+		S3: S3Config{
+			Endpoint: os.Getenv("ZK_S3_ENDPOINT"),
+			Region:   envString("ZK_S3_REGION", "us-east-1"),
+			Bucket:   os.Getenv("ZK_S3_BUCKET"),
+			Prefix:   os.Getenv("ZK_S3_PREFIX"),
+		},
+	}
+	if cfg.Artifacts.S3.PathStyle, err = envBool("ZK_S3_PATH_STYLE", false); err != nil {
+		return cfg, err
+	}
+
+	cfg.Secrets = SecretsConfig{
+		Backend: envString("ZK_SECRETS_BACKEND", "env"),
+		Dir:     envString("ZK_SECRETS_DIR", "/run/secrets"),
+		Vault: VaultConfig{
+			Addr:  os.Getenv("ZK_VAULT_ADDR"),
+			Token: os.Getenv("ZK_VAULT_TOKEN"),
+			Mount: envString("ZK_VAULT_MOUNT", "secret"),
+			Path:  envString("ZK_VAULT_PATH", "zktest1"),
+		},
+	}
+	if cfg.Secrets.CacheTTL, err = envDuration("ZK_SECRETS_CACHE_TTL", 5*time.Minute); err != nil {
+		return cfg, err
+	}
+
+	cfg.Signing = SigningConfig{
+		Backend:     envString("ZK_SIGNING_BACKEND", "local"),
+		KeyID:       os.Getenv("ZK_SIGNING_KEY_ID"),
+		Region:      envString("ZK_SIGNING_REGION", "us-east-1"),
+		Endpoint:    os.Getenv("ZK_SIGNING_ENDPOINT"),
+		DID:         os.Getenv("ZK_DID"),
+		HTTPTimeout: 10 * time.Second,
+	}
+
+	cfg.Bank = BankConfig{
+		Connector:   os.Getenv("ZK_BANK_CONNECTOR"),
+		URL:         envString("ZK_BANK_URL", "https://sandbox.plaid.com"),
+		HTTPTimeout: 10 * time.Second,
+	}
+
+	if cfg.Attestation.TTL, err = envDuration("ZK_ATTESTATION_TTL", 30*24*time.Hour); err != nil {
+		return cfg, err
+	}
+	if cfg.Attestation.Reminder, err = envDuration("ZK_ATTESTATION_REMINDER", 72*time.Hour); err != nil {
+		return cfg, err
+	}
+
+	cfg.AuditShip = AuditShipConfig{
+		URL:    os.Getenv("ZK_AUDIT_SHIP_URL"),
+		Format: envString("ZK_AUDIT_SHIP_FORMAT", "syslog"),
+	}
+
+	cfg.Notify = NotifyConfig{
+		SMTP: SMTPConfig{
+			Addr:     os.Getenv("ZK_SMTP_ADDR"),
+			From:     os.Getenv("ZK_SMTP_FROM"),
+			Username: os.Getenv("ZK_SMTP_USERNAME"),
+		},
+		HTTPTimeout: 10 * time.Second,
+	}
+
+	cfg.Proxy = ProxyConfig{BackendURL: os.Getenv("ZK_PROXY_BACKEND_URL"), HTTPTimeout: 10 * time.Second}
+	if cfg.Proxy.Only, err = envBool("ZK_PROXY_ONLY", false); err != nil {
+		return cfg, err
+	}
+	if err := checkProxyConfig(cfg.Proxy); err != nil {
+		return cfg, err
+	}
+
+	cfg.Keys.Dir = os.Getenv("ZK_KEY_DIR")
+	if cfg.Keys.Encrypt, err = envBool("ZK_KEY_ENCRYPTION", false); err != nil {
+		return cfg, err
+	}
+	if cfg.Keys.Sign, err = envBool("ZK_KEY_SIGNING", false); err != nil {
+		return cfg, err
+	}
+
+	if cfg.KeyRotation.Interval, err = envDuration("ZK_KEY_ROTATION_INTERVAL", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.KeyRotation.Grace, err = envDuration("ZK_KEY_ROTATION_GRACE", 24*time.Hour); err != nil {
+		return cfg, err
+	}
+	if cfg.KeyRotation.Interval < 0 || cfg.KeyRotation.Grace < 0 {
+		return cfg, fmt.Errorf("ZK_KEY_ROTATION_INTERVAL and ZK_KEY_ROTATION_GRACE must not be negative")
+	}
+
+	if cfg.Cleanup.Interval, err = envDuration("ZK_CLEANUP_INTERVAL", time.Minute); err != nil {
+		return cfg, err
+	}
+	if cfg.Cleanup.BalanceTTL, err = envDuration("ZK_BALANCE_TTL", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.Cleanup.DeletedRetention, err = envDuration("ZK_DELETED_RETENTION", 7*24*time.Hour); err != nil {
+		return cfg, err
+	}
+	if cfg.Cleanup.ProofRetention, err = envDuration("ZK_PROOF_RETENTION", 0); err != nil {
+		return cfg, err
+	}
+
+	cfg.Features = envList("ZK_FEATURES")
+
+	if cfg.RateLimit.Rate, err = envFloat("ZK_RATE_LIMIT", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.RateLimit.Burst, err = envInt("ZK_RATE_BURST", 20); err != nil {
+		return cfg, err
+	}
+	if cfg.RateLimit.Rate < 0 || cfg.RateLimit.Burst < 1 {
+		return cfg, fmt.Errorf("ZK_RATE_LIMIT must not be negative and ZK_RATE_BURST must be at least 1")
+	}
+
+	if cfg.Quota.Daily, err = envDuration("ZK_QUOTA_DAILY", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.Quota.Monthly, err = envDuration("ZK_QUOTA_MONTHLY", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.UserProofs.Max, err = envInt("ZK_USER_PROOF_LIMIT", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.UserProofs.Window, err = envDuration("ZK_USER_PROOF_WINDOW", time.Hour); err != nil {
+		return cfg, err
+	}
+	if cfg.UserProofs.Max < 0 || cfg.UserProofs.Window <= 0 {
+		return cfg, fmt.Errorf("ZK_USER_PROOF_LIMIT must not be negative and ZK_USER_PROOF_WINDOW must be positive")
+	}
+	if cfg.Probes.Queries, err = envInt("ZK_PROBE_QUERIES", 4); err != nil {
+		return cfg, err
+	}
+	if cfg.Probes.Window, err = envDuration("ZK_PROBE_WINDOW", time.Hour); err != nil {
+		return cfg, err
+	}
+	if (cfg.Probes.Queries != 0 && cfg.Probes.Queries < 3) || cfg.Probes.Window <= 0 {
+		return cfg, fmt.Errorf("ZK_PROBE_QUERIES must be 0 or at least 3 and ZK_PROBE_WINDOW must be positive")
+	}
+
+	cfg.Nonces = NonceConfig{
+		Backend: envString("ZK_NONCE_STORE", "memory"),
+		Redis:   RedisConfig{Addr: os.Getenv("ZK_REDIS_ADDR")},
+	}
+	if cfg.Nonces.Capacity, err = envInt("ZK_NONCE_CAPACITY", 100000); err != nil {
+		return cfg, err
+	}
+	if cfg.Nonces.Redis.DB, err = envInt("ZK_REDIS_DB", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.Nonces.Redis.TLS, err = envBool("ZK_REDIS_TLS", false); err != nil {
+		return cfg, err
+	}
+	if cfg.Nonces.Redis.Timeout, err = envDuration("ZK_REDIS_TIMEOUT", 2*time.Second); err != nil {
+		return cfg, err
+	}
+
+	cfg.OIDC = OIDCConfig{
+		DiscoveryURL: os.Getenv("ZK_OIDC_DISCOVERY_URL"),
+		ClientID:     os.Getenv("ZK_OIDC_CLIENT_ID"),
+		RedirectURL:  os.Getenv("ZK_OIDC_REDIRECT_URL"),
+		Scopes:       envList("ZK_OIDC_SCOPES"),
+		HTTPTimeout:  10 * time.Second,
+	}
+	if !slices.Contains(cfg.OIDC.Scopes, "openid") {
+		cfg.OIDC.Scopes = append([]string{"openid"}, cfg.OIDC.Scopes...)
+	}
+
+	cfg.OAuth = OAuthConfig{
+		Mode:             os.Getenv("ZK_OAUTH_MODE"),
+		IntrospectionURL: os.Getenv("ZK_OAUTH_INTROSPECTION_URL"),
+		ClientID:         os.Getenv("ZK_OAUTH_CLIENT_ID"),
+		JWKSURL:          os.Getenv("ZK_OAUTH_JWKS_URL"),
+		Issuer:           os.Getenv("ZK_OAUTH_ISSUER"),
+		Audience:         os.Getenv("ZK_OAUTH_AUDIENCE"),
+		HTTPTimeout:      10 * time.Second,
+	}
+	if cfg.OAuth.Required, err = envBool("ZK_OAUTH_REQUIRED", false); err != nil {
+		return cfg, err
+	}
+
+	cfg.HMAC.KeyIDs = envList("ZK_HMAC_KEY_IDS")
+	if cfg.HMAC.Window, err = envDuration("ZK_HMAC_WINDOW", 5*time.Minute); err != nil {
+		return cfg, err
+	}
+
+	cfg.Gate = GateConfig{
+		Mode:        os.Getenv("ZK_PROOF_GATE"),
+		CaptchaURL:  os.Getenv("ZK_CAPTCHA_URL"),
+		HTTPTimeout: 10 * time.Second,
+	}
+	if cfg.Gate.Difficulty, err = envInt("ZK_POW_DIFFICULTY", 16); err != nil {
+		return cfg, err
+	}
+	if cfg.Gate.ChallengeTTL, err = envDuration("ZK_POW_CHALLENGE_TTL", 2*time.Minute); err != nil {
+		return cfg, err
+	}
+
+	if cfg.RequireIfMatch, err = envBool("ZK_REQUIRE_IF_MATCH", false); err != nil {
+		return cfg, err
+	}
+	if cfg.RequireConsent, err = envBool("ZK_REQUIRE_CONSENT", false); err != nil {
+		return cfg, err
+	}
+	if cfg.RoundThresholds, err = envBool("ZK_ROUND_THRESHOLDS", false); err != nil {
+		return cfg, err
+	}
+
+	if cfg.Seed.Enabled, err = envBool("ZK_SEED_DEMO_DATA", false); err != nil {
+		return cfg, err
+	}
+	cfg.Seed.File = os.Getenv("ZK_SEED_FILE")
+	cfg.StatementsFile = os.Getenv("ZK_STATEMENTS_FILE")
+	cfg.CircuitPlugins = envList("ZK_CIRCUIT_PLUGINS")
+
+	if values := envList("ZK_BUCKET_BOUNDARIES"); len(values) > 0 {
+		if cfg.Buckets, err = parseBucketBoundaries(values); err != nil {
+			return cfg, fmt.Errorf("ZK_BUCKET_BOUNDARIES: %w", err)
+		}
+	}
+	if values := envList("ZK_TIERS"); len(values) > 0 {
+		if cfg.Tiers, err = parseTiers(values); err != nil {
+			return cfg, fmt.Errorf("ZK_TIERS: %w", err)
+		}
+	}
+
+	if cfg.APIKeys, err = parseAPIKeys(envList("ZK_API_KEYS")); err != nil {
+		return cfg, fmt.Errorf("ZK_API_KEYS: %w", err)
+	}
+	if cfg.Curves.Tenants, err = parseCurveAssignments(envList("ZK_TENANT_CURVES")); err != nil {
+		return cfg, fmt.Errorf("ZK_TENANT_CURVES: %w", err)
+	}
+	if cfg.Curves.Circuits, err = parseCurveAssignments(envList("ZK_CIRCUIT_CURVES")); err != nil {
+		return cfg, fmt.Errorf("ZK_CIRCUIT_CURVES: %w", err)
+	}
+	if err := cfg.Curves.check(); err != nil {
+		return cfg, fmt.Errorf("ZK_CIRCUIT_CURVES: %w", err)
+	}
+	if cfg.TenantAccess, err = parseTenantAccess(envList("ZK_TENANT_CIRCUITS"), envList("ZK_TENANT_MAX_THRESHOLDS")); err != nil {
+		return cfg, fmt.Errorf("tenant access: %w", err)
+	}
+	if err := cfg.TenantAccess.checkAPIKeys(cfg.APIKeys); err != nil {
+		return cfg, fmt.Errorf("tenant access: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// resolveSecrets fills in secret configuration values from the secret provider
+func (cfg *Config) resolveSecrets(ctx context.Context, p SecretProvider) error {
+	var err error
+	if cfg.Artifacts.S3.AccessKey, err = optionalSecret(ctx, p, s3AccessKeySecret); err != nil {
+		return fmt.Errorf("%s: %w", s3AccessKeySecret, err)
+	}
+	if cfg.Artifacts.S3.SecretKey, err = optionalSecret(ctx, p, s3SecretKeySecret); err != nil {
+		return fmt.Errorf("%s: %w", s3SecretKeySecret, err)
+	}
+	return nil
+}
+
+func envString(name, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func envBool(name string, fallback bool) (bool, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return fallback, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return fallback, fmt.Errorf("%s: %w", name, err)
+	}
+	return b, nil
+}
+
+func envInt(name string, fallback int) (int, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return fallback, fmt.Errorf("%s: %w", name, err)
+	}
+	return n, nil
+}
+
+func envFloat(name string, fallback float64) (float64, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return fallback, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return fallback, fmt.Errorf("%s: %w", name, err)
+	}
+	return f, nil
+}
+
+func envDuration(name string, fallback time.Duration) (time.Duration, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return fallback, fmt.Errorf("%s: %w", name, err)
+	}
+	return d, nil
+}
+
+// envRate reads a probability in the range [0, 1]
+func envRate(name string) (float64, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return 0, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", name, err)
+	}
+	if f < 0 || f > 1 {
+		return 0, fmt.Errorf("%s: must be between 0 and 1, got %v", name, f)
+	}
+	return f, nil
+}
+
+// envList reads a comma-separated list, ignoring empty entries
+func envList(name string) []string {
+	var out []string
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// maxConsentTTL bounds how long a consent may be granted for
+const maxConsentTTL = 366 * 24 * time.Hour
+
+var (
+	errConsentRequired = errs.New(errs.Forbidden, "consent_required", "the user has not consented to this proof for the audience")
+	errConsentNotFound = errs.New(errs.NotFound, "consent_not_found", "consent not found")
+)
+
+// requireConsent makes proofs issued for an audience need a consent of their user
+var requireConsent bool
+
+// Consent is a user's permission for proofs about their data to be issued for a relying party
+type Consent struct {
+	ID        string     `json:"id"`
+	Audience  string     `json:"audience"`            // relying party that asked for the proofs
+	Circuit   string     `json:"circuit"`             // composite, statement/<name> or an external circuit
+	Predicate string     `json:"predicate,omitempty"` // policy or statement proofs must state; empty allows any
+	GrantedAt time.Time  `json:"grantedAt"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+// ConsentRequest grants a consent
+type ConsentRequest struct {
+	Audience  string    `json:"audience"`
+	Circuit   string    `json:"circuit"`
+	Predicate string    `json:"predicate,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// active reports whether c allows a proof of circuit stating predicate for audience at now
+func (c *Consent) active(audience, circuit, predicate string, now time.Time) bool {
+	return c.RevokedAt == nil && now.Before(c.ExpiresAt) && c.Audience == audience &&
+		c.Circuit == circuit && (c.Predicate == "" || c.Predicate == predicate)
+}
+
+// consents holds the consents of each user, oldest first
+var (
+	consents   = make(map[string][]*Consent)
+	consentsMu sync.Mutex
+)
+
+// checkConsent fails when a proof of circuit stating predicate is issued for audience without
+// the consent of user. Proofs without an audience are the user's own and need none.
+func checkConsent(user, audience, circuit, predicate string, now time.Time) error {
+	if !requireConsent || audience == "" {
+		return nil
+	}
+	consentsMu.Lock()
+	defer consentsMu.Unlock()
+	if slices.ContainsFunc(consents[user], func(c *Consent) bool { return c.active(audience, circuit, predicate, now) }) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", errConsentRequired, audience)
+}
+
+// grantConsent records a user's consent to proofs for a relying party
+func grantConsent(w http.ResponseWriter, r *http.Request) {
+	var req ConsentRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	user := r.PathValue("userID")
+	if err := checkSessionUser(r, user); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	switch {
+	case req.Audience == "" || req.Circuit == "":
+		writeError(w, errs.Errorf(errs.Invalid, "audience and circuit are required"))
+		return
+	case !req.ExpiresAt.After(now):
+		writeError(w, errs.Errorf(errs.Invalid, "expiresAt must be in the future"))
+		return
+	case req.ExpiresAt.Sub(now) > maxConsentTTL:
+		writeError(w, errs.Errorf(errs.Invalid, "consent may be granted for at most %s", maxConsentTTL))
+		return
+	}
+	id, err := randomToken()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	c := &Consent{
+		ID:        id[:16],
+		Audience:  req.Audience,
+		Circuit:   req.Circuit,
+		Predicate: req.Predicate,
+		GrantedAt: now,
+		ExpiresAt: req.ExpiresAt.UTC(),
+	}
+	consentsMu.Lock()
+	consents[user] = append(consents[user], c)
+	consentsMu.Unlock()
+
+	audit.record(AuditEvent{Type: auditConsentGranted, Circuit: c.Circuit, Subject: c.Audience})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	writeJSON(w, c)
+}
+
+// listConsents returns the consents of a user that have not expired, revoked ones included,
+// to that user only
+func listConsents(w http.ResponseWriter, r *http.Request) {
+	user := r.PathValue("userID")
+	if err := checkReader(r, user); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	now := time.Now()
+	list := []Consent{}
+	consentsMu.Lock()
+	for _, c := range consents[user] {
+		if now.Before(c.ExpiresAt) {
+			list = append(list, *c)
+		}
+	}
+	consentsMu.Unlock()
+	writeJSON(w, list)
+}
+
+// revokeConsent withdraws a consent; proofs already issued under it stay valid
+func revokeConsent(w http.ResponseWriter, r *http.Request) {
+	user := r.PathValue("userID")
+	if err := checkSessionUser(r, user); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	consentsMu.Lock()
+	i := slices.IndexFunc(consents[user], func(c *Consent) bool { return c.ID == r.PathValue("consentID") })
+	var c *Consent
+	revoked := false
+	if i >= 0 {
+		if c = consents[user][i]; c.RevokedAt == nil {
+			now := time.Now().UTC()
+			c.RevokedAt, revoked = &now, true
+		}
+	}
+	consentsMu.Unlock()
+	if c == nil {
+		writeError(w, errConsentNotFound)
+		return
+	}
+
+	if revoked {
+		audit.record(AuditEvent{Type: auditConsentRevoked, Circuit: c.Circuit, Subject: c.Audience})
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// pruneConsents drops consents that have expired and returns how many
+func pruneConsents(now time.Time) int {
+	consentsMu.Lock()
+	defer consentsMu.Unlock()
+
+	removed := 0
+	for user, list := range consents {
+		kept := slices.DeleteFunc(list, func(c *Consent) bool { return !now.Before(c.ExpiresAt) })
+		removed += len(list) - len(kept)
+		if len(kept) == 0 {
+			delete(consents, user)
+		} else {
+			consents[user] = kept
+		}
+	}
+	return removed
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func consentRequest(t *testing.T, handler http.HandlerFunc, method, user, consentID string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, "/consents/"+user, bytes.NewReader(data))
+	req.SetPathValue("userID", user)
+	req.SetPathValue("consentID", consentID)
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	return rr
+}
+
+func TestConsents(t *testing.T) {
+	h := NewTestHelper(t)
+	requireConsent = true
+	t.Cleanup(func() {
+		requireConsent = false
+		consents = make(map[string][]*Consent)
+	})
+	now := time.Now()
+
+	if err := checkConsent("alice", "lender.example", "composite", "age >= 18", now); !errors.Is(err, errConsentRequired) {
+		t.Fatalf("Expected %v without consent, got %v", errConsentRequired, err)
+	}
+	if err := checkConsent("alice", "", "composite", "age >= 18", now); err != nil {
+		t.Errorf("Expected proofs without an audience to need no consent, got %v", err)
+	}
+
+	grant := ConsentRequest{Audience: "lender.example", Circuit: "composite", Predicate: "age >= 18", ExpiresAt: now.Add(time.Hour)}
+	rr := consentRequest(t, grantConsent, "POST", "alice", "", grant)
+	h.AssertStatusCode(rr, http.StatusCreated, "granting consent")
+	var consent Consent
+	if err := json.Unmarshal(rr.Body.Bytes(), &consent); err != nil || consent.ID == "" {
+		t.Fatalf("Expected a consent, got %s", rr.Body.String())
+	}
+
+	if err := checkConsent("alice", "lender.example", "composite", "age >= 18", now); err != nil {
+		t.Errorf("Expected the consented proof to be allowed, got %v", err)
+	}
+	for _, tt := range []struct{ user, audience, circuit, predicate string }{
+		{"bob", "lender.example", "composite", "age >= 18"},
+		{"alice", "broker.example", "composite", "age >= 18"},
+		{"alice", "lender.example", "statement/adult", "age >= 18"},
+		{"alice", "lender.example", "composite", "age >= 21"},
+	} {
+		if err := checkConsent(tt.user, tt.audience, tt.circuit, tt.predicate, now); !errors.Is(err, errConsentRequired) {
+			t.Errorf("Expected %+v to need consent, got %v", tt, err)
+		}
+	}
+	if err := checkConsent("alice", "lender.example", "composite", "age >= 18", now.Add(2*time.Hour)); !errors.Is(err, errConsentRequired) {
+		t.Errorf("Expected an expired consent to be refused, got %v", err)
+	}
+
+	// Consents are only listed for their user, here with a token issued to them
+	listAs := func(subject string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			listConsents(w, r.WithContext(withAccessToken(r.Context(), &accessToken{Subject: subject})))
+		}
+	}
+	h.AssertStatusCode(consentRequest(t, listConsents, "GET", "alice", "", nil), http.StatusUnauthorized, "listing consents anonymously")
+	h.AssertStatusCode(consentRequest(t, listAs("bob"), "GET", "alice", "", nil), http.StatusForbidden, "listing another user's consents")
+	rr = consentRequest(t, listAs("alice"), "GET", "alice", "", nil)
+	h.AssertStatusCode(rr, http.StatusOK, "listing consents")
+	var list []Consent
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil || len(list) != 1 || list[0].ID != consent.ID {
+		t.Errorf("Expected the granted consent, got %s", rr.Body.String())
+	}
+
+	rr = consentRequest(t, revokeConsent, "DELETE", "alice", consent.ID, nil)
+	h.AssertStatusCode(rr, http.StatusNoContent, "revoking consent")
+	if err := checkConsent("alice", "lender.example", "composite", "age >= 18", now); !errors.Is(err, errConsentRequired) {
+		t.Errorf("Expected a revoked consent to be refused, got %v", err)
+	}
+	rr = consentRequest(t, revokeConsent, "DELETE", "alice", "unknown", nil)
+	h.AssertStatusCode(rr, http.StatusNotFound, "revoking an unknown consent")
+
+	for name, req := range map[string]ConsentRequest{
+		"No audience":   {Circuit: "composite", ExpiresAt: now.Add(time.Hour)},
+		"Expired":       {Audience: "lender.example", Circuit: "composite", ExpiresAt: now.Add(-time.Hour)},
+		"Too long-term": {Audience: "lender.example", Circuit: "composite", ExpiresAt: now.Add(2 * maxConsentTTL)},
+	} {
+		rr := consentRequest(t, grantConsent, "POST", "alice", "", req)
+		h.AssertStatusCode(rr, http.StatusBadRequest, name)
+	}
+
+	if removed := pruneConsents(now.Add(2 * time.Hour)); removed != 1 || len(consents) != 0 {
+		t.Errorf("Expected the expired consent to be pruned, removed %d", removed)
+	}
+}
+
+func TestCompositeProofNeedsConsent(t *testing.T) {
+	h := NewTestHelper(t)
+	requireConsent = true
+	t.Cleanup(func() { requireConsent = false })
+	setAttribute("carol", "age", 30)
+
+	rr := postJSON(t, generateCompositeProof, "/get/proof/composite", CompositeProofRequest{
+		ID: "carol", Predicates: []PredicateSpec{{Name: "age", Threshold: 18}}, Audience: "lender.example",
+	})
+	h.AssertStatusCode(rr, http.StatusForbidden, "composite proof without consent")
+	if !strings.Contains(rr.Body.String(), errConsentRequired.Code) {
+		t.Errorf("Expected %s, got %s", errConsentRequired.Code, rr.Body.String())
+	}
+}
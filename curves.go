@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/korjavin/zkTest1/circuits"
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// proofCurveHeader carries the curve an issued proof was made on
+const proofCurveHeader = "X-Proof-Curve"
+
+// proofBackend is the proving system of every proof this server issues
+const proofBackend = "groth16"
+
+// defaultCurve is used for tenants and circuits without a selection; BN254 is the curve
+// with precompiles on Ethereum
+const defaultCurve = ecc.BN254
+
+// supportedCurves are the curves proofs can be made on
+var supportedCurves = []ecc.ID{ecc.BN254, ecc.BLS12_381}
+
+// portableCircuits can be compiled for every supported curve. The committed and composite
+// circuits check hashes computed with BN254 MiMC outside the circuit, so they stay on BN254.
+var portableCircuits = map[string]bool{
+	balanceCircuitName:       true,
+	bucketCircuitName:        true,
+	predicateCircuitName:     true,
+	timeLockCircuitName:      true,
+	strictBalanceCircuitName: true,
+}
+
+// CurveConfig selects the curve proofs are made on, per tenant and per circuit
+type CurveConfig struct {
+	Tenants  map[string]ecc.ID // keyed by tenant ID, see tenantID
+	Circuits map[string]ecc.ID
+}
+
+// curveSelection holds the curve configuration of the server
+var curveSelection CurveConfig
+
+// parseCurve parses a curve name such as "bls12_381"; an empty name is the default curve
+func parseCurve(name string) (ecc.ID, error) {
+	if name == "" {
+		return defaultCurve, nil
+	}
+	id, err := ecc.IDFromString(name)
+	if err != nil || !slices.Contains(supportedCurves, id) {
+		return ecc.UNKNOWN, errs.Errorf(errs.Invalid, "unsupported curve %q, supported: %s", name, curveNames())
+	}
+	return id, nil
+}
+
+func curveNames() string {
+	names := make([]string, len(supportedCurves))
+	for i, id := range supportedCurves {
+		names[i] = id.String()
+	}
+	return strings.Join(names, ", ")
+}
+
+// parseCurveAssignments parses name=curve pairs such as "balance=bls12_381"
+func parseCurveAssignments(values []string) (map[string]ecc.ID, error) {
+	assigned := make(map[string]ecc.ID, len(values))
+	for _, v := range values {
+		name, curveName, ok := strings.Cut(v, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%q is not name=curve", v)
+		}
+		curve, err := parseCurve(strings.TrimSpace(curveName))
+		if err != nil {
+			return nil, err
+		}
+		assigned[name] = curve
+	}
+	return assigned, nil
+}
+
+// check rejects circuit selections naming an unknown circuit or moving one that is only
+// available on the default curve
+func (c CurveConfig) check() error {
+	for name, curve := range c.Circuits {
+		if !slices.Contains(circuits.Names(), name) {
+			return fmt.Errorf("unknown circuit %q", name)
+		}
+		if curve != defaultCurve && !portableCircuits[name] {
+			return fmt.Errorf("%s is only available on %s", name, defaultCurve)
+		}
+	}
+	return nil
+}
+
+// curveFor returns the curve proofs of circuit are made on for a tenant: the tenant's
+// selection, then the circuit's, then the default. Circuits only available on BN254 ignore
+// tenant selections, and the curve recorded with their proofs says so.
+func (c CurveConfig) curveFor(tenant, circuit string) ecc.ID {
+	if !portableCircuits[circuit] {
+		return defaultCurve
+	}
+	if curve, ok := c.Tenants[tenant]; ok {
+		return curve
+	}
+	if curve, ok := c.Circuits[circuit]; ok {
+		return curve
+	}
+	return defaultCurve
+}
+
+// configuredCurves returns the curves circuit is set up on for some tenant or by its own selection
+func (c CurveConfig) configuredCurves(circuit string) []ecc.ID {
+	curves := []ecc.ID{c.curveFor("", circuit)}
+	if portableCircuits[circuit] {
+		for _, curve := range c.Tenants {
+			if !slices.Contains(curves, curve) {
+				curves = append(curves, curve)
+			}
+		}
+	}
+	return curves
+}
+
+// proofCurve returns the curve proofs of circuit are made on for the tenant of r
+func proofCurve(r *http.Request, circuit string) ecc.ID {
+	return curveSelection.curveFor(tenantID(r), circuit)
+}
+
+// verifyCurve parses the curve a proof of circuit claims to be made on
+func verifyCurve(name, circuit string) (ecc.ID, error) {
+	curve, err := parseCurve(name)
+	if err != nil {
+		return ecc.UNKNOWN, err
+	}
+	if curve != defaultCurve && !portableCircuits[circuit] {
+		return ecc.UNKNOWN, errs.Errorf(errs.Invalid, "%s proofs are only made on %s", circuit, defaultCurve)
+	}
+	return curve, nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+func withCurves(t *testing.T, cfg CurveConfig) {
+	t.Helper()
+	previous := curveSelection
+	curveSelection = cfg
+	t.Cleanup(func() { curveSelection = previous })
+}
+
+func TestParseCurveAssignments(t *testing.T) {
+	got, err := parseCurveAssignments([]string{"key-0011223344556677=bls12_381", "balance = BN254"})
+	if err != nil {
+		t.Fatalf("Expected assignments to parse, got %v", err)
+	}
+	if got["key-0011223344556677"] != ecc.BLS12_381 || got["balance"] != ecc.BN254 {
+		t.Errorf("Unexpected assignments %v", got)
+	}
+
+	for _, values := range [][]string{{"balance"}, {"=bn254"}, {"balance=bw6_761"}, {"balance=secp256k1"}} {
+		if _, err := parseCurveAssignments(values); err == nil {
+			t.Errorf("Expected %q to be rejected", values)
+		}
+	}
+}
+
+func TestCurveConfigCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		circuits map[string]ecc.ID
+		valid    bool
+	}{
+		{"Portable circuit", map[string]ecc.ID{bucketCircuitName: ecc.BLS12_381}, true},
+		{"BN254-only circuit on BN254", map[string]ecc.ID{committedCircuitName: ecc.BN254}, true},
+		{"BN254-only circuit moved", map[string]ecc.ID{committedCircuitName: ecc.BLS12_381}, false},
+		{"Unknown circuit", map[string]ecc.ID{"teleport": ecc.BN254}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := (CurveConfig{Circuits: tt.circuits}).check(); (err == nil) != tt.valid {
+				t.Errorf("Expected valid=%v, got %v", tt.valid, err)
+			}
+		})
+	}
+}
+
+func TestCurveFor(t *testing.T) {
+	cfg := CurveConfig{
+		Tenants:  map[string]ecc.ID{"key-bls": ecc.BLS12_381, "key-eth": ecc.BN254},
+		Circuits: map[string]ecc.ID{predicateCircuitName: ecc.BLS12_381},
+	}
+
+	tests := []struct {
+		name    string
+		tenant  string
+		circuit string
+		want    ecc.ID
+	}{
+		{"Default", anonymousTenant, balanceCircuitName, ecc.BN254},
+		{"Tenant selection", "key-bls", balanceCircuitName, ecc.BLS12_381},
+		{"Circuit selection", anonymousTenant, predicateCircuitName, ecc.BLS12_381},
+		{"Tenant wins over circuit", "key-eth", predicateCircuitName, ecc.BN254},
+		{"BN254-only circuit ignores tenant", "key-bls", committedCircuitName, ecc.BN254},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cfg.curveFor(tt.tenant, tt.circuit); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+
+	if _, err := verifyCurve("bls12_381", committedCircuitName); errs.Status(err) != http.StatusBadRequest {
+		t.Errorf("Expected a BLS12-381 committed proof to be refused, got %v", err)
+	}
+}
+
+func TestBLS12381BucketProof(t *testing.T) {
+	SkipIfShort(t, "BLS12-381 proof generation")
+	withBuckets(t, []int64{0, 1000, 10000})
+	withCurves(t, CurveConfig{Tenants: map[string]ecc.ID{anonymousTenant: ecc.BLS12_381}})
+
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+	h.StoreBalance("bls_user", 4200)
+
+	rr := postJSON(t, generateBucketProof, "/get/proof/bucket", BucketProofRequest{ID: "bls_user"})
+	h.AssertStatusCode(rr, http.StatusOK, "generating BLS12-381 bucket proof")
+	if got := rr.Header().Get(proofCurveHeader); got != "bls12_381" {
+		t.Fatalf("Expected the proof curve header to be bls12_381, got %q", got)
+	}
+
+	var resp struct {
+		Proof json.RawMessage `json:"proof"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	public, err := base64.StdEncoding.DecodeString(rr.Header().Get(publicWitnessHeader))
+	if err != nil {
+		t.Fatalf("Failed to decode public witness: %v", err)
+	}
+
+	upper := int64(10000)
+	valid := postJSON(t, validateBucketProof, "/validate/bucket", BucketValidateRequest{Lower: 1000, Upper: &upper, Proof: resp.Proof, Curve: "bls12_381"})
+	h.AssertStatusCode(valid, http.StatusOK, "validating on the proof's curve")
+
+	if rr := postJSON(t, validateBucketProof, "/validate/bucket", BucketValidateRequest{Lower: 1000, Upper: &upper, Proof: resp.Proof}); rr.Code == http.StatusOK {
+		t.Error("Expected a BLS12-381 proof not to verify as a BN254 proof")
+	}
+
+	witness := postJSON(t, validateProof, "/validate", ValidateRequest{Circuit: bucketCircuitName, Curve: "bls12_381", Proof: resp.Proof, PublicWitness: public})
+	h.AssertStatusCode(witness, http.StatusOK, "validating against the BLS12-381 public witness")
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/korjavin/zkTest1/circuits"
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// defaultDashboardEvents is the number of audit events /admin/dashboard/audit returns by default
+const defaultDashboardEvents = 50
+
+// KeyInfo describes the keys of a circuit setup loaded by this server
+type KeyInfo struct {
+	Name       string    `json:"name"`
+	Curve      string    `json:"curve"`
+	KeyID      string    `json:"kid,omitempty"`
+	Created    time.Time `json:"created,omitempty"`
+	AgeSeconds int64     `json:"ageSeconds,omitempty"`
+	Persisted  bool      `json:"persisted"`
+	VerifyOnly string    `json:"verifyOnly,omitempty"` // why the proving key could not be loaded
+	Error      string    `json:"error,omitempty"`      // why the setup failed
+}
+
+// CircuitInfo describes a registered circuit as compiled on BN254
+type CircuitInfo struct {
+	Name         string   `json:"name"`
+	Constraints  int      `json:"constraints"`
+	PublicInputs int      `json:"publicInputs"`
+	SecretInputs int      `json:"secretInputs"`
+	Curves       []string `json:"curves"` // curves proofs of the circuit are configured for
+}
+
+var (
+	circuitInfos     []CircuitInfo
+	circuitInfosErr  error
+	circuitInfosOnce sync.Once
+)
+
+// getDashboardProving reports proofs waiting for a worker, workers busy and recent jobs
+func getDashboardProving(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, provers.status())
+}
+
+// getDashboardKeys lists the circuit keys set up so far with their ages
+func getDashboardKeys(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, keyManager.Inventory(time.Now()))
+}
+
+// getDashboardCircuits lists the registered circuits with their constraint counts
+func getDashboardCircuits(w http.ResponseWriter, r *http.Request) {
+	circuitInfosOnce.Do(func() {
+		for _, name := range circuits.Names() {
+			circuit, err := circuits.New(name)
+			if err != nil {
+				circuitInfosErr = err
+				return
+			}
+			ccs, err := circuits.Compile(circuit)
+			if err != nil {
+				circuitInfosErr = err
+				return
+			}
+			circuitInfos = append(circuitInfos, CircuitInfo{
+				Name:         name,
+				Constraints:  ccs.GetNbConstraints(),
+				PublicInputs: ccs.GetNbPublicVariables() - 1, // without the constant one wire
+				SecretInputs: ccs.GetNbSecretVariables(),
+			})
+		}
+	})
+	if circuitInfosErr != nil {
+		writeError(w, circuitInfosErr)
+		return
+	}
+
+	// Curve selection is read per request; the compiled shape never changes
+	infos := make([]CircuitInfo, len(circuitInfos))
+	for i, info := range circuitInfos {
+		for _, curve := range curveSelection.configuredCurves(info.Name) {
+			info.Curves = append(info.Curves, curve.String())
+		}
+		infos[i] = info
+	}
+	writeJSON(w, infos)
+}
+
+// getDashboardAudit returns the latest audit events, newest first, limited by ?limit=
+func getDashboardAudit(w http.ResponseWriter, r *http.Request) {
+	limit := defaultDashboardEvents
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > auditCapacity {
+			writeError(w, errs.Errorf(errs.Invalid, "limit must be between 1 and %d", auditCapacity))
+			return
+		}
+		limit = n
+	}
+	writeJSON(w, audit.latest(limit))
+}
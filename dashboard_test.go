@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDashboardCircuits(t *testing.T) {
+	h := NewTestHelper(t)
+	rr := httptest.NewRecorder()
+	getDashboardCircuits(rr, httptest.NewRequest("GET", "/admin/dashboard/circuits", nil))
+	h.AssertStatusCode(rr, http.StatusOK, "listing circuits")
+
+	var infos []CircuitInfo
+	if err := json.Unmarshal(rr.Body.Bytes(), &infos); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	for _, info := range infos {
+		if info.Name != balanceCircuitName {
+			continue
+		}
+		if info.Constraints == 0 || info.PublicInputs != 1 || info.SecretInputs != 1 || len(info.Curves) == 0 || info.Curves[0] != "bn254" {
+			t.Errorf("Unexpected balance circuit info %+v", info)
+		}
+		return
+	}
+	t.Errorf("Expected the balance circuit to be listed, got %s", rr.Body.String())
+}
+
+func TestDashboardKeys(t *testing.T) {
+	previous := keyManager
+	created := time.Now().Add(-time.Hour).UTC()
+	ready := &setupEntry{setup: &circuitSetup{created: created}}
+	ready.done.Store(true)
+	failed := &setupEntry{err: errors.New("setup failed")}
+	failed.done.Store(true)
+	keyManager = &KeyManager{entries: map[string]*setupEntry{
+		"balance@bls12_381": ready,
+		"predicate-or":      failed,
+		"balance-bucket":    {}, // still being set up
+	}}
+	t.Cleanup(func() { keyManager = previous })
+
+	h := NewTestHelper(t)
+	rr := httptest.NewRecorder()
+	getDashboardKeys(rr, httptest.NewRequest("GET", "/admin/dashboard/keys", nil))
+	h.AssertStatusCode(rr, http.StatusOK, "listing keys")
+
+	var inventory []KeyInfo
+	if err := json.Unmarshal(rr.Body.Bytes(), &inventory); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(inventory) != 2 {
+		t.Fatalf("Expected the two finished setups, got %+v", inventory)
+	}
+	if k := inventory[0]; k.Name != "balance@bls12_381" || k.Curve != "bls12_381" || !k.Created.Equal(created) || k.AgeSeconds < 3600 {
+		t.Errorf("Unexpected key info %+v", k)
+	}
+	if k := inventory[1]; k.Name != "predicate-or" || k.Curve != "bn254" || k.Error != "setup failed" {
+		t.Errorf("Expected the failed setup with its error, got %+v", k)
+	}
+}
+
+func TestDashboardAudit(t *testing.T) {
+	previous := audit
+	t.Cleanup(func() { audit = previous })
+	audit = newAuditLog(10)
+	for _, typ := range []string{auditFlagUpdated, auditProofIssued, auditProofVerified} {
+		audit.record(AuditEvent{Type: typ})
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		status int
+		types  []string
+	}{
+		{"Default limit", "", http.StatusOK, []string{auditProofVerified, auditProofIssued, auditFlagUpdated}},
+		{"Limited", "?limit=2", http.StatusOK, []string{auditProofVerified, auditProofIssued}},
+		{"Zero", "?limit=0", http.StatusBadRequest, nil},
+		{"Not a number", "?limit=all", http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			getDashboardAudit(rr, httptest.NewRequest("GET", "/admin/dashboard/audit"+tt.query, nil))
+			if rr.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+			if tt.types == nil {
+				return
+			}
+			var events []AuditEvent
+			if err := json.Unmarshal(rr.Body.Bytes(), &events); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			var got []string
+			for _, e := range events {
+				got = append(got, e.Type)
+			}
+			if len(got) != len(tt.types) {
+				t.Fatalf("Expected %v, got %v", tt.types, got)
+			}
+			for i := range got {
+				if got[i] != tt.types[i] {
+					t.Errorf("Expected %v, got %v", tt.types, got)
+					break
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// maxRequestBodyBytes caps the size of JSON request bodies
+const maxRequestBodyBytes = 1 << 20
+
+// decodeJSON strictly decodes a single JSON object from the request body into dst.
+// Unknown fields, mistyped values and trailing data are rejected with an error
+// that names the offending field, so typos in client payloads are not silently ignored.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	body := http.MaxBytesReader(w, r.Body, maxRequestBodyBytes)
+
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(dst); err != nil {
+		return describeDecodeError(err)
+	}
+
+	// Reject anything after the first JSON value
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		return errs.Errorf(errs.Invalid, "request body must contain a single JSON object")
+	}
+
+	return nil
+}
+
+// unmarshalStrict decodes an embedded JSON value, rejecting unknown fields like decodeJSON
+func unmarshalStrict(data []byte, dst interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		return describeDecodeError(err)
+	}
+	return nil
+}
+
+// describeDecodeError converts encoding/json errors into client-facing invalid-request errors
+func describeDecodeError(err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var maxBytesErr *http.MaxBytesError
+
+	switch {
+	case errors.Is(err, io.EOF):
+		return errs.Errorf(errs.Invalid, "request body must not be empty")
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return errs.Errorf(errs.Invalid, "request body contains malformed JSON")
+	case errors.As(err, &syntaxErr):
+		return errs.Errorf(errs.Invalid, "request body contains malformed JSON at position %d", syntaxErr.Offset)
+	case errors.As(err, &typeErr):
+		if typeErr.Field == "" {
+			return errs.Errorf(errs.Invalid, "request body must be a JSON object, got %s", typeErr.Value)
+		}
+		return errs.Errorf(errs.Invalid, "field %q: expected %s, got %s", typeErr.Field, typeErr.Type, typeErr.Value)
+	case errors.As(err, &maxBytesErr):
+		return errs.Errorf(errs.Invalid, "request body must not exceed %d bytes", maxBytesErr.Limit)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.TrimPrefix(err.Error(), "json: unknown field ")
+		return errs.Errorf(errs.Invalid, "unknown field %s", field)
+	default:
+		return errs.Wrap(errs.Invalid, err)
+	}
+}
+
+// writeJSON encodes v as the JSON response body
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		expectError string
+	}{
+		{
+			name: "Valid request",
+			body: `{"id": "user1", "amount": 150}`,
+		},
+		{
+			name:        "Unknown field",
+			body:        `{"id": "user1", "amonut": 150}`,
+			expectError: `unknown field "amonut"`,
+		},
+		{
+			name:        "String instead of number",
+			body:        `{"id": "user1", "amount": "150"}`,
+			expectError: `field "amount": expected int, got string`,
+		},
+		{
+			name:        "Fractional number",
+			body:        `{"id": "user1", "amount": 1.5}`,
+			expectError: `field "amount": expected int, got number 1.5`,
+		},
+		{
+			name:        "Trailing data",
+			body:        `{"id": "user1", "amount": 150} {"id": "user2"}`,
+			expectError: "single JSON object",
+		},
+		{
+			name:        "Empty body",
+			body:        ``,
+			expectError: "must not be empty",
+		},
+		{
+			name:        "Malformed JSON",
+			body:        `{"id": "user1",`,
+			expectError: "malformed JSON",
+		},
+		{
+			name:        "Array instead of object",
+			body:        `[1, 2, 3]`,
+			expectError: "must be a JSON object",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/store/sum", bytes.NewBufferString(tt.body))
+			rr := httptest.NewRecorder()
+
+			var dst BalanceRequest
+			err := decodeJSON(rr, req, &dst)
+
+			if tt.expectError == "" {
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatalf("Expected error containing %q, got nil", tt.expectError)
+			}
+			if !strings.Contains(err.Error(), tt.expectError) {
+				t.Errorf("Expected error containing %q, got %q", tt.expectError, err.Error())
+			}
+		})
+	}
+}
+
+func TestStoreBalanceRejectsUnknownFields(t *testing.T) {
+	req := httptest.NewRequest("POST", "/store/sum", bytes.NewBufferString(`{"id": "user1", "balance": 150}`))
+	rr := httptest.NewRecorder()
+
+	http.HandlerFunc(storeBalance).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+	var body ErrorResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Expected a JSON error body, got %q", rr.Body.String())
+	}
+	if body.Code != "invalid_request" || !strings.Contains(body.Error, `unknown field "balance"`) {
+		t.Errorf("Expected an invalid_request error naming the unknown field, got %+v", body)
+	}
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// didCacheTTL bounds how long a resolved did:web document is used without fetching it again
+const didCacheTTL = 5 * time.Minute
+
+// Multicodec prefixes of the did:key public keys this server understands, as varints
+var (
+	multicodecP256    = []byte{0x80, 0x24}
+	multicodecEd25519 = []byte{0xed, 0x01}
+)
+
+var (
+	errDIDInvalid     = errs.New(errs.Invalid, "did_invalid", "not a did:key or did:web identifier")
+	errDIDUnresolved  = errs.New(errs.Unprocessable, "did_unresolved", "DID could not be resolved")
+	errDIDSignature   = errs.New(errs.Unauthorized, "did_signature_invalid", "signature does not verify with the issuer's DID keys")
+	errDIDUnsupported = errs.New(errs.Unprocessable, "did_key_unsupported", "DID uses a key type this server cannot verify; use P-256 or Ed25519")
+)
+
+// issuerDID is the server's own DID, the issuer of attestations and bundles; empty without a signer
+var issuerDID string
+
+// VerificationMethod is a key of a DID document, as published in JsonWebKey2020 form
+type VerificationMethod struct {
+	ID           string           `json:"id"`
+	Type         string           `json:"type"`
+	Controller   string           `json:"controller"`
+	PublicKeyJWK *jwkKey          `json:"publicKeyJwk,omitempty"`
+	Multibase    string           `json:"publicKeyMultibase,omitempty"`
+	key          crypto.PublicKey // parsed from either encoding
+}
+
+type jwkKey struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y,omitempty"`
+}
+
+// DIDDocument is the subset of a W3C DID document needed to verify signatures
+type DIDDocument struct {
+	Context            []string             `json:"@context"`
+	ID                 string               `json:"id"`
+	VerificationMethod []VerificationMethod `json:"verificationMethod"`
+	AssertionMethod    []string             `json:"assertionMethod,omitempty"`
+}
+
+// newIssuerDID returns the server's DID: did, which must be a did:web, or else the did:key
+// of the signing key
+func newIssuerDID(did string, s Signer) (string, error) {
+	if s == nil {
+		return "", nil
+	}
+	if did == "" {
+		pub, ok := s.Public().(*ecdsa.PublicKey)
+		if !ok {
+			return "", errors.New("signing key is not an ECDSA key")
+		}
+		return didKey(pub), nil
+	}
+	if _, err := didWebURL(did); err != nil {
+		return "", fmt.Errorf("ZK_DID: %w", err)
+	}
+	return did, nil
+}
+
+// didKey encodes a P-256 public key as a did:key
+func didKey(pub *ecdsa.PublicKey) string {
+	compressed := elliptic.MarshalCompressed(elliptic.P256(), pub.X, pub.Y)
+	return "did:key:z" + base58Encode(append(append([]byte{}, multicodecP256...), compressed...))
+}
+
+// serverDIDDocument describes the server's signing key under issuerDID
+func serverDIDDocument() (DIDDocument, error) {
+	pub, ok := signer.Public().(*ecdsa.PublicKey)
+	if !ok {
+		return DIDDocument{}, errors.New("signing key is not an ECDSA key")
+	}
+	method := VerificationMethod{
+		ID:         issuerDID + "#" + signer.KeyID(),
+		Type:       "JsonWebKey2020",
+		Controller: issuerDID,
+		PublicKeyJWK: &jwkKey{
+			Kty: "EC",
+			Crv: "P-256",
+			X:   base64.RawURLEncoding.EncodeToString(padCoordinate(pub.X)),
+			Y:   base64.RawURLEncoding.EncodeToString(padCoordinate(pub.Y)),
+		},
+		key: pub,
+	}
+	return DIDDocument{
+		Context:            []string{"https://www.w3.org/ns/did/v1", "https://w3id.org/security/suites/jws-2020/v1"},
+		ID:                 issuerDID,
+		VerificationMethod: []VerificationMethod{method},
+		AssertionMethod:    []string{method.ID},
+	}, nil
+}
+
+// getDIDDocument serves the server's DID document at /.well-known/did.json for did:web
+func getDIDDocument(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(issuerDID, "did:web:") {
+		writeError(w, errs.Errorf(errs.NotFound, "the server's DID is not a did:web"))
+		return
+	}
+	doc, err := serverDIDDocument()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/did+json")
+	if err := json.NewEncoder(w).Encode(doc); err != nil {
+		writeError(w, err)
+	}
+}
+
+// ResolvedDID lists the verification keys of a DID as JWKs
+type ResolvedDID struct {
+	ID                 string               `json:"id"`
+	VerificationMethod []VerificationMethod `json:"verificationMethod"`
+}
+
+// resolveDIDHandler resolves a user's or issuer's DID to its verification keys
+func resolveDIDHandler(w http.ResponseWriter, r *http.Request) {
+	doc, err := dids.resolve(r.Context(), r.PathValue("did"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	resolved := ResolvedDID{ID: doc.ID}
+	for _, m := range doc.VerificationMethod {
+		jwk, err := publicJWK(m.key)
+		if err != nil {
+			continue
+		}
+		resolved.VerificationMethod = append(resolved.VerificationMethod, VerificationMethod{
+			ID: m.ID, Type: "JsonWebKey2020", Controller: m.Controller, PublicKeyJWK: &jwk,
+		})
+	}
+	writeJSON(w, resolved)
+}
+
+func publicJWK(key crypto.PublicKey) (jwkKey, error) {
+	switch pub := key.(type) {
+	case *ecdsa.PublicKey:
+		return jwkKey{
+			Kty: "EC",
+			Crv: "P-256",
+			X:   base64.RawURLEncoding.EncodeToString(padCoordinate(pub.X)),
+			Y:   base64.RawURLEncoding.EncodeToString(padCoordinate(pub.Y)),
+		}, nil
+	case ed25519.PublicKey:
+		return jwkKey{Kty: "OKP", Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(pub)}, nil
+	default:
+		return jwkKey{}, errDIDUnsupported
+	}
+}
+
+// didResolver resolves did:key locally and did:web over HTTPS, caching did:web documents
+type didResolver struct {
+	client *http.Client
+	now    func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedDID
+}
+
+type cachedDID struct {
+	doc     DIDDocument
+	fetched time.Time
+}
+
+var dids = newDIDResolver(&http.Client{Timeout: 10 * time.Second}, time.Now)
+
+func newDIDResolver(client *http.Client, now func() time.Time) *didResolver {
+	return &didResolver{client: client, now: now, cache: make(map[string]cachedDID)}
+}
+
+func (d *didResolver) resolve(ctx context.Context, did string) (DIDDocument, error) {
+	switch {
+	case did != "" && did == issuerDID:
+		// The server's own DID never needs a round trip to itself
+		return serverDIDDocument()
+	case strings.HasPrefix(did, "did:key:"):
+		return resolveDIDKey(did)
+	case strings.HasPrefix(did, "did:web:"):
+		return d.resolveWeb(ctx, did)
+	default:
+		return DIDDocument{}, errDIDInvalid
+	}
+}
+
+func resolveDIDKey(did string) (DIDDocument, error) {
+	encoded := strings.TrimPrefix(did, "did:key:")
+	if !strings.HasPrefix(encoded, "z") {
+		return DIDDocument{}, fmt.Errorf("%w: expected a base58btc multibase key", errDIDInvalid)
+	}
+	key, err := parseMultibaseKey(encoded)
+	if err != nil {
+		return DIDDocument{}, err
+	}
+	method := VerificationMethod{ID: did + "#" + encoded, Type: "Multikey", Controller: did, Multibase: encoded, key: key}
+	return DIDDocument{ID: did, VerificationMethod: []VerificationMethod{method}, AssertionMethod: []string{method.ID}}, nil
+}
+
+// parseMultibaseKey decodes a base58btc multibase, multicodec-prefixed public key
+func parseMultibaseKey(encoded string) (crypto.PublicKey, error) {
+	raw, err := base58Decode(strings.TrimPrefix(encoded, "z"))
+	if err != nil || !strings.HasPrefix(encoded, "z") {
+		return nil, fmt.Errorf("%w: malformed multibase key", errDIDInvalid)
+	}
+	switch {
+	case len(raw) == 35 && string(raw[:2]) == string(multicodecP256):
+		x, y := elliptic.UnmarshalCompressed(elliptic.P256(), raw[2:])
+		if x == nil {
+			return nil, fmt.Errorf("%w: invalid P-256 point", errDIDInvalid)
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	case len(raw) == 34 && string(raw[:2]) == string(multicodecEd25519):
+		return ed25519.PublicKey(raw[2:]), nil
+	default:
+		return nil, errDIDUnsupported
+	}
+}
+
+// didWebURL maps a did:web to the URL of its document
+func didWebURL(did string) (string, error) {
+	rest, ok := strings.CutPrefix(did, "did:web:")
+	if !ok || rest == "" {
+		return "", errDIDInvalid
+	}
+	segments := strings.Split(rest, ":")
+	for i, s := range segments {
+		unescaped, err := url.PathUnescape(s)
+		if err != nil || unescaped == "" || strings.ContainsAny(unescaped, "/?#") {
+			return "", fmt.Errorf("%w: malformed did:web", errDIDInvalid)
+		}
+		segments[i] = unescaped
+	}
+	if len(segments) == 1 {
+		return "https://" + segments[0] + "/.well-known/did.json", nil
+	}
+	return "https://" + strings.Join(segments, "/") + "/did.json", nil
+}
+
+func (d *didResolver) resolveWeb(ctx context.Context, did string) (DIDDocument, error) {
+	d.mu.Lock()
+	cached, ok := d.cache[did]
+	d.mu.Unlock()
+	if ok && d.now().Sub(cached.fetched) < didCacheTTL {
+		return cached.doc, nil
+	}
+
+	docURL, err := didWebURL(did)
+	if err != nil {
+		return DIDDocument{}, err
+	}
+	var doc DIDDocument
+	if err := getProviderJSON(ctx, d.client, docURL, &doc); err != nil {
+		return DIDDocument{}, fmt.Errorf("%w: %v", errDIDUnresolved, err)
+	}
+	if doc.ID != did {
+		return DIDDocument{}, fmt.Errorf("%w: document is for %q", errDIDUnresolved, doc.ID)
+	}
+	for i := range doc.VerificationMethod {
+		m := &doc.VerificationMethod[i]
+		switch {
+		case m.PublicKeyJWK != nil:
+			m.key, err = m.PublicKeyJWK.publicKey()
+		case m.Multibase != "":
+			m.key, err = parseMultibaseKey(m.Multibase)
+		}
+		if err != nil {
+			return DIDDocument{}, fmt.Errorf("%w: method %s: %v", errDIDUnresolved, m.ID, err)
+		}
+		if strings.HasPrefix(m.ID, "#") {
+			m.ID = did + m.ID
+		}
+	}
+
+	d.mu.Lock()
+	d.cache[did] = cachedDID{doc: doc, fetched: d.now()}
+	d.mu.Unlock()
+	return doc, nil
+}
+
+func (k jwkKey) publicKey() (crypto.PublicKey, error) {
+	switch {
+	case k.Kty == "EC" && k.Crv == "P-256":
+		return jwk{Kty: k.Kty, Crv: k.Crv, X: k.X, Y: k.Y}.publicKey()
+	case k.Kty == "OKP" && k.Crv == "Ed25519":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, nil // other keys cannot be verified and are skipped
+	}
+}
+
+// verifyDIDSignature checks an ES256 (ASN.1) or Ed25519 signature over message with the key
+// of did whose fragment is kid; a document with a single key is used whatever its fragment
+func verifyDIDSignature(ctx context.Context, did, kid string, message, signature []byte) error {
+	doc, err := dids.resolve(ctx, did)
+	if err != nil {
+		return err
+	}
+	var key crypto.PublicKey
+	for _, m := range doc.VerificationMethod {
+		if _, fragment, _ := strings.Cut(m.ID, "#"); fragment == kid && m.key != nil {
+			key = m.key
+		}
+	}
+	if key == nil && len(doc.VerificationMethod) == 1 {
+		key = doc.VerificationMethod[0].key
+	}
+
+	switch pub := key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(message)
+		if ecdsa.VerifyASN1(pub, digest[:], signature) {
+			return nil
+		}
+	case ed25519.PublicKey:
+		if ed25519.Verify(pub, message, signature) {
+			return nil
+		}
+	case nil:
+		return fmt.Errorf("%w: no key %q", errDIDSignature, kid)
+	}
+	return errDIDSignature
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// base58Encode encodes data with the Bitcoin alphabet used by multibase "z"
+func base58Encode(data []byte) string {
+	n := new(big.Int).SetBytes(data)
+	radix, mod := big.NewInt(58), new(big.Int)
+	var out []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, radix, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		out = append(out, base58Alphabet[0])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+func base58Decode(s string) ([]byte, error) {
+	n := new(big.Int)
+	radix := big.NewInt(58)
+	for _, c := range s {
+		digit := strings.IndexRune(base58Alphabet, c)
+		if digit < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q", c)
+		}
+		n.Mul(n, radix).Add(n, big.NewInt(int64(digit)))
+	}
+	decoded := n.Bytes()
+	zeros := 0
+	for zeros < len(s) && s[zeros] == base58Alphabet[0] {
+		zeros++
+	}
+	return append(make([]byte, zeros), decoded...), nil
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// withIssuer installs an ephemeral signer and its did:key as the server's identity
+func withIssuer(t *testing.T) {
+	t.Helper()
+	previousSigner, previousDID := signer, issuerDID
+	t.Cleanup(func() { signer, issuerDID = previousSigner, previousDID })
+
+	var err error
+	if signer, err = newLocalSigner(mapSecrets{}); err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+	if issuerDID, err = newIssuerDID("", signer); err != nil {
+		t.Fatalf("Failed to derive the server's DID: %v", err)
+	}
+}
+
+func TestDIDKey(t *testing.T) {
+	// Ed25519 example of the did:key specification
+	doc, err := resolveDIDKey("did:key:z6MkhaXgBZDvotDkL5257faiztiGiC2QtKLGpbnnEGta2doK")
+	if err != nil {
+		t.Fatalf("Failed to resolve the Ed25519 example: %v", err)
+	}
+	if _, ok := doc.VerificationMethod[0].key.(ed25519.PublicKey); !ok {
+		t.Errorf("Expected an Ed25519 key, got %T", doc.VerificationMethod[0].key)
+	}
+
+	key := mustGenerateKey(t)
+	did := didKey(&key.PublicKey)
+	if !strings.HasPrefix(did, "did:key:zDn") {
+		t.Errorf("Expected a P-256 did:key to start with zDn, got %s", did)
+	}
+	doc, err = resolveDIDKey(did)
+	if err != nil {
+		t.Fatalf("Failed to resolve %s: %v", did, err)
+	}
+	if !key.PublicKey.Equal(doc.VerificationMethod[0].key) {
+		t.Error("Expected the did:key to resolve to the key it encodes")
+	}
+
+	for _, bad := range []string{"did:key:", "did:key:mAAAA", "did:key:z0OIl", "did:key:z" + base58Encode([]byte{0x12, 0x00, 1, 2})} {
+		if _, err := resolveDIDKey(bad); errs.Status(err) < 400 || errs.Status(err) >= 500 {
+			t.Errorf("Expected %q to be refused, got %v", bad, err)
+		}
+	}
+}
+
+func TestDIDWebURL(t *testing.T) {
+	tests := []struct {
+		did string
+		url string
+	}{
+		{"did:web:example.com", "https://example.com/.well-known/did.json"},
+		{"did:web:example.com%3A8443", "https://example.com:8443/.well-known/did.json"},
+		{"did:web:example.com:users:alice", "https://example.com/users/alice/did.json"},
+		{"did:web:", ""},
+		{"did:web:example.com::alice", ""},
+		{"did:web:example.com%2Fevil", ""},
+		{"did:key:z6Mk", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.did, func(t *testing.T) {
+			got, err := didWebURL(tt.did)
+			if tt.url == "" {
+				if !errors.Is(err, errDIDInvalid) {
+					t.Errorf("Expected an invalid did:web, got %q, %v", got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.url {
+				t.Errorf("Expected %s, got %q, %v", tt.url, got, err)
+			}
+		})
+	}
+}
+
+func TestResolveDIDWeb(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var did string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/users/alice/did.json" {
+			http.NotFound(w, r)
+			return
+		}
+		jwk, _ := publicJWK(public)
+		writeJSON(w, DIDDocument{ID: did, VerificationMethod: []VerificationMethod{
+			{ID: "#key-1", Type: "JsonWebKey2020", Controller: did, PublicKeyJWK: &jwk},
+		}})
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "https://")
+	did = "did:web:" + strings.ReplaceAll(host, ":", "%3A") + ":users:alice"
+
+	previous := dids
+	dids = newDIDResolver(server.Client(), time.Now)
+	t.Cleanup(func() { dids = previous })
+
+	message := []byte("bundle manifest")
+	signature := ed25519.Sign(private, message)
+	if err := verifyDIDSignature(context.Background(), did, "key-1", message, signature); err != nil {
+		t.Errorf("Expected the did:web signature to verify, got %v", err)
+	}
+	if err := verifyDIDSignature(context.Background(), did, "key-1", []byte("other manifest"), signature); !errors.Is(err, errDIDSignature) {
+		t.Errorf("Expected a signature over another message to fail, got %v", err)
+	}
+	if _, err := dids.resolve(context.Background(), "did:web:"+strings.ReplaceAll(host, ":", "%3A")+":users:bob"); !errors.Is(err, errDIDUnresolved) {
+		t.Errorf("Expected an unknown did:web to be unresolved, got %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/dids/x", nil)
+	req.SetPathValue("did", did)
+	resolveDIDHandler(rr, req)
+	var resolved ResolvedDID
+	if err := json.Unmarshal(rr.Body.Bytes(), &resolved); err != nil || len(resolved.VerificationMethod) != 1 ||
+		resolved.VerificationMethod[0].ID != did+"#key-1" || resolved.VerificationMethod[0].PublicKeyJWK.Crv != "Ed25519" {
+		t.Errorf("Unexpected resolution %s (%v)", rr.Body.String(), err)
+	}
+}
+
+func TestSignedBundle(t *testing.T) {
+	withIssuer(t)
+	h := NewTestHelper(t)
+	member := ProofEnvelope{Circuit: "balance", Inputs: json.RawMessage(`{"neededAmount": 100}`), Proof: json.RawMessage(`{}`)}
+
+	rr := postJSON(t, createBundle, "/bundle", ProofBundle{Header: BundleHeader{Subject: "did:key:z6MkhaXgBZDvotDkL5257faiztiGiC2QtKLGpbnnEGta2doK"}, Members: []ProofEnvelope{member}})
+	h.AssertStatusCode(rr, http.StatusOK, "creating a bundle")
+	var bundle ProofBundle
+	if err := json.Unmarshal(rr.Body.Bytes(), &bundle); err != nil {
+		t.Fatalf("Failed to decode bundle: %v", err)
+	}
+	if bundle.Header.Issuer != issuerDID || bundle.KeyID != signer.KeyID() || len(bundle.Signature) == 0 {
+		t.Fatalf("Expected the bundle to be signed by %s, got %+v", issuerDID, bundle)
+	}
+	if err := verifyDIDSignature(context.Background(), issuerDID, bundle.KeyID, []byte(bundle.Manifest), bundle.Signature); err != nil {
+		t.Errorf("Expected the signature to verify with the server's DID, got %v", err)
+	}
+
+	forged := bundle
+	forged.Signature = append([]byte(nil), bundle.Signature...)
+	forged.Signature[len(forged.Signature)-1] ^= 1
+	rr = postJSON(t, validateBundle, "/validate/bundle", forged)
+	h.AssertStatusCode(rr, http.StatusUnauthorized, "forged issuer signature")
+	if !strings.Contains(rr.Body.String(), errDIDSignature.Code) {
+		t.Errorf("Expected %s, got %s", errDIDSignature.Code, rr.Body.String())
+	}
+}
+
+func TestSignedEnvelope(t *testing.T) {
+	withIssuer(t)
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+	h.StoreBalance("envelope_user", 500)
+
+	rr := postJSON(t, generateProof, "/get/proof/neededAmount", ProofRequest{ID: "envelope_user", NeededAmount: 100})
+	h.AssertStatusCode(rr, http.StatusOK, "issuing a proof")
+	var signed ProofEnvelope
+	if err := json.Unmarshal([]byte(rr.Header().Get(signedEnvelopeHeader)), &signed); err != nil {
+		t.Fatalf("Failed to decode %s: %v", signedEnvelopeHeader, err)
+	}
+	signed.Proof = json.RawMessage(rr.Body.Bytes())
+	if signed.Issuer != issuerDID || signed.KeyID != signer.KeyID() || len(signed.Signature) == 0 {
+		t.Fatalf("Expected the issued proof to be signed by %s, got %+v", issuerDID, signed)
+	}
+	if issuer, err := checkEnvelopeSignature(context.Background(), signed); err != nil || issuer != issuerDID {
+		t.Errorf("Expected the envelope signature to verify, got %q (%v)", issuer, err)
+	}
+
+	// Bundling keeps the signature of an issued envelope and signs no member itself
+	member := ProofEnvelope{Circuit: "balance", Inputs: json.RawMessage(`{"neededAmount": 100}`), Proof: json.RawMessage(`{}`)}
+	rr = postJSON(t, createBundle, "/bundle", ProofBundle{Members: []ProofEnvelope{signed, member}})
+	h.AssertStatusCode(rr, http.StatusOK, "bundling a signed envelope")
+	var bundle ProofBundle
+	if err := json.Unmarshal(rr.Body.Bytes(), &bundle); err != nil {
+		t.Fatalf("Failed to decode bundle: %v", err)
+	}
+	if !bytes.Equal(bundle.Members[0].Signature, signed.Signature) {
+		t.Error("Expected the envelope signature to be kept")
+	}
+	if m := bundle.Members[1]; m.Issuer != "" || len(m.Signature) != 0 {
+		t.Errorf("Expected an unsigned member to stay unsigned, got %+v", m)
+	}
+
+	tampered := signed
+	tampered.Inputs = json.RawMessage(`{"neededAmount": 10}`)
+	if _, err := checkEnvelopeSignature(context.Background(), tampered); !errors.Is(err, errDIDSignature) {
+		t.Errorf("Expected %v for altered inputs, got %v", errDIDSignature, err)
+	}
+	if issuer, err := checkEnvelopeSignature(context.Background(), member); err != nil || issuer != "" {
+		t.Errorf("Expected unsigned envelopes to pass without an issuer, got %q (%v)", issuer, err)
+	}
+
+	rr = postJSON(t, validateBundle, "/validate/bundle", ProofBundle{Header: bundle.Header, Members: bundle.Members[:1], Manifest: mustManifest(t, bundle.Header, bundle.Members[:1])})
+	h.AssertStatusCode(rr, http.StatusOK, "validating an issued envelope")
+	var resp BundleValidateResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || len(resp.Members) != 1 || resp.Members[0].Issuer != issuerDID {
+		t.Errorf("Expected the member to name its issuer, got %s", rr.Body.String())
+	}
+
+	// The signature is not in the manifest, so a forged one fails the member rather than the bundle
+	forged := []ProofEnvelope{signed}
+	forged[0].Signature = append([]byte(nil), signed.Signature...)
+	forged[0].Signature[len(signed.Signature)-1] ^= 1
+	rr = postJSON(t, validateBundle, "/validate/bundle", ProofBundle{Header: bundle.Header, Members: forged, Manifest: mustManifest(t, bundle.Header, forged)})
+	h.AssertStatusCode(rr, http.StatusUnauthorized, "forged envelope signature")
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || len(resp.Members) != 1 || resp.Members[0].Error != errDIDSignature.Error() {
+		t.Errorf("Expected the member to fail with %v, got %s", errDIDSignature, rr.Body.String())
+	}
+}
+
+// mustManifest returns the manifest of an unsigned bundle of members
+func mustManifest(t *testing.T, header BundleHeader, members []ProofEnvelope) string {
+	t.Helper()
+	b := ProofBundle{Header: header, Members: members}
+	manifest, err := b.manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return manifest
+}
+
+func TestDIDDocument(t *testing.T) {
+	withIssuer(t)
+
+	rr := httptest.NewRecorder()
+	getDIDDocument(rr, httptest.NewRequest("GET", "/.well-known/did.json", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected no document for a did:key, got %d", rr.Code)
+	}
+
+	issuerDID = "did:web:zk.example"
+	rr = httptest.NewRecorder()
+	getDIDDocument(rr, httptest.NewRequest("GET", "/.well-known/did.json", nil))
+	var doc DIDDocument
+	if err := json.Unmarshal(rr.Body.Bytes(), &doc); err != nil || doc.ID != issuerDID || len(doc.AssertionMethod) != 1 ||
+		doc.VerificationMethod[0].ID != issuerDID+"#"+signer.KeyID() || rr.Header().Get("Content-Type") != "application/did+json" {
+		t.Errorf("Unexpected DID document %s (%v)", rr.Body.String(), err)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/consensys/gnark-crypto/ecc"
 	"github.com/consensys/gnark/backend/groth16"
 )
 
@@ -195,8 +196,8 @@ func TestEdgeCases(t *testing.T) {
 			name:         "Negative needed amount",
 			userID:       "negative_user",
 			balance:      100,
-			neededAmount: -10, // This should still work mathematically
-			expectError:  false,
+			neededAmount: -10, // not in the range of the comparison, so the witness is unsatisfiable
+			expectError:  true,
 		},
 	}
 
@@ -273,16 +274,17 @@ func generateProofE2E(t *testing.T, userID string, neededAmount int) (*httptest.
 		t.Fatalf("Failed to create proof request: %v", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/octet-stream")
 
 	rr := httptest.NewRecorder()
 	handler := http.HandlerFunc(generateProof)
 	handler.ServeHTTP(rr, req)
 
-	var proof groth16.Proof
+	// groth16.Proof is an interface, so the proof is read into the curve's concrete type
+	proof := groth16.NewProof(ecc.BN254)
 	if rr.Code == http.StatusOK {
-		err := json.Unmarshal(rr.Body.Bytes(), &proof)
-		if err != nil {
-			t.Fatalf("Failed to unmarshal proof response: %v", err)
+		if _, err := proof.ReadFrom(bytes.NewReader(rr.Body.Bytes())); err != nil {
+			t.Fatalf("Failed to read proof response: %v", err)
 		}
 	}
 
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Endpoint is one typed API route. The server registers its handler, and the client SDK in sdk/
+// and the OpenAPI document at /openapi.json are generated from the same definition, so an
+// endpoint added here gains a matching SDK method and OpenAPI operation.
+type Endpoint struct {
+	Name    string // SDK method and OpenAPI operation id, e.g. StoreBalance
+	Method  string
+	Path    string // ServeMux path; {wildcards} become SDK arguments
+	Summary string
+	Scope   string   // OAuth scope the route requires, if any
+	Proving bool     // behind the proof generation gate and proving quota
+	Query   []string // optional query parameters
+	Status  int      // success status; 200 when zero
+
+	Request  any // zero value of the JSON request body; nil for none
+	Response any // zero value of the JSON response body; nil for none
+	Handler  http.HandlerFunc
+}
+
+// rawJSON stands for bodies the server encodes itself, such as gnark proofs
+var rawJSON = json.RawMessage(nil)
+
+// pattern is the ServeMux pattern of e
+func (e Endpoint) pattern() string {
+	return e.Method + " " + e.Path
+}
+
+// pathParams returns the {wildcards} of e's path in order
+func (e Endpoint) pathParams() []string {
+	var params []string
+	for _, segment := range strings.Split(e.Path, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			params = append(params, strings.Trim(segment, "{}"))
+		}
+	}
+	return params
+}
+
+func (e Endpoint) status() int {
+	if e.Status == 0 {
+		return http.StatusOK
+	}
+	return e.Status
+}
+
+// handler wraps e's handler in its gate, quota and scope checks
+func (e Endpoint) handler() http.HandlerFunc {
+	h := e.Handler
+	if e.Proving {
+		// Replays of a keyed request pass neither the gate nor the meter again
+		h = idempotent(requireGate(meterProving(h)))
+	}
+	if e.Scope != "" {
+		return requireScope(e.Scope, h)
+	}
+	return identify(h)
+}
+
+// registerEndpoints adds the routes of endpoints to mux
+func registerEndpoints(mux *http.ServeMux, endpoints []Endpoint) {
+	for _, e := range endpoints {
+		mux.HandleFunc(e.pattern(), e.handler())
+	}
+}
+
+// apiEndpoints is the typed public API. Browser sign-in, JSON-RPC, streaming, binary downloads
+// and admin routes are registered by hand in main.
+func apiEndpoints() []Endpoint {
+	return []Endpoint{
+		{Name: "StoreBalance", Method: "POST", Path: "/store/sum", Summary: "Store a self-reported balance", Scope: scopeBalancesWrite, Request: BalanceRequest{}, Handler: storeBalance},
+		{Name: "StoreCreditScore", Method: "POST", Path: "/store/credit-score", Summary: "Store a credit score attribute", Scope: scopeBalancesWrite, Request: CreditScoreRequest{}, Handler: storeCreditScore},
+		{Name: "StoreAttribute", Method: "POST", Path: "/store/attribute", Summary: "Store a named attribute", Scope: scopeBalancesWrite, Request: AttributeRequest{}, Handler: storeAttribute},
+		{Name: "PutAttributes", Method: "PUT", Path: "/attributes/{userID}", Summary: "Store the typed attributes of a user", Scope: scopeBalancesWrite, Request: AttributeDocument{}, Response: AttributeDocument{}, Handler: putAttributes},
+		{Name: "GetAttributes", Method: "GET", Path: "/attributes/{userID}", Summary: "Get the typed attributes of a user", Scope: scopeBalancesRead, Response: AttributeDocument{}, Handler: getAttributes},
+		{Name: "GrantConsent", Method: "POST", Path: "/consents/{userID}", Summary: "Consent to proofs for a relying party", Scope: scopeBalancesWrite, Status: http.StatusCreated, Request: ConsentRequest{}, Response: Consent{}, Handler: grantConsent},
+		{Name: "ListConsents", Method: "GET", Path: "/consents/{userID}", Summary: "List the consents of a user", Scope: scopeBalancesRead, Response: []Consent{}, Handler: listConsents},
+		{Name: "RevokeConsent", Method: "DELETE", Path: "/consents/{userID}/{consentID}", Summary: "Revoke a consent", Scope: scopeBalancesWrite, Status: http.StatusNoContent, Handler: revokeConsent},
+		{Name: "ConnectBalance", Method: "POST", Path: "/connect/balance", Summary: "Fetch and attest a balance from the bank", Scope: scopeBalancesWrite, Request: ConnectBalanceRequest{}, Response: BalanceAttestation{}, Handler: connectBalance},
+		{Name: "GetBalanceAttestation", Method: "GET", Path: "/balances/{id}/attestation", Summary: "Get the bank attestation of a balance", Response: BalanceAttestation{}, Handler: getBalanceAttestation},
+		{Name: "PostLedgerTransaction", Method: "POST", Path: "/ledger/transactions", Summary: "Post a balanced ledger transaction", Scope: scopeBalancesWrite, Status: http.StatusCreated, Request: LedgerTransactionRequest{}, Response: LedgerTransaction{}, Handler: postLedgerTransaction},
+
+		{Name: "GetChallenge", Method: "GET", Path: "/challenge", Summary: "Get a challenge of the proof generation gate", Response: Challenge{}, Handler: getChallenge},
+		{Name: "GetUsage", Method: "GET", Path: "/usage", Summary: "Get the caller's proving usage", Response: TenantUsage{}, Handler: getUsage},
+		{Name: "ListBuckets", Method: "GET", Path: "/buckets", Summary: "List the disclosure buckets", Response: []Bucket{}, Handler: listBuckets},
+		{Name: "ListTiers", Method: "GET", Path: "/tiers", Summary: "List the balance tiers", Response: []Tier{}, Handler: listTiers},
+
+		{Name: "GenerateProof", Method: "POST", Path: "/get/proof/neededAmount", Summary: "Prove a balance covers an amount", Scope: scopeProofsGenerate, Proving: true, Request: ProofRequest{}, Response: rawJSON, Handler: generateProof},
+		{Name: "ValidateProof", Method: "POST", Path: "/validate", Summary: "Verify a balance proof", Scope: scopeProofsVerify, Request: ValidateRequest{}, Handler: validateProof},
+		{Name: "CommitThreshold", Method: "POST", Path: "/threshold/commit", Summary: "Commit to a hidden threshold", Scope: scopeProofsVerify, Request: CommitThresholdRequest{}, Response: CommitThresholdResponse{}, Handler: commitToThreshold},
+		{Name: "GenerateCommittedProof", Method: "POST", Path: "/get/proof/committed", Summary: "Prove a balance covers a committed threshold", Scope: scopeProofsGenerate, Proving: true, Request: CommittedProofRequest{}, Response: rawJSON, Handler: generateCommittedProof},
+		{Name: "ValidateCommittedProof", Method: "POST", Path: "/validate/committed", Summary: "Verify a committed threshold proof", Scope: scopeProofsVerify, Request: CommittedValidateRequest{}, Handler: validateCommittedProof},
+		{Name: "GenerateBucketProof", Method: "POST", Path: "/get/proof/bucket", Summary: "Prove the bucket a balance falls in", Scope: scopeProofsGenerate, Proving: true, Request: BucketProofRequest{}, Response: BucketProofResponse{}, Handler: generateBucketProof},
+		{Name: "ValidateBucketProof", Method: "POST", Path: "/validate/bucket", Summary: "Verify a bucket proof", Scope: scopeProofsVerify, Request: BucketValidateRequest{}, Handler: validateBucketProof},
+		{Name: "GenerateTierCertificate", Method: "POST", Path: "/get/proof/tier", Summary: "Prove the highest balance tier reached, with a signed claim", Scope: scopeProofsGenerate, Proving: true, Request: TierProofRequest{}, Response: TierCertificate{}, Handler: generateTierCertificate},
+		{Name: "ValidateTierCertificate", Method: "POST", Path: "/validate/tier", Summary: "Verify a tier certificate", Scope: scopeProofsVerify, Request: TierValidateRequest{}, Response: TierClaim{}, Handler: validateTierCertificate},
+		{Name: "GeneratePredicateProof", Method: "POST", Path: "/get/proof/predicate", Summary: "Prove a disjunction of thresholds", Scope: scopeProofsGenerate, Proving: true, Request: PredicateProofRequest{}, Response: PredicateProofResponse{}, Handler: generatePredicateProof},
+		{Name: "ValidatePredicateProof", Method: "POST", Path: "/validate/predicate", Summary: "Verify a predicate proof", Scope: scopeProofsVerify, Request: PredicateValidateRequest{}, Handler: validatePredicateProof},
+		{Name: "GenerateCompositeProof", Method: "POST", Path: "/get/proof/composite", Summary: "Prove several predicates in one proof", Scope: scopeProofsGenerate, Proving: true, Request: CompositeProofRequest{}, Response: CompositeProofResponse{}, Handler: generateCompositeProof},
+		{Name: "ValidateCompositeProof", Method: "POST", Path: "/validate/composite", Summary: "Verify a composite proof", Scope: scopeProofsVerify, Request: CompositeValidateRequest{}, Handler: validateCompositeProof},
+		{Name: "GenerateTimeLockedProof", Method: "POST", Path: "/get/proof/timelocked", Summary: "Prove a threshold that only becomes valid at notBefore", Scope: scopeProofsGenerate, Proving: true, Request: TimeLockedProofRequest{}, Response: rawJSON, Handler: generateTimeLockedProof},
+		{Name: "ValidateTimeLockedProof", Method: "POST", Path: "/validate/timelocked", Summary: "Verify a time-locked proof", Scope: scopeProofsVerify, Request: TimeLockedValidateRequest{}, Handler: validateTimeLockedProof},
+		{Name: "GenerateCircuitProof", Method: "POST", Path: "/get/proof/circuits/{name}", Summary: "Prove a registered external circuit", Scope: scopeProofsGenerate, Proving: true, Request: CircuitProofRequest{}, Response: CircuitProofResponse{}, Handler: generateCircuitProof},
+		{Name: "GenerateStatementProof", Method: "POST", Path: "/get/proof/statement/{name}", Summary: "Prove a registered statement", Scope: scopeProofsGenerate, Proving: true, Request: StatementProofRequest{}, Response: StatementProofResponse{}, Handler: generateStatementProof},
+		{Name: "ValidateStatementProof", Method: "POST", Path: "/validate/statement/{name}", Summary: "Verify a statement proof", Scope: scopeProofsVerify, Request: StatementValidateRequest{}, Handler: validateStatementProof},
+		{Name: "ValidatePolicy", Method: "POST", Path: "/validate/policy/{name}", Summary: "Verify a proof against a verification policy", Scope: scopeProofsVerify, Request: PolicyValidateRequest{}, Handler: validatePolicy},
+		{Name: "ValidateRawProof", Method: "POST", Path: "/validate/raw", Summary: "Verify a proof in another prover's format", Scope: scopeProofsVerify, Request: RawValidateRequest{}, Response: RawValidateResponse{}, Handler: validateRawProof},
+
+		{Name: "CreateBundle", Method: "POST", Path: "/bundle", Summary: "Seal proofs into a signed bundle", Scope: scopeProofsGenerate, Request: ProofBundle{}, Response: ProofBundle{}, Handler: createBundle},
+		{Name: "ValidateBundle", Method: "POST", Path: "/validate/bundle", Summary: "Verify every member of a bundle", Scope: scopeProofsVerify, Request: ProofBundle{}, Response: BundleValidateResponse{}, Handler: validateBundle},
+		{Name: "EncodeTransfer", Method: "POST", Path: "/transfer/encode", Summary: "Encode a proof envelope as QR chunks", Scope: scopeProofsGenerate, Query: []string{"chunkSize"}, Request: ProofEnvelope{}, Response: TransferEncoding{}, Handler: encodeTransferProof},
+		{Name: "DecodeTransfer", Method: "POST", Path: "/transfer/decode", Summary: "Decode QR chunks into a proof envelope", Scope: scopeProofsVerify, Request: TransferDecodeRequest{}, Response: ProofEnvelope{}, Handler: decodeTransferProof},
+
+		{Name: "GetAllowlist", Method: "GET", Path: "/allowlists/{name}", Summary: "Get the Merkle root of an allowlist", Response: AllowlistResponse{}, Handler: getAllowlist},
+		{Name: "GetPolicy", Method: "GET", Path: "/policies/{name}", Summary: "Get a verification policy", Response: Policy{}, Handler: getPolicy},
+		{Name: "GetAttributeSchema", Method: "GET", Path: "/attribute-schemas/{name}", Summary: "Get a registered attribute schema", Response: AttributeSchema{}, Handler: getAttributeSchema},
+		{Name: "GetStatement", Method: "GET", Path: "/statements/{name}", Summary: "Get a registered statement", Response: Statement{}, Handler: getStatement},
+		{Name: "GetCircuitSchema", Method: "GET", Path: "/circuits/{name}/schema", Summary: "Get the public inputs of a circuit", Query: []string{"curve"}, Response: CircuitSchema{}, Handler: getCircuitSchema},
+		{Name: "EstimateProving", Method: "GET", Path: "/circuits/{name}/estimate", Summary: "Estimate the latency and memory of proving a circuit", Query: []string{"curve"}, Response: ProvingEstimate{}, Handler: getProvingEstimate},
+		{Name: "GetSigningKey", Method: "GET", Path: "/keys/signing", Summary: "Get the server's signing key", Response: SigningKey{}, Handler: getSigningKey},
+		{Name: "GetEncryptionKey", Method: "GET", Path: "/keys/encryption", Summary: "Get the payload encryption key", Response: EncryptionKey{}, Handler: getEncryptionKey},
+		{Name: "GetDIDDocument", Method: "GET", Path: "/.well-known/did.json", Summary: "Get the server's did:web document", Response: DIDDocument{}, Handler: getDIDDocument},
+		{Name: "ResolveDID", Method: "GET", Path: "/dids/{did}", Summary: "Resolve a DID to its verification keys", Response: ResolvedDID{}, Handler: resolveDIDHandler},
+
+		{Name: "GetProofByHash", Method: "GET", Path: "/proofs/by-hash/{digest}", Summary: "Get an issued proof by its digest", Response: StoredProofResponse{}, Handler: getProofByHash},
+		{Name: "GetTreeHead", Method: "GET", Path: "/log/tree-head", Summary: "Get the signed head of the transparency log", Response: TreeHead{}, Handler: getTreeHead},
+		{Name: "GetInclusionProof", Method: "GET", Path: "/log/inclusion/{digest}", Summary: "Prove a proof is in the transparency log", Query: []string{"treeSize"}, Response: InclusionProof{}, Handler: getInclusionProof},
+		{Name: "GetConsistencyProof", Method: "GET", Path: "/log/consistency", Summary: "Prove one tree head extends another", Query: []string{"first", "second"}, Response: ConsistencyProof{}, Handler: getConsistencyProof},
+
+		{Name: "ListSubscriptions", Method: "GET", Path: "/subscriptions", Summary: "List the caller's notification subscriptions", Response: []SubscriptionStatus{}, Handler: listSubscriptions},
+		{Name: "PutSubscription", Method: "PUT", Path: "/subscriptions/{name}", Summary: "Create or replace a notification subscription", Request: Subscription{}, Response: SubscriptionStatus{}, Handler: putSubscription},
+		{Name: "DeleteSubscription", Method: "DELETE", Path: "/subscriptions/{name}", Summary: "Remove a notification subscription", Status: http.StatusNoContent, Handler: deleteSubscription},
+	}
+}
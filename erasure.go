@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// erasedAccountPrefix names the ledger account an erased user's postings are moved to. It is a
+// system account so the books still balance without it counting as a user's balance.
+const erasedAccountPrefix = systemAccountPrefix + "erased:"
+
+// ErasureReceipt is returned by POST /admin/users/{id}/erase. The server does not keep the salt:
+// whoever holds it and the user id can show that the tombstone stands for the user.
+type ErasureReceipt struct {
+	Tombstone     string    `json:"tombstone"`     // hex SHA-256 of the salt and the user id
+	Salt          string    `json:"salt"`          // hex
+	Proofs        int       `json:"proofs"`        // proofs deleted and tombstoned in the log
+	AuditEvents   int       `json:"auditEvents"`   // kept audit events rewritten
+	LedgerAccount string    `json:"ledgerAccount"` // account the user's postings were moved to
+	ErasedAt      time.Time `json:"erasedAt"`
+}
+
+// saltedHash returns the hex SHA-256 of salt followed by value
+func saltedHash(salt []byte, value string) string {
+	sum := sha256.Sum256(append(append([]byte(nil), salt...), value...))
+	return hex.EncodeToString(sum[:])
+}
+
+// eraseUser removes everything stored about a user: balances, deleted or not, attestations,
+// attributes, consents, the session and the proofs issued about them. What has to stay for the
+// books and the transparency log to remain consistent is replaced by salted hashes: ledger
+// postings move to a tombstone account, log entries and kept audit events name the proofs by
+// tombstones. Revocations are kept, as when proofs are pruned, so an erased proof presented
+// again is still rejected. Proofs issued before a restart are no longer linked to their user
+// and are left to proof retention.
+func eraseUser(ctx context.Context, id string, now time.Time) (ErasureReceipt, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return ErasureReceipt{}, err
+	}
+	receipt := ErasureReceipt{
+		Tombstone: saltedHash(salt, id),
+		Salt:      hex.EncodeToString(salt),
+		ErasedAt:  now.UTC(),
+	}
+	receipt.LedgerAccount = erasedAccountPrefix + receipt.Tombstone
+	redactions := map[string]string{id: receipt.Tombstone}
+
+	balancesMu.Lock()
+	delete(balances, id)
+	delete(balanceUpdated, id)
+	delete(balanceVersions, id)
+	delete(balanceAttestations, id)
+	delete(deletedBalances, id)
+	delete(remindedAttestations, id)
+	renameLedgerAccountLocked(id, receipt.LedgerAccount)
+	balancesMu.Unlock()
+
+	userAttributesMu.Lock()
+	delete(userAttributes, id)
+	delete(attributeDocuments, id)
+	userAttributesMu.Unlock()
+
+	consentsMu.Lock()
+	delete(consents, id)
+	consentsMu.Unlock()
+	userIssuance.forget(id)
+	probes.forget(id)
+
+	sessionsMu.Lock()
+	if key, ok := sessionUsers[id]; ok {
+		endSessionLocked(key)
+	}
+	sessionsMu.Unlock()
+
+	proofIndexMu.RLock()
+	var held []string
+	for digest, record := range proofIndex {
+		if record.Holder == id {
+			held = append(held, digest)
+		}
+	}
+	proofIndexMu.RUnlock()
+
+	var errs []error
+	for _, digest := range held {
+		// As when pruning, index entries are only dropped once the artifact is gone
+		if err := artifacts.Delete(ctx, artifactProof, digest); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", digest, err))
+			continue
+		}
+		proofIndexMu.Lock()
+		delete(proofIndex, digest)
+		proofIndexMu.Unlock()
+
+		tombstone := saltedHash(salt, digest)
+		proofLog.tombstone(digest, tombstone)
+		redactions[digest] = tombstone
+		receipt.Proofs++
+	}
+	receipt.AuditEvents = audit.redact(redactions)
+
+	audit.record(AuditEvent{Type: auditUserErased, Subject: receipt.Tombstone, Detail: fmt.Sprintf("%d proofs", receipt.Proofs)})
+	return receipt, errors.Join(errs...)
+}
+
+// renameLedgerAccountLocked moves the postings and balance of an account to another name,
+// rewriting the transactions that name it; callers must hold balancesMu
+func renameLedgerAccountLocked(from, to string) {
+	postings, ok := ledgerPostings[from]
+	if !ok {
+		return
+	}
+	for i := range ledgerTransactions {
+		for j := range ledgerTransactions[i].Entries {
+			if ledgerTransactions[i].Entries[j].Account == from {
+				ledgerTransactions[i].Entries[j].Account = to
+			}
+		}
+	}
+	ledgerPostings[to] = postings
+	ledgerBalances[to] = ledgerBalances[from]
+	delete(ledgerPostings, from)
+	delete(ledgerBalances, from)
+}
+
+// eraseUserData erases a user for a right-to-erasure request. Failing to delete some proof
+// artifacts fails the request after everything else is erased; retrying erases what is left
+// under a new tombstone.
+func eraseUserData(w http.ResponseWriter, r *http.Request) {
+	receipt, err := eraseUser(r.Context(), r.PathValue("id"), time.Now())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, receipt)
+}
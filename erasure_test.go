@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestEraseUser(t *testing.T) {
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+	t.Cleanup(h.SetupCleanBalances)
+	previousLog := proofLog
+	proofLog = newTransparencyLog()
+	t.Cleanup(func() { proofLog = previousLog })
+
+	h.AssertStatusCode(h.StoreBalance("erased_user", 500), http.StatusOK, "storing a balance")
+	h.AssertStatusCode(h.StoreBalance("kept_user", 200), http.StatusOK, "storing another balance")
+	setAttribute("erased_user", "age", 30)
+	consents["erased_user"] = []*Consent{{ID: "c1", Audience: "lender.example", Circuit: "composite", ExpiresAt: time.Now().Add(time.Hour)}}
+	t.Cleanup(func() {
+		delete(userAttributes, "erased_user")
+		delete(consents, "erased_user")
+	})
+
+	rr := postJSON(t, generateProof, "/get/proof/neededAmount", ProofRequest{ID: "erased_user", NeededAmount: 100})
+	h.AssertStatusCode(rr, http.StatusOK, "generating a proof")
+	digest := rr.Header().Get("X-Proof-Digest")
+	if digest == "" {
+		t.Fatal("Expected the proof to be persisted")
+	}
+	rr = postJSON(t, generateProof, "/get/proof/neededAmount", ProofRequest{ID: "kept_user", NeededAmount: 100})
+	kept := rr.Header().Get("X-Proof-Digest")
+	headBefore, _ := proofLog.treeHead(time.Now())
+
+	req := httptest.NewRequest("POST", "/admin/users/erased_user/erase", nil)
+	req.SetPathValue("id", "erased_user")
+	rr = httptest.NewRecorder()
+	eraseUserData(rr, req)
+	h.AssertStatusCode(rr, http.StatusOK, "erasing a user")
+	var receipt ErasureReceipt
+	if err := json.Unmarshal(rr.Body.Bytes(), &receipt); err != nil || receipt.Proofs != 1 {
+		t.Fatalf("Expected a receipt for one proof, got %s", rr.Body.String())
+	}
+	salt, _ := hex.DecodeString(receipt.Salt)
+	if saltedHash(salt, "erased_user") != receipt.Tombstone {
+		t.Error("Expected the tombstone to be the salted hash of the user id")
+	}
+
+	if _, _, exists := lookupBalance("erased_user"); exists {
+		t.Error("Expected the balance to be erased")
+	}
+	if len(attributeValues("erased_user")) != 0 || len(consents["erased_user"]) != 0 {
+		t.Error("Expected attributes and consents to be erased")
+	}
+	if _, ok := lookupProofRecord(digest); ok {
+		t.Error("Expected the proof record to be erased")
+	}
+	if _, ok := lookupProofRecord(kept); !ok {
+		t.Error("Expected the other user's proof to be kept")
+	}
+	if _, ok := ledgerPostings["erased_user"]; ok {
+		t.Error("Expected the ledger account to be renamed")
+	}
+	if ledgerBalances[receipt.LedgerAccount] != 500 {
+		t.Errorf("Expected the postings under %s, got balance %d", receipt.LedgerAccount, ledgerBalances[receipt.LedgerAccount])
+	}
+	sum := 0
+	for _, balance := range replayLedgerLocked() {
+		sum += balance
+	}
+	if sum != 0 {
+		t.Errorf("Expected the books to still balance, sum %d", sum)
+	}
+
+	// The log keeps the leaf under the proof's tombstone
+	headAfter, _ := proofLog.treeHead(time.Now())
+	if headAfter.RootHash != headBefore.RootHash {
+		t.Error("Expected erasure to leave the tree head unchanged")
+	}
+	if _, err := proofLog.inclusion(digest, 0); !errors.Is(err, errLogEntryNotFound) {
+		t.Errorf("Expected the digest to no longer find the entry, got %v", err)
+	}
+	tombstone := saltedHash(salt, digest)
+	inclusion, err := proofLog.inclusion(tombstone, 0)
+	if err != nil {
+		t.Fatalf("Expected the tombstone to find the entry, got %v", err)
+	}
+	raw, _ := hex.DecodeString(digest)
+	if leaf := leafHash(raw); inclusion.LeafHash != hex.EncodeToString(leaf[:]) {
+		t.Error("Expected the tombstoned entry to keep its leaf")
+	}
+
+	for _, e := range audit.latest(auditCapacity) {
+		if e.Digest == digest || e.Subject == "erased_user" {
+			t.Errorf("Expected audit events to no longer name the user or their proofs, got %+v", e)
+		}
+	}
+	if e := audit.latest(1)[0]; e.Type != auditUserErased || e.Subject != receipt.Tombstone {
+		t.Errorf("Expected a %s event naming the tombstone, got %+v", auditUserErased, e)
+	}
+}
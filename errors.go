@@ -0,0 +1,23 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// ErrorResponse is the body of every error response
+type ErrorResponse struct {
+	Error     string `json:"error"`
+	Code      string `json:"code"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// writeError answers with the status and error envelope that err maps to; untyped errors are 500s
+func writeError(w http.ResponseWriter, err error) {
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(errs.Status(err))
+	writeJSON(w, ErrorResponse{Error: err.Error(), Code: errs.Code(err), RequestID: w.Header().Get(requestIDHeader)})
+}
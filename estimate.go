@@ -0,0 +1,181 @@
+package main
+
+import (
+	"math/bits"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/constraint"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/korjavin/zkTest1/circuits"
+	"github.com/korjavin/zkTest1/internal/errs"
+	"github.com/korjavin/zkTest1/keys"
+)
+
+// defaultProvingPerConstraint is assumed when no proof has finished on this server yet
+const defaultProvingPerConstraint = 5 * time.Microsecond
+
+// Bases of a proving time estimate, from most to least specific
+const (
+	estimateRecent     = "recent"     // recent proofs of the circuit
+	estimateCalibrated = "calibrated" // recent proofs of other circuits, scaled by constraint count
+	estimateModel      = "model"      // constraint count alone
+)
+
+// ProvingEstimate is the expected cost of proving a circuit on this server right now
+type ProvingEstimate struct {
+	Circuit     string  `json:"circuit"`
+	Curve       string  `json:"curve"`
+	Constraints int     `json:"constraints"`
+	ProvingMs   float64 `json:"provingMs"` // once a worker is free
+	QueueMs     float64 `json:"queueMs"`   // waiting for a worker at the current load
+	MemoryBytes int64   `json:"memoryBytes"`
+	Basis       string  `json:"basis"`
+	Samples     int     `json:"samples"`             // recent proofs the estimate is based on
+	TimeoutMs   float64 `json:"timeoutMs,omitempty"` // the request timeout; 0 without one
+	Sync        bool    `json:"sync"`                // whether a proving request is expected to finish within it
+}
+
+// circuitShape is the size of a circuit's constraint system on one curve
+type circuitShape struct {
+	constraints int
+	wires       int // public, secret and internal variables
+	secret      int // secret and internal variables
+}
+
+var (
+	circuitShapes   = make(map[string]circuitShape) // by setup name
+	circuitShapesMu sync.Mutex
+)
+
+// shapeOf compiles a registered circuit for curve once and remembers its size
+func shapeOf(curve ecc.ID, name string, circuit frontend.Circuit) (circuitShape, error) {
+	key := keys.CurveName(name, curve)
+	circuitShapesMu.Lock()
+	shape, ok := circuitShapes[key]
+	circuitShapesMu.Unlock()
+	if ok {
+		return shape, nil
+	}
+
+	ccs, err := frontend.Compile(curve.ScalarField(), r1cs.NewBuilder, circuit)
+	if err != nil {
+		return circuitShape{}, err
+	}
+	shape = shapeOfSystem(ccs)
+
+	circuitShapesMu.Lock()
+	circuitShapes[key] = shape
+	circuitShapesMu.Unlock()
+	return shape, nil
+}
+
+// shapeOfSystem returns the size of a compiled constraint system
+func shapeOfSystem(ccs constraint.ConstraintSystem) circuitShape {
+	public, secret, internal := ccs.GetNbPublicVariables(), ccs.GetNbSecretVariables(), ccs.GetNbInternalVariables()
+	return circuitShape{constraints: ccs.GetNbConstraints(), wires: public + secret + internal, secret: secret + internal}
+}
+
+// memory approximates the bytes a Groth16 proof of the circuit holds at once: the proving key
+// (G1 points per wire and per FFT domain element, G2 points per wire) and the prover's
+// polynomial evaluations on the domain and its coset
+func (c circuitShape) memory(curve ecc.ID) int64 {
+	domain := int64(1) << bits.Len(uint(c.constraints))
+	g1 := int64(2 * ((curve.BaseField().BitLen() + 7) / 8))
+	g2 := 2 * g1
+	fr := int64(fieldBytes(curve))
+	provingKey := g1*(2*int64(c.wires)+int64(c.secret)+domain) + g2*int64(c.wires)
+	return provingKey + 6*domain*fr
+}
+
+// estimateProving estimates proving the circuit named setupName of the given shape from the
+// pool's recent jobs: its own when it has any, otherwise the cost per constraint of the others
+func estimateProving(status ProvingStatus, setupName string, shape circuitShape) ProvingEstimate {
+	e := ProvingEstimate{Constraints: shape.constraints}
+
+	var own, all float64
+	var ownN, allN int
+	var calibration []ProvingJob
+	for _, job := range status.Recent {
+		if job.Error != "" {
+			continue
+		}
+		all += job.ProvingMs
+		allN++
+		if job.Circuit == setupName {
+			own += job.ProvingMs
+			ownN++
+		} else {
+			calibration = append(calibration, job)
+		}
+	}
+
+	switch {
+	case ownN > 0:
+		e.ProvingMs, e.Basis, e.Samples = own/float64(ownN), estimateRecent, ownN
+	default:
+		var ms float64
+		var constraints int
+		for _, job := range calibration {
+			if n := loadedConstraints(job.Circuit); n > 0 {
+				ms += job.ProvingMs
+				constraints += n
+				e.Samples++
+			}
+		}
+		if constraints > 0 {
+			e.ProvingMs, e.Basis = ms/float64(constraints)*float64(shape.constraints), estimateCalibrated
+		} else {
+			e.ProvingMs, e.Basis = float64(time.Duration(shape.constraints)*defaultProvingPerConstraint)/float64(time.Millisecond), estimateModel
+		}
+	}
+
+	// With every worker busy, a new proof waits for the queue ahead of it to drain
+	if status.Workers > 0 && status.Busy >= status.Workers && allN > 0 {
+		e.QueueMs = (float64(status.QueueDepth)/float64(status.Workers) + 0.5) * all / float64(allN)
+	}
+	return e
+}
+
+// loadedConstraints returns the constraint count of a loaded setup, or 0
+func loadedConstraints(setupName string) int {
+	setup, ok := keyManager.loaded(setupName)
+	if !ok {
+		return 0
+	}
+	return setup.ccs.GetNbConstraints()
+}
+
+// getProvingEstimate estimates the latency and memory of proving a registered circuit on the
+// curve named by the curve query parameter, so clients can choose how to wait for a proof
+func getProvingEstimate(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	circuit, err := circuits.New(name)
+	if err != nil {
+		writeError(w, errs.Wrap(errs.NotFound, err))
+		return
+	}
+	curve, err := verifyCurve(r.URL.Query().Get("curve"), name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	shape, err := shapeOf(curve, name, circuit)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	e := estimateProving(provers.status(), keys.CurveName(name, curve), shape)
+	e.Circuit, e.Curve = name, curve.String()
+	e.MemoryBytes = shape.memory(curve)
+	e.Sync = true
+	if deadline, ok := r.Context().Deadline(); ok {
+		e.TimeoutMs = float64(time.Until(deadline).Microseconds()) / 1000
+		e.Sync = e.QueueMs+e.ProvingMs < e.TimeoutMs
+	}
+	writeJSON(w, e)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/korjavin/zkTest1/circuits"
+)
+
+func TestEstimateProving(t *testing.T) {
+	shape := circuitShape{constraints: 1000, wires: 1000, secret: 990}
+
+	t.Run("Model without recent jobs", func(t *testing.T) {
+		e := estimateProving(ProvingStatus{}, "balance", shape)
+		if e.Basis != estimateModel || e.ProvingMs != 5 || e.QueueMs != 0 {
+			t.Errorf("Expected the model estimate of 5ms, got %+v", e)
+		}
+	})
+
+	t.Run("Recent jobs of the circuit", func(t *testing.T) {
+		status := ProvingStatus{Recent: []ProvingJob{
+			{Circuit: "balance", ProvingMs: 100},
+			{Circuit: "balance", ProvingMs: 300},
+			{Circuit: "balance", ProvingMs: 5, Error: "deadline exceeded"},
+			{Circuit: "balance-bucket", ProvingMs: 1000},
+		}}
+		e := estimateProving(status, "balance", shape)
+		if e.Basis != estimateRecent || e.ProvingMs != 200 || e.Samples != 2 {
+			t.Errorf("Expected the average of two recent proofs, got %+v", e)
+		}
+	})
+
+	t.Run("Queue behind busy workers", func(t *testing.T) {
+		status := ProvingStatus{Workers: 2, Busy: 2, QueueDepth: 3, Recent: []ProvingJob{{Circuit: "balance", ProvingMs: 100}}}
+		e := estimateProving(status, "balance", shape)
+		if e.QueueMs != 200 {
+			t.Errorf("Expected a 200ms wait for 3 queued proofs on 2 workers, got %v", e.QueueMs)
+		}
+	})
+}
+
+func TestCircuitShapeMemory(t *testing.T) {
+	shape := circuitShape{constraints: 1000, wires: 1000, secret: 990}
+	bn254, bls := shape.memory(ecc.BN254), shape.memory(ecc.BLS12_381)
+	if bn254 <= 0 || bls <= bn254 {
+		t.Errorf("Expected BLS12-381 to need more memory than BN254, got %d and %d", bls, bn254)
+	}
+	bigger := circuitShape{constraints: 100000, wires: 100000, secret: 99990}
+	if bigger.memory(ecc.BN254) < 50*bn254 {
+		t.Errorf("Expected memory to grow with the constraint count")
+	}
+}
+
+func TestGetProvingEstimate(t *testing.T) {
+	estimate := func(name string, timeout time.Duration) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/circuits/"+name+"/estimate", nil)
+		req.SetPathValue("name", name)
+		if timeout > 0 {
+			ctx, cancel := context.WithTimeout(req.Context(), timeout)
+			defer cancel()
+			req = req.WithContext(ctx)
+		}
+		rr := httptest.NewRecorder()
+		getProvingEstimate(rr, req)
+		return rr
+	}
+
+	rr := estimate(circuits.BalanceName, 15*time.Second)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var e ProvingEstimate
+	if err := json.NewDecoder(rr.Body).Decode(&e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Circuit != circuits.BalanceName || e.Curve != "bn254" || e.Constraints == 0 || e.MemoryBytes == 0 {
+		t.Errorf("Unexpected estimate %+v", e)
+	}
+	if e.TimeoutMs == 0 || !e.Sync {
+		t.Errorf("Expected a small circuit to prove within the timeout, got %+v", e)
+	}
+
+	if rr := estimate(circuits.BalanceName, time.Nanosecond); rr.Code == http.StatusOK {
+		var e ProvingEstimate
+		_ = json.NewDecoder(rr.Body).Decode(&e)
+		if e.Sync {
+			t.Errorf("Expected no time left to prove synchronously, got %+v", e)
+		}
+	}
+
+	if rr := estimate("teleport", 0); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown circuit, got %d", rr.Code)
+	}
+}
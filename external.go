@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"plugin"
+	"time"
+
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/korjavin/zkTest1/circuits"
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// loadCircuitPlugins opens Go plugins, built with -buildmode=plugin against the same module
+// version, whose init functions call circuits.Register
+func loadCircuitPlugins(paths []string) error {
+	for _, path := range paths {
+		before := len(circuits.Names())
+		if _, err := plugin.Open(path); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		log.Printf("Loaded circuit plugin %s, %d circuits registered", path, len(circuits.Names())-before)
+	}
+	return nil
+}
+
+type CircuitProofRequest struct {
+	ID       string          `json:"id"`
+	Inputs   json.RawMessage `json:"inputs,omitempty"`   // public inputs, interpreted by the circuit's Assign
+	Audience string          `json:"audience,omitempty"` // relying party the proof is issued for
+}
+
+type CircuitProofResponse struct {
+	Circuit string        `json:"circuit"`
+	Proof   groth16.Proof `json:"proof"`
+}
+
+// generateCircuitProof proves a registered circuit that implements circuits.Assigner for a
+// user's stored attributes. Its proofs are verified by /validate with the circuit name and
+// the public witness returned in X-Public-Witness.
+func generateCircuitProof(w http.ResponseWriter, r *http.Request) {
+	var req CircuitProofRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := checkSessionUser(r, req.ID); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	name := r.PathValue("name")
+	if err := checkTenantAccess(r, name); err != nil {
+		writeError(w, err)
+		return
+	}
+	circuit, err := circuits.New(name)
+	if err != nil {
+		writeError(w, errs.Wrap(errs.NotFound, err))
+		return
+	}
+	assigner, ok := circuit.(circuits.Assigner)
+	if !ok {
+		writeError(w, errs.Errorf(errs.Invalid, "circuit %q cannot be proven from stored attributes", name))
+		return
+	}
+
+	if err := checkConsent(req.ID, req.Audience, name, "", time.Now()); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := checkUserIssuance(req.ID); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	attributes := attributeValues(req.ID)
+	if len(attributes) == 0 {
+		writeError(w, errs.Errorf(errs.NotFound, "no attributes stored for id"))
+		return
+	}
+	assignment, err := assigner.Assign(attributes, req.Inputs)
+	if err != nil {
+		writeError(w, errs.Wrap(errs.Unprocessable, err))
+		return
+	}
+
+	// Assign may have filled in the circuit it was called on, so set up with a fresh one
+	empty, _ := circuits.New(name)
+	curve := proofCurve(r, name)
+	setup, err := loadCurveSetup(curve, name, empty)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	proof, err := setup.prove(r.Context(), assignment)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	digest, err := persistProof(r.Context(), proof, ProofRecord{
+		Circuit:  name,
+		Curve:    recordedCurve(curve),
+		Audience: req.Audience,
+		Holder:   req.ID,
+	})
+	if err != nil {
+		log.Printf("Failed to persist proof: %v", err)
+	}
+	if digest != "" {
+		w.Header().Set("X-Proof-Digest", digest)
+	}
+	setProofHeaders(w, curve, assignment)
+	signIssuedProof(w, curve, name, req.Inputs, proof, assignment)
+
+	writeProof(w, r, proof, CircuitProofResponse{Circuit: name, Proof: proof})
+}
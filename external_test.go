@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/korjavin/zkTest1/circuits"
+)
+
+// savingsCircuit stands in for a downstream circuit: savings ≥ Minimum
+type savingsCircuit struct {
+	Savings frontend.Variable `gnark:",secret"`
+	Minimum frontend.Variable `gnark:",public"`
+}
+
+func (c *savingsCircuit) Define(api frontend.API) error {
+	api.AssertIsLessOrEqual(c.Minimum, c.Savings)
+	return nil
+}
+
+func (c *savingsCircuit) Assign(attributes map[string]int64, inputs json.RawMessage) (frontend.Circuit, error) {
+	var in struct {
+		Minimum int64 `json:"minimum"`
+	}
+	if err := json.Unmarshal(inputs, &in); err != nil {
+		return nil, err
+	}
+	savings, ok := attributes["savings"]
+	if !ok || savings < in.Minimum {
+		return nil, errors.New("savings below the minimum")
+	}
+	return &savingsCircuit{Savings: savings, Minimum: in.Minimum}, nil
+}
+
+func (c *savingsCircuit) Sample(ecc.ID) frontend.Circuit {
+	return &savingsCircuit{Savings: 2, Minimum: 1}
+}
+
+const savingsCircuitName = "test-savings"
+
+func init() {
+	if err := circuits.Register(savingsCircuitName, func() frontend.Circuit { return &savingsCircuit{} }); err != nil {
+		panic(err)
+	}
+}
+
+func TestExternalCircuit(t *testing.T) {
+	SkipIfShort(t, "external circuit proof generation")
+
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+	h.StoreBalance("ext_user", 10)
+	postJSON(t, storeAttribute, "/store/attribute", AttributeRequest{ID: "ext_user", Name: "savings", Value: 5000})
+
+	prove := func(name string, req CircuitProofRequest) (json.RawMessage, string, int) {
+		rr := postStatement(t, generateCircuitProof, "POST", name, req)
+		var resp struct {
+			Proof json.RawMessage `json:"proof"`
+		}
+		_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+		return resp.Proof, rr.Header().Get(publicWitnessHeader), rr.Code
+	}
+
+	proof, witnessHeader, status := prove(savingsCircuitName, CircuitProofRequest{ID: "ext_user", Inputs: json.RawMessage(`{"minimum": 1000}`)})
+	if status != http.StatusOK {
+		t.Fatalf("Expected the registered circuit to be proven, got %d", status)
+	}
+	publicWitness, err := base64.StdEncoding.DecodeString(witnessHeader)
+	if err != nil {
+		t.Fatalf("Failed to decode %s: %v", publicWitnessHeader, err)
+	}
+
+	rr := postJSON(t, validateProof, "/validate", ValidateRequest{Circuit: savingsCircuitName, PublicWitness: publicWitness, Proof: proof})
+	h.AssertStatusCode(rr, http.StatusOK, "validating against the public witness")
+
+	member := ProofEnvelope{Circuit: savingsCircuitName, Inputs: json.RawMessage(`{}`), Proof: proof, PublicWitness: publicWitness}
+	if err := verifyEnvelope(context.Background(), member); err != nil {
+		t.Errorf("Expected the envelope to verify, got %v", err)
+	}
+	member.PublicWitness = nil
+	if err := verifyEnvelope(context.Background(), member); err == nil {
+		t.Error("Expected an envelope without public witness to be refused")
+	}
+
+	tests := []struct {
+		name    string
+		circuit string
+		req     CircuitProofRequest
+		status  int
+	}{
+		{"Unsatisfied", savingsCircuitName, CircuitProofRequest{ID: "ext_user", Inputs: json.RawMessage(`{"minimum": 9000}`)}, http.StatusUnprocessableEntity},
+		{"No attributes", savingsCircuitName, CircuitProofRequest{ID: "nobody", Inputs: json.RawMessage(`{"minimum": 1}`)}, http.StatusNotFound},
+		{"Not an assigner", circuits.BalanceName, CircuitProofRequest{ID: "ext_user"}, http.StatusBadRequest},
+		{"Unknown circuit", "unknown", CircuitProofRequest{ID: "ext_user"}, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, status := prove(tt.circuit, tt.req); status != tt.status {
+				t.Errorf("Expected %d, got %d", tt.status, status)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// FaultConfig controls the failure-injection middleware used to exercise client retry logic
+type FaultConfig struct {
+	Paths        []string      // endpoints to inject faults on; empty means all
+	Latency      time.Duration // extra delay added before handling
+	ErrorRate    float64       // probability of replying 503 instead of handling
+	TruncateRate float64       // probability of cutting the response body short
+}
+
+// Enabled reports whether any fault is configured
+func (c FaultConfig) Enabled() bool {
+	return c.Latency > 0 || c.ErrorRate > 0 || c.TruncateRate > 0
+}
+
+func (c FaultConfig) matches(path string) bool {
+	return len(c.Paths) == 0 || slices.Contains(c.Paths, path)
+}
+
+// injectFaults wraps a handler with configurable latency, 5xx errors and truncated responses.
+// It must only be installed in dev mode.
+func injectFaults(cfg FaultConfig, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !cfg.matches(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if cfg.Latency > 0 {
+			select {
+			case <-time.After(cfg.Latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		if cfg.ErrorRate > 0 && rand.Float64() < cfg.ErrorRate {
+			w.Header().Set("X-Fault-Injected", "error")
+			http.Error(w, "injected fault", http.StatusServiceUnavailable)
+			return
+		}
+
+		if cfg.TruncateRate > 0 && rand.Float64() < cfg.TruncateRate {
+			writeTruncated(w, r, next)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeTruncated advertises the full response length, sends only half of the body
+// and then aborts the connection, so clients observe an unexpected EOF.
+func writeTruncated(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	rec := &bufferedResponse{header: http.Header{}, status: http.StatusOK}
+	next.ServeHTTP(rec, r)
+
+	for k, v := range rec.header {
+		w.Header()[k] = v
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(rec.body.Len()))
+	w.Header().Set("X-Fault-Injected", "truncate")
+	w.WriteHeader(rec.status)
+
+	if _, err := w.Write(rec.body.Bytes()[:rec.body.Len()/2]); err != nil {
+		log.Printf("Failed to write truncated response: %v", err)
+	}
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	panic(http.ErrAbortHandler)
+}
+
+// bufferedResponse captures a handler's response so it can be replayed
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header { return b.header }
+
+func (b *bufferedResponse) WriteHeader(status int) { b.status = status }
+
+func (b *bufferedResponse) Write(p []byte) (int, error) { return b.body.Write(p) }
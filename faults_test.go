@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func okHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"ok","padding":"0123456789"}`))
+	})
+}
+
+func TestInjectFaultsError(t *testing.T) {
+	handler := injectFaults(FaultConfig{
+		Paths:     []string{"/validate"},
+		ErrorRate: 1,
+	}, okHandler())
+
+	t.Run("Matching path fails", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("POST", "/validate", nil))
+
+		if rr.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, rr.Code)
+		}
+		if rr.Header().Get("X-Fault-Injected") != "error" {
+			t.Error("Expected X-Fault-Injected header")
+		}
+	})
+
+	t.Run("Other paths are untouched", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("POST", "/store/sum", nil))
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("Expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+	})
+}
+
+func TestInjectFaultsLatency(t *testing.T) {
+	latency := 50 * time.Millisecond
+	handler := injectFaults(FaultConfig{Latency: latency}, okHandler())
+
+	start := time.Now()
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/health", nil))
+
+	if elapsed := time.Since(start); elapsed < latency {
+		t.Errorf("Expected at least %v latency, got %v", latency, elapsed)
+	}
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+}
+
+func TestInjectFaultsTruncate(t *testing.T) {
+	server := httptest.NewServer(injectFaults(FaultConfig{TruncateRate: 1}, okHandler()))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/health")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.Header.Get("X-Fault-Injected") != "truncate" {
+		t.Error("Expected X-Fault-Injected header")
+	}
+	if _, err := io.ReadAll(resp.Body); err == nil {
+		t.Error("Expected reading a truncated body to fail")
+	}
+}
+
+func TestLoadConfigFaults(t *testing.T) {
+	t.Setenv("ZK_DEV_MODE", "true")
+	t.Setenv("ZK_FAULT_PATHS", "/validate, /get/proof/neededAmount")
+	t.Setenv("ZK_FAULT_LATENCY", "250ms")
+	t.Setenv("ZK_FAULT_ERROR_RATE", "0.2")
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if !cfg.DevMode || !cfg.Faults.Enabled() {
+		t.Fatalf("Expected dev mode with faults enabled, got %+v", cfg)
+	}
+	if len(cfg.Faults.Paths) != 2 || cfg.Faults.Paths[1] != "/get/proof/neededAmount" {
+		t.Errorf("Unexpected fault paths %v", cfg.Faults.Paths)
+	}
+	if cfg.Faults.Latency != 250*time.Millisecond {
+		t.Errorf("Expected 250ms latency, got %v", cfg.Faults.Latency)
+	}
+
+	t.Setenv("ZK_FAULT_ERROR_RATE", "1.5")
+	if _, err := loadConfig(); err == nil {
+		t.Error("Expected out-of-range error rate to be rejected")
+	}
+}
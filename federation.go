@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/frontend"
+	"github.com/korjavin/zkTest1/circuits"
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// keyDigestHeader carries the hex SHA-256 of a published verifying key, the value peers pin
+const keyDigestHeader = "X-Key-Digest"
+
+// maxVerifyingKeyBytes bounds a verifying key fetched from a peer
+const maxVerifyingKeyBytes = 1 << 20
+
+var (
+	errPeerNotTrusted  = errs.New(errs.Forbidden, "peer_not_trusted", "issuer is not a trusted peer for this circuit")
+	errPeerKeyMismatch = errs.New(errs.BadGateway, "peer_key_mismatch", "peer's verifying key does not match its pin")
+)
+
+// Peer is a server whose proofs this one verifies, trusted only for the verifying keys pinned to it
+type Peer struct {
+	Name string            `json:"name"`
+	URL  string            `json:"url"`
+	Pins map[string]string `json:"pins"` // circuit name to hex SHA-256 of the peer's verifying key
+}
+
+type trustedPeer struct {
+	Peer
+
+	mu   sync.Mutex
+	keys map[string]groth16.VerifyingKey // fetched keys by circuit and curve
+}
+
+var (
+	peersMu sync.RWMutex
+	peers   = make(map[string]*trustedPeer)
+
+	peerClient = &http.Client{Timeout: 10 * time.Second}
+)
+
+// getVerifyingKey publishes the binary verifying key of a circuit, so peers can verify this
+// server's proofs; X-Key-Digest is the value they pin
+func getVerifyingKey(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	circuit, err := publishedCircuit(name)
+	if err != nil {
+		writeError(w, errs.Wrap(errs.NotFound, err))
+		return
+	}
+	curve, err := verifyCurve(r.URL.Query().Get("curve"), name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	setup, err := loadCurveSetup(curve, name, circuit)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var buf bytes.Buffer
+	if _, err := setup.vk.WriteTo(&buf); err != nil {
+		writeError(w, err)
+		return
+	}
+	digest := sha256.Sum256(buf.Bytes())
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Header().Set(proofCurveHeader, setup.curve.String())
+	w.Header().Set(keyDigestHeader, hex.EncodeToString(digest[:]))
+	w.Header().Set(keyIDHeader, setup.keyID)
+	_, _ = w.Write(buf.Bytes())
+}
+
+// publishedCircuit returns an empty circuit whose verifying key can be published and pinned:
+// a registered circuit, or a composite circuit named by its predicates, e.g. "composite/age+kyc"
+func publishedCircuit(name string) (frontend.Circuit, error) {
+	if circuit, ok := compositeCircuitFor(name); ok {
+		return circuit, nil
+	}
+	return circuits.New(name)
+}
+
+// newPeer checks a peer registration
+func newPeer(name string, p Peer) (*trustedPeer, error) {
+	u, err := url.Parse(p.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("url must be an absolute http(s) URL")
+	}
+	if len(p.Pins) == 0 {
+		return nil, fmt.Errorf("at least one circuit must be pinned")
+	}
+	pins := make(map[string]string, len(p.Pins))
+	for circuit, digest := range p.Pins {
+		if _, err := publishedCircuit(circuit); err != nil {
+			return nil, fmt.Errorf("unknown circuit %q", circuit)
+		}
+		digest = strings.ToLower(digest)
+		if b, err := hex.DecodeString(digest); err != nil || len(b) != sha256.Size {
+			return nil, fmt.Errorf("pin for %s must be a hex SHA-256 digest", circuit)
+		}
+		pins[circuit] = digest
+	}
+	return &trustedPeer{
+		Peer: Peer{Name: name, URL: strings.TrimRight(p.URL, "/"), Pins: pins},
+		keys: make(map[string]groth16.VerifyingKey),
+	}, nil
+}
+
+// putPeer registers or replaces the trusted peer named in the path; replacing a peer drops
+// the keys fetched under its previous pins
+func putPeer(w http.ResponseWriter, r *http.Request) {
+	var req Peer
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	name := r.PathValue("name")
+	peer, err := newPeer(name, req)
+	if err != nil {
+		writeError(w, errs.Wrap(errs.Invalid, err))
+		return
+	}
+
+	peersMu.Lock()
+	peers[name] = peer
+	peersMu.Unlock()
+
+	audit.record(AuditEvent{Type: auditPeerUpdated, Subject: name, Detail: fmt.Sprintf("%s, %d pins", peer.URL, len(peer.Pins))})
+	writeJSON(w, peer.Peer)
+}
+
+// listPeers returns the trusted peers and their pins
+func listPeers(w http.ResponseWriter, r *http.Request) {
+	peersMu.RLock()
+	list := make([]Peer, 0, len(peers))
+	for _, p := range peers {
+		list = append(list, p.Peer)
+	}
+	peersMu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	writeJSON(w, list)
+}
+
+// deletePeer stops trusting a peer
+func deletePeer(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	peersMu.Lock()
+	_, ok := peers[name]
+	delete(peers, name)
+	peersMu.Unlock()
+
+	if !ok {
+		writeError(w, errs.Errorf(errs.NotFound, "peer %q is not registered", name))
+		return
+	}
+	audit.record(AuditEvent{Type: auditPeerRemoved, Subject: name})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// peerVerifyingKey returns a trusted peer's verifying key for circuit on curve, fetching it
+// once and only accepting it if it matches the pin
+func peerVerifyingKey(ctx context.Context, name, circuit string, curve ecc.ID) (groth16.VerifyingKey, error) {
+	peersMu.RLock()
+	peer, ok := peers[name]
+	peersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errPeerNotTrusted, name)
+	}
+	pin, ok := peer.Pins[circuit]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s is not pinned for %s", errPeerNotTrusted, name, circuit)
+	}
+
+	peer.mu.Lock()
+	defer peer.mu.Unlock()
+	cacheKey := circuit + "/" + curve.String()
+	if vk, ok := peer.keys[cacheKey]; ok {
+		return vk, nil
+	}
+
+	keyURL := peer.URL + "/keys/verifying/" + url.PathEscape(circuit) + "?curve=" + url.QueryEscape(curve.String())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, keyURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := peerClient.Do(req)
+	if err != nil {
+		return nil, errs.Wrap(errs.BadGateway, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxVerifyingKeyBytes))
+	if err != nil {
+		return nil, errs.Wrap(errs.BadGateway, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errs.Errorf(errs.BadGateway, "peer %s: %s answered %s", name, keyURL, resp.Status)
+	}
+
+	digest := sha256.Sum256(data)
+	if hex.EncodeToString(digest[:]) != pin {
+		return nil, fmt.Errorf("%w: %s for %s", errPeerKeyMismatch, name, circuit)
+	}
+	vk := groth16.NewVerifyingKey(curve)
+	if _, err := vk.ReadFrom(bytes.NewReader(data)); err != nil {
+		return nil, errs.Errorf(errs.BadGateway, "peer %s: malformed verifying key: %v", name, err)
+	}
+	peer.keys[cacheKey] = vk
+	return vk, nil
+}
+
+// verifyPeerProof verifies a proof issued by a trusted peer against its pinned verifying key
+func verifyPeerProof(ctx context.Context, issuer, circuit string, curve ecc.ID, proof groth16.Proof, public witness.Witness) error {
+	err := checkPeerProof(ctx, issuer, circuit, curve, proof, public)
+	recordVerification(circuit, proof, err)
+	return err
+}
+
+// checkPeerProof is verifyPeerProof without counting or auditing the attempt, for dry runs
+func checkPeerProof(ctx context.Context, issuer, circuit string, curve ecc.ID, proof groth16.Proof, public witness.Witness) error {
+	vk, err := peerVerifyingKey(ctx, issuer, circuit, curve)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	err = verifyGroth16(proof, vk, public)
+	timingsOf(ctx).addVerification(time.Since(start))
+	if err != nil {
+		return errInvalidProof
+	}
+	return nil
+}
+
+// verifyIssuedByPeer answers /validate for a proof a trusted peer issued
+func verifyIssuedByPeer(w http.ResponseWriter, r *http.Request, req ValidateRequest, curve ecc.ID, proof groth16.Proof) {
+	verify := verifyPeerProof
+	if req.DryRun {
+		verify = checkPeerProof
+	}
+	if req.Circuit != "" {
+		_, public, resp, err := checkedWitness(curve, req.Circuit, req.PublicWitness, time.Now())
+		if err == nil {
+			err = verify(r.Context(), req.Issuer, req.Circuit, curve, proof, public)
+		}
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, resp)
+		return
+	}
+
+	assignment := &circuits.BalanceCircuit{NeededAmount: req.NeededAmount}
+	if err := checkPublicWitness(curve, req.PublicWitness, assignment); err != nil {
+		writeError(w, err)
+		return
+	}
+	public, err := frontend.NewWitness(assignment, curve.ScalarField(), frontend.PublicOnly())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := verify(r.Context(), req.Issuer, balanceCircuitName, curve, proof, public); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/korjavin/zkTest1/circuits"
+)
+
+// fakePeer is a peer server with its own balance circuit setup, serving its verifying key
+func fakePeer(t *testing.T) (url, digest string, proof json.RawMessage) {
+	t.Helper()
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &circuits.BalanceCircuit{})
+	if err != nil {
+		t.Fatalf("Failed to compile circuit: %v", err)
+	}
+	pk, vk, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatalf("Failed to setup: %v", err)
+	}
+	witness, err := frontend.NewWitness(&circuits.BalanceCircuit{Balance: 150, NeededAmount: 100}, ecc.BN254.ScalarField())
+	if err != nil {
+		t.Fatalf("Failed to create witness: %v", err)
+	}
+	p, err := groth16.Prove(ccs, pk, witness)
+	if err != nil {
+		t.Fatalf("Failed to generate proof: %v", err)
+	}
+	if proof, err = json.Marshal(p); err != nil {
+		t.Fatal(err)
+	}
+
+	var key bytes.Buffer
+	if _, err := vk.WriteTo(&key); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(key.Bytes())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/keys/verifying/balance" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(key.Bytes())
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, hex.EncodeToString(sum[:]), proof
+}
+
+// withPeers starts each test from an empty trust registry
+func withPeers(t *testing.T) {
+	t.Helper()
+	peersMu.Lock()
+	previous := peers
+	peers = make(map[string]*trustedPeer)
+	peersMu.Unlock()
+	t.Cleanup(func() {
+		peersMu.Lock()
+		peers = previous
+		peersMu.Unlock()
+	})
+}
+
+func registerPeer(t *testing.T, name string, peer Peer) *httptest.ResponseRecorder {
+	t.Helper()
+	body, _ := json.Marshal(peer)
+	req := httptest.NewRequest("PUT", "/admin/peers/"+name, bytes.NewReader(body))
+	req.SetPathValue("name", name)
+	rr := httptest.NewRecorder()
+	putPeer(rr, req)
+	return rr
+}
+
+func TestPutPeer(t *testing.T) {
+	withPeers(t)
+	h := NewTestHelper(t)
+	pin := strings.Repeat("ab", 32)
+
+	tests := []struct {
+		name   string
+		peer   Peer
+		status int
+	}{
+		{"Valid", Peer{URL: "https://zk.example/", Pins: map[string]string{"balance": pin}}, http.StatusOK},
+		{"Relative URL", Peer{URL: "zk.example", Pins: map[string]string{"balance": pin}}, http.StatusBadRequest},
+		{"Other scheme", Peer{URL: "ftp://zk.example", Pins: map[string]string{"balance": pin}}, http.StatusBadRequest},
+		{"No pins", Peer{URL: "https://zk.example"}, http.StatusBadRequest},
+		{"Unknown circuit", Peer{URL: "https://zk.example", Pins: map[string]string{"nope": pin}}, http.StatusBadRequest},
+		{"Short pin", Peer{URL: "https://zk.example", Pins: map[string]string{"balance": "abcd"}}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h.AssertStatusCode(registerPeer(t, "acme", tt.peer), tt.status, tt.name)
+		})
+	}
+
+	rr := httptest.NewRecorder()
+	listPeers(rr, httptest.NewRequest("GET", "/admin/peers", nil))
+	var list []Peer
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil || len(list) != 1 || list[0].URL != "https://zk.example" {
+		t.Errorf("Expected the one valid peer, got %s (%v)", rr.Body.String(), err)
+	}
+
+	for _, status := range []int{http.StatusNoContent, http.StatusNotFound} {
+		req := httptest.NewRequest("DELETE", "/admin/peers/acme", nil)
+		req.SetPathValue("name", "acme")
+		rr = httptest.NewRecorder()
+		deletePeer(rr, req)
+		h.AssertStatusCode(rr, status, "removing a peer")
+	}
+}
+
+func TestValidatePeerProof(t *testing.T) {
+	SkipIfShort(t, "peer proof generation")
+	withPeers(t)
+	h := NewTestHelper(t)
+	url, digest, proof := fakePeer(t)
+
+	h.AssertStatusCode(registerPeer(t, "acme", Peer{URL: url, Pins: map[string]string{"balance": digest}}), http.StatusOK, "trusting acme")
+	h.AssertStatusCode(registerPeer(t, "impostor", Peer{URL: url, Pins: map[string]string{"balance": strings.Repeat("00", 32)}}), http.StatusOK, "trusting impostor")
+	h.AssertStatusCode(registerPeer(t, "partial", Peer{URL: url, Pins: map[string]string{circuits.BucketName: digest}}), http.StatusOK, "trusting partial")
+
+	tests := []struct {
+		name   string
+		req    ValidateRequest
+		status int
+		code   string
+	}{
+		{"Trusted peer", ValidateRequest{NeededAmount: 100, Proof: proof, Issuer: "acme"}, http.StatusOK, ""},
+		{"Other amount", ValidateRequest{NeededAmount: 101, Proof: proof, Issuer: "acme"}, http.StatusUnauthorized, "proof_invalid"},
+		{"Pin mismatch", ValidateRequest{NeededAmount: 100, Proof: proof, Issuer: "impostor"}, http.StatusBadGateway, "peer_key_mismatch"},
+		{"Circuit not pinned", ValidateRequest{NeededAmount: 100, Proof: proof, Issuer: "partial"}, http.StatusForbidden, "peer_not_trusted"},
+		{"Unknown issuer", ValidateRequest{NeededAmount: 100, Proof: proof, Issuer: "stranger"}, http.StatusForbidden, "peer_not_trusted"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := postJSON(t, validateProof, "/validate", tt.req)
+			h.AssertStatusCode(rr, tt.status, tt.name)
+			if tt.code != "" && !strings.Contains(rr.Body.String(), tt.code) {
+				t.Errorf("Expected %s, got %s", tt.code, rr.Body.String())
+			}
+		})
+	}
+
+	// Without an issuer the proof is checked against this server's own key
+	rr := postJSON(t, validateProof, "/validate", ValidateRequest{NeededAmount: 100, Proof: proof})
+	if rr.Code == http.StatusOK {
+		t.Error("Expected a peer's proof not to verify under this server's key")
+	}
+}
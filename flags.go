@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// Experimental capabilities that are off unless enabled with ZK_FEATURES or PUT /admin/flags/{name}
+const (
+	flagPlonk       = "plonk"
+	flagRecursion   = "recursion"
+	flagWASMProving = "wasm-proving"
+)
+
+// knownFlags describes every feature flag
+var knownFlags = map[string]string{
+	flagPlonk:       "PLONK proving and verification alongside Groth16",
+	flagRecursion:   "Recursive verification of proofs inside other circuits",
+	flagWASMProving: "Client-side proving with the circuit compiled to WebAssembly",
+}
+
+// FeatureFlag is the state of one flag as reported by the admin API
+type FeatureFlag struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Enabled     bool   `json:"enabled"`
+}
+
+type FlagRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+// featureFlags holds the enabled state of the known flags; it can change at runtime
+type featureFlags struct {
+	mu      sync.RWMutex
+	enabled map[string]bool
+}
+
+var flags = &featureFlags{enabled: make(map[string]bool)}
+
+// newFeatureFlags enables the named flags, rejecting names that are not known
+func newFeatureFlags(names []string) (*featureFlags, error) {
+	f := &featureFlags{enabled: make(map[string]bool)}
+	for _, name := range names {
+		if err := f.set(name, true); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (f *featureFlags) set(name string, enabled bool) error {
+	if _, ok := knownFlags[name]; !ok {
+		return fmt.Errorf("unknown feature flag %q", name)
+	}
+	f.mu.Lock()
+	f.enabled[name] = enabled
+	f.mu.Unlock()
+	return nil
+}
+
+func (f *featureFlags) isEnabled(name string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.enabled[name]
+}
+
+// list returns all known flags sorted by name
+func (f *featureFlags) list() []FeatureFlag {
+	out := make([]FeatureFlag, 0, len(knownFlags))
+	for name, description := range knownFlags {
+		out = append(out, FeatureFlag{Name: name, Description: description, Enabled: f.isEnabled(name)})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// requireFlag answers 404 for requests to an endpoint whose feature flag is off
+func requireFlag(name string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !flags.isEnabled(name) {
+			writeError(w, errs.Errorf(errs.NotFound, "experimental feature %q is disabled", name))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// notImplemented answers 501 for an enabled experimental feature this build does not provide yet
+func notImplemented(name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, errs.Errorf(errs.NotImplemented, "experimental feature %q is not implemented in this build", name))
+	}
+}
+
+func listFlags(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, flags.list())
+}
+
+// putFlag turns a feature flag on or off at runtime
+func putFlag(w http.ResponseWriter, r *http.Request) {
+	var req FlagRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	name := r.PathValue("name")
+	if err := flags.set(name, req.Enabled); err != nil {
+		writeError(w, errs.Wrap(errs.NotFound, err))
+		return
+	}
+
+	audit.record(AuditEvent{Type: auditFlagUpdated, Subject: name, Detail: "enabled=" + strconv.FormatBool(req.Enabled)})
+
+	writeJSON(w, FeatureFlag{Name: name, Description: knownFlags[name], Enabled: req.Enabled})
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewFeatureFlags(t *testing.T) {
+	f, err := newFeatureFlags([]string{flagPlonk})
+	if err != nil {
+		t.Fatalf("newFeatureFlags failed: %v", err)
+	}
+	if !f.isEnabled(flagPlonk) || f.isEnabled(flagRecursion) {
+		t.Errorf("Expected only %s to be enabled, got %+v", flagPlonk, f.list())
+	}
+	if len(f.list()) != len(knownFlags) {
+		t.Errorf("Expected every known flag to be listed, got %d", len(f.list()))
+	}
+
+	if _, err := newFeatureFlags([]string{"teleport"}); err == nil {
+		t.Error("Expected an unknown flag to be rejected")
+	}
+}
+
+func TestRequireFlag(t *testing.T) {
+	previous := flags
+	flags = &featureFlags{enabled: make(map[string]bool)}
+	t.Cleanup(func() { flags = previous })
+
+	handler := requireFlag(flagRecursion, notImplemented(flagRecursion))
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest("POST", "/get/proof/recursive", nil))
+	if rr.Code != http.StatusNotFound || !strings.Contains(rr.Body.String(), "disabled") {
+		t.Errorf("Expected 404 while the flag is off, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	req := httptest.NewRequest("PUT", "/admin/flags/recursion", bytes.NewBufferString(`{"enabled": true}`))
+	req.SetPathValue("name", flagRecursion)
+	rr = httptest.NewRecorder()
+	putFlag(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected the flag to be enabled, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handler(rr, httptest.NewRequest("POST", "/get/proof/recursive", nil))
+	if rr.Code != http.StatusNotImplemented {
+		t.Errorf("Expected 501 once the flag is on, got %d", rr.Code)
+	}
+
+	req = httptest.NewRequest("PUT", "/admin/flags/teleport", bytes.NewBufferString(`{"enabled": true}`))
+	req.SetPathValue("name", "teleport")
+	rr = httptest.NewRecorder()
+	putFlag(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown flag, got %d", rr.Code)
+	}
+}
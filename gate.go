@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// captchaSecret is the server-side secret of the CAPTCHA provider
+const captchaSecret = "captcha-secret"
+
+var (
+	errGateRequired  = errs.New(errs.Forbidden, "gate_required", "proof generation requires a solved challenge, see GET /challenge")
+	errGateFailed    = errs.New(errs.Forbidden, "gate_failed", "challenge solution rejected")
+	errCaptchaFailed = errs.New(errs.Forbidden, "captcha_failed", "captcha verification failed")
+)
+
+// GateConfig selects the optional anti-abuse gate in front of proof generation
+type GateConfig struct {
+	Mode         string        // "" (off), "pow" or "captcha"
+	Difficulty   int           // pow: required leading zero bits of SHA-256(challenge ":" nonce)
+	ChallengeTTL time.Duration // pow: how long a challenge can be solved
+	CaptchaURL   string        // captcha: siteverify endpoint; hCaptcha, reCAPTCHA and Turnstile share its API
+	HTTPTimeout  time.Duration
+}
+
+// ProofGate decides whether a proving request may proceed.
+// It returns errGateRequired when the request carries no solution.
+type ProofGate interface {
+	Check(r *http.Request) error
+}
+
+// proofGate is the configured gate; nil lets every proving request through
+var proofGate ProofGate
+
+func newProofGate(cfg GateConfig, p SecretProvider) (ProofGate, error) {
+	switch cfg.Mode {
+	case "":
+		return nil, nil
+	case "pow":
+		if cfg.Difficulty < 1 || cfg.Difficulty > 32 {
+			return nil, fmt.Errorf("proof-of-work difficulty must be between 1 and 32 bits, got %d", cfg.Difficulty)
+		}
+		return newPowGate(cfg.Difficulty, cfg.ChallengeTTL, nonces, time.Now), nil
+	case "captcha":
+		secret, err := p.Secret(context.Background(), captchaSecret)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", captchaSecret, err)
+		}
+		if cfg.CaptchaURL == "" {
+			return nil, errors.New("captcha gate needs a siteverify URL")
+		}
+		return &captchaGate{validator: &siteVerifyValidator{
+			url:    cfg.CaptchaURL,
+			secret: secret,
+			client: &http.Client{Timeout: cfg.HTTPTimeout},
+		}}, nil
+	default:
+		return nil, fmt.Errorf("unknown proof gate %q", cfg.Mode)
+	}
+}
+
+// Challenge is returned by GET /challenge
+type Challenge struct {
+	Mode       string    `json:"mode"` // "none", "pow" or "captcha"
+	Challenge  string    `json:"challenge,omitempty"`
+	Difficulty int       `json:"difficulty,omitempty"`
+	ExpiresAt  time.Time `json:"expiresAt,omitempty"`
+}
+
+// powGate hands out single-use challenges; a solution is a nonce such that
+// SHA-256(challenge ":" nonce) starts with difficulty zero bits
+type powGate struct {
+	difficulty int
+	ttl        time.Duration
+	store      NonceStore // open challenges
+	now        func() time.Time
+}
+
+func newPowGate(difficulty int, ttl time.Duration, store NonceStore, now func() time.Time) *powGate {
+	return &powGate{difficulty: difficulty, ttl: ttl, store: store, now: now}
+}
+
+func (g *powGate) issue(ctx context.Context) (Challenge, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return Challenge{}, err
+	}
+	c := Challenge{Mode: "pow", Challenge: hex.EncodeToString(b[:]), Difficulty: g.difficulty, ExpiresAt: g.now().Add(g.ttl)}
+	if _, err := g.store.Put(ctx, noncePoW+c.Challenge, nil, c.ExpiresAt); err != nil {
+		return Challenge{}, err
+	}
+	return c, nil
+}
+
+// Check reads "<challenge>:<nonce>" from the X-PoW-Solution header
+func (g *powGate) Check(r *http.Request) error {
+	solution := r.Header.Get("X-PoW-Solution")
+	if solution == "" {
+		return errGateRequired
+	}
+	challenge, _, ok := strings.Cut(solution, ":")
+	if !ok {
+		return errGateFailed
+	}
+
+	// Challenges are single-use, even when the solution is wrong
+	_, open, err := g.store.Take(r.Context(), noncePoW+challenge)
+	if err != nil {
+		return err
+	}
+	if !open {
+		return errGateFailed
+	}
+	sum := sha256.Sum256([]byte(solution))
+	if leadingZeroBits(sum[:]) < g.difficulty {
+		return errGateFailed
+	}
+	return nil
+}
+
+func leadingZeroBits(b []byte) int {
+	n := 0
+	for _, x := range b {
+		if x != 0 {
+			return n + bits.LeadingZeros8(x)
+		}
+		n += 8
+	}
+	return n
+}
+
+// CaptchaValidator checks a CAPTCHA response token with its provider
+type CaptchaValidator interface {
+	Validate(ctx context.Context, token, remoteIP string) error
+}
+
+// captchaGate passes requests whose X-Captcha-Token the validator accepts
+type captchaGate struct {
+	validator CaptchaValidator
+}
+
+func (g *captchaGate) Check(r *http.Request) error {
+	token := r.Header.Get("X-Captcha-Token")
+	if token == "" {
+		return errGateRequired
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return g.validator.Validate(r.Context(), token, ip)
+}
+
+// siteVerifyValidator posts the token to a siteverify endpoint
+type siteVerifyValidator struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+func (v *siteVerifyValidator) Validate(ctx context.Context, token, remoteIP string) error {
+	form := url.Values{"secret": {v.secret}, "response": {token}, "remoteip": {remoteIP}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("captcha siteverify: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&out); err != nil {
+		return fmt.Errorf("captcha siteverify: %w", err)
+	}
+	if !out.Success {
+		return errCaptchaFailed
+	}
+	return nil
+}
+
+// requireGate runs the configured proof gate before an expensive proving handler
+func requireGate(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if proofGate != nil {
+			err := proofGate.Check(r)
+			switch {
+			case errors.Is(err, errGateRequired), errors.Is(err, errGateFailed), errors.Is(err, errCaptchaFailed):
+				writeError(w, err)
+				return
+			case err != nil:
+				writeError(w, errs.Wrap(errs.BadGateway, err))
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// getChallenge tells clients which gate is active and issues a proof-of-work challenge
+func getChallenge(w http.ResponseWriter, r *http.Request) {
+	switch g := proofGate.(type) {
+	case nil:
+		writeJSON(w, Challenge{Mode: "none"})
+	case *powGate:
+		c, err := g.issue(r.Context())
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, c)
+	default:
+		writeJSON(w, Challenge{Mode: "captcha"})
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// solvePoW finds a nonce for a challenge by brute force, like a client would
+func solvePoW(t *testing.T, challenge string, difficulty int) string {
+	t.Helper()
+	for nonce := 0; nonce < 1<<24; nonce++ {
+		solution := challenge + ":" + strconv.Itoa(nonce)
+		sum := sha256.Sum256([]byte(solution))
+		if leadingZeroBits(sum[:]) >= difficulty {
+			return solution
+		}
+	}
+	t.Fatal("no proof-of-work solution found")
+	return ""
+}
+
+func gatedRequest(header, value string) *http.Request {
+	req := httptest.NewRequest("POST", "/get/proof/neededAmount", nil)
+	if value != "" {
+		req.Header.Set(header, value)
+	}
+	return req
+}
+
+func TestLeadingZeroBits(t *testing.T) {
+	tests := []struct {
+		in   []byte
+		want int
+	}{
+		{[]byte{0x80}, 0},
+		{[]byte{0x01}, 7},
+		{[]byte{0x00, 0x10}, 11},
+		{[]byte{0x00, 0x00}, 16},
+	}
+	for _, tt := range tests {
+		if got := leadingZeroBits(tt.in); got != tt.want {
+			t.Errorf("leadingZeroBits(%x) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPowGate(t *testing.T) {
+	now := time.Now()
+	clock := func() time.Time { return now }
+	store := newMemoryNonceStore(100, clock)
+	gate := newPowGate(8, time.Minute, store, clock)
+
+	c, err := gate.issue(context.Background())
+	if err != nil {
+		t.Fatalf("issue failed: %v", err)
+	}
+	solution := solvePoW(t, c.Challenge, c.Difficulty)
+
+	if err := gate.Check(gatedRequest("X-PoW-Solution", "")); err != errGateRequired {
+		t.Errorf("Expected errGateRequired without a solution, got %v", err)
+	}
+	if err := gate.Check(gatedRequest("X-PoW-Solution", solution)); err != nil {
+		t.Errorf("Expected the solution to pass, got %v", err)
+	}
+	if err := gate.Check(gatedRequest("X-PoW-Solution", solution)); err != errGateFailed {
+		t.Errorf("Expected a reused challenge to fail, got %v", err)
+	}
+
+	expired, _ := gate.issue(context.Background())
+	expiredSolution := solvePoW(t, expired.Challenge, expired.Difficulty)
+	now = now.Add(2 * time.Minute)
+	if err := gate.Check(gatedRequest("X-PoW-Solution", expiredSolution)); err != errGateFailed {
+		t.Errorf("Expected an expired challenge to fail, got %v", err)
+	}
+
+	_, _ = gate.issue(context.Background())
+	if removed := store.sweep(now.Add(2 * time.Minute)); removed != 1 {
+		t.Errorf("Expected 1 expired challenge swept, got %d", removed)
+	}
+}
+
+type fakeCaptcha struct{ valid string }
+
+func (f fakeCaptcha) Validate(_ context.Context, token, remoteIP string) error {
+	if token != f.valid {
+		return errCaptchaFailed
+	}
+	return nil
+}
+
+func TestRequireGate(t *testing.T) {
+	previous := proofGate
+	proofGate = &captchaGate{validator: fakeCaptcha{valid: "human"}}
+	t.Cleanup(func() { proofGate = previous })
+
+	handler := requireGate(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+
+	tests := []struct {
+		name           string
+		token          string
+		expectedStatus int
+	}{
+		{"Missing token", "", http.StatusForbidden},
+		{"Rejected token", "robot", http.StatusForbidden},
+		{"Accepted token", "human", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler(rr, gatedRequest("X-Captcha-Token", tt.token))
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestSiteVerifyValidator(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("secret") != "s3cret" {
+			t.Errorf("Expected the captcha secret to be sent, got %q", r.FormValue("secret"))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.FormValue("response") == "human" {
+			_, _ = w.Write([]byte(`{"success": true}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"success": false, "error-codes": ["invalid-input-response"]}`))
+	}))
+	defer server.Close()
+
+	gate, err := newProofGate(GateConfig{Mode: "captcha", CaptchaURL: server.URL, HTTPTimeout: time.Second}, mapSecrets{captchaSecret: "s3cret"})
+	if err != nil {
+		t.Fatalf("newProofGate failed: %v", err)
+	}
+	if err := gate.Check(gatedRequest("X-Captcha-Token", "human")); err != nil {
+		t.Errorf("Expected the token to verify, got %v", err)
+	}
+	if err := gate.Check(gatedRequest("X-Captcha-Token", "robot")); err != errCaptchaFailed {
+		t.Errorf("Expected errCaptchaFailed, got %v", err)
+	}
+}
+
+func TestNewProofGateConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     GateConfig
+		wantErr bool
+	}{
+		{"Disabled", GateConfig{}, false},
+		{"Proof of work", GateConfig{Mode: "pow", Difficulty: 16}, false},
+		{"Difficulty out of range", GateConfig{Mode: "pow", Difficulty: 64}, true},
+		{"Captcha without URL", GateConfig{Mode: "captcha"}, true},
+		{"Unknown mode", GateConfig{Mode: "riddle"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newProofGate(tt.cfg, mapSecrets{captchaSecret: "s3cret"})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newProofGate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
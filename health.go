@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// dependencyCheckTimeout bounds each live dependency check
+const dependencyCheckTimeout = 3 * time.Second
+
+// DependencyStatus is the outcome of the latest check of one dependency.
+// The last error is kept after the dependency recovers so flapping stays visible.
+type DependencyStatus struct {
+	Name        string     `json:"name"`
+	OK          bool       `json:"ok"`
+	LatencyMs   float64    `json:"latencyMs"`
+	CheckedAt   time.Time  `json:"checkedAt"`
+	LastError   string     `json:"lastError,omitempty"`
+	LastErrorAt *time.Time `json:"lastErrorAt,omitempty"`
+}
+
+type dependencyCheck struct {
+	name   string
+	check  func(ctx context.Context) error
+	status DependencyStatus
+}
+
+// dependencyChecks runs live checks of the services the server depends on
+type dependencyChecks struct {
+	mu     sync.Mutex
+	checks []*dependencyCheck
+}
+
+var dependencies = &dependencyChecks{}
+
+// register adds a named check; registering a name again replaces its check
+func (d *dependencyChecks) register(name string, check func(ctx context.Context) error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, c := range d.checks {
+		if c.name == name {
+			c.check = check
+			return
+		}
+	}
+	d.checks = append(d.checks, &dependencyCheck{name: name, check: check, status: DependencyStatus{Name: name}})
+	sort.Slice(d.checks, func(i, j int) bool { return d.checks[i].name < d.checks[j].name })
+}
+
+// run checks every dependency concurrently and returns their statuses
+func (d *dependencyChecks) run() []DependencyStatus {
+	d.mu.Lock()
+	checks := append([]*dependencyCheck(nil), d.checks...)
+	d.mu.Unlock()
+
+	var wg sync.WaitGroup
+	results := make([]error, len(checks))
+	latencies := make([]time.Duration, len(checks))
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			results[i] = runWithTimeout(c.check, dependencyCheckTimeout)
+			latencies[i] = time.Since(start)
+		}()
+	}
+	wg.Wait()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	statuses := make([]DependencyStatus, len(checks))
+	for i, c := range checks {
+		now := time.Now().UTC()
+		c.status.OK = results[i] == nil
+		c.status.LatencyMs = float64(latencies[i].Microseconds()) / 1000
+		c.status.CheckedAt = now
+		if results[i] != nil {
+			c.status.LastError = results[i].Error()
+			c.status.LastErrorAt = &now
+		}
+		statuses[i] = c.status
+	}
+	return statuses
+}
+
+// runWithTimeout runs check with a context that expires after timeout, giving up at that point
+// even if the check ignores its context
+func runWithTimeout(check func(ctx context.Context) error, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- check(ctx) }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ReadinessResponse is returned by GET /ready
+type ReadinessResponse struct {
+	Ready        bool               `json:"ready"`
+	Dependencies []DependencyStatus `json:"dependencies"`
+}
+
+// readiness reports 503 while any dependency check fails
+func readiness(w http.ResponseWriter, r *http.Request) {
+	resp := ReadinessResponse{Ready: true, Dependencies: dependencies.run()}
+	for _, s := range resp.Dependencies {
+		if !s.OK {
+			resp.Ready = false
+		}
+	}
+
+	if !resp.Ready {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	writeJSON(w, resp)
+}
+
+// registerDependencyChecks wires the live checks for the configured backends
+func registerDependencyChecks(bus MessageBus) {
+	dependencies.register("storage", func(ctx context.Context) error { return artifacts.Ping(ctx) })
+	dependencies.register("keys", func(context.Context) error { return keyManager.Check() })
+	dependencies.register("nonces", func(ctx context.Context) error { return nonces.Ping(ctx) })
+	if bus != nil {
+		dependencies.register("queue", func(context.Context) error { return bus.Ping() })
+	}
+}
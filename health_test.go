@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func withDependencies(t *testing.T) *dependencyChecks {
+	t.Helper()
+	previous := dependencies
+	dependencies = &dependencyChecks{}
+	t.Cleanup(func() { dependencies = previous })
+	return dependencies
+}
+
+func TestReadiness(t *testing.T) {
+	deps := withDependencies(t)
+
+	var storageErr error = errors.New("connection refused")
+	deps.register("storage", func(context.Context) error { return storageErr })
+	deps.register("keys", func(context.Context) error { return nil })
+
+	check := func(expectedStatus int) ReadinessResponse {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		readiness(rr, httptest.NewRequest("GET", "/ready", nil))
+		if rr.Code != expectedStatus {
+			t.Fatalf("Expected status %d, got %d", expectedStatus, rr.Code)
+		}
+		var resp ReadinessResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return resp
+	}
+
+	resp := check(http.StatusServiceUnavailable)
+	if resp.Ready || len(resp.Dependencies) != 2 {
+		t.Fatalf("Unexpected readiness report: %+v", resp)
+	}
+	if resp.Dependencies[1].Name != "storage" || resp.Dependencies[1].LastError != "connection refused" {
+		t.Errorf("Expected storage failure to be reported, got %+v", resp.Dependencies[1])
+	}
+
+	storageErr = nil
+	resp = check(http.StatusOK)
+	storage := resp.Dependencies[1]
+	if !storage.OK || storage.LastError == "" || storage.LastErrorAt == nil {
+		t.Errorf("Expected recovered storage to keep its last error, got %+v", storage)
+	}
+}
+
+func TestDependencyCheckTimeout(t *testing.T) {
+	err := runWithTimeout(func(context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}, 10*time.Millisecond)
+	if err == nil {
+		t.Error("Expected a slow check to time out")
+	}
+
+	err = runWithTimeout(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, 10*time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the check context to expire, got %v", err)
+	}
+}
+
+func TestFileArtifactStorePing(t *testing.T) {
+	store, err := newFileArtifactStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	if err := store.Ping(context.Background()); err != nil {
+		t.Errorf("Expected ping to succeed, got %v", err)
+	}
+
+	store.dir = store.dir + "/missing"
+	if err := store.Ping(context.Background()); err == nil {
+		t.Error("Expected ping of a missing directory to fail")
+	}
+}
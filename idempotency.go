@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLen     = 255
+	// maxIdempotentResponse bounds the responses kept for replay; larger ones release their key
+	maxIdempotentResponse = 64 << 10
+)
+
+// idempotencyTTL is how long the response to a request with an Idempotency-Key is replayed
+var idempotencyTTL = 24 * time.Hour
+
+var (
+	errIdempotencyKeyReused  = errs.New(errs.Unprocessable, "idempotency_key_reused", "the Idempotency-Key was used with another request body")
+	errIdempotencyInProgress = errs.New(errs.Conflict, "idempotency_in_progress", "a request with this Idempotency-Key is still being processed")
+)
+
+// idempotentResponse is the stored answer to a request with an Idempotency-Key
+type idempotentResponse struct {
+	Request string      `json:"request"` // digest of the request body
+	Status  int         `json:"status"`
+	Header  http.Header `json:"header"`
+	Body    []byte      `json:"body"`
+}
+
+// idempotencyRecorder writes a response through and keeps a copy of it to replay
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	status   int
+	header   http.Header // as the status was written
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (r *idempotencyRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+		r.header = r.ResponseWriter.Header().Clone()
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *idempotencyRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.WriteHeader(http.StatusOK)
+	}
+	if r.body.Len()+len(p) > maxIdempotentResponse {
+		r.overflow = true
+	} else {
+		r.body.Write(p)
+	}
+	return r.ResponseWriter.Write(p)
+}
+
+func (r *idempotencyRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// idempotent lets clients repeat a request with the same Idempotency-Key without it being
+// carried out twice. The first request with a key runs; a successful response is kept in the
+// nonce store for idempotencyTTL and replayed to repeats with the same body, which are not
+// metered, counted or logged again. Repeats while the first request runs answer 409, and a
+// failed request releases its key so that it can be retried. Keys are scoped by the caller and
+// path (see idempotencyScope); callers without a scope are not deduplicated.
+func idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		scope, scoped := idempotencyScope(r)
+		if key == "" || !scoped {
+			next(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			writeError(w, errs.Errorf(errs.Invalid, "%s must be at most %d characters", idempotencyKeyHeader, maxIdempotencyKeyLen))
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes))
+		if err != nil {
+			writeError(w, describeDecodeError(err))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		ctx := r.Context()
+		digest := artifactDigest(body)
+		name := nonceIdempotent + hashToken(scope+" "+r.URL.Path+" "+key)
+		done := name + ":done"
+
+		if stored, found, err := nonces.Get(ctx, done); err != nil || found {
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			replayIdempotent(w, stored, digest)
+			return
+		}
+		expires := time.Now().Add(idempotencyTTL)
+		fresh, err := nonces.Put(ctx, name, []byte(digest), expires)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if !fresh {
+			if pending, found, err := nonces.Get(ctx, name); err == nil && found && string(pending) != digest {
+				writeError(w, errIdempotencyKeyReused)
+				return
+			}
+			w.Header().Set("Retry-After", "1")
+			writeError(w, errIdempotencyInProgress)
+			return
+		}
+
+		rec := &idempotencyRecorder{ResponseWriter: w}
+		next(rec, r)
+		if rec.status == 0 {
+			rec.status, rec.header = http.StatusOK, w.Header().Clone()
+		}
+
+		// The request is over for the client, but its outcome must still be recorded
+		ctx = context.WithoutCancel(ctx)
+		if rec.status >= 200 && rec.status < 300 && !rec.overflow {
+			dropUnreplayedHeaders(rec.header)
+			data, err := json.Marshal(idempotentResponse{Request: digest, Status: rec.status, Header: rec.header, Body: rec.body.Bytes()})
+			if err == nil {
+				_, err = nonces.Put(ctx, done, data, expires)
+			}
+			if err == nil {
+				return
+			}
+			log.Printf("Failed to keep the response to an idempotent request: %v", err)
+		}
+		if _, _, err := nonces.Take(ctx, name); err != nil {
+			log.Printf("Failed to release an idempotency key: %v", err)
+		}
+	}
+}
+
+// idempotencyScope names whom the responses to keyed requests of r are replayed to: the tenant
+// it authenticated as and the user of its session. Anonymous callers without a session would
+// share their keys with each other, and a session request without its CSRF token could be
+// forged, so neither has a scope.
+func idempotencyScope(r *http.Request) (string, bool) {
+	tenant := tenantID(r)
+	s, _, hasCookie, err := requestSession(r)
+	switch {
+	case hasCookie && (err != nil || checkCSRF(r, s) != nil):
+		return "", false
+	case hasCookie:
+		return tenant + " " + s.provider + ":" + s.user, true
+	case tenant == anonymousTenant:
+		return "", false
+	}
+	return tenant, true
+}
+
+// dropUnreplayedHeaders removes the headers that belong to the first request rather than its
+// outcome: cookies, its request ID and the CORS headers of its origin
+func dropUnreplayedHeaders(header http.Header) {
+	header.Del("Set-Cookie")
+	header.Del("X-Request-ID")
+	for name := range header {
+		if strings.HasPrefix(name, "Access-Control-") {
+			delete(header, name)
+		}
+	}
+}
+
+// replayIdempotent answers a repeated request with the stored response to the first one
+func replayIdempotent(w http.ResponseWriter, stored []byte, digest string) {
+	var resp idempotentResponse
+	if err := json.Unmarshal(stored, &resp); err != nil {
+		writeError(w, errs.Errorf(errs.Internal, "failed to read the stored response"))
+		return
+	}
+	if resp.Request != digest {
+		writeError(w, errIdempotencyKeyReused)
+		return
+	}
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set(idempotentReplayedHeader, "true")
+	w.WriteHeader(resp.Status)
+	w.Write(resp.Body)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIdempotentRequests(t *testing.T) {
+	previous := nonces
+	nonces = newMeteredNonceStore(newMemoryNonceStore(100, time.Now))
+	t.Cleanup(func() { nonces = previous })
+	withAPIKeys(t, "partner-key", "other-key")
+
+	calls, status := 0, http.StatusOK
+	handler := idempotent(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("X-Proof-Digest", "abc")
+		w.Header().Set("X-Request-ID", "req-"+strconv.Itoa(calls))
+		w.Header().Set("Access-Control-Allow-Origin", "https://app.example")
+		w.WriteHeader(status)
+		w.Write([]byte(`{"call":` + strconv.Itoa(calls) + `}`))
+	})
+	sendAs := func(apiKey, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/get/proof/neededAmount", strings.NewReader(body))
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		if key != "" {
+			req.Header.Set(idempotencyKeyHeader, key)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+	send := func(key, body string) *httptest.ResponseRecorder {
+		return sendAs("partner-key", key, body)
+	}
+	h := NewTestHelper(t)
+
+	first := send("order-1", `{"id":"alice"}`)
+	again := send("order-1", `{"id":"alice"}`)
+	h.AssertStatusCode(again, http.StatusOK, "repeating a keyed request")
+	if calls != 1 || again.Body.String() != first.Body.String() || again.Header().Get("X-Proof-Digest") != "abc" {
+		t.Errorf("Expected the first response to be replayed, got %d calls and %s", calls, again.Body.String())
+	}
+	if again.Header().Get(idempotentReplayedHeader) != "true" || first.Header().Get(idempotentReplayedHeader) != "" {
+		t.Error("Expected only the replay to be marked")
+	}
+	if again.Header().Get("X-Request-ID") != "" || again.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected the request ID and CORS headers of the first request not to be replayed, got %v", again.Header())
+	}
+
+	// Keys are scoped by caller, and anonymous callers are not deduplicated at all
+	sendAs("other-key", "order-1", `{"id":"alice"}`)
+	sendAs("", "order-1", `{"id":"alice"}`)
+	sendAs("made-up-key", "order-1", `{"id":"alice"}`)
+	if calls != 4 {
+		t.Errorf("Expected other callers to run their own requests, got %d calls", calls)
+	}
+
+	h.AssertStatusCode(send("order-1", `{"id":"bob"}`), http.StatusUnprocessableEntity, "reusing a key with another body")
+	send("", `{"id":"alice"}`)
+	send("", `{"id":"alice"}`)
+	if calls != 6 {
+		t.Errorf("Expected requests without a key to run every time, got %d calls", calls)
+	}
+
+	status = http.StatusServiceUnavailable
+	send("order-2", `{"id":"alice"}`)
+	status = http.StatusOK
+	h.AssertStatusCode(send("order-2", `{"id":"alice"}`), http.StatusOK, "retrying a failed request")
+	if calls != 8 {
+		t.Errorf("Expected a failed request to release its key, got %d calls", calls)
+	}
+
+	// A key whose first request has not answered yet
+	name := nonceIdempotent + hashToken(apiKeyTenant("partner-key")+" /get/proof/neededAmount order-3")
+	nonces.Put(context.Background(), name, []byte(artifactDigest([]byte(`{"id":"alice"}`))), time.Now().Add(time.Minute))
+	rr := send("order-3", `{"id":"alice"}`)
+	h.AssertStatusCode(rr, http.StatusConflict, "repeating a running request")
+	if rr.Header().Get("Retry-After") == "" || calls != 8 {
+		t.Errorf("Expected a 409 with Retry-After without running the request, got %v after %d calls", rr.Header(), calls)
+	}
+}
+
+func TestIdempotencyScope(t *testing.T) {
+	signIn := func(user string) *http.Request {
+		rr := httptest.NewRecorder()
+		s, err := startSession(rr, httptest.NewRequest("POST", "/session", nil), user, sessionProviderOIDC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest("POST", "/get/proof/neededAmount", nil)
+		for _, c := range rr.Result().Cookies() {
+			req.AddCookie(c)
+		}
+		req.Header.Set(csrfHeader, s.csrf)
+		return req
+	}
+
+	alice, bob := signIn("scope_alice"), signIn("scope_bob")
+	aliceScope, ok := idempotencyScope(alice)
+	bobScope, _ := idempotencyScope(bob)
+	if !ok || aliceScope == bobScope {
+		t.Errorf("Expected each signed-in user to have a scope of their own, got %q and %q", aliceScope, bobScope)
+	}
+	alice.Header.Del(csrfHeader)
+	if _, ok := idempotencyScope(alice); ok {
+		t.Error("Expected a session request without its CSRF token to have no scope")
+	}
+	if _, ok := idempotencyScope(httptest.NewRequest("POST", "/get/proof/neededAmount", nil)); ok {
+		t.Error("Expected anonymous callers to have no scope")
+	}
+}
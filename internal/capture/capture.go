@@ -0,0 +1,100 @@
+// Package capture defines the request captures written by the server with ZK_CAPTURE_FILE
+// and replayed by zkctl: one JSON object per line for each verification request.
+package capture
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Record is one captured request and the outcome the server answered with
+type Record struct {
+	Time        time.Time `json:"time"`
+	RequestID   string    `json:"requestId,omitempty"`
+	Method      string    `json:"method"`
+	Path        string    `json:"path"`
+	Query       string    `json:"query,omitempty"`
+	ContentType string    `json:"contentType,omitempty"`
+	Body        []byte    `json:"body,omitempty"`
+	Outcome
+}
+
+// Outcome is what a response says about the request: its status, the error code of an
+// error envelope and the "valid" field of a validation result
+type Outcome struct {
+	Status int    `json:"status"`
+	Code   string `json:"code,omitempty"`
+	Valid  *bool  `json:"valid,omitempty"`
+}
+
+// OutcomeOf reads the outcome of a response with the given status and body
+func OutcomeOf(status int, body []byte) Outcome {
+	var fields struct {
+		Code  string `json:"code"`
+		Valid *bool  `json:"valid"`
+	}
+	// Bodies that are not a JSON object, such as empty 200 answers, only have a status
+	_ = json.Unmarshal(body, &fields)
+	return Outcome{Status: status, Code: fields.Code, Valid: fields.Valid}
+}
+
+func (o Outcome) String() string {
+	s := fmt.Sprint(o.Status)
+	if o.Code != "" {
+		s += " " + o.Code
+	}
+	if o.Valid != nil {
+		s += fmt.Sprintf(" valid=%t", *o.Valid)
+	}
+	return s
+}
+
+// Equal reports whether two outcomes are the same
+func (o Outcome) Equal(other Outcome) bool {
+	if o.Status != other.Status || o.Code != other.Code || (o.Valid == nil) != (other.Valid == nil) {
+		return false
+	}
+	return o.Valid == nil || *o.Valid == *other.Valid
+}
+
+// Writer appends records as JSON lines; it is safe for concurrent use
+type Writer struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{enc: json.NewEncoder(w)}
+}
+
+func (w *Writer) Write(r Record) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.enc.Encode(r)
+}
+
+// maxLine bounds one record; bodies are bounded by the server's request size limit
+const maxLine = 8 << 20
+
+// Read calls fn with every record of a capture, in order, and stops at the first error
+func Read(r io.Reader, fn func(Record) error) error {
+	lines := bufio.NewScanner(r)
+	lines.Buffer(nil, maxLine)
+	for n := 1; lines.Scan(); n++ {
+		if len(lines.Bytes()) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(lines.Bytes(), &rec); err != nil {
+			return fmt.Errorf("line %d: %w", n, err)
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	return lines.Err()
+}
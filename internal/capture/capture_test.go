@@ -0,0 +1,62 @@
+package capture
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+)
+
+func TestOutcomeOf(t *testing.T) {
+	valid, invalid := true, false
+	tests := []struct {
+		name string
+		body string
+		want Outcome
+	}{
+		{"Empty body", "", Outcome{Status: http.StatusOK}},
+		{"Validation result", `{"manifest": "ab", "valid": false}`, Outcome{Status: http.StatusOK, Valid: &invalid}},
+		{"Error envelope", `{"error": "invalid proof", "code": "proof_invalid"}`, Outcome{Status: http.StatusOK, Code: "proof_invalid"}},
+		{"Not an object", `[1, 2]`, Outcome{Status: http.StatusOK}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := OutcomeOf(http.StatusOK, []byte(tt.body)); !got.Equal(tt.want) {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+
+	if (Outcome{Status: 200, Valid: &valid}).Equal(Outcome{Status: 200, Valid: &invalid}) {
+		t.Error("Expected outcomes of different validity to differ")
+	}
+	if (Outcome{Status: 200}).Equal(Outcome{Status: 200, Valid: &valid}) {
+		t.Error("Expected a missing validity to differ from a reported one")
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	records := []Record{
+		{Method: "POST", Path: "/validate", Body: []byte(`{"neededAmount": 100}`), Outcome: Outcome{Status: 200}},
+		{Method: "POST", Path: "/validate/bundle", Query: "curve=bn254", Outcome: Outcome{Status: 401, Code: "proof_invalid"}},
+	}
+	for _, r := range records {
+		if err := w.Write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf.WriteString("\n")
+
+	var read []Record
+	if err := Read(&buf, func(r Record) error { read = append(read, r); return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != 2 || string(read[0].Body) != `{"neededAmount": 100}` || read[1].Query != "curve=bn254" || !read[1].Outcome.Equal(records[1].Outcome) {
+		t.Errorf("Unexpected records %+v", read)
+	}
+
+	if err := Read(bytes.NewBufferString("{\n"), func(Record) error { return nil }); err == nil {
+		t.Error("Expected an error for a malformed line")
+	}
+}
@@ -0,0 +1,132 @@
+// Package errs defines the typed errors of the server and the single mapping from errors
+// to HTTP statuses and error-envelope codes.
+package errs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Kind classifies an error by how a client should react to it
+type Kind int
+
+const (
+	Internal             Kind = iota // unexpected failure; untyped errors have this kind
+	Invalid                          // malformed or inconsistent request
+	Unauthorized                     // missing credentials, or a proof that does not verify
+	Forbidden                        // understood but refused
+	NotFound                         // the named resource does not exist
+	MethodNotAllowed                 // the route does not accept the request method
+	Conflict                         // the request conflicts with the current state
+	PreconditionRequired             // the request must name the version it replaces
+	Unprocessable                    // well-formed, but the witness does not satisfy the circuit
+	PaymentRequired                  // a paid allowance is used up
+	TooManyRequests                  // a rate or daily allowance is used up
+	Unavailable                      // disabled, shutting down, out of time or a dependency is down
+	BadGateway                       // an upstream service failed
+	NotImplemented                   // not available in this build
+)
+
+var kinds = map[Kind]struct {
+	status int
+	code   string
+}{
+	Internal:             {http.StatusInternalServerError, "internal"},
+	Invalid:              {http.StatusBadRequest, "invalid_request"},
+	Unauthorized:         {http.StatusUnauthorized, "unauthorized"},
+	Forbidden:            {http.StatusForbidden, "forbidden"},
+	NotFound:             {http.StatusNotFound, "not_found"},
+	MethodNotAllowed:     {http.StatusMethodNotAllowed, "method_not_allowed"},
+	Conflict:             {http.StatusConflict, "conflict"},
+	PreconditionRequired: {http.StatusPreconditionRequired, "precondition_required"},
+	Unprocessable:        {http.StatusUnprocessableEntity, "unprocessable"},
+	PaymentRequired:      {http.StatusPaymentRequired, "payment_required"},
+	TooManyRequests:      {http.StatusTooManyRequests, "too_many_requests"},
+	Unavailable:          {http.StatusServiceUnavailable, "unavailable"},
+	BadGateway:           {http.StatusBadGateway, "bad_gateway"},
+	NotImplemented:       {http.StatusNotImplemented, "not_implemented"},
+}
+
+// Status returns the HTTP status of errors of this kind
+func (k Kind) Status() int { return kinds[k].status }
+
+// Code returns the envelope code of errors of this kind that have no code of their own
+func (k Kind) Code() string { return kinds[k].code }
+
+// Error is an error with a kind and a stable machine-readable code
+type Error struct {
+	Kind Kind
+	Code string
+	Msg  string
+	Err  error // optional cause
+}
+
+func (e *Error) Error() string { return e.Msg }
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// New returns an error with its own code, for sentinels clients are expected to tell apart
+func New(kind Kind, code, msg string) *Error {
+	return &Error{Kind: kind, Code: code, Msg: msg}
+}
+
+// Errorf returns an error of kind with the kind's generic code
+func Errorf(kind Kind, format string, args ...any) error {
+	err := fmt.Errorf(format, args...)
+	return &Error{Kind: kind, Code: kind.Code(), Msg: err.Error(), Err: errors.Unwrap(err)}
+}
+
+// Wrap gives err a kind unless it already has one; a nil err stays nil
+func Wrap(kind Kind, err error) error {
+	var typed *Error
+	if err == nil || errors.As(err, &typed) {
+		return err
+	}
+	return &Error{Kind: kind, Code: kind.Code(), Msg: err.Error(), Err: err}
+}
+
+// Errors shared across the server
+var (
+	ErrBalanceNotFound = New(NotFound, "balance_not_found", "balance not found")
+	ErrProofInvalid    = New(Unauthorized, "proof_invalid", "invalid proof")
+	ErrProofMalformed  = New(Invalid, "proof_malformed", "invalid proof format")
+	ErrKeyMismatch     = New(Internal, "key_mismatch", "persisted keys do not match the circuit")
+	ErrTimeout         = New(Unavailable, "timeout", "request ran out of time")
+	ErrCanceled        = New(Unavailable, "canceled", "request was canceled")
+)
+
+// KindOf returns the kind of the outermost typed error err wraps, Unavailable for an ended
+// context and Internal otherwise
+func KindOf(err error) Kind {
+	var typed *Error
+	switch {
+	case errors.As(err, &typed):
+		return typed.Kind
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return Unavailable
+	default:
+		return Internal
+	}
+}
+
+// Status returns the HTTP status err maps to
+func Status(err error) int {
+	return KindOf(err).Status()
+}
+
+// Code returns the envelope code err maps to
+func Code(err error) string {
+	var typed *Error
+	switch {
+	case errors.As(err, &typed):
+		return typed.Code
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrTimeout.Code
+	case errors.Is(err, context.Canceled):
+		return ErrCanceled.Code
+	default:
+		return Internal.Code()
+	}
+}
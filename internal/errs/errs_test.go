@@ -0,0 +1,61 @@
+package errs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestMapping(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"Sentinel", ErrBalanceNotFound, http.StatusNotFound, "balance_not_found"},
+		{"Wrapped sentinel", fmt.Errorf("%w: bad point", ErrProofMalformed), http.StatusBadRequest, "proof_malformed"},
+		{"Kind without own code", Errorf(Conflict, "id %q is taken", "alice"), http.StatusConflict, "conflict"},
+		{"Untyped", errors.New("disk full"), http.StatusInternalServerError, "internal"},
+		{"Deadline", fmt.Errorf("proving: %w", context.DeadlineExceeded), http.StatusServiceUnavailable, "timeout"},
+		{"Canceled", context.Canceled, http.StatusServiceUnavailable, "canceled"},
+		{"Outermost kind wins", Errorf(Invalid, "%w", ErrBalanceNotFound), http.StatusBadRequest, "invalid_request"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Status(tt.err); got != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, got)
+			}
+			if got := Code(tt.err); got != tt.code {
+				t.Errorf("Expected code %q, got %q", tt.code, got)
+			}
+		})
+	}
+}
+
+func TestWrap(t *testing.T) {
+	if Wrap(Invalid, nil) != nil {
+		t.Error("Expected wrapping nil to stay nil")
+	}
+
+	cause := errors.New("bad salt")
+	err := Wrap(Invalid, cause)
+	if Status(err) != http.StatusBadRequest || err.Error() != "bad salt" || !errors.Is(err, cause) {
+		t.Errorf("Expected a 400 keeping the cause, got %d %v", Status(err), err)
+	}
+
+	if err := Wrap(Invalid, ErrProofInvalid); err != ErrProofInvalid {
+		t.Errorf("Expected a typed error to keep its kind, got %v", err)
+	}
+}
+
+func TestEveryKindMaps(t *testing.T) {
+	for k := Internal; k <= NotImplemented; k++ {
+		if k.Status() == 0 || k.Code() == "" {
+			t.Errorf("Kind %d has no status or code", k)
+		}
+	}
+}
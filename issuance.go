@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+var errUserProofLimit = errs.New(errs.TooManyRequests, "user_proof_limit", "too many proofs issued about this user")
+
+// UserProofLimit caps the proofs issued about one user per sliding window, whoever asks for
+// them, so a verifier cannot binary-search a balance with repeated thresholds; a zero Max
+// disables the cap
+type UserProofLimit struct {
+	Max    int
+	Window time.Duration
+}
+
+// issuanceLimiter keeps the times of the recent proofs about each user. Failed proofs count
+// too, as whether a threshold is met is exactly what an oracle attack learns from them.
+type issuanceLimiter struct {
+	cfg UserProofLimit
+	now func() time.Time
+
+	mu     sync.Mutex
+	issued map[string][]time.Time
+}
+
+func newIssuanceLimiter(cfg UserProofLimit, now func() time.Time) *issuanceLimiter {
+	return &issuanceLimiter{cfg: cfg, now: now, issued: make(map[string][]time.Time)}
+}
+
+var userIssuance = newIssuanceLimiter(UserProofLimit{}, time.Now)
+
+// recent drops the times of user that left the window; callers must hold l.mu
+func (l *issuanceLimiter) recent(user string, now time.Time) []time.Time {
+	times := l.issued[user]
+	i := 0
+	for i < len(times) && now.Sub(times[i]) >= l.cfg.Window {
+		i++
+	}
+	times = times[i:]
+	if len(times) == 0 {
+		delete(l.issued, user)
+		return nil
+	}
+	l.issued[user] = times
+	return times
+}
+
+// allow counts a proof about user, returning how long to wait when the window is full
+func (l *issuanceLimiter) allow(user string) (bool, time.Duration) {
+	if l.cfg.Max <= 0 {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	times := l.recent(user, now)
+	if len(times) >= l.cfg.Max {
+		return false, times[0].Add(l.cfg.Window).Sub(now)
+	}
+	l.issued[user] = append(times, now)
+	return true, 0
+}
+
+// forget drops what is kept about user
+func (l *issuanceLimiter) forget(user string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.issued, user)
+}
+
+// sweep forgets users without proofs in the window
+func (l *issuanceLimiter) sweep(now time.Time) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	removed := 0
+	for user := range l.issued {
+		if l.recent(user, now) == nil {
+			removed++
+		}
+	}
+	return removed
+}
+
+// checkUserIssuance counts a proof about user against ZK_USER_PROOF_LIMIT
+func checkUserIssuance(user string) error {
+	if ok, wait := userIssuance.allow(user); !ok {
+		return fmt.Errorf("%w, retry in %s", errUserProofLimit, wait.Round(time.Second))
+	}
+	return nil
+}
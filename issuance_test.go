@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIssuanceLimiter(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	l := newIssuanceLimiter(UserProofLimit{Max: 2, Window: time.Hour}, func() time.Time { return now })
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.allow("alice"); !ok {
+			t.Fatalf("Expected proof %d to be allowed", i+1)
+		}
+		now = now.Add(10 * time.Minute)
+	}
+	ok, wait := l.allow("alice")
+	if ok || wait != 40*time.Minute {
+		t.Errorf("Expected to wait 40m for the first proof to leave the window, got %v, %v", ok, wait)
+	}
+	if ok, _ := l.allow("bob"); !ok {
+		t.Error("Expected other users to be unaffected")
+	}
+
+	now = now.Add(40 * time.Minute)
+	if ok, _ := l.allow("alice"); !ok {
+		t.Error("Expected a proof once the oldest left the window")
+	}
+
+	now = now.Add(2 * time.Hour)
+	if removed := l.sweep(now); removed != 2 || len(l.issued) != 0 {
+		t.Errorf("Expected both users to be swept, removed %d", removed)
+	}
+
+	unlimited := newIssuanceLimiter(UserProofLimit{Window: time.Hour}, time.Now)
+	for i := 0; i < 100; i++ {
+		if ok, _ := unlimited.allow("alice"); !ok {
+			t.Fatal("Expected no limit without a maximum")
+		}
+	}
+}
+
+func TestUserProofLimit(t *testing.T) {
+	SkipIfShort(t, "proof generation")
+	previous := userIssuance
+	t.Cleanup(func() { userIssuance = previous })
+	userIssuance = newIssuanceLimiter(UserProofLimit{Max: 1, Window: time.Hour}, time.Now)
+
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+	t.Cleanup(h.SetupCleanBalances)
+	h.AssertStatusCode(h.StoreBalance("probed_user", 500), http.StatusOK, "storing a balance")
+
+	// A threshold the balance falls short of still uses up the allowance
+	rr := postJSON(t, generateProof, "/get/proof/neededAmount", ProofRequest{ID: "probed_user", NeededAmount: 1000})
+	if rr.Code == http.StatusOK || rr.Code == http.StatusTooManyRequests {
+		t.Fatalf("Expected an unmet threshold to fail to prove, got %d", rr.Code)
+	}
+
+	rr = postJSON(t, generateProof, "/get/proof/neededAmount", ProofRequest{ID: "probed_user", NeededAmount: 400})
+	h.AssertStatusCode(rr, http.StatusTooManyRequests, "proving past the limit")
+	if !strings.Contains(rr.Body.String(), errUserProofLimit.Code) {
+		t.Errorf("Expected %s, got %s", errUserProofLimit.Code, rr.Body.String())
+	}
+	rr = postJSON(t, generateBucketProof, "/get/proof/bucket", BucketProofRequest{ID: "probed_user"})
+	h.AssertStatusCode(rr, http.StatusTooManyRequests, "proving another statement past the limit")
+
+	rr = postJSON(t, generateProof, "/get/proof/neededAmount", ProofRequest{ID: "other_user", NeededAmount: 400})
+	h.AssertStatusCode(rr, http.StatusNotFound, "proving about another user")
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// encryptionKeySecret is the PEM-encoded P-256 private key request payloads are encrypted to
+const encryptionKeySecret = "encryption-key"
+
+// joseContentType marks a request body that is a JWE in compact serialization
+const joseContentType = "application/jose"
+
+var (
+	errJWEInvalid     = errs.New(errs.Invalid, "jwe_invalid", "encrypted payload could not be decrypted")
+	errJWEUnsupported = errs.New(errs.Invalid, "jwe_unsupported", "encrypted payload uses an unsupported algorithm; use ECDH-ES with A128GCM or A256GCM")
+)
+
+// payloadKey is the server's payload encryption key, replaced from configuration at startup
+var payloadKey *encryptionKey
+
+type encryptionKey struct {
+	private *ecdsa.PrivateKey
+	kid     string
+}
+
+// newEncryptionKey loads the payload encryption key; without one configured the key is
+// ephemeral, so clients must fetch GET /keys/encryption again after a restart
+func newEncryptionKey(p SecretProvider) (*encryptionKey, error) {
+	pemKey, err := p.Secret(context.Background(), encryptionKeySecret)
+	if errors.Is(err, errSecretNotFound) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("No %s configured, using an ephemeral payload encryption key", encryptionKeySecret)
+		return &encryptionKey{private: key, kid: publicKeyID(&key.PublicKey)}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", encryptionKeySecret, err)
+	}
+	key, err := parseECPrivateKey([]byte(pemKey))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", encryptionKeySecret, err)
+	}
+	return &encryptionKey{private: key, kid: publicKeyID(&key.PublicKey)}, nil
+}
+
+// EncryptionKey is the public payload encryption key as a JWK
+type EncryptionKey struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+}
+
+func (k *encryptionKey) jwk() EncryptionKey {
+	return EncryptionKey{
+		Kty: "EC",
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(padCoordinate(k.private.X)),
+		Y:   base64.RawURLEncoding.EncodeToString(padCoordinate(k.private.Y)),
+		Kid: k.kid,
+		Alg: "ECDH-ES",
+		Use: "enc",
+	}
+}
+
+// getEncryptionKey publishes the key clients encrypt request payloads to
+func getEncryptionKey(w http.ResponseWriter, r *http.Request) {
+	if payloadKey == nil {
+		writeError(w, errs.Errorf(errs.Unavailable, "payload encryption is not configured"))
+		return
+	}
+	writeJSON(w, payloadKey.jwk())
+}
+
+// decrypt opens a compact JWE encrypted with ECDH-ES and AES-GCM (RFC 7516, RFC 7518 4.6),
+// returning the plaintext and its content type
+func (k *encryptionKey) decrypt(token string) ([]byte, string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 {
+		return nil, "", fmt.Errorf("%w: expected five segments", errJWEInvalid)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Enc string `json:"enc"`
+		Kid string `json:"kid"`
+		Cty string `json:"cty"`
+		Zip string `json:"zip"`
+		Apu string `json:"apu"`
+		Apv string `json:"apv"`
+		Epk struct {
+			Kty string `json:"kty"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"epk"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, "", fmt.Errorf("%w: malformed header", errJWEInvalid)
+	}
+
+	var keyLen int
+	switch header.Enc {
+	case "A128GCM":
+		keyLen = 16
+	case "A256GCM":
+		keyLen = 32
+	}
+	if header.Alg != "ECDH-ES" || keyLen == 0 || header.Epk.Kty != "EC" || header.Epk.Crv != "P-256" || header.Zip != "" {
+		return nil, "", errJWEUnsupported
+	}
+	if header.Kid != "" && header.Kid != k.kid {
+		return nil, "", fmt.Errorf("%w: encrypted to another key, fetch GET /keys/encryption", errJWEInvalid)
+	}
+	if parts[1] != "" {
+		return nil, "", fmt.Errorf("%w: direct key agreement has no encrypted key", errJWEInvalid)
+	}
+
+	var iv, ciphertext, tag []byte
+	for _, segment := range []struct {
+		name string
+		in   string
+		out  *[]byte
+	}{{"iv", parts[2], &iv}, {"ciphertext", parts[3], &ciphertext}, {"tag", parts[4], &tag}} {
+		var err error
+		if *segment.out, err = base64.RawURLEncoding.DecodeString(segment.in); err != nil {
+			return nil, "", fmt.Errorf("%w: malformed %s", errJWEInvalid, segment.name)
+		}
+	}
+	x, errX := base64.RawURLEncoding.DecodeString(header.Epk.X)
+	y, errY := base64.RawURLEncoding.DecodeString(header.Epk.Y)
+	apu, errU := base64.RawURLEncoding.DecodeString(header.Apu)
+	apv, errV := base64.RawURLEncoding.DecodeString(header.Apv)
+	if err := errors.Join(errX, errY, errU, errV); err != nil || len(x) != 32 || len(y) != 32 {
+		return nil, "", fmt.Errorf("%w: malformed ephemeral key", errJWEInvalid)
+	}
+
+	// ecdh checks that the ephemeral key is on the curve
+	ephemeral, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", errJWEInvalid, err)
+	}
+	private, err := k.private.ECDH()
+	if err != nil {
+		return nil, "", err
+	}
+	shared, err := private.ECDH(ephemeral)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", errJWEInvalid, err)
+	}
+
+	block, err := aes.NewCipher(concatKDF(shared, header.Enc, apu, apv, keyLen))
+	if err != nil {
+		return nil, "", err
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
+	if err != nil || len(iv) == 0 {
+		return nil, "", fmt.Errorf("%w: invalid iv", errJWEInvalid)
+	}
+	plaintext, err := gcm.Open(nil, iv, append(ciphertext, tag...), []byte(parts[0]))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: authentication failed", errJWEInvalid)
+	}
+
+	cty := header.Cty
+	if cty == "" {
+		cty = "application/json"
+	}
+	return plaintext, cty, nil
+}
+
+// concatKDF derives the content encryption key of ECDH-ES in direct key agreement mode
+// (RFC 7518 4.6.2), where the algorithm id is the enc value
+func concatKDF(shared []byte, enc string, apu, apv []byte, keyLen int) []byte {
+	var info bytes.Buffer
+	for _, field := range [][]byte{[]byte(enc), apu, apv} {
+		_ = binary.Write(&info, binary.BigEndian, uint32(len(field)))
+		info.Write(field)
+	}
+	_ = binary.Write(&info, binary.BigEndian, uint32(keyLen*8))
+
+	// One round of SHA-256 covers keys up to 256 bits
+	h := sha256.New()
+	_ = binary.Write(h, binary.BigEndian, uint32(1))
+	h.Write(shared)
+	h.Write(info.Bytes())
+	return h.Sum(nil)[:keyLen]
+}
+
+// decryptPayloads replaces application/jose request bodies with their plaintext, so proxies
+// in front of the server, including TLS-terminating ones, only ever see ciphertext
+func decryptPayloads(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mediaType != joseContentType || payloadKey == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes))
+		if err != nil {
+			writeError(w, describeDecodeError(err))
+			return
+		}
+		plaintext, cty, err := payloadKey.decrypt(string(bytes.TrimSpace(token)))
+		if err != nil {
+			writeError(w, errs.Wrap(errs.Internal, err))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(plaintext))
+		r.ContentLength = int64(len(plaintext))
+		r.Header.Set("Content-Length", strconv.Itoa(len(plaintext)))
+		r.Header.Set("Content-Type", cty)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// encryptJWE encrypts plaintext to key as a client would, with ECDH-ES and enc
+func encryptJWE(t *testing.T, key *encryptionKey, header map[string]any, plaintext []byte) string {
+	t.Helper()
+	b64 := base64.RawURLEncoding.EncodeToString
+	public, err := key.private.PublicKey.ECDH()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ephemeral, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared, err := ephemeral.ECDH(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	point := ephemeral.PublicKey().Bytes()
+	header["epk"] = map[string]string{"kty": "EC", "crv": "P-256", "x": b64(point[1:33]), "y": b64(point[33:])}
+	protected, _ := json.Marshal(header)
+	encoded := b64(protected)
+
+	keyLen := 32
+	if header["enc"] == "A128GCM" {
+		keyLen = 16
+	}
+	block, err := aes.NewCipher(concatKDF(shared, header["enc"].(string), nil, nil, keyLen))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, _ := cipher.NewGCM(block)
+	iv := make([]byte, gcm.NonceSize())
+	_, _ = rand.Read(iv)
+	sealed := gcm.Seal(nil, iv, plaintext, []byte(encoded))
+	ciphertext, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+	return encoded + ".." + b64(iv) + "." + b64(ciphertext) + "." + b64(tag)
+}
+
+func TestDecryptJWE(t *testing.T) {
+	key, err := newEncryptionKey(mapSecrets{})
+	if err != nil {
+		t.Fatalf("Failed to create encryption key: %v", err)
+	}
+	plaintext := []byte(`{"id":"alice","amount":1000}`)
+	valid := encryptJWE(t, key, map[string]any{"alg": "ECDH-ES", "enc": "A256GCM", "kid": key.kid}, plaintext)
+	parts := strings.Split(valid, ".")
+	tampered := strings.Join(append(parts[:3:3], base64.RawURLEncoding.EncodeToString([]byte("forged ciphertext")), parts[4]), ".")
+
+	tests := []struct {
+		name  string
+		token string
+		code  string
+	}{
+		{"A256GCM", valid, ""},
+		{"A128GCM without kid", encryptJWE(t, key, map[string]any{"alg": "ECDH-ES", "enc": "A128GCM"}, plaintext), ""},
+		{"Other key", encryptJWE(t, key, map[string]any{"alg": "ECDH-ES", "enc": "A256GCM", "kid": "rotated"}, plaintext), "jwe_invalid"},
+		{"Key wrapping", encryptJWE(t, key, map[string]any{"alg": "ECDH-ES+A256KW", "enc": "A256GCM"}, plaintext), "jwe_unsupported"},
+		{"CBC content encryption", encryptJWE(t, key, map[string]any{"alg": "ECDH-ES", "enc": "A256CBC-HS512"}, plaintext), "jwe_unsupported"},
+		{"Tampered ciphertext", tampered, "jwe_invalid"},
+		{"Not a JWE", "eyJhbGciOiJub25lIn0.e30.", "jwe_invalid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, cty, err := key.decrypt(tt.token)
+			if tt.code != "" {
+				if errs.Code(err) != tt.code {
+					t.Fatalf("Expected %s, got %v", tt.code, err)
+				}
+				return
+			}
+			if err != nil || !bytes.Equal(got, plaintext) || cty != "application/json" {
+				t.Errorf("Expected the plaintext, got %q (%s), %v", got, cty, err)
+			}
+		})
+	}
+}
+
+func TestEncryptedStoreBalance(t *testing.T) {
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+	previous := payloadKey
+	t.Cleanup(func() { payloadKey = previous })
+	var err error
+	if payloadKey, err = newEncryptionKey(mapSecrets{}); err != nil {
+		t.Fatalf("Failed to create encryption key: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	getEncryptionKey(rr, httptest.NewRequest("GET", "/keys/encryption", nil))
+	var jwk EncryptionKey
+	if err := json.Unmarshal(rr.Body.Bytes(), &jwk); err != nil || jwk.Alg != "ECDH-ES" || jwk.Use != "enc" || jwk.Kid != payloadKey.kid {
+		t.Fatalf("Unexpected encryption key %s (%v)", rr.Body.String(), err)
+	}
+
+	handler := decryptPayloads(http.HandlerFunc(storeBalance))
+	token := encryptJWE(t, payloadKey, map[string]any{"alg": "ECDH-ES", "enc": "A256GCM"}, []byte(`{"id":"alice","amount":4200}`))
+	req := httptest.NewRequest("POST", "/store/sum", strings.NewReader(token))
+	req.Header.Set("Content-Type", "application/jose")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	h.AssertStatusCode(rr, http.StatusOK, "encrypted store")
+	if balance, _, ok := lookupBalance("alice"); !ok || balance != 4200 {
+		t.Errorf("Expected the decrypted balance to be stored, got %d", balance)
+	}
+
+	req = httptest.NewRequest("POST", "/store/sum", strings.NewReader(token[:len(token)-4]))
+	req.Header.Set("Content-Type", "application/jose")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	h.AssertStatusCode(rr, http.StatusBadRequest, "corrupted payload")
+}
+
+// TestConcatKDF checks the key derivation against the example of RFC 7518 Appendix C
+func TestConcatKDF(t *testing.T) {
+	shared := []byte{158, 86, 217, 29, 129, 113, 53, 211, 114, 131, 66, 131, 191, 132, 38, 156,
+		251, 49, 110, 163, 218, 128, 106, 72, 246, 218, 167, 121, 140, 254, 144, 196}
+	got := base64.RawURLEncoding.EncodeToString(concatKDF(shared, "A128GCM", []byte("Alice"), []byte("Bob"), 16))
+	if got != "VqqN6vgjbSBcIijNcacQGg" {
+		t.Errorf("Expected the RFC 7518 key, got %s", got)
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// jwksRefreshInterval bounds how often unknown key ids refetch a key set
+const jwksRefreshInterval = time.Minute
+
+// getProviderJSON fetches a JSON document from an identity provider; failures are the
+// provider's, so they answer 502
+func getProviderJSON(ctx context.Context, client *http.Client, rawURL string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return errs.Wrap(errs.BadGateway, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return errs.Wrap(errs.BadGateway, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errs.Errorf(errs.BadGateway, "identity provider: %s answered %s", rawURL, resp.Status)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return errs.Errorf(errs.BadGateway, "identity provider: %s: %w", rawURL, err)
+	}
+	return nil
+}
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey parses an RSA or P-256 signing key; other keys are skipped with a nil key
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	if k.Use != "" && k.Use != "sig" {
+		return nil, nil
+	}
+	switch {
+	case k.Kty == "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if len(n) < 256 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("key %s: unsupported RSA key", k.Kid)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case k.Kty == "EC" && k.Crv == "P-256":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("key %s: invalid P-256 coordinates", k.Kid)
+		}
+		// ecdh checks that the point is on the curve
+		if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, fmt.Errorf("key %s: %w", k.Kid, err)
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// jwksCache holds the signing keys of a JSON Web Key Set. Unknown key ids refetch the set,
+// as providers rotate keys, but at most once per jwksRefreshInterval.
+type jwksCache struct {
+	url    string
+	client *http.Client
+	now    func() time.Time
+
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+func newJWKSCache(url string, client *http.Client, now func() time.Time) *jwksCache {
+	return &jwksCache{url: url, client: client, now: now}
+}
+
+// errUnknownKey means a token names a signing key its provider does not publish
+var errUnknownKey = errors.New("unknown signing key")
+
+func (c *jwksCache) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	c.mu.Lock()
+	key, ok := c.keys[kid]
+	stale := c.now().Sub(c.fetched) >= jwksRefreshInterval
+	c.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+	if !stale {
+		return nil, fmt.Errorf("%w %q", errUnknownKey, kid)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := getProviderJSON(ctx, c.client, c.url, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		pub, err := k.publicKey()
+		if err != nil {
+			return nil, errs.Errorf(errs.BadGateway, "identity provider: %w", err)
+		}
+		if pub != nil {
+			keys[k.Kid] = pub
+		}
+	}
+
+	c.mu.Lock()
+	c.keys, c.fetched = keys, c.now()
+	c.mu.Unlock()
+
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w %q", errUnknownKey, kid)
+}
+
+// verifyJWT checks the RS256 or ES256 signature of a compact JWT against keys and decodes
+// its claims into out. Failures of the key set's provider are typed errors; everything else
+// is wrong with the token.
+func verifyJWT(ctx context.Context, keys *jwksCache, token string, out any) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return errors.New("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return errors.New("malformed header")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return errors.New("malformed signature")
+	}
+
+	key, err := keys.key(ctx, header.Kid)
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		if header.Alg != "RS256" || rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) != nil {
+			return errors.New("bad signature")
+		}
+	case *ecdsa.PublicKey:
+		if header.Alg != "ES256" || len(sig) != 64 ||
+			!ecdsa.Verify(pub, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+			return errors.New("bad signature")
+		}
+	default:
+		return errors.New("unsupported signing key")
+	}
+
+	if err := decodeSegment(parts[1], out); err != nil {
+		return errors.New("malformed claims")
+	}
+	return nil
+}
+
+func decodeSegment(segment string, out any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// tokenError attributes a failed token check to the token as sentinel, unless the token's
+// provider failed
+func tokenError(sentinel *errs.Error, err error) error {
+	var typed *errs.Error
+	if errors.As(err, &typed) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", sentinel, err)
+}
+
+// audiences reads an aud claim, which is a string or an array of strings
+func audiences(aud json.RawMessage) []string {
+	var one string
+	if json.Unmarshal(aud, &one) == nil {
+		return []string{one}
+	}
+	var many []string
+	_ = json.Unmarshal(aud, &many)
+	return many
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/korjavin/zkTest1/circuits"
+	"github.com/korjavin/zkTest1/keys"
+)
+
+// KeyManager holds the trusted-setup artifacts of every circuit. The first request for a
+// circuit on a curve compiles it and loads or creates its keys; the resulting circuitSetup is
+// then shared by the prover and the verifier, so a proof is always checked against the
+// verifying key it was made with. Rotation replaces a setup as a whole.
+type KeyManager struct {
+	mu      sync.Mutex
+	entries map[string]*setupEntry // by circuit name, suffixed with the curve when not the default
+}
+
+type setupEntry struct {
+	once  sync.Once
+	done  atomic.Bool // set once setup and err are final
+	setup *circuitSetup
+	err   error
+}
+
+func newKeyManager() *KeyManager {
+	return &KeyManager{entries: make(map[string]*setupEntry)}
+}
+
+// keyManager holds the keys of this server
+var keyManager = newKeyManager()
+
+// loadSetup returns the setup of a circuit on the default curve
+func loadSetup(name string, circuit frontend.Circuit) (*circuitSetup, error) {
+	return keyManager.Load(defaultCurve, name, circuit)
+}
+
+// loadCurveSetup returns the setup of a circuit on curve, see KeyManager.Load
+func loadCurveSetup(curve ecc.ID, name string, circuit frontend.Circuit) (*circuitSetup, error) {
+	return keyManager.Load(curve, name, circuit)
+}
+
+// Load compiles a circuit for curve and loads or creates its keys the first time it is
+// requested, then returns the same setup to every caller. Each curve has its own setup and key
+// files.
+func (m *KeyManager) Load(curve ecc.ID, name string, circuit frontend.Circuit) (*circuitSetup, error) {
+	name = keys.CurveName(name, curve)
+
+	m.mu.Lock()
+	entry, ok := m.entries[name]
+	if !ok {
+		entry = &setupEntry{}
+		m.entries[name] = entry
+	}
+	m.mu.Unlock()
+
+	entry.once.Do(func() {
+		defer entry.done.Store(true)
+
+		ccs, err := frontend.Compile(curve.ScalarField(), r1cs.NewBuilder, circuit)
+		if err != nil {
+			entry.err = err
+			return
+		}
+
+		pk, vk, verifyOnly, err := loadOrCreateKeys(name, ccs)
+		if err != nil {
+			entry.err = err
+			return
+		}
+
+		keyID, err := verifyingKeyID(vk)
+		if err != nil {
+			entry.err = err
+			return
+		}
+
+		// Persisted keys are as old as their files, and keep accepting the keys they replaced
+		// until the grace window of their rotation ends
+		created := time.Now()
+		var retired []keys.RetiredKey
+		if keyStore != nil {
+			if saved, err := keyStore.SavedAt(name); err == nil {
+				created = saved
+			}
+			if retired, err = keyStore.LoadRetired(name); err != nil {
+				entry.err = err
+				return
+			}
+			retired = unexpired(retired, time.Now())
+		}
+
+		entry.setup = &circuitSetup{name: name, curve: curve, circuit: circuit, ccs: ccs, pk: pk, vk: vk, keyID: keyID, created: created.UTC(), verifyOnly: verifyOnly, retired: retired}
+	})
+
+	return entry.setup, entry.err
+}
+
+// loaded returns the setup of name, suffixed with its curve, when it has been set up successfully
+func (m *KeyManager) loaded(name string) (*circuitSetup, bool) {
+	m.mu.Lock()
+	entry, ok := m.entries[name]
+	m.mu.Unlock()
+	if !ok || !entry.done.Load() || entry.err != nil {
+		return nil, false
+	}
+	return entry.setup, true
+}
+
+// replace swaps in setup for its circuit, as loaded
+func (m *KeyManager) replace(setup *circuitSetup) {
+	entry := &setupEntry{setup: setup}
+	entry.once.Do(func() {})
+	entry.done.Store(true)
+	m.mu.Lock()
+	m.entries[setup.name] = entry
+	m.mu.Unlock()
+}
+
+// LoadPersisted sets up every named circuit on its configured curves when keys are persisted,
+// so keys that do not match their circuit stop the server at startup instead of failing every
+// proof
+func (m *KeyManager) LoadPersisted() error {
+	if keyStore == nil {
+		return nil
+	}
+	for _, name := range circuits.Names() {
+		for _, curve := range curveSelection.configuredCurves(name) {
+			circuit, err := circuits.New(name)
+			if err != nil {
+				return err
+			}
+			if _, err := m.Load(curve, name, circuit); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Check returns the first error among the setups loaded so far
+func (m *KeyManager) Check() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name, entry := range m.entries {
+		if entry.done.Load() && entry.err != nil {
+			return fmt.Errorf("%s: %w", name, entry.err)
+		}
+	}
+	return nil
+}
+
+// Inventory describes the keys set up so far, by name
+func (m *KeyManager) Inventory(now time.Time) []KeyInfo {
+	m.mu.Lock()
+	inventory := make([]KeyInfo, 0, len(m.entries))
+	for name, entry := range m.entries {
+		if !entry.done.Load() {
+			continue // still being set up
+		}
+		info := KeyInfo{Name: name}
+		if curve, err := keys.CurveOf(name); err == nil {
+			info.Curve = curve.String()
+		}
+		if entry.err != nil {
+			info.Error = entry.err.Error()
+		} else {
+			info.Created = entry.setup.created
+			info.KeyID = entry.setup.keyID
+			info.Persisted = keyStore != nil
+			info.VerifyOnly = entry.setup.verifyOnly
+			info.AgeSeconds = int64(now.Sub(entry.setup.created).Seconds())
+		}
+		inventory = append(inventory, info)
+	}
+	m.mu.Unlock()
+
+	sort.Slice(inventory, func(i, j int) bool { return inventory[i].Name < inventory[j].Name })
+	return inventory
+}
+
+// due lists the loaded setups whose keys are at least interval old
+func (m *KeyManager) due(now time.Time, interval time.Duration) []string {
+	m.mu.Lock()
+	var due []string
+	for name, entry := range m.entries {
+		if entry.done.Load() && entry.err == nil && now.Sub(entry.setup.created) >= interval {
+			due = append(due, name)
+		}
+	}
+	m.mu.Unlock()
+	sort.Strings(due)
+	return due
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+)
+
+func TestKeyManagerSharesSetups(t *testing.T) {
+	const name = "keymanager-test"
+	m := newKeyManager()
+
+	prover, err := m.Load(ecc.BN254, name, &savingsCircuit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := m.Load(ecc.BN254, name, &savingsCircuit{})
+	if err != nil || verifier != prover {
+		t.Fatalf("Expected every caller to get the same setup, got %v", err)
+	}
+	proof, err := prover.prove(context.Background(), &savingsCircuit{Savings: 10, Minimum: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.verify(context.Background(), proof, &savingsCircuit{Minimum: 5}); err != nil {
+		t.Errorf("Expected a proof to verify with the shared setup, got %v", err)
+	}
+
+	other, err := m.Load(ecc.BLS12_381, name, &savingsCircuit{})
+	if err != nil || other == prover || other.keyID == prover.keyID {
+		t.Errorf("Expected each curve to have its own keys, got %v", err)
+	}
+	if err := m.Check(); err != nil {
+		t.Errorf("Expected no failed setups, got %v", err)
+	}
+	inventory := m.Inventory(time.Now())
+	if len(inventory) != 2 || inventory[0].Name != name || inventory[0].KeyID != prover.keyID {
+		t.Errorf("Expected both setups in the inventory, got %+v", inventory)
+	}
+}
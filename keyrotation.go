@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/frontend"
+	"github.com/korjavin/zkTest1/circuits"
+	"github.com/korjavin/zkTest1/internal/errs"
+	"github.com/korjavin/zkTest1/keys"
+)
+
+// keyIDHeader names the verifying key a response was made with
+const keyIDHeader = "X-Key-ID"
+
+// KeyRotationConfig schedules automatic rotation of circuit keys; rotation is off when Interval is 0
+type KeyRotationConfig struct {
+	Interval time.Duration // keys older than this are replaced at the next rotation check
+	Grace    time.Duration // how long proofs made with replaced keys keep verifying
+}
+
+// keyRotation is the configured schedule, also used for rotations requested by an admin
+var keyRotation = KeyRotationConfig{Grace: 24 * time.Hour}
+
+// rotationMu serializes rotations, so each one replaces the setup it read
+var rotationMu sync.Mutex
+
+// verifyingKeyID is the first 16 hex digits of the SHA-256 of a verifying key's binary encoding,
+// which X-Key-Digest carries in full
+func verifyingKeyID(vk groth16.VerifyingKey) (string, error) {
+	var buf bytes.Buffer
+	if _, err := vk.WriteTo(&buf); err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256(buf.Bytes())
+	return hex.EncodeToString(digest[:8]), nil
+}
+
+// verifyRetired reports whether a proof verifies against a replaced key still in its grace window
+func (s *circuitSetup) verifyRetired(proof groth16.Proof, publicWitness witness.Witness, now time.Time) bool {
+	for _, old := range s.retired {
+		if now.Before(old.Expires) && verifyGroth16(proof, old.Key, publicWitness) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// unexpired returns the retired keys still accepted at now
+func unexpired(retired []keys.RetiredKey, now time.Time) []keys.RetiredKey {
+	var accepted []keys.RetiredKey
+	for _, r := range retired {
+		if now.Before(r.Expires) {
+			accepted = append(accepted, r)
+		}
+	}
+	return accepted
+}
+
+// KeyRotation describes one rotation of a circuit's keys
+type KeyRotation struct {
+	Circuit            string    `json:"circuit"` // setup name, suffixed with the curve when it is not the default
+	KeyID              string    `json:"kid"`
+	PreviousKeyID      string    `json:"previousKid"`
+	PreviousValidUntil time.Time `json:"previousValidUntil"`
+	Canary             KeyCanary `json:"canary"`
+}
+
+// KeyCanary is the outcome of the canary proofs that check new keys before they are used
+type KeyCanary struct {
+	Proved   bool   `json:"proved"`            // a proof made with the new keys verified
+	Archived bool   `json:"archived"`          // a proof made with the replaced keys verified through the grace window
+	Skipped  string `json:"skipped,omitempty"` // why no canary was proved
+}
+
+// errCanaryFailed stops a rotation whose new keys do not prove and verify the circuit's sample
+var errCanaryFailed = errs.New(errs.Internal, "key_canary_failed", "canary proof failed with the new keys")
+
+// checkRotation proves the circuit's sample assignment with the new keys and with the replaced
+// ones, and checks both proofs against next the way requests are verified: the new one with the
+// current key and the old one through the retired keys, at now. The proofs wait for a proving
+// worker and memory like any other. Circuits without a sample are rotated unchecked.
+func checkRotation(ctx context.Context, old, next *circuitSetup, now time.Time) (KeyCanary, error) {
+	sampler, ok := old.circuit.(circuits.Sampler)
+	if !ok {
+		return KeyCanary{Skipped: "circuit has no sample assignment"}, nil
+	}
+	sample := sampler.Sample(old.curve)
+	if sample == nil {
+		return KeyCanary{Skipped: "circuit has no sample assignment on " + old.curve.String()}, nil
+	}
+	full, err := frontend.NewWitness(sample, old.curve.ScalarField())
+	if err != nil {
+		return KeyCanary{}, err
+	}
+	public, err := full.Public()
+	if err != nil {
+		return KeyCanary{}, err
+	}
+	canary := func(pk groth16.ProvingKey, accepted func(groth16.Proof) bool) error {
+		var proof groth16.Proof
+		err := provers.run(ctx, old.name, shapeOfSystem(old.ccs).memory(old.curve), func() error {
+			var err error
+			proof, err = groth16.Prove(old.ccs, pk, full)
+			return err
+		})
+		if isContextError(err) {
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("%w: proving: %v", errCanaryFailed, err)
+		}
+		if !accepted(proof) {
+			return fmt.Errorf("%w: proof does not verify", errCanaryFailed)
+		}
+		return nil
+	}
+
+	var result KeyCanary
+	if err := canary(next.pk, func(proof groth16.Proof) bool { return groth16.Verify(proof, next.vk, public) == nil }); err != nil {
+		return result, err
+	}
+	result.Proved = true
+	if len(next.retired) == 0 || next.retired[len(next.retired)-1].ID != old.keyID {
+		return result, nil // no grace window, so proofs of the replaced keys are meant to stop verifying
+	}
+	if old.pk == nil {
+		return result, nil // verify-only, so rotation restores proving and there is nothing to prove with
+	}
+	if err := canary(old.pk, func(proof groth16.Proof) bool { return next.verifyRetired(proof, public, now) }); err != nil {
+		return result, fmt.Errorf("replaced keys: %w", err)
+	}
+	result.Archived = true
+	return result, nil
+}
+
+// Rotate runs a fresh Groth16 setup for a loaded circuit setup and swaps it in once
+// checkRotation passes. The replaced verifying key keeps verifying for grace; key.rotated is
+// audited, so subscribers learn the new key ID.
+func (m *KeyManager) Rotate(ctx context.Context, name string, now time.Time, grace time.Duration) (KeyRotation, error) {
+	rotationMu.Lock()
+	defer rotationMu.Unlock()
+
+	old, ok := m.loaded(name)
+	if !ok {
+		return KeyRotation{}, errs.Errorf(errs.NotFound, "no keys are set up for %s", name)
+	}
+
+	pk, vk, err := groth16.Setup(old.ccs)
+	if err != nil {
+		return KeyRotation{}, err
+	}
+	id, err := verifyingKeyID(vk)
+	if err != nil {
+		return KeyRotation{}, err
+	}
+
+	expires := now.Add(grace).UTC()
+	next := &circuitSetup{name: name, curve: old.curve, circuit: old.circuit, ccs: old.ccs, pk: pk, vk: vk, keyID: id, created: now.UTC()}
+	next.retired = unexpired(old.retired, now)
+	if grace > 0 {
+		next.retired = append(next.retired, keys.RetiredKey{ID: old.keyID, Key: old.vk, Expires: expires})
+	}
+
+	// Nothing is persisted or swapped in until the new keys prove and the old proofs still verify
+	canary, err := checkRotation(ctx, old, next, now)
+	if err != nil {
+		return KeyRotation{}, fmt.Errorf("rotating keys of %s: %w", name, err)
+	}
+	// Replaced keys are persisted with the new ones, so their grace window outlasts a restart
+	// and covers every replica sharing the key directory
+	if keyStore != nil {
+		if err := keyStore.SaveRotation(name, old.ccs, pk, vk, next.retired); err != nil {
+			return KeyRotation{}, fmt.Errorf("persisting keys of %s: %w", name, err)
+		}
+	}
+
+	m.replace(next)
+
+	audit.record(AuditEvent{
+		Type:    auditKeyRotated,
+		Circuit: name,
+		Subject: id,
+		Detail:  fmt.Sprintf("replaces %s, accepted until %s", old.keyID, expires.Format(time.RFC3339)),
+	})
+	return KeyRotation{Circuit: name, KeyID: id, PreviousKeyID: old.keyID, PreviousValidUntil: expires, Canary: canary}, nil
+}
+
+// RotateDue rotates every loaded setup whose keys are older than the configured interval
+func (m *KeyManager) RotateDue(ctx context.Context, now time.Time, cfg KeyRotationConfig) (int, error) {
+	due := m.due(now, cfg.Interval)
+	for i, name := range due {
+		r, err := m.Rotate(ctx, name, now, cfg.Grace)
+		if err != nil {
+			return i, fmt.Errorf("%s: %w", name, err)
+		}
+		log.Printf("🔑 Rotated keys of %s to %s, %s accepted until %s", name, r.KeyID, r.PreviousKeyID, r.PreviousValidUntil.Format(time.RFC3339))
+	}
+	return len(due), nil
+}
+
+// maxRotationCheck bounds how long keys stay in use past their interval
+const maxRotationCheck = time.Hour
+
+// startKeyRotation rotates due keys on its own ticker until stop is closed, so rotation does
+// not depend on the cleanup sweep and a slow setup does not hold up other sweeps
+func startKeyRotation(cfg KeyRotationConfig, stop <-chan struct{}) {
+	ticker := time.NewTicker(min(cfg.Interval, maxRotationCheck))
+	// Canary proofs yield to proving requests
+	ctx := withProvingLane(context.Background(), laneBatch)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				if _, err := keyManager.RotateDue(ctx, now, cfg); err != nil {
+					log.Printf("Key rotation failed: %v", err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// rotateKeys replaces the keys of a circuit on the curve named by ?curve= right away
+func rotateKeys(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	circuit, err := circuits.New(name)
+	if err != nil {
+		writeError(w, errs.Wrap(errs.NotFound, err))
+		return
+	}
+	curve, err := verifyCurve(r.URL.Query().Get("curve"), name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	// Rotating keys that were never used sets them up first
+	if _, err := loadCurveSetup(curve, name, circuit); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	rotation, err := keyManager.Rotate(r.Context(), keys.CurveName(name, curve), time.Now(), keyRotation.Grace)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, rotation)
+}
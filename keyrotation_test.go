@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/korjavin/zkTest1/keys"
+)
+
+func TestRotateSetup(t *testing.T) {
+	const name = "rotation-test"
+	t.Cleanup(func() {
+		keyManager.mu.Lock()
+		delete(keyManager.entries, name)
+		keyManager.mu.Unlock()
+	})
+
+	setup, err := loadCurveSetup(ecc.BN254, name, &savingsCircuit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prove := func(s *circuitSetup) groth16.Proof {
+		t.Helper()
+		proof, err := s.prove(context.Background(), &savingsCircuit{Savings: 5000, Minimum: 1000})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return proof
+	}
+	verify := func(proof groth16.Proof) error {
+		t.Helper()
+		current, err := loadCurveSetup(ecc.BN254, name, &savingsCircuit{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return current.verify(context.Background(), proof, &savingsCircuit{Minimum: 1000})
+	}
+	before := prove(setup)
+
+	now := time.Now()
+	rotation, err := keyManager.Rotate(context.Background(), name, now, time.Hour)
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if rotation.PreviousKeyID != setup.keyID || rotation.KeyID == setup.keyID || len(rotation.KeyID) != 16 {
+		t.Errorf("Unexpected rotation %+v of key %s", rotation, setup.keyID)
+	}
+	if !rotation.Canary.Proved || !rotation.Canary.Archived {
+		t.Errorf("Expected canaries with the new and the replaced keys to verify, got %+v", rotation.Canary)
+	}
+	if events := audit.latest(1); len(events) != 1 || events[0].Type != auditKeyRotated || events[0].Subject != rotation.KeyID {
+		t.Errorf("Expected key.rotated to be audited, got %+v", events)
+	}
+
+	rotated, _ := loadCurveSetup(ecc.BN254, name, &savingsCircuit{})
+	if rotated.keyID != rotation.KeyID {
+		t.Fatalf("Expected new setups to use the rotated key %s, got %s", rotation.KeyID, rotated.keyID)
+	}
+	after := prove(rotated)
+
+	if err := verify(before); err != nil {
+		t.Errorf("Expected a proof made with the previous key to verify within the grace window, got %v", err)
+	}
+	if err := verify(after); err != nil {
+		t.Errorf("Expected a proof made with the new key to verify, got %v", err)
+	}
+
+	// Past the grace window, only the current key and the one it just replaced are accepted
+	if _, err := keyManager.Rotate(context.Background(), name, now.Add(2*time.Hour), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(before); !errors.Is(err, errInvalidProof) {
+		t.Errorf("Expected a proof made with an expired key to be rejected, got %v", err)
+	}
+	if err := verify(after); err != nil {
+		t.Errorf("Expected a proof made with the replaced key to verify, got %v", err)
+	}
+
+	if _, err := keyManager.Rotate(context.Background(), "not-loaded", now, time.Hour); err == nil {
+		t.Error("Expected rotating keys that are not set up to fail")
+	}
+}
+
+func TestRotatePersistsRetiredKeys(t *testing.T) {
+	SkipIfShort(t, "key setup")
+
+	store, err := keys.NewStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	savedStore, savedManager := keyStore, keyManager
+	keyStore, keyManager = store, newKeyManager()
+	t.Cleanup(func() { keyStore, keyManager = savedStore, savedManager })
+
+	const name = "rotation-persist-test"
+	setup, err := loadCurveSetup(ecc.BN254, name, &savingsCircuit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := setup.prove(context.Background(), &savingsCircuit{Savings: 5000, Minimum: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keyManager.Rotate(context.Background(), name, time.Now(), time.Hour); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+
+	// A restarted server, or another replica, loads the replaced key from the key directory
+	keyManager = newKeyManager()
+	restarted, err := loadCurveSetup(ecc.BN254, name, &savingsCircuit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restarted.retired) != 1 || restarted.retired[0].ID != setup.keyID {
+		t.Fatalf("Expected the replaced key %s to be loaded, got %+v", setup.keyID, restarted.retired)
+	}
+	if err := restarted.verify(context.Background(), before, &savingsCircuit{Minimum: 1000}); err != nil {
+		t.Errorf("Expected a proof made with the previous key to verify after a restart, got %v", err)
+	}
+}
+
+func TestCheckRotation(t *testing.T) {
+	old, err := loadCurveSetup(ecc.BN254, savingsCircuitName, &savingsCircuit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, vk, err := groth16.Setup(old.ccs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	next := func(vk groth16.VerifyingKey, retired ...keys.RetiredKey) *circuitSetup {
+		return &circuitSetup{name: old.name, curve: old.curve, circuit: old.circuit, ccs: old.ccs, pk: pk, vk: vk, retired: retired}
+	}
+	grace := keys.RetiredKey{ID: old.keyID, Key: old.vk, Expires: now.Add(time.Hour)}
+
+	if canary, err := checkRotation(context.Background(), old, next(vk), now); err != nil || !canary.Proved || canary.Archived {
+		t.Errorf("Expected only the new keys to be checked without a grace window, got %+v, %v", canary, err)
+	}
+	if _, err := checkRotation(context.Background(), old, next(old.vk, grace), now); !errors.Is(err, errCanaryFailed) {
+		t.Errorf("Expected a verifying key that does not match the proving key to fail the canary, got %v", err)
+	}
+	// The replaced key must still be accepted at the time of the rotation
+	expired := grace
+	expired.Expires = now
+	if canary, err := checkRotation(context.Background(), old, next(vk, expired), now); !errors.Is(err, errCanaryFailed) || !canary.Proved {
+		t.Errorf("Expected proofs of a replaced key outside its grace window to fail the canary, got %+v, %v", canary, err)
+	}
+
+	// Canary proofs wait for a proving worker like requests do
+	saved := provers
+	provers = newProvingPool(1, 0, 0)
+	t.Cleanup(func() { provers = saved })
+	provers.acquire(context.Background(), laneInteractive, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := checkRotation(ctx, old, next(vk), now); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the canary to wait for the busy worker until the deadline, got %v", err)
+	}
+	provers.release(0)
+
+	unsampled := *old
+	unsampled.circuit = &CompositeCircuit{}
+	if canary, err := checkRotation(context.Background(), &unsampled, next(vk), now); err != nil || canary.Skipped == "" {
+		t.Errorf("Expected circuits without a sample to be rotated unchecked, got %+v, %v", canary, err)
+	}
+}
+
+func TestRotateDueKeys(t *testing.T) {
+	if n, err := keyManager.RotateDue(context.Background(), time.Now(), KeyRotationConfig{Interval: 100 * 365 * 24 * time.Hour}); err != nil || n != 0 {
+		t.Errorf("Expected no keys to be due, got %d, %v", n, err)
+	}
+}
+
+func TestRotateKeysHandler(t *testing.T) {
+	tests := []struct {
+		name    string
+		circuit string
+		query   string
+		status  int
+	}{
+		{"Unknown circuit", "unknown", "", http.StatusNotFound},
+		{"Unknown curve", savingsCircuitName, "?curve=secp256k1", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/admin/keys/"+tt.circuit+"/rotate"+tt.query, nil)
+			req.SetPathValue("name", tt.circuit)
+			rr := httptest.NewRecorder()
+			rotateKeys(rr, req)
+			if rr.Code != tt.status {
+				t.Errorf("Expected %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package keys
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+var (
+	// ErrDigestMismatch is returned when a key file does not match the digest recorded for it
+	ErrDigestMismatch = errors.New("key file does not match its recorded digest")
+	// ErrUnsigned is returned when a store that signs its checksums finds them unsigned or
+	// signed with another key
+	ErrUnsigned = errors.New("key checksums are not signed with the configured key")
+)
+
+// SignWith makes the store sign the checksums of keys it saves with HMAC-SHA256 under key, and
+// refuse keys whose checksums are missing or not signed with it. An empty key changes nothing.
+func (s *Store) SignWith(key string) {
+	if key != "" {
+		s.signingKey = []byte(key)
+	}
+}
+
+func (s *Store) checksumPath(name string) string {
+	return filepath.Join(s.dir, FileName(name)+".sha256sum")
+}
+
+// writeChecksums records the SHA-256 of each file in sha256sum format, and its signature when
+// the store signs checksums. It is written last, so a save interrupted while replacing keys
+// leaves files that fail the check rather than a mix of old and new keys.
+func (s *Store) writeChecksums(name string, files map[string][]byte) error {
+	var manifest bytes.Buffer
+	for _, path := range slices.Sorted(maps.Keys(files)) {
+		sum := sha256.Sum256(files[path])
+		fmt.Fprintf(&manifest, "%s  %s\n", hex.EncodeToString(sum[:]), filepath.Base(path))
+	}
+	if s.signingKey != nil {
+		if err := writeFileAtomic(s.checksumPath(name)+".sig", []byte(s.sign(manifest.Bytes())+"\n")); err != nil {
+			return err
+		}
+	}
+	return writeFileAtomic(s.checksumPath(name), manifest.Bytes())
+}
+
+func (s *Store) sign(manifest []byte) string {
+	mac := hmac.New(sha256.New, s.signingKey)
+	mac.Write(manifest)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyChecksums checks every file the checksums of a circuit list but the one named except,
+// taking the content of files already read from read, each of which must be listed. Keys saved
+// before checksums were recorded pass unless the store signs checksums.
+func (s *Store) verifyChecksums(name string, read map[string][]byte, except string) error {
+	manifest, err := os.ReadFile(s.checksumPath(name))
+	if errors.Is(err, os.ErrNotExist) && s.signingKey == nil {
+		return nil
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if s.signingKey != nil {
+		if manifest == nil {
+			return fmt.Errorf("%s: %w: no checksums recorded", name, ErrUnsigned)
+		}
+		sig, err := readStamp(s.checksumPath(name) + ".sig")
+		if err != nil {
+			return err
+		}
+		if !hmac.Equal([]byte(sig), []byte(s.sign(manifest))) {
+			return fmt.Errorf("%s: %w", name, ErrUnsigned)
+		}
+	}
+
+	listed := make(map[string]bool, len(read))
+	lines := bufio.NewScanner(bytes.NewReader(manifest))
+	for lines.Scan() {
+		expected, file, ok := strings.Cut(lines.Text(), "  ")
+		if !ok || file != filepath.Base(file) {
+			return fmt.Errorf("%s: malformed checksum line %q", name, lines.Text())
+		}
+		if file == except {
+			continue
+		}
+		path := filepath.Join(s.dir, file)
+		listed[path] = true
+		data, ok := read[path]
+		if !ok {
+			if data, err = os.ReadFile(path); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+		sum := sha256.Sum256(data)
+		if actual := hex.EncodeToString(sum[:]); actual != expected {
+			return fmt.Errorf("%s: %w: %s has sha256 %s, expected %s", name, ErrDigestMismatch, file, actual, expected)
+		}
+	}
+	if err := lines.Err(); err != nil {
+		return err
+	}
+	// A file added next to the keys after they were saved has no digest to match
+	for _, path := range slices.Sorted(maps.Keys(read)) {
+		if !listed[path] {
+			return fmt.Errorf("%s: %w: %s has no recorded digest", name, ErrDigestMismatch, filepath.Base(path))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package keys
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Encrypted key file layout: magic | scrypt salt | GCM nonce | ciphertext
+var encryptedKeyMagic = []byte("ZKPK1\x00")
+
+const (
+	keySaltSize = 16
+	scryptN     = 1 << 15
+	scryptR     = 8
+	scryptP     = 1
+)
+
+// ErrDecrypt is returned when an encrypted proving key cannot be opened
+var ErrDecrypt = errors.New("cannot decrypt proving key: wrong passphrase or corrupted file")
+
+// Cipher encrypts key material at rest. The label is authenticated so that
+// an encrypted key cannot be swapped for the key of another circuit.
+type Cipher interface {
+	Seal(label string, plaintext []byte) ([]byte, error)
+	Open(label string, sealed []byte) ([]byte, error)
+}
+
+// PassphraseCipher derives a fresh AES-256-GCM key from a passphrase with scrypt for every file
+type PassphraseCipher struct {
+	passphrase []byte
+}
+
+func NewPassphraseCipher(passphrase string) (*PassphraseCipher, error) {
+	if len(passphrase) < 12 {
+		return nil, errors.New("key passphrase must be at least 12 characters")
+	}
+	return &PassphraseCipher{passphrase: []byte(passphrase)}, nil
+}
+
+func (c *PassphraseCipher) aead(salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(c.passphrase, salt, scryptN, scryptR, scryptP, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (c *PassphraseCipher) Seal(label string, plaintext []byte) ([]byte, error) {
+	salt := make([]byte, keySaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := c.aead(salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(encryptedKeyMagic)+len(salt)+len(nonce)+len(plaintext)+aead.Overhead())
+	out = append(out, encryptedKeyMagic...)
+	out = append(out, salt...)
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, plaintext, []byte(label)), nil
+}
+
+func (c *PassphraseCipher) Open(label string, sealed []byte) ([]byte, error) {
+	if !bytes.HasPrefix(sealed, encryptedKeyMagic) {
+		return nil, fmt.Errorf("%w: not an encrypted key file", ErrDecrypt)
+	}
+	sealed = sealed[len(encryptedKeyMagic):]
+	if len(sealed) < keySaltSize {
+		return nil, ErrDecrypt
+	}
+
+	salt, rest := sealed[:keySaltSize], sealed[keySaltSize:]
+	aead, err := c.aead(salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+
+	nonce, ciphertext := rest[:aead.NonceSize()], rest[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(label))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,84 @@
+package keys
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/constraint"
+)
+
+// RetiredKey is a verifying key replaced by a rotation that still verifies proofs until Expires
+type RetiredKey struct {
+	ID      string
+	Key     groth16.VerifyingKey
+	Expires time.Time
+}
+
+// retiredEntry is a RetiredKey as kept in <name>.retired
+type retiredEntry struct {
+	ID      string    `json:"kid"`
+	Key     []byte    `json:"vk"`
+	Expires time.Time `json:"expires"`
+}
+
+func (s *Store) retiredPath(name string) string {
+	return filepath.Join(s.dir, FileName(name)+".retired")
+}
+
+// SaveRotation writes the keys of a circuit as Save does, along with the verifying keys they
+// replaced, which the checksums cover like the keys themselves
+func (s *Store) SaveRotation(name string, ccs constraint.ConstraintSystem, pk groth16.ProvingKey, vk groth16.VerifyingKey, retired []RetiredKey) error {
+	if len(retired) == 0 {
+		return s.Save(name, ccs, pk, vk)
+	}
+	entries := make([]retiredEntry, len(retired))
+	for i, r := range retired {
+		var buf bytes.Buffer
+		if _, err := r.Key.WriteTo(&buf); err != nil {
+			return err
+		}
+		entries[i] = retiredEntry{ID: r.ID, Key: buf.Bytes(), Expires: r.Expires.UTC()}
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	return s.save(name, ccs, pk, vk, data)
+}
+
+// LoadRetired reads the verifying keys replaced by the last rotation of a circuit, nil when
+// there are none. Like LoadVerifyingKey it checks every file but the proving key.
+func (s *Store) LoadRetired(name string) ([]RetiredKey, error) {
+	path := s.retiredPath(name)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	pkPath, _ := s.paths(name)
+	if err := s.verifyChecksums(name, map[string][]byte{path: data}, filepath.Base(pkPath)); err != nil {
+		return nil, err
+	}
+
+	var entries []retiredEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("%s: reading retired keys: %w", name, err)
+	}
+	retired := make([]RetiredKey, len(entries))
+	for i, e := range entries {
+		vk, err := readVerifyingKey(name, e.Key)
+		if err != nil {
+			return nil, fmt.Errorf("retired key %s: %w", e.ID, err)
+		}
+		retired[i] = RetiredKey{ID: e.ID, Key: vk, Expires: e.Expires}
+	}
+	return retired, nil
+}
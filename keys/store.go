@@ -0,0 +1,321 @@
+// Package keys persists Groth16 circuit keys, optionally encrypting proving keys at rest.
+package keys
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/consensys/gnark"
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/constraint"
+)
+
+// ErrCircuitMismatch is returned when persisted keys were set up for a different circuit
+var ErrCircuitMismatch = errors.New("keys were set up for a different circuit")
+
+// Store keeps the verifying key of each circuit in <name>.vk, its proving key in <name>.pk,
+// or <name>.pk.enc when proving keys are encrypted at rest, the fingerprint of the
+// constraint system they were set up for in <name>.ccs.sha256, the gnark release
+// that wrote them in <name>.gnark and the verifying keys a rotation replaced in
+// <name>.retired. The SHA-256 of these files is recorded in
+// <name>.sha256sum and checked on every load. Keys set up on a curve other than BN254 are
+// kept under the name CurveName returns.
+type Store struct {
+	dir        string
+	cipher     Cipher // nil stores proving keys in plaintext
+	signingKey []byte // HMAC key of the checksums; nil leaves them unsigned
+}
+
+// NewStore opens a key directory, creating it when missing
+func NewStore(dir string, cipher Cipher) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir, cipher: cipher}, nil
+}
+
+// FileName maps a circuit name such as "composite/age+balance" to a flat file name
+func FileName(name string) string {
+	return strings.NewReplacer("/", "__", "+", "_").Replace(name)
+}
+
+// curveSeparator joins a circuit name and the curve its keys were set up on
+const curveSeparator = "@"
+
+// CurveName returns the name the keys of a circuit set up on curve are kept under, such as
+// "balance@bls12_381"; BN254 keys keep the plain circuit name
+func CurveName(name string, curve ecc.ID) string {
+	if curve == ecc.BN254 {
+		return name
+	}
+	return name + curveSeparator + curve.String()
+}
+
+// CurveOf returns the curve the keys kept under name were set up on
+func CurveOf(name string) (ecc.ID, error) {
+	_, curve, ok := strings.Cut(name, curveSeparator)
+	if !ok {
+		return ecc.BN254, nil
+	}
+	id, err := ecc.IDFromString(curve)
+	if err != nil {
+		return ecc.UNKNOWN, fmt.Errorf("%s: unknown curve %q", name, curve)
+	}
+	return id, nil
+}
+
+func (s *Store) paths(name string) (pkPath, vkPath string) {
+	base := filepath.Join(s.dir, FileName(name))
+	pkPath = base + ".pk"
+	if s.cipher != nil {
+		pkPath += ".enc"
+	}
+	return pkPath, base + ".vk"
+}
+
+// ProvingKeyFile returns the file holding the proving key of a circuit and whether it is
+// encrypted, whichever of the two exists regardless of the store's cipher
+func (s *Store) ProvingKeyFile(name string) (path string, encrypted bool, err error) {
+	base := filepath.Join(s.dir, FileName(name)) + ".pk"
+	for _, path := range []string{base + ".enc", base} {
+		if _, err := os.Stat(path); err == nil || !errors.Is(err, os.ErrNotExist) {
+			return path, path != base, err
+		}
+	}
+	return "", false, os.ErrNotExist
+}
+
+func (s *Store) fingerprintPath(name string) string {
+	return filepath.Join(s.dir, FileName(name)+".ccs.sha256")
+}
+
+func (s *Store) versionPath(name string) string {
+	return filepath.Join(s.dir, FileName(name)+".gnark")
+}
+
+// GnarkVersion returns the gnark release that wrote the keys of a circuit, or "" when keys
+// were saved before releases were recorded
+func (s *Store) GnarkVersion(name string) (string, error) {
+	return readStamp(s.versionPath(name))
+}
+
+// SavedAt returns when the keys of a circuit were written
+func (s *Store) SavedAt(name string) (time.Time, error) {
+	_, vkPath := s.paths(name)
+	info, err := os.Stat(vkPath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+// readStamp reads a one-line file written next to the keys; a missing file reads as ""
+func readStamp(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// Fingerprint returns the hex SHA-256 of a serialized constraint system
+func Fingerprint(ccs constraint.ConstraintSystem) (string, error) {
+	h := sha256.New()
+	if _, err := ccs.WriteTo(h); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// StoredFingerprint returns the fingerprint the keys of a circuit were saved with, or "" when
+// they were saved before fingerprints were recorded
+func (s *Store) StoredFingerprint(name string) (string, error) {
+	return readStamp(s.fingerprintPath(name))
+}
+
+// Verify checks that persisted keys were set up for ccs. Keys saved without a fingerprint
+// are only checked for the number of public inputs.
+func (s *Store) Verify(name string, ccs constraint.ConstraintSystem, vk groth16.VerifyingKey) error {
+	// Besides the public inputs, the verifying key has an input per commitment, e.g. of a range checker
+	if want := ccs.GetNbPublicVariables() - 1 + len(ccs.GetCommitments().CommitmentIndexes()); vk.NbPublicWitness() != want {
+		return fmt.Errorf("%s: %w: verifying key has %d public inputs, circuit has %d", name, ErrCircuitMismatch, vk.NbPublicWitness(), want)
+	}
+
+	stored, err := s.StoredFingerprint(name)
+	if err != nil || stored == "" {
+		return err
+	}
+	fp, err := Fingerprint(ccs)
+	if err != nil {
+		return err
+	}
+	if stored != fp {
+		return fmt.Errorf("%s: %w: keys fingerprint %.12s, compiled circuit %.12s", name, ErrCircuitMismatch, stored, fp)
+	}
+	return nil
+}
+
+// Load reads the keys of a circuit; found is false when they have not been persisted yet
+func (s *Store) Load(name string) (pk groth16.ProvingKey, vk groth16.VerifyingKey, found bool, err error) {
+	pkPath, vkPath := s.paths(name)
+
+	pkData, err := os.ReadFile(pkPath)
+	if errors.Is(err, os.ErrNotExist) {
+		if s.cipher != nil {
+			if _, plainErr := os.Stat(strings.TrimSuffix(pkPath, ".enc")); plainErr == nil {
+				return nil, nil, false, fmt.Errorf("%s: refusing to use an unencrypted proving key while encryption is enabled", name)
+			}
+		}
+		return nil, nil, false, nil
+	}
+	if err != nil {
+		return nil, nil, false, err
+	}
+	vkData, err := os.ReadFile(vkPath)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	// Files are checked as stored, so a tampered proving key is reported before decryption fails
+	if err := s.verifyChecksums(name, map[string][]byte{pkPath: pkData, vkPath: vkData}, ""); err != nil {
+		return nil, nil, false, err
+	}
+	if s.cipher != nil {
+		if pkData, err = s.cipher.Open(name, pkData); err != nil {
+			return nil, nil, false, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	vk, err = readVerifyingKey(name, vkData)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	curve, err := CurveOf(name)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	pk = groth16.NewProvingKey(curve)
+	if _, err := pk.ReadFrom(bytes.NewReader(pkData)); err != nil {
+		return nil, nil, false, fmt.Errorf("%s: reading proving key: %w", name, err)
+	}
+	return pk, vk, true, nil
+}
+
+// LoadVerifyingKey reads only the verifying key of a circuit, which is never encrypted. The
+// checksums of its other files are verified all the same, except that of the proving key.
+func (s *Store) LoadVerifyingKey(name string) (groth16.VerifyingKey, error) {
+	pkPath, vkPath := s.paths(name)
+	vkData, err := os.ReadFile(vkPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.verifyChecksums(name, map[string][]byte{vkPath: vkData}, filepath.Base(pkPath)); err != nil {
+		return nil, err
+	}
+	return readVerifyingKey(name, vkData)
+}
+
+// readVerifyingKey parses the verifying key of a circuit
+func readVerifyingKey(name string, vkData []byte) (groth16.VerifyingKey, error) {
+	curve, err := CurveOf(name)
+	if err != nil {
+		return nil, err
+	}
+	vk := groth16.NewVerifyingKey(curve)
+	if _, err := vk.ReadFrom(bytes.NewReader(vkData)); err != nil {
+		return nil, fmt.Errorf("%s: reading verifying key: %w", name, err)
+	}
+	return vk, nil
+}
+
+// Save writes the keys of a circuit with the fingerprint of ccs, encrypting the proving key when configured
+func (s *Store) Save(name string, ccs constraint.ConstraintSystem, pk groth16.ProvingKey, vk groth16.VerifyingKey) error {
+	return s.save(name, ccs, pk, vk, nil)
+}
+
+// save writes the keys of a circuit and the encoded keys they replaced, removing those of an
+// earlier rotation when retired is nil
+func (s *Store) save(name string, ccs constraint.ConstraintSystem, pk groth16.ProvingKey, vk groth16.VerifyingKey, retired []byte) error {
+	pkPath, vkPath := s.paths(name)
+
+	fp, err := Fingerprint(ccs)
+	if err != nil {
+		return err
+	}
+
+	var pkBuf, vkBuf bytes.Buffer
+	if _, err := pk.WriteTo(&pkBuf); err != nil {
+		return err
+	}
+	if _, err := vk.WriteTo(&vkBuf); err != nil {
+		return err
+	}
+
+	pkData := pkBuf.Bytes()
+	if s.cipher != nil {
+		if pkData, err = s.cipher.Seal(name, pkData); err != nil {
+			return err
+		}
+	}
+
+	if err := writeFileAtomic(vkPath, vkBuf.Bytes()); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(pkPath, pkData); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.fingerprintPath(name), []byte(fp+"\n")); err != nil {
+		return err
+	}
+	version := []byte(gnark.Version.String() + "\n")
+	if err := writeFileAtomic(s.versionPath(name), version); err != nil {
+		return err
+	}
+	files := map[string][]byte{
+		pkPath:                  pkData,
+		vkPath:                  vkBuf.Bytes(),
+		s.fingerprintPath(name): []byte(fp + "\n"),
+		s.versionPath(name):     version,
+	}
+	if retired != nil {
+		if err := writeFileAtomic(s.retiredPath(name), retired); err != nil {
+			return err
+		}
+		files[s.retiredPath(name)] = retired
+	} else if err := os.Remove(s.retiredPath(name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return s.writeChecksums(name, files)
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Open opens a key directory as the server does: proving keys are encrypted
+// with passphrase when it is set, and stored in plaintext otherwise
+func Open(dir, passphrase string) (*Store, error) {
+	if passphrase == "" {
+		return NewStore(dir, nil)
+	}
+	cipher, err := NewPassphraseCipher(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return NewStore(dir, cipher)
+}
@@ -0,0 +1,307 @@
+package keys
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark"
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/korjavin/zkTest1/circuits"
+)
+
+func TestPassphraseCipher(t *testing.T) {
+	if _, err := NewPassphraseCipher("short"); err == nil {
+		t.Error("Expected short passphrases to be rejected")
+	}
+
+	c, _ := NewPassphraseCipher("correct horse battery")
+	sealed, err := c.Seal("balance", []byte("proving key bytes"))
+	if err != nil {
+		t.Fatalf("Seal failed: %v", err)
+	}
+	if bytes.Contains(sealed, []byte("proving key bytes")) {
+		t.Error("Expected sealed data not to contain the plaintext")
+	}
+
+	if got, err := c.Open("balance", sealed); err != nil || string(got) != "proving key bytes" {
+		t.Errorf("Expected round trip, got %q, %v", got, err)
+	}
+
+	wrong, _ := NewPassphraseCipher("incorrect horse battery")
+	if _, err := wrong.Open("balance", sealed); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Expected ErrDecrypt for a wrong passphrase, got %v", err)
+	}
+	if _, err := c.Open("balance-committed", sealed); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Expected ErrDecrypt for a swapped key file, got %v", err)
+	}
+}
+
+func TestStore(t *testing.T) {
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &circuits.BalanceCircuit{})
+	if err != nil {
+		t.Fatalf("Failed to compile circuit: %v", err)
+	}
+	pk, vk, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+
+	dir := t.TempDir()
+	c, _ := NewPassphraseCipher("correct horse battery")
+	store, _ := NewStore(dir, c)
+
+	if _, _, found, err := store.Load("composite/age+balance"); found || err != nil {
+		t.Fatalf("Expected no keys yet, got found=%v, %v", found, err)
+	}
+	if err := store.Save("composite/age+balance", ccs, pk, vk); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "composite__age_balance.pk.enc")); err != nil {
+		t.Errorf("Expected encrypted proving key file: %v", err)
+	}
+	if path, enc, err := store.ProvingKeyFile("composite/age+balance"); err != nil || !enc || filepath.Base(path) != "composite__age_balance.pk.enc" {
+		t.Errorf("Expected the encrypted proving key file, got %q, %v, %v", path, enc, err)
+	}
+	if v, err := store.GnarkVersion("composite/age+balance"); v != gnark.Version.String() || err != nil {
+		t.Errorf("Expected keys to record gnark %s, got %q, %v", gnark.Version, v, err)
+	}
+	if saved, err := store.SavedAt("composite/age+balance"); err != nil || time.Since(saved) > time.Minute {
+		t.Errorf("Expected the keys to have just been saved, got %v, %v", saved, err)
+	}
+
+	loadedPK, loadedVK, found, err := store.Load("composite/age+balance")
+	if err != nil || !found {
+		t.Fatalf("Expected keys to load, got found=%v, %v", found, err)
+	}
+
+	// A proof made with the loaded proving key verifies with the loaded verifying key
+	witness, _ := frontend.NewWitness(&circuits.BalanceCircuit{Balance: 10, NeededAmount: 5}, ecc.BN254.ScalarField())
+	proof, err := groth16.Prove(ccs, loadedPK, witness)
+	if err != nil {
+		t.Fatalf("Prove with loaded key failed: %v", err)
+	}
+	public, _ := witness.Public()
+	if err := groth16.Verify(proof, loadedVK, public); err != nil {
+		t.Errorf("Expected proof to verify with loaded key: %v", err)
+	}
+
+	t.Run("Wrong passphrase", func(t *testing.T) {
+		wrong, _ := NewPassphraseCipher("incorrect horse battery")
+		other, _ := NewStore(dir, wrong)
+		if _, _, _, err := other.Load("composite/age+balance"); !errors.Is(err, ErrDecrypt) {
+			t.Errorf("Expected ErrDecrypt, got %v", err)
+		}
+	})
+
+	t.Run("Plaintext key with encryption enabled", func(t *testing.T) {
+		plainDir := t.TempDir()
+		plain, _ := NewStore(plainDir, nil)
+		if err := plain.Save("balance", ccs, pk, vk); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+		encrypted, _ := NewStore(plainDir, c)
+		if _, _, _, err := encrypted.Load("balance"); err == nil {
+			t.Error("Expected an unencrypted proving key to be refused")
+		}
+		if path, enc, err := encrypted.ProvingKeyFile("balance"); err != nil || enc || filepath.Base(path) != "balance.pk" {
+			t.Errorf("Expected the plaintext proving key to be found, got %q, %v, %v", path, enc, err)
+		}
+		if path, enc, err := plain.ProvingKeyFile("composite/age+balance"); err == nil {
+			t.Errorf("Expected no proving key, got %q, %v", path, enc)
+		}
+	})
+
+	t.Run("Circuit fingerprint", func(t *testing.T) {
+		if err := store.Verify("composite/age+balance", ccs, loadedVK); err != nil {
+			t.Errorf("Expected keys to match their circuit, got %v", err)
+		}
+
+		other, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &circuits.BucketCircuit{})
+		if err != nil {
+			t.Fatalf("Failed to compile circuit: %v", err)
+		}
+		if err := store.Verify("composite/age+balance", other, loadedVK); !errors.Is(err, ErrCircuitMismatch) {
+			t.Errorf("Expected ErrCircuitMismatch for another circuit, got %v", err)
+		}
+
+		// Without a fingerprint only the public inputs can be compared
+		os.Remove(filepath.Join(dir, "composite__age_balance.ccs.sha256"))
+		if err := store.Verify("composite/age+balance", ccs, loadedVK); err != nil {
+			t.Errorf("Expected legacy keys to pass, got %v", err)
+		}
+		if err := store.Verify("composite/age+balance", other, loadedVK); !errors.Is(err, ErrCircuitMismatch) {
+			t.Errorf("Expected ErrCircuitMismatch for a different number of public inputs, got %v", err)
+		}
+	})
+
+	t.Run("Other curve", func(t *testing.T) {
+		name := CurveName("balance", ecc.BLS12_381)
+		if name != "balance@bls12_381" || CurveName("balance", ecc.BN254) != "balance" {
+			t.Fatalf("Unexpected curve names %q", name)
+		}
+
+		blsCCS, err := frontend.Compile(ecc.BLS12_381.ScalarField(), r1cs.NewBuilder, &circuits.BalanceCircuit{})
+		if err != nil {
+			t.Fatalf("Failed to compile circuit: %v", err)
+		}
+		blsPK, blsVK, err := groth16.Setup(blsCCS)
+		if err != nil {
+			t.Fatalf("Setup failed: %v", err)
+		}
+		if err := store.Save(name, blsCCS, blsPK, blsVK); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+
+		loadedPK, loadedVK, found, err := store.Load(name)
+		if err != nil || !found {
+			t.Fatalf("Expected BLS12-381 keys to load, got found=%v, %v", found, err)
+		}
+		if loadedPK.CurveID() != ecc.BLS12_381 || loadedVK.CurveID() != ecc.BLS12_381 {
+			t.Errorf("Expected keys on BLS12-381, got %s and %s", loadedPK.CurveID(), loadedVK.CurveID())
+		}
+		if err := store.Verify(name, blsCCS, loadedVK); err != nil {
+			t.Errorf("Expected keys to match their circuit, got %v", err)
+		}
+
+		if _, err := CurveOf("balance@teleport"); err == nil {
+			t.Error("Expected an unknown curve suffix to be rejected")
+		}
+	})
+}
+
+func TestStoreChecksums(t *testing.T) {
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &circuits.BalanceCircuit{})
+	if err != nil {
+		t.Fatalf("Failed to compile circuit: %v", err)
+	}
+	pk, vk, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+
+	dir := t.TempDir()
+	store, _ := NewStore(dir, nil)
+	if err := store.Save("balance", ccs, pk, vk); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	sums, err := os.ReadFile(filepath.Join(dir, "balance.sha256sum"))
+	if err != nil || bytes.Count(sums, []byte("\n")) != 4 {
+		t.Fatalf("Expected checksums of four files, got %q, %v", sums, err)
+	}
+
+	for _, file := range []string{"balance.vk", "balance.pk", "balance.ccs.sha256", "balance.gnark"} {
+		t.Run("Tampered "+file, func(t *testing.T) {
+			path := filepath.Join(dir, file)
+			original, _ := os.ReadFile(path)
+			t.Cleanup(func() { os.WriteFile(path, original, 0o600) })
+			tampered := append(bytes.Clone(original[:len(original)-1]), original[len(original)-1]^1)
+			os.WriteFile(path, tampered, 0o600)
+
+			_, _, _, err := store.Load("balance")
+			if !errors.Is(err, ErrDigestMismatch) || !bytes.Contains([]byte(err.Error()), []byte(file)) {
+				t.Errorf("Expected ErrDigestMismatch naming %s, got %v", file, err)
+			}
+			_, err = store.LoadVerifyingKey("balance")
+			if file == "balance.pk" {
+				// Verifying does not need the proving key
+				if err != nil {
+					t.Errorf("Expected the verifying key to load despite the proving key, got %v", err)
+				}
+			} else if !errors.Is(err, ErrDigestMismatch) {
+				t.Errorf("Expected the verifying key to be refused too, got %v", err)
+			}
+		})
+	}
+
+	t.Run("Signed", func(t *testing.T) {
+		signedDir := t.TempDir()
+		signed, _ := NewStore(signedDir, nil)
+		signed.SignWith("checksum key")
+		if err := signed.Save("balance", ccs, pk, vk); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+		if _, _, found, err := signed.Load("balance"); !found || err != nil {
+			t.Fatalf("Expected signed keys to load, got found=%v, %v", found, err)
+		}
+
+		other, _ := NewStore(signedDir, nil)
+		other.SignWith("another key")
+		if _, _, _, err := other.Load("balance"); !errors.Is(err, ErrUnsigned) {
+			t.Errorf("Expected ErrUnsigned with another key, got %v", err)
+		}
+
+		// Keys saved without checksums are refused once checksums are signed
+		signed, _ = NewStore(dir, nil)
+		signed.SignWith("checksum key")
+		os.Remove(filepath.Join(dir, "balance.sha256sum"))
+		if _, _, _, err := store.Load("balance"); err != nil {
+			t.Errorf("Expected keys without checksums to load unsigned, got %v", err)
+		}
+		if _, _, _, err := signed.Load("balance"); !errors.Is(err, ErrUnsigned) {
+			t.Errorf("Expected ErrUnsigned without checksums, got %v", err)
+		}
+	})
+}
+
+func TestStoreRetiredKeys(t *testing.T) {
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &circuits.BalanceCircuit{})
+	if err != nil {
+		t.Fatalf("Failed to compile circuit: %v", err)
+	}
+	pk, vk, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+	_, oldVK, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+
+	dir := t.TempDir()
+	store, _ := NewStore(dir, nil)
+	store.SignWith("checksum key")
+	if retired, err := store.LoadRetired("balance"); retired != nil || err != nil {
+		t.Fatalf("Expected no retired keys before a rotation, got %v, %v", retired, err)
+	}
+
+	expires := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	if err := store.SaveRotation("balance", ccs, pk, vk, []RetiredKey{{ID: "0123456789abcdef", Key: oldVK, Expires: expires}}); err != nil {
+		t.Fatalf("SaveRotation failed: %v", err)
+	}
+	retired, err := store.LoadRetired("balance")
+	if err != nil || len(retired) != 1 || retired[0].ID != "0123456789abcdef" || !retired[0].Expires.Equal(expires) {
+		t.Fatalf("Expected the retired key to round trip, got %+v, %v", retired, err)
+	}
+	var want, got bytes.Buffer
+	oldVK.WriteTo(&want)
+	retired[0].Key.WriteTo(&got)
+	if !bytes.Equal(want.Bytes(), got.Bytes()) {
+		t.Error("Expected the retired verifying key to round trip")
+	}
+
+	path := filepath.Join(dir, "balance.retired")
+	original, _ := os.ReadFile(path)
+	os.WriteFile(path, append(bytes.Clone(original), ' '), 0o600)
+	if _, err := store.LoadRetired("balance"); !errors.Is(err, ErrDigestMismatch) {
+		t.Errorf("Expected ErrDigestMismatch for tampered retired keys, got %v", err)
+	}
+
+	// A save without a rotation drops the retired keys, and they cannot be planted back
+	if err := store.Save("balance", ccs, pk, vk); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected Save to remove the retired keys, got %v", err)
+	}
+	os.WriteFile(path, original, 0o600)
+	if _, err := store.LoadRetired("balance"); !errors.Is(err, ErrDigestMismatch) {
+		t.Errorf("Expected ErrDigestMismatch for retired keys without a digest, got %v", err)
+	}
+}
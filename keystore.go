@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/korjavin/zkTest1/keys"
+)
+
+// Secrets of the key store
+const (
+	keyPassphraseSecret = "key-passphrase"  // proving key passphrase
+	keySigningSecret    = "key-signing-key" // HMAC key of the key checksums
+)
+
+// KeyStoreConfig configures persistence of Groth16 keys
+type KeyStoreConfig struct {
+	Dir     string // keys are kept in memory only when empty
+	Encrypt bool   // encrypt proving keys with the key-passphrase secret
+	Sign    bool   // sign key checksums with the key-signing-key secret and refuse unsigned keys
+}
+
+// keyStore persists circuit keys across restarts; nil keeps keys in memory only
+var keyStore *keys.Store
+
+// newKeyStore opens the configured key store, reading the passphrase when encryption is enabled
+func newKeyStore(cfg KeyStoreConfig, p SecretProvider) (*keys.Store, error) {
+	if cfg.Dir == "" {
+		if cfg.Encrypt || cfg.Sign {
+			return nil, errors.New("key encryption and signing require a key directory")
+		}
+		return nil, nil
+	}
+
+	var cipher keys.Cipher
+	if cfg.Encrypt {
+		passphrase, err := p.Secret(context.Background(), keyPassphraseSecret)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", keyPassphraseSecret, err)
+		}
+		if cipher, err = keys.NewPassphraseCipher(passphrase); err != nil {
+			return nil, err
+		}
+	}
+	store, err := keys.NewStore(cfg.Dir, cipher)
+	if err != nil || !cfg.Sign {
+		return store, err
+	}
+	key, err := p.Secret(context.Background(), keySigningSecret)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", keySigningSecret, err)
+	}
+	store.SignWith(key)
+	return store, nil
+}
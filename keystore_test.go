@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/korjavin/zkTest1/circuits"
+	"github.com/korjavin/zkTest1/internal/errs"
+	"github.com/korjavin/zkTest1/keys"
+)
+
+func TestNewKeyStoreRequiresPassphrase(t *testing.T) {
+	if _, err := newKeyStore(KeyStoreConfig{Dir: t.TempDir(), Encrypt: true}, failingSecrets{}); err == nil {
+		t.Error("Expected an error when the passphrase cannot be read")
+	}
+	if _, err := newKeyStore(KeyStoreConfig{Encrypt: true}, envSecrets{}); err == nil {
+		t.Error("Expected an error when encryption is enabled without a key directory")
+	}
+	if _, err := newKeyStore(KeyStoreConfig{Dir: t.TempDir(), Sign: true}, failingSecrets{}); err == nil {
+		t.Error("Expected an error when the signing key cannot be read")
+	}
+	if store, err := newKeyStore(KeyStoreConfig{}, envSecrets{}); store != nil || err != nil {
+		t.Errorf("Expected no key store by default, got %v, %v", store, err)
+	}
+}
+
+func TestLoadOrCreateKeysRejectsChangedCircuit(t *testing.T) {
+	SkipIfShort(t, "key setup")
+
+	store, err := keys.NewStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("Failed to open key store: %v", err)
+	}
+	saved := keyStore
+	keyStore = store
+	defer func() { keyStore = saved }()
+
+	balance, _ := circuits.Compile(&circuits.BalanceCircuit{})
+	if _, _, _, err := loadOrCreateKeys("balance", balance); err != nil {
+		t.Fatalf("Expected keys to be created, got %v", err)
+	}
+	if _, _, _, err := loadOrCreateKeys("balance", balance); err != nil {
+		t.Fatalf("Expected persisted keys to load, got %v", err)
+	}
+
+	// Same number of public inputs, so only the fingerprint tells the circuits apart
+	committed, _ := circuits.Compile(&circuits.CommittedBalanceCircuit{})
+	if _, _, _, err := loadOrCreateKeys("balance", committed); !errors.Is(err, errs.ErrKeyMismatch) || errs.Code(err) != "key_mismatch" {
+		t.Errorf("Expected ErrKeyMismatch for a changed circuit, got %v", err)
+	}
+}
+
+func TestLoadOrCreateKeysVerifyOnly(t *testing.T) {
+	SkipIfShort(t, "key setup")
+
+	dir := t.TempDir()
+	store, err := keys.NewStore(dir, nil)
+	if err != nil {
+		t.Fatalf("Failed to open key store: %v", err)
+	}
+	saved := keyStore
+	keyStore = store
+	defer func() { keyStore = saved }()
+
+	balance, _ := circuits.Compile(&circuits.BalanceCircuit{})
+	_, vk, _, err := loadOrCreateKeys("balance", balance)
+	if err != nil {
+		t.Fatalf("Expected keys to be created, got %v", err)
+	}
+	id, _ := verifyingKeyID(vk)
+
+	for name, damage := range map[string]func(path string) error{
+		"Missing":   os.Remove,
+		"Corrupted": func(path string) error { return os.WriteFile(path, []byte("not a key"), 0o600) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			if err := damage(filepath.Join(dir, "balance.pk")); err != nil {
+				t.Fatal(err)
+			}
+			pk, loaded, verifyOnly, err := loadOrCreateKeys("balance", balance)
+			if err != nil || pk != nil || verifyOnly == "" {
+				t.Fatalf("Expected a verify-only setup, got pk=%v, reason %q, %v", pk, verifyOnly, err)
+			}
+			// The persisted verifying key is kept rather than replaced by a new setup
+			if loadedID, _ := verifyingKeyID(loaded); loadedID != id {
+				t.Errorf("Expected verifying key %s, got %s", id, loadedID)
+			}
+
+			setup := &circuitSetup{name: "balance", ccs: balance, vk: loaded, verifyOnly: verifyOnly}
+			_, err = setup.prove(context.Background(), &circuits.BalanceCircuit{})
+			if !errors.Is(err, errProvingUnavailable) || errs.Status(err) != 503 {
+				t.Errorf("Expected %v with status 503, got %v", errProvingUnavailable, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// System accounts are prefixed with "@"; unlike user accounts they may go negative
+const (
+	systemAccountPrefix = "@"
+	adjustmentAccount   = "@adjustment" // counterpart of balances set directly, e.g. through /store/sum
+)
+
+// maxLedgerEntries caps the number of entries in one posted transaction
+const maxLedgerEntries = 32
+
+// LedgerEntry moves amount into (positive) or out of (negative) an account
+type LedgerEntry struct {
+	Account string `json:"account"`
+	Amount  int    `json:"amount"`
+}
+
+// LedgerTransaction is a balanced set of entries; the amounts of its entries sum to zero
+type LedgerTransaction struct {
+	ID      int64         `json:"id"`
+	Time    time.Time     `json:"time"`
+	Memo    string        `json:"memo,omitempty"`
+	Entries []LedgerEntry `json:"entries"`
+}
+
+// LedgerPosting is one transaction as seen from one account, with the running balance after it
+type LedgerPosting struct {
+	TransactionID int64     `json:"transactionId"`
+	Time          time.Time `json:"time"`
+	Memo          string    `json:"memo,omitempty"`
+	Amount        int       `json:"amount"`
+	Balance       int       `json:"balance"`
+}
+
+// LedgerAccount is returned by GET /admin/ledger/accounts/{id}
+type LedgerAccount struct {
+	Account  string          `json:"account"`
+	Balance  int             `json:"balance"`
+	Postings []LedgerPosting `json:"postings"`
+}
+
+// TrialBalance is returned by GET /admin/ledger/balances; Balanced is false if the books do not sum to zero
+type TrialBalance struct {
+	Transactions int            `json:"transactions"`
+	Balances     map[string]int `json:"balances"`
+	Balanced     bool           `json:"balanced"`
+	Consistent   bool           `json:"consistent"` // stored balances match the replayed ledger
+}
+
+type LedgerTransactionRequest struct {
+	Memo    string        `json:"memo"`
+	Entries []LedgerEntry `json:"entries"`
+}
+
+// The ledger is the source of truth for balances: balances, balanceUpdated and balanceVersions
+// are its projection for user accounts. All of it is guarded by balancesMu.
+var (
+	ledgerTransactions []LedgerTransaction
+	ledgerPostings     = make(map[string][]LedgerPosting)
+	ledgerBalances     = make(map[string]int)
+)
+
+var (
+	errUnbalanced        = errs.New(errs.Invalid, "unbalanced_entries", "entries must sum to zero")
+	errInsufficientFunds = errs.New(errs.Conflict, "insufficient_funds", "transaction would overdraw an account")
+)
+
+func isSystemAccount(account string) bool {
+	return strings.HasPrefix(account, systemAccountPrefix)
+}
+
+// checkLedgerEntries validates a transaction before it is posted
+func checkLedgerEntries(entries []LedgerEntry) error {
+	if len(entries) < 2 || len(entries) > maxLedgerEntries {
+		return fmt.Errorf("a transaction needs between 2 and %d entries", maxLedgerEntries)
+	}
+	sum := 0
+	for _, e := range entries {
+		if e.Account == "" || e.Account == systemAccountPrefix {
+			return errors.New("every entry needs an account")
+		}
+		if e.Amount == 0 {
+			return fmt.Errorf("entry for %q has no amount", e.Account)
+		}
+		sum += e.Amount
+	}
+	if sum != 0 {
+		return errUnbalanced
+	}
+	return nil
+}
+
+// postLedgerLocked appends a transaction and updates the balances of every account it touches.
+// User accounts must not go negative. Callers must hold balancesMu and have checked the entries.
+func postLedgerLocked(memo string, entries []LedgerEntry, now time.Time) (LedgerTransaction, error) {
+	after := make(map[string]int, len(entries))
+	for _, e := range entries {
+		if _, ok := after[e.Account]; !ok {
+			after[e.Account] = ledgerBalances[e.Account]
+		}
+		after[e.Account] += e.Amount
+	}
+	for account, balance := range after {
+		if balance < 0 && !isSystemAccount(account) {
+			return LedgerTransaction{}, errInsufficientFunds
+		}
+	}
+
+	tx := appendLedgerLocked(memo, entries, now)
+	for account, balance := range after {
+		if !isSystemAccount(account) {
+			projectBalanceLocked(account, balance, now)
+			delete(balanceAttestations, account) // ledger balances are not bank-attested
+		}
+	}
+	return tx, nil
+}
+
+// appendLedgerLocked records a transaction and the postings of its accounts without touching the
+// balance projection; callers must hold balancesMu
+func appendLedgerLocked(memo string, entries []LedgerEntry, now time.Time) LedgerTransaction {
+	tx := LedgerTransaction{
+		ID:      int64(len(ledgerTransactions) + 1),
+		Time:    now,
+		Memo:    memo,
+		Entries: append([]LedgerEntry(nil), entries...),
+	}
+	ledgerTransactions = append(ledgerTransactions, tx)
+
+	for _, e := range entries {
+		ledgerBalances[e.Account] += e.Amount
+		ledgerPostings[e.Account] = append(ledgerPostings[e.Account], LedgerPosting{
+			TransactionID: tx.ID, Time: now, Memo: memo, Amount: e.Amount, Balance: ledgerBalances[e.Account],
+		})
+	}
+	return tx
+}
+
+// lastLedgerTransaction returns the id of the latest transaction that touched account; callers must hold balancesMu
+func lastLedgerTransaction(account string) int64 {
+	postings := ledgerPostings[account]
+	if len(postings) == 0 {
+		return 0
+	}
+	return postings[len(postings)-1].TransactionID
+}
+
+// lookupBalance returns the stored balance of id and the ledger transaction it reflects
+func lookupBalance(id string) (balance int, ledgerTx int64, ok bool) {
+	balancesMu.Lock()
+	defer balancesMu.Unlock()
+	balance, ok = balances[id]
+	return balance, lastLedgerTransaction(id), ok
+}
+
+// replayLedgerLocked derives every account balance from the transaction history alone
+func replayLedgerLocked() map[string]int {
+	derived := make(map[string]int)
+	for _, tx := range ledgerTransactions {
+		for _, e := range tx.Entries {
+			derived[e.Account] += e.Amount
+		}
+	}
+	return derived
+}
+
+// postLedgerTransaction posts a balanced transaction between accounts
+func postLedgerTransaction(w http.ResponseWriter, r *http.Request) {
+	var req LedgerTransactionRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := checkLedgerEntries(req.Entries); err != nil {
+		writeError(w, errs.Wrap(errs.Invalid, err))
+		return
+	}
+
+	balancesMu.Lock()
+	tx, err := postLedgerLocked(req.Memo, req.Entries, time.Now())
+	balancesMu.Unlock()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	audit.record(AuditEvent{Type: auditLedgerPosted, Detail: fmt.Sprintf("transaction %d, %d entries", tx.ID, len(tx.Entries))})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	writeJSON(w, tx)
+}
+
+// getLedgerAccount returns the balance and postings of one account
+func getLedgerAccount(w http.ResponseWriter, r *http.Request) {
+	account := r.PathValue("id")
+
+	balancesMu.Lock()
+	postings, ok := ledgerPostings[account]
+	resp := LedgerAccount{Account: account, Balance: ledgerBalances[account], Postings: append([]LedgerPosting(nil), postings...)}
+	balancesMu.Unlock()
+
+	if !ok {
+		writeError(w, errs.Errorf(errs.NotFound, "account has no ledger history"))
+		return
+	}
+	writeJSON(w, resp)
+}
+
+// getTrialBalance replays the ledger and checks it against the stored balances
+func getTrialBalance(w http.ResponseWriter, r *http.Request) {
+	balancesMu.Lock()
+	derived := replayLedgerLocked()
+	resp := TrialBalance{Transactions: len(ledgerTransactions), Balances: derived, Balanced: true, Consistent: true}
+	sum := 0
+	for account, balance := range derived {
+		sum += balance
+		if ledgerBalances[account] != balance {
+			resp.Consistent = false
+		}
+		if stored, ok := balances[account]; ok && stored != balance {
+			resp.Consistent = false
+		}
+	}
+	balancesMu.Unlock()
+
+	resp.Balanced = sum == 0
+	writeJSON(w, resp)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckLedgerEntries(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []LedgerEntry
+		wantErr bool
+	}{
+		{"Balanced transfer", []LedgerEntry{{"alice", -10}, {"bob", 10}}, false},
+		{"Split payment", []LedgerEntry{{"@external", -30}, {"alice", 20}, {"bob", 10}}, false},
+		{"Single entry", []LedgerEntry{{"alice", 10}}, true},
+		{"Unbalanced", []LedgerEntry{{"alice", -10}, {"bob", 9}}, true},
+		{"Zero amount", []LedgerEntry{{"alice", 0}, {"bob", 0}}, true},
+		{"Missing account", []LedgerEntry{{"", -10}, {"bob", 10}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkLedgerEntries(tt.entries); (err != nil) != tt.wantErr {
+				t.Errorf("checkLedgerEntries() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLedgerTransactions(t *testing.T) {
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+	h.StoreBalance("alice", 100)
+
+	rr := postJSON(t, postLedgerTransaction, "/ledger/transactions", LedgerTransactionRequest{
+		Memo:    "rent",
+		Entries: []LedgerEntry{{"alice", -40}, {"bob", 40}},
+	})
+	h.AssertStatusCode(rr, http.StatusCreated, "posting a transfer")
+	h.AssertBalanceStored("alice", 60)
+	h.AssertBalanceStored("bob", 40)
+
+	rr = postJSON(t, postLedgerTransaction, "/ledger/transactions", LedgerTransactionRequest{
+		Entries: []LedgerEntry{{"bob", -41}, {"alice", 41}},
+	})
+	h.AssertStatusCode(rr, http.StatusConflict, "overdrawing an account")
+	h.AssertBalanceStored("bob", 40)
+
+	// Setting a balance directly is recorded as an adjustment
+	h.StoreBalance("alice", 75)
+
+	req := httptest.NewRequest("GET", "/admin/ledger/accounts/alice", nil)
+	req.SetPathValue("id", "alice")
+	rr = httptest.NewRecorder()
+	getLedgerAccount(rr, req)
+	h.AssertStatusCode(rr, http.StatusOK, "reading the account")
+
+	var account LedgerAccount
+	if err := json.Unmarshal(rr.Body.Bytes(), &account); err != nil {
+		t.Fatalf("Failed to decode account: %v", err)
+	}
+	wantRunning := []int{100, 60, 75}
+	if len(account.Postings) != len(wantRunning) {
+		t.Fatalf("Expected %d postings, got %+v", len(wantRunning), account.Postings)
+	}
+	for i, want := range wantRunning {
+		if account.Postings[i].Balance != want {
+			t.Errorf("Posting %d: expected running balance %d, got %d", i, want, account.Postings[i].Balance)
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	getTrialBalance(rr, httptest.NewRequest("GET", "/admin/ledger/balances", nil))
+	var trial TrialBalance
+	if err := json.Unmarshal(rr.Body.Bytes(), &trial); err != nil {
+		t.Fatalf("Failed to decode trial balance: %v", err)
+	}
+	if !trial.Balanced || !trial.Consistent || trial.Balances["alice"] != 75 || trial.Balances[adjustmentAccount] != -115 {
+		t.Errorf("Unexpected trial balance %+v", trial)
+	}
+
+	if _, ledgerTx, _ := lookupBalance("alice"); ledgerTx != int64(trial.Transactions) {
+		t.Errorf("Expected alice's balance to reflect transaction %d, got %d", trial.Transactions, ledgerTx)
+	}
+}
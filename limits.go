@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ResourceLimits are the CPU and memory the server's container may use, read from its cgroup
+type ResourceLimits struct {
+	CPUs        float64 `json:"cpus,omitempty"`        // 0 without a CPU quota
+	MemoryBytes int64   `json:"memoryBytes,omitempty"` // 0 without a memory limit
+	Source      string  `json:"source,omitempty"`      // cgroup2 or cgroup1; empty when none was found
+}
+
+// cgroupRoot is where the server's own cgroup is mounted in a container
+const cgroupRoot = "/sys/fs/cgroup"
+
+// unlimitedMemory is the smallest cgroup v1 memory limit taken to mean no limit: v1 reports
+// the largest page-aligned int64 rather than "max"
+const unlimitedMemory = 1 << 62
+
+// detectLimits reads the CPU quota and memory limit of the cgroup mounted at the root of
+// fsys, trying cgroup v2 first. Limits it cannot read are left at 0.
+func detectLimits(fsys fs.FS) ResourceLimits {
+	if cpus, cpuErr := readCPUMax(fsys); !errors.Is(cpuErr, fs.ErrNotExist) {
+		memory, _ := readLimit(fsys, "memory.max")
+		return ResourceLimits{CPUs: cpus, MemoryBytes: memory, Source: "cgroup2"}
+	}
+
+	limits := ResourceLimits{}
+	quota, quotaErr := readLimit(fsys, "cpu/cpu.cfs_quota_us")
+	period, periodErr := readLimit(fsys, "cpu/cpu.cfs_period_us")
+	if quotaErr == nil && periodErr == nil && quota > 0 && period > 0 {
+		limits.CPUs = float64(quota) / float64(period)
+	}
+	memory, memoryErr := readLimit(fsys, "memory/memory.limit_in_bytes")
+	if memory < unlimitedMemory {
+		limits.MemoryBytes = memory
+	}
+	if quotaErr == nil || memoryErr == nil {
+		limits.Source = "cgroup1"
+	}
+	return limits
+}
+
+// readCPUMax reads a cgroup v2 cpu.max file: a quota and a period in microseconds, or
+// "max" and a period without a quota
+func readCPUMax(fsys fs.FS) (float64, error) {
+	data, err := fs.ReadFile(fsys, "cpu.max")
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) != 2 || fields[0] == "max" {
+		return 0, nil
+	}
+	quota, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	period, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || period <= 0 {
+		return 0, err
+	}
+	return float64(quota) / float64(period), nil
+}
+
+// readLimit reads a file holding one number, or "max" for no limit, which reads as 0
+func readLimit(fsys fs.FS, name string) (int64, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return 0, err
+	}
+	value := strings.TrimSpace(string(data))
+	if value == "max" {
+		return 0, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// provingWorkers is the number of proofs worth computing at once within the CPU quota,
+// or 0 for no limit when there is none. Each proof uses every CPU it can get, so more
+// proofs than CPUs only make all of them slower.
+func (l ResourceLimits) provingWorkers() int {
+	if l.CPUs <= 0 {
+		return 0
+	}
+	return max(1, int(l.CPUs))
+}
+
+// provingMemory is the memory proofs may hold at once: three quarters of the memory limit,
+// leaving the rest to the loaded keys and the server itself. It is 0 without a limit.
+func (l ResourceLimits) provingMemory() int64 {
+	return l.MemoryBytes / 4 * 3
+}
+
+// maxProcs is the GOMAXPROCS value matching the CPU quota, or 0 when the Go runtime default
+// should be kept: without a quota, or when GOMAXPROCS is set explicitly
+func (l ResourceLimits) maxProcs(numCPU int) int {
+	if l.CPUs <= 0 || os.Getenv("GOMAXPROCS") != "" {
+		return 0
+	}
+	if procs := int(math.Ceil(l.CPUs)); procs < numCPU {
+		return procs
+	}
+	return 0
+}
+
+// memoryLimit is the soft memory limit for the Go runtime: nine tenths of the memory limit, so
+// the collector works harder before the container is killed. It is 0, keeping the runtime
+// default, without a limit or when GOMEMLIMIT is set explicitly.
+func (l ResourceLimits) memoryLimit() int64 {
+	if l.MemoryBytes <= 0 || os.Getenv("GOMEMLIMIT") != "" {
+		return 0
+	}
+	return l.MemoryBytes / 10 * 9
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestDetectLimits(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+		want ResourceLimits
+	}{
+		{
+			name: "cgroup v2 with limits",
+			fsys: fstest.MapFS{
+				"cpu.max":    {Data: []byte("250000 100000\n")},
+				"memory.max": {Data: []byte("2147483648\n")},
+			},
+			want: ResourceLimits{CPUs: 2.5, MemoryBytes: 2 << 30, Source: "cgroup2"},
+		},
+		{
+			name: "cgroup v2 without limits",
+			fsys: fstest.MapFS{
+				"cpu.max":    {Data: []byte("max 100000\n")},
+				"memory.max": {Data: []byte("max\n")},
+			},
+			want: ResourceLimits{Source: "cgroup2"},
+		},
+		{
+			name: "cgroup v1 with limits",
+			fsys: fstest.MapFS{
+				"cpu/cpu.cfs_quota_us":         {Data: []byte("50000\n")},
+				"cpu/cpu.cfs_period_us":        {Data: []byte("100000\n")},
+				"memory/memory.limit_in_bytes": {Data: []byte("536870912\n")},
+			},
+			want: ResourceLimits{CPUs: 0.5, MemoryBytes: 512 << 20, Source: "cgroup1"},
+		},
+		{
+			name: "cgroup v1 without limits",
+			fsys: fstest.MapFS{
+				"cpu/cpu.cfs_quota_us":         {Data: []byte("-1\n")},
+				"cpu/cpu.cfs_period_us":        {Data: []byte("100000\n")},
+				"memory/memory.limit_in_bytes": {Data: []byte("9223372036854771712\n")},
+			},
+			want: ResourceLimits{Source: "cgroup1"},
+		},
+		{
+			name: "No cgroup",
+			fsys: fstest.MapFS{},
+			want: ResourceLimits{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectLimits(tt.fsys); got != tt.want {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestResourceLimitDefaults(t *testing.T) {
+	t.Setenv("GOMAXPROCS", "")
+	t.Setenv("GOMEMLIMIT", "")
+
+	limits := ResourceLimits{CPUs: 2.5, MemoryBytes: 4 << 30}
+	if got := limits.provingWorkers(); got != 2 {
+		t.Errorf("Expected 2 workers for 2.5 CPUs, got %d", got)
+	}
+	if got := limits.provingMemory(); got != 3<<30 {
+		t.Errorf("Expected 3 GiB for proofs, got %d", got)
+	}
+	if got := limits.maxProcs(16); got != 3 {
+		t.Errorf("Expected GOMAXPROCS 3 for 2.5 CPUs on 16, got %d", got)
+	}
+	if got := limits.memoryLimit(); got != 4<<30/10*9 {
+		t.Errorf("Expected a soft memory limit of nine tenths, got %d", got)
+	}
+	if got := limits.maxProcs(2); got != 0 {
+		t.Errorf("Expected the runtime default when the host has fewer CPUs, got %d", got)
+	}
+	if got := (ResourceLimits{CPUs: 0.5}).provingWorkers(); got != 1 {
+		t.Errorf("Expected at least one worker, got %d", got)
+	}
+
+	unlimited := ResourceLimits{}
+	if unlimited.provingWorkers() != 0 || unlimited.provingMemory() != 0 || unlimited.maxProcs(16) != 0 || unlimited.memoryLimit() != 0 {
+		t.Errorf("Expected no limits without a cgroup, got %d workers, %d bytes and GOMAXPROCS %d", unlimited.provingWorkers(), unlimited.provingMemory(), unlimited.maxProcs(16))
+	}
+
+	t.Setenv("GOMAXPROCS", "8")
+	if got := limits.maxProcs(16); got != 0 {
+		t.Errorf("Expected an explicit GOMAXPROCS to be kept, got %d", got)
+	}
+	t.Setenv("GOMEMLIMIT", "1GiB")
+	if got := limits.memoryLimit(); got != 0 {
+		t.Errorf("Expected an explicit GOMEMLIMIT to be kept, got %d", got)
+	}
+}
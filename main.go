@@ -1,226 +1,630 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/consensys/gnark-crypto/ecc"
 	"github.com/consensys/gnark/backend/groth16"
 	"github.com/consensys/gnark/frontend"
-	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/korjavin/zkTest1/circuits"
+	"github.com/korjavin/zkTest1/internal/capture"
+	"github.com/korjavin/zkTest1/internal/errs"
 )
 
-// Define the circuit
-type BalanceCircuit struct {
-	Balance      frontend.Variable `gnark:",private"`
-	NeededAmount frontend.Variable `gnark:",public"`
-}
-
-func (circuit *BalanceCircuit) Define(api frontend.API) error {
-	api.AssertIsLessOrEqual(circuit.NeededAmount, circuit.Balance)
-	return nil
-}
+// Identity of the balance circuit, bumped whenever its constraints change
+const (
+	balanceCircuitName    = circuits.BalanceName
+	balanceCircuitVersion = 2
+)
 
 var (
-	balances   = make(map[string]int)
-	balancesMu sync.Mutex
+	balances       = make(map[string]int)
+	balanceUpdated = make(map[string]time.Time) // last store of each balance, for expiry
+	balancesMu     sync.Mutex
 )
 
 type BalanceRequest struct {
-	ID     string `json:"id"`
-	Amount int    `json:"amount"`
+	ID              string `json:"id"`
+	Amount          int    `json:"amount"`
+	ExpectedVersion *int64 `json:"expectedVersion,omitempty"` // alternative to If-Match
 }
 
 type ProofRequest struct {
 	ID           string `json:"id"`
 	NeededAmount int    `json:"neededAmount"`
+	Comparison   string `json:"comparison,omitempty"` // gte (balance ≥ neededAmount, the default) or gt (balance > neededAmount)
+	Preset       string `json:"preset,omitempty"`     // fast or compact to trade range or proving time for speed or size
 }
 
 type ValidateRequest struct {
-	ID           string          `json:"id"`
-	NeededAmount int             `json:"neededAmount"`
-	Proof        json.RawMessage `json:"proof"`
+	ID            string          `json:"id"`
+	NeededAmount  int             `json:"neededAmount"`
+	Proof         json.RawMessage `json:"proof"`
+	GnarkVersion  string          `json:"gnarkVersion,omitempty"`  // release the proof was serialized with; this server's when empty
+	PublicWitness []byte          `json:"publicWitness,omitempty"` // base64 gnark public witness, checked against neededAmount
+	Circuit       string          `json:"circuit,omitempty"`       // verify against publicWitness alone for this registered circuit
+	Curve         string          `json:"curve,omitempty"`         // curve the proof was made on; bn254 when empty
+	Issuer        string          `json:"issuer,omitempty"`        // trusted peer that issued the proof; this server when empty
+	DryRun        bool            `json:"dryRun,omitempty"`        // check everything without counting or auditing the validation
+	Comparison    string          `json:"comparison,omitempty"`    // comparison the proof states, gte or gt; gte when empty
+	Preset        string          `json:"preset,omitempty"`        // preset the proof was made with
 }
 
+// dryRunHeader marks the answers of dry-run validations
+const dryRunHeader = "X-Dry-Run"
+
 func storeBalance(w http.ResponseWriter, r *http.Request) {
 	var req BalanceRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := checkSessionUser(r, req.ID); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	expected, given, err := expectedBalanceVersion(r, req.ExpectedVersion)
+	if err != nil {
+		writeError(w, errs.Wrap(errs.Invalid, err))
 		return
 	}
 
 	balancesMu.Lock()
-	balances[req.ID] = req.Amount
+	if err := checkBalanceVersionLocked(req.ID, expected, given); err != nil {
+		balancesMu.Unlock()
+		writeError(w, err)
+		return
+	}
+	version := setBalanceLocked(req.ID, req.Amount, time.Now())
+	delete(balanceAttestations, req.ID) // self-reported balances are not attested
 	balancesMu.Unlock()
+	audit.record(AuditEvent{Type: auditBalanceStored, Detail: "self-reported"})
 
+	w.Header().Set("ETag", balanceETag(version))
 	w.WriteHeader(http.StatusOK)
 }
 
-func generateProof(w http.ResponseWriter, r *http.Request) {
-	var req ProofRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
+var (
+	errBalanceNotFound = errs.ErrBalanceNotFound
+	errInvalidProof    = errs.ErrProofInvalid
+)
 
-	balancesMu.Lock()
-	balance, exists := balances[req.ID]
-	balancesMu.Unlock()
+// proveBalance generates a proof on curve that the stored balance of id covers neededAmount.
+// The returned digest identifies the stored proof and is empty if it could not be persisted.
+func proveBalance(ctx context.Context, curve ecc.ID, id string, neededAmount int) (groth16.Proof, string, error) {
+	balance, ledgerTx, exists := lookupBalance(id)
 
 	if !exists {
-		http.Error(w, "balance not found", http.StatusNotFound)
-		return
+		return nil, "", errBalanceNotFound
+	}
+	if err := checkBalanceAttestation(id, time.Now()); err != nil {
+		return nil, "", err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
 	}
 
-	// Create a circuit
-	var circuit BalanceCircuit
-	circuit.Balance = balance
-	circuit.NeededAmount = req.NeededAmount
+	setup, err := loadCurveSetup(curve, balanceCircuitName, &circuits.BalanceCircuit{})
+	if err != nil {
+		return nil, "", err
+	}
+	proof, err := setup.prove(ctx, &circuits.BalanceCircuit{Balance: balance, NeededAmount: neededAmount})
+	if err != nil {
+		if !isContextError(err) && !errors.Is(err, errProvingUnavailable) {
+			// Solver errors include witness values, so they must not reach the client or the logs
+			err = errs.Errorf(errs.Unprocessable, "balance is below neededAmount")
+		}
+		return nil, "", err
+	}
 
-	// Compile the circuit
-	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &BalanceCircuit{})
+	// Keep a content-addressed copy; a storage outage must not fail proving
+	digest, err := persistProof(ctx, proof, ProofRecord{
+		Circuit:        balanceCircuitName,
+		CircuitVersion: balanceCircuitVersion,
+		Curve:          recordedCurve(curve),
+		LedgerTx:       ledgerTx,
+		PublicInputs:   map[string]string{"neededAmount": strconv.Itoa(neededAmount)},
+		Holder:         id,
+	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		log.Printf("Failed to persist proof: %v", err)
 	}
 
-	// Generate the proving and verifying keys
-	pk, _, err := groth16.Setup(ccs)
+	return proof, digest, nil
+}
+
+// verifyBalance checks a proof on curve against the public neededAmount.
+// It returns errInvalidProof when the proof does not verify.
+func verifyBalance(ctx context.Context, curve ecc.ID, proof groth16.Proof, neededAmount int) error {
+	return verifyWithSetup(ctx, curve, balanceCircuitName, &circuits.BalanceCircuit{}, proof,
+		&circuits.BalanceCircuit{NeededAmount: neededAmount})
+}
+
+// checkBalance is verifyBalance without counting or auditing the attempt, for dry runs
+func checkBalance(ctx context.Context, curve ecc.ID, proof groth16.Proof, neededAmount int) error {
+	setup, err := loadCurveSetup(curve, balanceCircuitName, &circuits.BalanceCircuit{})
+	if err != nil {
+		return err
+	}
+	publicWitness, err := frontend.NewWitness(&circuits.BalanceCircuit{NeededAmount: neededAmount}, curve.ScalarField(), frontend.PublicOnly())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return fmt.Errorf("public witness: %w", err)
+	}
+	return setup.checkWitness(ctx, proof, publicWitness)
+}
+
+func generateProof(w http.ResponseWriter, r *http.Request) {
+	var req ProofRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := checkSessionUser(r, req.ID); err != nil {
+		writeError(w, err)
 		return
 	}
 
-	// Create witness
-	witness, err := frontend.NewWitness(&circuit, ecc.BN254.ScalarField())
+	circuit, err := balanceCircuitFor(req.Comparison, req.Preset)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
+		return
+	}
+	if req.NeededAmount, err = roundThreshold(req.NeededAmount); err != nil {
+		writeError(w, err)
 		return
 	}
+	if err := checkTenantAccess(r, circuit, int64(req.NeededAmount)); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	observeThreshold(tenantID(r), req.ID, circuit, int64(req.NeededAmount))
 
-	// Generate the proof
-	proof, err := groth16.Prove(ccs, pk, witness)
+	curve := proofCurve(r, circuit)
+	proof, digest, err := proveComparison(r.Context(), curve, circuit, req.ID, req.NeededAmount)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(proof); err != nil {
-		http.Error(w, "failed to encode response", http.StatusInternalServerError)
-		return
+	if digest != "" {
+		w.Header().Set("X-Proof-Digest", digest)
+	}
+	if roundThresholds {
+		w.Header().Set(provedThresholdHeader, strconv.Itoa(req.NeededAmount))
 	}
+	setProofHeaders(w, curve, balanceAssignment(circuit, req.NeededAmount))
+	signIssuedProof(w, curve, circuit, map[string]int{"neededAmount": req.NeededAmount}, proof, balanceAssignment(circuit, req.NeededAmount))
+	writeProof(w, r, proof, nil)
 }
 
 func validateProof(w http.ResponseWriter, r *http.Request) {
 	var req ValidateRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, err)
 		return
 	}
 
-	// Compile the circuit (we need this to get the verifying key)
-	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &BalanceCircuit{})
+	if req.Circuit != "" && (req.Comparison != "" || req.Preset != "") {
+		writeError(w, errs.Errorf(errs.Invalid, "comparison and preset apply to balance proofs, not to circuit"))
+		return
+	}
+	circuit, err := balanceCircuitFor(req.Comparison, req.Preset)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
+		return
+	}
+	if req.Circuit != "" {
+		circuit = req.Circuit
+	}
+	thresholds := []int64{int64(req.NeededAmount)}
+	if req.Circuit != "" {
+		thresholds = nil // the circuit's public inputs are not known by name
+	}
+	if err := checkTenantAccess(r, circuit, thresholds...); err != nil {
+		writeError(w, err)
+		return
+	}
+	curve, err := verifyCurve(req.Curve, circuit)
+	if err != nil {
+		writeError(w, err)
 		return
 	}
 
-	// Generate the proving and verifying keys
-	_, vk, err := groth16.Setup(ccs)
+	proof, err := decodeProof(curve, req.GnarkVersion, req.Proof)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
+	if req.DryRun {
+		w.Header().Set(dryRunHeader, "true")
+	}
 
-	// Create public witness (only the public inputs)
-	publicWitness := BalanceCircuit{
-		NeededAmount: req.NeededAmount,
+	// Proofs of trusted peers are verified with the peer's pinned verifying key instead of ours
+	if req.Issuer != "" {
+		verifyIssuedByPeer(w, r, req, curve, proof)
+		return
 	}
 
-	witness, err := frontend.NewWitness(&publicWitness, ecc.BN254.ScalarField(), frontend.PublicOnly())
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	// Circuits this endpoint does not model by fields are verified against the witness as given
+	if req.Circuit != "" {
+		verify := verifyAgainstWitness
+		if req.DryRun {
+			verify = checkAgainstWitness
+		}
+		resp, err := verify(r.Context(), curve, req.Circuit, proof, req.PublicWitness, time.Now())
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, resp)
 		return
 	}
 
-	// Unmarshal the proof from JSON
-	var proof groth16.Proof
-	if err := json.Unmarshal(req.Proof, &proof); err != nil {
-		http.Error(w, "invalid proof format: "+err.Error(), http.StatusBadRequest)
+	if err := checkPublicWitness(curve, req.PublicWitness, balanceAssignment(circuit, req.NeededAmount)); err != nil {
+		writeError(w, err)
 		return
 	}
 
-	// Verify the proof
-	err = groth16.Verify(proof, vk, witness)
-	if err != nil {
-		http.Error(w, "invalid proof", http.StatusUnauthorized)
+	verify := comparisonVerifier(circuit, req.DryRun)
+	if err := verify(r.Context(), curve, proof, req.NeededAmount); err != nil {
+		writeError(w, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
 
-// CORS middleware to allow frontend requests
-func enableCORS(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// Set CORS headers
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
-
-		// Handle preflight requests
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
+func main() {
+	// Every log line goes through redaction so balances and witness values never reach the logs
+	log.SetOutput(redactingWriter{out: os.Stderr})
 
-		next(w, r)
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
 	}
-}
 
-func main() {
-	// API endpoints with CORS
-	http.HandleFunc("/store/sum", enableCORS(storeBalance))
-	http.HandleFunc("/get/proof/neededAmount", enableCORS(generateProof))
-	http.HandleFunc("/validate", enableCORS(validateProof))
+	if secrets, err = newSecretProvider(cfg.Secrets); err != nil {
+		log.Fatalf("Failed to configure secrets: %v", err)
+	}
+	if err := cfg.resolveSecrets(context.Background(), secrets); err != nil {
+		log.Fatalf("Failed to load secrets: %v", err)
+	}
+	if flags, err = newFeatureFlags(cfg.Features); err != nil {
+		log.Fatalf("Invalid ZK_FEATURES: %v", err)
+	}
+	if err := loadCircuitPlugins(cfg.CircuitPlugins); err != nil {
+		log.Fatalf("Failed to load circuit plugins: %v", err)
+	}
+	curveSelection = cfg.Curves
+	tenantAccess = cfg.TenantAccess
+	apiKeys = cfg.APIKeys
+	constraintBudget = cfg.MaxConstraints
+	if err := checkCircuitBudgets(); err != nil {
+		log.Fatalf("Refusing to serve: %v. Raise ZK_MAX_CONSTRAINTS, or leave out the plugin or ZK_CURVE setting that brings in the circuit.", err)
+	}
+	if procs := cfg.Limits.maxProcs(runtime.NumCPU()); procs > 0 {
+		runtime.GOMAXPROCS(procs)
+	}
+	if limit := cfg.Limits.memoryLimit(); limit > 0 {
+		debug.SetMemoryLimit(limit)
+	}
+	if cfg.Limits.Source != "" {
+		log.Printf("Container limits (%s): %.2f CPUs, %d bytes of memory; proving with %d workers and %d bytes", cfg.Limits.Source, cfg.Limits.CPUs, cfg.Limits.MemoryBytes, cfg.ProvingWorkers, cfg.ProvingMemory)
+	}
+	provers = newProvingPool(cfg.ProvingWorkers, cfg.ReservedWorkers, cfg.ProvingMemory)
+	provers.gcPercent = cfg.ProvingGC
+	verifications = newVerificationCache(cfg.VerifyCache, time.Now)
+	if keyStore, err = newKeyStore(cfg.Keys, secrets); err != nil {
+		log.Fatalf("Failed to open key store: %v", err)
+	}
+	if err := keyManager.LoadPersisted(); err != nil {
+		if errors.Is(err, errs.ErrKeyMismatch) {
+			log.Fatalf("Refusing to serve: %v. Regenerate the keys with keygen -force after a circuit change.", err)
+		}
+		log.Fatalf("Failed to load circuit keys: %v", err)
+	}
+	// Both /get/proof and /validate use the balance circuit, so it is compiled and set up before
+	// the first request rather than by it
+	if _, err := loadCurveSetup(defaultCurve, balanceCircuitName, &circuits.BalanceCircuit{}); err != nil {
+		log.Fatalf("Failed to set up the balance circuit: %v", err)
+	}
+	if signer, err = newSigner(cfg.Signing, secrets); err != nil {
+		log.Fatalf("Failed to configure signing: %v", err)
+	}
+	if issuerDID, err = newIssuerDID(cfg.Signing.DID, signer); err != nil {
+		log.Fatalf("Failed to configure the server's DID: %v", err)
+	}
+	if payloadKey, err = newEncryptionKey(secrets); err != nil {
+		log.Fatalf("Failed to configure payload encryption: %v", err)
+	}
+	if bankConnector, err = newBankConnector(cfg.Bank, secrets); err != nil {
+		log.Fatalf("Failed to configure bank connector: %v", err)
+	}
+	nonceStore, err := newNonceStore(cfg.Nonces, secrets)
+	if err != nil {
+		log.Fatalf("Failed to configure the nonce store: %v", err)
+	}
+	nonces = newMeteredNonceStore(nonceStore)
+	log.Printf("🎟️  Challenges and signatures are single-use through the %s nonce store", cfg.Nonces.Backend)
+	if proofGate, err = newProofGate(cfg.Gate, secrets); err != nil {
+		log.Fatalf("Failed to configure proof gate: %v", err)
+	}
+	if oidcProvider, err = newOIDCClient(cfg.OIDC, secrets); err != nil {
+		log.Fatalf("Failed to configure OIDC sign-in: %v", err)
+	}
+	if tokenValidator, err = newTokenValidator(cfg.OAuth, secrets); err != nil {
+		log.Fatalf("Failed to configure access tokens: %v", err)
+	}
+	oauthRequired = cfg.OAuth.Required
+	if signedRequests, err = newRequestVerifier(cfg.HMAC, secrets); err != nil {
+		log.Fatalf("Failed to configure request signing: %v", err)
+	}
 
-	// Serve static files for the demo frontend
-	fs := http.FileServer(http.Dir("./web/"))
-	http.Handle("/", fs)
+	// API endpoints with CORS
+	http.HandleFunc("POST /session", login)
+	http.HandleFunc("GET /session", getSession)
+	http.HandleFunc("DELETE /session", logout)
+	http.HandleFunc("GET /oidc/login", oidcLogin)
+	http.HandleFunc("GET /oidc/callback", oidcCallback)
+	http.HandleFunc("/rpc", handleRPC)
+	http.HandleFunc("POST /validate/bundle/stream", requireScope(scopeProofsVerify, validateBundleStream))
+	http.HandleFunc("POST /proxy/{policy}", requireScope(scopeProofsVerify, proxyVerify))
+	http.HandleFunc("GET /keys/verifying/{name}", getVerifyingKey)
+	http.HandleFunc("GET /artifacts/{kind}/{digest}", getArtifact)
+	http.HandleFunc("GET /openapi.json", getOpenAPI)
+	registerEndpoints(http.DefaultServeMux, apiEndpoints())
+
+	// Experimental endpoints, off unless their feature flag is enabled
+	http.HandleFunc("/get/proof/plonk", requireFlag(flagPlonk, notImplemented(flagPlonk)))
+	http.HandleFunc("/validate/plonk", requireFlag(flagPlonk, notImplemented(flagPlonk)))
+	http.HandleFunc("/get/proof/recursive", requireFlag(flagRecursion, notImplemented(flagRecursion)))
+	http.HandleFunc("GET /wasm/keys/{name}", requireFlag(flagWASMProving, getProvingKey))
+
+	// Admin endpoints (require the admin-token secret)
+	http.HandleFunc("/admin/test-vectors", requireAdmin(exportTestVectors))
+	http.HandleFunc("GET /admin/stats", requireAdmin(getStats))
+	http.HandleFunc("GET /admin/usage", requireAdmin(getAllUsage))
+	http.HandleFunc("GET /admin/audit", requireAdmin(exportAudit))
+	http.HandleFunc("PUT /admin/allowlists/{name}", requireAdmin(putAllowlist))
+	http.HandleFunc("PUT /admin/policies/{name}", requireAdmin(putPolicy))
+	http.HandleFunc("PUT /admin/statements/{name}", requireAdmin(putStatement))
+	http.HandleFunc("PUT /admin/attribute-schemas/{name}", requireAdmin(putAttributeSchema))
+	http.HandleFunc("GET /admin/peers", requireAdmin(listPeers))
+	http.HandleFunc("PUT /admin/peers/{name}", requireAdmin(putPeer))
+	http.HandleFunc("DELETE /admin/peers/{name}", requireAdmin(deletePeer))
+	http.HandleFunc("POST /admin/keys/{name}/rotate", requireAdmin(rotateKeys))
+	http.HandleFunc("POST /admin/proofs/{digest}/revoke", requireAdmin(revokeProof))
+	http.HandleFunc("POST /admin/compare", requireAdmin(requireFlag(flagPlonk, compareBackends)))
+	http.HandleFunc("GET /admin/verifybench", requireAdmin(getVerifyBench))
+	http.HandleFunc("GET /admin/flags", requireAdmin(listFlags))
+	http.HandleFunc("PUT /admin/flags/{name}", requireAdmin(putFlag))
+	http.HandleFunc("POST /admin/balances/import", requireAdmin(importBalances))
+	http.HandleFunc("DELETE /admin/balances/{id}", requireAdmin(deleteBalance))
+	http.HandleFunc("POST /admin/balances/{id}/restore", requireAdmin(restoreDeletedBalance))
+	http.HandleFunc("POST /admin/users/{id}/erase", requireAdmin(eraseUserData))
+	http.HandleFunc("GET /admin/ledger/accounts/{id}", requireAdmin(getLedgerAccount))
+	http.HandleFunc("GET /admin/ledger/balances", requireAdmin(getTrialBalance))
+	http.HandleFunc("POST /admin/seed", requireAdmin(seedDemo))
+	http.HandleFunc("GET /admin/dashboard/proving", requireAdmin(getDashboardProving))
+	http.HandleFunc("GET /admin/dashboard/keys", requireAdmin(getDashboardKeys))
+	http.HandleFunc("GET /admin/dashboard/circuits", requireAdmin(getDashboardCircuits))
+	http.HandleFunc("GET /admin/dashboard/audit", requireAdmin(getDashboardAudit))
+	http.HandleFunc("GET /admin/status", requireAdmin(getStatus))
+
+	// Readiness probe with live dependency checks
+	http.HandleFunc("GET /ready", readiness)
+
+	// Serve the demo frontend to requests no API route matches
+	assets, err := webAssets(cfg.DevMode)
+	if err != nil {
+		log.Fatalf("Failed to load the demo frontend: %v", err)
+	}
+	if cfg.DevMode {
+		log.Printf("Serving the demo frontend from ./%s", webDir)
+	}
+	http.HandleFunc("/", staticHandler(assets))
+	http.HandleFunc("GET /wasm/", requireFlag(flagWASMProving, wasmHandler(assets)))
 
 	// Health check endpoint
-	http.HandleFunc("/health", enableCORS(func(w http.ResponseWriter, r *http.Request) {
+	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		if err := json.NewEncoder(w).Encode(map[string]string{
 			"status":  "ok",
 			"service": "zkTest1 - Zero-Knowledge Proof Demo",
-			"version": "1.0.0",
+			"version": serverVersion,
 		}); err != nil {
 			log.Printf("Failed to encode health check response: %v", err)
 		}
-	}))
+	})
+
+	if cfg.Buckets != nil {
+		bucketBoundaries = cfg.Buckets
+	}
+	if cfg.Tiers != nil {
+		balanceTiers = cfg.Tiers
+	}
+	requireBalancePrecondition = cfg.RequireIfMatch
+	requireConsent = cfg.RequireConsent
+	roundThresholds = cfg.RoundThresholds
+	meter = newProvingMeter(cfg.Quota, time.Now)
+	userIssuance = newIssuanceLimiter(cfg.UserProofs, time.Now)
+	probes = newProbeDetector(cfg.Probes, time.Now)
+
+	if artifacts, err = newArtifactStore(cfg.Artifacts); err != nil {
+		log.Fatalf("Failed to open artifact store: %v", err)
+	}
 
-	fmt.Println("🔐 zkTest1 Zero-Knowledge Proof Demo Server")
-	fmt.Println("📊 API Server: http://localhost:8080")
-	fmt.Println("🌐 Demo Frontend: http://localhost:8080")
-	fmt.Println("📖 API Documentation: http://localhost:8080/#api")
-	fmt.Println("🚀 Ready for zero-knowledge proof demonstrations!")
+	var bus MessageBus
+	if cfg.Bus.URL != "" {
+		nb, err := newNATSBus(cfg.Bus.URL, cfg.Bus.QueueGroup)
+		if err != nil {
+			log.Fatalf("Failed to connect to message bus: %v", err)
+		}
+		defer nb.Close()
+		bus = nb
+
+		if err := startProofConsumer(bus, cfg.Bus); err != nil {
+			log.Fatalf("Failed to subscribe to %s: %v", cfg.Bus.RequestTopic, err)
+		}
+		log.Printf("📨 Consuming proof requests from %s, replying on %s", cfg.Bus.RequestTopic, cfg.Bus.ReplyTopic)
+	}
+
+	registerDependencyChecks(bus)
+
+	if cfg.StatementsFile != "" {
+		n, err := loadStatements(cfg.StatementsFile)
+		if err != nil {
+			log.Fatalf("Failed to load statements: %v", err)
+		}
+		log.Printf("Registered %d statements from %s", n, cfg.StatementsFile)
+	}
+
+	if cfg.Seed.Enabled {
+		demo, err := loadDemoData(cfg.Seed.File)
+		if err != nil {
+			log.Fatalf("Failed to load demo data: %v", err)
+		}
+		seeded, err := seedDemoData(context.Background(), demo)
+		if err != nil {
+			log.Fatalf("Failed to seed demo data: %v", err)
+		}
+		log.Printf("🌱 Seeded %d demo users and %d example proofs", seeded.Users, len(seeded.Proofs))
+	}
+
+	if cfg.AuditShip.URL != "" {
+		stop := make(chan struct{})
+		defer close(stop)
+		if auditShip, err = startAuditShipper(cfg.AuditShip, stop); err != nil {
+			log.Fatalf("Failed to configure audit shipping: %v", err)
+		}
+		log.Printf("📜 Shipping audit events to %s", cfg.AuditShip.URL)
+	}
+
+	stopNotifications := make(chan struct{})
+	defer close(stopNotifications)
+	if notifications, err = startNotifications(cfg.Notify, stopNotifications); err != nil {
+		log.Fatalf("Failed to configure notifications: %v", err)
+	}
+
+	keyRotation = cfg.KeyRotation
+	proxyBackend = cfg.Proxy.BackendURL
+	proxyClient.Timeout = cfg.Proxy.HTTPTimeout
+	if proxyBackend != "" {
+		log.Printf("🛂 Verification proxy forwards decisions to %s", proxyBackend)
+	}
+	attestationPolicy = cfg.Attestation
+	if keyRotation.Interval > 0 {
+		stopRotation := make(chan struct{})
+		defer close(stopRotation)
+		startKeyRotation(keyRotation, stopRotation)
+	}
+
+	var limiter *rateLimiter
+	if cfg.RateLimit.Rate > 0 {
+		limiter = newRateLimiter(cfg.RateLimit, time.Now)
+	}
+
+	if cfg.Cleanup.Interval > 0 {
+		registerCleanupTasks(cfg.Cleanup)
+		if limiter != nil {
+			cleanup.register("rate-limits", func(now time.Time) (int, error) {
+				return limiter.sweep(now), nil
+			})
+		}
+		cleanup.register("nonces", func(now time.Time) (int, error) {
+			return nonces.sweep(now), nil
+		})
+		cleanup.register("verification-cache", func(now time.Time) (int, error) {
+			return verifications.sweep(now), nil
+		})
+		cleanup.register("consents", func(now time.Time) (int, error) {
+			return pruneConsents(now), nil
+		})
+		if cfg.UserProofs.Max > 0 {
+			cleanup.register("user-proof-limits", func(now time.Time) (int, error) {
+				return userIssuance.sweep(now), nil
+			})
+		}
+		if cfg.Probes.Queries > 0 {
+			cleanup.register("threshold-probes", func(now time.Time) (int, error) {
+				return probes.sweep(now), nil
+			})
+		}
+		if cfg.Attestation.TTL > 0 && cfg.Attestation.Reminder > 0 {
+			cleanup.register("attestation-reminders", func(now time.Time) (int, error) {
+				return remindExpiringAttestations(now, cfg.Attestation.Reminder)
+			})
+		}
+		stop := make(chan struct{})
+		defer close(stop)
+		cleanup.start(cfg.Cleanup.Interval, stop)
+	}
+
+	// Every route goes through the same stack, outermost first; admin, gate and quota checks are per route
+	stack := []Middleware{withRequestID}
+	if cfg.AccessLog {
+		stack = append(stack, func(next http.Handler) http.Handler { return logRequests(log.Default(), next) })
+	}
+	if cfg.CaptureFile != "" {
+		f, err := os.OpenFile(cfg.CaptureFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			log.Fatalf("Failed to open capture file: %v", err)
+		}
+		defer f.Close()
+		out := capture.NewWriter(f)
+		stack = append(stack, func(next http.Handler) http.Handler { return captureRequests(out, next) })
+		log.Printf("Capturing verification requests to %s", cfg.CaptureFile)
+	}
+	stack = append(stack, httpMetrics.middleware, recoverPanics, cors, reportTimings)
+	if cfg.Proxy.Only {
+		stack = append(stack, proxyOnly)
+	}
+	if cfg.RequestTimeout > 0 {
+		stack = append(stack, withTimeout(cfg.RequestTimeout))
+	}
+	if limiter != nil {
+		stack = append(stack, limiter.middleware)
+	}
+	if signedRequests != nil {
+		stack = append(stack, signedRequests.middleware)
+	}
+	// Signatures cover the body as sent, so payloads are decrypted after they are checked
+	stack = append(stack, decryptPayloads)
+	if cfg.DevMode && cfg.Faults.Enabled() {
+		log.Printf("⚠️  Dev mode: injecting faults %+v", cfg.Faults)
+		stack = append(stack, func(next http.Handler) http.Handler { return injectFaults(cfg.Faults, next) })
+	}
+	handler := chain(http.DefaultServeMux, stack...)
 
 	server := &http.Server{
-		Addr:         ":8080",
-		Handler:      nil,
+		Addr:         cfg.Addr,
+		Handler:      handler,
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
 
-	if err := server.ListenAndServe(); err != nil {
-		fmt.Println("❌ Failed to start server:", err)
+	listener, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		log.Fatalf("Failed to start server: %v", err)
+	}
+	logStartup(newStartupReport(cfg, []string{listener.Addr().String()}, time.Now()))
+	if err := server.Serve(listener); err != nil {
+		log.Fatalf("Server stopped: %v", err)
 	}
 }
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// Middleware wraps a handler with behaviour shared by every route
+type Middleware func(http.Handler) http.Handler
+
+// chain wraps h in the middlewares, the first one outermost
+func chain(h http.Handler, mws ...Middleware) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// withRequestID makes sure every request and response carries an X-Request-ID
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = newRequestID()
+			r.Header.Set(requestIDHeader, id)
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// panicsRecovered counts handler panics turned into 500 responses
+var panicsRecovered atomic.Int64
+
+// recoverPanics turns a handler panic into a logged stack trace and a 500 JSON error
+// instead of an aborted connection
+func recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+			panicsRecovered.Add(1)
+			id := w.Header().Get(requestIDHeader)
+			log.Printf("panic serving %s %s (request_id=%s): %v\n%s", r.Method, r.URL.Path, id, p, debug.Stack())
+
+			if rec.status != 0 {
+				return // the response is already on its way; the client sees it cut short
+			}
+			writeError(w, errs.Errorf(errs.Internal, "internal server error"))
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// withTimeout bounds the context of every request, so proving, storage and outbound calls give up
+// once the response could no longer be written
+func withTimeout(timeout time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// cors allows the demo frontend and other origins to call the API, answering preflight requests directly
+func cors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, If-Match, X-PoW-Solution, X-Captcha-Token, X-API-Key, X-Request-ID, X-Signature-Key-Id, X-Signature-Timestamp, X-Signature")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag, Retry-After, X-Gnark-Version, X-Key-Digest, X-Key-ID, X-Proof-Curve, X-Proof-Digest, X-Proxy-Decision, X-Proof-Size, X-Proved-Threshold, X-Public-Witness, X-Request-ID, X-Signed-Envelope, Server-Timing, WWW-Authenticate")
+
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RouteStats counts the responses of one route pattern
+type RouteStats struct {
+	Requests     int `json:"requests"`
+	ClientErrors int `json:"clientErrors"`
+	ServerErrors int `json:"serverErrors"`
+}
+
+// requestMetrics counts responses per ServeMux pattern, so path parameters do not create new series
+type requestMetrics struct {
+	mu     sync.Mutex
+	routes map[string]*RouteStats
+}
+
+var httpMetrics = &requestMetrics{routes: make(map[string]*RouteStats)}
+
+func (m *requestMetrics) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		route := r.Pattern // set by the ServeMux once it has matched the request
+		if route == "" {
+			route = "unmatched"
+		}
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		s, ok := m.routes[route]
+		if !ok {
+			s = &RouteStats{}
+			m.routes[route] = s
+		}
+		s.Requests++
+		switch status := rec.status; {
+		case status >= 500:
+			s.ServerErrors++
+		case status >= 400:
+			s.ClientErrors++
+		}
+	})
+}
+
+func (m *requestMetrics) snapshot() map[string]RouteStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make(map[string]RouteStats, len(m.routes))
+	for route, s := range m.routes {
+		out[route] = *s
+	}
+	return out
+}
+
+// RateLimitConfig bounds the request rate of each client IP; a zero Rate disables limiting
+type RateLimitConfig struct {
+	Rate  float64 // sustained requests per second
+	Burst int
+}
+
+// rateLimiter keeps a token bucket per client IP
+type rateLimiter struct {
+	cfg RateLimitConfig
+	now func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(cfg RateLimitConfig, now func() time.Time) *rateLimiter {
+	return &rateLimiter{cfg: cfg, now: now, buckets: make(map[string]*tokenBucket)}
+}
+
+// allow takes a token from the bucket of client, returning how long to wait when there is none
+func (l *rateLimiter) allow(client string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &tokenBucket{tokens: float64(l.cfg.Burst), last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(float64(l.cfg.Burst), b.tokens+now.Sub(b.last).Seconds()*l.cfg.Rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.cfg.Rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep forgets clients whose bucket has refilled completely
+func (l *rateLimiter) sweep(now time.Time) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	full := time.Duration(float64(l.cfg.Burst) / l.cfg.Rate * float64(time.Second))
+	removed := 0
+	for client, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, client)
+			removed++
+		}
+	}
+	return removed
+}
+
+// middleware answers 429 once a client IP exceeds its rate; X-Forwarded-For is not trusted
+func (l *rateLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			client = r.RemoteAddr
+		}
+		if ok, wait := l.allow(client); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeError(w, errs.Errorf(errs.TooManyRequests, "rate limit exceeded"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
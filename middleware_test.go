@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+	mark := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	h := chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { order = append(order, "handler") }), mark("outer"), mark("inner"))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if got := strings.Join(order, ","); got != "outer,inner,handler" {
+		t.Errorf("Expected outer,inner,handler, got %s", got)
+	}
+}
+
+func TestRecoverPanics(t *testing.T) {
+	before := panicsRecovered.Load()
+	h := chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("prover exploded")
+	}), withRequestID, recoverPanics)
+
+	req := httptest.NewRequest("POST", "/get/proof/neededAmount", nil)
+	req.Header.Set(requestIDHeader, "req-42")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected 500, got %d", rr.Code)
+	}
+	var body ErrorResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Expected a JSON error body, got %q", rr.Body.String())
+	}
+	if body.RequestID != "req-42" || strings.Contains(body.Error, "exploded") {
+		t.Errorf("Expected a generic error with the request ID, got %+v", body)
+	}
+	if panicsRecovered.Load() != before+1 {
+		t.Error("Expected the panic to be counted")
+	}
+}
+
+func TestRecoverPanicsKeepsAbort(t *testing.T) {
+	h := recoverPanics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	defer func() {
+		if p := recover(); p != http.ErrAbortHandler {
+			t.Errorf("Expected http.ErrAbortHandler to propagate, got %v", p)
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
+
+func TestCORSPreflight(t *testing.T) {
+	called := false
+	h := cors(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true }))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("OPTIONS", "/bundle", nil))
+	if rr.Code != http.StatusOK || called {
+		t.Errorf("Expected preflight to be answered without the handler, got %d called=%v", rr.Code, called)
+	}
+	if rr.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Error("Expected CORS headers on the preflight response")
+	}
+}
+
+func TestRequestMetricsByPattern(t *testing.T) {
+	m := &requestMetrics{routes: make(map[string]*RouteStats)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") == "missing" {
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	})
+	h := m.middleware(mux)
+
+	for _, path := range []string{"/items/1", "/items/2", "/items/missing", "/nowhere"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	stats := m.snapshot()
+	if got := stats["GET /items/{id}"]; got.Requests != 3 || got.ClientErrors != 1 {
+		t.Errorf("Expected 3 requests and 1 client error for the pattern, got %+v", got)
+	}
+	if got := stats["unmatched"]; got.Requests != 1 {
+		t.Errorf("Expected the unmatched request to be counted separately, got %+v", stats)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Now()
+	l := newRateLimiter(RateLimitConfig{Rate: 1, Burst: 2}, func() time.Time { return now })
+	h := l.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	request := func(addr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/health", nil)
+		req.RemoteAddr = addr
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for i := 0; i < 2; i++ {
+		if rr := request("192.0.2.1:1000"); rr.Code != http.StatusOK {
+			t.Fatalf("Expected request %d within the burst to pass, got %d", i, rr.Code)
+		}
+	}
+	rr := request("192.0.2.1:1001")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "1" {
+		t.Errorf("Expected 429 with Retry-After 1, got %d %q", rr.Code, rr.Header().Get("Retry-After"))
+	}
+	if rr := request("192.0.2.2:1000"); rr.Code != http.StatusOK {
+		t.Errorf("Expected another client to be unaffected, got %d", rr.Code)
+	}
+
+	now = now.Add(time.Second)
+	if rr := request("192.0.2.1:1000"); rr.Code != http.StatusOK {
+		t.Errorf("Expected a refilled token after one second, got %d", rr.Code)
+	}
+
+	if removed := l.sweep(now.Add(time.Minute)); removed != 2 {
+		t.Errorf("Expected both idle buckets to be swept, got %d", removed)
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	var deadline time.Time
+	var ok bool
+	h := withTimeout(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadline, ok = r.Context().Deadline()
+	}))
+
+	start := time.Now()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if !ok || deadline.Before(start) || deadline.After(start.Add(time.Second+100*time.Millisecond)) {
+		t.Errorf("Expected a deadline about a second away, got %v (set: %v)", deadline.Sub(start), ok)
+	}
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"bufio"
+	"container/list"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// redisPasswordSecret authenticates to Redis when set
+const redisPasswordSecret = "redis-password"
+
+// redisKeyPrefix keeps nonce keys apart from anything else in the Redis database
+const redisKeyPrefix = "zk:nonce:"
+
+// Namespaces of the single-use values kept in the nonce store
+const (
+	noncePoW        = "pow:"  // proof-of-work challenges
+	nonceSignature  = "sig:"  // request signatures within the replay window
+	nonceOIDCState  = "oidc:" // sign-ins started at /oidc/login
+	nonceIdempotent = "idem:" // requests with an Idempotency-Key and their responses
+)
+
+var errNonceStoreUnavailable = errs.New(errs.Unavailable, "nonce_store_unavailable", "replay protection is unavailable, try again later")
+
+// NonceConfig selects where single-use values are kept. Replicas must share a Redis store for
+// challenges, signatures and sign-ins to be single-use across them.
+type NonceConfig struct {
+	Backend  string // "memory" or "redis"
+	Capacity int    // memory: entries kept before the least recently stored is evicted
+	Redis    RedisConfig
+}
+
+// RedisConfig locates a Redis server; the password is the redis-password secret
+type RedisConfig struct {
+	Addr    string
+	DB      int
+	TLS     bool
+	Timeout time.Duration
+}
+
+// NonceStore keeps short-lived values that may be used once
+type NonceStore interface {
+	// Put stores value under key until expires. It returns false, storing nothing, when key is
+	// already stored and unexpired.
+	Put(ctx context.Context, key string, value []byte, expires time.Time) (bool, error)
+	// Take removes key and returns its value, or false when key is not stored or has expired
+	Take(ctx context.Context, key string) ([]byte, bool, error)
+	// Get returns the value of key without removing it, or false when key is not stored or has expired
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Ping(ctx context.Context) error
+}
+
+// nonces is the process-wide store, replaced from configuration at startup
+var nonces = newMeteredNonceStore(newMemoryNonceStore(100000, time.Now))
+
+func newNonceStore(cfg NonceConfig, p SecretProvider) (NonceStore, error) {
+	switch cfg.Backend {
+	case "", "memory":
+		if cfg.Capacity < 1 {
+			return nil, fmt.Errorf("nonce store capacity must be positive, got %d", cfg.Capacity)
+		}
+		return newMemoryNonceStore(cfg.Capacity, time.Now), nil
+	case "redis":
+		if cfg.Redis.Addr == "" {
+			return nil, errors.New("the redis nonce store needs ZK_REDIS_ADDR")
+		}
+		password, err := optionalSecret(context.Background(), p, redisPasswordSecret)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", redisPasswordSecret, err)
+		}
+		return newRedisNonceStore(cfg.Redis, password), nil
+	default:
+		return nil, fmt.Errorf("unknown nonce store %q", cfg.Backend)
+	}
+}
+
+// nonceEntry is one stored value
+type nonceEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// memoryNonceStore keeps values in process memory. When full, the least recently stored entry
+// is evicted. Entries are mostly read by taking them, so that is also about the least recently used.
+type memoryNonceStore struct {
+	capacity int
+	now      func() time.Time
+
+	mu      sync.Mutex
+	order   *list.List // front is the most recently stored
+	entries map[string]*list.Element
+	evicted atomic.Int64 // unexpired entries dropped to make room
+}
+
+func newMemoryNonceStore(capacity int, now func() time.Time) *memoryNonceStore {
+	return &memoryNonceStore{capacity: capacity, now: now, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (s *memoryNonceStore) Put(_ context.Context, key string, value []byte, expires time.Time) (bool, error) {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.entries[key]; ok {
+		if now.Before(el.Value.(*nonceEntry).expires) {
+			return false, nil
+		}
+		s.removeLocked(el)
+	}
+	for len(s.entries) >= s.capacity {
+		oldest := s.order.Back()
+		if now.Before(oldest.Value.(*nonceEntry).expires) {
+			s.evicted.Add(1)
+		}
+		s.removeLocked(oldest)
+	}
+	s.entries[key] = s.order.PushFront(&nonceEntry{key: key, value: value, expires: expires})
+	return true, nil
+}
+
+func (s *memoryNonceStore) Take(_ context.Context, key string) ([]byte, bool, error) {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	s.removeLocked(el)
+	e := el.Value.(*nonceEntry)
+	if !now.Before(e.expires) {
+		return nil, false, nil
+	}
+	return e.value, true, nil
+}
+
+func (s *memoryNonceStore) Get(_ context.Context, key string) ([]byte, bool, error) {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.entries[key]
+	if !ok || !now.Before(el.Value.(*nonceEntry).expires) {
+		return nil, false, nil
+	}
+	return el.Value.(*nonceEntry).value, true, nil
+}
+
+func (s *memoryNonceStore) Ping(context.Context) error { return nil }
+
+func (s *memoryNonceStore) removeLocked(el *list.Element) {
+	s.order.Remove(el)
+	delete(s.entries, el.Value.(*nonceEntry).key)
+}
+
+// sweep drops expired entries
+func (s *memoryNonceStore) sweep(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed := 0
+	for key, el := range s.entries {
+		if !now.Before(el.Value.(*nonceEntry).expires) {
+			s.order.Remove(el)
+			delete(s.entries, key)
+			removed++
+		}
+	}
+	return removed
+}
+
+// redisNonceStore keeps values in Redis 6.2 or later, which expires them itself.
+// Put is SET NX PXAT and Take is GETDEL, so both are atomic across replicas.
+type redisNonceStore struct {
+	cfg      RedisConfig
+	password string
+	idle     chan *redisConn
+}
+
+// redisConn is one connection speaking RESP2
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+const maxIdleRedisConns = 8
+
+func newRedisNonceStore(cfg RedisConfig, password string) *redisNonceStore {
+	return &redisNonceStore{cfg: cfg, password: password, idle: make(chan *redisConn, maxIdleRedisConns)}
+}
+
+func (s *redisNonceStore) Put(ctx context.Context, key string, value []byte, expires time.Time) (bool, error) {
+	reply, err := s.do(ctx, "SET", redisKeyPrefix+key, string(value), "NX", "PXAT", strconv.FormatInt(expires.UnixMilli(), 10))
+	if err != nil {
+		return false, err
+	}
+	// A nil reply means NX found the key
+	return reply != nil, nil
+}
+
+func (s *redisNonceStore) Take(ctx context.Context, key string) ([]byte, bool, error) {
+	reply, err := s.do(ctx, "GETDEL", redisKeyPrefix+key)
+	if err != nil || reply == nil {
+		return nil, false, err
+	}
+	return []byte(*reply), true, nil
+}
+
+func (s *redisNonceStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	reply, err := s.do(ctx, "GET", redisKeyPrefix+key)
+	if err != nil || reply == nil {
+		return nil, false, err
+	}
+	return []byte(*reply), true, nil
+}
+
+func (s *redisNonceStore) Ping(ctx context.Context) error {
+	_, err := s.do(ctx, "PING")
+	return err
+}
+
+// do sends one command and returns its reply; nil is the RESP null
+func (s *redisNonceStore) do(ctx context.Context, args ...string) (*string, error) {
+	conn, err := s.conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	reply, err := conn.do(ctx, s.cfg.Timeout, args...)
+	var redisErr redisError
+	if err != nil && !errors.As(err, &redisErr) {
+		// The connection may be mid-reply; it cannot be reused
+		conn.Close()
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	select {
+	case s.idle <- conn:
+	default:
+		conn.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	return reply, nil
+}
+
+// conn reuses an idle connection or dials a new one, authenticating and selecting the database
+func (s *redisNonceStore) conn(ctx context.Context) (*redisConn, error) {
+	select {
+	case c := <-s.idle:
+		return c, nil
+	default:
+	}
+
+	dialer := &net.Dialer{Timeout: s.cfg.Timeout}
+	var raw net.Conn
+	var err error
+	if s.cfg.TLS {
+		host, _, _ := net.SplitHostPort(s.cfg.Addr)
+		raw, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}}).DialContext(ctx, "tcp", s.cfg.Addr)
+	} else {
+		raw, err = dialer.DialContext(ctx, "tcp", s.cfg.Addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{Conn: raw, r: bufio.NewReader(raw)}
+	if s.password != "" {
+		if _, err := c.do(ctx, s.cfg.Timeout, "AUTH", s.password); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if s.cfg.DB != 0 {
+		if _, err := c.do(ctx, s.cfg.Timeout, "SELECT", strconv.Itoa(s.cfg.DB)); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// redisError is an error reply; the connection stays usable after one
+type redisError string
+
+func (e redisError) Error() string { return string(e) }
+
+func (c *redisConn) do(ctx context.Context, timeout time.Duration, args ...string) (*string, error) {
+	var deadline time.Time // zero clears the deadline of a reused connection
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	if d, ok := ctx.Deadline(); ok && (deadline.IsZero() || d.Before(deadline)) {
+		deadline = d
+	}
+	_ = c.SetDeadline(deadline)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := io.WriteString(c.Conn, b.String()); err != nil {
+		return nil, err
+	}
+	return c.reply()
+}
+
+// reply reads one simple string, error, integer or bulk string reply
+func (c *redisConn) reply() (*string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("empty reply")
+	}
+	switch line[0] {
+	case '+', ':':
+		s := line[1:]
+		return &s, nil
+	case '-':
+		return nil, redisError(line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("malformed bulk length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		s := string(buf[:n])
+		return &s, nil
+	default:
+		return nil, fmt.Errorf("unexpected reply %q", line)
+	}
+}
+
+// NonceStats counts nonce store operations since startup
+type NonceStats struct {
+	Stored   int64 `json:"stored"`
+	Replayed int64 `json:"replayed"` // puts refused because the key was already stored
+	Taken    int64 `json:"taken"`
+	Missed   int64 `json:"missed"` // takes of keys that were never stored, already taken or expired
+	Evicted  int64 `json:"evicted"`
+	Errors   int64 `json:"errors"`
+}
+
+// meteredNonceStore counts the operations of the store it wraps and turns its failures into
+// errNonceStoreUnavailable, so callers refuse requests rather than skip replay checks
+type meteredNonceStore struct {
+	next                                    NonceStore
+	stored, replayed, taken, missed, failed atomic.Int64
+}
+
+func newMeteredNonceStore(next NonceStore) *meteredNonceStore {
+	return &meteredNonceStore{next: next}
+}
+
+func (m *meteredNonceStore) Put(ctx context.Context, key string, value []byte, expires time.Time) (bool, error) {
+	ok, err := m.next.Put(ctx, key, value, expires)
+	switch {
+	case err != nil:
+		m.failed.Add(1)
+		return false, fmt.Errorf("%w: %v", errNonceStoreUnavailable, err)
+	case ok:
+		m.stored.Add(1)
+	default:
+		m.replayed.Add(1)
+	}
+	return ok, nil
+}
+
+func (m *meteredNonceStore) Take(ctx context.Context, key string) ([]byte, bool, error) {
+	value, ok, err := m.next.Take(ctx, key)
+	switch {
+	case err != nil:
+		m.failed.Add(1)
+		return nil, false, fmt.Errorf("%w: %v", errNonceStoreUnavailable, err)
+	case ok:
+		m.taken.Add(1)
+	default:
+		m.missed.Add(1)
+	}
+	return value, ok, nil
+}
+
+// Get only counts failures, as reading a value neither uses nor refuses it
+func (m *meteredNonceStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, ok, err := m.next.Get(ctx, key)
+	if err != nil {
+		m.failed.Add(1)
+		return nil, false, fmt.Errorf("%w: %v", errNonceStoreUnavailable, err)
+	}
+	return value, ok, nil
+}
+
+func (m *meteredNonceStore) Ping(ctx context.Context) error { return m.next.Ping(ctx) }
+
+func (m *meteredNonceStore) snapshot() NonceStats {
+	stats := NonceStats{
+		Stored:   m.stored.Load(),
+		Replayed: m.replayed.Load(),
+		Taken:    m.taken.Load(),
+		Missed:   m.missed.Load(),
+		Errors:   m.failed.Load(),
+	}
+	if mem, ok := m.next.(*memoryNonceStore); ok {
+		stats.Evicted = mem.evicted.Load()
+	}
+	return stats
+}
+
+// sweep drops expired entries of an in-memory store; Redis expires its own
+func (m *meteredNonceStore) sweep(now time.Time) int {
+	if mem, ok := m.next.(*memoryNonceStore); ok {
+		return mem.sweep(now)
+	}
+	return 0
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+func TestMemoryNonceStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	store := newMemoryNonceStore(2, func() time.Time { return now })
+
+	if ok, _ := store.Put(ctx, "a", []byte("1"), now.Add(time.Minute)); !ok {
+		t.Fatal("Expected a new key to be stored")
+	}
+	if ok, _ := store.Put(ctx, "a", []byte("2"), now.Add(time.Minute)); ok {
+		t.Error("Expected a stored key to be refused")
+	}
+	if value, ok, _ := store.Get(ctx, "a"); !ok || string(value) != "1" {
+		t.Errorf("Expected to read the first value, got %q %v", value, ok)
+	}
+	value, ok, _ := store.Take(ctx, "a")
+	if !ok || string(value) != "1" {
+		t.Errorf("Expected the first value, got %q %v", value, ok)
+	}
+	if _, ok, _ := store.Take(ctx, "a"); ok {
+		t.Error("Expected a key to be taken once")
+	}
+
+	_, _ = store.Put(ctx, "expiring", nil, now.Add(time.Second))
+	now = now.Add(time.Second)
+	if _, ok, _ := store.Take(ctx, "expiring"); ok {
+		t.Error("Expected an expired key to be missing")
+	}
+	if ok, _ := store.Put(ctx, "expiring", nil, now.Add(time.Second)); !ok {
+		t.Error("Expected an expired key to be stored again")
+	}
+
+	// The least recently stored entry makes room when full
+	_, _ = store.Put(ctx, "b", nil, now.Add(time.Minute))
+	_, _ = store.Put(ctx, "c", nil, now.Add(time.Minute))
+	if _, ok, _ := store.Take(ctx, "expiring"); ok {
+		t.Error("Expected the oldest entry to be evicted")
+	}
+	if store.evicted.Load() != 1 {
+		t.Errorf("Expected 1 eviction, got %d", store.evicted.Load())
+	}
+	if n := store.sweep(now.Add(time.Hour)); n != 2 {
+		t.Errorf("Expected 2 entries swept, got %d", n)
+	}
+}
+
+// fakeRedis answers the commands the nonce store sends, without expiring anything
+type fakeRedis struct {
+	password string
+	mu       sync.Mutex
+	data     map[string]string
+	commands []string
+}
+
+func startFakeRedis(t *testing.T, password string) (*fakeRedis, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	f := &fakeRedis{password: password, data: make(map[string]string)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f, ln.Addr().String()
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authed := f.password == ""
+	for {
+		args, err := readRESPCommand(r)
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.commands = append(f.commands, args[0])
+		var reply string
+		switch {
+		case args[0] == "AUTH":
+			authed = args[1] == f.password
+			reply = "+OK\r\n"
+			if !authed {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		case !authed:
+			reply = "-NOAUTH Authentication required\r\n"
+		case args[0] == "PING":
+			reply = "+PONG\r\n"
+		case args[0] == "SELECT":
+			reply = "+OK\r\n"
+		case args[0] == "SET":
+			if _, ok := f.data[args[1]]; ok {
+				reply = "$-1\r\n"
+			} else {
+				f.data[args[1]] = args[2]
+				reply = "+OK\r\n"
+			}
+		case args[0] == "GET":
+			if v, ok := f.data[args[1]]; ok {
+				reply = fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+			} else {
+				reply = "$-1\r\n"
+			}
+		case args[0] == "GETDEL":
+			if v, ok := f.data[args[1]]; ok {
+				delete(f.data, args[1])
+				reply = fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+			} else {
+				reply = "$-1\r\n"
+			}
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		f.mu.Unlock()
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func readRESPCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		if _, err := r.ReadString('\n'); err != nil { // $<length>
+			return nil, err
+		}
+		arg, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args[i] = strings.TrimSuffix(arg, "\r\n")
+	}
+	return args, nil
+}
+
+func TestRedisNonceStore(t *testing.T) {
+	ctx := context.Background()
+	fake, addr := startFakeRedis(t, "hunter2")
+	store := newRedisNonceStore(RedisConfig{Addr: addr, DB: 3, Timeout: time.Second}, "hunter2")
+	expires := time.Now().Add(time.Minute)
+
+	if err := store.Ping(ctx); err != nil {
+		t.Fatalf("Ping failed: %v", err)
+	}
+	if ok, err := store.Put(ctx, "sig:abc", []byte("v"), expires); err != nil || !ok {
+		t.Fatalf("Expected a new key to be stored, got %v %v", ok, err)
+	}
+	if ok, err := store.Put(ctx, "sig:abc", nil, expires); err != nil || ok {
+		t.Errorf("Expected a stored key to be refused, got %v %v", ok, err)
+	}
+	if value, ok, err := store.Get(ctx, "sig:abc"); err != nil || !ok || string(value) != "v" {
+		t.Errorf("Expected to read the stored value, got %q %v %v", value, ok, err)
+	}
+	value, ok, err := store.Take(ctx, "sig:abc")
+	if err != nil || !ok || string(value) != "v" {
+		t.Errorf("Expected the stored value, got %q %v %v", value, ok, err)
+	}
+	if _, ok, err := store.Take(ctx, "sig:abc"); err != nil || ok {
+		t.Errorf("Expected a key to be taken once, got %v %v", ok, err)
+	}
+
+	fake.mu.Lock()
+	got := strings.Join(fake.commands, " ")
+	_, prefixed := fake.data[redisKeyPrefix+"sig:abc"]
+	fake.mu.Unlock()
+	// One connection is dialled, authenticated and reused
+	if got != "AUTH SELECT PING SET SET GET GETDEL GETDEL" {
+		t.Errorf("Unexpected commands %q", got)
+	}
+	if prefixed {
+		t.Error("Expected the taken key to be deleted")
+	}
+
+	wrong := newRedisNonceStore(RedisConfig{Addr: addr, Timeout: time.Second}, "guess")
+	if err := wrong.Ping(ctx); err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Errorf("Expected a wrong password to fail, got %v", err)
+	}
+}
+
+type failingNonceStore struct{}
+
+func (failingNonceStore) Put(context.Context, string, []byte, time.Time) (bool, error) {
+	return false, errors.New("connection refused")
+}
+
+func (failingNonceStore) Take(context.Context, string) ([]byte, bool, error) {
+	return nil, false, errors.New("connection refused")
+}
+
+func (failingNonceStore) Get(context.Context, string) ([]byte, bool, error) {
+	return nil, false, errors.New("connection refused")
+}
+
+func (failingNonceStore) Ping(context.Context) error { return errors.New("connection refused") }
+
+func TestMeteredNonceStore(t *testing.T) {
+	ctx := context.Background()
+	expires := time.Now().Add(time.Minute)
+	m := newMeteredNonceStore(newMemoryNonceStore(10, time.Now))
+	_, _ = m.Put(ctx, "a", nil, expires)
+	_, _ = m.Put(ctx, "a", nil, expires)
+	_, _, _ = m.Take(ctx, "a")
+	_, _, _ = m.Take(ctx, "a")
+	if got := m.snapshot(); got != (NonceStats{Stored: 1, Replayed: 1, Taken: 1, Missed: 1}) {
+		t.Errorf("Unexpected stats %+v", got)
+	}
+
+	failing := newMeteredNonceStore(failingNonceStore{})
+	_, err := failing.Put(ctx, "a", nil, expires)
+	if errs.Status(err) != 503 || errs.Code(err) != "nonce_store_unavailable" {
+		t.Errorf("Expected a failing store to be unavailable, got %d %v", errs.Status(err), err)
+	}
+	if _, _, err := failing.Take(ctx, "a"); !errors.Is(err, errNonceStoreUnavailable) {
+		t.Errorf("Expected errNonceStoreUnavailable, got %v", err)
+	}
+	if got := failing.snapshot().Errors; got != 2 {
+		t.Errorf("Expected 2 errors counted, got %d", got)
+	}
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// smtpPasswordSecret names the SMTP password in the secret provider; it is optional
+const smtpPasswordSecret = "smtp-password"
+
+// Headers sent with webhook notifications
+const (
+	eventTypeHeader        = "X-Event-Type"
+	webhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// notifyQueue bounds the events waiting to be delivered; newer events are dropped when it is full
+const notifyQueue = 1024
+
+var (
+	errSubscriptionNotFound = errs.New(errs.NotFound, "subscription_not_found", "subscription not found")
+	errNotifierUnavailable  = errs.New(errs.Invalid, "notifier_unavailable", "notifier is not configured on this server")
+	subscriptionNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+)
+
+// notifiableEvents are the audit event types a subscription may name; "*" matches all of them
+var notifiableEvents = []string{
+	auditBalanceStored, auditBalanceDeleted, auditBalanceRestored, auditLedgerPosted,
+	auditProofIssued, auditProofVerified, auditProofRejected, auditProofRevoked,
+	auditPolicyAccepted, auditPolicyDenied, auditKeyRotated, auditAttestationExpiring,
+	auditProbeSuspected,
+}
+
+// NotifyConfig configures the notifiers that need server-side settings
+type NotifyConfig struct {
+	SMTP        SMTPConfig
+	HTTPTimeout time.Duration
+}
+
+// SMTPConfig locates the mail relay used by email subscriptions; email is disabled when Addr is empty
+type SMTPConfig struct {
+	Addr     string // host:port
+	From     string
+	Username string // PLAIN auth with the smtp-password secret when set
+}
+
+// Subscription sends the events a tenant is interested in to one destination
+type Subscription struct {
+	Name     string   `json:"name"`
+	Events   []string `json:"events"`           // event types, or "*"
+	Notifier string   `json:"notifier"`         // "webhook", "slack" or "email"
+	URL      string   `json:"url,omitempty"`    // webhook or Slack incoming webhook
+	To       string   `json:"to,omitempty"`     // email recipient
+	Secret   string   `json:"secret,omitempty"` // webhook HMAC key, never returned
+}
+
+// SubscriptionStatus is a subscription as listed back to its tenant
+type SubscriptionStatus struct {
+	Subscription
+	Delivered    int64      `json:"delivered"`
+	Failed       int64      `json:"failed"`
+	LastError    string     `json:"lastError,omitempty"`
+	LastFailedAt *time.Time `json:"lastFailedAt,omitempty"`
+}
+
+// subscription is a registered Subscription with its delivery counters
+type subscription struct {
+	Subscription
+	delivered atomic.Int64
+	failed    atomic.Int64
+
+	mu           sync.Mutex
+	lastError    string
+	lastFailedAt time.Time
+}
+
+func (s *subscription) matches(eventType string) bool {
+	return slices.Contains(s.Events, "*") || slices.Contains(s.Events, eventType)
+}
+
+func (s *subscription) status() SubscriptionStatus {
+	st := SubscriptionStatus{Subscription: s.Subscription, Delivered: s.delivered.Load(), Failed: s.failed.Load()}
+	st.Secret = ""
+	s.mu.Lock()
+	if st.LastError = s.lastError; st.LastError != "" {
+		at := s.lastFailedAt
+		st.LastFailedAt = &at
+	}
+	s.mu.Unlock()
+	return st
+}
+
+// Notifier delivers one event to a subscription's destination
+type Notifier interface {
+	Notify(ctx context.Context, sub *Subscription, e AuditEvent) error
+}
+
+// notificationText is the one-line summary used by chat and email notifiers
+func notificationText(e AuditEvent) string {
+	var b strings.Builder
+	b.WriteString(e.Type)
+	if e.Circuit != "" {
+		fmt.Fprintf(&b, " circuit=%s", e.Circuit)
+	}
+	if e.Subject != "" {
+		fmt.Fprintf(&b, " subject=%s", e.Subject)
+	}
+	if e.Digest != "" {
+		fmt.Fprintf(&b, " digest=%s", e.Digest)
+	}
+	if e.Detail != "" {
+		fmt.Fprintf(&b, ": %s", e.Detail)
+	}
+	return b.String()
+}
+
+// webhookNotifier posts the event as JSON, signed with HMAC-SHA256 of the body when the
+// subscription has a secret
+type webhookNotifier struct {
+	client *http.Client
+}
+
+func (n webhookNotifier) Notify(ctx context.Context, sub *Subscription, e AuditEvent) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	header := http.Header{"Content-Type": {"application/json"}, eventTypeHeader: {e.Type}}
+	if sub.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(sub.Secret))
+		mac.Write(body)
+		header.Set(webhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	return postNotification(ctx, n.client, sub.URL, header, body)
+}
+
+// slackNotifier posts to a Slack incoming webhook
+type slackNotifier struct {
+	client *http.Client
+}
+
+func (n slackNotifier) Notify(ctx context.Context, sub *Subscription, e AuditEvent) error {
+	body, err := json.Marshal(map[string]string{"text": "zkTest1: " + notificationText(e)})
+	if err != nil {
+		return err
+	}
+	return postNotification(ctx, n.client, sub.URL, http.Header{"Content-Type": {"application/json"}}, body)
+}
+
+func postNotification(ctx context.Context, client *http.Client, target string, header http.Header, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header = header
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s answered %s", req.URL.Host, resp.Status)
+	}
+	return nil
+}
+
+// emailNotifier sends a plain-text mail through the configured relay
+type emailNotifier struct {
+	cfg      SMTPConfig
+	password string
+	send     func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+func (n emailNotifier) Notify(_ context.Context, sub *Subscription, e AuditEvent) error {
+	var auth smtp.Auth
+	if n.cfg.Username != "" {
+		host, _, _ := strings.Cut(n.cfg.Addr, ":")
+		auth = smtp.PlainAuth("", n.cfg.Username, n.password, host)
+	}
+	text := notificationText(e)
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: [zkTest1] %s\r\nDate: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n\r\nEvent %d at %s\r\n",
+		n.cfg.From, sub.To, e.Type, e.Time.Format(time.RFC1123Z), text, e.Seq, e.Time.Format(time.RFC3339))
+	return n.send(n.cfg.Addr, auth, n.cfg.From, []string{sub.To}, []byte(msg))
+}
+
+// notificationDispatcher holds the subscriptions of every tenant and delivers matching audit events
+type notificationDispatcher struct {
+	mu        sync.RWMutex
+	subs      map[string]map[string]*subscription // by tenant, then name
+	notifiers map[string]Notifier
+	queue     chan AuditEvent
+	dropped   atomic.Int64
+	timeout   time.Duration
+}
+
+func newNotificationDispatcher(notifiers map[string]Notifier, timeout time.Duration) *notificationDispatcher {
+	return &notificationDispatcher{
+		subs:      make(map[string]map[string]*subscription),
+		notifiers: notifiers,
+		queue:     make(chan AuditEvent, notifyQueue),
+		timeout:   timeout,
+	}
+}
+
+// notifications is the running dispatcher, nil until startNotifications
+var notifications *notificationDispatcher
+
+// newNotifiers builds the webhook and Slack notifiers, and email when an SMTP relay is configured
+func newNotifiers(ctx context.Context, cfg NotifyConfig, p SecretProvider) (map[string]Notifier, error) {
+	client := &http.Client{Timeout: cfg.HTTPTimeout}
+	notifiers := map[string]Notifier{
+		"webhook": webhookNotifier{client: client},
+		"slack":   slackNotifier{client: client},
+	}
+	if cfg.SMTP.Addr == "" {
+		return notifiers, nil
+	}
+	if _, err := mail.ParseAddress(cfg.SMTP.From); err != nil {
+		return nil, fmt.Errorf("smtp from address: %w", err)
+	}
+	email := emailNotifier{cfg: cfg.SMTP, send: smtp.SendMail}
+	if cfg.SMTP.Username != "" {
+		var err error
+		if email.password, err = p.Secret(ctx, smtpPasswordSecret); err != nil {
+			return nil, fmt.Errorf("%s: %w", smtpPasswordSecret, err)
+		}
+	}
+	notifiers["email"] = email
+	return notifiers, nil
+}
+
+// startNotifications delivers audit events to subscriptions until stop is closed
+func startNotifications(cfg NotifyConfig, stop <-chan struct{}) (*notificationDispatcher, error) {
+	notifiers, err := newNotifiers(context.Background(), cfg, secrets)
+	if err != nil {
+		return nil, err
+	}
+	d := newNotificationDispatcher(notifiers, cfg.HTTPTimeout)
+	audit.addSink(d.enqueue)
+	go d.run(stop)
+	return d, nil
+}
+
+// enqueue is the audit log sink; it never blocks request handling
+func (d *notificationDispatcher) enqueue(e AuditEvent) {
+	if !slices.Contains(notifiableEvents, e.Type) {
+		return
+	}
+	select {
+	case d.queue <- e:
+	default:
+		d.dropped.Add(1)
+	}
+}
+
+func (d *notificationDispatcher) run(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case e := <-d.queue:
+			d.deliver(e)
+		}
+	}
+}
+
+// deliver sends e to every matching subscription of every tenant. A failed delivery is
+// counted on the subscription and not retried.
+func (d *notificationDispatcher) deliver(e AuditEvent) {
+	d.mu.RLock()
+	var matching []*subscription
+	for _, subs := range d.subs {
+		for _, s := range subs {
+			if s.matches(e.Type) {
+				matching = append(matching, s)
+			}
+		}
+	}
+	d.mu.RUnlock()
+
+	for _, s := range matching {
+		ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+		err := d.notifiers[s.Notifier].Notify(ctx, &s.Subscription, e)
+		cancel()
+		if err != nil {
+			s.failed.Add(1)
+			s.mu.Lock()
+			s.lastError, s.lastFailedAt = err.Error(), time.Now().UTC()
+			s.mu.Unlock()
+			log.Printf("Failed to notify subscription %s of %s: %v", s.Name, e.Type, err)
+			continue
+		}
+		s.delivered.Add(1)
+	}
+}
+
+// check validates a subscription against the notifiers this server has
+func (d *notificationDispatcher) check(s Subscription) error {
+	if _, ok := d.notifiers[s.Notifier]; !ok {
+		switch s.Notifier {
+		case "webhook", "slack", "email":
+			return fmt.Errorf("%w: %s", errNotifierUnavailable, s.Notifier)
+		}
+		return errs.Errorf(errs.Invalid, "notifier must be webhook, slack or email")
+	}
+	if len(s.Events) == 0 {
+		return errs.Errorf(errs.Invalid, "at least one event type is required")
+	}
+	for _, event := range s.Events {
+		if event != "*" && !slices.Contains(notifiableEvents, event) {
+			return errs.Errorf(errs.Invalid, "unknown event type %q", event)
+		}
+	}
+	switch s.Notifier {
+	case "webhook", "slack":
+		u, err := url.Parse(s.URL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return errs.Errorf(errs.Invalid, "url must be an absolute http(s) URL")
+		}
+		if s.To != "" {
+			return errs.Errorf(errs.Invalid, "to is only used by email subscriptions")
+		}
+	case "email":
+		if a, err := mail.ParseAddress(s.To); err != nil || a.Address != s.To {
+			return errs.Errorf(errs.Invalid, "to must be an email address")
+		}
+		if s.URL != "" || s.Secret != "" {
+			return errs.Errorf(errs.Invalid, "url and secret are only used by webhook and slack subscriptions")
+		}
+	}
+	if s.Secret != "" && s.Notifier != "webhook" {
+		return errs.Errorf(errs.Invalid, "secret is only used by webhook subscriptions")
+	}
+	return nil
+}
+
+// subscriptionTenant identifies the caller; subscriptions belong to an authenticated tenant
+func subscriptionTenant(r *http.Request) (string, error) {
+	tenant := tenantID(r)
+	if tenant == anonymousTenant {
+		return "", errs.Errorf(errs.Unauthorized, "subscriptions require an access token, a signed request or a listed X-API-Key")
+	}
+	if notifications == nil {
+		return "", errs.Errorf(errs.Unavailable, "notifications are not running")
+	}
+	return tenant, nil
+}
+
+// putSubscription registers or replaces one of the caller's subscriptions
+func putSubscription(w http.ResponseWriter, r *http.Request) {
+	tenant, err := subscriptionTenant(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	name := r.PathValue("name")
+	if !subscriptionNamePattern.MatchString(name) {
+		writeError(w, errs.Errorf(errs.Invalid, "subscription name must be lowercase letters, digits and dashes"))
+		return
+	}
+
+	var req Subscription
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	req.Name = name
+	if err := notifications.check(req); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	s := &subscription{Subscription: req}
+	notifications.mu.Lock()
+	if notifications.subs[tenant] == nil {
+		notifications.subs[tenant] = make(map[string]*subscription)
+	}
+	notifications.subs[tenant][name] = s
+	notifications.mu.Unlock()
+
+	writeJSON(w, s.status())
+}
+
+// listSubscriptions returns the caller's subscriptions with their delivery counters, by name
+func listSubscriptions(w http.ResponseWriter, r *http.Request) {
+	tenant, err := subscriptionTenant(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	notifications.mu.RLock()
+	list := make([]SubscriptionStatus, 0, len(notifications.subs[tenant]))
+	for _, s := range notifications.subs[tenant] {
+		list = append(list, s.status())
+	}
+	notifications.mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	writeJSON(w, list)
+}
+
+// deleteSubscription removes one of the caller's subscriptions
+func deleteSubscription(w http.ResponseWriter, r *http.Request) {
+	tenant, err := subscriptionTenant(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	name := r.PathValue("name")
+	notifications.mu.Lock()
+	_, ok := notifications.subs[tenant][name]
+	delete(notifications.subs[tenant], name)
+	notifications.mu.Unlock()
+	if !ok {
+		writeError(w, errSubscriptionNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
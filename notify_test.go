@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// withNotifications replaces the dispatcher for the duration of a test
+func withNotifications(t *testing.T, notifiers map[string]Notifier) *notificationDispatcher {
+	t.Helper()
+	saved := notifications
+	notifications = newNotificationDispatcher(notifiers, 5*time.Second)
+	t.Cleanup(func() { notifications = saved })
+	return notifications
+}
+
+func subscriptionRequest(t *testing.T, handler http.HandlerFunc, method, apiKey, name string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	var data []byte
+	if body != nil {
+		data, _ = json.Marshal(body)
+	}
+	req := httptest.NewRequest(method, "/subscriptions/"+name, bytes.NewReader(data))
+	if apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	}
+	req.SetPathValue("name", name)
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	return rr
+}
+
+func TestPutSubscription(t *testing.T) {
+	client := &http.Client{}
+	withNotifications(t, map[string]Notifier{"webhook": webhookNotifier{client}, "slack": slackNotifier{client}})
+	withAPIKeys(t, "key-a", "key-b")
+
+	tests := []struct {
+		name   string
+		apiKey string
+		sub    string
+		body   Subscription
+		status int
+	}{
+		{"Webhook", "key-a", "issued", Subscription{Events: []string{auditProofIssued}, Notifier: "webhook", URL: "https://hooks.example/zk", Secret: "s3cret"}, http.StatusOK},
+		{"Slack for all events", "key-a", "all", Subscription{Events: []string{"*"}, Notifier: "slack", URL: "https://hooks.slack.com/services/T/B/X"}, http.StatusOK},
+		{"No API key", "", "issued", Subscription{Events: []string{auditProofIssued}, Notifier: "webhook", URL: "https://hooks.example/zk"}, http.StatusUnauthorized},
+		{"Email without SMTP", "key-a", "mail", Subscription{Events: []string{auditProofIssued}, Notifier: "email", To: "ops@example.com"}, http.StatusBadRequest},
+		{"Unknown notifier", "key-a", "pager", Subscription{Events: []string{auditProofIssued}, Notifier: "pager"}, http.StatusBadRequest},
+		{"Unknown event", "key-a", "typo", Subscription{Events: []string{"proof.issue"}, Notifier: "webhook", URL: "https://hooks.example/zk"}, http.StatusBadRequest},
+		{"No events", "key-a", "none", Subscription{Notifier: "webhook", URL: "https://hooks.example/zk"}, http.StatusBadRequest},
+		{"Relative URL", "key-a", "rel", Subscription{Events: []string{"*"}, Notifier: "webhook", URL: "/hook"}, http.StatusBadRequest},
+		{"Secret on Slack", "key-a", "slack", Subscription{Events: []string{"*"}, Notifier: "slack", URL: "https://hooks.slack.com/x", Secret: "s"}, http.StatusBadRequest},
+		{"Bad name", "key-a", "Bad_Name", Subscription{Events: []string{"*"}, Notifier: "webhook", URL: "https://hooks.example/zk"}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := subscriptionRequest(t, putSubscription, "PUT", tt.apiKey, tt.sub, tt.body)
+			if rr.Code != tt.status {
+				t.Errorf("Expected %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+			if strings.Contains(rr.Body.String(), "s3cret") {
+				t.Error("Expected the webhook secret not to be returned")
+			}
+		})
+	}
+
+	// Subscriptions belong to the API key that created them
+	var list []SubscriptionStatus
+	rr := subscriptionRequest(t, listSubscriptions, "GET", "key-a", "", nil)
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil || len(list) != 2 || list[0].Name != "all" {
+		t.Errorf("Expected two subscriptions for key-a, got %s", rr.Body.String())
+	}
+	rr = subscriptionRequest(t, listSubscriptions, "GET", "key-b", "", nil)
+	if strings.TrimSpace(rr.Body.String()) != "[]" {
+		t.Errorf("Expected no subscriptions for key-b, got %s", rr.Body.String())
+	}
+	if rr := subscriptionRequest(t, deleteSubscription, "DELETE", "key-b", "issued", nil); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected another tenant's subscription to be invisible, got %d", rr.Code)
+	}
+	if rr := subscriptionRequest(t, deleteSubscription, "DELETE", "key-a", "issued", nil); rr.Code != http.StatusNoContent {
+		t.Errorf("Expected 204 deleting the subscription, got %d", rr.Code)
+	}
+}
+
+func TestNotificationDelivery(t *testing.T) {
+	type received struct {
+		header http.Header
+		body   []byte
+	}
+	var mu sync.Mutex
+	got := map[string][]received{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		got[r.URL.Path] = append(got[r.URL.Path], received{r.Header, body})
+		mu.Unlock()
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	var mails []string
+	email := emailNotifier{
+		cfg: SMTPConfig{Addr: "smtp.example:587", From: "zk@example.com"},
+		send: func(addr string, _ smtp.Auth, from string, to []string, msg []byte) error {
+			mails = append(mails, to[0]+"\n"+string(msg))
+			return nil
+		},
+	}
+	withAPIKeys(t, "key-a")
+	d := withNotifications(t, map[string]Notifier{
+		"webhook": webhookNotifier{server.Client()},
+		"slack":   slackNotifier{server.Client()},
+		"email":   email,
+	})
+
+	subs := map[string]Subscription{
+		"hook":   {Events: []string{auditProofRejected}, Notifier: "webhook", URL: server.URL + "/hook", Secret: "s3cret"},
+		"slack":  {Events: []string{"*"}, Notifier: "slack", URL: server.URL + "/slack"},
+		"mail":   {Events: []string{auditBalanceStored}, Notifier: "email", To: "ops@example.com"},
+		"broken": {Events: []string{auditProofRejected}, Notifier: "webhook", URL: server.URL + "/broken"},
+	}
+	for name, sub := range subs {
+		if rr := subscriptionRequest(t, putSubscription, "PUT", "key-a", name, sub); rr.Code != http.StatusOK {
+			t.Fatalf("Failed to subscribe %s: %s", name, rr.Body.String())
+		}
+	}
+
+	d.deliver(AuditEvent{Seq: 1, Time: time.Now(), Type: auditProofRejected, Circuit: "balance", Detail: "proof invalid"})
+	d.deliver(AuditEvent{Seq: 2, Time: time.Now(), Type: auditBalanceStored, Detail: "self-reported"})
+
+	hooks := got["/hook"]
+	if len(hooks) != 1 {
+		t.Fatalf("Expected one webhook call, got %d", len(hooks))
+	}
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(hooks[0].body)
+	if sig := hooks[0].header.Get(webhookSignatureHeader); sig != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+		t.Errorf("Unexpected webhook signature %q", sig)
+	}
+	if typ := hooks[0].header.Get(eventTypeHeader); typ != auditProofRejected {
+		t.Errorf("Unexpected %s %q", eventTypeHeader, typ)
+	}
+
+	if n := len(got["/slack"]); n != 2 {
+		t.Errorf("Expected Slack to receive both events, got %d", n)
+	} else if !strings.Contains(string(got["/slack"][0].body), "proof.rejected circuit=balance: proof invalid") {
+		t.Errorf("Unexpected Slack message %s", got["/slack"][0].body)
+	}
+
+	if len(mails) != 1 || !strings.HasPrefix(mails[0], "ops@example.com\n") || !strings.Contains(mails[0], "Subject: [zkTest1] balance.stored") {
+		t.Errorf("Expected one balance.stored mail, got %q", mails)
+	}
+
+	var list []SubscriptionStatus
+	rr := subscriptionRequest(t, listSubscriptions, "GET", "key-a", "", nil)
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range list {
+		switch s.Name {
+		case "broken":
+			if s.Failed != 1 || s.LastError == "" || s.LastFailedAt == nil {
+				t.Errorf("Expected the broken webhook to record its failure, got %+v", s)
+			}
+		case "slack":
+			if s.Delivered != 2 {
+				t.Errorf("Expected two deliveries to Slack, got %d", s.Delivered)
+			}
+		}
+	}
+
+	// Events that are not notifiable never reach the queue
+	d.enqueue(AuditEvent{Type: auditFlagUpdated})
+	if len(d.queue) != 0 {
+		t.Error("Expected flag updates not to be queued")
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// Scopes of the endpoint groups client-credentials tokens are authorized for
+const (
+	scopeBalancesWrite  = "balances:write"
+	scopeBalancesRead   = "balances:read"
+	scopeProofsGenerate = "proofs:generate"
+	scopeProofsVerify   = "proofs:verify"
+
+	// scopeProofsBatch moves the token's proofs to the batch lane of the proving queue
+	scopeProofsBatch = "proofs:batch"
+)
+
+// oauthIntrospectionSecret authenticates this server at the introspection endpoint
+const oauthIntrospectionSecret = "oauth-introspection-secret"
+
+const (
+	// introspectionCacheTTL bounds how long an introspected token is trusted without asking again
+	introspectionCacheTTL = time.Minute
+	// maxIntrospectedTokens bounds the introspection cache
+	maxIntrospectedTokens = 10000
+)
+
+var (
+	errTokenRequired     = errs.New(errs.Unauthorized, "token_required", "a bearer access token is required")
+	errInvalidToken      = errs.New(errs.Unauthorized, "invalid_token", "access token is invalid or expired")
+	errInsufficientScope = errs.New(errs.Forbidden, "insufficient_scope", "access token lacks the required scope")
+)
+
+// OAuthConfig selects how bearer access tokens of API clients are validated
+type OAuthConfig struct {
+	Mode             string // "" (off), "introspection" or "jwks"
+	IntrospectionURL string // introspection: RFC 7662 endpoint
+	ClientID         string // introspection: this server's client id at the endpoint
+	JWKSURL          string // jwks: key set the tokens are signed with
+	Issuer           string // jwks: required iss claim
+	Audience         string // required audience; empty accepts any
+	Required         bool   // refuse requests with neither a token nor a session
+	HTTPTimeout      time.Duration
+}
+
+// accessToken is what a validated bearer token grants
+type accessToken struct {
+	ClientID string
+	Subject  string // sub claim, the user a token issued to a user acts for
+	Scopes   []string
+	Expires  time.Time
+}
+
+func (t accessToken) has(scope string) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+// withTokenLane puts the proofs of a request made with token in the token's proving lane
+func withTokenLane(ctx context.Context, token *accessToken) context.Context {
+	if token != nil && token.has(scopeProofsBatch) {
+		return withProvingLane(ctx, laneBatch)
+	}
+	return ctx
+}
+
+// TokenValidator checks a bearer access token. It returns errInvalidToken for tokens it
+// refuses; other errors mean the token could not be checked.
+type TokenValidator interface {
+	Validate(ctx context.Context, token string) (accessToken, error)
+}
+
+var (
+	// tokenValidator is the configured validator; nil leaves the API open as before
+	tokenValidator TokenValidator
+	// oauthRequired refuses API calls without a token unless they come from a browser signed in
+	// through the identity provider or are signed
+	oauthRequired bool
+)
+
+func newTokenValidator(cfg OAuthConfig, p SecretProvider) (TokenValidator, error) {
+	client := &http.Client{Timeout: cfg.HTTPTimeout}
+	switch cfg.Mode {
+	case "":
+		if cfg.Required {
+			return nil, errors.New("ZK_OAUTH_REQUIRED needs a token validation mode")
+		}
+		return nil, nil
+	case "introspection":
+		if cfg.IntrospectionURL == "" || cfg.ClientID == "" {
+			return nil, errors.New("token introspection needs an endpoint URL and client id")
+		}
+		secret, err := p.Secret(context.Background(), oauthIntrospectionSecret)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", oauthIntrospectionSecret, err)
+		}
+		return &introspectionValidator{
+			url:      cfg.IntrospectionURL,
+			clientID: cfg.ClientID,
+			secret:   secret,
+			audience: cfg.Audience,
+			client:   client,
+			now:      time.Now,
+			cache:    make(map[string]accessToken),
+		}, nil
+	case "jwks":
+		if cfg.JWKSURL == "" || cfg.Issuer == "" {
+			return nil, errors.New("JWT access tokens need a JWKS URL and issuer")
+		}
+		return &jwtValidator{
+			keys:     newJWKSCache(cfg.JWKSURL, client, time.Now),
+			issuer:   cfg.Issuer,
+			audience: cfg.Audience,
+			now:      time.Now,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown token validation mode %q", cfg.Mode)
+	}
+}
+
+// introspectionValidator asks the authorization server about each token (RFC 7662) and
+// caches active tokens briefly, as every API call would otherwise cost a round trip
+type introspectionValidator struct {
+	url      string
+	clientID string
+	secret   string
+	audience string
+	client   *http.Client
+	now      func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]accessToken // by SHA-256 of the token
+}
+
+func (v *introspectionValidator) Validate(ctx context.Context, token string) (accessToken, error) {
+	sum := sha256.Sum256([]byte(token))
+	key := hex.EncodeToString(sum[:])
+	now := v.now()
+
+	v.mu.Lock()
+	cached, ok := v.cache[key]
+	v.mu.Unlock()
+	if ok && now.Before(cached.Expires) {
+		return cached, nil
+	}
+
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return accessToken{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(v.clientID), url.QueryEscape(v.secret))
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return accessToken{}, errs.Wrap(errs.BadGateway, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return accessToken{}, errs.Wrap(errs.BadGateway, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return accessToken{}, errs.Errorf(errs.BadGateway, "token introspection answered %s", resp.Status)
+	}
+
+	var result struct {
+		Active   bool            `json:"active"`
+		Scope    string          `json:"scope"`
+		ClientID string          `json:"client_id"`
+		Sub      string          `json:"sub"`
+		Exp      int64           `json:"exp"`
+		Aud      json.RawMessage `json:"aud"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return accessToken{}, errs.Errorf(errs.BadGateway, "token introspection: %w", err)
+	}
+	if !result.Active {
+		return accessToken{}, errInvalidToken
+	}
+	if v.audience != "" && !slices.Contains(audiences(result.Aud), v.audience) {
+		return accessToken{}, fmt.Errorf("%w: wrong audience", errInvalidToken)
+	}
+
+	granted := accessToken{
+		ClientID: result.ClientID,
+		Subject:  result.Sub,
+		Scopes:   strings.Fields(result.Scope),
+		Expires:  now.Add(introspectionCacheTTL),
+	}
+	if result.Exp != 0 {
+		exp := time.Unix(result.Exp, 0)
+		if !now.Before(exp) {
+			return accessToken{}, fmt.Errorf("%w: expired", errInvalidToken)
+		}
+		if exp.Before(granted.Expires) {
+			granted.Expires = exp
+		}
+	}
+
+	v.mu.Lock()
+	if len(v.cache) >= maxIntrospectedTokens {
+		for k, t := range v.cache {
+			if !now.Before(t.Expires) {
+				delete(v.cache, k)
+			}
+		}
+	}
+	if len(v.cache) < maxIntrospectedTokens {
+		v.cache[key] = granted
+	}
+	v.mu.Unlock()
+	return granted, nil
+}
+
+// jwtValidator checks JWT access tokens locally against the issuer's published keys
+type jwtValidator struct {
+	keys     *jwksCache
+	issuer   string
+	audience string
+	now      func() time.Time
+}
+
+func (v *jwtValidator) Validate(ctx context.Context, token string) (accessToken, error) {
+	var claims struct {
+		Iss      string          `json:"iss"`
+		Sub      string          `json:"sub"`
+		Aud      json.RawMessage `json:"aud"`
+		Exp      int64           `json:"exp"`
+		Nbf      int64           `json:"nbf"`
+		Scope    string          `json:"scope"`
+		Scp      []string        `json:"scp"`
+		ClientID string          `json:"client_id"`
+		Azp      string          `json:"azp"`
+	}
+	if err := verifyJWT(ctx, v.keys, token, &claims); err != nil {
+		return accessToken{}, tokenError(errInvalidToken, err)
+	}
+
+	now := v.now()
+	switch {
+	case claims.Iss != v.issuer:
+		return accessToken{}, fmt.Errorf("%w: wrong issuer", errInvalidToken)
+	case v.audience != "" && !slices.Contains(audiences(claims.Aud), v.audience):
+		return accessToken{}, fmt.Errorf("%w: wrong audience", errInvalidToken)
+	case claims.Exp == 0 || !now.Before(time.Unix(claims.Exp, 0)):
+		return accessToken{}, fmt.Errorf("%w: expired", errInvalidToken)
+	case claims.Nbf != 0 && now.Before(time.Unix(claims.Nbf, 0)):
+		return accessToken{}, fmt.Errorf("%w: not yet valid", errInvalidToken)
+	}
+
+	granted := accessToken{ClientID: claims.ClientID, Subject: claims.Sub, Scopes: claims.Scp, Expires: time.Unix(claims.Exp, 0)}
+	if claims.Scope != "" {
+		granted.Scopes = strings.Fields(claims.Scope)
+	}
+	for _, id := range []string{claims.Azp, claims.Sub} {
+		if granted.ClientID == "" {
+			granted.ClientID = id
+		}
+	}
+	return granted, nil
+}
+
+// authenticate validates the bearer token of r. It returns nil without a token when the
+// request may proceed anyway, and writes the error response when ok is false.
+func authenticate(w http.ResponseWriter, r *http.Request) (token *accessToken, ok bool) {
+	token, present, ok := bearerToken(w, r)
+	if !ok || present || tokenValidator == nil {
+		return token, ok
+	}
+
+	// Browsers signed in through the identity provider use their session, which the handlers
+	// check, and HMAC-signed requests were verified by the middleware. Demo sessions are
+	// open to anyone, so they do not stand in for a token.
+	if s, _, hasCookie, err := requestSession(r); !oauthRequired || hasCookie && err == nil && s.provider == sessionProviderOIDC || isSignedRequest(r) {
+		return nil, true
+	}
+	w.Header().Set("WWW-Authenticate", `Bearer`)
+	writeError(w, errTokenRequired)
+	return nil, false
+}
+
+// bearerToken validates the bearer token of r when it has one and tokens are validated. It
+// writes the error response when ok is false.
+func bearerToken(w http.ResponseWriter, r *http.Request) (token *accessToken, present, ok bool) {
+	if tokenValidator == nil {
+		return nil, false, true
+	}
+	raw, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found || raw == "" {
+		return nil, false, true
+	}
+
+	granted, err := tokenValidator.Validate(r.Context(), raw)
+	switch {
+	case errors.Is(err, errInvalidToken):
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeError(w, err)
+		return nil, true, false
+	case err != nil:
+		writeError(w, errs.Wrap(errs.BadGateway, err))
+		return nil, true, false
+	}
+	return &granted, true, true
+}
+
+type accessTokenKey struct{}
+
+// withAccessToken makes ctx carry the validated bearer token of its request, nil for none
+func withAccessToken(ctx context.Context, token *accessToken) context.Context {
+	return context.WithValue(ctx, accessTokenKey{}, token)
+}
+
+// accessTokenOf returns the validated bearer token ctx carries, or nil
+func accessTokenOf(ctx context.Context) *accessToken {
+	token, _ := ctx.Value(accessTokenKey{}).(*accessToken)
+	return token
+}
+
+// identify validates the bearer token of a request to an endpoint that needs no scope, so that
+// its caller is known to tenantID; requests without a token pass as before
+func identify(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, _, ok := bearerToken(w, r)
+		if !ok {
+			return
+		}
+		next(w, r.WithContext(withAccessToken(r.Context(), token)))
+	}
+}
+
+// requireScope lets requests through whose bearer token grants scope; requests without a
+// token pass when authenticate allows them
+func requireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := authenticate(w, r)
+		if !ok {
+			return
+		}
+		if token != nil && !token.has(scope) {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, scope))
+			writeError(w, fmt.Errorf("%w: needs %s", errInsufficientScope, scope))
+			return
+		}
+		next(w, r.WithContext(withTokenLane(withAccessToken(r.Context(), token), token)))
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// withTokenValidator installs v for the duration of the test
+func withTokenValidator(t *testing.T, v TokenValidator, required bool) {
+	t.Helper()
+	previous, previousRequired := tokenValidator, oauthRequired
+	tokenValidator, oauthRequired = v, required
+	t.Cleanup(func() { tokenValidator, oauthRequired = previous, previousRequired })
+}
+
+func accessClaims(idp *fakeIdP, scope string) map[string]any {
+	return map[string]any{
+		"iss":       idp.URL,
+		"sub":       "integrator",
+		"aud":       "zk-api",
+		"exp":       time.Now().Add(time.Hour).Unix(),
+		"scope":     scope,
+		"client_id": "acme-payroll",
+	}
+}
+
+func TestJWTAccessTokens(t *testing.T) {
+	idp := newFakeIdP(t)
+	v, err := newTokenValidator(OAuthConfig{Mode: "jwks", JWKSURL: idp.URL + "/jwks", Issuer: idp.URL, Audience: "zk-api", HTTPTimeout: 5 * time.Second}, envSecrets{})
+	if err != nil {
+		t.Fatalf("Failed to configure validator: %v", err)
+	}
+
+	claims := func(change func(map[string]any)) map[string]any {
+		c := accessClaims(idp, "proofs:generate proofs:verify")
+		change(c)
+		return c
+	}
+	tests := []struct {
+		name   string
+		token  string
+		valid  bool
+		scopes []string
+		client string
+	}{
+		{"RS256", idp.sign(t, "RS256", "rsa", claims(func(map[string]any) {})), true, []string{"proofs:generate", "proofs:verify"}, "acme-payroll"},
+		{"ES256 with scp claim", idp.sign(t, "ES256", "ec", claims(func(c map[string]any) {
+			delete(c, "scope")
+			delete(c, "client_id")
+			c["scp"] = []string{"balances:write"}
+			c["azp"] = "acme-bank"
+		})), true, []string{"balances:write"}, "acme-bank"},
+		{"Audience list", idp.sign(t, "RS256", "rsa", claims(func(c map[string]any) { c["aud"] = []string{"other", "zk-api"} })), true, []string{"proofs:generate", "proofs:verify"}, "acme-payroll"},
+		{"Wrong issuer", idp.sign(t, "RS256", "rsa", claims(func(c map[string]any) { c["iss"] = "https://evil.example" })), false, nil, ""},
+		{"Wrong audience", idp.sign(t, "RS256", "rsa", claims(func(c map[string]any) { c["aud"] = "other" })), false, nil, ""},
+		{"Expired", idp.sign(t, "RS256", "rsa", claims(func(c map[string]any) { c["exp"] = time.Now().Add(-time.Minute).Unix() })), false, nil, ""},
+		{"No expiry", idp.sign(t, "RS256", "rsa", claims(func(c map[string]any) { delete(c, "exp") })), false, nil, ""},
+		{"Not yet valid", idp.sign(t, "RS256", "rsa", claims(func(c map[string]any) { c["nbf"] = time.Now().Add(time.Hour).Unix() })), false, nil, ""},
+		{"Unknown key", idp.sign(t, "RS256", "other", claims(func(map[string]any) {})), false, nil, ""},
+		{"Malformed", "not-a-jwt", false, nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			granted, err := v.Validate(context.Background(), tt.token)
+			if !tt.valid {
+				if !errors.Is(err, errInvalidToken) {
+					t.Fatalf("Expected an invalid token, got %+v, %v", granted, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected a valid token, got %v", err)
+			}
+			if strings.Join(granted.Scopes, " ") != strings.Join(tt.scopes, " ") || granted.ClientID != tt.client || granted.Subject != "integrator" {
+				t.Errorf("Expected scopes %v for %s, got %+v", tt.scopes, tt.client, granted)
+			}
+		})
+	}
+}
+
+func TestTokenIntrospection(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if id, secret, ok := r.BasicAuth(); !ok || id != "zk-api" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.FormValue("token") {
+		case "good":
+			writeJSON(w, map[string]any{"active": true, "scope": "proofs:verify", "client_id": "acme", "sub": "alice123", "aud": "zk-api", "exp": time.Now().Add(time.Hour).Unix()})
+		case "other-audience":
+			writeJSON(w, map[string]any{"active": true, "scope": "proofs:verify", "aud": []string{"elsewhere"}})
+		default:
+			writeJSON(w, map[string]any{"active": false})
+		}
+	}))
+	defer server.Close()
+
+	t.Setenv("ZK_OAUTH_INTROSPECTION_SECRET", "s3cret")
+	v, err := newTokenValidator(OAuthConfig{Mode: "introspection", IntrospectionURL: server.URL, ClientID: "zk-api", Audience: "zk-api", HTTPTimeout: 5 * time.Second}, envSecrets{})
+	if err != nil {
+		t.Fatalf("Failed to configure validator: %v", err)
+	}
+
+	for range 2 {
+		granted, err := v.Validate(context.Background(), "good")
+		if err != nil || granted.ClientID != "acme" || granted.Subject != "alice123" || !granted.has(scopeProofsVerify) {
+			t.Fatalf("Expected an active token, got %+v, %v", granted, err)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Expected the active token to be cached, introspected %d times", n)
+	}
+
+	for _, token := range []string{"revoked", "other-audience"} {
+		if _, err := v.Validate(context.Background(), token); !errors.Is(err, errInvalidToken) {
+			t.Errorf("Expected %s to be refused, got %v", token, err)
+		}
+	}
+
+	broken, err := newTokenValidator(OAuthConfig{Mode: "introspection", IntrospectionURL: server.URL, ClientID: "wrong", HTTPTimeout: 5 * time.Second}, envSecrets{})
+	if err != nil {
+		t.Fatalf("Failed to configure validator: %v", err)
+	}
+	if _, err := broken.Validate(context.Background(), "good"); err == nil || errors.Is(err, errInvalidToken) {
+		t.Errorf("Expected a provider failure, got %v", err)
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	withSessions(t)
+	idp := newFakeIdP(t)
+	v, err := newTokenValidator(OAuthConfig{Mode: "jwks", JWKSURL: idp.URL + "/jwks", Issuer: idp.URL, HTTPTimeout: 5 * time.Second}, envSecrets{})
+	if err != nil {
+		t.Fatalf("Failed to configure validator: %v", err)
+	}
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+
+	rr := sessionRequest(t, login, "POST", "/session", SessionRequest{ID: "alice"}, nil, "")
+	h.AssertStatusCode(rr, http.StatusOK, "signing in")
+	demoCookie := rr.Result().Cookies()[0]
+	rr = httptest.NewRecorder()
+	if _, err := startSession(rr, httptest.NewRequest("GET", "/oidc/callback", nil), "bob", sessionProviderOIDC); err != nil {
+		t.Fatalf("Failed to start an OIDC session: %v", err)
+	}
+	cookie := rr.Result().Cookies()[0]
+
+	verifier := "Bearer " + idp.sign(t, "RS256", "rsa", accessClaims(idp, "proofs:verify"))
+	tests := []struct {
+		name      string
+		validator TokenValidator
+		required  bool
+		auth      string
+		cookie    *http.Cookie
+		status    int
+		challenge string
+	}{
+		{"Tokens off", nil, false, "", nil, http.StatusOK, ""},
+		{"Optional token omitted", v, false, "", nil, http.StatusOK, ""},
+		{"Required token omitted", v, true, "", nil, http.StatusUnauthorized, `Bearer`},
+		{"Signed-in browser", v, true, "", cookie, http.StatusOK, ""},
+		{"Demo session", v, true, "", demoCookie, http.StatusUnauthorized, `Bearer`},
+		{"Stale session", v, true, "", &http.Cookie{Name: sessionCookie, Value: "stale"}, http.StatusUnauthorized, `Bearer`},
+		{"Invalid token", v, false, "Bearer forged", nil, http.StatusUnauthorized, `Bearer error="invalid_token"`},
+		{"Granted scope", v, true, verifier, nil, http.StatusOK, ""},
+		{"Missing scope", v, false, "Bearer " + idp.sign(t, "RS256", "rsa", accessClaims(idp, "proofs:generate")), nil, http.StatusForbidden, `Bearer error="insufficient_scope", scope="proofs:verify"`},
+	}
+
+	handler := requireScope(scopeProofsVerify, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withTokenValidator(t, tt.validator, tt.required)
+			req := httptest.NewRequest("POST", "/validate", nil)
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			if tt.cookie != nil {
+				req.AddCookie(tt.cookie)
+			}
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+			h.AssertStatusCode(rr, tt.status, tt.name)
+			if got := rr.Header().Get("WWW-Authenticate"); got != tt.challenge {
+				t.Errorf("Expected challenge %q, got %q", tt.challenge, got)
+			}
+		})
+	}
+
+	t.Run("Proving lanes", func(t *testing.T) {
+		withTokenValidator(t, v, false)
+		var lane provingLane
+		laneHandler := requireScope(scopeProofsVerify, func(w http.ResponseWriter, r *http.Request) {
+			lane = provingLaneOf(r.Context())
+		})
+		for auth, want := range map[string]provingLane{
+			verifier: laneInteractive,
+			"Bearer " + idp.sign(t, "RS256", "rsa", accessClaims(idp, "proofs:verify proofs:batch")): laneBatch,
+		} {
+			req := httptest.NewRequest("POST", "/validate", nil)
+			req.Header.Set("Authorization", auth)
+			laneHandler(httptest.NewRecorder(), req)
+			if lane != want {
+				t.Errorf("Expected the %s lane, got %s", want, lane)
+			}
+		}
+	})
+}
+
+func TestRPCScopes(t *testing.T) {
+	NewTestHelper(t).SetupCleanBalances()
+	idp := newFakeIdP(t)
+	v, err := newTokenValidator(OAuthConfig{Mode: "jwks", JWKSURL: idp.URL + "/jwks", Issuer: idp.URL, HTTPTimeout: 5 * time.Second}, envSecrets{})
+	if err != nil {
+		t.Fatalf("Failed to configure validator: %v", err)
+	}
+	withTokenValidator(t, v, false)
+
+	body := `[{"jsonrpc": "2.0", "method": "zk_prove", "params": {"id": "nobody", "neededAmount": 1}, "id": 1},
+		{"jsonrpc": "2.0", "method": "zk_validate", "params": {}, "id": 2}]`
+	req := httptest.NewRequest("POST", "/rpc", bytes.NewBufferString(body))
+	req.Header.Set("Authorization", "Bearer "+idp.sign(t, "RS256", "rsa", accessClaims(idp, "proofs:generate")))
+	rr := httptest.NewRecorder()
+	handleRPC(rr, req)
+
+	var responses []rpcResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &responses); err != nil || len(responses) != 2 {
+		t.Fatalf("Expected two responses, got %s (%v)", rr.Body.String(), err)
+	}
+	if responses[0].Error == nil || responses[0].Error.Code != rpcBalanceNotFound {
+		t.Errorf("Expected zk_prove to be allowed, got %+v", responses[0].Error)
+	}
+	if responses[1].Error == nil || responses[1].Error.Code != rpcInsufficientScope {
+		t.Errorf("Expected zk_validate to need proofs:verify, got %+v", responses[1].Error)
+	}
+}
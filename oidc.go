@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// oidcClientSecret is the client secret registered with the identity provider; public
+// clients without one rely on PKCE alone
+const oidcClientSecret = "oidc-client-secret"
+
+const (
+	oidcStateCookie   = "zk_oidc_state"
+	oidcLoginTTL      = 10 * time.Minute // time allowed to finish signing in at the provider
+	oidcClockSkew     = time.Minute
+	oidcDiscoveryPath = "/.well-known/openid-configuration"
+)
+
+var (
+	errOIDCDisabled   = errs.New(errs.NotFound, "oidc_disabled", "OIDC sign-in is not configured")
+	errOIDCRequired   = errs.New(errs.Forbidden, "oidc_required", "sign in through the identity provider at GET /oidc/login")
+	errOIDCState      = errs.New(errs.Unauthorized, "oidc_state_invalid", "unknown or expired sign-in, start again at GET /oidc/login")
+	errOIDCRejected   = errs.New(errs.Unauthorized, "oidc_rejected", "the identity provider did not sign the user in")
+	errIDTokenInvalid = errs.New(errs.Unauthorized, "id_token_invalid", "invalid ID token")
+)
+
+// OIDCConfig configures sign-in through an OpenID Connect provider
+type OIDCConfig struct {
+	DiscoveryURL string // the provider's issuer URL or its /.well-known/openid-configuration
+	ClientID     string
+	RedirectURL  string // this server's /oidc/callback as registered with the provider
+	Scopes       []string
+	HTTPTimeout  time.Duration
+}
+
+// oidcProvider signs browser users in when configured; nil leaves demo sign-in by name
+var oidcProvider *oidcClient
+
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+
+	keys *jwksCache
+}
+
+// pendingLogin is a sign-in started at /oidc/login and not yet completed, kept in the nonce
+// store by state as "<nonce>.<verifier>"
+type pendingLogin struct {
+	nonce    string
+	verifier string // PKCE code verifier
+}
+
+type oidcClient struct {
+	cfg    OIDCConfig
+	secret string
+	client *http.Client
+	now    func() time.Time
+
+	pending NonceStore
+
+	mu   sync.Mutex
+	meta *oidcMetadata // discovered on first use
+}
+
+func newOIDCClient(cfg OIDCConfig, p SecretProvider) (*oidcClient, error) {
+	if cfg.DiscoveryURL == "" {
+		return nil, nil
+	}
+	if cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return nil, errors.New("OIDC sign-in needs a client id and redirect URL")
+	}
+	secret, err := optionalSecret(context.Background(), p, oidcClientSecret)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", oidcClientSecret, err)
+	}
+	return &oidcClient{
+		cfg:     cfg,
+		secret:  secret,
+		client:  &http.Client{Timeout: cfg.HTTPTimeout},
+		now:     time.Now,
+		pending: nonces,
+	}, nil
+}
+
+// oidcBalanceID derives the balance id of a provider's subject. Subjects are only unique per
+// issuer and may be long or personal, so the id is a digest of both.
+func oidcBalanceID(issuer, subject string) string {
+	sum := sha256.Sum256([]byte(issuer + "\x00" + subject))
+	return "oidc-" + hex.EncodeToString(sum[:16])
+}
+
+// metadata returns the provider's discovery document, fetching it on first use so an
+// unreachable provider does not stop the server
+func (c *oidcClient) metadata(ctx context.Context) (oidcMetadata, error) {
+	c.mu.Lock()
+	meta := c.meta
+	c.mu.Unlock()
+	if meta != nil {
+		return *meta, nil
+	}
+
+	discoveryURL := c.cfg.DiscoveryURL
+	if !strings.HasSuffix(discoveryURL, oidcDiscoveryPath) {
+		discoveryURL = strings.TrimRight(discoveryURL, "/") + oidcDiscoveryPath
+	}
+	var m oidcMetadata
+	if err := getProviderJSON(ctx, c.client, discoveryURL, &m); err != nil {
+		return oidcMetadata{}, err
+	}
+	if m.Issuer == "" || m.AuthorizationEndpoint == "" || m.TokenEndpoint == "" || m.JWKSURI == "" {
+		return oidcMetadata{}, errs.Errorf(errs.BadGateway, "identity provider: incomplete discovery document at %s", discoveryURL)
+	}
+	m.keys = newJWKSCache(m.JWKSURI, c.client, c.now)
+
+	c.mu.Lock()
+	c.meta = &m
+	c.mu.Unlock()
+	return m, nil
+}
+
+// idTokenClaims are the ID token claims the server checks
+type idTokenClaims struct {
+	Issuer   string          `json:"iss"`
+	Subject  string          `json:"sub"`
+	Audience json.RawMessage `json:"aud"` // a string or an array of strings
+	Expires  int64           `json:"exp"`
+	Nonce    string          `json:"nonce"`
+}
+
+// verifyIDToken checks an RS256 or ES256 ID token's signature, issuer, audience, expiry and
+// nonce, and returns its claims
+func (c *oidcClient) verifyIDToken(ctx context.Context, meta oidcMetadata, token, nonce string) (idTokenClaims, error) {
+	var claims idTokenClaims
+	if err := verifyJWT(ctx, meta.keys, token, &claims); err != nil {
+		return idTokenClaims{}, tokenError(errIDTokenInvalid, err)
+	}
+	switch {
+	case claims.Issuer != meta.Issuer:
+		return idTokenClaims{}, fmt.Errorf("%w: issued by %q", errIDTokenInvalid, claims.Issuer)
+	case !slices.Contains(audiences(claims.Audience), c.cfg.ClientID):
+		return idTokenClaims{}, fmt.Errorf("%w: issued to another client", errIDTokenInvalid)
+	case c.now().Add(-oidcClockSkew).After(time.Unix(claims.Expires, 0)):
+		return idTokenClaims{}, fmt.Errorf("%w: expired", errIDTokenInvalid)
+	case subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+		return idTokenClaims{}, fmt.Errorf("%w: nonce mismatch", errIDTokenInvalid)
+	case claims.Subject == "":
+		return idTokenClaims{}, fmt.Errorf("%w: no subject", errIDTokenInvalid)
+	}
+	return claims, nil
+}
+
+// exchangeCode redeems an authorization code for the provider's ID token
+func (c *oidcClient) exchangeCode(ctx context.Context, meta oidcMetadata, code, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {c.cfg.RedirectURL},
+		"client_id":     {c.cfg.ClientID},
+		"code_verifier": {verifier},
+	}
+	if c.secret != "" {
+		form.Set("client_secret", c.secret)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", errs.Wrap(errs.BadGateway, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", errs.Wrap(errs.BadGateway, err)
+	}
+	var out struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}
+	_ = json.Unmarshal(data, &out)
+	switch {
+	case resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized:
+		return "", fmt.Errorf("%w: %s", errOIDCRejected, out.Error)
+	case resp.StatusCode != http.StatusOK:
+		return "", errs.Errorf(errs.BadGateway, "identity provider: token endpoint answered %s", resp.Status)
+	case out.IDToken == "":
+		return "", errs.Errorf(errs.BadGateway, "identity provider: no ID token in the token response")
+	}
+	return out.IDToken, nil
+}
+
+// begin records a new sign-in and returns its state and the provider URL to send the user to
+func (c *oidcClient) begin(ctx context.Context, meta oidcMetadata) (state, authURL string, err error) {
+	var nonce, verifier string
+	for _, v := range []*string{&state, &nonce, &verifier} {
+		if *v, err = randomToken(); err != nil {
+			return "", "", err
+		}
+	}
+
+	if _, err := c.pending.Put(ctx, nonceOIDCState+state, []byte(nonce+"."+verifier), c.now().Add(oidcLoginTTL)); err != nil {
+		return "", "", err
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {c.cfg.ClientID},
+		"redirect_uri":          {c.cfg.RedirectURL},
+		"scope":                 {strings.Join(c.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return state, meta.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// finish takes the pending sign-in of state, which can be completed once
+func (c *oidcClient) finish(ctx context.Context, state string) (pendingLogin, bool, error) {
+	value, ok, err := c.pending.Take(ctx, nonceOIDCState+state)
+	if err != nil || !ok {
+		return pendingLogin{}, false, err
+	}
+	nonce, verifier, ok := strings.Cut(string(value), ".")
+	return pendingLogin{nonce: nonce, verifier: verifier}, ok, nil
+}
+
+func setOIDCStateCookie(w http.ResponseWriter, r *http.Request, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/oidc/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		// Lax, so the cookie comes back with the provider's redirect to the callback
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// oidcLogin sends the browser to the identity provider to sign in
+func oidcLogin(w http.ResponseWriter, r *http.Request) {
+	if oidcProvider == nil {
+		writeError(w, errOIDCDisabled)
+		return
+	}
+	meta, err := oidcProvider.metadata(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	state, authURL, err := oidcProvider.begin(r.Context(), meta)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	// The state is bound to this browser, so a sign-in cannot be completed in another one
+	setOIDCStateCookie(w, r, state, int(oidcLoginTTL.Seconds()))
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// oidcCallback completes a sign-in at the identity provider and signs the browser in with
+// the balance id of the token's subject
+func oidcCallback(w http.ResponseWriter, r *http.Request) {
+	if oidcProvider == nil {
+		writeError(w, errOIDCDisabled)
+		return
+	}
+	query := r.URL.Query()
+	state := query.Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		writeError(w, errOIDCState)
+		return
+	}
+	pending, ok, err := oidcProvider.finish(r.Context(), state)
+	setOIDCStateCookie(w, r, "", -1)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if !ok {
+		writeError(w, errOIDCState)
+		return
+	}
+	if reason := query.Get("error"); reason != "" {
+		writeError(w, fmt.Errorf("%w: %s", errOIDCRejected, reason))
+		return
+	}
+
+	meta, err := oidcProvider.metadata(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	token, err := oidcProvider.exchangeCode(r.Context(), meta, query.Get("code"), pending.verifier)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	claims, err := oidcProvider.verifyIDToken(r.Context(), meta, token, pending.nonce)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if _, err := startSession(w, r, oidcBalanceID(claims.Issuer, claims.Subject), sessionProviderOIDC); err != nil {
+		writeError(w, err)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
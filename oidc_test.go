@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeIdP is an OIDC provider with one RSA and one P-256 signing key
+type fakeIdP struct {
+	*httptest.Server
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+
+	challenge string // PKCE challenge of the latest authorization request
+	idToken   string // returned by the token endpoint
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	t.Helper()
+	idp := &fakeIdP{}
+	var err error
+	if idp.rsaKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	if idp.ecKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		t.Fatalf("Failed to generate EC key: %v", err)
+	}
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"keys": []map[string]string{
+			{"kid": "rsa", "kty": "RSA", "use": "sig", "n": b64(idp.rsaKey.N.Bytes()), "e": b64([]byte{1, 0, 1})},
+			{"kid": "ec", "kty": "EC", "crv": "P-256", "x": b64(idp.ecKey.X.FillBytes(make([]byte, 32))), "y": b64(idp.ecKey.Y.FillBytes(make([]byte, 32)))},
+			{"kid": "enc", "kty": "RSA", "use": "enc", "n": "AQAB", "e": "AQAB"},
+		}})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if r.FormValue("code") != "good-code" || b64(sum[:]) != idp.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]string{"error": "invalid_grant"})
+			return
+		}
+		writeJSON(w, map[string]string{"id_token": idp.idToken})
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+// sign returns a compact JWS of claims, signed with the key of kid
+func (idp *fakeIdP) sign(t *testing.T, alg, kid string, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(input))
+
+	var sig []byte
+	switch kid {
+	case "rsa":
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, idp.rsaKey, crypto.SHA256, digest[:]); err != nil {
+			t.Fatalf("Failed to sign: %v", err)
+		}
+	case "ec":
+		r, s, err := ecdsa.Sign(rand.Reader, idp.ecKey, digest[:])
+		if err != nil {
+			t.Fatalf("Failed to sign: %v", err)
+		}
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func (idp *fakeIdP) claims(nonce string) map[string]any {
+	return map[string]any{
+		"iss":   idp.URL,
+		"sub":   "248289761001",
+		"aud":   "zktest1",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": nonce,
+	}
+}
+
+func withOIDC(t *testing.T, idp *fakeIdP) *oidcClient {
+	t.Helper()
+	client, err := newOIDCClient(OIDCConfig{
+		DiscoveryURL: idp.URL,
+		ClientID:     "zktest1",
+		RedirectURL:  "https://zk.example/oidc/callback",
+		Scopes:       []string{"openid"},
+		HTTPTimeout:  5 * time.Second,
+	}, envSecrets{})
+	if err != nil {
+		t.Fatalf("Failed to configure OIDC: %v", err)
+	}
+	previous := oidcProvider
+	oidcProvider = client
+	t.Cleanup(func() { oidcProvider = previous })
+	return client
+}
+
+func TestOIDCSignIn(t *testing.T) {
+	withSessions(t)
+	idp := newFakeIdP(t)
+	withOIDC(t, idp)
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+
+	rr := httptest.NewRecorder()
+	oidcLogin(rr, httptest.NewRequest("GET", "/oidc/login", nil))
+	h.AssertStatusCode(rr, http.StatusFound, "starting sign-in")
+	location, err := url.Parse(rr.Header().Get("Location"))
+	if err != nil || !strings.HasPrefix(location.String(), idp.URL+"/authorize?") {
+		t.Fatalf("Expected a redirect to the provider, got %q", rr.Header().Get("Location"))
+	}
+	auth := location.Query()
+	if auth.Get("code_challenge_method") != "S256" || auth.Get("scope") != "openid" || auth.Get("nonce") == "" {
+		t.Errorf("Unexpected authorization request %v", auth)
+	}
+	idp.challenge = auth.Get("code_challenge")
+	stateCookie := rr.Result().Cookies()[0]
+
+	callback := func(state, code string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/oidc/callback?"+url.Values{"state": {state}, "code": {code}}.Encode(), nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rr := httptest.NewRecorder()
+		oidcCallback(rr, req)
+		return rr
+	}
+
+	idp.idToken = idp.sign(t, "RS256", "rsa", idp.claims(auth.Get("nonce")))
+	if rr := callback(auth.Get("state"), "good-code", &http.Cookie{Name: oidcStateCookie, Value: "other"}); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a state from another browser to be refused, got %d", rr.Code)
+	}
+
+	rr = callback(auth.Get("state"), "good-code", stateCookie)
+	h.AssertStatusCode(rr, http.StatusSeeOther, "completing sign-in")
+	var session *http.Cookie
+	for _, c := range rr.Result().Cookies() {
+		if c.Name == sessionCookie {
+			session = c
+		}
+	}
+	if session == nil {
+		t.Fatal("Expected a session cookie")
+	}
+
+	if rr := callback(auth.Get("state"), "good-code", stateCookie); rr.Code != http.StatusUnauthorized || !strings.Contains(rr.Body.String(), "oidc_state_invalid") {
+		t.Errorf("Expected a completed sign-in not to be replayed, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = sessionRequest(t, getSession, "GET", "/session", nil, session, "")
+	h.AssertStatusCode(rr, http.StatusOK, "reading the session")
+	var resp SessionResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode session: %v", err)
+	}
+	want := oidcBalanceID(idp.URL, "248289761001")
+	if resp.ID != want || resp.Provider != sessionProviderOIDC {
+		t.Fatalf("Expected an OIDC session for %s, got %+v", want, resp)
+	}
+
+	h.AssertStatusCode(sessionRequest(t, storeBalance, "POST", "/store/sum", BalanceRequest{ID: want, Amount: 100}, session, resp.CSRFToken), http.StatusOK, "storing the subject's balance")
+	h.AssertStatusCode(sessionRequest(t, storeBalance, "POST", "/store/sum", BalanceRequest{ID: "alice", Amount: 100}, session, resp.CSRFToken), http.StatusForbidden, "storing another user's balance")
+
+	if rr := sessionRequest(t, login, "POST", "/session", SessionRequest{ID: "alice"}, nil, ""); rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "oidc_required") {
+		t.Errorf("Expected demo sign-in to be refused with OIDC configured, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestOIDCCallbackRejectsBadCode(t *testing.T) {
+	withSessions(t)
+	idp := newFakeIdP(t)
+	client := withOIDC(t, idp)
+
+	meta, err := client.metadata(context.Background())
+	if err != nil {
+		t.Fatalf("Discovery failed: %v", err)
+	}
+	state, _, err := client.begin(context.Background(), meta)
+	if err != nil {
+		t.Fatalf("Failed to begin sign-in: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/oidc/callback?state="+state+"&code=stolen", nil)
+	req.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: state})
+	rr := httptest.NewRecorder()
+	oidcCallback(rr, req)
+	if rr.Code != http.StatusUnauthorized || !strings.Contains(rr.Body.String(), "oidc_rejected") {
+		t.Errorf("Expected a code the provider rejects to fail sign-in, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	idp := newFakeIdP(t)
+	client := withOIDC(t, idp)
+	meta, err := client.metadata(context.Background())
+	if err != nil {
+		t.Fatalf("Discovery failed: %v", err)
+	}
+
+	with := func(key string, value any) map[string]any {
+		claims := idp.claims("n0nce")
+		claims[key] = value
+		return claims
+	}
+	valid := idp.sign(t, "RS256", "rsa", idp.claims("n0nce"))
+	parts := strings.Split(valid, ".")
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"RS256", valid, true},
+		{"ES256", idp.sign(t, "ES256", "ec", idp.claims("n0nce")), true},
+		{"Audience list", idp.sign(t, "RS256", "rsa", with("aud", []string{"other", "zktest1"})), true},
+		{"Algorithm confusion", idp.sign(t, "ES256", "rsa", idp.claims("n0nce")), false},
+		{"Unsigned", parts[0] + "." + parts[1] + ".", false},
+		{"Tampered claims", parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"admin"}`)) + "." + parts[2], false},
+		{"Unknown key", idp.sign(t, "RS256", "rotated", idp.claims("n0nce")), false},
+		{"Other issuer", idp.sign(t, "RS256", "rsa", with("iss", "https://evil.example")), false},
+		{"Other audience", idp.sign(t, "RS256", "rsa", with("aud", "someone-else")), false},
+		{"Expired", idp.sign(t, "RS256", "rsa", with("exp", time.Now().Add(-time.Hour).Unix())), false},
+		{"Other nonce", idp.sign(t, "RS256", "rsa", with("nonce", "replayed")), false},
+		{"No subject", idp.sign(t, "RS256", "rsa", with("sub", "")), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := client.verifyIDToken(context.Background(), meta, tt.token, "n0nce")
+			if tt.valid && (err != nil || claims.Subject != "248289761001") {
+				t.Errorf("Expected the token to verify, got %+v, %v", claims, err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("Expected the token to be rejected")
+			}
+		})
+	}
+}
+
+func TestOIDCBalanceID(t *testing.T) {
+	a := oidcBalanceID("https://accounts.example", "alice")
+	if a != oidcBalanceID("https://accounts.example", "alice") || len(a) > maxUserIDLen {
+		t.Errorf("Expected a stable id of at most %d characters, got %q", maxUserIDLen, a)
+	}
+	if a == oidcBalanceID("https://other.example", "alice") {
+		t.Error("Expected the same subject at another issuer to get another id")
+	}
+}
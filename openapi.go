@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	rawMessageType    = reflect.TypeOf(json.RawMessage(nil))
+	timeType          = reflect.TypeOf(time.Time{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// dtoField is one JSON field of a request or response struct
+type dtoField struct {
+	GoName    string
+	JSONName  string
+	Tag       string // the json tag as written
+	OmitEmpty bool
+	Embedded  bool // an embedded struct whose fields are promoted into the object
+	Type      reflect.Type
+}
+
+// dtoFields lists the fields encoding/json marshals of the struct type t
+func dtoFields(t reflect.Type) []dtoField {
+	var fields []dtoField
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		field := dtoField{GoName: f.Name, JSONName: name, Tag: tag, OmitEmpty: strings.Contains(opts, "omitempty"), Type: f.Type}
+		if f.Anonymous && name == "" {
+			field.Embedded = true
+		} else if name == "" {
+			field.JSONName = f.Name
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// dtoName is the exported name a named type is generated under
+func dtoName(t reflect.Type) string {
+	r, size := utf8.DecodeRuneInString(t.Name())
+	return string(unicode.ToUpper(r)) + t.Name()[size:]
+}
+
+// dtoKind classifies types that are not described field by field
+func dtoKind(t reflect.Type) string {
+	switch {
+	case t == rawMessageType || t.Kind() == reflect.Interface:
+		return "any"
+	case t == timeType:
+		return "time"
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		return "bytes"
+	case t.Name() != "" && (t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType)):
+		return "any"
+	case t.Name() != "" && (t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType)):
+		return "text"
+	}
+	return ""
+}
+
+// OpenAPI is the subset of an OpenAPI 3.1 document the API is described with
+type OpenAPI struct {
+	OpenAPI    string                                 `json:"openapi"`
+	Info       map[string]string                      `json:"info"`
+	Paths      map[string]map[string]OpenAPIOperation `json:"paths"`
+	Components struct {
+		Schemas         map[string]any `json:"schemas"`
+		SecuritySchemes map[string]any `json:"securitySchemes"`
+	} `json:"components"`
+}
+
+type OpenAPIOperation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Parameters  []map[string]any      `json:"parameters,omitempty"`
+	RequestBody map[string]any        `json:"requestBody,omitempty"`
+	Responses   map[string]any        `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+// newOpenAPI describes endpoints, with their named types as component schemas
+func newOpenAPI(endpoints []Endpoint) (*OpenAPI, error) {
+	doc := &OpenAPI{
+		OpenAPI: "3.1.0",
+		Info:    map[string]string{"title": "zkTest1", "version": serverVersion},
+		Paths:   make(map[string]map[string]OpenAPIOperation),
+	}
+	schemas := openAPISchemas{defs: make(map[string]any), types: make(map[string]reflect.Type)}
+	errorSchema, _ := schemas.of(reflect.TypeOf(ErrorResponse{}))
+	doc.Components.SecuritySchemes = map[string]any{"bearerAuth": map[string]string{"type": "http", "scheme": "bearer"}}
+
+	for _, e := range endpoints {
+		op := OpenAPIOperation{
+			OperationID: e.Name,
+			Summary:     e.Summary,
+			Responses: map[string]any{
+				"default": map[string]any{"description": "Error", "content": map[string]any{"application/json": map[string]any{"schema": errorSchema}}},
+			},
+		}
+		for _, p := range e.pathParams() {
+			op.Parameters = append(op.Parameters, map[string]any{"name": p, "in": "path", "required": true, "schema": map[string]string{"type": "string"}})
+		}
+		for _, q := range e.Query {
+			op.Parameters = append(op.Parameters, map[string]any{"name": q, "in": "query", "schema": map[string]string{"type": "string"}})
+		}
+		if e.Request != nil {
+			schema, err := schemas.of(reflect.TypeOf(e.Request))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", e.Name, err)
+			}
+			op.RequestBody = map[string]any{"required": true, "content": map[string]any{"application/json": map[string]any{"schema": schema}}}
+		}
+		success := map[string]any{"description": http.StatusText(e.status())}
+		if e.Response != nil {
+			schema, err := schemas.of(reflect.TypeOf(e.Response))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", e.Name, err)
+			}
+			success["content"] = map[string]any{"application/json": map[string]any{"schema": schema}}
+		}
+		op.Responses[fmt.Sprint(e.status())] = success
+		if e.Scope != "" {
+			op.Security = []map[string][]string{{"bearerAuth": {e.Scope}}}
+		}
+
+		if doc.Paths[e.Path] == nil {
+			doc.Paths[e.Path] = make(map[string]OpenAPIOperation)
+		}
+		doc.Paths[e.Path][strings.ToLower(e.Method)] = op
+	}
+	doc.Components.Schemas = schemas.defs
+	return doc, nil
+}
+
+// openAPISchemas collects the component schemas of named struct types
+type openAPISchemas struct {
+	defs  map[string]any
+	types map[string]reflect.Type // to refuse two types of the same name
+}
+
+func (s *openAPISchemas) of(t reflect.Type) (map[string]any, error) {
+	switch dtoKind(t) {
+	case "any":
+		return map[string]any{}, nil
+	case "time":
+		return map[string]any{"type": "string", "format": "date-time"}, nil
+	case "bytes":
+		return map[string]any{"type": "string", "contentEncoding": "base64"}, nil
+	case "text":
+		return map[string]any{"type": "string"}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return s.of(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}, nil
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}, nil
+	case reflect.Slice, reflect.Array:
+		items, err := s.of(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"type": "array", "items": items}, nil
+	case reflect.Map:
+		values, err := s.of(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"type": "object", "additionalProperties": values}, nil
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		name := dtoName(t)
+		ref := map[string]any{"$ref": "#/components/schemas/" + name}
+		if seen, ok := s.types[name]; ok {
+			if seen != t {
+				return nil, fmt.Errorf("types %s and %s are both named %s", seen, t, name)
+			}
+			return ref, nil
+		}
+		s.types[name] = t
+		def, err := s.object(t)
+		if err != nil {
+			return nil, err
+		}
+		s.defs[name] = def
+		return ref, nil
+	}
+	return nil, fmt.Errorf("cannot describe %s", t)
+}
+
+// object describes a struct's fields, including those promoted from embedded structs
+func (s *openAPISchemas) object(t reflect.Type) (map[string]any, error) {
+	properties := make(map[string]any)
+	var required []string
+	var walk func(t reflect.Type) error
+	walk = func(t reflect.Type) error {
+		for _, f := range dtoFields(t) {
+			if f.Embedded {
+				embedded := f.Type
+				if embedded.Kind() == reflect.Pointer {
+					embedded = embedded.Elem()
+				}
+				if err := walk(embedded); err != nil {
+					return err
+				}
+				continue
+			}
+			schema, err := s.of(f.Type)
+			if err != nil {
+				return fmt.Errorf("%s.%s: %w", t.Name(), f.GoName, err)
+			}
+			properties[f.JSONName] = schema
+			if !f.OmitEmpty && f.Type.Kind() != reflect.Pointer {
+				required = append(required, f.JSONName)
+			}
+		}
+		return nil
+	}
+	if err := walk(t); err != nil {
+		return nil, err
+	}
+	object := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		object["required"] = required
+	}
+	return object, nil
+}
+
+var (
+	openAPIOnce sync.Once
+	openAPIDoc  []byte
+	openAPIErr  error
+)
+
+// getOpenAPI serves the OpenAPI document of the typed API
+func getOpenAPI(w http.ResponseWriter, r *http.Request) {
+	openAPIOnce.Do(func() {
+		var doc *OpenAPI
+		if doc, openAPIErr = newOpenAPI(apiEndpoints()); openAPIErr == nil {
+			openAPIDoc, openAPIErr = json.Marshal(doc)
+		}
+	})
+	if openAPIErr != nil {
+		writeError(w, openAPIErr)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(openAPIDoc)
+}
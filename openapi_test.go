@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOpenAPIDescribesEveryEndpoint(t *testing.T) {
+	endpoints := apiEndpoints()
+	doc, err := newOpenAPI(endpoints)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := make(map[string]bool)
+	for _, e := range endpoints {
+		if ids[e.Name] {
+			t.Errorf("endpoint name %s is used twice", e.Name)
+		}
+		ids[e.Name] = true
+		op, ok := doc.Paths[e.Path][map[string]string{"GET": "get", "POST": "post", "PUT": "put", "DELETE": "delete"}[e.Method]]
+		if !ok {
+			t.Errorf("%s %s is missing from the document", e.Method, e.Path)
+			continue
+		}
+		if op.OperationID != e.Name {
+			t.Errorf("%s: operation id %q", e.Name, op.OperationID)
+		}
+		if len(op.Parameters) != len(e.pathParams())+len(e.Query) {
+			t.Errorf("%s: %d parameters", e.Name, len(op.Parameters))
+		}
+		if (e.Scope != "") != (len(op.Security) > 0) {
+			t.Errorf("%s: security %v for scope %q", e.Name, op.Security, e.Scope)
+		}
+	}
+
+	if _, ok := doc.Components.Schemas["BalanceRequest"]; !ok {
+		t.Error("BalanceRequest has no component schema")
+	}
+	validate := doc.Paths["/validate"]["post"]
+	if _, ok := validate.Responses["200"]; !ok {
+		t.Errorf("/validate responses: %v", validate.Responses)
+	}
+}
+
+func TestRegisterEndpoints(t *testing.T) {
+	mux := http.NewServeMux()
+	registerEndpoints(mux, []Endpoint{{Name: "Echo", Method: "GET", Path: "/echo/{id}", Handler: func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{"id": r.PathValue("id")})
+	}}})
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/echo/alice", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != "{\"id\":\"alice\"}\n" {
+		t.Errorf("got %d %s", rr.Code, rr.Body.String())
+	}
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("POST", "/echo/alice", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST got %d", rr.Code)
+	}
+}
+
+func TestGetOpenAPI(t *testing.T) {
+	rr := httptest.NewRecorder()
+	getOpenAPI(rr, httptest.NewRequest("GET", "/openapi.json", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", rr.Code, rr.Body.String())
+	}
+	var doc OpenAPI
+	if err := json.NewDecoder(rr.Body).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.OpenAPI != "3.1.0" || len(doc.Paths) == 0 {
+		t.Errorf("document %+v", doc)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// Policy is a relying party's named set of verification rules
+type Policy struct {
+	Name            string          `json:"name"`
+	Predicates      []PredicateSpec `json:"predicates"`
+	MaxProofAge     string          `json:"maxProofAge,omitempty"` // e.g. "24h"; unset means no limit
+	Audience        string          `json:"audience,omitempty"`    // required audience of the proof
+	CheckRevocation bool            `json:"checkRevocation,omitempty"`
+	Issuer          string          `json:"issuer,omitempty"` // trusted peer whose proofs the policy accepts instead of this server's
+
+	composite compositePolicy
+	maxAge    time.Duration
+}
+
+var (
+	policies   = make(map[string]*Policy)
+	policiesMu sync.RWMutex
+)
+
+var (
+	errPolicyNotFound  = errs.New(errs.NotFound, "policy_not_found", "policy not found")
+	errMalformedProof  = errs.ErrProofMalformed
+	errProofUnknown    = errs.New(errs.Unauthorized, "proof_unknown", "proof was not issued by this server")
+	errProofExpired    = errs.New(errs.Unauthorized, "proof_expired", "proof is older than the policy allows")
+	errAudienceMissing = errs.New(errs.Unauthorized, "audience_mismatch", "proof was not issued for the policy audience")
+	errProofRevoked    = errs.New(errs.Unauthorized, "proof_revoked", "proof has been revoked")
+)
+
+// compile validates the policy and resolves its predicates and maximum age
+func (p *Policy) compile() error {
+	composite, err := parseCompositePolicy(p.Predicates)
+	if err != nil {
+		return err
+	}
+	p.composite = composite
+
+	if p.Issuer != "" && (p.MaxProofAge != "" || p.Audience != "" || p.CheckRevocation) {
+		return fmt.Errorf("maxProofAge, audience and checkRevocation need proofs issued by this server, not %s", p.Issuer)
+	}
+
+	p.maxAge = 0
+	if p.MaxProofAge != "" {
+		if p.maxAge, err = time.ParseDuration(p.MaxProofAge); err != nil || p.maxAge <= 0 {
+			return fmt.Errorf("maxProofAge must be a positive duration, got %q", p.MaxProofAge)
+		}
+	}
+	return nil
+}
+
+func lookupPolicy(name string) (*Policy, error) {
+	policiesMu.RLock()
+	defer policiesMu.RUnlock()
+
+	p, ok := policies[name]
+	if !ok {
+		return nil, errPolicyNotFound
+	}
+	return p, nil
+}
+
+// check enforces the policy on a proof issued by this server, or by its issuer when it names one
+func (p *Policy) check(ctx context.Context, proof json.RawMessage, now time.Time) error {
+	if p.Issuer != "" {
+		return p.enforceIssuedBy(ctx, proof)
+	}
+	return p.enforce(ctx, proof, now)
+}
+
+// enforceIssuedBy verifies the policy's predicates against the issuer's pinned verifying key
+// for the composite circuit; the peer must be pinned for that circuit's name
+func (p *Policy) enforceIssuedBy(ctx context.Context, proof json.RawMessage) error {
+	decoded, err := decodeProofJSON(defaultCurve, proof)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errMalformedProof, err)
+	}
+	assignment, err := p.composite.assignment("")
+	if err != nil {
+		return err
+	}
+	public, err := frontend.NewWitness(assignment, defaultCurve.ScalarField(), frontend.PublicOnly())
+	if err != nil {
+		return err
+	}
+	return verifyPeerProof(ctx, p.Issuer, p.composite.circuitName(), defaultCurve, decoded, public)
+}
+
+// enforce runs every rule of the policy against proof, SNARK verification first.
+// Rules other than the predicates rely on the issuance record of the proof.
+func (p *Policy) enforce(ctx context.Context, proof json.RawMessage, now time.Time) error {
+	decoded, err := decodeProofJSON(defaultCurve, proof)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errMalformedProof, err)
+	}
+
+	if err := p.composite.verify(ctx, decoded); err != nil {
+		return err
+	}
+
+	if p.maxAge == 0 && p.Audience == "" && !p.CheckRevocation {
+		return nil
+	}
+
+	digest, err := proofDigest(decoded)
+	if err != nil {
+		return err
+	}
+	record, ok := lookupProofRecord(digest)
+	if !ok {
+		return errProofUnknown
+	}
+
+	if p.maxAge > 0 && now.Sub(record.CreatedAt) > p.maxAge {
+		return errProofExpired
+	}
+	if p.Audience != "" && record.Audience != p.Audience {
+		return errAudienceMissing
+	}
+	if p.CheckRevocation && isRevoked(digest) {
+		return errProofRevoked
+	}
+	return nil
+}
+
+// putPolicy registers or replaces the policy named in the path
+func putPolicy(w http.ResponseWriter, r *http.Request) {
+	var p Policy
+	if err := decodeJSON(w, r, &p); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	p.Name = r.PathValue("name")
+	if err := p.compile(); err != nil {
+		writeError(w, errs.Wrap(errs.Invalid, err))
+		return
+	}
+
+	policiesMu.Lock()
+	policies[p.Name] = &p
+	policiesMu.Unlock()
+
+	audit.record(AuditEvent{Type: auditPolicyUpdated, Subject: p.Name})
+
+	writeJSON(w, &p)
+}
+
+func getPolicy(w http.ResponseWriter, r *http.Request) {
+	p, err := lookupPolicy(r.PathValue("name"))
+	if err != nil {
+		writeError(w, errs.Wrap(errs.NotFound, err))
+		return
+	}
+	writeJSON(w, p)
+}
+
+type PolicyValidateRequest struct {
+	Proof json.RawMessage `json:"proof"`
+}
+
+// validatePolicy enforces a registered policy on a proof: predicates, proof age, audience and revocation
+func validatePolicy(w http.ResponseWriter, r *http.Request) {
+	var req PolicyValidateRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	p, err := lookupPolicy(r.PathValue("name"))
+	if err != nil {
+		writeError(w, errs.Wrap(errs.NotFound, err))
+		return
+	}
+	if err := checkTenantAccess(r, compositeEnvelopeCircuit, p.composite.thresholds()...); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	err = p.check(r.Context(), req.Proof, time.Now())
+	if err == nil {
+		audit.record(AuditEvent{Type: auditPolicyAccepted, Subject: p.Name})
+	} else {
+		audit.record(AuditEvent{Type: auditPolicyDenied, Subject: p.Name, Detail: err.Error()})
+	}
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
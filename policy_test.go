@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPolicyCompile(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      Policy
+		expectError bool
+	}{
+		{"Predicates only", Policy{Predicates: []PredicateSpec{{Name: "balance", Threshold: 100}}}, false},
+		{"With max age", Policy{Predicates: []PredicateSpec{{Name: "age", Threshold: 18}}, MaxProofAge: "24h"}, false},
+		{"No predicates", Policy{MaxProofAge: "1h"}, true},
+		{"Unknown predicate", Policy{Predicates: []PredicateSpec{{Name: "height", Threshold: 1}}}, true},
+		{"Bad max age", Policy{Predicates: []PredicateSpec{{Name: "balance", Threshold: 1}}, MaxProofAge: "soon"}, true},
+		{"Negative max age", Policy{Predicates: []PredicateSpec{{Name: "balance", Threshold: 1}}, MaxProofAge: "-1h"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.compile()
+			if (err != nil) != tt.expectError {
+				t.Errorf("compile() error = %v, expectError %v", err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestUnknownPolicy(t *testing.T) {
+	req := httptest.NewRequest("POST", "/validate/policy/missing", strings.NewReader(`{"proof": {}}`))
+	req.SetPathValue("name", "missing")
+	rr := httptest.NewRecorder()
+	validatePolicy(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", rr.Code)
+	}
+}
+
+func TestPolicyEnforcement(t *testing.T) {
+	SkipIfShort(t, "policy enforcement")
+
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+	h.StoreBalance("policy_user", 1000)
+
+	predicates := []PredicateSpec{{Name: "balance", Threshold: 500}}
+	issue := func(audience string) json.RawMessage {
+		rr := postJSON(t, generateCompositeProof, "/get/proof/composite", CompositeProofRequest{
+			ID: "policy_user", Predicates: predicates, Audience: audience,
+		})
+		h.AssertStatusCode(rr, http.StatusOK, "generating composite proof")
+		var resp struct {
+			Proof json.RawMessage `json:"proof"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return resp.Proof
+	}
+
+	policy := &Policy{Name: "loan", Predicates: predicates, MaxProofAge: "1h", Audience: "bank", CheckRevocation: true}
+	if err := policy.compile(); err != nil {
+		t.Fatalf("Failed to compile policy: %v", err)
+	}
+
+	proof := issue("bank")
+	now := time.Now()
+
+	if err := policy.enforce(context.Background(), proof, now); err != nil {
+		t.Fatalf("Expected proof to satisfy the policy, got %v", err)
+	}
+	if err := policy.enforce(context.Background(), proof, now.Add(2*time.Hour)); err != errProofExpired {
+		t.Errorf("Expected errProofExpired, got %v", err)
+	}
+	if err := policy.enforce(context.Background(), issue("shop"), now); err != errAudienceMissing {
+		t.Errorf("Expected errAudienceMissing, got %v", err)
+	}
+
+	stricter := &Policy{Predicates: []PredicateSpec{{Name: "balance", Threshold: 900}}}
+	if err := stricter.compile(); err != nil {
+		t.Fatalf("Failed to compile policy: %v", err)
+	}
+	if err := stricter.enforce(context.Background(), proof, now); err != errInvalidProof {
+		t.Errorf("Expected errInvalidProof for different predicates, got %v", err)
+	}
+
+	decoded, _ := decodeProofJSON(defaultCurve, proof)
+	digest, _ := proofDigest(decoded)
+	revokedProofsMu.Lock()
+	revokedProofs[digest] = now
+	revokedProofsMu.Unlock()
+
+	if err := policy.enforce(context.Background(), proof, now); err != errProofRevoked {
+		t.Errorf("Expected errProofRevoked, got %v", err)
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/korjavin/zkTest1/circuits"
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// Identity of the disjunctive predicate circuit
+const (
+	predicateCircuitName    = circuits.PredicateName
+	predicateCircuitVersion = 2
+)
+
+// PredicateClause is a single "attribute >= threshold" comparison
+type PredicateClause struct {
+	Attribute string
+	Threshold int64
+}
+
+var (
+	errEmptyPredicate        = errs.New(errs.Invalid, "empty_predicate", "predicate must not be empty")
+	errPredicateNotSatisfied = errs.New(errs.Unprocessable, "predicate_unsatisfied", "predicate not satisfied")
+	clausePattern            = regexp.MustCompile(`^([A-Za-z]+)\s*>=\s*(\d+)$`)
+	orPattern                = regexp.MustCompile(`\s*(?:\|\||\s[Oo][Rr]\s)\s*`)
+)
+
+// parsePredicate parses expressions such as "balance >= 100 || creditScore >= 700"
+func parsePredicate(expr string) ([]PredicateClause, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return nil, errEmptyPredicate
+	}
+
+	parts := orPattern.Split(expr, -1)
+	if len(parts) > circuits.MaxPredicateClauses {
+		return nil, fmt.Errorf("predicate may have at most %d clauses", circuits.MaxPredicateClauses)
+	}
+
+	clauses := make([]PredicateClause, 0, len(parts))
+	for _, part := range parts {
+		m := clausePattern.FindStringSubmatch(strings.TrimSpace(part))
+		if m == nil {
+			return nil, fmt.Errorf("invalid clause %q: expected <attribute> >= <integer>", part)
+		}
+		if attributeIndex(m[1]) < 0 {
+			return nil, fmt.Errorf("unknown attribute %q", m[1])
+		}
+		threshold, err := strconv.ParseInt(m[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid threshold %q", m[2])
+		}
+		clauses = append(clauses, PredicateClause{Attribute: m[1], Threshold: threshold})
+	}
+	return clauses, nil
+}
+
+// formatPredicate renders clauses in canonical form
+func formatPredicate(clauses []PredicateClause) string {
+	parts := make([]string, len(clauses))
+	for i, c := range clauses {
+		parts[i] = fmt.Sprintf("%s >= %d", c.Attribute, c.Threshold)
+	}
+	return strings.Join(parts, " || ")
+}
+
+func attributeIndex(name string) int {
+	for i, a := range circuits.PredicateAttributes {
+		if a == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// predicateAssignment builds the public part of the witness for clauses;
+// values holds the private attribute values and may be nil for verification
+func predicateAssignment(clauses []PredicateClause, values map[string]int64) *circuits.PredicateCircuit {
+	var assignment circuits.PredicateCircuit
+	satisfied := false
+	for i := 0; i < circuits.MaxPredicateClauses; i++ {
+		assignment.Values[i], assignment.Selectors[i] = 0, 0
+		assignment.Enabled[i], assignment.Attribute[i], assignment.Threshold[i] = 0, 0, 0
+		if i >= len(clauses) {
+			continue
+		}
+
+		c := clauses[i]
+		assignment.Enabled[i] = 1
+		assignment.Attribute[i] = attributeIndex(c.Attribute)
+		assignment.Threshold[i] = c.Threshold
+
+		if v, ok := values[c.Attribute]; ok {
+			assignment.Values[i] = v
+			if !satisfied && v >= c.Threshold {
+				assignment.Selectors[i] = 1
+				satisfied = true
+			}
+		}
+	}
+	return &assignment
+}
+
+type PredicateProofRequest struct {
+	ID        string `json:"id"`
+	Predicate string `json:"predicate"`
+}
+
+type PredicateProofResponse struct {
+	Predicate string        `json:"predicate"`
+	Proof     groth16.Proof `json:"proof"`
+}
+
+type PredicateValidateRequest struct {
+	Predicate string          `json:"predicate"`
+	Proof     json.RawMessage `json:"proof"`
+	Curve     string          `json:"curve,omitempty"` // curve the proof was made on; bn254 when empty
+}
+
+// generatePredicateProof proves a disjunction of thresholds over the stored attributes of a user
+func generatePredicateProof(w http.ResponseWriter, r *http.Request) {
+	var req PredicateProofRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := checkSessionUser(r, req.ID); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	clauses, err := parsePredicate(req.Predicate)
+	if err != nil {
+		writeError(w, errs.Wrap(errs.Invalid, err))
+		return
+	}
+	if err := checkTenantAccess(r, predicateCircuitName, clauseThresholds(clauses)...); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := checkUserIssuance(req.ID); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	values := attributeValues(req.ID)
+	if len(values) == 0 {
+		writeError(w, errs.Errorf(errs.NotFound, "no attributes stored for id"))
+		return
+	}
+
+	assignment := predicateAssignment(clauses, values)
+	if !assignmentSatisfied(assignment) {
+		writeError(w, errPredicateNotSatisfied)
+		return
+	}
+
+	curve := proofCurve(r, predicateCircuitName)
+	setup, err := loadCurveSetup(curve, predicateCircuitName, &circuits.PredicateCircuit{})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	proof, err := setup.prove(r.Context(), assignment)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	predicate := formatPredicate(clauses)
+	digest, err := persistProof(r.Context(), proof, ProofRecord{
+		Circuit:        predicateCircuitName,
+		CircuitVersion: predicateCircuitVersion,
+		Curve:          recordedCurve(curve),
+		PublicInputs:   map[string]string{"predicate": predicate},
+		Holder:         req.ID,
+	})
+	if err != nil {
+		log.Printf("Failed to persist proof: %v", err)
+	}
+	if digest != "" {
+		w.Header().Set("X-Proof-Digest", digest)
+	}
+	setProofHeaders(w, curve, assignment)
+	signIssuedProof(w, curve, predicateCircuitName, map[string]string{"predicate": predicate}, proof, assignment)
+
+	writeProof(w, r, proof, PredicateProofResponse{Predicate: predicate, Proof: proof})
+}
+
+// clauseThresholds returns the thresholds of a predicate's clauses
+func clauseThresholds(clauses []PredicateClause) []int64 {
+	thresholds := make([]int64, len(clauses))
+	for i, c := range clauses {
+		thresholds[i] = c.Threshold
+	}
+	return thresholds
+}
+
+func assignmentSatisfied(assignment *circuits.PredicateCircuit) bool {
+	for _, s := range assignment.Selectors {
+		if s == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// validatePredicateProof verifies a proof against a predicate expression
+func validatePredicateProof(w http.ResponseWriter, r *http.Request) {
+	var req PredicateValidateRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	clauses, err := parsePredicate(req.Predicate)
+	if err != nil {
+		writeError(w, errs.Wrap(errs.Invalid, err))
+		return
+	}
+	if err := checkTenantAccess(r, predicateCircuitName, clauseThresholds(clauses)...); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	curve, err := verifyCurve(req.Curve, predicateCircuitName)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	proof, err := decodeProofJSON(curve, req.Proof)
+	if err != nil {
+		writeError(w, fmt.Errorf("%w: %v", errMalformedProof, err))
+		return
+	}
+
+	setup, err := loadCurveSetup(curve, predicateCircuitName, &circuits.PredicateCircuit{})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	err = setup.verify(r.Context(), proof, predicateAssignment(clauses, nil))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestParsePredicate(t *testing.T) {
+	tests := []struct {
+		name        string
+		expr        string
+		expected    string
+		expectError bool
+	}{
+		{"Single clause", "balance >= 100", "balance >= 100", false},
+		{"Double pipe", "balance>=100 || creditScore >= 700", "balance >= 100 || creditScore >= 700", false},
+		{"OR keyword", "balance >= 100 OR creditScore >= 700", "balance >= 100 || creditScore >= 700", false},
+		{"Empty", "  ", "", true},
+		{"Unknown attribute", "age >= 18", "", true},
+		{"Unsupported operator", "balance < 100", "", true},
+		{"Negative threshold", "balance >= -1", "", true},
+		{"Too many clauses", "balance >= 1 || balance >= 2 || balance >= 3 || balance >= 4 || balance >= 5", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clauses, err := parsePredicate(tt.expr)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error for %q", tt.expr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := formatPredicate(clauses); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestPredicateProofWorkflow(t *testing.T) {
+	SkipIfShort(t, "predicate proof generation")
+
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+	h.StoreBalance("or_user", 50)
+	postJSON(t, storeCreditScore, "/store/credit-score", CreditScoreRequest{ID: "or_user", Score: 720})
+
+	predicate := "balance >= 100 || creditScore >= 700"
+	rr := postJSON(t, generatePredicateProof, "/get/proof/predicate", PredicateProofRequest{ID: "or_user", Predicate: predicate})
+	h.AssertStatusCode(rr, http.StatusOK, "generating predicate proof")
+
+	var resp struct {
+		Predicate string          `json:"predicate"`
+		Proof     json.RawMessage `json:"proof"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		predicate      string
+		expectedStatus int
+	}{
+		{"Same predicate", predicate, http.StatusOK},
+		{"Different threshold", "balance >= 100 || creditScore >= 800", http.StatusUnauthorized},
+		{"Clauses swapped", "creditScore >= 700 || balance >= 100", http.StatusUnauthorized},
+		{"Malformed predicate", "creditScore > 700", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			valid := postJSON(t, validatePredicateProof, "/validate/predicate", PredicateValidateRequest{Predicate: tt.predicate, Proof: resp.Proof})
+			h.AssertStatusCode(valid, tt.expectedStatus, tt.name)
+		})
+	}
+
+	t.Run("Unsatisfied predicate", func(t *testing.T) {
+		rr := postJSON(t, generatePredicateProof, "/get/proof/predicate", PredicateProofRequest{ID: "or_user", Predicate: "balance >= 100 || creditScore >= 800"})
+		h.AssertStatusCode(rr, http.StatusUnprocessableEntity, "proving unsatisfied predicate")
+	})
+}
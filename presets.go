@@ -0,0 +1,44 @@
+package main
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/korjavin/zkTest1/circuits"
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// Proving presets a request can pick instead of a circuit's default shape. Each preset is its own
+// circuit with its own keys, so a proof is validated with the preset it was made with.
+const (
+	presetFast    = "fast"    // narrower range checks: fewer constraints, smaller values only
+	presetCompact = "compact" // range checks by bit decomposition: smaller proofs, slower proving
+)
+
+// circuitPresets maps a circuit to the circuits proving its presets
+var circuitPresets = map[string]map[string]string{
+	balanceCircuitName: {
+		presetFast:    circuits.FastName,
+		presetCompact: circuits.CompactName,
+	},
+}
+
+// presetCircuit returns the circuit proving circuit with preset; an empty preset is circuit itself
+func presetCircuit(circuit, preset string) (string, error) {
+	if preset == "" {
+		return circuit, nil
+	}
+	presets := circuitPresets[circuit]
+	if name, ok := presets[preset]; ok {
+		return name, nil
+	}
+	if len(presets) == 0 {
+		return "", errs.Errorf(errs.Invalid, "circuit %s has no presets", circuit)
+	}
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return "", errs.Errorf(errs.Invalid, "preset of %s must be one of %s", circuit, strings.Join(names, ", "))
+}
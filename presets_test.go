@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/korjavin/zkTest1/circuits"
+)
+
+func TestBalanceCircuitFor(t *testing.T) {
+	tests := []struct {
+		comparison, preset string
+		want               string
+		wantErr            string
+	}{
+		{"", "", balanceCircuitName, ""},
+		{comparisonAbove, "", strictBalanceCircuitName, ""},
+		{"", presetFast, circuits.FastName, ""},
+		{comparisonAtLeast, presetCompact, circuits.CompactName, ""},
+		{"", "tiny", "", "preset of balance must be one of compact, fast"},
+		{comparisonAbove, presetFast, "", "circuit balance-strict has no presets"},
+	}
+	for _, tt := range tests {
+		got, err := balanceCircuitFor(tt.comparison, tt.preset)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("%q/%q: expected %q, got %v", tt.comparison, tt.preset, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%q/%q: expected %s, got %s, %v", tt.comparison, tt.preset, tt.want, got, err)
+		}
+	}
+}
+
+func TestProofPresets(t *testing.T) {
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+	t.Cleanup(h.SetupCleanBalances)
+	h.AssertStatusCode(h.StoreBalance("preset_user", 100), http.StatusOK, "storing a balance")
+
+	for _, preset := range []string{presetFast, presetCompact} {
+		t.Run(preset, func(t *testing.T) {
+			rr := postJSON(t, generateProof, "/get/proof/neededAmount", ProofRequest{ID: "preset_user", NeededAmount: 101, Preset: preset})
+			h.AssertStatusCode(rr, http.StatusUnprocessableEntity, "proof above the balance")
+
+			rr = postJSON(t, generateProof, "/get/proof/neededAmount", ProofRequest{ID: "preset_user", NeededAmount: 100, Preset: preset})
+			h.AssertStatusCode(rr, http.StatusOK, "proof at the balance")
+			if record, ok := lookupProofRecord(rr.Header().Get("X-Proof-Digest")); !ok || record.Circuit != circuitPresets[balanceCircuitName][preset] {
+				t.Errorf("Expected the proof to be recorded with the preset's circuit, got %+v", record)
+			}
+			proof := json.RawMessage(rr.Body.Bytes())
+
+			rr = postJSON(t, validateProof, "/validate", ValidateRequest{NeededAmount: 100, Proof: proof, Preset: preset})
+			h.AssertStatusCode(rr, http.StatusOK, "validating with the preset")
+			rr = postJSON(t, validateProof, "/validate", ValidateRequest{NeededAmount: 99, Proof: proof, Preset: preset})
+			h.AssertStatusCode(rr, http.StatusUnauthorized, "validating against another threshold")
+			rr = postJSON(t, validateProof, "/validate", ValidateRequest{NeededAmount: 100, Proof: proof})
+			h.AssertStatusCode(rr, http.StatusUnauthorized, "validating without the preset")
+		})
+	}
+
+	// A map keeps the threshold of 2^32 expressible where int has 32 bits
+	rr := postJSON(t, generateProof, "/get/proof/neededAmount", map[string]any{"id": "preset_user", "neededAmount": int64(1) << circuits.FastValueBits, "preset": presetFast})
+	h.AssertStatusCode(rr, http.StatusBadRequest, "threshold beyond the fast preset")
+	rr = postJSON(t, generateProof, "/get/proof/neededAmount", ProofRequest{ID: "preset_user", NeededAmount: 1, Preset: "tiny"})
+	h.AssertStatusCode(rr, http.StatusBadRequest, "unknown preset")
+	rr = postJSON(t, validateProof, "/validate", ValidateRequest{NeededAmount: 1, Proof: json.RawMessage(`{}`), Preset: presetFast, Circuit: circuits.FastName})
+	h.AssertStatusCode(rr, http.StatusBadRequest, "preset with a circuit")
+}
+
+func TestCircuitSchemaListsPresets(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/circuits/balance/schema", nil)
+	req.SetPathValue("name", balanceCircuitName)
+	rr := httptest.NewRecorder()
+	getCircuitSchema(rr, req)
+
+	var schema CircuitSchema
+	if err := json.Unmarshal(rr.Body.Bytes(), &schema); err != nil {
+		t.Fatalf("Failed to decode schema: %v", err)
+	}
+	if schema.Presets[presetFast] != circuits.FastName || schema.Presets[presetCompact] != circuits.CompactName {
+		t.Errorf("Expected the balance presets, got %v", schema.Presets)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ProbeConfig configures the detection of balance extraction by converging thresholds; zero
+// Queries disables it
+type ProbeConfig struct {
+	Queries int           // converging thresholds in a row that are flagged, at least 3
+	Window  time.Duration // how long a threshold is remembered
+}
+
+type probe struct {
+	at        time.Time
+	threshold int64
+}
+
+// probeDetector remembers the recent thresholds asked about each user. A binary search for a
+// balance asks ever closer thresholds, so a run of thresholds whose distance to the previous
+// one strictly shrinks is suspicious whether or not the proofs succeed.
+type probeDetector struct {
+	cfg ProbeConfig
+	now func() time.Time
+
+	mu    sync.Mutex
+	users map[string][]probe
+}
+
+func newProbeDetector(cfg ProbeConfig, now func() time.Time) *probeDetector {
+	return &probeDetector{cfg: cfg, now: now, users: make(map[string][]probe)}
+}
+
+var probes = newProbeDetector(ProbeConfig{}, time.Now)
+
+// recent drops the thresholds of user that left the window; callers must hold d.mu
+func (d *probeDetector) recent(user string, now time.Time) []probe {
+	seen := d.users[user]
+	i := 0
+	for i < len(seen) && now.Sub(seen[i].at) >= d.cfg.Window {
+		i++
+	}
+	seen = seen[i:]
+	if len(seen) == 0 {
+		delete(d.users, user)
+		return nil
+	}
+	d.users[user] = seen
+	return seen
+}
+
+// observe remembers a threshold asked about user and reports whether it completes a converging
+// run. A flagged run is forgotten, so one search is flagged once.
+func (d *probeDetector) observe(user string, threshold int64) bool {
+	if d.cfg.Queries <= 0 {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	seen := append(d.recent(user, now), probe{now, threshold})
+	if len(seen) > d.cfg.Queries {
+		seen = seen[len(seen)-d.cfg.Queries:]
+	}
+	if len(seen) == d.cfg.Queries && converging(seen) {
+		delete(d.users, user)
+		return true
+	}
+	d.users[user] = seen
+	return false
+}
+
+// converging reports whether every threshold is strictly closer to its predecessor than that
+// one was to its own
+func converging(seen []probe) bool {
+	previous := int64(-1)
+	for i := 1; i < len(seen); i++ {
+		step := seen[i].threshold - seen[i-1].threshold
+		if step < 0 {
+			step = -step
+		}
+		if step == 0 || (previous >= 0 && step >= previous) {
+			return false
+		}
+		previous = step
+	}
+	return true
+}
+
+// forget drops the thresholds remembered about user
+func (d *probeDetector) forget(user string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.users, user)
+}
+
+// sweep forgets users without thresholds in the window
+func (d *probeDetector) sweep(now time.Time) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	removed := 0
+	for user := range d.users {
+		if d.recent(user, now) == nil {
+			removed++
+		}
+	}
+	return removed
+}
+
+// observeThreshold feeds a threshold a tenant asks about user to the detector and audits a
+// suspected probe. The event names the tenant, but neither the user nor the thresholds.
+func observeThreshold(tenant, user, circuit string, threshold int64) {
+	if !probes.observe(user, threshold) {
+		return
+	}
+	audit.record(AuditEvent{
+		Type:    auditProbeSuspected,
+		Circuit: circuit,
+		Subject: tenant,
+		Detail:  fmt.Sprintf("%d thresholds about one user converged within %s", probes.cfg.Queries, probes.cfg.Window),
+	})
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProbeDetector(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	d := newProbeDetector(ProbeConfig{Queries: 4, Window: time.Hour}, func() time.Time { return now })
+
+	observe := func(user string, thresholds ...int64) (flagged []bool) {
+		for _, threshold := range thresholds {
+			flagged = append(flagged, d.observe(user, threshold))
+			now = now.Add(time.Minute)
+		}
+		return flagged
+	}
+
+	// A binary search for a balance of 3700
+	if got := observe("alice", 5000, 2500, 3750, 3125); got[3] != true || got[2] {
+		t.Errorf("Expected the fourth converging threshold to be flagged, got %v", got)
+	}
+	// Flagged searches are forgotten
+	if got := observe("alice", 3437); got[0] {
+		t.Error("Expected a flagged search to be flagged once")
+	}
+
+	for name, thresholds := range map[string][]int64{
+		"Evenly spaced": {1000, 2000, 3000, 4000},
+		"Diverging":     {3000, 3100, 2800, 3500},
+		"Repeated":      {1000, 500, 500, 500},
+	} {
+		if got := observe(name, thresholds...); got[3] {
+			t.Errorf("%s: expected %v not to be flagged", name, thresholds)
+		}
+	}
+
+	// Thresholds outside the window do not count
+	observe("bob", 5000, 2500, 3750)
+	now = now.Add(time.Hour)
+	if got := observe("bob", 3125); got[0] {
+		t.Error("Expected thresholds outside the window to be forgotten")
+	}
+	now = now.Add(2 * time.Hour)
+	if d.sweep(now); len(d.users) != 0 {
+		t.Errorf("Expected every user to be swept, %d left", len(d.users))
+	}
+
+	disabled := newProbeDetector(ProbeConfig{Window: time.Hour}, time.Now)
+	for _, threshold := range []int64{5000, 2500, 3750, 3125} {
+		if disabled.observe("alice", threshold) {
+			t.Fatal("Expected no detection without a number of queries")
+		}
+	}
+}
+
+func TestObserveThresholdAudits(t *testing.T) {
+	previousAudit, previousProbes := audit, probes
+	t.Cleanup(func() { audit, probes = previousAudit, previousProbes })
+	audit = newAuditLog(10)
+	probes = newProbeDetector(ProbeConfig{Queries: 3, Window: time.Hour}, time.Now)
+
+	for _, threshold := range []int64{8000, 4000, 6000} {
+		observeThreshold("key-0123", "probed_user", balanceCircuitName, threshold)
+	}
+	events := audit.since(0)
+	if len(events) != 1 || events[0].Type != auditProbeSuspected || events[0].Subject != "key-0123" {
+		t.Fatalf("Expected a probe.suspected event naming the tenant, got %+v", events)
+	}
+	if e := events[0]; strings.Contains(e.Detail, "probed_user") || strings.Contains(e.Detail, "6000") {
+		t.Errorf("Expected the event to name neither the user nor a threshold, got %q", e.Detail)
+	}
+}
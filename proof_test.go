@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"testing"
 
 	"github.com/consensys/gnark-crypto/ecc"
 	"github.com/consensys/gnark/backend/groth16"
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
 	"github.com/consensys/gnark/frontend"
 	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/korjavin/zkTest1/circuits"
 )
 
 func TestProofGeneration(t *testing.T) {
@@ -39,7 +43,7 @@ func TestProofGeneration(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Create and compile the circuit
-			ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &BalanceCircuit{})
+			ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &circuits.BalanceCircuit{})
 			if err != nil {
 				t.Fatalf("Failed to compile circuit: %v", err)
 			}
@@ -51,7 +55,7 @@ func TestProofGeneration(t *testing.T) {
 			}
 
 			// Create witness
-			circuit := BalanceCircuit{
+			circuit := circuits.BalanceCircuit{
 				Balance:      tt.balance,
 				NeededAmount: tt.neededAmount,
 			}
@@ -71,7 +75,7 @@ func TestProofGeneration(t *testing.T) {
 				}
 
 				// Verify the proof
-				publicWitness := BalanceCircuit{
+				publicWitness := circuits.BalanceCircuit{
 					NeededAmount: tt.neededAmount,
 				}
 
@@ -98,7 +102,7 @@ func TestProofVerification(t *testing.T) {
 	neededAmount := 100
 
 	// Setup circuit
-	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &BalanceCircuit{})
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &circuits.BalanceCircuit{})
 	if err != nil {
 		t.Fatalf("Failed to compile circuit: %v", err)
 	}
@@ -109,7 +113,7 @@ func TestProofVerification(t *testing.T) {
 	}
 
 	// Generate proof
-	circuit := BalanceCircuit{
+	circuit := circuits.BalanceCircuit{
 		Balance:      balance,
 		NeededAmount: neededAmount,
 	}
@@ -125,7 +129,7 @@ func TestProofVerification(t *testing.T) {
 	}
 
 	t.Run("Valid verification", func(t *testing.T) {
-		publicWitness := BalanceCircuit{
+		publicWitness := circuits.BalanceCircuit{
 			NeededAmount: neededAmount,
 		}
 
@@ -141,7 +145,7 @@ func TestProofVerification(t *testing.T) {
 	})
 
 	t.Run("Invalid verification - wrong needed amount", func(t *testing.T) {
-		wrongPublicWitness := BalanceCircuit{
+		wrongPublicWitness := circuits.BalanceCircuit{
 			NeededAmount: neededAmount + 100, // Different needed amount
 		}
 
@@ -159,7 +163,7 @@ func TestProofVerification(t *testing.T) {
 
 func BenchmarkProofGeneration(b *testing.B) {
 	// Setup circuit once
-	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &BalanceCircuit{})
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &circuits.BalanceCircuit{})
 	if err != nil {
 		b.Fatalf("Failed to compile circuit: %v", err)
 	}
@@ -169,7 +173,7 @@ func BenchmarkProofGeneration(b *testing.B) {
 		b.Fatalf("Failed to setup: %v", err)
 	}
 
-	circuit := BalanceCircuit{
+	circuit := circuits.BalanceCircuit{
 		Balance:      150,
 		NeededAmount: 100,
 	}
@@ -191,7 +195,7 @@ func BenchmarkProofGeneration(b *testing.B) {
 
 func BenchmarkProofVerification(b *testing.B) {
 	// Setup and generate proof once
-	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &BalanceCircuit{})
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &circuits.BalanceCircuit{})
 	if err != nil {
 		b.Fatalf("Failed to compile circuit: %v", err)
 	}
@@ -201,7 +205,7 @@ func BenchmarkProofVerification(b *testing.B) {
 		b.Fatalf("Failed to setup: %v", err)
 	}
 
-	circuit := BalanceCircuit{
+	circuit := circuits.BalanceCircuit{
 		Balance:      150,
 		NeededAmount: 100,
 	}
@@ -216,7 +220,7 @@ func BenchmarkProofVerification(b *testing.B) {
 		b.Fatalf("Failed to generate proof: %v", err)
 	}
 
-	publicWitness := BalanceCircuit{
+	publicWitness := circuits.BalanceCircuit{
 		NeededAmount: 100,
 	}
 
@@ -234,3 +238,29 @@ func BenchmarkProofVerification(b *testing.B) {
 		}
 	}
 }
+
+func TestVerifyGroth16WithoutCommitments(t *testing.T) {
+	setup, err := loadSetup(balanceCircuitName, &circuits.BalanceCircuit{})
+	if err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+	assignment := &circuits.BalanceCircuit{Balance: 150, NeededAmount: 100}
+	proof, err := setup.prove(context.Background(), assignment)
+	if err != nil {
+		t.Fatalf("Prove failed: %v", err)
+	}
+	public, err := frontend.NewWitness(assignment, ecc.BN254.ScalarField(), frontend.PublicOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyGroth16(proof, setup.vk, public); err != nil {
+		t.Fatalf("Expected the proof to verify, got %v", err)
+	}
+
+	// A proof stripped of the range checker's commitment must be rejected, not crash the verifier
+	stripped := *proof.(*groth16_bn254.Proof)
+	stripped.Commitments = nil
+	if err := verifyGroth16(&stripped, setup.vk, public); !errors.Is(err, errInvalidProof) {
+		t.Errorf("Expected %v, got %v", errInvalidProof, err)
+	}
+}
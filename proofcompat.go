@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/blang/semver/v4"
+	"github.com/consensys/gnark"
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// gnarkVersionHeader carries the gnark release a proof was serialized with
+const gnarkVersionHeader = "X-Gnark-Version"
+
+var (
+	// oldestGnark is the earliest release whose JSON proofs can be decoded, directly or through a shim
+	oldestGnark = semver.MustParse("0.8.0")
+
+	// commitmentsGnark is the release that replaced the single Commitment field with Commitments
+	commitmentsGnark = semver.MustParse("0.9.0")
+)
+
+var errProofVersion = errs.New(errs.Unprocessable, "proof_version_unsupported", "proof was serialized by an unsupported gnark version")
+
+// decodeProof decodes a JSON proof on curve serialized by the given gnark release, or a JSON
+// string with the base64 of its binary encoding. An empty version means the proof comes from
+// this server's release.
+func decodeProof(curve ecc.ID, version string, data []byte) (groth16.Proof, error) {
+	v := gnark.Version
+	if version != "" {
+		parsed, err := semver.ParseTolerant(version)
+		if err != nil {
+			return nil, errs.Errorf(errs.Invalid, "invalid gnark version %q", version)
+		}
+		v = parsed
+	}
+
+	// Later releases may change the format in ways no shim here knows about
+	if v.LT(oldestGnark) || v.Major != gnark.Version.Major || v.Minor > gnark.Version.Minor {
+		return nil, fmt.Errorf("%w: %s, proofs from gnark %s through %d.%d.x are supported",
+			errProofVersion, v, oldestGnark, gnark.Version.Major, gnark.Version.Minor)
+	}
+
+	// The binary encoding has no shims, so it is only read from the current release line
+	var encoded string
+	if json.Unmarshal(data, &encoded) == nil {
+		if !currentReleaseLine(v) {
+			return nil, fmt.Errorf("%w: binary proofs are decoded from gnark %d.%d.x only", errProofVersion, gnark.Version.Major, gnark.Version.Minor)
+		}
+		return decodeProofBinary(curve, encoded)
+	}
+
+	data, err := upgradeProofJSON(v, data)
+	var proof groth16.Proof
+	if err == nil {
+		proof, err = decodeProofJSON(curve, data)
+	}
+	if err != nil {
+		if !currentReleaseLine(v) {
+			return nil, fmt.Errorf("%w: decoding a proof from gnark %s: %v", errProofVersion, v, err)
+		}
+		return nil, fmt.Errorf("%w: %v", errMalformedProof, err)
+	}
+	return proof, nil
+}
+
+// currentReleaseLine reports whether v has the major and minor version of the gnark this server uses
+func currentReleaseLine(v semver.Version) bool {
+	return v.Major == gnark.Version.Major && v.Minor == gnark.Version.Minor
+}
+
+// upgradeProofJSON rewrites a proof serialized by an older gnark release into the current format
+func upgradeProofJSON(v semver.Version, data []byte) ([]byte, error) {
+	if v.GTE(commitmentsGnark) {
+		return data, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	// gnark 0.8 had at most one commitment, left at the point at infinity when unused
+	if c, ok := fields["Commitment"]; ok {
+		delete(fields, "Commitment")
+		infinity, err := isInfinityJSON(c)
+		if err != nil {
+			return nil, fmt.Errorf("commitment: %w", err)
+		}
+		if !infinity {
+			fields["Commitments"] = json.RawMessage("[" + string(c) + "]")
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// isInfinityJSON reports whether a JSON affine point of any curve is the point at infinity,
+// which gnark encodes with both coordinates zero
+func isInfinityJSON(data []byte) (bool, error) {
+	var point struct {
+		X, Y json.RawMessage
+	}
+	if err := json.Unmarshal(data, &point); err != nil {
+		return false, err
+	}
+	if point.X == nil || point.Y == nil {
+		return false, errors.New("point is missing a coordinate")
+	}
+	return string(point.X) == "0" && string(point.Y) == "0", nil
+}
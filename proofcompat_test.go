@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254"
+	"github.com/consensys/gnark/backend/groth16"
+	groth16bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+func TestDecodeProofVersions(t *testing.T) {
+	current, err := json.Marshal(groth16.NewProof(ecc.BN254))
+	if err != nil {
+		t.Fatalf("Failed to encode proof: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		version string
+		data    string
+		code    string // empty when the proof decodes
+	}{
+		{"Own release", "", string(current), ""},
+		{"Same minor, other patch", "v0.12.3", string(current), ""},
+		{"Newer release", "0.13.0", string(current), "proof_version_unsupported"},
+		{"Before the oldest shim", "0.7.1", string(current), "proof_version_unsupported"},
+		{"Unparseable version", "latest", string(current), "invalid_request"},
+		{"Malformed proof", "", `{"Ar": 1}`, "proof_malformed"},
+		{"Older release fails to decode", "0.10.0", `{"Ar": 1}`, "proof_version_unsupported"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeProof(defaultCurve, tt.version, []byte(tt.data))
+			if tt.code == "" {
+				if err != nil {
+					t.Errorf("Expected proof to decode, got %v", err)
+				}
+				return
+			}
+			if errs.Code(err) != tt.code {
+				t.Errorf("Expected code %q, got %q (%v)", tt.code, errs.Code(err), err)
+			}
+		})
+	}
+}
+
+func TestDecodeProofGnark08Commitment(t *testing.T) {
+	_, _, g1, _ := bn254.Generators()
+	point, _ := json.Marshal(&g1)
+	var infinity bn254.G1Affine
+	none, _ := json.Marshal(&infinity)
+
+	tests := []struct {
+		name        string
+		commitment  json.RawMessage
+		commitments int
+	}{
+		{"Unused commitment", none, 0},
+		{"One commitment", point, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old, _ := json.Marshal(map[string]any{
+				"Ar": &g1, "Krs": &g1, "Bs": &bn254.G2Affine{}, "Commitment": tt.commitment, "CommitmentPok": &infinity,
+			})
+
+			proof, err := decodeProof(defaultCurve, "0.8.1", old)
+			if err != nil {
+				t.Fatalf("Expected a gnark 0.8 proof to decode, got %v", err)
+			}
+			got := proof.(*groth16bn254.Proof).Commitments
+			if len(got) != tt.commitments {
+				t.Fatalf("Expected %d commitments, got %d", tt.commitments, len(got))
+			}
+			if len(got) == 1 && !got[0].Equal(&g1) {
+				t.Error("Expected the commitment to be kept")
+			}
+		})
+	}
+
+	if _, err := decodeProof(defaultCurve, "0.8.0", []byte(`{"Commitment": "x"}`)); !errors.Is(err, errProofVersion) {
+		t.Errorf("Expected errProofVersion for an undecodable commitment, got %v", err)
+	}
+}
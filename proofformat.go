@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// Media types a proof can be answered in, picked with the Accept header. The binary form is
+// gnark's WriteTo encoding, with compressed points; base64 is the same bytes as text.
+const (
+	proofMediaJSON   = "application/json"
+	proofMediaBinary = "application/octet-stream"
+	proofMediaBase64 = "text/plain"
+)
+
+// proofMediaType returns the proof format a request accepts most, JSON when it names none the
+// server writes. Ties go to the type listed first.
+func proofMediaType(r *http.Request) string {
+	best, bestQ := proofMediaJSON, 0.0
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		switch mediaType {
+		case proofMediaJSON, proofMediaBinary, proofMediaBase64:
+		default:
+			continue
+		}
+		if q > bestQ {
+			best, bestQ = mediaType, q
+		}
+	}
+	return best
+}
+
+// proofEnvelopeHeader carries the rest of a JSON envelope when its proof is answered in binary or base64
+const proofEnvelopeHeader = "X-Proof-Envelope"
+
+// writeProof answers a proof in the format the request accepts. Endpoints that wrap the proof in
+// a JSON object pass it as envelope: JSON requests get the envelope, and binary or base64 ones
+// the bare proof, with the other fields of the envelope as JSON in X-Proof-Envelope.
+func writeProof(w http.ResponseWriter, r *http.Request, proof groth16.Proof, envelope any) {
+	w.Header().Add("Vary", "Accept")
+	mediaType := proofMediaType(r)
+	if mediaType == proofMediaJSON {
+		if envelope == nil {
+			envelope = proof
+		}
+		w.Header().Set("Content-Type", proofMediaJSON)
+		if err := json.NewEncoder(w).Encode(envelope); err != nil {
+			writeError(w, errs.Errorf(errs.Internal, "failed to encode response"))
+		}
+		return
+	}
+
+	if envelope != nil {
+		fields, err := envelopeFields(envelope)
+		if err != nil {
+			writeError(w, errs.Errorf(errs.Internal, "failed to encode response"))
+			return
+		}
+		w.Header().Set(proofEnvelopeHeader, string(fields))
+	}
+	var buf bytes.Buffer
+	if _, err := proof.WriteTo(&buf); err != nil {
+		writeError(w, errs.Errorf(errs.Internal, "failed to encode response"))
+		return
+	}
+	data := buf.Bytes()
+	if mediaType == proofMediaBase64 {
+		data = []byte(base64.StdEncoding.EncodeToString(data))
+		mediaType += "; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", mediaType)
+	w.Write(data)
+}
+
+// envelopeFields encodes envelope as JSON without its proof field
+func envelopeFields(envelope any) ([]byte, error) {
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	delete(fields, "proof")
+	return json.Marshal(fields)
+}
+
+// decodeProofBinary decodes a proof on curve from the base64 of its binary encoding
+func decodeProofBinary(curve ecc.ID, encoded string) (groth16.Proof, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: proof is not base64: %v", errMalformedProof, err)
+	}
+	proof := groth16.NewProof(curve)
+	n, err := proof.ReadFrom(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errMalformedProof, err)
+	}
+	if n != int64(len(data)) {
+		return nil, fmt.Errorf("%w: %d bytes after the proof", errMalformedProof, int64(len(data))-n)
+	}
+	return proof, nil
+}
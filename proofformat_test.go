@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+)
+
+func TestProofMediaType(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", proofMediaJSON},
+		{"*/*", proofMediaJSON},
+		{"application/octet-stream", proofMediaBinary},
+		{"text/plain, application/json", proofMediaBase64},
+		{"application/json;q=0.5, application/octet-stream", proofMediaBinary},
+		{"text/html, image/png", proofMediaJSON},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/get/proof/neededAmount", nil)
+		req.Header.Set("Accept", tt.accept)
+		if got := proofMediaType(req); got != tt.want {
+			t.Errorf("Accept %q: expected %s, got %s", tt.accept, tt.want, got)
+		}
+	}
+}
+
+func TestProofFormats(t *testing.T) {
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+	t.Cleanup(h.SetupCleanBalances)
+	h.AssertStatusCode(h.StoreBalance("format_user", 100), http.StatusOK, "storing a balance")
+
+	prove := func(accept string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(ProofRequest{ID: "format_user", NeededAmount: 50, Comparison: comparisonAbove})
+		req := httptest.NewRequest(http.MethodPost, "/get/proof/neededAmount", bytes.NewReader(body))
+		req.Header.Set("Accept", accept)
+		rr := httptest.NewRecorder()
+		generateProof(rr, req)
+		h.AssertStatusCode(rr, http.StatusOK, "proving as "+accept)
+		if got := rr.Header().Get("Vary"); got != "Accept" {
+			t.Errorf("Expected Vary: Accept, got %q", got)
+		}
+		return rr
+	}
+
+	binary := prove(proofMediaBinary)
+	if ct := binary.Header().Get("Content-Type"); ct != proofMediaBinary {
+		t.Errorf("Expected %s, got %s", proofMediaBinary, ct)
+	}
+	encoded := prove(proofMediaBase64)
+	// Proofs are randomized, so only their encodings can be compared
+	if decoded, err := base64.StdEncoding.DecodeString(encoded.Body.String()); err != nil || len(decoded) != binary.Body.Len() {
+		t.Errorf("Expected the base64 of a %d byte proof, got %d bytes, %v", binary.Body.Len(), len(decoded), err)
+	}
+
+	// Base64 proofs validate as JSON strings
+	proof, _ := json.Marshal(encoded.Body.String())
+	rr := postJSON(t, validateProof, "/validate", ValidateRequest{NeededAmount: 50, Proof: proof, Comparison: comparisonAbove})
+	h.AssertStatusCode(rr, http.StatusOK, "validating a base64 proof")
+	rr = postJSON(t, validateProof, "/validate", ValidateRequest{NeededAmount: 51, Proof: proof, Comparison: comparisonAbove})
+	h.AssertStatusCode(rr, http.StatusUnauthorized, "validating a base64 proof against another threshold")
+
+	if _, err := decodeProof(ecc.BN254, "", json.RawMessage(`"bm90IGEgcHJvb2Y="`)); !errors.Is(err, errMalformedProof) {
+		t.Errorf("Expected %v for bytes that are not a proof, got %v", errMalformedProof, err)
+	}
+	if _, err := decodeProof(ecc.BN254, "0.10.0", proof); !errors.Is(err, errProofVersion) {
+		t.Errorf("Expected %v for a binary proof of an older release, got %v", errProofVersion, err)
+	}
+}
+
+func TestProofEnvelope(t *testing.T) {
+	proof := groth16.NewProof(ecc.BN254)
+	envelope := BucketProofResponse{Bucket: Bucket{Lower: 1000}, Proof: proof}
+	write := func(accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/get/proof/bucket", nil)
+		req.Header.Set("Accept", accept)
+		rr := httptest.NewRecorder()
+		writeProof(rr, req, proof, envelope)
+		return rr
+	}
+
+	rr := write(proofMediaJSON)
+	var resp map[string]json.RawMessage
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || resp["bucket"] == nil || resp["proof"] == nil {
+		t.Errorf("Expected the JSON envelope, got %s (%v)", rr.Body.String(), err)
+	}
+	if got := rr.Header().Get(proofEnvelopeHeader); got != "" {
+		t.Errorf("Expected no %s with JSON, got %s", proofEnvelopeHeader, got)
+	}
+
+	rr = write(proofMediaBinary)
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(rr.Header().Get(proofEnvelopeHeader)), &fields); err != nil || fields["bucket"] == nil || fields["proof"] != nil {
+		t.Errorf("Expected the envelope without its proof in %s, got %q (%v)", proofEnvelopeHeader, rr.Header().Get(proofEnvelopeHeader), err)
+	}
+	if _, err := groth16.NewProof(ecc.BN254).ReadFrom(rr.Body); err != nil {
+		t.Errorf("Expected the binary proof as the body, got %v", err)
+	}
+}
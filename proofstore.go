@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// ProofRecord describes an issued proof indexed by the SHA-256 digest of its binary encoding
+type ProofRecord struct {
+	Digest         string            `json:"digest"`
+	Circuit        string            `json:"circuit,omitempty"`
+	CircuitVersion int               `json:"circuitVersion,omitempty"`
+	Curve          string            `json:"curve,omitempty"` // set when the proof is not on the default curve
+	PublicInputs   map[string]string `json:"publicInputs,omitempty"`
+	Audience       string            `json:"audience,omitempty"`
+	LedgerTx       int64             `json:"ledgerTx,omitempty"` // last ledger transaction in the proven balance
+	CreatedAt      time.Time         `json:"createdAt"`
+	Holder         string            `json:"-"` // user the proof is about, so erasing them can find it
+}
+
+var (
+	proofIndex   = make(map[string]ProofRecord)
+	proofIndexMu sync.RWMutex
+)
+
+// persistProof stores the binary encoding of a proof in the artifact store and indexes it by digest,
+// filling in the digest and creation time of record. Storing the same proof twice keeps the original record.
+func persistProof(ctx context.Context, proof groth16.Proof, record ProofRecord) (string, error) {
+	data, err := proofBytes(proof)
+	if err != nil {
+		return "", err
+	}
+
+	audit.record(AuditEvent{Type: auditProofIssued, Circuit: record.Circuit, Digest: artifactDigest(data)})
+
+	digest, err := artifacts.Put(ctx, artifactProof, data)
+	if err != nil {
+		return "", err
+	}
+
+	proofIndexMu.Lock()
+	if _, exists := proofIndex[digest]; !exists {
+		record.Digest = digest
+		record.CreatedAt = time.Now().UTC()
+		proofIndex[digest] = record
+		proofLog.append(digest)
+	}
+	proofIndexMu.Unlock()
+
+	return digest, nil
+}
+
+// proofBytes returns the binary encoding of a proof that its digest is computed over
+func proofBytes(proof groth16.Proof) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := proof.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// proofDigest returns the content digest a proof is indexed under
+func proofDigest(proof groth16.Proof) (string, error) {
+	data, err := proofBytes(proof)
+	if err != nil {
+		return "", err
+	}
+	return artifactDigest(data), nil
+}
+
+// recordedCurve returns the curve of a proof as kept in its record, empty for the default curve
+func recordedCurve(curve ecc.ID) string {
+	if curve == defaultCurve {
+		return ""
+	}
+	return curve.String()
+}
+
+// lookupProofRecord returns the index record of an issued proof
+func lookupProofRecord(digest string) (ProofRecord, bool) {
+	proofIndexMu.RLock()
+	defer proofIndexMu.RUnlock()
+	record, ok := proofIndex[digest]
+	return record, ok
+}
+
+// loadProof fetches a stored proof and its index record by digest.
+// Proofs present in the artifact store but not in the index (e.g. after a restart) are
+// returned with a record carrying only the digest.
+func loadProof(ctx context.Context, digest string) (groth16.Proof, ProofRecord, error) {
+	data, err := artifacts.Get(ctx, artifactProof, digest)
+	if err != nil {
+		return nil, ProofRecord{}, err
+	}
+
+	record, ok := lookupProofRecord(digest)
+	if !ok {
+		record = ProofRecord{Digest: digest}
+	}
+	curve, err := parseCurve(record.Curve)
+	if err != nil {
+		return nil, ProofRecord{}, err
+	}
+
+	proof := groth16.NewProof(curve)
+	if _, err := proof.ReadFrom(bytes.NewReader(data)); err != nil {
+		return nil, ProofRecord{}, err
+	}
+
+	return proof, record, nil
+}
+
+// StoredProofResponse is returned by GET /proofs/by-hash/{digest}
+type StoredProofResponse struct {
+	ProofRecord
+	Proof groth16.Proof `json:"proof"`
+}
+
+// getProofByHash serves a previously issued proof by its content digest
+func getProofByHash(w http.ResponseWriter, r *http.Request) {
+	digest := r.PathValue("digest")
+	if err := validateArtifactRef(artifactProof, digest); err != nil {
+		writeError(w, errs.Wrap(errs.Invalid, err))
+		return
+	}
+
+	proof, record, err := loadProof(r.Context(), digest)
+	if errors.Is(err, errArtifactNotFound) {
+		writeError(w, errs.Errorf(errs.NotFound, "proof not found"))
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", `"`+digest+`"`)
+	writeJSON(w, StoredProofResponse{ProofRecord: record, Proof: proof})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetProofByHashErrors(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /proofs/by-hash/{digest}", getProofByHash)
+
+	tests := []struct {
+		name           string
+		digest         string
+		expectedStatus int
+	}{
+		{"Malformed digest", "not-a-digest", http.StatusBadRequest},
+		{"Unknown digest", artifactDigest([]byte("unknown")), http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest("GET", "/proofs/by-hash/"+tt.digest, nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestProofDigestRoundTrip(t *testing.T) {
+	SkipIfShort(t, "proof generation for content addressing")
+
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+	h.AssertStatusCode(h.StoreBalance("hash_user", 150), http.StatusOK, "storing balance")
+
+	req := httptest.NewRequest("POST", "/get/proof/neededAmount", strings.NewReader(`{"id": "hash_user", "neededAmount": 100}`))
+	rr := httptest.NewRecorder()
+	generateProof(rr, req)
+	h.AssertStatusCode(rr, http.StatusOK, "generating proof")
+
+	digest := rr.Header().Get("X-Proof-Digest")
+	if err := validateArtifactRef(artifactProof, digest); err != nil {
+		t.Fatalf("Expected a valid digest header, got %q: %v", digest, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /proofs/by-hash/{digest}", getProofByHash)
+
+	lookup := httptest.NewRecorder()
+	mux.ServeHTTP(lookup, httptest.NewRequest("GET", "/proofs/by-hash/"+digest, nil))
+	h.AssertStatusCode(lookup, http.StatusOK, "looking up proof by hash")
+
+	var stored struct {
+		ProofRecord
+		Proof json.RawMessage `json:"proof"`
+	}
+	if err := json.Unmarshal(lookup.Body.Bytes(), &stored); err != nil {
+		t.Fatalf("Failed to decode stored proof: %v", err)
+	}
+
+	if stored.Digest != digest || stored.PublicInputs["neededAmount"] != "100" || stored.Circuit != balanceCircuitName {
+		t.Errorf("Unexpected record %+v", stored.ProofRecord)
+	}
+	if !jsonEqual(t, stored.Proof, rr.Body.Bytes()) {
+		t.Error("Expected the stored proof to match the issued proof")
+	}
+}
+
+func jsonEqual(t *testing.T, a, b []byte) bool {
+	t.Helper()
+	var va, vb interface{}
+	if err := json.Unmarshal(a, &va); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	if err := json.Unmarshal(b, &vb); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	ja, _ := json.Marshal(va)
+	jb, _ := json.Marshal(vb)
+	return string(ja) == string(jb)
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"runtime/debug"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// recentJobCapacity is the number of finished proofs kept for the admin dashboard
+const recentJobCapacity = 100
+
+// ProvingJob is one finished proof, without its inputs
+type ProvingJob struct {
+	Circuit   string    `json:"circuit"`
+	Lane      string    `json:"lane"`
+	Started   time.Time `json:"started"`
+	WaitedMs  float64   `json:"waitedMs"` // time spent queued for a worker
+	ProvingMs float64   `json:"provingMs"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Lanes of the proving queue. Interactive proofs are handed the next free worker before any
+// batch proof, so bulk clients cannot starve the demo frontend.
+type provingLane int
+
+const (
+	laneInteractive provingLane = iota
+	laneBatch
+	laneCount
+)
+
+func (l provingLane) String() string {
+	if l == laneBatch {
+		return "batch"
+	}
+	return "interactive"
+}
+
+type provingLaneKey struct{}
+
+// withProvingLane makes the proofs computed for ctx wait in lane
+func withProvingLane(ctx context.Context, lane provingLane) context.Context {
+	return context.WithValue(ctx, provingLaneKey{}, lane)
+}
+
+// provingLaneOf returns the lane of ctx, interactive unless set otherwise
+func provingLaneOf(ctx context.Context) provingLane {
+	lane, _ := ctx.Value(provingLaneKey{}).(provingLane)
+	return lane
+}
+
+// errProofTooLarge is returned for a proof estimated to need more memory than all proofs may hold
+var errProofTooLarge = errs.New(errs.Unavailable, "proof_too_large", "the proof needs more memory than this server may use for proving")
+
+// provingPool bounds the number of proofs computed at once, and the memory they are estimated
+// to hold, and records finished proofs. Proofs beyond the limits wait in their lane until a
+// worker and enough memory free up or their caller gives up.
+type provingPool struct {
+	workers   int   // 0 when proving is unbounded
+	reserved  int   // workers batch proofs may not take
+	memory    int64 // estimated bytes proofs may hold at once; 0 when unbounded
+	gcPercent int   // GOGC while any proof runs; 0 leaves it alone
+	mu        sync.Mutex
+	queues    [laneCount][]*provingWaiter // waiting proofs per lane, oldest first
+	busy      int
+	inUse     int64        // estimated bytes held by the running proofs
+	idleGC    int          // GOGC to restore once no proof runs
+	recent    []ProvingJob // ring buffer of at most recentJobCapacity jobs
+	next      int
+}
+
+// setGCPercent is debug.SetGCPercent, replaced in tests
+var setGCPercent = debug.SetGCPercent
+
+// provingWaiter is a proof waiting in line; ready is closed when it is handed a worker
+type provingWaiter struct {
+	ready  chan struct{}
+	memory int64
+}
+
+func newProvingPool(workers, reserved int, memory int64) *provingPool {
+	return &provingPool{workers: workers, reserved: min(reserved, workers), memory: memory}
+}
+
+var provers = newProvingPool(0, 0, 0)
+
+// free reports whether a proof in lane needing the given memory may start now; callers must hold p.mu
+func (p *provingPool) free(lane provingLane, memory int64) bool {
+	if p.memory > 0 && p.inUse+memory > p.memory {
+		return false
+	}
+	if p.workers == 0 {
+		return true
+	}
+	limit := p.workers
+	if lane == laneBatch {
+		limit -= p.reserved
+	}
+	return p.busy < limit
+}
+
+// take hands a worker and memory to a proof; callers must hold p.mu.
+// gnark allocates the buffers of every proof afresh and drops them when it returns, so several
+// proofs at once mostly produce garbage; raising GOGC while any runs trades memory for fewer
+// collections, the soft memory limit still bounding the heap.
+func (p *provingPool) take(memory int64) {
+	if p.busy == 0 && p.gcPercent > 0 {
+		p.idleGC = setGCPercent(p.gcPercent)
+	}
+	p.busy++
+	p.inUse += memory
+}
+
+// put takes back the worker and memory of a proof, restoring GOGC once none runs; callers must hold p.mu
+func (p *provingPool) put(memory int64) {
+	p.busy--
+	p.inUse -= memory
+	if p.busy == 0 && p.gcPercent > 0 {
+		setGCPercent(p.idleGC)
+	}
+}
+
+// acquire takes a worker and memory for a proof in lane, waiting behind the proofs of its own
+// and higher-priority lanes, unless ctx ends first. A proof needing more memory than the pool
+// has at all is refused rather than queued forever.
+func (p *provingPool) acquire(ctx context.Context, lane provingLane, memory int64) error {
+	if p.memory > 0 && memory > p.memory {
+		return errProofTooLarge
+	}
+	p.mu.Lock()
+	ahead := 0
+	for l := laneInteractive; l <= lane; l++ {
+		ahead += len(p.queues[l])
+	}
+	if ahead == 0 && p.free(lane, memory) {
+		p.take(memory)
+		p.mu.Unlock()
+		return nil
+	}
+	waiter := &provingWaiter{ready: make(chan struct{}), memory: memory}
+	p.queues[lane] = append(p.queues[lane], waiter)
+	p.mu.Unlock()
+
+	select {
+	case <-waiter.ready:
+		return nil
+	case <-ctx.Done():
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		select {
+		case <-waiter.ready:
+			// Handed a worker while giving up: pass it on
+			p.put(memory)
+			p.dispatch()
+		default:
+			p.queues[lane] = slices.DeleteFunc(p.queues[lane], func(w *provingWaiter) bool { return w == waiter })
+			// A large proof leaving the head of the line may let smaller ones start
+			p.dispatch()
+		}
+		return ctx.Err()
+	}
+}
+
+// release frees a worker and memory and hands them to waiting proofs
+func (p *provingPool) release(memory int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.put(memory)
+	p.dispatch()
+}
+
+// dispatch hands free workers to the oldest waiting proofs, interactive ones first;
+// callers must hold p.mu. A proof waiting for memory holds up the proofs behind it, so
+// small proofs cannot starve a large one.
+func (p *provingPool) dispatch() {
+	for lane := laneInteractive; lane < laneCount; lane++ {
+		for len(p.queues[lane]) > 0 && p.free(lane, p.queues[lane][0].memory) {
+			waiter := p.queues[lane][0]
+			close(waiter.ready)
+			p.queues[lane] = p.queues[lane][1:]
+			p.take(waiter.memory)
+		}
+	}
+}
+
+// run calls prove once a worker and the memory the proof is estimated to need are free for
+// the lane of ctx, unless ctx ends first. A memory of 0 only waits for a worker.
+func (p *provingPool) run(ctx context.Context, circuit string, memory int64, prove func() error) error {
+	lane := provingLaneOf(ctx)
+	queued := time.Now()
+	if err := p.acquire(ctx, lane, memory); err != nil {
+		return err
+	}
+	defer p.release(memory)
+
+	start := time.Now()
+	err := prove()
+
+	job := ProvingJob{
+		Circuit:   circuit,
+		Lane:      lane.String(),
+		Started:   start.UTC(),
+		WaitedMs:  float64(start.Sub(queued).Microseconds()) / 1000,
+		ProvingMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		job.Error = err.Error()
+	} else {
+		timingsOf(ctx).addProof(start.Sub(queued), time.Since(start))
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.recent) < recentJobCapacity {
+		p.recent = append(p.recent, job)
+	} else {
+		p.recent[p.next] = job
+		p.next = (p.next + 1) % recentJobCapacity
+	}
+	return err
+}
+
+// ProvingStatus is the load of the proving pool and its latest jobs, newest first
+type ProvingStatus struct {
+	Workers     int            `json:"workers"`  // 0 when proving is unbounded
+	Reserved    int            `json:"reserved"` // workers kept for interactive proofs
+	Busy        int            `json:"busy"`
+	Memory      int64          `json:"memoryBytes,omitempty"` // estimated bytes proofs may hold at once
+	MemoryInUse int64          `json:"memoryInUseBytes"`      // estimated bytes held by running proofs
+	QueueDepth  int            `json:"queueDepth"`
+	Queued      map[string]int `json:"queued"` // queue depth per lane
+	Recent      []ProvingJob   `json:"recent"`
+}
+
+func (p *provingPool) status() ProvingStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	recent := make([]ProvingJob, 0, len(p.recent))
+	for i := len(p.recent) - 1; i >= 0; i-- {
+		recent = append(recent, p.recent[(p.next+i)%len(p.recent)])
+	}
+	status := ProvingStatus{Workers: p.workers, Reserved: p.reserved, Busy: p.busy, Memory: p.memory, MemoryInUse: p.inUse, Queued: make(map[string]int, laneCount), Recent: recent}
+	for lane := laneInteractive; lane < laneCount; lane++ {
+		status.Queued[lane.String()] = len(p.queues[lane])
+		status.QueueDepth += len(p.queues[lane])
+	}
+	return status
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestProvingPool(t *testing.T) {
+	p := newProvingPool(1, 0, 0)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- p.run(context.Background(), "first", 0, func() error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	<-started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	waited := make(chan error)
+	go func() {
+		waited <- p.run(ctx, "second", 0, func() error { return nil })
+	}()
+
+	// The second proof waits in line while the only worker is busy
+	deadline := time.Now().Add(5 * time.Second)
+	for p.status().QueueDepth != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected a queued proof, got %+v", p.status())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if s := p.status(); s.Workers != 1 || s.Busy != 1 {
+		t.Errorf("Expected 1 of 1 workers busy, got %+v", s)
+	}
+
+	cancel()
+	if err := <-waited; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected a queued proof to give up with its caller, got %v", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("Expected the first proof to finish, got %v", err)
+	}
+
+	if err := p.run(context.Background(), "third", 0, func() error { return errors.New("unsatisfied") }); err == nil {
+		t.Fatal("Expected the proof error to be returned")
+	}
+
+	s := p.status()
+	if s.Busy != 0 || s.QueueDepth != 0 {
+		t.Errorf("Expected an idle pool, got %+v", s)
+	}
+	if len(s.Recent) != 2 || s.Recent[0].Circuit != "third" || s.Recent[0].Error != "unsatisfied" || s.Recent[1].Circuit != "first" {
+		t.Errorf("Expected the finished proofs newest first, got %+v", s.Recent)
+	}
+}
+
+func TestUnboundedProvingPool(t *testing.T) {
+	p := newProvingPool(0, 0, 0)
+	for i := 0; i < recentJobCapacity+5; i++ {
+		if err := p.run(context.Background(), "balance", 0, func() error { return nil }); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if s := p.status(); s.Workers != 0 || len(s.Recent) != recentJobCapacity {
+		t.Errorf("Expected an unbounded pool keeping %d jobs, got %d workers and %d jobs", recentJobCapacity, s.Workers, len(s.Recent))
+	}
+}
+
+// occupy runs a proof in lane on p that holds its worker until the returned func is called
+func occupy(t *testing.T, p *provingPool, lane provingLane) func() {
+	t.Helper()
+	started, release, done := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = p.run(withProvingLane(context.Background(), lane), "hold", 0, func() error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	<-started
+	return func() {
+		close(release)
+		<-done
+	}
+}
+
+// waitQueued waits until p has n proofs queued in lane
+func waitQueued(t *testing.T, p *provingPool, lane provingLane, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for p.status().Queued[lane.String()] != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d queued %s proofs, got %+v", n, lane, p.status())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestProvingLanes(t *testing.T) {
+	p := newProvingPool(1, 0, 0)
+	release := occupy(t, p, laneBatch)
+
+	order := make(chan string, 2)
+	finished := make(chan struct{}, 2)
+	for _, lane := range []provingLane{laneBatch, laneInteractive} {
+		go func() {
+			_ = p.run(withProvingLane(context.Background(), lane), lane.String(), 0, func() error {
+				order <- lane.String()
+				return nil
+			})
+			finished <- struct{}{}
+		}()
+		waitQueued(t, p, lane, 1)
+	}
+	if s := p.status(); s.QueueDepth != 2 {
+		t.Errorf("Expected 2 queued proofs, got %+v", s)
+	}
+
+	release()
+	<-finished
+	<-finished
+	if first, second := <-order, <-order; first != "interactive" || second != "batch" {
+		t.Errorf("Expected the interactive proof to overtake the batch proof, got %s then %s", first, second)
+	}
+	if s := p.status(); s.Recent[0].Lane != "batch" || s.Recent[1].Lane != "interactive" {
+		t.Errorf("Expected jobs to record their lane, got %+v", s.Recent)
+	}
+}
+
+func TestProvingLaneReservedWorkers(t *testing.T) {
+	p := newProvingPool(2, 1, 0)
+	release := occupy(t, p, laneBatch)
+	defer release()
+
+	// The second worker is kept for interactive proofs
+	ctx, cancel := context.WithCancel(withProvingLane(context.Background(), laneBatch))
+	waited := make(chan error)
+	go func() {
+		waited <- p.run(ctx, "batch", 0, func() error { return nil })
+	}()
+	waitQueued(t, p, laneBatch, 1)
+
+	if err := p.run(context.Background(), "interactive", 0, func() error { return nil }); err != nil {
+		t.Fatalf("Expected an interactive proof to take the reserved worker, got %v", err)
+	}
+	waitQueued(t, p, laneBatch, 1)
+
+	cancel()
+	if err := <-waited; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the queued batch proof to give up with its caller, got %v", err)
+	}
+	if s := p.status(); s.QueueDepth != 0 || s.Busy != 1 {
+		t.Errorf("Expected one busy worker and no queue, got %+v", s)
+	}
+}
+
+func TestProvingPoolMemory(t *testing.T) {
+	p := newProvingPool(0, 0, 100)
+
+	if err := p.run(context.Background(), "huge", 101, func() error { return nil }); !errors.Is(err, errProofTooLarge) {
+		t.Fatalf("Expected a proof larger than the pool to be refused, got %v", err)
+	}
+
+	started, release, done := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = p.run(context.Background(), "large", 60, func() error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	<-started
+
+	// Without a worker limit, proofs still wait for the memory they need
+	ran := make(chan error)
+	go func() {
+		ran <- p.run(context.Background(), "medium", 50, func() error { return nil })
+	}()
+	waitQueued(t, p, laneInteractive, 1)
+	if s := p.status(); s.Memory != 100 || s.MemoryInUse != 60 {
+		t.Errorf("Expected 60 of 100 bytes in use, got %+v", s)
+	}
+
+	close(release)
+	<-done
+	if err := <-ran; err != nil {
+		t.Fatalf("Expected the queued proof to run once memory freed up, got %v", err)
+	}
+	if s := p.status(); s.MemoryInUse != 0 || s.QueueDepth != 0 {
+		t.Errorf("Expected an idle pool, got %+v", s)
+	}
+}
+
+func TestProvingPoolGCPercent(t *testing.T) {
+	var settings []int
+	gcPercent := 100
+	previous := setGCPercent
+	setGCPercent = func(percent int) int {
+		settings = append(settings, percent)
+		old := gcPercent
+		gcPercent = percent
+		return old
+	}
+	t.Cleanup(func() { setGCPercent = previous })
+
+	p := newProvingPool(0, 0, 0)
+	p.gcPercent = 400
+	started, release, done := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = p.run(context.Background(), "slow", 0, func() error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	<-started
+	// A second proof starting while one runs leaves GOGC as it is
+	if err := p.run(context.Background(), "fast", 0, func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	<-done
+
+	if !slices.Equal(settings, []int{400, 100}) || gcPercent != 100 {
+		t.Errorf("Expected GOGC raised to 400 once and restored to 100, got %v", settings)
+	}
+}
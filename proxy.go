@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// proxyDecisionHeader tells the caller what the proxy decided, next to the backend's answer
+const proxyDecisionHeader = "X-Proxy-Decision"
+
+// maxBackendResponseBytes bounds the backend answer relayed to the caller
+const maxBackendResponseBytes = 1 << 20
+
+// ProxyConfig configures verification proxy mode, where this server verifies proofs for a
+// backend that does not verify them itself
+type ProxyConfig struct {
+	BackendURL  string // decisions are posted here; /proxy is disabled when empty
+	Only        bool   // serve only the relying-party routes
+	HTTPTimeout time.Duration
+}
+
+// proxyBackend is the configured backend, empty when proxy mode is off
+var (
+	proxyBackend string
+	proxyClient  = &http.Client{Timeout: 10 * time.Second}
+)
+
+var errProxyDisabled = errs.New(errs.NotFound, "proxy_disabled", "verification proxy is not configured")
+
+// ProxyRequest is a proof presented to the proxy
+type ProxyRequest struct {
+	Proof json.RawMessage `json:"proof"`
+}
+
+// ProxyDecision is posted to the backend for every proof the proxy could decide on
+type ProxyDecision struct {
+	Policy      string    `json:"policy"`
+	Issuer      string    `json:"issuer,omitempty"` // trusted peer that issued the proof, empty for this server
+	Decision    string    `json:"decision"`         // "accept" or "reject"
+	Reason      string    `json:"reason,omitempty"` // error code of a rejection
+	ProofDigest string    `json:"proofDigest,omitempty"`
+	RequestID   string    `json:"requestId,omitempty"`
+	DecidedAt   time.Time `json:"decidedAt"`
+	Verifier    string    `json:"verifier,omitempty"` // DID of this server; kid names its key
+	KeyID       string    `json:"kid,omitempty"`
+	Signature   []byte    `json:"signature,omitempty"` // ES256 over the decision without kid and signature
+}
+
+func checkProxyConfig(cfg ProxyConfig) error {
+	if cfg.BackendURL == "" {
+		if cfg.Only {
+			return errors.New("ZK_PROXY_ONLY needs ZK_PROXY_BACKEND_URL")
+		}
+		return nil
+	}
+	u, err := url.Parse(cfg.BackendURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("ZK_PROXY_BACKEND_URL must be an absolute http(s) URL")
+	}
+	return nil
+}
+
+// signDecision signs the decision with the server signing key when one is configured
+func signDecision(d *ProxyDecision) error {
+	if signer == nil {
+		return nil
+	}
+	d.Verifier = issuerDID
+	unsigned := *d
+	unsigned.KeyID, unsigned.Signature = "", nil
+	payload, err := json.Marshal(unsigned)
+	if err != nil {
+		return err
+	}
+	if d.Signature, err = signMessage(signer, payload); err != nil {
+		return err
+	}
+	d.KeyID = signer.KeyID()
+	return nil
+}
+
+// decide enforces a policy on a proof. It returns an error only when no decision can be made,
+// e.g. because the issuer's verifying key cannot be fetched.
+func decide(ctx context.Context, p *Policy, proof json.RawMessage, now time.Time) (ProxyDecision, error) {
+	d := ProxyDecision{Policy: p.Name, Issuer: p.Issuer, Decision: "accept", DecidedAt: now.UTC()}
+	if decoded, err := decodeProofJSON(defaultCurve, proof); err == nil {
+		d.ProofDigest, _ = proofDigest(decoded)
+	}
+
+	err := p.check(ctx, proof, now)
+	if err != nil && errs.Status(err) >= http.StatusInternalServerError {
+		return ProxyDecision{}, err
+	}
+	if err != nil {
+		d.Decision, d.Reason = "reject", errs.Code(err)
+		audit.record(AuditEvent{Type: auditPolicyDenied, Subject: p.Name, Digest: d.ProofDigest, Detail: err.Error()})
+	} else {
+		audit.record(AuditEvent{Type: auditPolicyAccepted, Subject: p.Name, Digest: d.ProofDigest})
+	}
+	return d, nil
+}
+
+// proxyVerify verifies a proof against the policy in the path, posts the signed decision to the
+// backend and relays the backend's answer. Rejections are forwarded too, so the backend sees
+// every attempt; the decision is also in X-Proxy-Decision.
+func proxyVerify(w http.ResponseWriter, r *http.Request) {
+	if proxyBackend == "" {
+		writeError(w, errProxyDisabled)
+		return
+	}
+	var req ProxyRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	p, err := lookupPolicy(r.PathValue("policy"))
+	if err != nil {
+		writeError(w, errs.Wrap(errs.NotFound, err))
+		return
+	}
+	if err := checkTenantAccess(r, compositeEnvelopeCircuit, p.composite.thresholds()...); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	decision, err := decide(r.Context(), p, req.Proof, time.Now())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	decision.RequestID = r.Header.Get(requestIDHeader)
+	if err := signDecision(&decision); err != nil {
+		writeError(w, err)
+		return
+	}
+	body, err := json.Marshal(decision)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	backendReq, err := http.NewRequestWithContext(r.Context(), http.MethodPost, proxyBackend, bytes.NewReader(body))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	backendReq.Header.Set("Content-Type", "application/json")
+	backendReq.Header.Set(requestIDHeader, decision.RequestID)
+	resp, err := proxyClient.Do(backendReq)
+	if err != nil {
+		log.Printf("Failed to forward proxy decision: %v", err)
+		writeError(w, errs.Errorf(errs.BadGateway, "backend is unavailable"))
+		return
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+	w.Header().Set(proxyDecisionHeader, decision.Decision)
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, io.LimitReader(resp.Body, maxBackendResponseBytes))
+}
+
+// proxyOnlyPrefixes are the routes served in proxy-only mode
+var proxyOnlyPrefixes = []string{"/proxy/", "/admin/", "/policies/", "/health", "/ready", "/keys/signing", "/.well-known/"}
+
+// proxyOnly answers 404 for every route a pure relying party does not need, such as storing
+// balances and proving
+func proxyOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, prefix := range proxyOnlyPrefixes {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		writeError(w, errs.Errorf(errs.NotFound, "not served in verification proxy mode"))
+	})
+}
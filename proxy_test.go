@@ -0,0 +1,202 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// fakeBackend records the decisions the proxy forwards and answers 202
+func fakeBackend(t *testing.T) (string, *[]ProxyDecision) {
+	t.Helper()
+	var received []ProxyDecision
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var d ProxyDecision
+		if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		received = append(received, d)
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = io.WriteString(w, "noted "+d.Decision)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, &received
+}
+
+// withProxy points the proxy at backend and registers a local policy named "proxy-test"
+func withProxy(t *testing.T, backend string) {
+	t.Helper()
+	policy := &Policy{Name: "proxy-test", Predicates: []PredicateSpec{{Name: "balance", Threshold: 500}}}
+	if err := policy.compile(); err != nil {
+		t.Fatal(err)
+	}
+	previousBackend, previousSigner := proxyBackend, signer
+	policiesMu.Lock()
+	policies[policy.Name] = policy
+	policiesMu.Unlock()
+	proxyBackend = backend
+	t.Cleanup(func() {
+		proxyBackend, signer = previousBackend, previousSigner
+		policiesMu.Lock()
+		delete(policies, policy.Name)
+		policiesMu.Unlock()
+	})
+}
+
+func postProxy(t *testing.T, policy, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/proxy/"+policy, strings.NewReader(body))
+	req.SetPathValue("policy", policy)
+	req.Header.Set(requestIDHeader, "req-1")
+	rr := httptest.NewRecorder()
+	proxyVerify(rr, req)
+	return rr
+}
+
+func TestCheckProxyConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         ProxyConfig
+		expectError bool
+	}{
+		{"Disabled", ProxyConfig{}, false},
+		{"Backend", ProxyConfig{BackendURL: "https://backend.example/decisions"}, false},
+		{"Proxy only", ProxyConfig{BackendURL: "http://backend:8080", Only: true}, false},
+		{"Proxy only without backend", ProxyConfig{Only: true}, true},
+		{"Relative backend", ProxyConfig{BackendURL: "backend/decisions"}, true},
+		{"Other scheme", ProxyConfig{BackendURL: "ftp://backend.example"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkProxyConfig(tt.cfg); (err != nil) != tt.expectError {
+				t.Errorf("checkProxyConfig() error = %v, expectError %v", err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestProxyForwardsRejections(t *testing.T) {
+	backend, received := fakeBackend(t)
+	withProxy(t, backend)
+	signer, _ = newLocalSigner(mapSecrets{})
+
+	rr := postProxy(t, "proxy-test", `{"proof": {"Ar": "not a point"}}`)
+	if rr.Code != http.StatusAccepted || rr.Body.String() != "noted reject" {
+		t.Fatalf("Expected the backend answer to be relayed, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if got := rr.Header().Get(proxyDecisionHeader); got != "reject" {
+		t.Errorf("Expected %s: reject, got %q", proxyDecisionHeader, got)
+	}
+	if len(*received) != 1 {
+		t.Fatalf("Expected one decision at the backend, got %d", len(*received))
+	}
+
+	d := (*received)[0]
+	if d.Policy != "proxy-test" || d.Decision != "reject" || d.Reason != errs.Code(errMalformedProof) || d.RequestID != "req-1" {
+		t.Errorf("Unexpected decision %+v", d)
+	}
+	if d.Verifier != issuerDID || d.KeyID != signer.KeyID() {
+		t.Errorf("Expected the decision to name this server's key, got %+v", d)
+	}
+	unsigned := d
+	unsigned.KeyID, unsigned.Signature = "", nil
+	payload, _ := json.Marshal(unsigned)
+	digest := sha256.Sum256(payload)
+	if !ecdsa.VerifyASN1(signer.Public().(*ecdsa.PublicKey), digest[:], d.Signature) {
+		t.Error("Expected the decision signature to verify")
+	}
+}
+
+func TestProxyErrors(t *testing.T) {
+	backend, received := fakeBackend(t)
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	tests := []struct {
+		name    string
+		backend string
+		policy  string
+		body    string
+		status  int
+	}{
+		{"Disabled", "", "proxy-test", `{"proof": {}}`, http.StatusNotFound},
+		{"Unknown policy", backend, "missing", `{"proof": {}}`, http.StatusNotFound},
+		{"Malformed request", backend, "proxy-test", `{"proof": {}, "extra": 1}`, http.StatusBadRequest},
+		{"Backend unreachable", unreachable.URL, "proxy-test", `{"proof": {}}`, http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withProxy(t, tt.backend)
+			if rr := postProxy(t, tt.policy, tt.body); rr.Code != tt.status {
+				t.Errorf("Expected %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+		})
+	}
+	if len(*received) != 0 {
+		t.Errorf("Expected nothing to be forwarded, got %+v", *received)
+	}
+}
+
+func TestProxyAcceptsValidProofs(t *testing.T) {
+	SkipIfShort(t, "proxy acceptance")
+
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+	h.StoreBalance("proxy_user", 1000)
+	backend, received := fakeBackend(t)
+	withProxy(t, backend)
+
+	rr := postJSON(t, generateCompositeProof, "/get/proof/composite", CompositeProofRequest{
+		ID: "proxy_user", Predicates: []PredicateSpec{{Name: "balance", Threshold: 500}},
+	})
+	h.AssertStatusCode(rr, http.StatusOK, "generating composite proof")
+	var resp struct {
+		Proof json.RawMessage `json:"proof"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	body, _ := json.Marshal(ProxyRequest{Proof: resp.Proof})
+
+	rr = postProxy(t, "proxy-test", string(body))
+	h.AssertStatusCode(rr, http.StatusAccepted, "proxying a valid proof")
+	if len(*received) != 1 || (*received)[0].Decision != "accept" || (*received)[0].ProofDigest == "" {
+		t.Errorf("Expected an accept decision with the proof digest, got %+v", *received)
+	}
+}
+
+func TestProxyOnly(t *testing.T) {
+	handler := proxyOnly(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/proxy/loan", http.StatusNoContent},
+		{"/health", http.StatusNoContent},
+		{"/admin/peers", http.StatusNoContent},
+		{"/keys/signing", http.StatusNoContent},
+		{"/store/sum", http.StatusNotFound},
+		{"/get/proof", http.StatusNotFound},
+		{"/keys/verifying/balance", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+			if rr.Code != tt.status {
+				t.Errorf("Expected %d, got %d", tt.status, rr.Code)
+			}
+		})
+	}
+}
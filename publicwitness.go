@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/consensys/gnark"
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/frontend"
+	"github.com/korjavin/zkTest1/circuits"
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// publicWitnessHeader carries the base64 gnark binary encoding of the public witness of an issued proof
+const publicWitnessHeader = "X-Public-Witness"
+
+var errPublicWitnessMismatch = errs.New(errs.Invalid, "public_witness_mismatch", "public witness does not encode the public inputs of the request")
+
+// encodePublicWitness returns the gnark binary encoding of the public part of assignment on curve
+func encodePublicWitness(curve ecc.ID, assignment frontend.Circuit) ([]byte, error) {
+	w, err := frontend.NewWitness(assignment, curve.ScalarField(), frontend.PublicOnly())
+	if err != nil {
+		return nil, err
+	}
+	return w.MarshalBinary()
+}
+
+// setProofHeaders returns the gnark release, curve and public witness of a proof with it;
+// like persisting, a failure here must not fail proving
+func setProofHeaders(w http.ResponseWriter, curve ecc.ID, assignment frontend.Circuit) {
+	w.Header().Set(gnarkVersionHeader, gnark.Version.String())
+	w.Header().Set(proofCurveHeader, curve.String())
+
+	data, err := encodePublicWitness(curve, assignment)
+	if err != nil {
+		log.Printf("Failed to encode public witness: %v", err)
+		return
+	}
+	w.Header().Set(publicWitnessHeader, base64.StdEncoding.EncodeToString(data))
+}
+
+// checkPublicWitness verifies that a serialized public witness, when given, encodes the public
+// inputs of expected, so a client and the server disagreeing on encoding fails explicitly
+// rather than as an invalid proof
+func checkPublicWitness(curve ecc.ID, data []byte, expected frontend.Circuit) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	given, err := unmarshalWitness(curve, data)
+	if err != nil {
+		return err
+	}
+
+	want, err := encodePublicWitness(curve, expected)
+	if err != nil {
+		return err
+	}
+	// Re-encoding normalizes the vector, so equal inputs give equal bytes
+	got, err := given.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(got, want) {
+		return errPublicWitnessMismatch
+	}
+	return nil
+}
+
+// PublicInputValue is one public input a proof was verified against
+type PublicInputValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"` // decimal field element
+}
+
+// WitnessValidateResponse reports what a proof verified against a caller's public witness proves
+type WitnessValidateResponse struct {
+	Circuit      string             `json:"circuit"`
+	PublicInputs []PublicInputValue `json:"publicInputs"`
+}
+
+// witnessChecks enforce the conditions a circuit's validate endpoint checks outside the proof
+var witnessChecks = map[string]func(inputs map[string]*big.Int, now time.Time) error{
+	timeLockCircuitName: func(inputs map[string]*big.Int, now time.Time) error {
+		notBefore := time.Unix(inputs["NotBefore"].Int64(), 0)
+		if now.Before(notBefore) {
+			return fmt.Errorf("%w: valid from %s", errNotYetValid, notBefore.UTC().Format(time.RFC3339))
+		}
+		return nil
+	},
+}
+
+// witnessHeaderSize is the size of the public count, secret count and vector length that start a binary witness
+const witnessHeaderSize = 12
+
+// unmarshalWitness decodes a gnark binary witness on curve. gnark allocates the vector from its
+// length field, so the length is checked against the data first.
+func unmarshalWitness(curve ecc.ID, data []byte) (witness.Witness, error) {
+	if len(data) < witnessHeaderSize {
+		return nil, errs.Errorf(errs.Invalid, "invalid public witness: too short")
+	}
+	nbPublic, nbSecret := binary.BigEndian.Uint32(data[0:4]), binary.BigEndian.Uint32(data[4:8])
+	n := binary.BigEndian.Uint32(data[8:12])
+	if uint64(n) != uint64(nbPublic)+uint64(nbSecret) || uint64(len(data)) != witnessHeaderSize+uint64(n)*uint64(fieldBytes(curve)) {
+		return nil, errs.Errorf(errs.Invalid, "invalid public witness: length does not match its header")
+	}
+
+	w, err := witness.New(curve.ScalarField())
+	if err != nil {
+		return nil, err
+	}
+	if err := w.UnmarshalBinary(data); err != nil {
+		return nil, errs.Errorf(errs.Invalid, "invalid public witness: %v", err)
+	}
+	return w, nil
+}
+
+// fieldBytes is the size of a serialized scalar field element of curve
+func fieldBytes(curve ecc.ID) int {
+	return (curve.ScalarField().BitLen() + 7) / 8
+}
+
+// decodePublicWitness decodes a serialized public witness, checking it against the schema of
+// circuit, and returns it with its input values in schema order
+func decodePublicWitness(curve ecc.ID, data []byte, circuit frontend.Circuit) (witness.Witness, []circuits.PublicInput, []*big.Int, error) {
+	inputs, err := circuits.PublicInputs(circuit)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	w, err := unmarshalWitness(curve, data)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if binary.BigEndian.Uint32(data[4:8]) != 0 {
+		return nil, nil, nil, errs.Errorf(errs.Invalid, "public witness must not contain private inputs")
+	}
+
+	// Elements follow the header as big-endian integers of the field size
+	size := fieldBytes(curve)
+	values := make([]*big.Int, (len(data)-witnessHeaderSize)/size)
+	if len(values) != len(inputs) {
+		return nil, nil, nil, errs.Errorf(errs.Invalid, "public witness has %d inputs, the circuit has %d", len(values), len(inputs))
+	}
+	for i := range values {
+		offset := witnessHeaderSize + i*size
+		values[i] = new(big.Int).SetBytes(data[offset : offset+size])
+	}
+	return w, inputs, values, nil
+}
+
+// verifyAgainstWitness verifies a proof on curve for a registered circuit against a caller's
+// serialized public witness alone, returning the public inputs it proves
+func verifyAgainstWitness(ctx context.Context, curve ecc.ID, name string, proof groth16.Proof, data []byte, now time.Time) (*WitnessValidateResponse, error) {
+	return againstWitness(ctx, curve, name, proof, data, now, (*circuitSetup).verifyWitness)
+}
+
+// checkAgainstWitness is verifyAgainstWitness without counting or auditing the attempt
+func checkAgainstWitness(ctx context.Context, curve ecc.ID, name string, proof groth16.Proof, data []byte, now time.Time) (*WitnessValidateResponse, error) {
+	return againstWitness(ctx, curve, name, proof, data, now, (*circuitSetup).checkWitness)
+}
+
+func againstWitness(ctx context.Context, curve ecc.ID, name string, proof groth16.Proof, data []byte, now time.Time,
+	verify func(*circuitSetup, context.Context, groth16.Proof, witness.Witness) error) (*WitnessValidateResponse, error) {
+	circuit, public, resp, err := checkedWitness(curve, name, data, now)
+	if err != nil {
+		return nil, err
+	}
+	setup, err := loadCurveSetup(curve, name, circuit)
+	if err != nil {
+		return nil, err
+	}
+	if err := verify(setup, ctx, proof, public); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// checkedWitness decodes a serialized public witness of a registered circuit and applies the
+// circuit's checks of its public inputs
+func checkedWitness(curve ecc.ID, name string, data []byte, now time.Time) (frontend.Circuit, witness.Witness, *WitnessValidateResponse, error) {
+	circuit, err := circuits.New(name)
+	if err != nil {
+		return nil, nil, nil, errs.Wrap(errs.Invalid, err)
+	}
+	public, inputs, values, err := decodePublicWitness(curve, data, circuit)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	resp := &WitnessValidateResponse{Circuit: name, PublicInputs: make([]PublicInputValue, len(inputs))}
+	byName := make(map[string]*big.Int, len(inputs))
+	for i, in := range inputs {
+		resp.PublicInputs[i] = PublicInputValue{Name: in.Name, Value: values[i].String()}
+		byName[in.Name] = values[i]
+	}
+	if check, ok := witnessChecks[name]; ok {
+		if err := check(byName, now); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return circuit, public, resp, nil
+}
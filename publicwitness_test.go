@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/korjavin/zkTest1/circuits"
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+func TestCheckPublicWitness(t *testing.T) {
+	issued, err := encodePublicWitness(defaultCurve, &circuits.TimeLockedBalanceCircuit{Balance: 900, NeededAmount: 500, NotBefore: 1700000000})
+	if err != nil {
+		t.Fatalf("Failed to encode public witness: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected *circuits.TimeLockedBalanceCircuit
+		code     string // empty when the witness matches
+	}{
+		{"Matching inputs", issued, &circuits.TimeLockedBalanceCircuit{NeededAmount: 500, NotBefore: 1700000000}, ""},
+		{"No witness", nil, &circuits.TimeLockedBalanceCircuit{NeededAmount: 1, NotBefore: 2}, ""},
+		{"Different input", issued, &circuits.TimeLockedBalanceCircuit{NeededAmount: 500, NotBefore: 1700000001}, "public_witness_mismatch"},
+		{"Truncated", issued[:len(issued)-5], &circuits.TimeLockedBalanceCircuit{NeededAmount: 500, NotBefore: 1700000000}, "invalid_request"},
+		{"Forged length", []byte{0, 0, 0, 1, 0, 0, 0, 0, 0x7f, 0xff, 0xff, 0xff, 1}, &circuits.TimeLockedBalanceCircuit{NeededAmount: 500, NotBefore: 1700000000}, "invalid_request"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkPublicWitness(defaultCurve, tt.data, tt.expected)
+			if tt.code == "" {
+				if err != nil {
+					t.Errorf("Expected witness to match, got %v", err)
+				}
+				return
+			}
+			if errs.Code(err) != tt.code {
+				t.Errorf("Expected code %q, got %q (%v)", tt.code, errs.Code(err), err)
+			}
+		})
+	}
+}
+
+func TestPublicWitnessOmitsSecrets(t *testing.T) {
+	rr := httptest.NewRecorder()
+	setProofHeaders(rr, defaultCurve, &circuits.BalanceCircuit{Balance: 123456, NeededAmount: 100})
+
+	public := rr.Header().Get(publicWitnessHeader)
+	if public == "" {
+		t.Fatal("Expected a public witness header")
+	}
+
+	rr = httptest.NewRecorder()
+	setProofHeaders(rr, defaultCurve, &circuits.BalanceCircuit{Balance: 1, NeededAmount: 100})
+	if got := rr.Header().Get(publicWitnessHeader); got != public {
+		t.Error("Expected the public witness not to depend on the secret balance")
+	}
+
+	// Verifier-side assignments leave private wires unset and must encode the same way
+	clauses, err := parsePredicate("balance >= 100 || creditScore >= 650")
+	if err != nil {
+		t.Fatalf("Failed to parse predicate: %v", err)
+	}
+	issued, _ := encodePublicWitness(defaultCurve, predicateAssignment(clauses, map[string]int64{"balance": 500}))
+	if err := checkPublicWitness(defaultCurve, issued, predicateAssignment(clauses, nil)); err != nil {
+		t.Errorf("Expected the issued predicate witness to match the verifier's, got %v", err)
+	}
+}
+
+func TestVerifyAgainstWitness(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	encode := func(assignment frontend.Circuit) []byte {
+		data, err := encodePublicWitness(defaultCurve, assignment)
+		if err != nil {
+			t.Fatalf("Failed to encode public witness: %v", err)
+		}
+		return data
+	}
+	full, _ := frontend.NewWitness(&circuits.BalanceCircuit{Balance: 900, NeededAmount: 500}, ecc.BN254.ScalarField())
+	withSecrets, _ := full.MarshalBinary()
+
+	tests := []struct {
+		name    string
+		circuit string
+		data    []byte
+		code    string
+	}{
+		{"Unknown circuit", "teleport", encode(&circuits.BalanceCircuit{NeededAmount: 1}), "invalid_request"},
+		{"Garbage", circuits.BalanceName, []byte("not a witness"), "invalid_request"},
+		{"Private inputs", circuits.BalanceName, withSecrets, "invalid_request"},
+		{"Another circuit's witness", circuits.BalanceName, encode(&circuits.BucketCircuit{Lower: 1, Upper: 2}), "invalid_request"},
+		{"Time lock before notBefore", circuits.TimeLockName, encode(&circuits.TimeLockedBalanceCircuit{NeededAmount: 1, NotBefore: now.Unix() + 60}), "not_yet_valid"},
+	}
+
+	proof := groth16.NewProof(ecc.BN254)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := verifyAgainstWitness(context.Background(), defaultCurve, tt.circuit, proof, tt.data, now)
+			if errs.Code(err) != tt.code {
+				t.Errorf("Expected code %q, got %q (%v)", tt.code, errs.Code(err), err)
+			}
+		})
+	}
+
+	t.Run("Valid proof", func(t *testing.T) {
+		SkipIfShort(t, "bucket proof generation")
+
+		setup, err := loadSetup(bucketCircuitName, &circuits.BucketCircuit{})
+		if err != nil {
+			t.Fatalf("Setup failed: %v", err)
+		}
+		assignment := &circuits.BucketCircuit{Balance: 1500, Lower: 1000, Upper: 10000}
+		proof, err := setup.prove(context.Background(), assignment)
+		if err != nil {
+			t.Fatalf("Prove failed: %v", err)
+		}
+
+		resp, err := verifyAgainstWitness(context.Background(), defaultCurve, bucketCircuitName, proof, encode(assignment), now)
+		if err != nil {
+			t.Fatalf("Expected proof to verify against its witness, got %v", err)
+		}
+		want := []PublicInputValue{{"Lower", "1000"}, {"Upper", "10000"}}
+		if !reflect.DeepEqual(resp.PublicInputs, want) {
+			t.Errorf("Expected public inputs %v, got %v", want, resp.PublicInputs)
+		}
+
+		if _, err := verifyAgainstWitness(context.Background(), defaultCurve, bucketCircuitName, proof, encode(&circuits.BucketCircuit{Lower: 0, Upper: 10000}), now); !errors.Is(err, errInvalidProof) {
+			t.Errorf("Expected errInvalidProof for another bucket, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// anonymousTenant meters requests of callers that did not authenticate
+const anonymousTenant = "anonymous"
+
+var (
+	errDailyQuota   = errs.New(errs.TooManyRequests, "daily_quota_exceeded", "daily proving quota exceeded")
+	errMonthlyQuota = errs.New(errs.PaymentRequired, "monthly_quota_exceeded", "monthly proving quota exceeded")
+)
+
+// QuotaConfig limits the proving time each tenant may consume; 0 means unlimited
+type QuotaConfig struct {
+	Daily   time.Duration
+	Monthly time.Duration
+}
+
+// TenantUsage is the proving time a tenant consumed in the current UTC day and month
+type TenantUsage struct {
+	Tenant       string  `json:"tenant"`
+	MonthProofs  int     `json:"monthProofs"`
+	DaySeconds   float64 `json:"daySeconds"`
+	MonthSeconds float64 `json:"monthSeconds"`
+	DailyQuota   float64 `json:"dailyQuotaSeconds,omitempty"`
+	MonthlyQuota float64 `json:"monthlyQuotaSeconds,omitempty"`
+}
+
+// tenantMeter holds the running totals of one tenant
+type tenantMeter struct {
+	day, month  string
+	dayTotal    time.Duration
+	monthTotal  time.Duration
+	monthProofs int
+}
+
+// provingMeter tracks proving time per tenant and enforces the quotas
+type provingMeter struct {
+	mu      sync.Mutex
+	cfg     QuotaConfig
+	now     func() time.Time
+	tenants map[string]*tenantMeter
+}
+
+func newProvingMeter(cfg QuotaConfig, now func() time.Time) *provingMeter {
+	return &provingMeter{cfg: cfg, now: now, tenants: make(map[string]*tenantMeter)}
+}
+
+var meter = newProvingMeter(QuotaConfig{}, time.Now)
+
+// apiKeys holds the tenant IDs of the X-API-Keys the server accepts (see apiKeyTenant); other
+// keys identify no one
+var apiKeys map[string]bool
+
+// tenantID identifies the caller by what it authenticated with: the client of its bearer token,
+// the key it signed the request with, or a listed X-API-Key. Callers with none of them, or with
+// a key that is not listed, share anonymousTenant, so made-up keys do not open quotas of their own.
+func tenantID(r *http.Request) string {
+	if token := accessTokenOf(r.Context()); token != nil && token.ClientID != "" {
+		return "client-" + token.ClientID
+	}
+	if isSignedRequest(r) {
+		return "hmac-" + r.Header.Get(signatureKeyHeader)
+	}
+	if key := r.Header.Get("X-API-Key"); key != "" && apiKeys[apiKeyTenant(key)] {
+		return apiKeyTenant(key)
+	}
+	return anonymousTenant
+}
+
+// apiKeyTenant names the tenant of an API key by a hash of it, so raw keys are never kept
+func apiKeyTenant(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "key-" + hex.EncodeToString(sum[:8])
+}
+
+// parseAPIKeys parses the tenant IDs of accepted API keys, as key- and 16 hex digits
+func parseAPIKeys(values []string) (map[string]bool, error) {
+	keys := make(map[string]bool, len(values))
+	for _, v := range values {
+		digest, ok := strings.CutPrefix(v, "key-")
+		if _, err := hex.DecodeString(digest); !ok || len(digest) != 16 || err != nil {
+			return nil, fmt.Errorf("%q is not key- followed by 16 hex digits", v)
+		}
+		keys[strings.ToLower(v)] = true
+	}
+	return keys, nil
+}
+
+// current returns the usage of tenant, rolled over to today; callers must hold m.mu
+func (m *provingMeter) current(tenant string) *tenantMeter {
+	u, ok := m.tenants[tenant]
+	if !ok {
+		u = &tenantMeter{}
+		m.tenants[tenant] = u
+	}
+	now := m.now().UTC()
+	if day := now.Format(time.DateOnly); u.day != day {
+		u.day, u.dayTotal = day, 0
+	}
+	if month := now.Format("2006-01"); u.month != month {
+		u.month, u.monthTotal, u.monthProofs = month, 0, 0
+	}
+	return u
+}
+
+// check reports whether tenant may start another proof
+func (m *provingMeter) check(tenant string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u := m.current(tenant)
+	if m.cfg.Monthly > 0 && u.monthTotal >= m.cfg.Monthly {
+		return errMonthlyQuota
+	}
+	if m.cfg.Daily > 0 && u.dayTotal >= m.cfg.Daily {
+		return errDailyQuota
+	}
+	return nil
+}
+
+// record charges tenant for proving time
+func (m *provingMeter) record(tenant string, took time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u := m.current(tenant)
+	u.dayTotal += took
+	u.monthTotal += took
+	u.monthProofs++
+}
+
+// snapshot returns the usage of tenant as reported by the API; callers must hold m.mu
+func (m *provingMeter) snapshot(tenant string) TenantUsage {
+	u := m.current(tenant)
+	return TenantUsage{
+		Tenant:       tenant,
+		MonthProofs:  u.monthProofs,
+		DaySeconds:   u.dayTotal.Seconds(),
+		MonthSeconds: u.monthTotal.Seconds(),
+		DailyQuota:   m.cfg.Daily.Seconds(),
+		MonthlyQuota: m.cfg.Monthly.Seconds(),
+	}
+}
+
+func (m *provingMeter) usage(tenant string) TenantUsage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.snapshot(tenant)
+}
+
+func (m *provingMeter) all() []TenantUsage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]TenantUsage, 0, len(m.tenants))
+	for tenant := range m.tenants {
+		out = append(out, m.snapshot(tenant))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Tenant < out[j].Tenant })
+	return out
+}
+
+// untilNextDay is the time until the daily quota resets at UTC midnight
+func untilNextDay(now time.Time) time.Duration {
+	now = now.UTC()
+	y, mo, d := now.Date()
+	return time.Date(y, mo, d+1, 0, 0, 0, 0, time.UTC).Sub(now)
+}
+
+// meterProving enforces the caller's proving quota and charges it for the time the handler takes.
+// Concurrent requests are checked before any of them is charged, so a tenant can overshoot by one batch.
+func meterProving(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenant := tenantID(r)
+		switch err := meter.check(tenant); {
+		case errors.Is(err, errMonthlyQuota):
+			writeError(w, err)
+			return
+		case errors.Is(err, errDailyQuota):
+			retry := untilNextDay(meter.now())
+			w.Header().Set("Retry-After", strconv.Itoa(int(retry.Seconds())+1))
+			writeError(w, fmt.Errorf("%w, resets in %s", err, retry.Round(time.Minute)))
+			return
+		}
+
+		start := time.Now()
+		next(w, r)
+		meter.record(tenant, time.Since(start))
+	}
+}
+
+// getUsage reports the caller's own proving usage
+func getUsage(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, meter.usage(tenantID(r)))
+}
+
+// getAllUsage reports the proving usage of every tenant
+func getAllUsage(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, meter.all())
+}
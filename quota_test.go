@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// withAPIKeys makes the server accept keys as X-API-Keys
+func withAPIKeys(t *testing.T, keys ...string) {
+	t.Helper()
+	previous := apiKeys
+	t.Cleanup(func() { apiKeys = previous })
+	apiKeys = make(map[string]bool)
+	for _, key := range keys {
+		apiKeys[apiKeyTenant(key)] = true
+	}
+}
+
+func TestTenantID(t *testing.T) {
+	withAPIKeys(t, "secret-key-1")
+	request := func(key string) *http.Request {
+		r := httptest.NewRequest("GET", "/usage", nil)
+		if key != "" {
+			r.Header.Set("X-API-Key", key)
+		}
+		return r
+	}
+
+	if got := tenantID(request("")); got != anonymousTenant {
+		t.Errorf("Expected %s without a key, got %s", anonymousTenant, got)
+	}
+	id := tenantID(request("secret-key-1"))
+	if id == anonymousTenant || id == "secret-key-1" || id != apiKeyTenant("secret-key-1") {
+		t.Errorf("Expected a hashed tenant id, got %s", id)
+	}
+	if got := tenantID(request("made-up-key")); got != anonymousTenant {
+		t.Errorf("Expected an unknown key to share %s, got %s", anonymousTenant, got)
+	}
+
+	// An authenticated client wins over any key it sends
+	token := request("secret-key-1")
+	token = token.WithContext(withAccessToken(token.Context(), &accessToken{ClientID: "partner"}))
+	if got := tenantID(token); got != "client-partner" {
+		t.Errorf("Expected the token's client to be the tenant, got %s", got)
+	}
+
+	if _, err := parseAPIKeys([]string{id}); err != nil {
+		t.Errorf("Expected %s to parse, got %v", id, err)
+	}
+	if _, err := parseAPIKeys([]string{"secret-key-1"}); err == nil {
+		t.Error("Expected a raw key to be refused in ZK_API_KEYS")
+	}
+}
+
+func TestProvingMeterQuotas(t *testing.T) {
+	now := time.Date(2026, 3, 30, 23, 0, 0, 0, time.UTC)
+	m := newProvingMeter(QuotaConfig{Daily: 10 * time.Second, Monthly: 15 * time.Second}, func() time.Time { return now })
+
+	m.record("t1", 10*time.Second)
+	if err := m.check("t1"); err != errDailyQuota {
+		t.Errorf("Expected the daily quota to be exhausted, got %v", err)
+	}
+	if err := m.check("t2"); err != nil {
+		t.Errorf("Expected other tenants to be unaffected, got %v", err)
+	}
+
+	// A new day resets the daily total but not the monthly one
+	now = now.Add(2 * time.Hour)
+	if err := m.check("t1"); err != nil {
+		t.Errorf("Expected a new day to reset the daily quota, got %v", err)
+	}
+	m.record("t1", 6*time.Second)
+	if err := m.check("t1"); err != errMonthlyQuota {
+		t.Errorf("Expected the monthly quota to be exhausted, got %v", err)
+	}
+
+	now = time.Date(2026, 4, 1, 0, 0, 1, 0, time.UTC)
+	if err := m.check("t1"); err != nil {
+		t.Errorf("Expected a new month to reset the quota, got %v", err)
+	}
+	if u := m.usage("t1"); u.MonthSeconds != 0 || u.MonthProofs != 0 {
+		t.Errorf("Expected fresh monthly usage, got %+v", u)
+	}
+}
+
+func TestMeterProvingResponses(t *testing.T) {
+	previous := meter
+	t.Cleanup(func() { meter = previous })
+
+	handler := meterProving(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+
+	tests := []struct {
+		name           string
+		used           time.Duration
+		quota          QuotaConfig
+		expectedStatus int
+	}{
+		{"Within quota", time.Second, QuotaConfig{Daily: time.Minute, Monthly: time.Hour}, http.StatusOK},
+		{"Daily quota exceeded", time.Minute, QuotaConfig{Daily: time.Minute, Monthly: time.Hour}, http.StatusTooManyRequests},
+		{"Monthly quota exceeded", time.Hour, QuotaConfig{Daily: time.Minute, Monthly: time.Hour}, http.StatusPaymentRequired},
+		{"Unlimited", 24 * time.Hour, QuotaConfig{}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meter = newProvingMeter(tt.quota, time.Now)
+			meter.record(anonymousTenant, tt.used)
+
+			rr := httptest.NewRecorder()
+			handler(rr, httptest.NewRequest("POST", "/get/proof/neededAmount", nil))
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if rr.Code == http.StatusTooManyRequests && rr.Header().Get("Retry-After") == "" {
+				t.Error("Expected Retry-After on 429")
+			}
+		})
+	}
+
+	meter = newProvingMeter(QuotaConfig{}, time.Now)
+	handler(httptest.NewRecorder(), httptest.NewRequest("POST", "/get/proof/neededAmount", nil))
+	if u := meter.usage(anonymousTenant); u.MonthProofs != 1 {
+		t.Errorf("Expected the request to be metered, got %+v", u)
+	}
+}
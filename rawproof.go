@@ -0,0 +1,392 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fp"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// Proof formats of other proving stacks accepted by /validate/raw
+const (
+	formatSnarkJS  = "snarkjs"
+	formatArkworks = "arkworks"
+)
+
+var errRawFormat = errs.New(errs.Invalid, "raw_format_invalid", "verifying key, proof or public inputs are not valid for the format")
+
+// RawValidateRequest carries a Groth16 BN254 proof with its own verifying key. For snarkjs the
+// fields are the verification_key.json and proof.json objects and the public.json array; for
+// arkworks they are hex strings of the compressed CanonicalSerialize encoding of the
+// VerifyingKey, Proof and Vec<Fr> of public inputs.
+type RawValidateRequest struct {
+	Format        string          `json:"format"`
+	VerifyingKey  json.RawMessage `json:"verifyingKey"`
+	Proof         json.RawMessage `json:"proof"`
+	PublicSignals json.RawMessage `json:"publicSignals"`
+}
+
+type RawValidateResponse struct {
+	Format       string   `json:"format"`
+	Curve        string   `json:"curve"`
+	PublicInputs []string `json:"publicInputs"` // decimal field elements
+}
+
+// rawProof is a foreign proof converted to gnark's types
+type rawProof struct {
+	vk     *groth16_bn254.VerifyingKey
+	proof  *groth16_bn254.Proof
+	public fr.Vector
+}
+
+// validateRawProof verifies a proof made by another Groth16 implementation against the
+// verifying key sent with it, so the server can act as a verification hub
+func validateRawProof(w http.ResponseWriter, r *http.Request) {
+	var req RawValidateRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := checkTenantAccess(r, "raw-"+req.Format); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var raw *rawProof
+	var err error
+	switch req.Format {
+	case formatSnarkJS:
+		raw, err = importSnarkJS(req.VerifyingKey, req.Proof, req.PublicSignals)
+	case formatArkworks:
+		raw, err = importArkworks(req.VerifyingKey, req.Proof, req.PublicSignals)
+	default:
+		err = errs.Errorf(errs.Invalid, "unsupported format %q, supported: %s, %s", req.Format, formatSnarkJS, formatArkworks)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := raw.vk.Precompute(); err != nil {
+		writeError(w, fmt.Errorf("%w: verifying key: %v", errRawFormat, err))
+		return
+	}
+
+	circuit := "raw-" + req.Format
+	start := time.Now()
+	err = groth16_bn254.Verify(raw.proof, raw.vk, raw.public)
+	timingsOf(r.Context()).addVerification(time.Since(start))
+	if err != nil {
+		usage.recordValidation(circuit, errInvalidProof)
+		auditVerification(circuit, raw.proof, errInvalidProof)
+		writeError(w, errInvalidProof)
+		return
+	}
+	usage.recordValidation(circuit, nil)
+	auditVerification(circuit, raw.proof, nil)
+
+	resp := RawValidateResponse{Format: req.Format, Curve: "bn254", PublicInputs: make([]string, len(raw.public))}
+	for i := range raw.public {
+		resp.PublicInputs[i] = raw.public[i].String()
+	}
+	writeJSON(w, resp)
+}
+
+// snarkjs encodes points as decimal projective coordinates, G1 as [x, y, z] and G2 as
+// [[x.c0, x.c1], [y.c0, y.c1], [z.c0, z.c1]], with z = 1 for the affine points it exports
+type snarkjsVerifyingKey struct {
+	Protocol string     `json:"protocol"`
+	Curve    string     `json:"curve"`
+	NPublic  int        `json:"nPublic"`
+	Alpha1   []string   `json:"vk_alpha_1"`
+	Beta2    [][]string `json:"vk_beta_2"`
+	Gamma2   [][]string `json:"vk_gamma_2"`
+	Delta2   [][]string `json:"vk_delta_2"`
+	IC       [][]string `json:"IC"`
+}
+
+type snarkjsProof struct {
+	Protocol string     `json:"protocol"`
+	Curve    string     `json:"curve"`
+	A        []string   `json:"pi_a"`
+	B        [][]string `json:"pi_b"`
+	C        []string   `json:"pi_c"`
+}
+
+func importSnarkJS(vkData, proofData, publicData []byte) (*rawProof, error) {
+	var vk snarkjsVerifyingKey
+	var proof snarkjsProof
+	var signals []string
+	if err := json.Unmarshal(vkData, &vk); err != nil {
+		return nil, fmt.Errorf("%w: verifying key: %v", errRawFormat, err)
+	}
+	if err := json.Unmarshal(proofData, &proof); err != nil {
+		return nil, fmt.Errorf("%w: proof: %v", errRawFormat, err)
+	}
+	if err := json.Unmarshal(publicData, &signals); err != nil {
+		return nil, fmt.Errorf("%w: public signals: %v", errRawFormat, err)
+	}
+	for _, p := range []struct{ protocol, curve string }{{vk.Protocol, vk.Curve}, {proof.Protocol, proof.Curve}} {
+		if p.protocol != "groth16" || !slices.Contains([]string{"bn128", "bn254"}, strings.ToLower(p.curve)) {
+			return nil, errs.Errorf(errs.Invalid, "only groth16 proofs on bn128 are supported, got %s on %s", p.protocol, p.curve)
+		}
+	}
+	if len(vk.IC) != vk.NPublic+1 || len(signals) != vk.NPublic {
+		return nil, fmt.Errorf("%w: expected %d public signals and %d IC points", errRawFormat, vk.NPublic, vk.NPublic+1)
+	}
+
+	raw := &rawProof{vk: &groth16_bn254.VerifyingKey{}, proof: &groth16_bn254.Proof{}}
+	var err error
+	set := func(name string, parse func() error) {
+		if err == nil {
+			if e := parse(); e != nil {
+				err = fmt.Errorf("%w: %s: %v", errRawFormat, name, e)
+			}
+		}
+	}
+	set("vk_alpha_1", func() error { return snarkjsG1(&raw.vk.G1.Alpha, vk.Alpha1) })
+	set("vk_beta_2", func() error { return snarkjsG2(&raw.vk.G2.Beta, vk.Beta2) })
+	set("vk_gamma_2", func() error { return snarkjsG2(&raw.vk.G2.Gamma, vk.Gamma2) })
+	set("vk_delta_2", func() error { return snarkjsG2(&raw.vk.G2.Delta, vk.Delta2) })
+	raw.vk.G1.K = make([]bn254.G1Affine, len(vk.IC))
+	for i := range vk.IC {
+		set(fmt.Sprintf("IC[%d]", i), func() error { return snarkjsG1(&raw.vk.G1.K[i], vk.IC[i]) })
+	}
+	set("pi_a", func() error { return snarkjsG1(&raw.proof.Ar, proof.A) })
+	set("pi_b", func() error { return snarkjsG2(&raw.proof.Bs, proof.B) })
+	set("pi_c", func() error { return snarkjsG1(&raw.proof.Krs, proof.C) })
+	raw.public = make(fr.Vector, len(signals))
+	for i, s := range signals {
+		set(fmt.Sprintf("public signal %d", i), func() error {
+			v, err := decimalElement(s, fr.Modulus())
+			raw.public[i].SetBigInt(v)
+			return err
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// decimalElement parses a canonical decimal field element
+func decimalElement(s string, modulus *big.Int) (*big.Int, error) {
+	v, ok := new(big.Int).SetString(s, 10)
+	if !ok || v.Sign() < 0 || v.Cmp(modulus) >= 0 {
+		return new(big.Int), fmt.Errorf("%q is not a field element", s)
+	}
+	return v, nil
+}
+
+func snarkjsG1(p *bn254.G1Affine, coords []string) error {
+	if len(coords) != 3 || coords[2] != "1" {
+		return fmt.Errorf("expected affine [x, y, \"1\"]")
+	}
+	x, err := decimalElement(coords[0], fp.Modulus())
+	if err != nil {
+		return err
+	}
+	y, err := decimalElement(coords[1], fp.Modulus())
+	if err != nil {
+		return err
+	}
+	p.X.SetBigInt(x)
+	p.Y.SetBigInt(y)
+	if !p.IsOnCurve() || !p.IsInSubGroup() {
+		return fmt.Errorf("point is not on the curve")
+	}
+	return nil
+}
+
+func snarkjsG2(p *bn254.G2Affine, coords [][]string) error {
+	if len(coords) != 3 || !slices.Equal(coords[2], []string{"1", "0"}) {
+		return fmt.Errorf("expected affine [[x0, x1], [y0, y1], [\"1\", \"0\"]]")
+	}
+	var parts [4]*big.Int
+	for i, s := range [][]string{coords[0], coords[1]} {
+		if len(s) != 2 {
+			return fmt.Errorf("expected coordinates in Fp2")
+		}
+		for j := range s {
+			v, err := decimalElement(s[j], fp.Modulus())
+			if err != nil {
+				return err
+			}
+			parts[2*i+j] = v
+		}
+	}
+	p.X.A0.SetBigInt(parts[0])
+	p.X.A1.SetBigInt(parts[1])
+	p.Y.A0.SetBigInt(parts[2])
+	p.Y.A1.SetBigInt(parts[3])
+	if !p.IsOnCurve() || !p.IsInSubGroup() {
+		return fmt.Errorf("point is not on the curve")
+	}
+	return nil
+}
+
+// arkworks flags of compressed short Weierstrass points, in the top bits of the last byte
+const (
+	arkPointAtInfinity = 1 << 6
+	arkYIsNegative     = 1 << 7
+)
+
+// gnark flags of compressed points, in the top bits of the first byte
+const (
+	gnarkCompressedSmallest = 0b10 << 6
+	gnarkCompressedLargest  = 0b11 << 6
+	gnarkCompressedInfinity = 0b01 << 6
+)
+
+// arkReader reads arkworks' compressed canonical serialization, which is little-endian
+type arkReader struct {
+	data []byte
+	err  error
+}
+
+func newArkReader(field string, data []byte) *arkReader {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return &arkReader{err: fmt.Errorf("%s must be a hex string", field)}
+	}
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		return &arkReader{err: fmt.Errorf("%s: %v", field, err)}
+	}
+	return &arkReader{data: b}
+}
+
+func (a *arkReader) next(n int) []byte {
+	if a.err != nil {
+		return nil
+	}
+	if len(a.data) < n {
+		a.err = fmt.Errorf("truncated")
+		return nil
+	}
+	b := a.data[:n]
+	a.data = a.data[n:]
+	return b
+}
+
+// point converts a compressed arkworks point to gnark's encoding: reversing the bytes makes
+// them big-endian, and for G2 also puts c1 before c0 as gnark does
+func (a *arkReader) point(size int, setBytes func([]byte) (int, error)) {
+	le := a.next(size)
+	if le == nil {
+		return
+	}
+	be := make([]byte, size)
+	for i := range le {
+		be[size-1-i] = le[i]
+	}
+	flags := be[0] & (arkPointAtInfinity | arkYIsNegative)
+	be[0] &^= arkPointAtInfinity | arkYIsNegative
+	switch {
+	case flags&arkPointAtInfinity != 0:
+		be[0] |= gnarkCompressedInfinity
+	case flags&arkYIsNegative != 0:
+		be[0] |= gnarkCompressedLargest
+	default:
+		be[0] |= gnarkCompressedSmallest
+	}
+	if _, err := setBytes(be); err != nil {
+		a.err = err
+	}
+}
+
+func (a *arkReader) g1(p *bn254.G1Affine) { a.point(bn254.SizeOfG1AffineCompressed, p.SetBytes) }
+func (a *arkReader) g2(p *bn254.G2Affine) { a.point(bn254.SizeOfG2AffineCompressed, p.SetBytes) }
+
+// length reads the u64 length prefix of a Vec
+func (a *arkReader) length(max int) int {
+	b := a.next(8)
+	if b == nil {
+		return 0
+	}
+	n := binary.LittleEndian.Uint64(b)
+	if n > uint64(max) {
+		a.err = fmt.Errorf("vector of %d elements is too long", n)
+		return 0
+	}
+	return int(n)
+}
+
+func (a *arkReader) scalar(e *fr.Element) {
+	le := a.next(fr.Bytes)
+	if le == nil {
+		return
+	}
+	be := make([]byte, fr.Bytes)
+	for i := range le {
+		be[fr.Bytes-1-i] = le[i]
+	}
+	if err := e.SetBytesCanonical(be); err != nil {
+		a.err = err
+	}
+}
+
+// done reports the first error, or trailing bytes
+func (a *arkReader) done(field string) error {
+	if a.err == nil && len(a.data) != 0 {
+		a.err = fmt.Errorf("%d trailing bytes", len(a.data))
+	}
+	if a.err != nil {
+		return fmt.Errorf("%w: %s: %v", errRawFormat, field, a.err)
+	}
+	return nil
+}
+
+// maxRawPublicInputs bounds the vectors read from an arkworks encoding
+const maxRawPublicInputs = 1024
+
+// importArkworks decodes ark-groth16's VerifyingKey (alpha_g1, beta_g2, gamma_g2, delta_g2,
+// gamma_abc_g1) and Proof (a, b, c) on BN254
+func importArkworks(vkData, proofData, publicData []byte) (*rawProof, error) {
+	raw := &rawProof{vk: &groth16_bn254.VerifyingKey{}, proof: &groth16_bn254.Proof{}}
+
+	vk := newArkReader("verifyingKey", vkData)
+	vk.g1(&raw.vk.G1.Alpha)
+	vk.g2(&raw.vk.G2.Beta)
+	vk.g2(&raw.vk.G2.Gamma)
+	vk.g2(&raw.vk.G2.Delta)
+	raw.vk.G1.K = make([]bn254.G1Affine, vk.length(maxRawPublicInputs+1))
+	for i := range raw.vk.G1.K {
+		vk.g1(&raw.vk.G1.K[i])
+	}
+	if err := vk.done("verifyingKey"); err != nil {
+		return nil, err
+	}
+
+	proof := newArkReader("proof", proofData)
+	proof.g1(&raw.proof.Ar)
+	proof.g2(&raw.proof.Bs)
+	proof.g1(&raw.proof.Krs)
+	if err := proof.done("proof"); err != nil {
+		return nil, err
+	}
+
+	public := newArkReader("publicSignals", publicData)
+	raw.public = make(fr.Vector, public.length(maxRawPublicInputs))
+	for i := range raw.public {
+		public.scalar(&raw.public[i])
+	}
+	if err := public.done("publicSignals"); err != nil {
+		return nil, err
+	}
+
+	if len(raw.vk.G1.K) != len(raw.public)+1 {
+		return nil, fmt.Errorf("%w: key expects %d public inputs, got %d", errRawFormat, len(raw.vk.G1.K)-1, len(raw.public))
+	}
+	return raw, nil
+}
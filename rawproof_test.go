@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/backend/groth16"
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+)
+
+// foreignCircuit stands in for a circuit of another proving stack: balance ≥ neededAmount without
+// the commitments gnark's range checker adds, which snarkjs and arkworks keys cannot express
+type foreignCircuit struct {
+	Balance      frontend.Variable `gnark:",secret"`
+	NeededAmount frontend.Variable `gnark:",public"`
+}
+
+func (c *foreignCircuit) Define(api frontend.API) error {
+	api.AssertIsLessOrEqual(c.NeededAmount, c.Balance)
+	return nil
+}
+
+func foreignProof(t *testing.T) (*groth16_bn254.VerifyingKey, *groth16_bn254.Proof, []fr.Element) {
+	t.Helper()
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &foreignCircuit{})
+	if err != nil {
+		t.Fatalf("Failed to compile circuit: %v", err)
+	}
+	pk, vk, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatalf("Failed to setup: %v", err)
+	}
+	witness, err := frontend.NewWitness(&foreignCircuit{Balance: 150, NeededAmount: 100}, ecc.BN254.ScalarField())
+	if err != nil {
+		t.Fatalf("Failed to create witness: %v", err)
+	}
+	proof, err := groth16.Prove(ccs, pk, witness)
+	if err != nil {
+		t.Fatalf("Failed to generate proof: %v", err)
+	}
+	var amount fr.Element
+	amount.SetUint64(100)
+	return vk.(*groth16_bn254.VerifyingKey), proof.(*groth16_bn254.Proof), []fr.Element{amount}
+}
+
+// snarkjsFixture encodes a gnark proof as snarkjs would export it
+func snarkjsFixture(vk *groth16_bn254.VerifyingKey, proof *groth16_bn254.Proof, public []fr.Element) (json.RawMessage, json.RawMessage, json.RawMessage) {
+	g1 := func(p bn254.G1Affine) []string { return []string{p.X.String(), p.Y.String(), "1"} }
+	g2 := func(p bn254.G2Affine) [][]string {
+		return [][]string{{p.X.A0.String(), p.X.A1.String()}, {p.Y.A0.String(), p.Y.A1.String()}, {"1", "0"}}
+	}
+	key := snarkjsVerifyingKey{Protocol: "groth16", Curve: "bn128", NPublic: len(public),
+		Alpha1: g1(vk.G1.Alpha), Beta2: g2(vk.G2.Beta), Gamma2: g2(vk.G2.Gamma), Delta2: g2(vk.G2.Delta)}
+	for _, k := range vk.G1.K {
+		key.IC = append(key.IC, g1(k))
+	}
+	signals := make([]string, len(public))
+	for i := range public {
+		signals[i] = public[i].String()
+	}
+	vkJSON, _ := json.Marshal(key)
+	proofJSON, _ := json.Marshal(snarkjsProof{Protocol: "groth16", Curve: "bn128", A: g1(proof.Ar), B: g2(proof.Bs), C: g1(proof.Krs)})
+	publicJSON, _ := json.Marshal(signals)
+	return vkJSON, proofJSON, publicJSON
+}
+
+// arkworksPoint turns gnark's compressed big-endian encoding into arkworks' little-endian one
+func arkworksPoint(be []byte) []byte {
+	flags := be[0] & (0b11 << 6)
+	le := make([]byte, len(be))
+	for i := range be {
+		le[len(be)-1-i] = be[i]
+	}
+	le[len(le)-1] &^= 0b11 << 6
+	switch flags {
+	case gnarkCompressedInfinity:
+		le[len(le)-1] |= arkPointAtInfinity
+	case gnarkCompressedLargest:
+		le[len(le)-1] |= arkYIsNegative
+	}
+	return le
+}
+
+func arkworksFixture(vk *groth16_bn254.VerifyingKey, proof *groth16_bn254.Proof, public []fr.Element) (json.RawMessage, json.RawMessage, json.RawMessage) {
+	g1 := func(p bn254.G1Affine) []byte { b := p.Bytes(); return arkworksPoint(b[:]) }
+	g2 := func(p bn254.G2Affine) []byte { b := p.Bytes(); return arkworksPoint(b[:]) }
+	length := func(n int) []byte { return binary.LittleEndian.AppendUint64(nil, uint64(n)) }
+	encode := func(b []byte) json.RawMessage { s, _ := json.Marshal(hex.EncodeToString(b)); return s }
+
+	key := append(append(append(g1(vk.G1.Alpha), g2(vk.G2.Beta)...), g2(vk.G2.Gamma)...), g2(vk.G2.Delta)...)
+	key = append(key, length(len(vk.G1.K))...)
+	for _, k := range vk.G1.K {
+		key = append(key, g1(k)...)
+	}
+	p := append(append(g1(proof.Ar), g2(proof.Bs)...), g1(proof.Krs)...)
+	inputs := length(len(public))
+	for i := range public {
+		be := public[i].Bytes()
+		for j := len(be) - 1; j >= 0; j-- {
+			inputs = append(inputs, be[j])
+		}
+	}
+	return encode(key), encode(p), encode(inputs)
+}
+
+func TestValidateRawProof(t *testing.T) {
+	SkipIfShort(t, "foreign proof generation")
+	h := NewTestHelper(t)
+	vk, proof, public := foreignProof(t)
+	var other fr.Element
+	other.SetUint64(101)
+
+	snarkVK, snarkProof, snarkPublic := snarkjsFixture(vk, proof, public)
+	_, _, snarkOther := snarkjsFixture(vk, proof, []fr.Element{other})
+	arkVK, arkProof, arkPublic := arkworksFixture(vk, proof, public)
+	_, _, arkOther := arkworksFixture(vk, proof, []fr.Element{other})
+
+	var off map[string]any
+	_ = json.Unmarshal(snarkProof, &off)
+	off["pi_a"] = []string{"1", "3", "1"}
+	offCurve, _ := json.Marshal(off)
+
+	tests := []struct {
+		name   string
+		req    RawValidateRequest
+		status int
+		code   string
+	}{
+		{"snarkjs", RawValidateRequest{formatSnarkJS, snarkVK, snarkProof, snarkPublic}, http.StatusOK, ""},
+		{"snarkjs other signal", RawValidateRequest{formatSnarkJS, snarkVK, snarkProof, snarkOther}, http.StatusUnauthorized, "proof_invalid"},
+		{"snarkjs point off curve", RawValidateRequest{formatSnarkJS, snarkVK, offCurve, snarkPublic}, http.StatusBadRequest, "raw_format_invalid"},
+		{"snarkjs missing signal", RawValidateRequest{formatSnarkJS, snarkVK, snarkProof, json.RawMessage(`[]`)}, http.StatusBadRequest, "raw_format_invalid"},
+		{"arkworks", RawValidateRequest{formatArkworks, arkVK, arkProof, arkPublic}, http.StatusOK, ""},
+		{"arkworks other input", RawValidateRequest{formatArkworks, arkVK, arkProof, arkOther}, http.StatusUnauthorized, "proof_invalid"},
+		{"arkworks truncated proof", RawValidateRequest{formatArkworks, arkVK, json.RawMessage(`"` + strings.Trim(string(arkProof), `"`)[:40] + `"`), arkPublic}, http.StatusBadRequest, "raw_format_invalid"},
+		{"Unknown format", RawValidateRequest{"bellman", arkVK, arkProof, arkPublic}, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := postJSON(t, validateRawProof, "/validate/raw", tt.req)
+			h.AssertStatusCode(rr, tt.status, tt.name)
+			if tt.code != "" && !strings.Contains(rr.Body.String(), tt.code) {
+				t.Errorf("Expected %s, got %s", tt.code, rr.Body.String())
+			}
+			if tt.status == http.StatusOK && !strings.Contains(rr.Body.String(), `"publicInputs":["100"]`) {
+				t.Errorf("Expected the proven public input, got %s", rr.Body.String())
+			}
+		})
+	}
+}
+
+// TestValidateRawProofVectors verifies the /validate/raw bodies under testdata/rawproof/<format>,
+// each made by the named tool itself rather than converted from a gnark proof
+func TestValidateRawProofVectors(t *testing.T) {
+	h := NewTestHelper(t)
+	for _, format := range []string{formatSnarkJS, formatArkworks} {
+		t.Run(format, func(t *testing.T) {
+			vectors, _ := filepath.Glob(filepath.Join("testdata", "rawproof", format, "*.json"))
+			if len(vectors) == 0 {
+				t.Skipf("no %s vectors in testdata/rawproof/%s", format, format)
+			}
+			for _, path := range vectors {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var req RawValidateRequest
+				if err := json.Unmarshal(data, &req); err != nil || req.Format != format {
+					t.Fatalf("%s: expected a %s request, got format %q, %v", path, format, req.Format, err)
+				}
+				rr := postJSON(t, validateRawProof, "/validate/raw", req)
+				h.AssertStatusCode(rr, http.StatusOK, path)
+			}
+		})
+	}
+}
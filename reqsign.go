@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// Headers of HMAC-signed requests
+const (
+	signatureKeyHeader       = "X-Signature-Key-Id"
+	signatureTimestampHeader = "X-Signature-Timestamp"
+	signatureHeader          = "X-Signature"
+)
+
+var (
+	errSignatureInvalid  = errs.New(errs.Unauthorized, "signature_invalid", "request signature is invalid")
+	errSignatureExpired  = errs.New(errs.Unauthorized, "signature_expired", "request timestamp is outside the replay window")
+	errSignatureReplayed = errs.New(errs.Unauthorized, "signature_replayed", "request signature was already used")
+)
+
+// HMACConfig lists the keys clients may sign requests with
+type HMACConfig struct {
+	KeyIDs []string      // each key is the secret hmac-key-<id>
+	Window time.Duration // how far a request's timestamp may be from the server's clock
+}
+
+// requestVerifier checks HMAC-SHA256 signatures over
+//
+//	METHOD "\n" request URI "\n" hex(SHA-256(body)) "\n" unix timestamp
+//
+// and refuses a signature seen before within the replay window
+type requestVerifier struct {
+	keys   map[string][]byte
+	window time.Duration
+	seen   NonceStore // signatures until they leave the window
+	now    func() time.Time
+}
+
+// signedRequests is the configured verifier; nil ignores signature headers
+var signedRequests *requestVerifier
+
+func newRequestVerifier(cfg HMACConfig, p SecretProvider) (*requestVerifier, error) {
+	if len(cfg.KeyIDs) == 0 {
+		return nil, nil
+	}
+	if cfg.Window <= 0 {
+		return nil, fmt.Errorf("request signing needs a positive replay window, got %s", cfg.Window)
+	}
+	v := &requestVerifier{
+		keys:   make(map[string][]byte, len(cfg.KeyIDs)),
+		window: cfg.Window,
+		seen:   nonces,
+		now:    time.Now,
+	}
+	for _, id := range cfg.KeyIDs {
+		name := "hmac-key-" + id
+		key, err := p.Secret(context.Background(), name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		v.keys[id] = []byte(key)
+	}
+	return v, nil
+}
+
+// signatureBase is the string a request's signature covers
+func signatureBase(method, uri string, body []byte, timestamp string) string {
+	sum := sha256.Sum256(body)
+	return method + "\n" + uri + "\n" + hex.EncodeToString(sum[:]) + "\n" + timestamp
+}
+
+// hmacSignature returns the hex HMAC-SHA256 of base under key
+func hmacSignature(key []byte, base string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(base))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verify checks the signature of r, leaving its body readable
+func (v *requestVerifier) verify(w http.ResponseWriter, r *http.Request) error {
+	key, ok := v.keys[r.Header.Get(signatureKeyHeader)]
+	if !ok {
+		return fmt.Errorf("%w: unknown key id", errSignatureInvalid)
+	}
+	timestamp := r.Header.Get(signatureTimestampHeader)
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: malformed timestamp", errSignatureInvalid)
+	}
+	now := v.now()
+	signed := time.Unix(unix, 0)
+	if signed.Before(now.Add(-v.window)) || signed.After(now.Add(v.window)) {
+		return errSignatureExpired
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes))
+	if err != nil {
+		return describeDecodeError(err)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	signature := r.Header.Get(signatureHeader)
+	expected := hmacSignature(key, signatureBase(r.Method, r.URL.RequestURI(), body, timestamp))
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return errSignatureInvalid
+	}
+
+	// Timestamps up to window ahead are accepted, so remember the signature until it is window behind
+	fresh, err := v.seen.Put(r.Context(), nonceSignature+signature, nil, signed.Add(v.window))
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return errSignatureReplayed
+	}
+	return nil
+}
+
+// middleware verifies requests carrying a signature key id; unsigned requests pass
+func (v *requestVerifier) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(signatureKeyHeader) != "" {
+			if err := v.verify(w, r); err != nil {
+				w.Header().Set("WWW-Authenticate", `HMAC-SHA256`)
+				writeError(w, err)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isSignedRequest reports whether r passed signature verification. The middleware refuses
+// every request with a key id it cannot verify, so a key id that reaches a handler is genuine.
+func isSignedRequest(r *http.Request) bool {
+	return signedRequests != nil && r.Header.Get(signatureKeyHeader) != ""
+}
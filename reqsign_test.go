@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func signedRequest(method, uri, body, keyID string, key []byte, at time.Time) *http.Request {
+	req := httptest.NewRequest(method, uri, bytes.NewBufferString(body))
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	req.Header.Set(signatureKeyHeader, keyID)
+	req.Header.Set(signatureTimestampHeader, timestamp)
+	req.Header.Set(signatureHeader, hmacSignature(key, signatureBase(method, uri, []byte(body), timestamp)))
+	return req
+}
+
+func TestRequestSignatures(t *testing.T) {
+	t.Setenv("ZK_HMAC_KEY_ACME", "acme-secret")
+	v, err := newRequestVerifier(HMACConfig{KeyIDs: []string{"acme"}, Window: 5 * time.Minute}, envSecrets{})
+	if err != nil {
+		t.Fatalf("Failed to configure request signing: %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	v.now = func() time.Time { return now }
+	store := newMemoryNonceStore(100, v.now)
+	v.seen = store
+	h := NewTestHelper(t)
+
+	var received string
+	handler := v.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = string(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	key := []byte("acme-secret")
+	body := `{"id":"alice","amount":100}`
+	replayed := signedRequest("POST", "/store/sum", body, "acme", key, now)
+	handler.ServeHTTP(httptest.NewRecorder(), signedRequest("POST", "/store/sum", body, "acme", key, now))
+
+	tampered := signedRequest("POST", "/store/sum", body, "acme", key, now.Add(time.Second))
+	tampered.Body = io.NopCloser(bytes.NewBufferString(`{"id":"alice","amount":999}`))
+	otherPath := signedRequest("POST", "/store/sum", body, "acme", key, now.Add(2*time.Second))
+	otherPath.URL.Path = "/store/credit-score"
+
+	tests := []struct {
+		name   string
+		req    *http.Request
+		status int
+		code   string
+	}{
+		{"Unsigned", httptest.NewRequest("POST", "/store/sum", bytes.NewBufferString(body)), http.StatusOK, ""},
+		{"Signed", signedRequest("POST", "/store/sum?x=1", body, "acme", key, now.Add(-time.Minute)), http.StatusOK, ""},
+		{"Replayed", replayed, http.StatusUnauthorized, "signature_replayed"},
+		{"Tampered body", tampered, http.StatusUnauthorized, "signature_invalid"},
+		{"Other path", otherPath, http.StatusUnauthorized, "signature_invalid"},
+		{"Wrong key", signedRequest("POST", "/store/sum", body, "acme", []byte("guess"), now), http.StatusUnauthorized, "signature_invalid"},
+		{"Unknown key id", signedRequest("POST", "/store/sum", body, "other", key, now), http.StatusUnauthorized, "signature_invalid"},
+		{"Too old", signedRequest("POST", "/store/sum", body, "acme", key, now.Add(-6*time.Minute)), http.StatusUnauthorized, "signature_expired"},
+		{"Too far ahead", signedRequest("POST", "/store/sum", body, "acme", key, now.Add(6*time.Minute)), http.StatusUnauthorized, "signature_expired"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received = ""
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, tt.req)
+			h.AssertStatusCode(rr, tt.status, tt.name)
+			if tt.code != "" && !bytes.Contains(rr.Body.Bytes(), []byte(`"code":"`+tt.code+`"`)) {
+				t.Errorf("Expected code %s, got %s", tt.code, rr.Body.String())
+			}
+			if tt.status == http.StatusOK && received != body {
+				t.Errorf("Expected the handler to read the body, got %q", received)
+			}
+		})
+	}
+
+	if n := store.sweep(now.Add(10 * time.Minute)); n != 2 {
+		t.Errorf("Expected both used signatures to be forgotten, swept %d", n)
+	}
+}
+
+func TestSignedRequestsSatisfyRequiredTokens(t *testing.T) {
+	t.Setenv("ZK_HMAC_KEY_ACME", "acme-secret")
+	v, err := newRequestVerifier(HMACConfig{KeyIDs: []string{"acme"}, Window: 5 * time.Minute}, envSecrets{})
+	if err != nil {
+		t.Fatalf("Failed to configure request signing: %v", err)
+	}
+	previous := signedRequests
+	signedRequests = v
+	t.Cleanup(func() { signedRequests = previous })
+	withTokenValidator(t, &jwtValidator{}, true)
+	h := NewTestHelper(t)
+
+	handler := v.middleware(requireScope(scopeBalancesWrite, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, signedRequest("POST", "/store/sum", `{}`, "acme", []byte("acme-secret"), time.Now()))
+	h.AssertStatusCode(rr, http.StatusOK, "signed request")
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/store/sum", bytes.NewBufferString(`{}`)))
+	h.AssertStatusCode(rr, http.StatusUnauthorized, "unsigned request")
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// revokedProofs maps the digests of revoked proofs to their revocation time
+var (
+	revokedProofs   = make(map[string]time.Time)
+	revokedProofsMu sync.RWMutex
+)
+
+func isRevoked(digest string) bool {
+	revokedProofsMu.RLock()
+	defer revokedProofsMu.RUnlock()
+	_, revoked := revokedProofs[digest]
+	return revoked
+}
+
+type RevocationResponse struct {
+	Digest    string    `json:"digest"`
+	RevokedAt time.Time `json:"revokedAt"`
+}
+
+// revokeProof marks an issued proof as revoked; revoking twice keeps the original time
+func revokeProof(w http.ResponseWriter, r *http.Request) {
+	digest := r.PathValue("digest")
+	if err := validateArtifactRef(artifactProof, digest); err != nil {
+		writeError(w, errs.Wrap(errs.Invalid, err))
+		return
+	}
+
+	revokedProofsMu.Lock()
+	revokedAt, ok := revokedProofs[digest]
+	if !ok {
+		revokedAt = time.Now().UTC()
+		revokedProofs[digest] = revokedAt
+	}
+	revokedProofsMu.Unlock()
+
+	if !ok {
+		audit.record(AuditEvent{Type: auditProofRevoked, Digest: digest})
+	}
+
+	writeJSON(w, RevocationResponse{Digest: digest, RevokedAt: revokedAt})
+}
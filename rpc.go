@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// JSON-RPC 2.0 error codes
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcInternalError  = -32603
+
+	// Application-defined codes
+	rpcBalanceNotFound   = -32001
+	rpcTimeout           = -32002
+	rpcInsufficientScope = -32003
+	rpcNotAllowed        = -32004
+	rpcUserProofLimit    = -32005
+)
+
+// maxRPCBatchSize bounds the number of calls in one batch since proving is expensive
+const maxRPCBatchSize = 20
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// ProveResult is the JSON-RPC result of zk_prove
+type ProveResult struct {
+	Proof        groth16.Proof `json:"proof"`
+	Digest       string        `json:"digest,omitempty"`
+	NeededAmount int           `json:"neededAmount"` // threshold the proof states, rounded up with ZK_ROUND_THRESHOLDS
+}
+
+// ValidateResult is the JSON-RPC result of zk_validate
+type ValidateResult struct {
+	Valid bool `json:"valid"`
+}
+
+// rpcMethods maps JSON-RPC method names to their implementations
+var rpcMethods = map[string]func(ctx context.Context, params json.RawMessage) (interface{}, *rpcError){
+	"zk_prove":    rpcProve,
+	"zk_validate": rpcValidate,
+}
+
+// rpcScopes is the scope a bearer token needs for each method
+var rpcScopes = map[string]string{
+	"zk_prove":    scopeProofsGenerate,
+	"zk_validate": scopeProofsVerify,
+}
+
+// handleRPC serves JSON-RPC 2.0 calls, including batches, on a single route
+func handleRPC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, errs.Errorf(errs.MethodNotAllowed, "method not allowed"))
+		return
+	}
+	// Scopes are checked per call, so a batch may mix methods a token is allowed
+	token, ok := authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	r = r.WithContext(withAccessToken(r.Context(), token))
+	ctx := withTenant(r.Context(), tenantID(r))
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes))
+	if err != nil {
+		writeJSON(w, rpcResponse{JSONRPC: "2.0", Error: &rpcError{rpcParseError, describeDecodeError(err).Error()}, ID: nullID})
+		return
+	}
+
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(body, &batch); err != nil {
+			writeJSON(w, rpcResponse{JSONRPC: "2.0", Error: &rpcError{rpcParseError, "parse error"}, ID: nullID})
+			return
+		}
+		if len(batch) == 0 {
+			writeJSON(w, rpcResponse{JSONRPC: "2.0", Error: &rpcError{rpcInvalidRequest, "empty batch"}, ID: nullID})
+			return
+		}
+		if len(batch) > maxRPCBatchSize {
+			writeJSON(w, rpcResponse{JSONRPC: "2.0", Error: &rpcError{rpcInvalidRequest, "batch too large"}, ID: nullID})
+			return
+		}
+
+		responses := make([]rpcResponse, 0, len(batch))
+		for _, raw := range batch {
+			if resp, ok := dispatchRPC(ctx, token, raw); ok {
+				responses = append(responses, resp)
+			}
+		}
+
+		// A batch made only of notifications gets no response body
+		if len(responses) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeJSON(w, responses)
+		return
+	}
+
+	resp, ok := dispatchRPC(ctx, token, body)
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, resp)
+}
+
+var nullID = json.RawMessage("null")
+
+// dispatchRPC executes a single call. The boolean is false for notifications,
+// which must not produce a response. A non-nil token must grant the method's scope.
+func dispatchRPC(ctx context.Context, token *accessToken, raw json.RawMessage) (rpcResponse, bool) {
+	var req rpcRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return rpcResponse{JSONRPC: "2.0", Error: &rpcError{rpcParseError, "parse error"}, ID: nullID}, true
+		}
+		return rpcResponse{JSONRPC: "2.0", Error: &rpcError{rpcInvalidRequest, "invalid request"}, ID: nullID}, true
+	}
+
+	id := req.ID
+	if id == nil {
+		id = nullID
+	}
+
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return rpcResponse{JSONRPC: "2.0", Error: &rpcError{rpcInvalidRequest, "invalid request"}, ID: id}, true
+	}
+
+	method, found := rpcMethods[req.Method]
+	if !found {
+		return rpcResponse{JSONRPC: "2.0", Error: &rpcError{rpcMethodNotFound, "method not found"}, ID: id}, req.ID != nil
+	}
+	if token != nil && !token.has(rpcScopes[req.Method]) {
+		return rpcResponse{JSONRPC: "2.0", Error: &rpcError{rpcInsufficientScope, "insufficient scope: needs " + rpcScopes[req.Method]}, ID: id}, req.ID != nil
+	}
+
+	result, rpcErr := method(withTokenLane(ctx, token), req.Params)
+	if req.ID == nil {
+		return rpcResponse{}, false
+	}
+	if rpcErr != nil {
+		return rpcResponse{JSONRPC: "2.0", Error: rpcErr, ID: id}, true
+	}
+	return rpcResponse{JSONRPC: "2.0", Result: result, ID: id}, true
+}
+
+// decodeParams strictly decodes by-name params into dst
+func decodeParams(params json.RawMessage, dst interface{}) *rpcError {
+	if len(params) == 0 {
+		return &rpcError{rpcInvalidParams, "params are required"}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(params))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		return &rpcError{rpcInvalidParams, describeDecodeError(err).Error()}
+	}
+	return nil
+}
+
+func rpcProve(ctx context.Context, params json.RawMessage) (interface{}, *rpcError) {
+	var req ProofRequest
+	if rpcErr := decodeParams(params, &req); rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	circuit, err := balanceCircuitFor(req.Comparison, req.Preset)
+	if err != nil {
+		return nil, &rpcError{rpcInvalidParams, err.Error()}
+	}
+	if req.NeededAmount, err = roundThreshold(req.NeededAmount); err != nil {
+		return nil, &rpcError{rpcInvalidParams, err.Error()}
+	}
+	if err := tenantAccess.check(tenantOf(ctx), circuit, int64(req.NeededAmount)); err != nil {
+		return nil, &rpcError{rpcNotAllowed, err.Error()}
+	}
+
+	observeThreshold(tenantOf(ctx), req.ID, circuit, int64(req.NeededAmount))
+	proof, digest, err := proveComparison(ctx, defaultCurve, circuit, req.ID, req.NeededAmount)
+	if errors.Is(err, errBalanceNotFound) {
+		return nil, &rpcError{rpcBalanceNotFound, err.Error()}
+	}
+	if errors.Is(err, errUserProofLimit) {
+		return nil, &rpcError{rpcUserProofLimit, err.Error()}
+	}
+	if isContextError(err) {
+		return nil, &rpcError{rpcTimeout, err.Error()}
+	}
+	if err != nil {
+		return nil, &rpcError{rpcInternalError, err.Error()}
+	}
+
+	return ProveResult{Proof: proof, Digest: digest, NeededAmount: req.NeededAmount}, nil
+}
+
+func rpcValidate(ctx context.Context, params json.RawMessage) (interface{}, *rpcError) {
+	var req ValidateRequest
+	if rpcErr := decodeParams(params, &req); rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	circuit, err := balanceCircuitFor(req.Comparison, req.Preset)
+	if err != nil {
+		return nil, &rpcError{rpcInvalidParams, err.Error()}
+	}
+	if err := tenantAccess.check(tenantOf(ctx), circuit, int64(req.NeededAmount)); err != nil {
+		return nil, &rpcError{rpcNotAllowed, err.Error()}
+	}
+
+	curve, err := verifyCurve(req.Curve, circuit)
+	if err != nil {
+		return nil, &rpcError{rpcInvalidParams, err.Error()}
+	}
+	proof, err := decodeProof(curve, req.GnarkVersion, req.Proof)
+	if err != nil {
+		return nil, &rpcError{rpcInvalidParams, "invalid proof format: " + err.Error()}
+	}
+
+	err = comparisonVerifier(circuit, req.DryRun)(ctx, curve, proof, req.NeededAmount)
+	if errors.Is(err, errInvalidProof) {
+		return ValidateResult{Valid: false}, nil
+	}
+	if isContextError(err) {
+		return nil, &rpcError{rpcTimeout, err.Error()}
+	}
+	if err != nil {
+		return nil, &rpcError{rpcInternalError, err.Error()}
+	}
+
+	return ValidateResult{Valid: true}, nil
+}
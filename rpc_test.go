@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func callRPC(t *testing.T, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/rpc", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	handleRPC(rr, req)
+	return rr
+}
+
+func TestRPCErrors(t *testing.T) {
+	NewTestHelper(t).SetupCleanBalances()
+
+	tests := []struct {
+		name         string
+		body         string
+		expectedCode int
+		expectedID   string
+	}{
+		{"Parse error", `{"jsonrpc": "2.0", "method": `, rpcParseError, "null"},
+		{"Wrong version", `{"jsonrpc": "1.0", "method": "zk_prove", "id": 1}`, rpcInvalidRequest, "1"},
+		{"Method not found", `{"jsonrpc": "2.0", "method": "zk_unknown", "id": "a"}`, rpcMethodNotFound, `"a"`},
+		{"Missing params", `{"jsonrpc": "2.0", "method": "zk_prove", "id": 2}`, rpcInvalidParams, "2"},
+		{"Unknown param", `{"jsonrpc": "2.0", "method": "zk_prove", "params": {"id": "x", "amount": 1}, "id": 3}`, rpcInvalidParams, "3"},
+		{"Balance not found", `{"jsonrpc": "2.0", "method": "zk_prove", "params": {"id": "nobody", "neededAmount": 1}, "id": 4}`, rpcBalanceNotFound, "4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := callRPC(t, tt.body)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected HTTP 200, got %d", rr.Code)
+			}
+
+			var resp rpcResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.Error == nil {
+				t.Fatalf("Expected error response, got %s", rr.Body.String())
+			}
+			if resp.Error.Code != tt.expectedCode {
+				t.Errorf("Expected error code %d, got %d (%s)", tt.expectedCode, resp.Error.Code, resp.Error.Message)
+			}
+			if string(resp.ID) != tt.expectedID {
+				t.Errorf("Expected id %s, got %s", tt.expectedID, resp.ID)
+			}
+		})
+	}
+}
+
+func TestRPCNotification(t *testing.T) {
+	rr := callRPC(t, `{"jsonrpc": "2.0", "method": "zk_unknown"}`)
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("Expected HTTP 204 for notification, got %d", rr.Code)
+	}
+	if rr.Body.Len() != 0 {
+		t.Errorf("Expected empty body, got %s", rr.Body.String())
+	}
+}
+
+func TestRPCBatch(t *testing.T) {
+	t.Run("Mixed batch", func(t *testing.T) {
+		rr := callRPC(t, `[
+			{"jsonrpc": "2.0", "method": "zk_unknown", "id": 1},
+			{"jsonrpc": "2.0", "method": "zk_unknown"},
+			{"foo": "bar"},
+			{"jsonrpc": "2.0", "method": "zk_prove", "id": 2}
+		]`)
+
+		var responses []rpcResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &responses); err != nil {
+			t.Fatalf("Failed to decode batch response: %v", err)
+		}
+		if len(responses) != 3 {
+			t.Fatalf("Expected 3 responses (notification omitted), got %d", len(responses))
+		}
+
+		expected := []int{rpcMethodNotFound, rpcInvalidRequest, rpcInvalidParams}
+		for i, resp := range responses {
+			if resp.Error == nil || resp.Error.Code != expected[i] {
+				t.Errorf("Response %d: expected error code %d, got %+v", i, expected[i], resp.Error)
+			}
+		}
+	})
+
+	t.Run("Empty batch", func(t *testing.T) {
+		var resp rpcResponse
+		if err := json.Unmarshal(callRPC(t, `[]`).Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if resp.Error == nil || resp.Error.Code != rpcInvalidRequest {
+			t.Errorf("Expected invalid request error, got %+v", resp.Error)
+		}
+	})
+}
+
+func TestRPCProve(t *testing.T) {
+	SkipIfShort(t, "JSON-RPC proof generation")
+
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+	h.AssertStatusCode(h.StoreBalance("rpc_user", 150), http.StatusOK, "storing balance")
+
+	rr := callRPC(t, `{"jsonrpc": "2.0", "method": "zk_prove", "params": {"id": "rpc_user", "neededAmount": 100}, "id": 7}`)
+
+	var resp struct {
+		Result map[string]interface{} `json:"result"`
+		Error  *rpcError              `json:"error"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Error != nil {
+		t.Fatalf("Expected success, got error %+v", resp.Error)
+	}
+	if resp.Result["proof"] == nil {
+		t.Error("Expected proof in result")
+	}
+	if resp.Result["digest"] == nil {
+		t.Error("Expected digest in result")
+	}
+}
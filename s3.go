@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3Config configures an S3-compatible object storage backend (AWS S3, MinIO, R2, ...)
+type S3Config struct {
+	Endpoint  string // e.g. https://s3.eu-west-1.amazonaws.com or http://minio:9000
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool   // address the bucket in the path instead of the host name
+	Prefix    string // optional key prefix inside the bucket
+}
+
+// s3ArtifactStore stores artifacts as objects signed with AWS Signature Version 4.
+// Nothing is kept on local disk; objects are fetched lazily when requested.
+type s3ArtifactStore struct {
+	cfg    S3Config
+	base   *url.URL
+	client *http.Client
+	now    func() time.Time
+}
+
+func newS3ArtifactStore(cfg S3Config) (*s3ArtifactStore, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" || cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, errors.New("s3 backend requires endpoint, bucket, access key and secret key")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+
+	base, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint: %w", err)
+	}
+
+	return &s3ArtifactStore{
+		cfg:    cfg,
+		base:   base,
+		client: &http.Client{Timeout: 30 * time.Second},
+		now:    time.Now,
+	}, nil
+}
+
+func (s *s3ArtifactStore) objectKey(kind, digest string) string {
+	return s.cfg.Prefix + kind + "/" + digest
+}
+
+// objectURL returns the URL of an object using path-style or virtual-hosted addressing
+func (s *s3ArtifactStore) objectURL(key string) *url.URL {
+	u := *s.base
+	if s.cfg.PathStyle {
+		u.Path = "/" + s.cfg.Bucket + "/" + key
+	} else {
+		u.Host = s.cfg.Bucket + "." + s.base.Host
+		u.Path = "/" + key
+	}
+	return &u
+}
+
+func (s *s3ArtifactStore) Put(ctx context.Context, kind string, data []byte) (string, error) {
+	digest := artifactDigest(data)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(s.objectKey(kind, digest)).String(), bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	s.sign(req, hashHex(data))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("s3 put %s: %s: %s", digest, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return digest, nil
+}
+
+func (s *s3ArtifactStore) Get(ctx context.Context, kind, digest string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.objectURL(s.objectKey(kind, digest)).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, hashHex(nil))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errArtifactNotFound
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("s3 get %s: %s", digest, resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return checkArtifact(digest, data)
+}
+
+func (s *s3ArtifactStore) Delete(ctx context.Context, kind, digest string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.objectURL(s.objectKey(kind, digest)).String(), nil)
+	if err != nil {
+		return err
+	}
+	s.sign(req, hashHex(nil))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// S3 answers 204 whether or not the object existed
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("s3 delete %s: %s", digest, resp.Status)
+	}
+	return nil
+}
+
+// Ping sends a HEAD request for the bucket to check connectivity and credentials
+func (s *s3ArtifactStore) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, s.objectURL("").String(), nil)
+	if err != nil {
+		return err
+	}
+	s.sign(req, hashHex(nil))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("s3 head bucket %s: %s", s.cfg.Bucket, resp.Status)
+	}
+	return nil
+}
+
+// SignedURL returns a presigned GET URL for the object, valid for ttl
+func (s *s3ArtifactStore) SignedURL(kind, digest string, ttl time.Duration) (string, error) {
+	return s.presign(http.MethodGet, s.objectKey(kind, digest), ttl), nil
+}
+
+func (s *s3ArtifactStore) presign(method, key string, ttl time.Duration) string {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	v4 := s.sigV4()
+	scope := v4.scope(now)
+
+	u := s.objectURL(key)
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", s.cfg.AccessKey+"/"+scope)
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", strconv.Itoa(int(ttl.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		uriEncode(u.Path, false),
+		canonicalQuery(query),
+		"host:" + u.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+
+	u.RawQuery = canonicalQuery(query) + "&X-Amz-Signature=" + v4.signature(now, amzDate, scope, canonicalRequest)
+	return u.String()
+}
+
+// sign adds SigV4 authorization headers to req
+func (s *s3ArtifactStore) sign(req *http.Request, payloadHash string) {
+	s.sigV4().sign(req, payloadHash, s.now())
+}
+
+func (s *s3ArtifactStore) sigV4() sigV4 {
+	return sigV4{AccessKey: s.cfg.AccessKey, SecretKey: s.cfg.SecretKey, Region: s.cfg.Region, Service: "s3"}
+}
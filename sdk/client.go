@@ -0,0 +1,109 @@
+// Package sdk is a Go client for the zkTest1 API.
+//
+// The request and response types and the Client methods in zz_generated.go are generated from
+// the server's endpoint definitions; run make sdk after changing them.
+package sdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// maxErrorBytes bounds the error bodies read from the server
+const maxErrorBytes = 64 << 10
+
+// Client calls a zkTest1 server. Calls are sent once; set HTTPClient to a client with a Transport
+// to retry them.
+type Client struct {
+	BaseURL    string // e.g. https://zk.example.com
+	HTTPClient *http.Client
+	Token      string // OAuth access token sent as a bearer token, if set
+}
+
+// New returns a client for the server at baseURL using http.DefaultClient
+func New(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/"), HTTPClient: http.DefaultClient}
+}
+
+// Error is an error response of the server
+type Error struct {
+	Status    int
+	Code      string // e.g. proof_invalid
+	Message   string
+	RequestID string
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("zkTest1: %d %s", e.Status, e.Message)
+	}
+	return fmt.Sprintf("zkTest1: %d %s: %s", e.Status, e.Code, e.Message)
+}
+
+// do sends in as the JSON body of a request and decodes a successful response into out.
+// Either may be nil.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out any) error {
+	target := c.BaseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	if key := idempotencyKeyOf(ctx); key != "" {
+		req.Header.Set(idempotencyKeyHeader, key)
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBytes))
+		var envelope struct {
+			Error     string `json:"error"`
+			Code      string `json:"code"`
+			RequestID string `json:"requestId"`
+		}
+		apiErr := &Error{Status: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+		if json.Unmarshal(data, &envelope) == nil && envelope.Error != "" {
+			apiErr.Code, apiErr.Message, apiErr.RequestID = envelope.Code, envelope.Error, envelope.RequestID
+		}
+		return apiErr
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("zkTest1: decoding %s %s: %w", method, path, err)
+	}
+	return nil
+}
@@ -0,0 +1,265 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// idempotencyKeyHeader carries the key set with WithIdempotencyKey, the same on every attempt
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// ErrCircuitOpen is returned without calling the server while a CircuitBreaker is open
+var ErrCircuitOpen = errors.New("zkTest1: circuit breaker open after repeated server failures")
+
+type idempotencyKey struct{}
+
+// WithIdempotencyKey returns a context whose calls send key as Idempotency-Key. The key marks a
+// call as safe to repeat, so a Transport retries it whatever its method.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+func idempotencyKeyOf(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKey{}).(string)
+	return key
+}
+
+// RetryPolicy says how often and how soon a Transport repeats a failed request
+type RetryPolicy struct {
+	MaxAttempts    int           // attempts per request including the first; 0 or 1 disables retries
+	BaseDelay      time.Duration // delay before the first retry, doubled for each further one
+	MaxDelay       time.Duration // longest delay; a longer Retry-After of the server ends the retries
+	AttemptTimeout time.Duration // time allowed for each attempt; 0 leaves it to the context
+}
+
+// DefaultRetryPolicy makes up to four attempts, waiting about a second and a half in all
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 4, BaseDelay: 250 * time.Millisecond, MaxDelay: 10 * time.Second}
+
+// delay is the backoff before retry n, counting from 1, with half of it jittered so clients
+// that failed together do not retry together
+func (p RetryPolicy) delay(n int) time.Duration {
+	d := p.BaseDelay << (n - 1)
+	if d <= 0 || (p.MaxDelay > 0 && d > p.MaxDelay) {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// Transport is an http.RoundTripper that retries transient failures and stops calling a server
+// that keeps failing. Set it as the Transport of Client.HTTPClient.
+//
+// Answers 429 are retried for every request, as the server refused them before doing any work,
+// and answers 409 with Retry-After for requests with an Idempotency-Key whose first attempt is
+// still running.
+// Network errors and answers 502, 503 and 504 are retried for GET, HEAD, OPTIONS, PUT and DELETE
+// requests, and for requests with an Idempotency-Key: a POST may have been carried out before it
+// failed.
+type Transport struct {
+	Base    http.RoundTripper // http.DefaultTransport when nil
+	Retry   RetryPolicy
+	Breaker *CircuitBreaker // optional; shared by every request of the transport
+}
+
+// NewTransport returns a transport with DefaultRetryPolicy and a breaker that opens after five
+// failures in a row for thirty seconds
+func NewTransport() *Transport {
+	return &Transport{Retry: DefaultRetryPolicy, Breaker: NewCircuitBreaker(5, 30*time.Second)}
+}
+
+// sleep waits d unless ctx ends first; tests replace it
+var sleep = func(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// RoundTrip sends req, repeating it as the retry policy allows
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	repeatable := req.Header.Get(idempotencyKeyHeader) != ""
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		repeatable = true
+	}
+	// A body that cannot be read again cannot be sent again
+	canRetry := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+
+	for attempt := 1; ; attempt++ {
+		if t.Breaker != nil && !t.Breaker.allow() {
+			return nil, ErrCircuitOpen
+		}
+		resp, err := t.attempt(base, req, attempt)
+		if err != nil && req.Context().Err() != nil {
+			// The caller gave up, which says nothing about the server
+			if t.Breaker != nil {
+				t.Breaker.record(false, true)
+			}
+			return nil, err
+		}
+		failed := err != nil || transientStatus(resp.StatusCode)
+		if t.Breaker != nil {
+			t.Breaker.record(failed, false)
+		}
+
+		retry := canRetry && attempt < t.Retry.MaxAttempts &&
+			((err == nil && resp.StatusCode == http.StatusTooManyRequests) || (failed && repeatable) || inProgress(req, resp))
+		if !retry {
+			return resp, err
+		}
+
+		delay := t.Retry.delay(attempt)
+		if resp != nil {
+			if after, ok := retryAfter(resp); ok {
+				if t.Retry.MaxDelay > 0 && after > t.Retry.MaxDelay {
+					return resp, nil // the caller learns when to come back
+				}
+				delay = max(delay, after)
+			}
+			io.Copy(io.Discard, io.LimitReader(resp.Body, maxErrorBytes))
+			resp.Body.Close()
+		}
+		if err := sleep(req.Context(), delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// attempt sends req once, with a fresh body for repeats and the policy's timeout
+func (t *Transport) attempt(base http.RoundTripper, req *http.Request, n int) (*http.Response, error) {
+	ctx, cancel := req.Context(), context.CancelFunc(func() {})
+	if t.Retry.AttemptTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, t.Retry.AttemptTimeout)
+	}
+	attempt := req.WithContext(ctx)
+	if n > 1 && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		attempt.Body = body
+	}
+	resp, err := base.RoundTrip(attempt)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// The timeout covers reading the body too, so it is only released with the body
+	resp.Body = cancelOnClose{resp.Body, cancel}
+	return resp, nil
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// transientStatus reports whether an answer says the server or a proxy before it is failing for
+// now, such as when all proving workers are busy
+func transientStatus(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
+
+// inProgress reports whether the server answered a request with an Idempotency-Key that an
+// earlier attempt with the key is still running, so the attempt's answer can be fetched later
+func inProgress(req *http.Request, resp *http.Response) bool {
+	return resp != nil && resp.StatusCode == http.StatusConflict &&
+		req.Header.Get(idempotencyKeyHeader) != "" && resp.Header.Get("Retry-After") != ""
+}
+
+// retryAfter reads a Retry-After header in seconds
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// CircuitBreaker stops calls to a server after a run of failures, so clients do not add load to
+// a saturated server. Once Cooldown has passed one call is let through; the breaker closes when
+// it succeeds and stays open for another Cooldown when it fails.
+type CircuitBreaker struct {
+	Failures int           // failures in a row that open the breaker
+	Cooldown time.Duration // how long an open breaker refuses calls
+
+	now func() time.Time // time.Now when nil
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool // a call is testing whether the server recovered
+}
+
+// NewCircuitBreaker returns a breaker that opens after failures failures in a row for cooldown
+func NewCircuitBreaker(failures int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{Failures: failures, Cooldown: cooldown}
+}
+
+func (b *CircuitBreaker) clock() time.Time {
+	if b.now == nil {
+		return time.Now()
+	}
+	return b.now()
+}
+
+// Open reports whether the breaker currently refuses calls
+func (b *CircuitBreaker) Open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.Failures > 0 && b.failures >= b.Failures && (b.probing || b.clock().Before(b.openUntil))
+}
+
+func (b *CircuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.Failures <= 0 || b.failures < b.Failures {
+		return true
+	}
+	if b.probing || b.clock().Before(b.openUntil) {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// record counts the outcome of a call; an abandoned one only lets the next call through
+func (b *CircuitBreaker) record(failed, abandoned bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if abandoned {
+		return
+	}
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.Failures > 0 && b.failures >= b.Failures {
+		b.openUntil = b.clock().Add(b.Cooldown)
+	}
+}
@@ -0,0 +1,160 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func withoutSleep(t *testing.T) *[]time.Duration {
+	t.Helper()
+	var slept []time.Duration
+	previous := sleep
+	sleep = func(_ context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		return nil
+	}
+	t.Cleanup(func() { sleep = previous })
+	return &slept
+}
+
+// failingServer answers each request with the next status of statuses, then 200
+func failingServer(t *testing.T, statuses ...int) (*httptest.Server, *[]*http.Request) {
+	t.Helper()
+	var mu sync.Mutex
+	var seen []*http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		seen = append(seen, r)
+		if len(seen) <= len(statuses) {
+			if status := statuses[len(seen)-1]; status == http.StatusTooManyRequests || status == http.StatusConflict {
+				w.Header().Set("Retry-After", "2")
+			}
+			w.WriteHeader(statuses[len(seen)-1])
+			w.Write([]byte(`{"error":"busy","code":"unavailable"}`))
+			return
+		}
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &seen
+}
+
+func TestTransportRetries(t *testing.T) {
+	slept := withoutSleep(t)
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: 100 * time.Millisecond, MaxDelay: 5 * time.Second}
+
+	t.Run("GET", func(t *testing.T) {
+		*slept = nil
+		srv, seen := failingServer(t, http.StatusServiceUnavailable, http.StatusBadGateway)
+		client := &Client{BaseURL: srv.URL, HTTPClient: &http.Client{Transport: &Transport{Retry: policy}}}
+		if err := client.do(context.Background(), http.MethodGet, "/health", nil, nil, nil); err != nil {
+			t.Fatalf("Expected the third attempt to succeed, got %v", err)
+		}
+		if len(*seen) != 3 {
+			t.Errorf("Expected 3 attempts, got %d", len(*seen))
+		}
+		for i, d := range *slept {
+			if base := policy.BaseDelay << i; d < base/2 || d > base {
+				t.Errorf("Expected retry %d after %v to %v, got %v", i+1, base/2, base, d)
+			}
+		}
+	})
+
+	t.Run("POST without a key", func(t *testing.T) {
+		srv, seen := failingServer(t, http.StatusServiceUnavailable)
+		client := &Client{BaseURL: srv.URL, HTTPClient: &http.Client{Transport: &Transport{Retry: policy}}}
+		err := client.do(context.Background(), http.MethodPost, "/get/proof/neededAmount", nil, map[string]int{"neededAmount": 1}, nil)
+		var apiErr *Error
+		if !errors.As(err, &apiErr) || apiErr.Status != http.StatusServiceUnavailable || len(*seen) != 1 {
+			t.Errorf("Expected the 503 of a single attempt, got %v after %d", err, len(*seen))
+		}
+	})
+
+	t.Run("POST refused with 429", func(t *testing.T) {
+		*slept = nil
+		srv, seen := failingServer(t, http.StatusTooManyRequests)
+		client := &Client{BaseURL: srv.URL, HTTPClient: &http.Client{Transport: &Transport{Retry: policy}}}
+		if err := client.do(context.Background(), http.MethodPost, "/get/proof/neededAmount", nil, map[string]int{"neededAmount": 1}, nil); err != nil || len(*seen) != 2 {
+			t.Fatalf("Expected a refused request to be retried, got %v after %d", err, len(*seen))
+		}
+		if len(*slept) != 1 || (*slept)[0] != 2*time.Second {
+			t.Errorf("Expected to wait the Retry-After of 2s, waited %v", *slept)
+		}
+	})
+
+	t.Run("POST with a key", func(t *testing.T) {
+		srv, seen := failingServer(t, http.StatusServiceUnavailable, http.StatusGatewayTimeout)
+		client := &Client{BaseURL: srv.URL, HTTPClient: &http.Client{Transport: &Transport{Retry: policy}}}
+		ctx := WithIdempotencyKey(context.Background(), "order-17")
+		if err := client.do(ctx, http.MethodPost, "/get/proof/neededAmount", nil, map[string]int{"neededAmount": 1}, nil); err != nil {
+			t.Fatalf("Expected a request with a key to be retried, got %v", err)
+		}
+		for i, r := range *seen {
+			if key := r.Header.Get("Idempotency-Key"); key != "order-17" || r.ContentLength == 0 {
+				t.Errorf("Attempt %d: expected the key and the body again, got %q and %d bytes", i+1, key, r.ContentLength)
+			}
+		}
+	})
+
+	t.Run("POST with a key still running", func(t *testing.T) {
+		srv, seen := failingServer(t, http.StatusConflict)
+		client := &Client{BaseURL: srv.URL, HTTPClient: &http.Client{Transport: &Transport{Retry: policy}}}
+		post := func(ctx context.Context) error {
+			return client.do(ctx, http.MethodPost, "/get/proof/neededAmount", nil, map[string]int{"neededAmount": 1}, nil)
+		}
+		if err := post(WithIdempotencyKey(context.Background(), "order-18")); err != nil || len(*seen) != 2 {
+			t.Errorf("Expected the answer of the running request to be fetched again, got %v after %d", err, len(*seen))
+		}
+
+		srv, seen = failingServer(t, http.StatusConflict)
+		client.BaseURL = srv.URL
+		var apiErr *Error
+		if err := post(context.Background()); !errors.As(err, &apiErr) || apiErr.Status != http.StatusConflict || len(*seen) != 1 {
+			t.Errorf("Expected a 409 without a key to be returned, got %v after %d", err, len(*seen))
+		}
+	})
+
+	t.Run("Retry-After beyond MaxDelay", func(t *testing.T) {
+		srv, seen := failingServer(t, http.StatusTooManyRequests)
+		short := policy
+		short.MaxDelay = time.Second
+		client := &Client{BaseURL: srv.URL, HTTPClient: &http.Client{Transport: &Transport{Retry: short}}}
+		if err := client.do(context.Background(), http.MethodGet, "/health", nil, nil, nil); err == nil || len(*seen) != 1 {
+			t.Errorf("Expected the 429 to be returned rather than waited out, got %v after %d", err, len(*seen))
+		}
+	})
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	withoutSleep(t)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	breaker := NewCircuitBreaker(2, time.Minute)
+	breaker.now = func() time.Time { return now }
+
+	srv, seen := failingServer(t, http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	client := &Client{BaseURL: srv.URL, HTTPClient: &http.Client{Transport: &Transport{Retry: RetryPolicy{MaxAttempts: 5}, Breaker: breaker}}}
+	call := func() error { return client.do(context.Background(), http.MethodGet, "/health", nil, nil, nil) }
+
+	if err := call(); !errors.Is(err, ErrCircuitOpen) || len(*seen) != 2 || !breaker.Open() {
+		t.Fatalf("Expected the breaker to open after 2 failures, got %v after %d", err, len(*seen))
+	}
+	if err := call(); !errors.Is(err, ErrCircuitOpen) || len(*seen) != 2 {
+		t.Errorf("Expected an open breaker not to call the server, got %v after %d", err, len(*seen))
+	}
+
+	// The trial call after the cooldown fails, so the breaker opens again
+	now = now.Add(time.Minute)
+	if err := call(); !errors.Is(err, ErrCircuitOpen) || len(*seen) != 3 {
+		t.Errorf("Expected one trial call, got %v after %d", err, len(*seen))
+	}
+	now = now.Add(time.Minute)
+	if err := call(); err != nil || breaker.Open() {
+		t.Errorf("Expected a successful trial call to close the breaker, got %v", err)
+	}
+}
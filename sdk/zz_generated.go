@@ -0,0 +1,979 @@
+// Code generated by make sdk from the server's endpoint definitions; DO NOT EDIT.
+
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"time"
+)
+
+type AllowlistResponse struct {
+	Name    string `json:"name"`
+	Root    string `json:"root"`
+	Members int    `json:"members"`
+}
+
+type AttributeDocument struct {
+	Schema     string                     `json:"schema"`
+	Attributes map[string]json.RawMessage `json:"attributes"`
+	Values     map[string]int64           `json:"values,omitempty"`
+}
+
+type AttributeField struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Min      *int64   `json:"min,omitempty"`
+	Max      *int64   `json:"max,omitempty"`
+	Values   []string `json:"values,omitempty"`
+	Required bool     `json:"required,omitempty"`
+}
+
+type AttributeRequest struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Value int64  `json:"value"`
+}
+
+type AttributeSchema struct {
+	Name   string           `json:"name"`
+	Fields []AttributeField `json:"fields"`
+}
+
+type BalanceAttestation struct {
+	ID          string     `json:"id"`
+	Source      string     `json:"source"`
+	Institution string     `json:"institution,omitempty"`
+	AccountID   string     `json:"accountId"`
+	Currency    string     `json:"currency,omitempty"`
+	FetchedAt   time.Time  `json:"fetchedAt"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+	Issuer      string     `json:"issuer,omitempty"`
+	KeyID       string     `json:"kid,omitempty"`
+	Signature   []byte     `json:"signature,omitempty"`
+}
+
+type BalanceRequest struct {
+	ID              string `json:"id"`
+	Amount          int    `json:"amount"`
+	ExpectedVersion *int64 `json:"expectedVersion,omitempty"`
+}
+
+type Bucket struct {
+	Lower int64  `json:"lower"`
+	Upper *int64 `json:"upper,omitempty"`
+	Label string `json:"label"`
+}
+
+type BucketProofRequest struct {
+	ID string `json:"id"`
+}
+
+type BucketProofResponse struct {
+	Bucket Bucket          `json:"bucket"`
+	Proof  json.RawMessage `json:"proof"`
+}
+
+type BucketValidateRequest struct {
+	Lower int64           `json:"lower"`
+	Upper *int64          `json:"upper"`
+	Proof json.RawMessage `json:"proof"`
+	Curve string          `json:"curve,omitempty"`
+}
+
+type BundleHeader struct {
+	Version  int       `json:"version"`
+	Subject  string    `json:"subject,omitempty"`
+	Audience string    `json:"audience,omitempty"`
+	Issuer   string    `json:"issuer,omitempty"`
+	IssuedAt time.Time `json:"issuedAt"`
+}
+
+type BundleMemberResult struct {
+	Index       int     `json:"index"`
+	Circuit     string  `json:"circuit"`
+	Valid       bool    `json:"valid"`
+	Error       string  `json:"error,omitempty"`
+	Issuer      string  `json:"issuer,omitempty"`
+	VerifyingMs float64 `json:"verifyingMs"`
+}
+
+type BundleValidateResponse struct {
+	Manifest string               `json:"manifest"`
+	Issuer   string               `json:"issuer,omitempty"`
+	Valid    bool                 `json:"valid"`
+	Members  []BundleMemberResult `json:"members"`
+}
+
+type Challenge struct {
+	Mode       string    `json:"mode"`
+	Challenge  string    `json:"challenge,omitempty"`
+	Difficulty int       `json:"difficulty,omitempty"`
+	ExpiresAt  time.Time `json:"expiresAt,omitempty"`
+}
+
+type CircuitProofRequest struct {
+	ID       string          `json:"id"`
+	Inputs   json.RawMessage `json:"inputs,omitempty"`
+	Audience string          `json:"audience,omitempty"`
+}
+
+type CircuitProofResponse struct {
+	Circuit string          `json:"circuit"`
+	Proof   json.RawMessage `json:"proof"`
+}
+
+type CircuitSchema struct {
+	Circuit      string            `json:"circuit"`
+	Curve        string            `json:"curve"`
+	ScalarField  string            `json:"scalarField"`
+	PublicInputs []PublicInput     `json:"publicInputs"`
+	Encoding     WitnessEncoding   `json:"encoding"`
+	Presets      map[string]string `json:"presets,omitempty"`
+}
+
+type CommitThresholdRequest struct {
+	Threshold int `json:"threshold"`
+}
+
+type CommitThresholdResponse struct {
+	Commitment string `json:"commitment"`
+	Salt       string `json:"salt"`
+}
+
+type CommittedProofRequest struct {
+	ID         string `json:"id"`
+	Commitment string `json:"commitment"`
+	Threshold  int    `json:"threshold"`
+	Salt       string `json:"salt"`
+}
+
+type CommittedValidateRequest struct {
+	Commitment string          `json:"commitment"`
+	Proof      json.RawMessage `json:"proof"`
+}
+
+type CompositeProofRequest struct {
+	ID         string          `json:"id"`
+	Predicates []PredicateSpec `json:"predicates"`
+	Audience   string          `json:"audience,omitempty"`
+}
+
+type CompositeProofResponse struct {
+	Policy string          `json:"policy"`
+	Proof  json.RawMessage `json:"proof"`
+}
+
+type CompositeValidateRequest struct {
+	Predicates []PredicateSpec `json:"predicates"`
+	Proof      json.RawMessage `json:"proof"`
+}
+
+type ConnectBalanceRequest struct {
+	ID           string `json:"id"`
+	ConsentToken string `json:"consentToken"`
+	AccountID    string `json:"accountId,omitempty"`
+}
+
+type Consent struct {
+	ID        string     `json:"id"`
+	Audience  string     `json:"audience"`
+	Circuit   string     `json:"circuit"`
+	Predicate string     `json:"predicate,omitempty"`
+	GrantedAt time.Time  `json:"grantedAt"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+type ConsentRequest struct {
+	Audience  string    `json:"audience"`
+	Circuit   string    `json:"circuit"`
+	Predicate string    `json:"predicate,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type ConsistencyProof struct {
+	First  int      `json:"first"`
+	Second int      `json:"second"`
+	Proof  []string `json:"proof"`
+}
+
+type CreditScoreRequest struct {
+	ID    string `json:"id"`
+	Score int    `json:"score"`
+}
+
+type DIDDocument struct {
+	Context            []string             `json:"@context"`
+	ID                 string               `json:"id"`
+	VerificationMethod []VerificationMethod `json:"verificationMethod"`
+	AssertionMethod    []string             `json:"assertionMethod,omitempty"`
+}
+
+type EncryptionKey struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+}
+
+type InclusionProof struct {
+	Digest    string   `json:"digest"`
+	LeafIndex int      `json:"leafIndex"`
+	LeafHash  string   `json:"leafHash"`
+	TreeSize  int      `json:"treeSize"`
+	AuditPath []string `json:"auditPath"`
+}
+
+type JwkKey struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y,omitempty"`
+}
+
+type LedgerEntry struct {
+	Account string `json:"account"`
+	Amount  int    `json:"amount"`
+}
+
+type LedgerTransaction struct {
+	ID      int64         `json:"id"`
+	Time    time.Time     `json:"time"`
+	Memo    string        `json:"memo,omitempty"`
+	Entries []LedgerEntry `json:"entries"`
+}
+
+type LedgerTransactionRequest struct {
+	Memo    string        `json:"memo"`
+	Entries []LedgerEntry `json:"entries"`
+}
+
+type Policy struct {
+	Name            string          `json:"name"`
+	Predicates      []PredicateSpec `json:"predicates"`
+	MaxProofAge     string          `json:"maxProofAge,omitempty"`
+	Audience        string          `json:"audience,omitempty"`
+	CheckRevocation bool            `json:"checkRevocation,omitempty"`
+	Issuer          string          `json:"issuer,omitempty"`
+}
+
+type PolicyValidateRequest struct {
+	Proof json.RawMessage `json:"proof"`
+}
+
+type PredicateProofRequest struct {
+	ID        string `json:"id"`
+	Predicate string `json:"predicate"`
+}
+
+type PredicateProofResponse struct {
+	Predicate string          `json:"predicate"`
+	Proof     json.RawMessage `json:"proof"`
+}
+
+type PredicateSpec struct {
+	Name      string `json:"name"`
+	Threshold int64  `json:"threshold,omitempty"`
+	List      string `json:"list,omitempty"`
+}
+
+type PredicateValidateRequest struct {
+	Predicate string          `json:"predicate"`
+	Proof     json.RawMessage `json:"proof"`
+	Curve     string          `json:"curve,omitempty"`
+}
+
+type ProofBundle struct {
+	Header    BundleHeader    `json:"header"`
+	Members   []ProofEnvelope `json:"members"`
+	Manifest  string          `json:"manifest"`
+	KeyID     string          `json:"kid,omitempty"`
+	Signature []byte          `json:"signature,omitempty"`
+}
+
+type ProofEnvelope struct {
+	Circuit       string          `json:"circuit"`
+	Inputs        json.RawMessage `json:"inputs"`
+	Proof         json.RawMessage `json:"proof"`
+	GnarkVersion  string          `json:"gnarkVersion,omitempty"`
+	PublicWitness []byte          `json:"publicWitness,omitempty"`
+	Curve         string          `json:"curve,omitempty"`
+	Backend       string          `json:"backend,omitempty"`
+	Metrics       *ProofMetrics   `json:"metrics,omitempty"`
+	Issuer        string          `json:"issuer,omitempty"`
+	KeyID         string          `json:"kid,omitempty"`
+	Signature     []byte          `json:"signature,omitempty"`
+}
+
+type ProofMetrics struct {
+	SizeBytes   int     `json:"sizeBytes,omitempty"`
+	QueueMs     float64 `json:"queueMs,omitempty"`
+	ProvingMs   float64 `json:"provingMs,omitempty"`
+	VerifyingMs float64 `json:"verifyingMs,omitempty"`
+}
+
+type ProofRecord struct {
+	Digest         string            `json:"digest"`
+	Circuit        string            `json:"circuit,omitempty"`
+	CircuitVersion int               `json:"circuitVersion,omitempty"`
+	Curve          string            `json:"curve,omitempty"`
+	PublicInputs   map[string]string `json:"publicInputs,omitempty"`
+	Audience       string            `json:"audience,omitempty"`
+	LedgerTx       int64             `json:"ledgerTx,omitempty"`
+	CreatedAt      time.Time         `json:"createdAt"`
+}
+
+type ProofRequest struct {
+	ID           string `json:"id"`
+	NeededAmount int    `json:"neededAmount"`
+	Comparison   string `json:"comparison,omitempty"`
+	Preset       string `json:"preset,omitempty"`
+}
+
+type ProvingEstimate struct {
+	Circuit     string  `json:"circuit"`
+	Curve       string  `json:"curve"`
+	Constraints int     `json:"constraints"`
+	ProvingMs   float64 `json:"provingMs"`
+	QueueMs     float64 `json:"queueMs"`
+	MemoryBytes int64   `json:"memoryBytes"`
+	Basis       string  `json:"basis"`
+	Samples     int     `json:"samples"`
+	TimeoutMs   float64 `json:"timeoutMs,omitempty"`
+	Sync        bool    `json:"sync"`
+}
+
+type PublicInput struct {
+	Index    int    `json:"index"`
+	Name     string `json:"name"`
+	Field    string `json:"field"`
+	Position *int   `json:"position,omitempty"`
+	Type     string `json:"type"`
+}
+
+type RawValidateRequest struct {
+	Format        string          `json:"format"`
+	VerifyingKey  json.RawMessage `json:"verifyingKey"`
+	Proof         json.RawMessage `json:"proof"`
+	PublicSignals json.RawMessage `json:"publicSignals"`
+}
+
+type RawValidateResponse struct {
+	Format       string   `json:"format"`
+	Curve        string   `json:"curve"`
+	PublicInputs []string `json:"publicInputs"`
+}
+
+type ResolvedDID struct {
+	ID                 string               `json:"id"`
+	VerificationMethod []VerificationMethod `json:"verificationMethod"`
+}
+
+type SigningKey struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+}
+
+type Statement struct {
+	Name        string               `json:"name"`
+	Description string               `json:"description,omitempty"`
+	Predicates  []StatementPredicate `json:"predicates"`
+}
+
+type StatementPredicate struct {
+	Attribute string   `json:"attribute,omitempty"`
+	Sum       []string `json:"sum,omitempty"`
+	Op        string   `json:"op"`
+	Value     int64    `json:"value,omitempty"`
+	Min       int64    `json:"min,omitempty"`
+	Max       int64    `json:"max,omitempty"`
+}
+
+type StatementProofRequest struct {
+	ID       string `json:"id"`
+	Audience string `json:"audience,omitempty"`
+}
+
+type StatementProofResponse struct {
+	Statement string          `json:"statement"`
+	Proof     json.RawMessage `json:"proof"`
+}
+
+type StatementValidateRequest struct {
+	Proof json.RawMessage `json:"proof"`
+}
+
+type StoredProofResponse struct {
+	ProofRecord
+	Proof json.RawMessage `json:"proof"`
+}
+
+type Subscription struct {
+	Name     string   `json:"name"`
+	Events   []string `json:"events"`
+	Notifier string   `json:"notifier"`
+	URL      string   `json:"url,omitempty"`
+	To       string   `json:"to,omitempty"`
+	Secret   string   `json:"secret,omitempty"`
+}
+
+type SubscriptionStatus struct {
+	Subscription
+	Delivered    int64      `json:"delivered"`
+	Failed       int64      `json:"failed"`
+	LastError    string     `json:"lastError,omitempty"`
+	LastFailedAt *time.Time `json:"lastFailedAt,omitempty"`
+}
+
+type TenantUsage struct {
+	Tenant       string  `json:"tenant"`
+	MonthProofs  int     `json:"monthProofs"`
+	DaySeconds   float64 `json:"daySeconds"`
+	MonthSeconds float64 `json:"monthSeconds"`
+	DailyQuota   float64 `json:"dailyQuotaSeconds,omitempty"`
+	MonthlyQuota float64 `json:"monthlyQuotaSeconds,omitempty"`
+}
+
+type Tier struct {
+	Label     string `json:"label"`
+	Threshold int64  `json:"threshold"`
+}
+
+type TierCertificate struct {
+	Claim TierClaim       `json:"claim"`
+	Proof json.RawMessage `json:"proof"`
+}
+
+type TierClaim struct {
+	Tier        string    `json:"tier"`
+	Threshold   int64     `json:"threshold"`
+	ProofDigest string    `json:"proofDigest"`
+	Curve       string    `json:"curve"`
+	Audience    string    `json:"audience,omitempty"`
+	IssuedAt    time.Time `json:"issuedAt"`
+	Issuer      string    `json:"issuer"`
+	KeyID       string    `json:"kid"`
+	Signature   []byte    `json:"signature"`
+}
+
+type TierProofRequest struct {
+	ID       string `json:"id"`
+	Audience string `json:"audience,omitempty"`
+}
+
+type TierValidateRequest struct {
+	Claim        TierClaim       `json:"claim"`
+	Proof        json.RawMessage `json:"proof"`
+	GnarkVersion string          `json:"gnarkVersion,omitempty"`
+}
+
+type TimeLockedProofRequest struct {
+	ID           string    `json:"id"`
+	NeededAmount int       `json:"neededAmount"`
+	NotBefore    time.Time `json:"notBefore"`
+}
+
+type TimeLockedValidateRequest struct {
+	NeededAmount int             `json:"neededAmount"`
+	NotBefore    time.Time       `json:"notBefore"`
+	Proof        json.RawMessage `json:"proof"`
+	Curve        string          `json:"curve,omitempty"`
+}
+
+type TransferDecodeRequest struct {
+	Chunks []string `json:"chunks"`
+}
+
+type TransferEncoding struct {
+	Chunks []string `json:"chunks"`
+	Size   int      `json:"size"`
+}
+
+type TreeHead struct {
+	TreeSize  int       `json:"treeSize"`
+	RootHash  string    `json:"rootHash"`
+	Timestamp time.Time `json:"timestamp"`
+	Issuer    string    `json:"issuer,omitempty"`
+	KeyID     string    `json:"kid,omitempty"`
+	Signature []byte    `json:"signature,omitempty"`
+}
+
+type ValidateRequest struct {
+	ID            string          `json:"id"`
+	NeededAmount  int             `json:"neededAmount"`
+	Proof         json.RawMessage `json:"proof"`
+	GnarkVersion  string          `json:"gnarkVersion,omitempty"`
+	PublicWitness []byte          `json:"publicWitness,omitempty"`
+	Circuit       string          `json:"circuit,omitempty"`
+	Curve         string          `json:"curve,omitempty"`
+	Issuer        string          `json:"issuer,omitempty"`
+	DryRun        bool            `json:"dryRun,omitempty"`
+	Comparison    string          `json:"comparison,omitempty"`
+	Preset        string          `json:"preset,omitempty"`
+}
+
+type VerificationMethod struct {
+	ID           string  `json:"id"`
+	Type         string  `json:"type"`
+	Controller   string  `json:"controller"`
+	PublicKeyJWK *JwkKey `json:"publicKeyJwk,omitempty"`
+	Multibase    string  `json:"publicKeyMultibase,omitempty"`
+}
+
+type WitnessEncoding struct {
+	JSON   string `json:"json"`
+	Binary string `json:"binary"`
+}
+
+// StoreBalance calls POST /store/sum: Store a self-reported balance.
+func (c *Client) StoreBalance(ctx context.Context, req *BalanceRequest) error {
+	return c.do(ctx, "POST", "/store/sum", nil, req, nil)
+}
+
+// StoreCreditScore calls POST /store/credit-score: Store a credit score attribute.
+func (c *Client) StoreCreditScore(ctx context.Context, req *CreditScoreRequest) error {
+	return c.do(ctx, "POST", "/store/credit-score", nil, req, nil)
+}
+
+// StoreAttribute calls POST /store/attribute: Store a named attribute.
+func (c *Client) StoreAttribute(ctx context.Context, req *AttributeRequest) error {
+	return c.do(ctx, "POST", "/store/attribute", nil, req, nil)
+}
+
+// PutAttributes calls PUT /attributes/{userID}: Store the typed attributes of a user.
+func (c *Client) PutAttributes(ctx context.Context, userID string, req *AttributeDocument) (*AttributeDocument, error) {
+	var out AttributeDocument
+	if err := c.do(ctx, "PUT", "/attributes/"+url.PathEscape(userID), nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetAttributes calls GET /attributes/{userID}: Get the typed attributes of a user.
+func (c *Client) GetAttributes(ctx context.Context, userID string) (*AttributeDocument, error) {
+	var out AttributeDocument
+	if err := c.do(ctx, "GET", "/attributes/"+url.PathEscape(userID), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GrantConsent calls POST /consents/{userID}: Consent to proofs for a relying party.
+func (c *Client) GrantConsent(ctx context.Context, userID string, req *ConsentRequest) (*Consent, error) {
+	var out Consent
+	if err := c.do(ctx, "POST", "/consents/"+url.PathEscape(userID), nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListConsents calls GET /consents/{userID}: List the consents of a user.
+func (c *Client) ListConsents(ctx context.Context, userID string) ([]Consent, error) {
+	var out []Consent
+	err := c.do(ctx, "GET", "/consents/"+url.PathEscape(userID), nil, nil, &out)
+	return out, err
+}
+
+// RevokeConsent calls DELETE /consents/{userID}/{consentID}: Revoke a consent.
+func (c *Client) RevokeConsent(ctx context.Context, userID string, consentID string) error {
+	return c.do(ctx, "DELETE", "/consents/"+url.PathEscape(userID)+"/"+url.PathEscape(consentID), nil, nil, nil)
+}
+
+// ConnectBalance calls POST /connect/balance: Fetch and attest a balance from the bank.
+func (c *Client) ConnectBalance(ctx context.Context, req *ConnectBalanceRequest) (*BalanceAttestation, error) {
+	var out BalanceAttestation
+	if err := c.do(ctx, "POST", "/connect/balance", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetBalanceAttestation calls GET /balances/{id}/attestation: Get the bank attestation of a balance.
+func (c *Client) GetBalanceAttestation(ctx context.Context, id string) (*BalanceAttestation, error) {
+	var out BalanceAttestation
+	if err := c.do(ctx, "GET", "/balances/"+url.PathEscape(id)+"/attestation", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PostLedgerTransaction calls POST /ledger/transactions: Post a balanced ledger transaction.
+func (c *Client) PostLedgerTransaction(ctx context.Context, req *LedgerTransactionRequest) (*LedgerTransaction, error) {
+	var out LedgerTransaction
+	if err := c.do(ctx, "POST", "/ledger/transactions", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetChallenge calls GET /challenge: Get a challenge of the proof generation gate.
+func (c *Client) GetChallenge(ctx context.Context) (*Challenge, error) {
+	var out Challenge
+	if err := c.do(ctx, "GET", "/challenge", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetUsage calls GET /usage: Get the caller's proving usage.
+func (c *Client) GetUsage(ctx context.Context) (*TenantUsage, error) {
+	var out TenantUsage
+	if err := c.do(ctx, "GET", "/usage", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListBuckets calls GET /buckets: List the disclosure buckets.
+func (c *Client) ListBuckets(ctx context.Context) ([]Bucket, error) {
+	var out []Bucket
+	err := c.do(ctx, "GET", "/buckets", nil, nil, &out)
+	return out, err
+}
+
+// ListTiers calls GET /tiers: List the balance tiers.
+func (c *Client) ListTiers(ctx context.Context) ([]Tier, error) {
+	var out []Tier
+	err := c.do(ctx, "GET", "/tiers", nil, nil, &out)
+	return out, err
+}
+
+// GenerateProof calls POST /get/proof/neededAmount: Prove a balance covers an amount.
+func (c *Client) GenerateProof(ctx context.Context, req *ProofRequest) (json.RawMessage, error) {
+	var out json.RawMessage
+	err := c.do(ctx, "POST", "/get/proof/neededAmount", nil, req, &out)
+	return out, err
+}
+
+// ValidateProof calls POST /validate: Verify a balance proof.
+func (c *Client) ValidateProof(ctx context.Context, req *ValidateRequest) error {
+	return c.do(ctx, "POST", "/validate", nil, req, nil)
+}
+
+// CommitThreshold calls POST /threshold/commit: Commit to a hidden threshold.
+func (c *Client) CommitThreshold(ctx context.Context, req *CommitThresholdRequest) (*CommitThresholdResponse, error) {
+	var out CommitThresholdResponse
+	if err := c.do(ctx, "POST", "/threshold/commit", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GenerateCommittedProof calls POST /get/proof/committed: Prove a balance covers a committed threshold.
+func (c *Client) GenerateCommittedProof(ctx context.Context, req *CommittedProofRequest) (json.RawMessage, error) {
+	var out json.RawMessage
+	err := c.do(ctx, "POST", "/get/proof/committed", nil, req, &out)
+	return out, err
+}
+
+// ValidateCommittedProof calls POST /validate/committed: Verify a committed threshold proof.
+func (c *Client) ValidateCommittedProof(ctx context.Context, req *CommittedValidateRequest) error {
+	return c.do(ctx, "POST", "/validate/committed", nil, req, nil)
+}
+
+// GenerateBucketProof calls POST /get/proof/bucket: Prove the bucket a balance falls in.
+func (c *Client) GenerateBucketProof(ctx context.Context, req *BucketProofRequest) (*BucketProofResponse, error) {
+	var out BucketProofResponse
+	if err := c.do(ctx, "POST", "/get/proof/bucket", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ValidateBucketProof calls POST /validate/bucket: Verify a bucket proof.
+func (c *Client) ValidateBucketProof(ctx context.Context, req *BucketValidateRequest) error {
+	return c.do(ctx, "POST", "/validate/bucket", nil, req, nil)
+}
+
+// GenerateTierCertificate calls POST /get/proof/tier: Prove the highest balance tier reached, with a signed claim.
+func (c *Client) GenerateTierCertificate(ctx context.Context, req *TierProofRequest) (*TierCertificate, error) {
+	var out TierCertificate
+	if err := c.do(ctx, "POST", "/get/proof/tier", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ValidateTierCertificate calls POST /validate/tier: Verify a tier certificate.
+func (c *Client) ValidateTierCertificate(ctx context.Context, req *TierValidateRequest) (*TierClaim, error) {
+	var out TierClaim
+	if err := c.do(ctx, "POST", "/validate/tier", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GeneratePredicateProof calls POST /get/proof/predicate: Prove a disjunction of thresholds.
+func (c *Client) GeneratePredicateProof(ctx context.Context, req *PredicateProofRequest) (*PredicateProofResponse, error) {
+	var out PredicateProofResponse
+	if err := c.do(ctx, "POST", "/get/proof/predicate", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ValidatePredicateProof calls POST /validate/predicate: Verify a predicate proof.
+func (c *Client) ValidatePredicateProof(ctx context.Context, req *PredicateValidateRequest) error {
+	return c.do(ctx, "POST", "/validate/predicate", nil, req, nil)
+}
+
+// GenerateCompositeProof calls POST /get/proof/composite: Prove several predicates in one proof.
+func (c *Client) GenerateCompositeProof(ctx context.Context, req *CompositeProofRequest) (*CompositeProofResponse, error) {
+	var out CompositeProofResponse
+	if err := c.do(ctx, "POST", "/get/proof/composite", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ValidateCompositeProof calls POST /validate/composite: Verify a composite proof.
+func (c *Client) ValidateCompositeProof(ctx context.Context, req *CompositeValidateRequest) error {
+	return c.do(ctx, "POST", "/validate/composite", nil, req, nil)
+}
+
+// GenerateTimeLockedProof calls POST /get/proof/timelocked: Prove a threshold that only becomes valid at notBefore.
+func (c *Client) GenerateTimeLockedProof(ctx context.Context, req *TimeLockedProofRequest) (json.RawMessage, error) {
+	var out json.RawMessage
+	err := c.do(ctx, "POST", "/get/proof/timelocked", nil, req, &out)
+	return out, err
+}
+
+// ValidateTimeLockedProof calls POST /validate/timelocked: Verify a time-locked proof.
+func (c *Client) ValidateTimeLockedProof(ctx context.Context, req *TimeLockedValidateRequest) error {
+	return c.do(ctx, "POST", "/validate/timelocked", nil, req, nil)
+}
+
+// GenerateCircuitProof calls POST /get/proof/circuits/{name}: Prove a registered external circuit.
+func (c *Client) GenerateCircuitProof(ctx context.Context, name string, req *CircuitProofRequest) (*CircuitProofResponse, error) {
+	var out CircuitProofResponse
+	if err := c.do(ctx, "POST", "/get/proof/circuits/"+url.PathEscape(name), nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GenerateStatementProof calls POST /get/proof/statement/{name}: Prove a registered statement.
+func (c *Client) GenerateStatementProof(ctx context.Context, name string, req *StatementProofRequest) (*StatementProofResponse, error) {
+	var out StatementProofResponse
+	if err := c.do(ctx, "POST", "/get/proof/statement/"+url.PathEscape(name), nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ValidateStatementProof calls POST /validate/statement/{name}: Verify a statement proof.
+func (c *Client) ValidateStatementProof(ctx context.Context, name string, req *StatementValidateRequest) error {
+	return c.do(ctx, "POST", "/validate/statement/"+url.PathEscape(name), nil, req, nil)
+}
+
+// ValidatePolicy calls POST /validate/policy/{name}: Verify a proof against a verification policy.
+func (c *Client) ValidatePolicy(ctx context.Context, name string, req *PolicyValidateRequest) error {
+	return c.do(ctx, "POST", "/validate/policy/"+url.PathEscape(name), nil, req, nil)
+}
+
+// ValidateRawProof calls POST /validate/raw: Verify a proof in another prover's format.
+func (c *Client) ValidateRawProof(ctx context.Context, req *RawValidateRequest) (*RawValidateResponse, error) {
+	var out RawValidateResponse
+	if err := c.do(ctx, "POST", "/validate/raw", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateBundle calls POST /bundle: Seal proofs into a signed bundle.
+func (c *Client) CreateBundle(ctx context.Context, req *ProofBundle) (*ProofBundle, error) {
+	var out ProofBundle
+	if err := c.do(ctx, "POST", "/bundle", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ValidateBundle calls POST /validate/bundle: Verify every member of a bundle.
+func (c *Client) ValidateBundle(ctx context.Context, req *ProofBundle) (*BundleValidateResponse, error) {
+	var out BundleValidateResponse
+	if err := c.do(ctx, "POST", "/validate/bundle", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// EncodeTransfer calls POST /transfer/encode: Encode a proof envelope as QR chunks.
+// The query may set chunkSize.
+func (c *Client) EncodeTransfer(ctx context.Context, req *ProofEnvelope, query url.Values) (*TransferEncoding, error) {
+	var out TransferEncoding
+	if err := c.do(ctx, "POST", "/transfer/encode", query, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DecodeTransfer calls POST /transfer/decode: Decode QR chunks into a proof envelope.
+func (c *Client) DecodeTransfer(ctx context.Context, req *TransferDecodeRequest) (*ProofEnvelope, error) {
+	var out ProofEnvelope
+	if err := c.do(ctx, "POST", "/transfer/decode", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetAllowlist calls GET /allowlists/{name}: Get the Merkle root of an allowlist.
+func (c *Client) GetAllowlist(ctx context.Context, name string) (*AllowlistResponse, error) {
+	var out AllowlistResponse
+	if err := c.do(ctx, "GET", "/allowlists/"+url.PathEscape(name), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetPolicy calls GET /policies/{name}: Get a verification policy.
+func (c *Client) GetPolicy(ctx context.Context, name string) (*Policy, error) {
+	var out Policy
+	if err := c.do(ctx, "GET", "/policies/"+url.PathEscape(name), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetAttributeSchema calls GET /attribute-schemas/{name}: Get a registered attribute schema.
+func (c *Client) GetAttributeSchema(ctx context.Context, name string) (*AttributeSchema, error) {
+	var out AttributeSchema
+	if err := c.do(ctx, "GET", "/attribute-schemas/"+url.PathEscape(name), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetStatement calls GET /statements/{name}: Get a registered statement.
+func (c *Client) GetStatement(ctx context.Context, name string) (*Statement, error) {
+	var out Statement
+	if err := c.do(ctx, "GET", "/statements/"+url.PathEscape(name), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetCircuitSchema calls GET /circuits/{name}/schema: Get the public inputs of a circuit.
+// The query may set curve.
+func (c *Client) GetCircuitSchema(ctx context.Context, name string, query url.Values) (*CircuitSchema, error) {
+	var out CircuitSchema
+	if err := c.do(ctx, "GET", "/circuits/"+url.PathEscape(name)+"/schema", query, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// EstimateProving calls GET /circuits/{name}/estimate: Estimate the latency and memory of proving a circuit.
+// The query may set curve.
+func (c *Client) EstimateProving(ctx context.Context, name string, query url.Values) (*ProvingEstimate, error) {
+	var out ProvingEstimate
+	if err := c.do(ctx, "GET", "/circuits/"+url.PathEscape(name)+"/estimate", query, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetSigningKey calls GET /keys/signing: Get the server's signing key.
+func (c *Client) GetSigningKey(ctx context.Context) (*SigningKey, error) {
+	var out SigningKey
+	if err := c.do(ctx, "GET", "/keys/signing", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetEncryptionKey calls GET /keys/encryption: Get the payload encryption key.
+func (c *Client) GetEncryptionKey(ctx context.Context) (*EncryptionKey, error) {
+	var out EncryptionKey
+	if err := c.do(ctx, "GET", "/keys/encryption", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetDIDDocument calls GET /.well-known/did.json: Get the server's did:web document.
+func (c *Client) GetDIDDocument(ctx context.Context) (*DIDDocument, error) {
+	var out DIDDocument
+	if err := c.do(ctx, "GET", "/.well-known/did.json", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ResolveDID calls GET /dids/{did}: Resolve a DID to its verification keys.
+func (c *Client) ResolveDID(ctx context.Context, did string) (*ResolvedDID, error) {
+	var out ResolvedDID
+	if err := c.do(ctx, "GET", "/dids/"+url.PathEscape(did), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetProofByHash calls GET /proofs/by-hash/{digest}: Get an issued proof by its digest.
+func (c *Client) GetProofByHash(ctx context.Context, digest string) (*StoredProofResponse, error) {
+	var out StoredProofResponse
+	if err := c.do(ctx, "GET", "/proofs/by-hash/"+url.PathEscape(digest), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetTreeHead calls GET /log/tree-head: Get the signed head of the transparency log.
+func (c *Client) GetTreeHead(ctx context.Context) (*TreeHead, error) {
+	var out TreeHead
+	if err := c.do(ctx, "GET", "/log/tree-head", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetInclusionProof calls GET /log/inclusion/{digest}: Prove a proof is in the transparency log.
+// The query may set treeSize.
+func (c *Client) GetInclusionProof(ctx context.Context, digest string, query url.Values) (*InclusionProof, error) {
+	var out InclusionProof
+	if err := c.do(ctx, "GET", "/log/inclusion/"+url.PathEscape(digest), query, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetConsistencyProof calls GET /log/consistency: Prove one tree head extends another.
+// The query may set first, second.
+func (c *Client) GetConsistencyProof(ctx context.Context, query url.Values) (*ConsistencyProof, error) {
+	var out ConsistencyProof
+	if err := c.do(ctx, "GET", "/log/consistency", query, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListSubscriptions calls GET /subscriptions: List the caller's notification subscriptions.
+func (c *Client) ListSubscriptions(ctx context.Context) ([]SubscriptionStatus, error) {
+	var out []SubscriptionStatus
+	err := c.do(ctx, "GET", "/subscriptions", nil, nil, &out)
+	return out, err
+}
+
+// PutSubscription calls PUT /subscriptions/{name}: Create or replace a notification subscription.
+func (c *Client) PutSubscription(ctx context.Context, name string, req *Subscription) (*SubscriptionStatus, error) {
+	var out SubscriptionStatus
+	if err := c.do(ctx, "PUT", "/subscriptions/"+url.PathEscape(name), nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteSubscription calls DELETE /subscriptions/{name}: Remove a notification subscription.
+func (c *Client) DeleteSubscription(ctx context.Context, name string) error {
+	return c.do(ctx, "DELETE", "/subscriptions/"+url.PathEscape(name), nil, nil, nil)
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// sdkFile is the generated part of the client SDK, relative to the repository root
+const sdkFile = "sdk/zz_generated.go"
+
+// sdkGenerator writes the request and response types and the methods of the client SDK
+type sdkGenerator struct {
+	types   map[string]reflect.Type // named struct types to generate, by generated name
+	pending []reflect.Type
+}
+
+// generateSDK returns the Go source of package sdk for endpoints: a copy of every named type
+// their requests and responses use, and a Client method per endpoint
+func generateSDK(endpoints []Endpoint) ([]byte, error) {
+	g := &sdkGenerator{types: make(map[string]reflect.Type)}
+
+	var methods bytes.Buffer
+	for _, e := range endpoints {
+		if err := g.method(&methods, e); err != nil {
+			return nil, fmt.Errorf("%s: %w", e.Name, err)
+		}
+	}
+
+	// Generating a type may find more; generate until none are left, then sort them by name
+	defs := make(map[string]string)
+	for len(g.pending) > 0 {
+		t := g.pending[0]
+		g.pending = g.pending[1:]
+		var def bytes.Buffer
+		if err := g.typeDef(&def, t); err != nil {
+			return nil, err
+		}
+		defs[dtoName(t)] = def.String()
+	}
+	names := make([]string, 0, len(defs))
+	for name := range defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var types bytes.Buffer
+	for _, name := range names {
+		types.WriteString(defs[name])
+	}
+
+	var src bytes.Buffer
+	src.WriteString("// Code generated by make sdk from the server's endpoint definitions; DO NOT EDIT.\n\npackage sdk\n\nimport (\n")
+	body := types.String() + methods.String()
+	for _, pkg := range []string{"context", "encoding/json", "net/url", "time"} {
+		name := pkg[strings.LastIndex(pkg, "/")+1:]
+		if pkg == "context" || strings.Contains(body, name+".") {
+			fmt.Fprintf(&src, "\t%q\n", pkg)
+		}
+	}
+	src.WriteString(")\n\n")
+	src.WriteString(body)
+	return format.Source(src.Bytes())
+}
+
+// method writes the Client method calling e
+func (g *sdkGenerator) method(w *bytes.Buffer, e Endpoint) error {
+	args := []string{"ctx context.Context"}
+	path := fmt.Sprintf("%q", e.Path)
+	if params := e.pathParams(); len(params) > 0 {
+		var parts []string
+		rest := e.Path
+		for _, p := range params {
+			before, after, _ := strings.Cut(rest, "{"+p+"}")
+			parts = append(parts, fmt.Sprintf("%q", before), "url.PathEscape("+p+")")
+			rest = after
+			args = append(args, p+" string")
+		}
+		if rest != "" {
+			parts = append(parts, fmt.Sprintf("%q", rest))
+		}
+		path = strings.Join(parts, " + ")
+	}
+
+	in := "nil"
+	if e.Request != nil {
+		t := reflect.TypeOf(e.Request)
+		typ, err := g.goType(t)
+		if err != nil {
+			return err
+		}
+		if t.Kind() == reflect.Struct {
+			typ = "*" + typ
+		}
+		args = append(args, "req "+typ)
+		in = "req"
+	}
+	query := "nil"
+	if len(e.Query) > 0 {
+		args = append(args, "query url.Values")
+		query = "query"
+	}
+
+	fmt.Fprintf(w, "// %s calls %s %s: %s.", e.Name, e.Method, e.Path, e.Summary)
+	if len(e.Query) > 0 {
+		fmt.Fprintf(w, "\n// The query may set %s.", strings.Join(e.Query, ", "))
+	}
+	call := fmt.Sprintf("c.do(ctx, %q, %s, %s, %s", e.Method, path, query, in)
+	switch {
+	case e.Response == nil:
+		fmt.Fprintf(w, "\nfunc (c *Client) %s(%s) error {\n\treturn %s, nil)\n}\n\n", e.Name, strings.Join(args, ", "), call)
+	case reflect.TypeOf(e.Response).Kind() == reflect.Struct && dtoKind(reflect.TypeOf(e.Response)) == "":
+		typ, err := g.goType(reflect.TypeOf(e.Response))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "\nfunc (c *Client) %s(%s) (*%s, error) {\n\tvar out %s\n\tif err := %s, &out); err != nil {\n\t\treturn nil, err\n\t}\n\treturn &out, nil\n}\n\n",
+			e.Name, strings.Join(args, ", "), typ, typ, call)
+	default:
+		typ, err := g.goType(reflect.TypeOf(e.Response))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "\nfunc (c *Client) %s(%s) (%s, error) {\n\tvar out %s\n\terr := %s, &out)\n\treturn out, err\n}\n\n",
+			e.Name, strings.Join(args, ", "), typ, typ, call)
+	}
+	return nil
+}
+
+// goType returns the Go type expression t is generated as, queueing named structs
+func (g *sdkGenerator) goType(t reflect.Type) (string, error) {
+	switch dtoKind(t) {
+	case "any":
+		return "json.RawMessage", nil
+	case "time":
+		return "time.Time", nil
+	case "bytes":
+		return "[]byte", nil
+	case "text":
+		return "string", nil
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		elem, err := g.goType(t.Elem())
+		return "*" + elem, err
+	case reflect.Slice:
+		elem, err := g.goType(t.Elem())
+		return "[]" + elem, err
+	case reflect.Array:
+		elem, err := g.goType(t.Elem())
+		return fmt.Sprintf("[%d]%s", t.Len(), elem), err
+	case reflect.Map:
+		key, err := g.goType(t.Key())
+		if err != nil {
+			return "", err
+		}
+		elem, err := g.goType(t.Elem())
+		return "map[" + key + "]" + elem, err
+	case reflect.Struct:
+		if t.Name() == "" {
+			var def bytes.Buffer
+			if err := g.fields(&def, t); err != nil {
+				return "", err
+			}
+			return "struct {\n" + def.String() + "}", nil
+		}
+		name := dtoName(t)
+		if seen, ok := g.types[name]; ok {
+			if seen != t {
+				return "", fmt.Errorf("types %s and %s are both named %s", seen, t, name)
+			}
+			return name, nil
+		}
+		g.types[name] = t
+		g.pending = append(g.pending, t)
+		return name, nil
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return t.Kind().String(), nil
+	}
+	return "", fmt.Errorf("cannot generate %s", t)
+}
+
+// typeDef writes the declaration of the named struct t
+func (g *sdkGenerator) typeDef(w *bytes.Buffer, t reflect.Type) error {
+	fmt.Fprintf(w, "type %s struct {\n", dtoName(t))
+	if err := g.fields(w, t); err != nil {
+		return err
+	}
+	w.WriteString("}\n\n")
+	return nil
+}
+
+func (g *sdkGenerator) fields(w *bytes.Buffer, t reflect.Type) error {
+	for _, f := range dtoFields(t) {
+		typ, err := g.goType(f.Type)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %w", t.Name(), f.GoName, err)
+		}
+		switch {
+		case f.Embedded:
+			fmt.Fprintf(w, "\t%s\n", typ)
+		case f.Tag != "":
+			fmt.Fprintf(w, "\t%s %s `json:%q`\n", f.GoName, typ, f.Tag)
+		default:
+			fmt.Fprintf(w, "\t%s %s\n", f.GoName, typ)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+// updateSDKEnv makes TestGeneratedSDKUpToDate rewrite sdkFile instead of comparing against it
+const updateSDKEnv = "ZK_UPDATE_SDK"
+
+func TestGeneratedSDKUpToDate(t *testing.T) {
+	src, err := generateSDK(apiEndpoints())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if os.Getenv(updateSDKEnv) != "" {
+		if err := os.WriteFile(sdkFile, src, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	existing, err := os.ReadFile(sdkFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(existing, src) {
+		t.Errorf("%s is out of date with the endpoint definitions; run make sdk", sdkFile)
+	}
+}
+
+func TestGenerateSDKMethods(t *testing.T) {
+	endpoints := []Endpoint{
+		{Name: "GetStatement", Method: "GET", Path: "/statements/{name}", Summary: "Get a registered statement", Response: Statement{}},
+		{Name: "GetConsistencyProof", Method: "GET", Path: "/log/consistency", Summary: "Prove one tree head extends another", Query: []string{"first", "second"}, Response: ConsistencyProof{}},
+		{Name: "DeleteSubscription", Method: "DELETE", Path: "/subscriptions/{name}", Summary: "Remove a notification subscription"},
+		{Name: "ListBuckets", Method: "GET", Path: "/buckets", Summary: "List the disclosure buckets", Response: []Bucket{}},
+	}
+	src, err := generateSDK(endpoints)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`func (c *Client) GetStatement(ctx context.Context, name string) (*Statement, error)`,
+		`c.do(ctx, "GET", "/statements/"+url.PathEscape(name), nil, nil, &out)`,
+		`func (c *Client) GetConsistencyProof(ctx context.Context, query url.Values) (*ConsistencyProof, error)`,
+		`func (c *Client) DeleteSubscription(ctx context.Context, name string) error`,
+		`func (c *Client) ListBuckets(ctx context.Context) ([]Bucket, error)`,
+		"type Statement struct {",
+		"type Bucket struct {",
+	} {
+		if !strings.Contains(string(src), want) {
+			t.Errorf("generated SDK lacks %q", want)
+		}
+	}
+}
+
+func TestGenerateSDKRefusesUnsupportedTypes(t *testing.T) {
+	endpoints := []Endpoint{{Name: "Bad", Method: "POST", Path: "/bad", Request: struct{ C chan int }{}}}
+	if _, err := generateSDK(endpoints); err == nil {
+		t.Error("expected an error for a channel field")
+	}
+}
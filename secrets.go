@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Names of the secrets read through the secret provider
+const (
+	adminTokenSecret  = "admin-token"
+	s3AccessKeySecret = "s3-access-key"
+	s3SecretKeySecret = "s3-secret-key"
+)
+
+var (
+	errSecretNotFound = errors.New("secret not found")
+	secretNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+)
+
+// SecretProvider resolves named secret material (tokens, keys, credentials).
+// It returns errSecretNotFound when the secret is not configured.
+type SecretProvider interface {
+	Secret(ctx context.Context, name string) (string, error)
+}
+
+// secrets is the process-wide secret provider, replaced from configuration at startup
+var secrets SecretProvider = envSecrets{}
+
+// SecretsConfig selects and configures the secret provider backend
+type SecretsConfig struct {
+	Backend  string // "env", "file" or "vault"
+	Dir      string // file backend: one file per secret
+	CacheTTL time.Duration
+	Vault    VaultConfig
+}
+
+// VaultConfig locates a HashiCorp Vault KV version 2 secret holding one field per secret name
+type VaultConfig struct {
+	Addr  string
+	Token string
+	Mount string
+	Path  string
+}
+
+func newSecretProvider(cfg SecretsConfig) (SecretProvider, error) {
+	switch cfg.Backend {
+	case "", "env":
+		return envSecrets{}, nil
+	case "file":
+		if cfg.Dir == "" {
+			return nil, errors.New("secrets directory is required for the file backend")
+		}
+		return fileSecrets{dir: cfg.Dir}, nil
+	case "vault":
+		v, err := newVaultSecrets(cfg.Vault)
+		if err != nil {
+			return nil, err
+		}
+		return newCachedSecrets(v, cfg.CacheTTL), nil
+	default:
+		return nil, fmt.Errorf("unknown secrets backend %q", cfg.Backend)
+	}
+}
+
+// secretEnvName maps a secret name to its environment variable, e.g. admin-token -> ZK_ADMIN_TOKEN
+func secretEnvName(name string) string {
+	return "ZK_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// envSecrets reads secrets from ZK_* environment variables
+type envSecrets struct{}
+
+func (envSecrets) Secret(_ context.Context, name string) (string, error) {
+	if v := os.Getenv(secretEnvName(name)); v != "" {
+		return v, nil
+	}
+	return "", errSecretNotFound
+}
+
+// fileSecrets reads each secret from a file named after it, as mounted by Docker and Kubernetes
+type fileSecrets struct {
+	dir string
+}
+
+func (s fileSecrets) Secret(_ context.Context, name string) (string, error) {
+	if !secretNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid secret name %q", name)
+	}
+	data, err := os.ReadFile(filepath.Join(s.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", errSecretNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	v := strings.TrimRight(string(data), "\r\n")
+	if v == "" {
+		return "", errSecretNotFound
+	}
+	return v, nil
+}
+
+// vaultSecrets reads secrets from the fields of a Vault KV v2 secret
+type vaultSecrets struct {
+	cfg    VaultConfig
+	url    string
+	client *http.Client
+}
+
+func newVaultSecrets(cfg VaultConfig) (*vaultSecrets, error) {
+	if cfg.Addr == "" || cfg.Token == "" || cfg.Path == "" {
+		return nil, errors.New("vault backend requires address, token and path")
+	}
+	if cfg.Mount == "" {
+		cfg.Mount = "secret"
+	}
+	base, err := url.Parse(cfg.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vault address: %w", err)
+	}
+	base.Path = "/v1/" + cfg.Mount + "/data/" + strings.Trim(cfg.Path, "/")
+
+	return &vaultSecrets{cfg: cfg, url: base.String(), client: &http.Client{Timeout: 10 * time.Second}}, nil
+}
+
+func (v *vaultSecrets) Secret(ctx context.Context, name string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", v.cfg.Token)
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", errSecretNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault read %s: %s", v.cfg.Path, resp.Status)
+	}
+
+	var body struct {
+		Data struct {
+			Data map[string]string `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return "", fmt.Errorf("vault read %s: %w", v.cfg.Path, err)
+	}
+
+	value, ok := body.Data.Data[name]
+	if !ok || value == "" {
+		return "", errSecretNotFound
+	}
+	return value, nil
+}
+
+// cachedSecrets keeps resolved secrets for ttl so remote providers are not queried per request
+type cachedSecrets struct {
+	next SecretProvider
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]cachedSecret
+}
+
+type cachedSecret struct {
+	value   string
+	err     error
+	expires time.Time
+}
+
+func newCachedSecrets(next SecretProvider, ttl time.Duration) *cachedSecrets {
+	return &cachedSecrets{next: next, ttl: ttl, now: time.Now, entries: make(map[string]cachedSecret)}
+}
+
+func (c *cachedSecrets) Secret(ctx context.Context, name string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[name]; ok && c.now().Before(e.expires) {
+		return e.value, e.err
+	}
+
+	value, err := c.next.Secret(ctx, name)
+	// Only definite answers are cached; transient failures are retried on the next call
+	if err == nil || errors.Is(err, errSecretNotFound) {
+		c.entries[name] = cachedSecret{value: value, err: err, expires: c.now().Add(c.ttl)}
+	}
+	return value, err
+}
+
+// optionalSecret returns the secret or "" when it is not configured
+func optionalSecret(ctx context.Context, p SecretProvider, name string) (string, error) {
+	v, err := p.Secret(ctx, name)
+	if errors.Is(err, errSecretNotFound) {
+		return "", nil
+	}
+	return v, err
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEnvSecrets(t *testing.T) {
+	t.Setenv("ZK_S3_SECRET_KEY", "from-env")
+
+	if v, err := (envSecrets{}).Secret(context.Background(), s3SecretKeySecret); err != nil || v != "from-env" {
+		t.Errorf("Expected from-env, got %q, %v", v, err)
+	}
+	if _, err := (envSecrets{}).Secret(context.Background(), "unset-secret"); !errors.Is(err, errSecretNotFound) {
+		t.Errorf("Expected errSecretNotFound, got %v", err)
+	}
+}
+
+func TestFileSecrets(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, adminTokenSecret), []byte("file-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	provider := fileSecrets{dir: dir}
+
+	tests := []struct {
+		name        string
+		secret      string
+		expected    string
+		expectedErr error
+	}{
+		{"Trailing newline trimmed", adminTokenSecret, "file-token", nil},
+		{"Missing file", "s3-access-key", "", errSecretNotFound},
+		{"Path traversal", "../etc/passwd", "", errors.New("invalid")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := provider.Secret(context.Background(), tt.secret)
+			if tt.expectedErr == nil && (err != nil || v != tt.expected) {
+				t.Errorf("Expected %q, got %q, %v", tt.expected, v, err)
+			}
+			if tt.expectedErr != nil && err == nil {
+				t.Errorf("Expected error, got %q", v)
+			}
+			if errors.Is(tt.expectedErr, errSecretNotFound) && !errors.Is(err, errSecretNotFound) {
+				t.Errorf("Expected errSecretNotFound, got %v", err)
+			}
+		})
+	}
+}
+
+func TestVaultSecrets(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("X-Vault-Token") != "root" {
+			http.Error(w, "permission denied", http.StatusForbidden)
+			return
+		}
+		if r.URL.Path != "/v1/kv/data/zk/prod" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"data": {"data": {"admin-token": "vault-token"}, "metadata": {"version": 3}}}`))
+	}))
+	defer server.Close()
+
+	provider, err := newSecretProvider(SecretsConfig{
+		Backend:  "vault",
+		CacheTTL: time.Minute,
+		Vault:    VaultConfig{Addr: server.URL, Token: "root", Mount: "kv", Path: "zk/prod"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if v, err := provider.Secret(context.Background(), adminTokenSecret); err != nil || v != "vault-token" {
+			t.Fatalf("Expected vault-token, got %q, %v", v, err)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("Expected the secret to be cached, got %d requests", requests)
+	}
+
+	if _, err := provider.Secret(context.Background(), s3AccessKeySecret); !errors.Is(err, errSecretNotFound) {
+		t.Errorf("Expected errSecretNotFound, got %v", err)
+	}
+
+	denied, _ := newVaultSecrets(VaultConfig{Addr: server.URL, Token: "wrong", Path: "zk/prod"})
+	if _, err := denied.Secret(context.Background(), adminTokenSecret); err == nil || errors.Is(err, errSecretNotFound) {
+		t.Errorf("Expected a permission error, got %v", err)
+	}
+}
+
+func TestRequireAdminSecretUnavailable(t *testing.T) {
+	previous := secrets
+	secrets = failingSecrets{}
+	t.Cleanup(func() { secrets = previous })
+
+	handler := requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Handler must not run when the admin token cannot be read")
+	})
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/admin/stats", nil)
+	req.Header.Set("Authorization", "Bearer anything")
+	handler(rr, req)
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", rr.Code)
+	}
+}
+
+type failingSecrets struct{}
+
+func (failingSecrets) Secret(context.Context, string) (string, error) {
+	return "", errors.New("vault sealed")
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// SeedConfig controls loading demo data at startup
+type SeedConfig struct {
+	Enabled bool
+	File    string // JSON DemoData; empty means defaultDemoData
+}
+
+// DemoUser is a seeded user with a balance and optional attributes
+type DemoUser struct {
+	ID         string           `json:"id"`
+	Balance    int              `json:"balance"`
+	Attributes map[string]int64 `json:"attributes,omitempty"`
+}
+
+// DemoProof is an example balance proof generated while seeding
+type DemoProof struct {
+	ID           string `json:"id"`
+	NeededAmount int    `json:"neededAmount"`
+}
+
+// DemoData is the set of users and example proofs loaded by POST /admin/seed
+type DemoData struct {
+	Users  []DemoUser  `json:"users"`
+	Proofs []DemoProof `json:"proofs"`
+}
+
+// SeededProof identifies a pre-generated proof in the proof store
+type SeededProof struct {
+	ID           string `json:"id"`
+	NeededAmount int    `json:"neededAmount"`
+	Digest       string `json:"digest,omitempty"`
+}
+
+// SeedResponse is returned by POST /admin/seed
+type SeedResponse struct {
+	Users  int           `json:"users"`
+	Proofs []SeededProof `json:"proofs"`
+}
+
+// defaultDemoData matches the defaults of the bundled frontend ("Alice", 1000, proving 500)
+var defaultDemoData = DemoData{
+	Users: []DemoUser{
+		{ID: "alice", Balance: 1000, Attributes: map[string]int64{"age": 34, "creditScore": 720}},
+		{ID: "bob", Balance: 250, Attributes: map[string]int64{"age": 19, "creditScore": 640}},
+		{ID: "carol", Balance: 50, Attributes: map[string]int64{"age": 67, "creditScore": 810}},
+	},
+	Proofs: []DemoProof{
+		{ID: "alice", NeededAmount: 500},
+		{ID: "bob", NeededAmount: 100},
+	},
+}
+
+// loadDemoData reads demo data from a JSON file, or returns defaultDemoData when path is empty
+func loadDemoData(path string) (DemoData, error) {
+	if path == "" {
+		return defaultDemoData, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return DemoData{}, err
+	}
+	var d DemoData
+	if err := unmarshalStrict(data, &d); err != nil {
+		return DemoData{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return d, d.check()
+}
+
+func (d DemoData) check() error {
+	balances := make(map[string]int, len(d.Users))
+	for _, u := range d.Users {
+		if u.ID == "" {
+			return errors.New("every demo user needs an id")
+		}
+		if _, ok := u.Attributes["balance"]; ok {
+			return fmt.Errorf("user %q: the balance is not an attribute", u.ID)
+		}
+		balances[u.ID] = u.Balance
+	}
+	for _, p := range d.Proofs {
+		balance, ok := balances[p.ID]
+		if !ok {
+			return fmt.Errorf("proof for %q: no such demo user", p.ID)
+		}
+		if p.NeededAmount > balance {
+			return fmt.Errorf("proof for %q: neededAmount exceeds the demo balance", p.ID)
+		}
+	}
+	return nil
+}
+
+// seedDemoData stores the demo users and generates their example proofs.
+// Existing data for the same ids is overwritten; other users are left alone.
+func seedDemoData(ctx context.Context, d DemoData) (SeedResponse, error) {
+	if err := d.check(); err != nil {
+		return SeedResponse{}, err
+	}
+
+	now := time.Now()
+	for _, u := range d.Users {
+		balancesMu.Lock()
+		setBalanceLocked(u.ID, u.Balance, now)
+		delete(balanceAttestations, u.ID)
+		balancesMu.Unlock()
+
+		for name, v := range u.Attributes {
+			setAttribute(u.ID, name, v)
+		}
+	}
+
+	resp := SeedResponse{Users: len(d.Users), Proofs: make([]SeededProof, 0, len(d.Proofs))}
+	for _, p := range d.Proofs {
+		_, digest, err := proveBalance(ctx, defaultCurve, p.ID, p.NeededAmount)
+		if err != nil {
+			return resp, fmt.Errorf("proof for %q: %w", p.ID, err)
+		}
+		resp.Proofs = append(resp.Proofs, SeededProof{ID: p.ID, NeededAmount: p.NeededAmount, Digest: digest})
+	}
+	return resp, nil
+}
+
+// seedDemo loads the posted demo data, or the built-in set when the body is empty
+func seedDemo(w http.ResponseWriter, r *http.Request) {
+	d := defaultDemoData
+	if r.ContentLength != 0 {
+		d = DemoData{}
+		if err := decodeJSON(w, r, &d); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+
+	if err := d.check(); err != nil {
+		writeError(w, errs.Wrap(errs.Invalid, err))
+		return
+	}
+
+	resp, err := seedDemoData(r.Context(), d)
+	if err != nil {
+		log.Printf("Failed to seed demo data: %v", err)
+		writeError(w, errs.Errorf(errs.Internal, "failed to generate demo proofs"))
+		return
+	}
+	writeJSON(w, resp)
+}
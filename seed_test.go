@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDemoDataCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    DemoData
+		wantErr bool
+	}{
+		{"Default set", defaultDemoData, false},
+		{"Missing id", DemoData{Users: []DemoUser{{Balance: 10}}}, true},
+		{"Balance as attribute", DemoData{Users: []DemoUser{{ID: "u", Attributes: map[string]int64{"balance": 1}}}}, true},
+		{"Proof for unknown user", DemoData{Proofs: []DemoProof{{ID: "nobody"}}}, true},
+		{"Proof above balance", DemoData{Users: []DemoUser{{ID: "u", Balance: 10}}, Proofs: []DemoProof{{ID: "u", NeededAmount: 11}}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.data.check(); (err != nil) != tt.wantErr {
+				t.Errorf("check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadDemoData(t *testing.T) {
+	if d, err := loadDemoData(""); err != nil || len(d.Users) != len(defaultDemoData.Users) {
+		t.Errorf("Expected the default set without a file, got %+v, %v", d, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "demo.json")
+	if err := os.WriteFile(path, []byte(`{"users": [{"id": "dave", "balance": 5}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	d, err := loadDemoData(path)
+	if err != nil || len(d.Users) != 1 || d.Users[0].ID != "dave" {
+		t.Errorf("Expected dave from the file, got %+v, %v", d, err)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"users": [], "extra": 1}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadDemoData(path); err == nil {
+		t.Error("Expected unknown fields to be rejected")
+	}
+}
+
+func TestSeedDemoStoresUsers(t *testing.T) {
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+
+	rr := postJSON(t, seedDemo, "/admin/seed", DemoData{
+		Users: []DemoUser{{ID: "dave", Balance: 300, Attributes: map[string]int64{"age": 41}}},
+	})
+	h.AssertStatusCode(rr, http.StatusOK, "seeding demo data")
+	h.AssertBalanceStored("dave", 300)
+	if got := attributeValues("dave")["age"]; got != 41 {
+		t.Errorf("Expected age 41, got %d", got)
+	}
+
+	rr = postJSON(t, seedDemo, "/admin/seed", DemoData{Proofs: []DemoProof{{ID: "nobody"}}})
+	h.AssertStatusCode(rr, http.StatusBadRequest, "seeding an inconsistent set")
+}
+
+func TestSeedDemoDefaultSet(t *testing.T) {
+	SkipIfShort(t, "seeding example proofs")
+
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+
+	resp, err := seedDemoData(context.Background(), defaultDemoData)
+	if err != nil {
+		t.Fatalf("seedDemoData failed: %v", err)
+	}
+	if resp.Users != len(defaultDemoData.Users) || len(resp.Proofs) != len(defaultDemoData.Proofs) {
+		t.Errorf("Unexpected seed result %+v", resp)
+	}
+	for _, p := range resp.Proofs {
+		if p.Digest == "" {
+			t.Errorf("Expected a stored proof for %s", p.ID)
+		}
+	}
+	h.AssertBalanceStored("alice", 1000)
+}
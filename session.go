@@ -0,0 +1,272 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+const (
+	sessionCookie = "zk_session"
+	csrfHeader    = "X-CSRF-Token"
+	sessionTTL    = 8 * time.Hour
+	maxUserIDLen  = 64
+)
+
+// How a session was signed in
+const (
+	sessionProviderDemo = "demo" // by name, for the shared demo
+	sessionProviderOIDC = "oidc" // by the identity provider, for the balance id of the subject
+)
+
+// session is a signed-in demo user. Sessions are kept by a hash of their cookie, so raw
+// cookies are never kept.
+type session struct {
+	user     string
+	provider string
+	csrf     string
+	expires  time.Time
+}
+
+var (
+	sessions     = make(map[string]*session) // by hashed cookie
+	sessionUsers = make(map[string]string)   // hashed cookie of the session each user is signed in with
+	sessionsMu   sync.Mutex
+)
+
+var (
+	errNotSignedIn   = errs.New(errs.Unauthorized, "not_signed_in", "not signed in")
+	errCSRF          = errs.New(errs.Forbidden, "csrf_token_invalid", "missing or invalid CSRF token")
+	errOtherUser     = errs.New(errs.Forbidden, "session_user_mismatch", "the session is signed in as another user")
+	errOtherSubject  = errs.New(errs.Forbidden, "token_subject_mismatch", "the access token was issued to another user")
+	errReaderUnknown = errs.New(errs.Unauthorized, "user_required", "reading a user's data needs their session or an access token issued to them")
+	errUserSignedIn  = errs.New(errs.Conflict, "user_signed_in", "the user is signed in in another session")
+)
+
+type SessionRequest struct {
+	ID string `json:"id"`
+}
+
+// SessionResponse describes the caller's session; the CSRF token must be sent back in
+// X-CSRF-Token with every state-changing request made with the session cookie
+type SessionResponse struct {
+	ID        string    `json:"id"`
+	Provider  string    `json:"provider"`
+	CSRFToken string    `json:"csrfToken"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+func (s session) response() SessionResponse {
+	return SessionResponse{ID: s.user, Provider: s.provider, CSRFToken: s.csrf, ExpiresAt: s.expires.UTC()}
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// endSessionLocked removes a session; callers must hold sessionsMu
+func endSessionLocked(key string) {
+	if s, ok := sessions[key]; ok {
+		delete(sessionUsers, s.user)
+		delete(sessions, key)
+	}
+}
+
+// pruneSessionsLocked removes expired sessions; callers must hold sessionsMu
+func pruneSessionsLocked(now time.Time) {
+	for key, s := range sessions {
+		if now.After(s.expires) {
+			endSessionLocked(key)
+		}
+	}
+}
+
+// requestSession returns the live session of the cookie r carries and its key.
+// ok is false for requests without a session cookie.
+func requestSession(r *http.Request) (s session, key string, ok bool, err error) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return session{}, "", false, nil
+	}
+	key = hashToken(cookie.Value)
+
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	found, exists := sessions[key]
+	if !exists || time.Now().After(found.expires) {
+		endSessionLocked(key)
+		return session{}, "", true, errNotSignedIn
+	}
+	return *found, key, true, nil
+}
+
+// checkCSRF compares the X-CSRF-Token header of r with the token of its session
+func checkCSRF(r *http.Request, s session) error {
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get(csrfHeader)), []byte(s.csrf)) != 1 {
+		return errCSRF
+	}
+	return nil
+}
+
+// checkSessionUser refuses a request made with a session cookie that lacks the session's
+// CSRF token or acts for another user than the one signed in. Requests without a session
+// cookie are API calls and act for the id they name.
+func checkSessionUser(r *http.Request, id string) error {
+	s, _, ok, err := requestSession(r)
+	if !ok || err != nil {
+		return err
+	}
+	if err := checkCSRF(r, s); err != nil {
+		return err
+	}
+	if id != s.user {
+		return errOtherUser
+	}
+	return nil
+}
+
+// checkReader lets a request read the data of user id only when it is made for that user: in
+// their session, or with a bearer token whose subject they are. Unlike writes, which API calls
+// without a session make for the id they name, reads without either are refused.
+func checkReader(r *http.Request, id string) error {
+	if _, _, ok, _ := requestSession(r); ok {
+		return checkSessionUser(r, id)
+	}
+	token := accessTokenOf(r.Context())
+	switch {
+	case token == nil:
+		return errReaderUnknown
+	case token.Subject != id:
+		return errOtherSubject
+	}
+	return nil
+}
+
+func setSessionCookie(w http.ResponseWriter, r *http.Request, value string, expires time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		MaxAge:   int(time.Until(expires).Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// startSession signs the caller in as user and sets the session cookie. A demo user can be
+// signed in in one session at a time, so visitors of a shared demo cannot act for each other;
+// users the identity provider signed in end their other session instead.
+func startSession(w http.ResponseWriter, r *http.Request, user, provider string) (session, error) {
+	token, err := randomToken()
+	if err != nil {
+		return session{}, err
+	}
+	csrf, err := randomToken()
+	if err != nil {
+		return session{}, err
+	}
+
+	now := time.Now()
+	_, previous, _, _ := requestSession(r)
+
+	sessionsMu.Lock()
+	pruneSessionsLocked(now)
+	if holder, ok := sessionUsers[user]; ok && holder != previous {
+		if provider != sessionProviderOIDC {
+			sessionsMu.Unlock()
+			return session{}, errUserSignedIn
+		}
+		endSessionLocked(holder)
+	}
+	// Signing in again replaces the caller's session
+	if previous != "" {
+		endSessionLocked(previous)
+	}
+	key := hashToken(token)
+	s := &session{user: user, provider: provider, csrf: csrf, expires: now.Add(sessionTTL)}
+	sessions[key] = s
+	sessionUsers[user] = key
+	sessionsMu.Unlock()
+
+	setSessionCookie(w, r, token, s.expires)
+	return *s, nil
+}
+
+// login signs the caller in as a demo user. With an identity provider configured, browser
+// users sign in through it instead.
+func login(w http.ResponseWriter, r *http.Request) {
+	if oidcProvider != nil {
+		writeError(w, errOIDCRequired)
+		return
+	}
+	var req SessionRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	if req.ID == "" || len(req.ID) > maxUserIDLen {
+		writeError(w, errs.Errorf(errs.Invalid, "id must be 1 to %d characters", maxUserIDLen))
+		return
+	}
+
+	s, err := startSession(w, r, req.ID, sessionProviderDemo)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, s.response())
+}
+
+// getSession returns the caller's session, including its CSRF token after a page reload
+func getSession(w http.ResponseWriter, r *http.Request) {
+	s, _, ok, err := requestSession(r)
+	if !ok {
+		err = errNotSignedIn
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, s.response())
+}
+
+// logout ends the caller's session
+func logout(w http.ResponseWriter, r *http.Request) {
+	s, key, ok, err := requestSession(r)
+	if !ok {
+		err = errNotSignedIn
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := checkCSRF(r, s); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	sessionsMu.Lock()
+	endSessionLocked(key)
+	sessionsMu.Unlock()
+
+	setSessionCookie(w, r, "", time.Unix(0, 0))
+	w.WriteHeader(http.StatusNoContent)
+}
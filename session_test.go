@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+func withSessions(t *testing.T) {
+	t.Helper()
+	sessionsMu.Lock()
+	previous, previousUsers := sessions, sessionUsers
+	sessions, sessionUsers = make(map[string]*session), make(map[string]string)
+	sessionsMu.Unlock()
+	t.Cleanup(func() {
+		sessionsMu.Lock()
+		sessions, sessionUsers = previous, previousUsers
+		sessionsMu.Unlock()
+	})
+}
+
+// sessionRequest calls handler with the given session cookie and CSRF token, either of which may be empty
+func sessionRequest(t *testing.T, handler http.HandlerFunc, method, path string, body any, cookie *http.Cookie, csrf string) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatalf("Failed to marshal request: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	if csrf != "" {
+		req.Header.Set(csrfHeader, csrf)
+	}
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	return rr
+}
+
+func TestSessionFlow(t *testing.T) {
+	withSessions(t)
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+
+	rr := sessionRequest(t, login, "POST", "/session", SessionRequest{ID: "alice"}, nil, "")
+	h.AssertStatusCode(rr, http.StatusOK, "signing in")
+	var signedIn SessionResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &signedIn); err != nil || signedIn.CSRFToken == "" {
+		t.Fatalf("Expected a CSRF token, got %s (%v)", rr.Body.String(), err)
+	}
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != sessionCookie || !cookies[0].HttpOnly || cookies[0].SameSite != http.SameSiteStrictMode {
+		t.Fatalf("Expected an HttpOnly, SameSite=Strict session cookie, got %+v", cookies)
+	}
+	cookie := cookies[0]
+
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+		csrf   string
+		id     string
+		status int
+		code   string
+	}{
+		{"Own balance", cookie, signedIn.CSRFToken, "alice", http.StatusOK, ""},
+		{"Missing CSRF token", cookie, "", "alice", http.StatusForbidden, "csrf_token_invalid"},
+		{"Wrong CSRF token", cookie, "forged", "alice", http.StatusForbidden, "csrf_token_invalid"},
+		{"Other user's balance", cookie, signedIn.CSRFToken, "bob", http.StatusForbidden, "session_user_mismatch"},
+		{"Unknown session", &http.Cookie{Name: sessionCookie, Value: "stale"}, signedIn.CSRFToken, "alice", http.StatusUnauthorized, "not_signed_in"},
+		{"API call without a session", nil, "", "bob", http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := sessionRequest(t, storeBalance, "POST", "/store/sum", BalanceRequest{ID: tt.id, Amount: 100}, tt.cookie, tt.csrf)
+			h.AssertStatusCode(rr, tt.status, tt.name)
+			if tt.code != "" && !bytes.Contains(rr.Body.Bytes(), []byte(`"code":"`+tt.code+`"`)) {
+				t.Errorf("Expected code %s, got %s", tt.code, rr.Body.String())
+			}
+		})
+	}
+
+	t.Run("User signed in elsewhere", func(t *testing.T) {
+		rr := sessionRequest(t, login, "POST", "/session", SessionRequest{ID: "alice"}, nil, "")
+		h.AssertStatusCode(rr, http.StatusConflict, "signing in as a user with a live session")
+	})
+
+	t.Run("Session after reload", func(t *testing.T) {
+		rr := sessionRequest(t, getSession, "GET", "/session", nil, cookie, "")
+		h.AssertStatusCode(rr, http.StatusOK, "reading the session")
+		var resp SessionResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || resp.ID != "alice" || resp.CSRFToken != signedIn.CSRFToken {
+			t.Errorf("Expected alice's session, got %s", rr.Body.String())
+		}
+	})
+
+	t.Run("Sign out", func(t *testing.T) {
+		h.AssertStatusCode(sessionRequest(t, logout, "DELETE", "/session", nil, cookie, ""), http.StatusForbidden, "signing out without CSRF token")
+		h.AssertStatusCode(sessionRequest(t, logout, "DELETE", "/session", nil, cookie, signedIn.CSRFToken), http.StatusNoContent, "signing out")
+		h.AssertStatusCode(sessionRequest(t, getSession, "GET", "/session", nil, cookie, ""), http.StatusUnauthorized, "reading an ended session")
+		h.AssertStatusCode(sessionRequest(t, login, "POST", "/session", SessionRequest{ID: "alice"}, nil, ""), http.StatusOK, "signing in after sign out")
+	})
+}
+
+func TestLoginValidatesID(t *testing.T) {
+	withSessions(t)
+	for _, id := range []string{"", string(bytes.Repeat([]byte("a"), maxUserIDLen+1))} {
+		rr := sessionRequest(t, login, "POST", "/session", SessionRequest{ID: id}, nil, "")
+		if rr.Code != errs.Invalid.Status() {
+			t.Errorf("Expected id %q to be rejected, got %d", id, rr.Code)
+		}
+	}
+}
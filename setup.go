@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	groth16_bls12381 "github.com/consensys/gnark/backend/groth16/bls12-381"
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/constraint"
+	"github.com/consensys/gnark/frontend"
+	"github.com/korjavin/zkTest1/internal/errs"
+	"github.com/korjavin/zkTest1/keys"
+)
+
+// circuitSetup holds the compiled constraint system and Groth16 keys of a circuit on one curve
+type circuitSetup struct {
+	name    string // circuit name, suffixed with the curve when it is not the default
+	curve   ecc.ID
+	circuit frontend.Circuit // the empty circuit it was compiled from
+	ccs     constraint.ConstraintSystem
+	pk      groth16.ProvingKey
+	vk      groth16.VerifyingKey
+	keyID   string            // identifies vk, see verifyingKeyID
+	retired []keys.RetiredKey // keys replaced by rotation that still verify
+	created time.Time         // when the keys were generated
+
+	// verifyOnly says why the proving key could not be loaded; pk is nil when it is set
+	verifyOnly string
+}
+
+var errProvingUnavailable = errs.New(errs.Unavailable, "proving_unavailable", "proving is unavailable for this circuit, proofs can only be verified")
+
+// loadOrCreateKeys reads persisted keys for a circuit, running the Groth16 setup and
+// persisting its result when the key store has none. When only the verifying key can be
+// read, it is returned without a proving key and verifyOnly says why.
+func loadOrCreateKeys(name string, ccs constraint.ConstraintSystem) (pk groth16.ProvingKey, vk groth16.VerifyingKey, verifyOnly string, err error) {
+	if keyStore != nil {
+		pk, vk, found, err := keyStore.Load(name)
+		if err != nil || !found {
+			// A new setup would invalidate every proof issued with a persisted verifying key,
+			// so without the proving key the circuit only verifies
+			vk, vkErr := keyStore.LoadVerifyingKey(name)
+			if vkErr != nil {
+				if err != nil {
+					return nil, nil, "", err
+				}
+				if !errors.Is(vkErr, os.ErrNotExist) {
+					return nil, nil, "", vkErr
+				}
+			} else {
+				if err := keyStore.Verify(name, ccs, vk); err != nil {
+					return nil, nil, "", fmt.Errorf("%w: %w", errs.ErrKeyMismatch, err)
+				}
+				verifyOnly = name + ": proving key is missing"
+				if err != nil {
+					verifyOnly = err.Error()
+				}
+				log.Printf("⚠️  Serving %s verify-only: %s", name, verifyOnly)
+				return nil, vk, verifyOnly, nil
+			}
+		}
+		if found {
+			// Keys of a changed circuit would fail every proof, so they are refused outright
+			if err := keyStore.Verify(name, ccs, vk); err != nil {
+				return nil, nil, "", fmt.Errorf("%w: %w", errs.ErrKeyMismatch, err)
+			}
+			return pk, vk, "", nil
+		}
+	}
+
+	pk, vk, err = groth16.Setup(ccs)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	if keyStore != nil {
+		if err := keyStore.Save(name, ccs, pk, vk); err != nil {
+			return nil, nil, "", fmt.Errorf("persisting keys of %s: %w", name, err)
+		}
+	}
+	return pk, vk, "", nil
+}
+
+// errDeadlineTooShort is returned instead of starting a proof the caller's deadline leaves no time for
+var errDeadlineTooShort = fmt.Errorf("%w: not enough time left to prove", context.DeadlineExceeded)
+
+// checkProvingTime fails when ctx is done, or when its deadline is closer than the time the
+// latest proof of circuit took. gnark cannot interrupt a proof once it has started.
+func checkProvingTime(ctx context.Context, circuit string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < usage.lastProvingTime(circuit) {
+		return errDeadlineTooShort
+	}
+	return nil
+}
+
+// isContextError reports whether err means the caller's context was cancelled or ran out of time
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// prove creates a full witness from assignment and proves it, unless ctx ends first
+func (s *circuitSetup) prove(ctx context.Context, assignment frontend.Circuit) (groth16.Proof, error) {
+	if s.pk == nil {
+		return nil, fmt.Errorf("%w: %s", errProvingUnavailable, s.verifyOnly)
+	}
+	witness, err := frontend.NewWitness(assignment, s.curve.ScalarField())
+	if err != nil {
+		return nil, err
+	}
+
+	var proof groth16.Proof
+	err = provers.run(ctx, s.name, shapeOfSystem(s.ccs).memory(s.curve), func() error {
+		// Checked once a worker is free, as waiting for one takes from the caller's time
+		if err := checkProvingTime(ctx, s.name); err != nil {
+			return err
+		}
+		start := time.Now()
+		var err error
+		proof, err = groth16.Prove(s.ccs, s.pk, witness)
+		usage.recordProof(s.name, time.Since(start), err)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Nobody is waiting for a proof finished after the caller gave up, so it is not issued
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	timingsOf(ctx).addProofSize(proof)
+	return proof, nil
+}
+
+// verify checks a proof against the public part of assignment.
+// It returns errInvalidProof when the proof does not verify.
+func (s *circuitSetup) verify(ctx context.Context, proof groth16.Proof, assignment frontend.Circuit) error {
+	publicWitness, err := frontend.NewWitness(assignment, s.curve.ScalarField(), frontend.PublicOnly())
+	if err != nil {
+		usage.recordValidation(s.name, err)
+		auditVerification(s.name, proof, err)
+		return err
+	}
+	return s.verifyWitness(ctx, proof, publicWitness)
+}
+
+// verifyWitness checks a proof against a public witness, with the current key or one replaced
+// by rotation within its grace window. It returns errInvalidProof when the proof does not verify.
+func (s *circuitSetup) verifyWitness(ctx context.Context, proof groth16.Proof, publicWitness witness.Witness) error {
+	err := s.checkWitness(ctx, proof, publicWitness)
+	recordVerification(s.name, proof, err)
+	return err
+}
+
+// checkWitness is verifyWitness without counting or auditing the attempt, for dry runs.
+// Outcomes with the current key are cached; proofs that only verify with a retired key are
+// not, as they stop verifying when its grace window ends.
+func (s *circuitSetup) checkWitness(ctx context.Context, proof groth16.Proof, publicWitness witness.Witness) error {
+	start := time.Now()
+	defer func() { timingsOf(ctx).addVerification(time.Since(start)) }()
+
+	key, keyErr := verificationKey(s.keyID, proof, publicWitness)
+	if keyErr == nil {
+		if valid, ok := verifications.get(key); ok {
+			if !valid {
+				return errInvalidProof
+			}
+			return nil
+		}
+	}
+
+	if err := verifyGroth16(proof, s.vk, publicWitness); err != nil {
+		if s.verifyRetired(proof, publicWitness, time.Now()) {
+			return nil
+		}
+		if keyErr == nil {
+			verifications.put(key, false)
+		}
+		return errInvalidProof
+	}
+	if keyErr == nil {
+		verifications.put(key, true)
+	}
+	return nil
+}
+
+// verifyGroth16 is groth16.Verify for proofs from clients. gnark reads the commitments a
+// verifying key expects, such as the range checker's, from the proof without checking that it
+// has them, so a proof with the wrong number is rejected here instead of panicking.
+func verifyGroth16(proof groth16.Proof, vk groth16.VerifyingKey, public witness.Witness) error {
+	var got, want int
+	switch p := proof.(type) {
+	case *groth16_bn254.Proof:
+		k, ok := vk.(*groth16_bn254.VerifyingKey)
+		if !ok {
+			return errInvalidProof
+		}
+		got, want = len(p.Commitments), len(k.PublicAndCommitmentCommitted)
+	case *groth16_bls12381.Proof:
+		k, ok := vk.(*groth16_bls12381.VerifyingKey)
+		if !ok {
+			return errInvalidProof
+		}
+		got, want = len(p.Commitments), len(k.PublicAndCommitmentCommitted)
+	}
+	if got != want {
+		return errInvalidProof
+	}
+	return groth16.Verify(proof, vk, public)
+}
+
+// recordVerification counts and audits a verification that reached the SNARK check.
+// Failures before it, such as an unreachable key, are not verification outcomes.
+func recordVerification(circuit string, proof groth16.Proof, err error) {
+	if err != nil && !errors.Is(err, errInvalidProof) {
+		return
+	}
+	usage.recordValidation(circuit, err)
+	auditVerification(circuit, proof, err)
+}
+
+// decodeProofJSON decodes a JSON-encoded Groth16 proof on curve into its concrete type
+func decodeProofJSON(curve ecc.ID, data []byte) (groth16.Proof, error) {
+	proof := groth16.NewProof(curve)
+	if err := json.Unmarshal(data, proof); err != nil {
+		return nil, err
+	}
+	return proof, nil
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// Names of the secrets used by the signing backends
+const (
+	signingKeySecret     = "signing-key"      // local: PEM-encoded P-256 private key
+	kmsAccessKeySecret   = "kms-access-key"   // aws-kms
+	kmsSecretKeySecret   = "kms-secret-key"   // aws-kms
+	gcpAccessTokenSecret = "gcp-access-token" // gcp-kms: OAuth2 access token
+)
+
+// Signer signs on behalf of the server (receipts, webhooks, envelopes) with an ES256 key.
+// Sign receives a SHA-256 digest and returns an ASN.1 DER ECDSA signature.
+type Signer interface {
+	crypto.Signer
+	KeyID() string
+}
+
+// signer is the process-wide signer, replaced from configuration at startup
+var signer Signer
+
+// SigningConfig selects where the server's signing key lives
+type SigningConfig struct {
+	Backend     string // "local", "aws-kms", "gcp-kms" or "pkcs11"
+	KeyID       string // KMS key ID/ARN, or GCP CryptoKeyVersion resource name
+	Region      string // aws-kms
+	Endpoint    string // KMS API endpoint override
+	DID         string // did:web the server publishes its key under; the key's did:key when empty
+	HTTPTimeout time.Duration
+}
+
+func newSigner(cfg SigningConfig, p SecretProvider) (Signer, error) {
+	client := &http.Client{Timeout: cfg.HTTPTimeout}
+
+	switch cfg.Backend {
+	case "", "local":
+		return newLocalSigner(p)
+	case "aws-kms":
+		accessKey, err := p.Secret(context.Background(), kmsAccessKeySecret)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", kmsAccessKeySecret, err)
+		}
+		secretKey, err := p.Secret(context.Background(), kmsSecretKeySecret)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", kmsSecretKeySecret, err)
+		}
+		return newAWSKMSSigner(cfg, sigV4{AccessKey: accessKey, SecretKey: secretKey, Region: cfg.Region, Service: "kms"}, client)
+	case "gcp-kms":
+		token, err := p.Secret(context.Background(), gcpAccessTokenSecret)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", gcpAccessTokenSecret, err)
+		}
+		return newGCPKMSSigner(cfg, token, client)
+	case "pkcs11":
+		return nil, errors.New("pkcs11 signing requires a build with PKCS#11 support, which this binary does not include")
+	default:
+		return nil, fmt.Errorf("unknown signing backend %q", cfg.Backend)
+	}
+}
+
+// signMessage hashes message with SHA-256 and signs it
+func signMessage(s Signer, message []byte) ([]byte, error) {
+	digest := sha256.Sum256(message)
+	return s.Sign(rand.Reader, digest[:], crypto.SHA256)
+}
+
+// publicKeyID derives a stable key ID from the SHA-256 of the SPKI encoding
+func publicKeyID(pub *ecdsa.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:8])
+}
+
+// localSigner keeps the signing key in process memory
+type localSigner struct {
+	*ecdsa.PrivateKey
+	kid string
+}
+
+func newLocalSigner(p SecretProvider) (*localSigner, error) {
+	pemKey, err := p.Secret(context.Background(), signingKeySecret)
+	if errors.Is(err, errSecretNotFound) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("No %s configured, using an ephemeral signing key", signingKeySecret)
+		return &localSigner{PrivateKey: key, kid: publicKeyID(&key.PublicKey)}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", signingKeySecret, err)
+	}
+
+	key, err := parseECPrivateKey([]byte(pemKey))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", signingKeySecret, err)
+	}
+	return &localSigner{PrivateKey: key, kid: publicKeyID(&key.PublicKey)}, nil
+}
+
+func parseECPrivateKey(data []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("expected a PEM-encoded private key")
+	}
+
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ec, ok := key.(*ecdsa.PrivateKey)
+	if !ok || ec.Curve != elliptic.P256() {
+		return nil, errors.New("key must be a P-256 ECDSA key")
+	}
+	return ec, nil
+}
+
+func (s *localSigner) KeyID() string { return s.kid }
+
+// kmsSigner delegates signing to a remote KMS; the private key never leaves it
+type kmsSigner struct {
+	keyID  string
+	public *ecdsa.PublicKey
+	sign   func(digest []byte) ([]byte, error)
+}
+
+func (s *kmsSigner) Public() crypto.PublicKey { return s.public }
+
+func (s *kmsSigner) KeyID() string { return s.keyID }
+
+func (s *kmsSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts.HashFunc() != crypto.SHA256 || len(digest) != sha256.Size {
+		return nil, errors.New("kms signer only signs SHA-256 digests")
+	}
+	return s.sign(digest)
+}
+
+func parseECPublicKeyDER(der []byte) (*ecdsa.PublicKey, error) {
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+	ec, ok := key.(*ecdsa.PublicKey)
+	if !ok || ec.Curve != elliptic.P256() {
+		return nil, errors.New("kms key must be a P-256 ECDSA key")
+	}
+	return ec, nil
+}
+
+// kmsCall posts a JSON request and decodes the JSON response
+func kmsCall(client *http.Client, req *http.Request, out interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("kms %s: %s: %s", req.URL.Path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, out)
+}
+
+// newAWSKMSSigner signs with an ECC_NIST_P256 key in AWS KMS through its JSON API
+func newAWSKMSSigner(cfg SigningConfig, creds sigV4, client *http.Client) (*kmsSigner, error) {
+	if cfg.KeyID == "" || cfg.Region == "" {
+		return nil, errors.New("aws-kms signing requires a key ID and region")
+	}
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = "https://kms." + cfg.Region + ".amazonaws.com/"
+	}
+
+	call := func(target string, params, out interface{}) error {
+		body, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+		req.Header.Set("X-Amz-Target", "TrentService."+target)
+		creds.sign(req, hashHex(body), time.Now())
+		return kmsCall(client, req, out)
+	}
+
+	var pub struct {
+		PublicKey []byte
+	}
+	if err := call("GetPublicKey", map[string]string{"KeyId": cfg.KeyID}, &pub); err != nil {
+		return nil, err
+	}
+	public, err := parseECPublicKeyDER(pub.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kmsSigner{keyID: cfg.KeyID, public: public, sign: func(digest []byte) ([]byte, error) {
+		var out struct {
+			Signature []byte
+		}
+		err := call("Sign", map[string]interface{}{
+			"KeyId":            cfg.KeyID,
+			"Message":          digest,
+			"MessageType":      "DIGEST",
+			"SigningAlgorithm": "ECDSA_SHA_256",
+		}, &out)
+		return out.Signature, err
+	}}, nil
+}
+
+// newGCPKMSSigner signs with an EC_SIGN_P256_SHA256 CryptoKeyVersion in Google Cloud KMS
+func newGCPKMSSigner(cfg SigningConfig, token string, client *http.Client) (*kmsSigner, error) {
+	if cfg.KeyID == "" {
+		return nil, errors.New("gcp-kms signing requires a CryptoKeyVersion resource name")
+	}
+	endpoint := strings.TrimRight(cfg.Endpoint, "/")
+	if endpoint == "" {
+		endpoint = "https://cloudkms.googleapis.com"
+	}
+	resource := endpoint + "/v1/" + strings.TrimPrefix(cfg.KeyID, "/")
+
+	newRequest := func(method, url string, body []byte) (*http.Request, error) {
+		req, err := http.NewRequest(method, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	}
+
+	req, err := newRequest(http.MethodGet, resource+"/publicKey", nil)
+	if err != nil {
+		return nil, err
+	}
+	var pub struct {
+		Pem string `json:"pem"`
+	}
+	if err := kmsCall(client, req, &pub); err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode([]byte(pub.Pem))
+	if block == nil {
+		return nil, errors.New("gcp-kms returned an invalid public key")
+	}
+	public, err := parseECPublicKeyDER(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kmsSigner{keyID: cfg.KeyID, public: public, sign: func(digest []byte) ([]byte, error) {
+		body, err := json.Marshal(map[string]map[string][]byte{"digest": {"sha256": digest}})
+		if err != nil {
+			return nil, err
+		}
+		req, err := newRequest(http.MethodPost, resource+":asymmetricSign", body)
+		if err != nil {
+			return nil, err
+		}
+		var out struct {
+			Signature []byte `json:"signature"`
+		}
+		err = kmsCall(client, req, &out)
+		return out.Signature, err
+	}}, nil
+}
+
+// SigningKey is the public signing key as a JWK
+type SigningKey struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+}
+
+func signingJWK(s Signer) (SigningKey, error) {
+	pub, ok := s.Public().(*ecdsa.PublicKey)
+	if !ok {
+		return SigningKey{}, errors.New("signing key is not an ECDSA key")
+	}
+	return SigningKey{
+		Kty: "EC",
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(padCoordinate(pub.X)),
+		Y:   base64.RawURLEncoding.EncodeToString(padCoordinate(pub.Y)),
+		Kid: s.KeyID(),
+		Alg: "ES256",
+		Use: "sig",
+	}, nil
+}
+
+func padCoordinate(v *big.Int) []byte {
+	return v.FillBytes(make([]byte, 32))
+}
+
+// getSigningKey publishes the server's public signing key so signatures can be checked
+func getSigningKey(w http.ResponseWriter, r *http.Request) {
+	if signer == nil {
+		writeError(w, errs.Errorf(errs.Unavailable, "signing is not configured"))
+		return
+	}
+	jwk, err := signingJWK(signer)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, jwk)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mapSecrets is a SecretProvider backed by a map
+type mapSecrets map[string]string
+
+func (m mapSecrets) Secret(_ context.Context, name string) (string, error) {
+	if v, ok := m[name]; ok {
+		return v, nil
+	}
+	return "", errSecretNotFound
+}
+
+func mustGenerateKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func assertSignatureVerifies(t *testing.T, s Signer, pub *ecdsa.PublicKey) {
+	t.Helper()
+	message := []byte("verification receipt")
+	sig, err := signMessage(s, message)
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	digest := sha256.Sum256(message)
+	if !ecdsa.VerifyASN1(pub, digest[:], sig) {
+		t.Error("Expected signature to verify with the signer's public key")
+	}
+}
+
+func TestLocalSigner(t *testing.T) {
+	key := mustGenerateKey(t)
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	pemKey := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+
+	s, err := newSigner(SigningConfig{Backend: "local"}, mapSecrets{signingKeySecret: pemKey})
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+	if s.KeyID() != publicKeyID(&key.PublicKey) {
+		t.Errorf("Expected key ID derived from the configured key")
+	}
+	assertSignatureVerifies(t, s, &key.PublicKey)
+
+	ephemeral, err := newSigner(SigningConfig{}, mapSecrets{})
+	if err != nil {
+		t.Fatalf("Failed to create ephemeral signer: %v", err)
+	}
+	assertSignatureVerifies(t, ephemeral, ephemeral.Public().(*ecdsa.PublicKey))
+
+	if _, err := newSigner(SigningConfig{}, mapSecrets{signingKeySecret: "not pem"}); err == nil {
+		t.Error("Expected an invalid signing key to be rejected")
+	}
+	if _, err := newSigner(SigningConfig{Backend: "pkcs11"}, mapSecrets{}); err == nil {
+		t.Error("Expected pkcs11 to report that it is unavailable")
+	}
+}
+
+func TestAWSKMSSigner(t *testing.T) {
+	key := mustGenerateKey(t)
+	spki, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Authorization"), "/us-west-2/kms/aws4_request") ||
+			!strings.Contains(r.Header.Get("Authorization"), "x-amz-target") {
+			http.Error(w, "bad signature", http.StatusForbidden)
+			return
+		}
+		var req struct {
+			KeyId       string
+			Message     []byte
+			MessageType string
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.KeyId != "alias/zk" {
+			http.Error(w, "unknown key", http.StatusBadRequest)
+			return
+		}
+
+		switch r.Header.Get("X-Amz-Target") {
+		case "TrentService.GetPublicKey":
+			json.NewEncoder(w).Encode(map[string][]byte{"PublicKey": spki})
+		case "TrentService.Sign":
+			sig, _ := ecdsa.SignASN1(rand.Reader, key, req.Message)
+			json.NewEncoder(w).Encode(map[string][]byte{"Signature": sig})
+		default:
+			http.Error(w, "unknown target", http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	s, err := newSigner(SigningConfig{Backend: "aws-kms", KeyID: "alias/zk", Region: "us-west-2", Endpoint: server.URL, HTTPTimeout: time.Second},
+		mapSecrets{kmsAccessKeySecret: "AKID", kmsSecretKeySecret: "secret"})
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+	assertSignatureVerifies(t, s, &key.PublicKey)
+
+	if _, err := newSigner(SigningConfig{Backend: "aws-kms", KeyID: "alias/zk", Region: "us-west-2"}, mapSecrets{}); err == nil {
+		t.Error("Expected missing KMS credentials to be reported")
+	}
+}
+
+func TestGCPKMSSigner(t *testing.T) {
+	key := mustGenerateKey(t)
+	spki, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	keyVersion := "projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer ya29.token" {
+			http.Error(w, "unauthenticated", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/" + keyVersion + "/publicKey":
+			json.NewEncoder(w).Encode(map[string]string{"pem": string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: spki}))})
+		case "/v1/" + keyVersion + ":asymmetricSign":
+			var req struct {
+				Digest struct {
+					Sha256 []byte `json:"sha256"`
+				} `json:"digest"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			sig, _ := ecdsa.SignASN1(rand.Reader, key, req.Digest.Sha256)
+			json.NewEncoder(w).Encode(map[string][]byte{"signature": sig})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	s, err := newSigner(SigningConfig{Backend: "gcp-kms", KeyID: keyVersion, Endpoint: server.URL, HTTPTimeout: time.Second},
+		mapSecrets{gcpAccessTokenSecret: "ya29.token"})
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+	assertSignatureVerifies(t, s, &key.PublicKey)
+}
+
+func TestGetSigningKey(t *testing.T) {
+	previous := signer
+	t.Cleanup(func() { signer = previous })
+
+	signer = nil
+	rr := httptest.NewRecorder()
+	getSigningKey(rr, httptest.NewRequest("GET", "/keys/signing", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 without a signer, got %d", rr.Code)
+	}
+
+	signer, _ = newLocalSigner(mapSecrets{})
+	rr = httptest.NewRecorder()
+	getSigningKey(rr, httptest.NewRequest("GET", "/keys/signing", nil))
+
+	var jwk SigningKey
+	if err := json.Unmarshal(rr.Body.Bytes(), &jwk); err != nil {
+		t.Fatalf("Failed to decode JWK: %v", err)
+	}
+	if jwk.Kty != "EC" || jwk.Crv != "P-256" || jwk.Alg != "ES256" || jwk.Kid != signer.KeyID() || len(jwk.X) != 43 {
+		t.Errorf("Unexpected JWK: %+v", jwk)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// deletedBalance is a soft-deleted balance record, kept for the retention window so it can be restored
+type deletedBalance struct {
+	Amount      int
+	Updated     time.Time
+	Attestation *BalanceAttestation
+	DeletedAt   time.Time
+}
+
+// deletedBalances holds soft-deleted balances by id; guarded by balancesMu
+var deletedBalances = make(map[string]deletedBalance)
+
+var (
+	errNotDeleted    = errs.New(errs.NotFound, "not_deleted", "no deleted balance to restore")
+	errBalanceExists = errs.New(errs.Conflict, "balance_exists", "a new balance was stored since the deletion")
+)
+
+// softDeleteLocked moves the balance of id to deletedBalances; callers must hold balancesMu
+func softDeleteLocked(id string, now time.Time) bool {
+	amount, ok := balances[id]
+	if !ok {
+		return false
+	}
+	record := deletedBalance{Amount: amount, Updated: balanceUpdated[id], DeletedAt: now}
+	if a, ok := balanceAttestations[id]; ok {
+		record.Attestation = &a
+	}
+	deletedBalances[id] = record
+
+	delete(balances, id)
+	delete(balanceUpdated, id)
+	delete(balanceVersions, id)
+	delete(balanceAttestations, id)
+	return true
+}
+
+// softDeleteBalance removes the balance of id from use, keeping it restorable
+func softDeleteBalance(id string, now time.Time) error {
+	balancesMu.Lock()
+	deleted := softDeleteLocked(id, now)
+	balancesMu.Unlock()
+
+	if !deleted {
+		return errBalanceNotFound
+	}
+	audit.record(AuditEvent{Type: auditBalanceDeleted, Detail: "admin"})
+	return nil
+}
+
+// restoreBalance brings back a soft-deleted balance with its attestation and update time
+func restoreBalance(id string) error {
+	balancesMu.Lock()
+	defer balancesMu.Unlock()
+
+	record, ok := deletedBalances[id]
+	if !ok {
+		return errNotDeleted
+	}
+	if _, ok := balances[id]; ok {
+		return errBalanceExists
+	}
+
+	setBalanceLocked(id, record.Amount, record.Updated)
+	if record.Attestation != nil {
+		balanceAttestations[id] = *record.Attestation
+	}
+	delete(deletedBalances, id)
+
+	audit.record(AuditEvent{Type: auditBalanceRestored})
+	return nil
+}
+
+// purgeDeletedBalances permanently removes balances deleted more than retention ago
+func purgeDeletedBalances(now time.Time, retention time.Duration) int {
+	balancesMu.Lock()
+	defer balancesMu.Unlock()
+
+	purged := 0
+	for id, record := range deletedBalances {
+		if now.Sub(record.DeletedAt) > retention {
+			delete(deletedBalances, id)
+			purged++
+		}
+	}
+	return purged
+}
+
+// deleteBalance soft-deletes a balance; it can be restored until the retention window ends
+func deleteBalance(w http.ResponseWriter, r *http.Request) {
+	if err := softDeleteBalance(r.PathValue("id"), time.Now()); err != nil {
+		writeError(w, errs.Wrap(errs.NotFound, err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// restoreDeletedBalance undoes a soft deletion
+func restoreDeletedBalance(w http.ResponseWriter, r *http.Request) {
+	if err := restoreBalance(r.PathValue("id")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
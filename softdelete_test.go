@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func adminBalanceRequest(handler http.HandlerFunc, method, path, id string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.SetPathValue("id", id)
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	return rr
+}
+
+func TestSoftDeleteAndRestore(t *testing.T) {
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+	h.StoreBalance("soft_user", 300)
+
+	rr := adminBalanceRequest(deleteBalance, "DELETE", "/admin/balances/soft_user", "soft_user")
+	h.AssertStatusCode(rr, http.StatusNoContent, "deleting balance")
+
+	rr, _ = h.GenerateProof("soft_user", 100)
+	h.AssertStatusCode(rr, http.StatusNotFound, "proving with a deleted balance")
+
+	rr = adminBalanceRequest(restoreDeletedBalance, "POST", "/admin/balances/soft_user/restore", "soft_user")
+	h.AssertStatusCode(rr, http.StatusNoContent, "restoring balance")
+	h.AssertBalanceStored("soft_user", 300)
+
+	tests := []struct {
+		name           string
+		handler        http.HandlerFunc
+		method         string
+		id             string
+		expectedStatus int
+	}{
+		{"Restore twice", restoreDeletedBalance, "POST", "soft_user", http.StatusNotFound},
+		{"Delete unknown", deleteBalance, "DELETE", "nobody", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := adminBalanceRequest(tt.handler, tt.method, "/admin/balances/"+tt.id, tt.id)
+			h.AssertStatusCode(rr, tt.expectedStatus, tt.name)
+		})
+	}
+}
+
+func TestRestoreConflictsWithNewBalance(t *testing.T) {
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+	h.StoreBalance("soft_user", 300)
+
+	if err := softDeleteBalance("soft_user", time.Now()); err != nil {
+		t.Fatalf("softDeleteBalance failed: %v", err)
+	}
+	h.StoreBalance("soft_user", 50)
+
+	rr := adminBalanceRequest(restoreDeletedBalance, "POST", "/admin/balances/soft_user/restore", "soft_user")
+	h.AssertStatusCode(rr, http.StatusConflict, "restoring over a new balance")
+	h.AssertBalanceStored("soft_user", 50)
+}
+
+func TestPurgeDeletedBalances(t *testing.T) {
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+	h.StoreBalance("old", 1)
+	h.StoreBalance("recent", 2)
+
+	now := time.Now()
+	_ = softDeleteBalance("old", now.Add(-48*time.Hour))
+	_ = softDeleteBalance("recent", now)
+
+	if purged := purgeDeletedBalances(now, 24*time.Hour); purged != 1 {
+		t.Errorf("Expected 1 deleted balance purged, got %d", purged)
+	}
+	if err := restoreBalance("old"); err != errNotDeleted {
+		t.Errorf("Expected the purged balance to be gone, got %v", err)
+	}
+	if err := restoreBalance("recent"); err != nil {
+		t.Errorf("Expected the recent deletion to be restorable, got %v", err)
+	}
+}
@@ -0,0 +1,486 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/bits"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/korjavin/zkTest1/circuits"
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// Identity of the circuits built from statements; statements of the same shape share a circuit
+const (
+	statementCircuitPrefix  = "statement/"
+	statementCircuitVersion = 2
+)
+
+const (
+	// maxStatementPredicates bounds the size of a statement's circuit
+	maxStatementPredicates = 8
+
+	// maxSumAttributes bounds the attributes added up by one predicate
+	maxSumAttributes = 8
+
+	// statementValueBits is the width values are range checked to, so sums cannot wrap around
+	statementValueBits = 64
+)
+
+var errStatementNotFound = errs.New(errs.NotFound, "statement_not_found", "statement not found")
+
+// statementOps maps the comparison operators of the DSL to the names used in circuit names
+var statementOps = map[string]string{
+	">=":      "gte",
+	">":       "gt",
+	"<=":      "lte",
+	"<":       "lt",
+	"==":      "eq",
+	"!=":      "ne",
+	"between": "between",
+}
+
+// StatementPredicate compares an attribute, or the sum of several, with public bounds
+type StatementPredicate struct {
+	Attribute string   `json:"attribute,omitempty"`
+	Sum       []string `json:"sum,omitempty"`
+	Op        string   `json:"op"`
+	Value     int64    `json:"value,omitempty"` // bound of comparisons
+	Min       int64    `json:"min,omitempty"`   // inclusive bounds of between
+	Max       int64    `json:"max,omitempty"`
+}
+
+// attributes lists the attributes the predicate adds up
+func (p StatementPredicate) attributes() []string {
+	if p.Attribute != "" {
+		return []string{p.Attribute}
+	}
+	return p.Sum
+}
+
+// bounds lists the public inputs of the predicate
+func (p StatementPredicate) bounds() []int64 {
+	if p.Op == "between" {
+		return []int64{p.Min, p.Max}
+	}
+	return []int64{p.Value}
+}
+
+// holds evaluates the predicate on a value outside the circuit
+func (p StatementPredicate) holds(v int64) bool {
+	switch p.Op {
+	case ">=":
+		return v >= p.Value
+	case ">":
+		return v > p.Value
+	case "<=":
+		return v <= p.Value
+	case "<":
+		return v < p.Value
+	case "==":
+		return v == p.Value
+	case "!=":
+		return v != p.Value
+	default:
+		return p.Min <= v && v <= p.Max
+	}
+}
+
+func (p StatementPredicate) String() string {
+	term := strings.Join(p.attributes(), " + ")
+	if p.Op == "between" {
+		return fmt.Sprintf("%d <= %s <= %d", p.Min, term, p.Max)
+	}
+	return fmt.Sprintf("%s %s %d", term, p.Op, p.Value)
+}
+
+func (p StatementPredicate) check() error {
+	switch {
+	case (p.Attribute == "") == (len(p.Sum) == 0):
+		return errors.New("set either attribute or sum")
+	case p.Attribute == "" && (len(p.Sum) < 2 || len(p.Sum) > maxSumAttributes):
+		return fmt.Errorf("sum takes 2 to %d attributes", maxSumAttributes)
+	}
+	for i, name := range p.Sum {
+		if name == "" || slices.Contains(p.Sum[:i], name) {
+			return errors.New("sum takes distinct attribute names")
+		}
+	}
+
+	if _, ok := statementOps[p.Op]; !ok {
+		return fmt.Errorf("unknown op %q", p.Op)
+	}
+	if p.Op == "between" {
+		if p.Value != 0 || p.Min < 0 || p.Max < p.Min {
+			return errors.New("between takes 0 <= min <= max")
+		}
+		return nil
+	}
+	if p.Min != 0 || p.Max != 0 || p.Value < 0 {
+		return fmt.Errorf("%s takes a non-negative value", p.Op)
+	}
+	if p.Op == "<" && p.Value == 0 {
+		return errors.New("< 0 can never hold")
+	}
+	return nil
+}
+
+// Statement is a named conjunction of predicates over user attributes, compiled into a circuit
+// at runtime so simple statements need configuration rather than code
+type Statement struct {
+	Name        string               `json:"name"`
+	Description string               `json:"description,omitempty"`
+	Predicates  []StatementPredicate `json:"predicates"`
+}
+
+func (s *Statement) check() error {
+	if len(s.Predicates) == 0 || len(s.Predicates) > maxStatementPredicates {
+		return fmt.Errorf("a statement takes 1 to %d predicates", maxStatementPredicates)
+	}
+	for i, p := range s.Predicates {
+		if err := p.check(); err != nil {
+			return fmt.Errorf("predicate %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// circuitName identifies the circuit of the statement by its shape, so bounds can change
+// without a new setup
+func (s *Statement) circuitName() string {
+	parts := make([]string, len(s.Predicates))
+	for i, p := range s.Predicates {
+		parts[i] = strconv.Itoa(len(p.attributes())) + "-" + statementOps[p.Op]
+	}
+	return statementCircuitPrefix + strings.Join(parts, "+")
+}
+
+func (s *Statement) String() string {
+	parts := make([]string, len(s.Predicates))
+	for i, p := range s.Predicates {
+		parts[i] = p.String()
+	}
+	return strings.Join(parts, " && ")
+}
+
+// statementTerm is the shape of one predicate: how many values it adds up and how it compares
+type statementTerm struct {
+	values int
+	op     string
+}
+
+// StatementCircuit is the generic circuit of statements. Values holds the attributes of every
+// predicate in order and Bounds their bounds; the shape tells Define how to consume them.
+type StatementCircuit struct {
+	Values []frontend.Variable `gnark:",secret"`
+	Bounds []frontend.Variable `gnark:",public"`
+
+	shape []statementTerm `gnark:"-"`
+}
+
+func (circuit *StatementCircuit) Define(api frontend.API) error {
+	cmp := circuits.NewComparator(api)
+	values, bounds := circuit.Values, circuit.Bounds
+	for _, term := range circuit.shape {
+		for _, v := range values[:term.values] {
+			cmp.Check(v, statementValueBits)
+		}
+		x := values[0]
+		if term.values > 1 {
+			x = api.Add(values[0], values[1], values[2:term.values]...)
+		}
+		values = values[term.values:]
+
+		// A sum of n values needs the bits of n on top of theirs; one more leaves room for bound + 1
+		width := statementValueBits + bits.Len(uint(term.values)) + 1
+		lessOrEqual := func(a, b frontend.Variable) {
+			cmp.Check(a, width)
+			cmp.Check(b, width)
+			cmp.AssertIsLessOrEqual(a, b, width)
+		}
+		bound := bounds[0]
+		switch term.op {
+		case ">=":
+			lessOrEqual(bound, x)
+		case ">":
+			lessOrEqual(api.Add(bound, 1), x)
+		case "<=":
+			lessOrEqual(x, bound)
+		case "<":
+			lessOrEqual(api.Add(x, 1), bound)
+		case "==":
+			api.AssertIsEqual(x, bound)
+		case "!=":
+			api.AssertIsDifferent(x, bound)
+		case "between":
+			lessOrEqual(bound, x)
+			lessOrEqual(x, bounds[1])
+			bounds = bounds[1:]
+		default:
+			return fmt.Errorf("unknown op %q", term.op)
+		}
+		bounds = bounds[1:]
+	}
+	return nil
+}
+
+// circuit returns an empty circuit shaped for the statement
+func (s *Statement) circuit() *StatementCircuit {
+	var circuit StatementCircuit
+	for _, p := range s.Predicates {
+		circuit.shape = append(circuit.shape, statementTerm{values: len(p.attributes()), op: p.Op})
+		for range p.attributes() {
+			circuit.Values = append(circuit.Values, 0)
+		}
+		for range p.bounds() {
+			circuit.Bounds = append(circuit.Bounds, 0)
+		}
+	}
+	return &circuit
+}
+
+// assignment builds the witness for id, or only its public part when id is empty
+func (s *Statement) assignment(id string) (*StatementCircuit, error) {
+	var values map[string]int64
+	if id != "" {
+		values = attributeValues(id)
+	}
+
+	assignment := s.circuit()
+	assignment.Values, assignment.Bounds = assignment.Values[:0], assignment.Bounds[:0]
+	for _, p := range s.Predicates {
+		var sum int64
+		for _, name := range p.attributes() {
+			v, ok := values[name]
+			if id != "" && (!ok || v < 0) {
+				return nil, fmt.Errorf("%w: %s needs a non-negative %s", errPredicateNotSatisfied, p, name)
+			}
+			sum += v
+			assignment.Values = append(assignment.Values, v)
+		}
+		if id != "" && !p.holds(sum) {
+			return nil, fmt.Errorf("%w: %s", errPredicateNotSatisfied, p)
+		}
+		for _, b := range p.bounds() {
+			assignment.Bounds = append(assignment.Bounds, b)
+		}
+	}
+	return assignment, nil
+}
+
+var (
+	statements   = make(map[string]*Statement)
+	statementsMu sync.RWMutex
+)
+
+func lookupStatement(name string) (*Statement, error) {
+	statementsMu.RLock()
+	defer statementsMu.RUnlock()
+
+	s, ok := statements[name]
+	if !ok {
+		return nil, errStatementNotFound
+	}
+	return s, nil
+}
+
+// loadStatements registers the statements of a JSON file holding an array of statements
+func loadStatements(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	var list []Statement
+	if err := unmarshalStrict(data, &list); err != nil {
+		return 0, fmt.Errorf("%s: %w", path, err)
+	}
+
+	statementsMu.Lock()
+	defer statementsMu.Unlock()
+	for i := range list {
+		if list[i].Name == "" {
+			return 0, fmt.Errorf("%s: statement %d has no name", path, i)
+		}
+		if err := list[i].check(); err != nil {
+			return 0, fmt.Errorf("%s: statement %q: %w", path, list[i].Name, err)
+		}
+		if err := checkConstraintBudget(defaultCurve, list[i].circuitName(), list[i].circuit()); err != nil {
+			return 0, fmt.Errorf("%s: statement %q: %w", path, list[i].Name, err)
+		}
+		statements[list[i].Name] = &list[i]
+	}
+	return len(list), nil
+}
+
+// putStatement registers or replaces the statement named in the path
+func putStatement(w http.ResponseWriter, r *http.Request) {
+	var s Statement
+	if err := decodeJSON(w, r, &s); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	s.Name = r.PathValue("name")
+	if err := s.check(); err != nil {
+		writeError(w, errs.Wrap(errs.Invalid, err))
+		return
+	}
+	if err := checkConstraintBudget(defaultCurve, s.circuitName(), s.circuit()); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	statementsMu.Lock()
+	statements[s.Name] = &s
+	statementsMu.Unlock()
+
+	audit.record(AuditEvent{Type: auditStatementUpdated, Subject: s.Name, Detail: s.String()})
+
+	writeJSON(w, &s)
+}
+
+func getStatement(w http.ResponseWriter, r *http.Request) {
+	s, err := lookupStatement(r.PathValue("name"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, s)
+}
+
+type StatementProofRequest struct {
+	ID       string `json:"id"`
+	Audience string `json:"audience,omitempty"` // relying party the proof is issued for
+}
+
+type StatementProofResponse struct {
+	Statement string        `json:"statement"`
+	Proof     groth16.Proof `json:"proof"`
+}
+
+type StatementValidateRequest struct {
+	Proof json.RawMessage `json:"proof"`
+}
+
+// generateStatementProof proves a registered statement about a user's attributes
+func generateStatementProof(w http.ResponseWriter, r *http.Request) {
+	var req StatementProofRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := checkSessionUser(r, req.ID); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	s, err := lookupStatement(r.PathValue("name"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := checkTenantAccess(r, statementAccessNamePrefix+s.Name); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := checkConsent(req.ID, req.Audience, statementAccessNamePrefix+s.Name, s.String(), time.Now()); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := checkUserIssuance(req.ID); err != nil {
+		writeError(w, err)
+		return
+	}
+	if len(attributeValues(req.ID)) == 0 {
+		writeError(w, errs.Errorf(errs.NotFound, "no attributes stored for id"))
+		return
+	}
+
+	assignment, err := s.assignment(req.ID)
+	if err != nil {
+		writeError(w, errs.Wrap(errs.Unprocessable, err))
+		return
+	}
+
+	setup, err := loadSetup(s.circuitName(), s.circuit())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	proof, err := setup.prove(r.Context(), assignment)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	digest, err := persistProof(r.Context(), proof, ProofRecord{
+		Circuit:        s.circuitName(),
+		CircuitVersion: statementCircuitVersion,
+		PublicInputs:   map[string]string{"statement": s.Name},
+		Audience:       req.Audience,
+		Holder:         req.ID,
+	})
+	if err != nil {
+		log.Printf("Failed to persist proof: %v", err)
+	}
+	if digest != "" {
+		w.Header().Set("X-Proof-Digest", digest)
+	}
+	setProofHeaders(w, defaultCurve, assignment)
+	signIssuedProof(w, defaultCurve, s.circuitName(), map[string]string{"statement": s.Name}, proof, assignment)
+
+	writeProof(w, r, proof, StatementProofResponse{Statement: s.String(), Proof: proof})
+}
+
+// validateStatementProof verifies a proof of a registered statement against its current bounds
+func validateStatementProof(w http.ResponseWriter, r *http.Request) {
+	var req StatementValidateRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	s, err := lookupStatement(r.PathValue("name"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := checkTenantAccess(r, statementAccessNamePrefix+s.Name); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	proof, err := decodeProofJSON(defaultCurve, req.Proof)
+	if err != nil {
+		writeError(w, fmt.Errorf("%w: %v", errMalformedProof, err))
+		return
+	}
+
+	assignment, err := s.assignment("")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	setup, err := loadSetup(s.circuitName(), s.circuit())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := setup.verify(r.Context(), proof, assignment); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/test"
+)
+
+func postStatement(t *testing.T, handler http.HandlerFunc, method, name string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, "/statements/"+name, bytes.NewReader(data))
+	req.SetPathValue("name", name)
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	return rr
+}
+
+func TestStatementCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		predicate   StatementPredicate
+		expectError bool
+	}{
+		{"Comparison", StatementPredicate{Attribute: "age", Op: ">=", Value: 18}, false},
+		{"Range", StatementPredicate{Attribute: "age", Op: "between", Min: 18, Max: 65}, false},
+		{"Sum", StatementPredicate{Sum: []string{"balance", "savings"}, Op: ">", Value: 1000}, false},
+		{"Attribute and sum", StatementPredicate{Attribute: "age", Sum: []string{"a", "b"}, Op: ">=", Value: 1}, true},
+		{"No attribute", StatementPredicate{Op: ">=", Value: 1}, true},
+		{"Sum of one", StatementPredicate{Sum: []string{"balance"}, Op: ">=", Value: 1}, true},
+		{"Repeated summand", StatementPredicate{Sum: []string{"balance", "balance"}, Op: ">=", Value: 1}, true},
+		{"Unknown op", StatementPredicate{Attribute: "age", Op: "=~", Value: 1}, true},
+		{"Inverted range", StatementPredicate{Attribute: "age", Op: "between", Min: 65, Max: 18}, true},
+		{"Range with value", StatementPredicate{Attribute: "age", Op: "between", Value: 3, Max: 18}, true},
+		{"Negative bound", StatementPredicate{Attribute: "age", Op: "<=", Value: -1}, true},
+		{"Below zero", StatementPredicate{Attribute: "age", Op: "<", Value: 0}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := Statement{Predicates: []StatementPredicate{tt.predicate}}
+			if err := s.check(); (err != nil) != tt.expectError {
+				t.Errorf("check() error = %v, expectError %v", err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestStatementCircuit(t *testing.T) {
+	tests := []struct {
+		name      string
+		predicate StatementPredicate
+		values    []frontend.Variable
+		bounds    []frontend.Variable
+		holds     bool
+	}{
+		{">= equal", StatementPredicate{Attribute: "a", Op: ">="}, []frontend.Variable{10}, []frontend.Variable{10}, true},
+		{">= below", StatementPredicate{Attribute: "a", Op: ">="}, []frontend.Variable{9}, []frontend.Variable{10}, false},
+		{"> equal", StatementPredicate{Attribute: "a", Op: ">"}, []frontend.Variable{10}, []frontend.Variable{10}, false},
+		{"<= equal", StatementPredicate{Attribute: "a", Op: "<="}, []frontend.Variable{10}, []frontend.Variable{10}, true},
+		{"< equal", StatementPredicate{Attribute: "a", Op: "<"}, []frontend.Variable{10}, []frontend.Variable{10}, false},
+		{"== equal", StatementPredicate{Attribute: "a", Op: "=="}, []frontend.Variable{10}, []frontend.Variable{10}, true},
+		{"!= equal", StatementPredicate{Attribute: "a", Op: "!="}, []frontend.Variable{10}, []frontend.Variable{10}, false},
+		{"between inside", StatementPredicate{Attribute: "a", Op: "between"}, []frontend.Variable{30}, []frontend.Variable{18, 65}, true},
+		{"between above", StatementPredicate{Attribute: "a", Op: "between"}, []frontend.Variable{66}, []frontend.Variable{18, 65}, false},
+		{"sum", StatementPredicate{Sum: []string{"a", "b", "c"}, Op: ">="}, []frontend.Variable{3, 4, 5}, []frontend.Variable{12}, true},
+		{"sum short", StatementPredicate{Sum: []string{"a", "b", "c"}, Op: ">="}, []frontend.Variable{3, 4, 4}, []frontend.Variable{12}, false},
+		// -1 is the largest field element; the range check keeps it from passing as a huge value
+		{"negative value", StatementPredicate{Attribute: "a", Op: ">="}, []frontend.Variable{-1}, []frontend.Variable{10}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := Statement{Predicates: []StatementPredicate{tt.predicate}}
+			assignment := &StatementCircuit{Values: tt.values, Bounds: tt.bounds}
+			err := test.IsSolved(s.circuit(), assignment, ecc.BN254.ScalarField())
+			if (err == nil) != tt.holds {
+				t.Errorf("Expected holds=%v, got %v", tt.holds, err)
+			}
+		})
+	}
+}
+
+func TestLoadStatements(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "statements.json")
+	if err := os.WriteFile(path, []byte(`[{"name": "adult", "predicates": [{"attribute": "age", "op": ">=", "value": 18}]}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		statementsMu.Lock()
+		delete(statements, "adult")
+		statementsMu.Unlock()
+	})
+	if n, err := loadStatements(path); err != nil || n != 1 {
+		t.Fatalf("Expected one statement, got %d, %v", n, err)
+	}
+	if s, err := lookupStatement("adult"); err != nil || s.String() != "age >= 18" {
+		t.Errorf("Unexpected statement %v, %v", s, err)
+	}
+
+	if err := os.WriteFile(path, []byte(`[{"name": "bad", "predicates": [{"attribute": "age", "op": "~"}]}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadStatements(path); err == nil {
+		t.Error("Expected an invalid statement to be refused")
+	}
+}
+
+func TestStatementProofWorkflow(t *testing.T) {
+	SkipIfShort(t, "statement proof generation")
+
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+	h.StoreBalance("stmt_user", 700)
+	postJSON(t, storeAttribute, "/store/attribute", AttributeRequest{ID: "stmt_user", Name: "savings", Value: 400})
+	postJSON(t, storeAttribute, "/store/attribute", AttributeRequest{ID: "stmt_user", Name: "age", Value: 30})
+
+	statement := Statement{Predicates: []StatementPredicate{
+		{Sum: []string{"balance", "savings"}, Op: ">=", Value: 1000},
+		{Attribute: "age", Op: "between", Min: 18, Max: 65},
+	}}
+	rr := postStatement(t, putStatement, "PUT", "solvent-adult", statement)
+	h.AssertStatusCode(rr, http.StatusOK, "registering the statement")
+	t.Cleanup(func() {
+		statementsMu.Lock()
+		delete(statements, "solvent-adult")
+		statementsMu.Unlock()
+	})
+
+	rr = postStatement(t, generateStatementProof, "POST", "solvent-adult", StatementProofRequest{ID: "stmt_user"})
+	h.AssertStatusCode(rr, http.StatusOK, "proving the statement")
+	var resp struct {
+		Statement string          `json:"statement"`
+		Proof     json.RawMessage `json:"proof"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Statement != "balance + savings >= 1000 && 18 <= age <= 65" {
+		t.Errorf("Unexpected statement %q", resp.Statement)
+	}
+
+	rr = postStatement(t, validateStatementProof, "POST", "solvent-adult", StatementValidateRequest{Proof: resp.Proof})
+	h.AssertStatusCode(rr, http.StatusOK, "validating the proof")
+
+	// Raising a bound keeps the circuit but no longer matches the proof's public inputs
+	statement.Predicates[0].Value = 2000
+	h.AssertStatusCode(postStatement(t, putStatement, "PUT", "solvent-adult", statement), http.StatusOK, "raising the bound")
+	rr = postStatement(t, validateStatementProof, "POST", "solvent-adult", StatementValidateRequest{Proof: resp.Proof})
+	h.AssertStatusCode(rr, http.StatusUnauthorized, "validating against the raised bound")
+
+	rr = postStatement(t, generateStatementProof, "POST", "solvent-adult", StatementProofRequest{ID: "stmt_user"})
+	h.AssertStatusCode(rr, http.StatusUnprocessableEntity, "proving an unsatisfied statement")
+
+	rr = postStatement(t, generateStatementProof, "POST", "missing", StatementProofRequest{ID: "stmt_user"})
+	h.AssertStatusCode(rr, http.StatusNotFound, "unknown statement")
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Failure reasons reported by /admin/stats
+const (
+	failureInvalidProof = "invalid_proof"
+	failureProve        = "prove_error"
+	failureVerify       = "verify_error"
+)
+
+// CircuitDayStats are the usage counters of one circuit on one UTC day
+type CircuitDayStats struct {
+	Generated    int     `json:"generated"`
+	ProveFailed  int     `json:"proveFailed"`
+	Validated    int     `json:"validated"`
+	Rejected     int     `json:"rejected"`
+	VerifyFailed int     `json:"verifyFailed"`
+	AvgProvingMs float64 `json:"avgProvingMs"`
+
+	provingTotal time.Duration
+}
+
+// usageStats aggregates proving and validation events in memory since startup
+type usageStats struct {
+	mu       sync.Mutex
+	now      func() time.Time
+	since    time.Time
+	circuits map[string]map[string]*CircuitDayStats // circuit -> day -> counters
+	failures map[string]int
+	lastTook map[string]time.Duration // duration of the latest successful proof per circuit
+}
+
+func newUsageStats(now func() time.Time) *usageStats {
+	return &usageStats{
+		now:      now,
+		since:    now().UTC(),
+		circuits: make(map[string]map[string]*CircuitDayStats),
+		failures: make(map[string]int),
+		lastTook: make(map[string]time.Duration),
+	}
+}
+
+var usage = newUsageStats(time.Now)
+
+// day returns the counters of circuit for today; callers must hold s.mu
+func (s *usageStats) day(circuit string) *CircuitDayStats {
+	days, ok := s.circuits[circuit]
+	if !ok {
+		days = make(map[string]*CircuitDayStats)
+		s.circuits[circuit] = days
+	}
+	key := s.now().UTC().Format(time.DateOnly)
+	d, ok := days[key]
+	if !ok {
+		d = &CircuitDayStats{}
+		days[key] = d
+	}
+	return d
+}
+
+// recordProof counts a proving attempt that took the given time
+func (s *usageStats) recordProof(circuit string, took time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.day(circuit)
+	if err != nil {
+		d.ProveFailed++
+		s.failures[failureProve]++
+		return
+	}
+	d.Generated++
+	d.provingTotal += took
+	s.lastTook[circuit] = took
+	d.AvgProvingMs = float64(d.provingTotal.Microseconds()) / 1000 / float64(d.Generated)
+}
+
+// lastProvingTime returns how long the latest successful proof of circuit took, or 0 if none has
+func (s *usageStats) lastProvingTime(circuit string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastTook[circuit]
+}
+
+// recordValidation counts a verification attempt
+func (s *usageStats) recordValidation(circuit string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.day(circuit)
+	switch {
+	case err == nil:
+		d.Validated++
+	case errors.Is(err, errInvalidProof):
+		d.Rejected++
+		s.failures[failureInvalidProof]++
+	default:
+		d.VerifyFailed++
+		s.failures[failureVerify]++
+	}
+}
+
+// StatsResponse is returned by GET /admin/stats
+type StatsResponse struct {
+	Users    int                                   `json:"users"`
+	Circuits map[string]map[string]CircuitDayStats `json:"circuits"`
+	Failures map[string]int                        `json:"failures"`
+	Since    time.Time                             `json:"since"`
+
+	Dependencies []DependencyStatus `json:"dependencies"`
+	Cleanup      []SweepStatus      `json:"cleanup"`
+	AuditDropped int64              `json:"auditDropped"` // audit events not delivered to the collector
+
+	NotificationsDropped int64 `json:"notificationsDropped"` // events not queued for subscriptions
+
+	Requests map[string]RouteStats `json:"requests"` // responses per route pattern
+	Panics   int64                 `json:"panics"`   // handler panics recovered into 500 responses
+
+	Nonces      NonceStats       `json:"nonces"`
+	VerifyCache VerifyCacheStats `json:"verifyCache"`
+}
+
+func (s *usageStats) snapshot() StatsResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	resp := StatsResponse{
+		Circuits: make(map[string]map[string]CircuitDayStats, len(s.circuits)),
+		Failures: make(map[string]int, len(s.failures)),
+		Since:    s.since,
+	}
+	for circuit, days := range s.circuits {
+		resp.Circuits[circuit] = make(map[string]CircuitDayStats, len(days))
+		for day, d := range days {
+			resp.Circuits[circuit][day] = *d
+		}
+	}
+	for reason, n := range s.failures {
+		resp.Failures[reason] = n
+	}
+	return resp
+}
+
+// countUsers returns the number of distinct ids with a balance or attributes
+func countUsers() int {
+	ids := make(map[string]struct{})
+
+	balancesMu.Lock()
+	for id := range balances {
+		ids[id] = struct{}{}
+	}
+	balancesMu.Unlock()
+
+	userAttributesMu.Lock()
+	for id := range userAttributes {
+		ids[id] = struct{}{}
+	}
+	userAttributesMu.Unlock()
+
+	return len(ids)
+}
+
+// getStats reports user counts and per-circuit, per-day proving and validation usage
+func getStats(w http.ResponseWriter, r *http.Request) {
+	resp := usage.snapshot()
+	resp.Users = countUsers()
+	resp.Dependencies = dependencies.run()
+	resp.Cleanup = cleanup.snapshot()
+	resp.Requests = httpMetrics.snapshot()
+	resp.Panics = panicsRecovered.Load()
+	resp.Nonces = nonces.snapshot()
+	resp.VerifyCache = verifications.snapshot()
+	if auditShip != nil {
+		resp.AuditDropped = auditShip.dropped.Load()
+	}
+	if notifications != nil {
+		resp.NotificationsDropped = notifications.dropped.Load()
+	}
+	writeJSON(w, resp)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestUsageStats(t *testing.T) {
+	now := time.Date(2025, 3, 1, 23, 0, 0, 0, time.UTC)
+	stats := newUsageStats(func() time.Time { return now })
+
+	stats.recordProof("balance", 100*time.Millisecond, nil)
+	stats.recordProof("balance", 300*time.Millisecond, nil)
+	stats.recordProof("balance", time.Second, errors.New("solver failed"))
+	stats.recordValidation("balance", nil)
+	stats.recordValidation("balance", errInvalidProof)
+
+	now = now.Add(2 * time.Hour)
+	stats.recordValidation("balance", errors.New("bad witness"))
+
+	snap := stats.snapshot()
+
+	first := snap.Circuits["balance"]["2025-03-01"]
+	if first.Generated != 2 || first.ProveFailed != 1 || first.Validated != 1 || first.Rejected != 1 {
+		t.Errorf("Unexpected counters for first day: %+v", first)
+	}
+	if first.AvgProvingMs != 200 {
+		t.Errorf("Expected average proving time of 200ms, got %v", first.AvgProvingMs)
+	}
+
+	second := snap.Circuits["balance"]["2025-03-02"]
+	if second.VerifyFailed != 1 || second.Validated != 0 {
+		t.Errorf("Unexpected counters for second day: %+v", second)
+	}
+
+	if took := stats.lastProvingTime("balance"); took != 300*time.Millisecond {
+		t.Errorf("Expected the latest successful proof to have taken 300ms, got %v", took)
+	}
+
+	expectedFailures := map[string]int{failureProve: 1, failureInvalidProof: 1, failureVerify: 1}
+	for reason, n := range expectedFailures {
+		if snap.Failures[reason] != n {
+			t.Errorf("Expected %d %s failures, got %d", n, reason, snap.Failures[reason])
+		}
+	}
+}
+
+func TestGetStats(t *testing.T) {
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+	h.StoreBalance("stats_a", 10)
+	h.StoreBalance("stats_b", 20)
+
+	rr := httptest.NewRecorder()
+	getStats(rr, httptest.NewRequest("GET", "/admin/stats", nil))
+	h.AssertStatusCode(rr, http.StatusOK, "fetching stats")
+
+	var resp StatsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Users < 2 {
+		t.Errorf("Expected at least 2 users, got %d", resp.Users)
+	}
+}
+
+func TestCheckProvingTime(t *testing.T) {
+	previous := usage
+	usage = newUsageStats(time.Now)
+	t.Cleanup(func() { usage = previous })
+	usage.recordProof("balance", time.Second, nil)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	short, cancelShort := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancelShort()
+	long, cancelLong := context.WithTimeout(context.Background(), time.Minute)
+	defer cancelLong()
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		circuit string
+		want    error
+	}{
+		{"No deadline", context.Background(), "balance", nil},
+		{"Cancelled", cancelled, "balance", context.Canceled},
+		{"Deadline shorter than the last proof", short, "balance", errDeadlineTooShort},
+		{"Deadline longer than the last proof", long, "balance", nil},
+		{"Circuit never proven", short, "balance-bucket", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkProvingTime(tt.ctx, tt.circuit)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+			if err != nil && !isContextError(err) {
+				t.Errorf("Expected %v to count as a context error", err)
+			}
+		})
+	}
+}
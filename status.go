@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/korjavin/zkTest1/circuits"
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// serverVersion is the release reported by /health and the startup report
+const serverVersion = "1.0.0"
+
+// StartupReport is what the server started with: its configuration, circuits, keys, storage and
+// listening addresses. It is logged as one JSON line and served at /admin/status so orchestration
+// can assert the configuration. It never holds secrets.
+type StartupReport struct {
+	Service    string         `json:"service"`
+	Version    string         `json:"version"`
+	Started    time.Time      `json:"started"`
+	Listen     []string       `json:"listen"`
+	Config     ConfigSummary  `json:"config"`
+	Storage    StorageSummary `json:"storage"`
+	Circuits   []string       `json:"circuits"`
+	Keys       []KeyInfo      `json:"keys"`       // circuit keys loaded at startup
+	SigningKID string         `json:"signingKid"` // key ID of the server signing key
+}
+
+// ConfigSummary is the configuration of a server without secrets; URLs lose their passwords
+type ConfigSummary struct {
+	DevMode          bool              `json:"devMode"`
+	AccessLog        bool              `json:"accessLog"`
+	Capture          bool              `json:"capture"`
+	RequestTimeoutMs int64             `json:"requestTimeoutMs"`
+	ProvingWorkers   int               `json:"provingWorkers"`
+	ReservedWorkers  int               `json:"reservedWorkers"`
+	ProvingMemory    int64             `json:"provingMemoryBytes"`
+	ProvingGCPercent int               `json:"provingGcPercent,omitempty"`
+	Limits           ResourceLimits    `json:"limits"`
+	Features         []string          `json:"features"`
+	Curves           map[string]string `json:"curves,omitempty"` // configured curve by circuit
+	Secrets          string            `json:"secrets"`
+	Signing          string            `json:"signing"`
+	OAuth            string            `json:"oauth,omitempty"`
+	OAuthRequired    bool              `json:"oauthRequired"`
+	Gate             string            `json:"gate,omitempty"`
+	RateLimit        float64           `json:"rateLimit,omitempty"` // requests per second and client
+	Bus              string            `json:"bus,omitempty"`
+	Proxy            string            `json:"proxy,omitempty"`
+	ProxyOnly        bool              `json:"proxyOnly"`
+}
+
+// StorageSummary names the backends state is kept in
+type StorageSummary struct {
+	Artifacts     string `json:"artifacts"`
+	Keys          string `json:"keys"` // "file" or "memory"
+	KeyDir        string `json:"keyDir,omitempty"`
+	KeysEncrypted bool   `json:"keysEncrypted"`
+	Nonces        string `json:"nonces"`
+}
+
+// startup is the report of the running server, set once it listens
+var startup *StartupReport
+
+// newStartupReport describes a server started with cfg and listening on listen
+func newStartupReport(cfg Config, listen []string, now time.Time) StartupReport {
+	report := StartupReport{
+		Service:  "zkTest1",
+		Version:  serverVersion,
+		Started:  now.UTC(),
+		Listen:   listen,
+		Circuits: circuits.Names(),
+		Keys:     keyManager.Inventory(now),
+		Config: ConfigSummary{
+			DevMode:          cfg.DevMode,
+			AccessLog:        cfg.AccessLog,
+			Capture:          cfg.CaptureFile != "",
+			RequestTimeoutMs: cfg.RequestTimeout.Milliseconds(),
+			ProvingWorkers:   cfg.ProvingWorkers,
+			ReservedWorkers:  cfg.ReservedWorkers,
+			ProvingMemory:    cfg.ProvingMemory,
+			ProvingGCPercent: cfg.ProvingGC,
+			Limits:           cfg.Limits,
+			Features:         append([]string{}, cfg.Features...),
+			Secrets:          cfg.Secrets.Backend,
+			Signing:          cfg.Signing.Backend,
+			OAuth:            cfg.OAuth.Mode,
+			OAuthRequired:    cfg.OAuth.Required,
+			Gate:             cfg.Gate.Mode,
+			RateLimit:        cfg.RateLimit.Rate,
+			Bus:              redactURL(cfg.Bus.URL),
+			Proxy:            redactURL(cfg.Proxy.BackendURL),
+			ProxyOnly:        cfg.Proxy.Only,
+		},
+		Storage: StorageSummary{
+			Artifacts:     cfg.Artifacts.Backend,
+			Keys:          "memory",
+			KeyDir:        cfg.Keys.Dir,
+			KeysEncrypted: cfg.Keys.Encrypt,
+			Nonces:        cfg.Nonces.Backend,
+		},
+	}
+	sort.Strings(report.Config.Features)
+	if cfg.Keys.Dir != "" {
+		report.Storage.Keys = "file"
+	}
+	if len(cfg.Curves.Circuits) > 0 {
+		report.Config.Curves = make(map[string]string, len(cfg.Curves.Circuits))
+		for name, curve := range cfg.Curves.Circuits {
+			report.Config.Curves[name] = curve.String()
+		}
+	}
+	if signer != nil {
+		report.SigningKID = signer.KeyID()
+	}
+	return report
+}
+
+// redactURL drops the password of a URL, which brokers and backends may take as credentials
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return u.Redacted()
+}
+
+// logStartup logs the startup report as one JSON line and serves it at /admin/status
+func logStartup(report StartupReport) {
+	startup = &report
+	data, err := json.Marshal(report)
+	if err != nil {
+		log.Printf("Failed to encode startup report: %v", err)
+		return
+	}
+	log.Printf("Startup report: %s", data)
+}
+
+// getStatus returns the startup report with the server's uptime
+func getStatus(w http.ResponseWriter, r *http.Request) {
+	if startup == nil {
+		writeError(w, errs.New(errs.Unavailable, "starting", "the server is still starting"))
+		return
+	}
+	writeJSON(w, struct {
+		*StartupReport
+		UptimeSeconds int64 `json:"uptimeSeconds"`
+	}{startup, int64(time.Since(startup.Started).Seconds())})
+}
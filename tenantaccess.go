@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+var (
+	errCircuitNotAllowed   = errs.New(errs.Forbidden, "circuit_not_allowed", "this API key may not use the circuit")
+	errThresholdNotAllowed = errs.New(errs.Forbidden, "threshold_not_allowed", "this API key may not use the threshold")
+	errTenantUnknown       = errs.New(errs.Unauthorized, "tenant_unknown", "tenants are restricted, so requests need an access token, a signature or a listed X-API-Key")
+)
+
+// statementAccessNamePrefix names registered statements in tenant allowlists, as statement/<name>
+const statementAccessNamePrefix = "statement/"
+
+// TenantAccess restricts what one tenant may prove and verify
+type TenantAccess struct {
+	Circuits     []string // circuits the tenant may use; nil allows every circuit
+	MaxThreshold int64    // largest amount threshold the tenant may prove or verify; 0 means no limit
+}
+
+// TenantAccessConfig holds the restrictions of tenants, keyed by tenant ID (see tenantID).
+// Authenticated tenants without an entry may use every circuit and threshold. Once any tenant is
+// restricted, anonymous callers need an entry of their own, or they could drop their key to
+// escape the restrictions.
+type TenantAccessConfig map[string]TenantAccess
+
+// tenantAccess holds the tenant restrictions of the server
+var tenantAccess TenantAccessConfig
+
+// parseTenantAccess parses tenant=circuit pairs, a tenant listed several times being allowed each
+// of its circuits, and tenant=amount pairs of maximum thresholds
+func parseTenantAccess(circuitPairs, thresholdPairs []string) (TenantAccessConfig, error) {
+	cfg := make(TenantAccessConfig)
+	for _, v := range circuitPairs {
+		tenant, circuit, ok := cutPair(v)
+		if !ok {
+			return nil, fmt.Errorf("%q is not tenant=circuit", v)
+		}
+		access := cfg[tenant]
+		if !slices.Contains(access.Circuits, circuit) {
+			access.Circuits = append(access.Circuits, circuit)
+		}
+		cfg[tenant] = access
+	}
+	for _, v := range thresholdPairs {
+		tenant, amount, ok := cutPair(v)
+		if !ok {
+			return nil, fmt.Errorf("%q is not tenant=amount", v)
+		}
+		max, err := strconv.ParseInt(amount, 10, 64)
+		if err != nil || max <= 0 {
+			return nil, fmt.Errorf("%q: the maximum threshold must be a positive integer", v)
+		}
+		access := cfg[tenant]
+		access.MaxThreshold = max
+		cfg[tenant] = access
+	}
+	return cfg, nil
+}
+
+// cutPair splits a name=value pair, both trimmed and non-empty
+func cutPair(v string) (string, string, bool) {
+	name, value, ok := strings.Cut(v, "=")
+	name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+	return name, value, ok && name != "" && value != ""
+}
+
+// check fails when tenant may not use circuit, or any of thresholds is above its maximum
+func (c TenantAccessConfig) check(tenant, circuit string, thresholds ...int64) error {
+	access, ok := c[tenant]
+	if !ok {
+		if tenant == anonymousTenant && len(c) > 0 {
+			return errTenantUnknown
+		}
+		return nil
+	}
+	if access.Circuits != nil && !slices.Contains(access.Circuits, circuit) {
+		return fmt.Errorf("%w: %s", errCircuitNotAllowed, circuit)
+	}
+	if access.MaxThreshold > 0 {
+		for _, threshold := range thresholds {
+			if threshold > access.MaxThreshold {
+				return fmt.Errorf("%w: %d is above %d", errThresholdNotAllowed, threshold, access.MaxThreshold)
+			}
+		}
+	}
+	return nil
+}
+
+// checkAPIKeys fails on restricted API key tenants that are not in keys, as no request could
+// ever be them
+func (c TenantAccessConfig) checkAPIKeys(keys map[string]bool) error {
+	tenants := slices.Sorted(maps.Keys(c))
+	for _, tenant := range tenants {
+		if strings.HasPrefix(tenant, "key-") && !keys[tenant] {
+			return fmt.Errorf("%s is not listed in ZK_API_KEYS", tenant)
+		}
+	}
+	return nil
+}
+
+type tenantKey struct{}
+
+// withTenant makes ctx carry the tenant of its request, for checks outside HTTP handlers
+func withTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// tenantOf returns the tenant ctx carries, or "" for none
+func tenantOf(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// checkTenantAccess fails when the tenant of r may not prove or verify with circuit at the
+// given amount thresholds
+func checkTenantAccess(r *http.Request, circuit string, thresholds ...int64) error {
+	return tenantAccess.check(tenantID(r), circuit, thresholds...)
+}
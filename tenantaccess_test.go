@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseTenantAccess(t *testing.T) {
+	cfg, err := parseTenantAccess(
+		[]string{"key-a=balance", "key-a = balance-bucket", "key-b=statement/adult"},
+		[]string{"key-a=5000", "key-c=100"},
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if a := cfg["key-a"]; len(a.Circuits) != 2 || a.MaxThreshold != 5000 {
+		t.Errorf("Unexpected access of key-a: %+v", a)
+	}
+	if c := cfg["key-c"]; c.Circuits != nil || c.MaxThreshold != 100 {
+		t.Errorf("Expected key-c to be limited by threshold only, got %+v", c)
+	}
+
+	for _, bad := range [][2][]string{
+		{{"key-a"}, nil},
+		{{"=balance"}, nil},
+		{nil, {"key-a=lots"}},
+		{nil, {"key-a=0"}},
+	} {
+		if _, err := parseTenantAccess(bad[0], bad[1]); err == nil {
+			t.Errorf("Expected %v to be rejected", bad)
+		}
+	}
+}
+
+func TestTenantAccessCheck(t *testing.T) {
+	cfg := TenantAccessConfig{
+		"key-a": {Circuits: []string{balanceCircuitName}, MaxThreshold: 1000},
+		"key-c": {MaxThreshold: 100},
+	}
+	tests := []struct {
+		name       string
+		tenant     string
+		circuit    string
+		thresholds []int64
+		want       error
+	}{
+		{"Unrestricted tenant", "client-other", predicateCircuitName, []int64{1 << 40}, nil},
+		{"Anonymous caller", anonymousTenant, predicateCircuitName, nil, errTenantUnknown},
+		{"Allowed circuit", "key-a", balanceCircuitName, []int64{1000}, nil},
+		{"Other circuit", "key-a", bucketCircuitName, nil, errCircuitNotAllowed},
+		{"Threshold too high", "key-a", balanceCircuitName, []int64{10, 1001}, errThresholdNotAllowed},
+		{"Any circuit below the threshold", "key-c", timeLockCircuitName, []int64{100}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := cfg.check(tt.tenant, tt.circuit, tt.thresholds...)
+			if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestTenantAccessEnforced(t *testing.T) {
+	previous := tenantAccess
+	t.Cleanup(func() { tenantAccess = previous })
+	withAPIKeys(t, "partner-key")
+
+	keyed := httptest.NewRequest("GET", "/", nil)
+	keyed.Header.Set("X-API-Key", "partner-key")
+	tenantAccess = TenantAccessConfig{tenantID(keyed): {Circuits: []string{bucketCircuitName}, MaxThreshold: 1000}}
+
+	postAs := func(key string, handler http.HandlerFunc, path string, body any) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest("POST", path, bytes.NewReader(data))
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+	post := func(handler http.HandlerFunc, path string, body any) *httptest.ResponseRecorder {
+		return postAs("partner-key", handler, path, body)
+	}
+	expectForbidden := func(rr *httptest.ResponseRecorder, code string) {
+		t.Helper()
+		var body struct {
+			Code string `json:"code"`
+		}
+		_ = json.Unmarshal(rr.Body.Bytes(), &body)
+		if rr.Code != http.StatusForbidden || body.Code != code {
+			t.Errorf("Expected 403 %s, got %d: %s", code, rr.Code, rr.Body.String())
+		}
+	}
+
+	expectForbidden(post(generateProof, "/get/proof/neededAmount", ProofRequest{ID: "alice", NeededAmount: 100}), "circuit_not_allowed")
+	expectForbidden(post(validateProof, "/validate", ValidateRequest{NeededAmount: 100}), "circuit_not_allowed")
+	top := bucketAt(len(bucketBoundaries) - 1)
+	expectForbidden(post(validateBucketProof, "/validate/bucket", BucketValidateRequest{Lower: top.Lower, Upper: top.Upper}), "threshold_not_allowed")
+
+	// Dropping the key or making one up does not escape the restrictions
+	for _, key := range []string{"", "made-up-key"} {
+		rr := postAs(key, generateProof, "/get/proof/neededAmount", ProofRequest{ID: "alice", NeededAmount: 100})
+		if rr.Code != http.StatusUnauthorized || !strings.Contains(rr.Body.String(), errTenantUnknown.Code) {
+			t.Errorf("Expected 401 %s with key %q, got %d: %s", errTenantUnknown.Code, key, rr.Code, rr.Body.String())
+		}
+	}
+
+	// Bundle members a tenant may not verify fail on their own
+	bundle := ProofBundle{Header: BundleHeader{Version: bundleVersion}, Members: []ProofEnvelope{
+		{Circuit: balanceCircuitName, Inputs: json.RawMessage(`{"neededAmount":100}`), Proof: json.RawMessage(`{}`)},
+	}}
+	bundle.Manifest, _ = bundle.manifest()
+	rr := post(validateBundle, "/validate/bundle", bundle)
+	var resp BundleValidateResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Valid || len(resp.Members) != 1 || resp.Members[0].Error == "" {
+		t.Errorf("Expected the member to be refused, got %s", rr.Body.String())
+	}
+
+	// JSON-RPC carries the tenant of its request
+	ctx := withTenant(context.Background(), tenantID(keyed))
+	if _, rpcErr := rpcValidate(ctx, json.RawMessage(`{"neededAmount":100,"proof":{}}`)); rpcErr == nil || rpcErr.Code != rpcNotAllowed {
+		t.Errorf("Expected zk_validate to be refused, got %+v", rpcErr)
+	}
+}
+
+func TestTenantAccessNeedsListedKeys(t *testing.T) {
+	cfg := TenantAccessConfig{"key-3f1a9c0d2b4e5f60": {MaxThreshold: 100}, "client-partner": {MaxThreshold: 100}}
+	if err := cfg.checkAPIKeys(map[string]bool{"key-3f1a9c0d2b4e5f60": true}); err != nil {
+		t.Errorf("Expected a listed key to be accepted, got %v", err)
+	}
+	if err := cfg.checkAPIKeys(nil); err == nil {
+		t.Error("Expected a restricted key missing from ZK_API_KEYS to be refused")
+	}
+}
@@ -7,12 +7,14 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/consensys/gnark-crypto/ecc"
 	"github.com/consensys/gnark/backend/groth16"
 	"github.com/consensys/gnark/constraint"
 	"github.com/consensys/gnark/frontend"
 	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/korjavin/zkTest1/circuits"
 )
 
 // TestHelper provides utilities for testing the zkTest1 application
@@ -29,6 +31,13 @@ func NewTestHelper(t *testing.T) *TestHelper {
 func (h *TestHelper) SetupCleanBalances() {
 	balancesMu.Lock()
 	balances = make(map[string]int)
+	balanceUpdated = make(map[string]time.Time)
+	balanceAttestations = make(map[string]BalanceAttestation)
+	balanceVersions = make(map[string]int64)
+	deletedBalances = make(map[string]deletedBalance)
+	ledgerTransactions = nil
+	ledgerPostings = make(map[string][]LedgerPosting)
+	ledgerBalances = make(map[string]int)
 	balancesMu.Unlock()
 }
 
@@ -124,7 +133,7 @@ func (h *TestHelper) ValidateProof(userID string, neededAmount int, proof groth1
 
 // CreateCircuitAndSetup creates and compiles a circuit with setup
 func (h *TestHelper) CreateCircuitAndSetup() (constraint.ConstraintSystem, groth16.ProvingKey, groth16.VerifyingKey) {
-	circuit := &BalanceCircuit{}
+	circuit := &circuits.BalanceCircuit{}
 
 	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, circuit)
 	if err != nil {
@@ -143,7 +152,7 @@ func (h *TestHelper) CreateCircuitAndSetup() (constraint.ConstraintSystem, groth
 func (h *TestHelper) GenerateTestProof(balance, neededAmount int) (groth16.Proof, groth16.VerifyingKey) {
 	ccs, pk, vk := h.CreateCircuitAndSetup()
 
-	circuit := BalanceCircuit{
+	circuit := circuits.BalanceCircuit{
 		Balance:      balance,
 		NeededAmount: neededAmount,
 	}
@@ -163,7 +172,7 @@ func (h *TestHelper) GenerateTestProof(balance, neededAmount int) (groth16.Proof
 
 // VerifyTestProof verifies a proof directly using the circuit (bypassing HTTP)
 func (h *TestHelper) VerifyTestProof(proof groth16.Proof, vk groth16.VerifyingKey, neededAmount int) bool {
-	publicWitness := BalanceCircuit{
+	publicWitness := circuits.BalanceCircuit{
 		NeededAmount: neededAmount,
 	}
 
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/consensys/gnark"
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/korjavin/zkTest1/circuits"
+)
+
+// TestVector is a single canonical proof/public-input pair with its expected verification result
+type TestVector struct {
+	Name          string            `json:"name"`
+	PublicInputs  map[string]string `json:"publicInputs"`
+	PublicWitness string            `json:"publicWitness"` // base64, gnark binary encoding
+	Proof         string            `json:"proof"`         // base64, gnark binary encoding
+	ExpectValid   bool              `json:"expectValid"`
+}
+
+// TestVectorBundle lets relying parties check an independent verifier implementation
+// against proofs produced by this server for a given circuit version.
+type TestVectorBundle struct {
+	Circuit        string       `json:"circuit"`
+	CircuitVersion int          `json:"circuitVersion"`
+	Curve          string       `json:"curve"`
+	Backend        string       `json:"backend"`
+	GnarkVersion   string       `json:"gnarkVersion"`
+	VerifyingKey   string       `json:"verifyingKey"` // base64, gnark binary encoding
+	Vectors        []TestVector `json:"vectors"`
+	GeneratedAt    time.Time    `json:"generatedAt"`
+}
+
+// testVectorCase describes how a vector is produced: a proof is generated for
+// Balance/ProvedAmount and then checked against CheckedAmount.
+type testVectorCase struct {
+	Name          string
+	Balance       int
+	ProvedAmount  int
+	CheckedAmount int
+}
+
+var testVectorCases = []testVectorCase{
+	{Name: "sufficient balance", Balance: 150, ProvedAmount: 100, CheckedAmount: 100},
+	{Name: "exact balance", Balance: 100, ProvedAmount: 100, CheckedAmount: 100},
+	{Name: "zero threshold", Balance: 0, ProvedAmount: 0, CheckedAmount: 0},
+	{Name: "public input mismatch", Balance: 150, ProvedAmount: 100, CheckedAmount: 120},
+}
+
+// encodeBase64 serializes a gnark object with its binary encoding and returns it as base64
+func encodeBase64(v io.WriterTo) (string, error) {
+	var buf bytes.Buffer
+	if _, err := v.WriteTo(&buf); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// buildTestVectors runs a setup for the balance circuit and produces a self-consistent bundle
+func buildTestVectors() (*TestVectorBundle, error) {
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &circuits.BalanceCircuit{})
+	if err != nil {
+		return nil, err
+	}
+
+	pk, vk, err := groth16.Setup(ccs)
+	if err != nil {
+		return nil, err
+	}
+
+	vkEncoded, err := encodeBase64(vk)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := &TestVectorBundle{
+		Circuit:        balanceCircuitName,
+		CircuitVersion: balanceCircuitVersion,
+		Curve:          ecc.BN254.String(),
+		Backend:        "groth16",
+		GnarkVersion:   gnark.Version.String(),
+		VerifyingKey:   vkEncoded,
+		GeneratedAt:    time.Now().UTC(),
+	}
+
+	for _, tc := range testVectorCases {
+		witness, err := frontend.NewWitness(&circuits.BalanceCircuit{
+			Balance:      tc.Balance,
+			NeededAmount: tc.ProvedAmount,
+		}, ecc.BN254.ScalarField())
+		if err != nil {
+			return nil, err
+		}
+
+		proof, err := groth16.Prove(ccs, pk, witness)
+		if err != nil {
+			return nil, err
+		}
+
+		publicWitness, err := frontend.NewWitness(&circuits.BalanceCircuit{
+			NeededAmount: tc.CheckedAmount,
+		}, ecc.BN254.ScalarField(), frontend.PublicOnly())
+		if err != nil {
+			return nil, err
+		}
+
+		proofEncoded, err := encodeBase64(proof)
+		if err != nil {
+			return nil, err
+		}
+
+		witnessEncoded, err := encodeBase64(publicWitness)
+		if err != nil {
+			return nil, err
+		}
+
+		bundle.Vectors = append(bundle.Vectors, TestVector{
+			Name:          tc.Name,
+			PublicInputs:  map[string]string{"neededAmount": strconv.Itoa(tc.CheckedAmount)},
+			PublicWitness: witnessEncoded,
+			Proof:         proofEncoded,
+			ExpectValid:   groth16.Verify(proof, vk, publicWitness) == nil,
+		})
+	}
+
+	return bundle, nil
+}
+
+// exportTestVectors serves the canonical test vector bundle for the current circuit version
+func exportTestVectors(w http.ResponseWriter, r *http.Request) {
+	bundle, err := buildTestVectors()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(bundle); err != nil {
+		log.Printf("Failed to encode test vectors: %v", err)
+	}
+}
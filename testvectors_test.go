@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/backend/witness"
+)
+
+func TestRequireAdmin(t *testing.T) {
+	handler := requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name           string
+		configured     string
+		authorization  string
+		expectedStatus int
+	}{
+		{"Admin API disabled", "", "Bearer secret", http.StatusForbidden},
+		{"Missing token", "secret", "", http.StatusUnauthorized},
+		{"Wrong token", "secret", "Bearer wrong", http.StatusUnauthorized},
+		{"Valid token", "secret", "Bearer secret", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(secretEnvName(adminTokenSecret), tt.configured)
+
+			req := httptest.NewRequest("GET", "/admin/test-vectors", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestExportTestVectors(t *testing.T) {
+	SkipIfShort(t, "test vector generation")
+
+	req := httptest.NewRequest("GET", "/admin/test-vectors", nil)
+	rr := httptest.NewRecorder()
+	exportTestVectors(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var bundle TestVectorBundle
+	if err := json.Unmarshal(rr.Body.Bytes(), &bundle); err != nil {
+		t.Fatalf("Failed to decode bundle: %v", err)
+	}
+
+	if bundle.Circuit != balanceCircuitName || bundle.CircuitVersion != balanceCircuitVersion {
+		t.Errorf("Unexpected circuit identity %s v%d", bundle.Circuit, bundle.CircuitVersion)
+	}
+	if len(bundle.Vectors) != len(testVectorCases) {
+		t.Fatalf("Expected %d vectors, got %d", len(testVectorCases), len(bundle.Vectors))
+	}
+
+	// Independently re-verify every vector from its serialized form
+	vk := groth16.NewVerifyingKey(ecc.BN254)
+	if _, err := vk.ReadFrom(bytes.NewReader(mustDecodeBase64(t, bundle.VerifyingKey))); err != nil {
+		t.Fatalf("Failed to decode verifying key: %v", err)
+	}
+
+	for _, v := range bundle.Vectors {
+		t.Run(v.Name, func(t *testing.T) {
+			proof := groth16.NewProof(ecc.BN254)
+			if _, err := proof.ReadFrom(bytes.NewReader(mustDecodeBase64(t, v.Proof))); err != nil {
+				t.Fatalf("Failed to decode proof: %v", err)
+			}
+
+			publicWitness, err := witness.New(ecc.BN254.ScalarField())
+			if err != nil {
+				t.Fatalf("Failed to create witness: %v", err)
+			}
+			if err := publicWitness.UnmarshalBinary(mustDecodeBase64(t, v.PublicWitness)); err != nil {
+				t.Fatalf("Failed to decode public witness: %v", err)
+			}
+
+			valid := groth16.Verify(proof, vk, publicWitness) == nil
+			if valid != v.ExpectValid {
+				t.Errorf("Expected valid=%v, got %v", v.ExpectValid, valid)
+			}
+		})
+	}
+}
+
+func mustDecodeBase64(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatalf("Failed to decode base64: %v", err)
+	}
+	return b
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/korjavin/zkTest1/circuits"
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// Tier is a labelled balance threshold
+type Tier struct {
+	Label     string `json:"label"`
+	Threshold int64  `json:"threshold"`
+}
+
+// balanceTiers are the tiers certificates can name, by ascending threshold
+var balanceTiers = []Tier{{"bronze", 1000}, {"silver", 10000}, {"gold", 100000}}
+
+var errTierClaimUnsigned = errs.New(errs.Unauthorized, "tier_claim_unsigned", "tier claim is not signed")
+
+// parseTiers parses comma-separated label=threshold pairs with strictly ascending thresholds
+func parseTiers(values []string) ([]Tier, error) {
+	tiers := make([]Tier, 0, len(values))
+	for _, v := range values {
+		label, threshold, ok := strings.Cut(v, "=")
+		t, err := strconv.ParseInt(threshold, 10, 64)
+		if !ok || label == "" || err != nil || t < 0 {
+			return nil, fmt.Errorf("invalid tier %q, expected label=threshold", v)
+		}
+		if len(tiers) > 0 && t <= tiers[len(tiers)-1].Threshold {
+			return nil, errors.New("tier thresholds must be strictly ascending")
+		}
+		tiers = append(tiers, Tier{Label: label, Threshold: t})
+	}
+	if len(tiers) == 0 {
+		return nil, errors.New("at least one tier is required")
+	}
+	return tiers, nil
+}
+
+// tierFor returns the highest tier whose threshold balance reaches
+func tierFor(balance int64) (Tier, bool) {
+	for i := len(balanceTiers) - 1; i >= 0; i-- {
+		if balance >= balanceTiers[i].Threshold {
+			return balanceTiers[i], true
+		}
+	}
+	return Tier{}, false
+}
+
+// TierClaim states the tier of a user's balance. It names the balance proof that backs it by
+// digest, so relying parties can take the label as is or check the proof themselves.
+type TierClaim struct {
+	Tier        string    `json:"tier"`
+	Threshold   int64     `json:"threshold"`   // the proof shows balance ≥ threshold
+	ProofDigest string    `json:"proofDigest"` // SHA-256 of the proof's binary encoding
+	Curve       string    `json:"curve"`
+	Audience    string    `json:"audience,omitempty"`
+	IssuedAt    time.Time `json:"issuedAt"`
+	Issuer      string    `json:"issuer"` // DID of the server; kid names its key
+	KeyID       string    `json:"kid"`
+	Signature   []byte    `json:"signature"` // ES256 over the claim without kid and signature
+}
+
+// payload is what the signature of c covers
+func (c TierClaim) payload() ([]byte, error) {
+	c.KeyID, c.Signature = "", nil
+	return json.Marshal(c)
+}
+
+type TierProofRequest struct {
+	ID       string `json:"id"`
+	Audience string `json:"audience,omitempty"` // relying party the certificate is for
+}
+
+// TierCertificate is a signed tier claim with the balance proof it is about
+type TierCertificate struct {
+	Claim TierClaim     `json:"claim"`
+	Proof groth16.Proof `json:"proof"`
+}
+
+type TierValidateRequest struct {
+	Claim        TierClaim       `json:"claim"`
+	Proof        json.RawMessage `json:"proof"`
+	GnarkVersion string          `json:"gnarkVersion,omitempty"` // release the proof was serialized with; this server's when empty
+}
+
+// listTiers returns the configured balance tiers
+func listTiers(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, balanceTiers)
+}
+
+// generateTierCertificate proves the threshold of the highest tier the stored balance reaches
+// and signs a claim naming the tier, so relying parties get the label along with the proof
+func generateTierCertificate(w http.ResponseWriter, r *http.Request) {
+	var req TierProofRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := checkSessionUser(r, req.ID); err != nil {
+		writeError(w, err)
+		return
+	}
+	// The label is only worth the signature on it
+	if signer == nil {
+		writeError(w, errs.Errorf(errs.Unavailable, "signing is not configured"))
+		return
+	}
+
+	balance, ledgerTx, exists := lookupBalance(req.ID)
+	if !exists {
+		writeError(w, errBalanceNotFound)
+		return
+	}
+	if err := checkBalanceAttestation(req.ID, time.Now()); err != nil {
+		writeError(w, err)
+		return
+	}
+	tier, ok := tierFor(int64(balance))
+	if !ok {
+		writeError(w, errs.Errorf(errs.Unprocessable, "balance is below the lowest tier"))
+		return
+	}
+	if err := checkTenantAccess(r, balanceCircuitName, tier.Threshold); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := checkConsent(req.ID, req.Audience, balanceCircuitName, tier.Label, time.Now()); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := checkUserIssuance(req.ID); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	curve := proofCurve(r, balanceCircuitName)
+	setup, err := loadCurveSetup(curve, balanceCircuitName, &circuits.BalanceCircuit{})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	assignment := &circuits.BalanceCircuit{Balance: balance, NeededAmount: tier.Threshold}
+	proof, err := setup.prove(r.Context(), assignment)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	claim := TierClaim{
+		Tier:      tier.Label,
+		Threshold: tier.Threshold,
+		Curve:     curve.String(),
+		Audience:  req.Audience,
+		IssuedAt:  time.Now().UTC().Truncate(time.Second),
+		Issuer:    issuerDID,
+	}
+	if claim.ProofDigest, err = proofDigest(proof); err != nil {
+		writeError(w, err)
+		return
+	}
+	payload, err := claim.payload()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if claim.Signature, err = signMessage(signer, payload); err != nil {
+		writeError(w, err)
+		return
+	}
+	claim.KeyID = signer.KeyID()
+
+	digest, err := persistProof(r.Context(), proof, ProofRecord{
+		Circuit:        balanceCircuitName,
+		CircuitVersion: balanceCircuitVersion,
+		Curve:          recordedCurve(curve),
+		LedgerTx:       ledgerTx,
+		PublicInputs:   map[string]string{"neededAmount": strconv.FormatInt(tier.Threshold, 10), "tier": tier.Label},
+		Audience:       req.Audience,
+		Holder:         req.ID,
+	})
+	if err != nil {
+		log.Printf("Failed to persist proof: %v", err)
+	}
+	if digest != "" {
+		w.Header().Set("X-Proof-Digest", digest)
+	}
+	setProofHeaders(w, curve, assignment)
+	signIssuedProof(w, curve, balanceCircuitName, map[string]int64{"neededAmount": tier.Threshold}, proof, assignment)
+
+	writeProof(w, r, proof, TierCertificate{Claim: claim, Proof: proof})
+}
+
+// validateTierCertificate checks the signature of a tier claim with its issuer's DID, that the
+// proof is the one the claim names and that it proves the claimed threshold
+func validateTierCertificate(w http.ResponseWriter, r *http.Request) {
+	var req TierValidateRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	claim := req.Claim
+	if len(claim.Signature) == 0 {
+		writeError(w, errTierClaimUnsigned)
+		return
+	}
+	payload, err := claim.payload()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := verifyDIDSignature(r.Context(), claim.Issuer, claim.KeyID, payload, claim.Signature); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	curve, err := verifyCurve(claim.Curve, balanceCircuitName)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	proof, err := decodeProof(curve, req.GnarkVersion, req.Proof)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if digest, err := proofDigest(proof); err != nil || digest != claim.ProofDigest {
+		writeError(w, errs.Errorf(errs.Invalid, "proof is not the one the claim names"))
+		return
+	}
+	public := &circuits.BalanceCircuit{NeededAmount: claim.Threshold}
+	if err := verifyWithSetup(r.Context(), curve, balanceCircuitName, &circuits.BalanceCircuit{}, proof, public); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, claim)
+}
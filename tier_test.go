@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseTiers(t *testing.T) {
+	tiers, err := parseTiers([]string{"bronze=1000", "silver=10000", "gold=100000"})
+	if err != nil || len(tiers) != 3 || tiers[2] != (Tier{"gold", 100000}) {
+		t.Errorf("Expected three tiers, got %v, %v", tiers, err)
+	}
+	for _, values := range [][]string{
+		{"bronze=1000", "silver=500"},
+		{"bronze"},
+		{"=1000"},
+		{"bronze=-1"},
+		{"bronze=many"},
+	} {
+		if _, err := parseTiers(values); err == nil {
+			t.Errorf("Expected %v to be rejected", values)
+		}
+	}
+}
+
+func TestTierCertificate(t *testing.T) {
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+	t.Cleanup(h.SetupCleanBalances)
+	withIssuer(t)
+
+	h.AssertStatusCode(h.StoreBalance("tier_user", 25000), http.StatusOK, "storing a balance")
+	h.AssertStatusCode(h.StoreBalance("tierless_user", 10), http.StatusOK, "storing a small balance")
+
+	rr := postJSON(t, generateTierCertificate, "/get/proof/tier", TierProofRequest{ID: "tier_user", Audience: "lender.example"})
+	h.AssertStatusCode(rr, http.StatusOK, "issuing a tier certificate")
+	var cert struct {
+		Claim TierClaim       `json:"claim"`
+		Proof json.RawMessage `json:"proof"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &cert); err != nil {
+		t.Fatalf("Failed to decode certificate: %v", err)
+	}
+	if cert.Claim.Tier != "silver" || cert.Claim.Threshold != 10000 || cert.Claim.Issuer != issuerDID {
+		t.Errorf("Expected a silver claim by this server, got %+v", cert.Claim)
+	}
+	if cert.Claim.ProofDigest != rr.Header().Get("X-Proof-Digest") {
+		t.Error("Expected the claim to name the issued proof")
+	}
+
+	rr = postJSON(t, validateTierCertificate, "/validate/tier", TierValidateRequest{Claim: cert.Claim, Proof: cert.Proof})
+	h.AssertStatusCode(rr, http.StatusOK, "validating a tier certificate")
+
+	forged := cert.Claim
+	forged.Tier = "gold"
+	rr = postJSON(t, validateTierCertificate, "/validate/tier", TierValidateRequest{Claim: forged, Proof: cert.Proof})
+	h.AssertStatusCode(rr, http.StatusUnauthorized, "validating a relabelled claim")
+
+	unsigned := cert.Claim
+	unsigned.Signature = nil
+	rr = postJSON(t, validateTierCertificate, "/validate/tier", TierValidateRequest{Claim: unsigned, Proof: cert.Proof})
+	h.AssertStatusCode(rr, http.StatusUnauthorized, "validating an unsigned claim")
+	if !strings.Contains(rr.Body.String(), errTierClaimUnsigned.Code) {
+		t.Errorf("Expected %s, got %s", errTierClaimUnsigned.Code, rr.Body.String())
+	}
+
+	rr = postJSON(t, generateTierCertificate, "/get/proof/tier", TierProofRequest{ID: "tierless_user"})
+	h.AssertStatusCode(rr, http.StatusUnprocessableEntity, "balance below every tier")
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/korjavin/zkTest1/circuits"
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// Identity of the time-locked balance circuit
+const (
+	timeLockCircuitName    = circuits.TimeLockName
+	timeLockCircuitVersion = 2
+)
+
+// errNotYetValid is returned for time-locked proofs presented before their notBefore time
+var errNotYetValid = errs.New(errs.Forbidden, "not_yet_valid", "proof is not valid yet")
+
+// maxNotBefore is the latest notBefore the circuit can represent
+var maxNotBefore = time.Unix(1<<circuits.TimestampBits-1, 0)
+
+func checkNotBefore(notBefore time.Time) error {
+	if notBefore.Unix() < 0 || notBefore.After(maxNotBefore) {
+		return fmt.Errorf("notBefore must be between 1970 and %d", maxNotBefore.Year())
+	}
+	return nil
+}
+
+// verifyTimeLocked checks the verifier clock against notBefore, then the proof on curve against its public inputs.
+// It returns errNotYetValid before notBefore and errInvalidProof when the proof does not verify.
+func verifyTimeLocked(ctx context.Context, curve ecc.ID, proof groth16.Proof, neededAmount int, notBefore, now time.Time) error {
+	if now.Before(notBefore) {
+		return fmt.Errorf("%w: valid from %s", errNotYetValid, notBefore.UTC().Format(time.RFC3339))
+	}
+
+	setup, err := loadCurveSetup(curve, timeLockCircuitName, &circuits.TimeLockedBalanceCircuit{})
+	if err != nil {
+		return err
+	}
+	return setup.verify(ctx, proof, &circuits.TimeLockedBalanceCircuit{NeededAmount: neededAmount, NotBefore: notBefore.Unix()})
+}
+
+type TimeLockedProofRequest struct {
+	ID           string    `json:"id"`
+	NeededAmount int       `json:"neededAmount"`
+	NotBefore    time.Time `json:"notBefore"`
+}
+
+type TimeLockedValidateRequest struct {
+	NeededAmount int             `json:"neededAmount"`
+	NotBefore    time.Time       `json:"notBefore"`
+	Proof        json.RawMessage `json:"proof"`
+	Curve        string          `json:"curve,omitempty"` // curve the proof was made on; bn254 when empty
+}
+
+// generateTimeLockedProof proves a balance threshold in a proof that only verifies from notBefore on
+func generateTimeLockedProof(w http.ResponseWriter, r *http.Request) {
+	var req TimeLockedProofRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := checkSessionUser(r, req.ID); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := checkNotBefore(req.NotBefore); err != nil {
+		writeError(w, errs.Wrap(errs.Invalid, err))
+		return
+	}
+	var err error
+	if req.NeededAmount, err = roundThreshold(req.NeededAmount); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := checkTenantAccess(r, timeLockCircuitName, int64(req.NeededAmount)); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := checkUserIssuance(req.ID); err != nil {
+		writeError(w, err)
+		return
+	}
+	observeThreshold(tenantID(r), req.ID, timeLockCircuitName, int64(req.NeededAmount))
+
+	balance, ledgerTx, exists := lookupBalance(req.ID)
+
+	if !exists {
+		writeError(w, errBalanceNotFound)
+		return
+	}
+	if err := checkBalanceAttestation(req.ID, time.Now()); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	curve := proofCurve(r, timeLockCircuitName)
+	setup, err := loadCurveSetup(curve, timeLockCircuitName, &circuits.TimeLockedBalanceCircuit{})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	assignment := &circuits.TimeLockedBalanceCircuit{
+		Balance:      balance,
+		NeededAmount: req.NeededAmount,
+		NotBefore:    req.NotBefore.Unix(),
+	}
+	proof, err := setup.prove(r.Context(), assignment)
+	if err != nil {
+		if !isContextError(err) && !errors.Is(err, errProvingUnavailable) {
+			// Solver errors include witness values, so they must not reach the client or the logs
+			err = errs.Errorf(errs.Unprocessable, "balance does not cover neededAmount")
+		}
+		writeError(w, err)
+		return
+	}
+
+	digest, err := persistProof(r.Context(), proof, ProofRecord{
+		Circuit:        timeLockCircuitName,
+		CircuitVersion: timeLockCircuitVersion,
+		Curve:          recordedCurve(curve),
+		LedgerTx:       ledgerTx,
+		PublicInputs: map[string]string{
+			"neededAmount": strconv.Itoa(req.NeededAmount),
+			"notBefore":    req.NotBefore.UTC().Format(time.RFC3339),
+		},
+		Holder: req.ID,
+	})
+	if err != nil {
+		log.Printf("Failed to persist proof: %v", err)
+	}
+	if digest != "" {
+		w.Header().Set("X-Proof-Digest", digest)
+	}
+	if roundThresholds {
+		w.Header().Set(provedThresholdHeader, strconv.Itoa(req.NeededAmount))
+	}
+	setProofHeaders(w, curve, assignment)
+	signIssuedProof(w, curve, timeLockCircuitName, map[string]any{"neededAmount": req.NeededAmount, "notBefore": req.NotBefore}, proof, assignment)
+
+	writeProof(w, r, proof, nil)
+}
+
+// validateTimeLockedProof verifies a time-locked proof, rejecting it before its notBefore time
+func validateTimeLockedProof(w http.ResponseWriter, r *http.Request) {
+	var req TimeLockedValidateRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := checkNotBefore(req.NotBefore); err != nil {
+		writeError(w, errs.Wrap(errs.Invalid, err))
+		return
+	}
+	if err := checkTenantAccess(r, timeLockCircuitName, int64(req.NeededAmount)); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	curve, err := verifyCurve(req.Curve, timeLockCircuitName)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	proof, err := decodeProofJSON(curve, req.Proof)
+	if err != nil {
+		writeError(w, fmt.Errorf("%w: %v", errMalformedProof, err))
+		return
+	}
+
+	err = verifyTimeLocked(r.Context(), curve, proof, req.NeededAmount, req.NotBefore, time.Now())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTimeLockedRejectsBeforeNotBefore(t *testing.T) {
+	notBefore := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	err := verifyTimeLocked(context.Background(), defaultCurve, nil, 100, notBefore, notBefore.Add(-time.Second))
+	if !errors.Is(err, errNotYetValid) {
+		t.Errorf("Expected errNotYetValid before notBefore, got %v", err)
+	}
+}
+
+func TestTimeLockedProofRequestValidation(t *testing.T) {
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+	h.StoreBalance("timelock_user", 150)
+
+	tests := []struct {
+		name           string
+		request        TimeLockedProofRequest
+		expectedStatus int
+	}{
+		{"Unknown user", TimeLockedProofRequest{ID: "nobody", NeededAmount: 100, NotBefore: time.Now()}, http.StatusNotFound},
+		{"Before 1970", TimeLockedProofRequest{ID: "timelock_user", NeededAmount: 100, NotBefore: time.Unix(-1, 0)}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := postJSON(t, generateTimeLockedProof, "/get/proof/timelocked", tt.request)
+			h.AssertStatusCode(rr, tt.expectedStatus, tt.name)
+		})
+	}
+}
+
+func TestTimeLockedProofWorkflow(t *testing.T) {
+	SkipIfShort(t, "time-locked proof")
+
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+	h.StoreBalance("timelock_user", 150)
+
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	future := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	matured := postJSON(t, generateTimeLockedProof, "/get/proof/timelocked", TimeLockedProofRequest{
+		ID: "timelock_user", NeededAmount: 100, NotBefore: past,
+	})
+	h.AssertStatusCode(matured, http.StatusOK, "generating matured proof")
+
+	pending := postJSON(t, generateTimeLockedProof, "/get/proof/timelocked", TimeLockedProofRequest{
+		ID: "timelock_user", NeededAmount: 100, NotBefore: future,
+	})
+	h.AssertStatusCode(pending, http.StatusOK, "generating pending proof")
+
+	tests := []struct {
+		name           string
+		request        TimeLockedValidateRequest
+		expectedStatus int
+	}{
+		{"Valid after notBefore", TimeLockedValidateRequest{NeededAmount: 100, NotBefore: past, Proof: matured.Body.Bytes()}, http.StatusOK},
+		{"Rejected before notBefore", TimeLockedValidateRequest{NeededAmount: 100, NotBefore: future, Proof: pending.Body.Bytes()}, http.StatusForbidden},
+		{"Earlier notBefore does not verify", TimeLockedValidateRequest{NeededAmount: 100, NotBefore: past, Proof: pending.Body.Bytes()}, http.StatusUnauthorized},
+		{"Other amount does not verify", TimeLockedValidateRequest{NeededAmount: 50, NotBefore: past, Proof: matured.Body.Bytes()}, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := postJSON(t, validateTimeLockedProof, "/validate/timelocked", tt.request)
+			h.AssertStatusCode(rr, tt.expectedStatus, tt.name)
+		})
+	}
+
+	rr := postJSON(t, generateTimeLockedProof, "/get/proof/timelocked", TimeLockedProofRequest{
+		ID: "timelock_user", NeededAmount: 200, NotBefore: past,
+	})
+	h.AssertStatusCode(rr, http.StatusUnprocessableEntity, "proving an uncovered amount")
+}
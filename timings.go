@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/consensys/gnark/backend/groth16"
+)
+
+// proofSizeHeader carries the size in bytes of the binary encoding of an issued proof
+const proofSizeHeader = "X-Proof-Size"
+
+// requestTimings collects the proving and verification costs of one request
+type requestTimings struct {
+	mu        sync.Mutex
+	queue     time.Duration // waiting for a proving worker
+	proving   time.Duration
+	verifying time.Duration
+	proofSize int
+	proofs    int
+	verified  int
+}
+
+type requestTimingsKey struct{}
+
+// timingsOf returns the timings of the request ctx belongs to, or nil outside reportTimings
+func timingsOf(ctx context.Context) *requestTimings {
+	t, _ := ctx.Value(requestTimingsKey{}).(*requestTimings)
+	return t
+}
+
+// addProof records a proof that waited for a worker and then took the given time
+func (t *requestTimings) addProof(waited, took time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.queue += waited
+	t.proving += took
+	t.proofs++
+}
+
+// addProofSize records the size of an issued proof
+func (t *requestTimings) addProofSize(proof groth16.Proof) {
+	if t == nil {
+		return
+	}
+	size, err := encodedSize(proof)
+	if err != nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.proofSize += size
+}
+
+// addVerification records a SNARK verification that took the given time
+func (t *requestTimings) addVerification(took time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.verifying += took
+	t.verified++
+}
+
+// ProofMetrics are the costs of issuing and checking a proof, as reported in the Server-Timing
+// and X-Proof-Size headers. They are informational and not covered by a bundle's manifest.
+type ProofMetrics struct {
+	SizeBytes   int     `json:"sizeBytes,omitempty"`
+	QueueMs     float64 `json:"queueMs,omitempty"`
+	ProvingMs   float64 `json:"provingMs,omitempty"`
+	VerifyingMs float64 `json:"verifyingMs,omitempty"`
+}
+
+// serverTiming returns the Server-Timing header value of what was recorded, and the proof size
+func (t *requestTimings) serverTiming() (string, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var parts []string
+	if t.proofs > 0 {
+		parts = append(parts, fmt.Sprintf("queue;dur=%.3f", milliseconds(t.queue)), fmt.Sprintf("prove;dur=%.3f", milliseconds(t.proving)))
+	}
+	if t.verified > 0 {
+		parts = append(parts, fmt.Sprintf("verify;dur=%.3f", milliseconds(t.verifying)))
+	}
+	return strings.Join(parts, ", "), t.proofSize
+}
+
+// timingsWriter adds the recorded timings to the response headers just before they are sent
+type timingsWriter struct {
+	http.ResponseWriter
+	timings *requestTimings
+	written bool
+}
+
+func (w *timingsWriter) WriteHeader(status int) {
+	if !w.written {
+		w.written = true
+		timing, size := w.timings.serverTiming()
+		if timing != "" {
+			w.Header().Add("Server-Timing", timing)
+		}
+		if size > 0 {
+			w.Header().Set(proofSizeHeader, strconv.Itoa(size))
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *timingsWriter) Write(p []byte) (int, error) {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *timingsWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// reportTimings tells clients and load balancers what proving and verifying cost each request:
+// queue wait, proving and verification time in Server-Timing, and the proof size in X-Proof-Size
+func reportTimings(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timings := &requestTimings{}
+		ctx := context.WithValue(r.Context(), requestTimingsKey{}, timings)
+		next.ServeHTTP(&timingsWriter{ResponseWriter: w, timings: timings}, r.WithContext(ctx))
+	})
+}
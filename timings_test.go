@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/korjavin/zkTest1/circuits"
+)
+
+func TestReportTimings(t *testing.T) {
+	t.Run("Nothing recorded", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		reportTimings(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, map[string]bool{"ok": true})
+		})).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+		if rr.Header().Get("Server-Timing") != "" || rr.Header().Get(proofSizeHeader) != "" {
+			t.Errorf("Expected no timing headers, got %v", rr.Header())
+		}
+	})
+
+	t.Run("Proving and verifying", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		reportTimings(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			timings := timingsOf(r.Context())
+			timings.addProof(2*time.Millisecond, 30*time.Millisecond)
+			timings.addVerification(time.Millisecond)
+			timings.addVerification(time.Millisecond)
+			writeJSON(w, map[string]bool{"ok": true})
+		})).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+		if got, want := rr.Header().Get("Server-Timing"), "queue;dur=2.000, prove;dur=30.000, verify;dur=2.000"; got != want {
+			t.Errorf("Expected Server-Timing %q, got %q", want, got)
+		}
+	})
+
+	t.Run("Outside the middleware", func(t *testing.T) {
+		// Recording without reportTimings is a no-op rather than a panic
+		timingsOf(httptest.NewRequest("GET", "/", nil).Context()).addVerification(time.Millisecond)
+	})
+}
+
+func TestReportTimingsOfProof(t *testing.T) {
+	SkipIfShort(t, "balance proof generation")
+
+	balancesMu.Lock()
+	balances["timings"] = 150
+	balancesMu.Unlock()
+
+	body, _ := json.Marshal(ProofRequest{ID: "timings", NeededAmount: 100})
+	rr := httptest.NewRecorder()
+	reportTimings(http.HandlerFunc(generateProof)).ServeHTTP(rr, httptest.NewRequest("POST", "/get/proof/neededAmount", bytes.NewReader(body)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if size, _ := strconv.Atoi(rr.Header().Get(proofSizeHeader)); size <= 0 {
+		t.Errorf("Expected a positive %s, got %q", proofSizeHeader, rr.Header().Get(proofSizeHeader))
+	}
+	if timing := rr.Header().Get("Server-Timing"); !strings.Contains(timing, "queue;dur=") || !strings.Contains(timing, "prove;dur=") {
+		t.Errorf("Expected queue and proving times, got %q", timing)
+	}
+}
+
+func TestReportTimingsOfVerification(t *testing.T) {
+	SkipIfShort(t, "bucket proof generation")
+
+	setup, err := loadSetup(bucketCircuitName, &circuits.BucketCircuit{})
+	if err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+	assignment := &circuits.BucketCircuit{Balance: 1500, Lower: 1000, Upper: 10000}
+	proof, err := setup.prove(context.Background(), assignment)
+	if err != nil {
+		t.Fatalf("Prove failed: %v", err)
+	}
+	proofJSON, _ := json.Marshal(proof)
+	public, err := encodePublicWitness(defaultCurve, assignment)
+	if err != nil {
+		t.Fatalf("Failed to encode public witness: %v", err)
+	}
+	body, _ := json.Marshal(ValidateRequest{Proof: proofJSON, PublicWitness: public, Circuit: bucketCircuitName})
+	rr := httptest.NewRecorder()
+	reportTimings(http.HandlerFunc(validateProof)).ServeHTTP(rr, httptest.NewRequest("POST", "/validate", bytes.NewReader(body)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if timing := rr.Header().Get("Server-Timing"); !strings.HasPrefix(timing, "verify;dur=") {
+		t.Errorf("Expected only a verification time, got %q", timing)
+	}
+}
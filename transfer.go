@@ -0,0 +1,482 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/blang/semver/v4"
+	"github.com/consensys/gnark"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// transferPrefix starts every chunk of the QR transfer format, like HC1: in EU digital COVID certificates
+const transferPrefix = "ZK1:"
+
+// Limits of the transfer format. 4000 characters fit a version 40 QR code in alphanumeric mode.
+const (
+	minTransferChunk   = 64
+	maxTransferChunk   = 4000
+	maxTransferChunks  = 64
+	maxTransferDecoded = 1 << 20
+)
+
+// CBOR map keys of an encoded envelope; the proof is gnark's compressed binary encoding
+const (
+	transferCircuit       = 1
+	transferInputs        = 2
+	transferProof         = 3
+	transferGnarkVersion  = 4
+	transferPublicWitness = 5
+	transferCurve         = 6
+)
+
+var errTransferMalformed = errs.New(errs.Invalid, "transfer_malformed", "malformed transfer encoding")
+
+// TransferEncoding is a proof envelope as base45 text, split into chunks of at most chunkSize characters
+type TransferEncoding struct {
+	Chunks []string `json:"chunks"`
+	Size   int      `json:"size"` // characters over all chunks
+}
+
+// TransferDecodeRequest carries the scanned chunks, in any order
+type TransferDecodeRequest struct {
+	Chunks []string `json:"chunks"`
+}
+
+// encodeTransfer packs an envelope as zlib-compressed CBOR, with the proof in gnark's binary form
+func encodeTransfer(m ProofEnvelope) ([]byte, error) {
+	if m.Backend != "" && m.Backend != proofBackend {
+		return nil, fmt.Errorf("unsupported backend %q", m.Backend)
+	}
+	curve, err := parseCurve(m.Curve)
+	if err != nil {
+		return nil, err
+	}
+	proof, err := decodeProof(curve, m.GnarkVersion, m.Proof)
+	if err != nil {
+		return nil, err
+	}
+	var binary bytes.Buffer
+	if _, err := proof.WriteTo(&binary); err != nil {
+		return nil, err
+	}
+	var inputs []byte
+	if len(m.Inputs) > 0 {
+		if inputs, err = compactJSON(m.Inputs); err != nil {
+			return nil, fmt.Errorf("inputs: %w", err)
+		}
+	}
+
+	var w cborWriter
+	fields := 3 // circuit, proof and gnark version are always written
+	for _, present := range []bool{len(inputs) > 0, len(m.PublicWitness) > 0, m.Curve != ""} {
+		if present {
+			fields++
+		}
+	}
+	w.head(cborMap, uint64(fields))
+	w.uint(transferCircuit)
+	w.text(m.Circuit)
+	if len(inputs) > 0 {
+		w.uint(transferInputs)
+		w.text(string(inputs))
+	}
+	w.uint(transferProof)
+	w.bytes(binary.Bytes())
+	w.uint(transferGnarkVersion)
+	w.text(gnark.Version.String())
+	if len(m.PublicWitness) > 0 {
+		w.uint(transferPublicWitness)
+		w.bytes(m.PublicWitness)
+	}
+	if m.Curve != "" {
+		w.uint(transferCurve)
+		w.text(m.Curve)
+	}
+
+	var compressed bytes.Buffer
+	zw, _ := zlib.NewWriterLevel(&compressed, zlib.BestCompression)
+	if _, err := zw.Write(w.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return compressed.Bytes(), nil
+}
+
+// decodeTransfer unpacks what encodeTransfer packed; the proof is returned as JSON of this
+// server's gnark release
+func decodeTransfer(data []byte) (ProofEnvelope, error) {
+	m, binary, version, err := readTransfer(data)
+	if err != nil {
+		return m, fmt.Errorf("%w: %v", errTransferMalformed, err)
+	}
+
+	// The binary encoding is only read by the release line that wrote it
+	v, err := semver.ParseTolerant(version)
+	if err != nil || v.Major != gnark.Version.Major || v.Minor != gnark.Version.Minor {
+		return m, fmt.Errorf("%w: %q, this server reads binary proofs from gnark %d.%d.x",
+			errProofVersion, version, gnark.Version.Major, gnark.Version.Minor)
+	}
+	curve, err := parseCurve(m.Curve)
+	if err != nil {
+		return m, err
+	}
+	proof := groth16.NewProof(curve)
+	if _, err := proof.ReadFrom(bytes.NewReader(binary)); err != nil {
+		return m, fmt.Errorf("%w: %v", errMalformedProof, err)
+	}
+	if m.Proof, err = json.Marshal(proof); err != nil {
+		return m, err
+	}
+	m.GnarkVersion = gnark.Version.String()
+	m.Backend = proofBackend
+	return m, nil
+}
+
+// readTransfer decompresses and parses an encoded envelope, returning the binary proof and the
+// gnark version that wrote it separately
+func readTransfer(data []byte) (m ProofEnvelope, binary []byte, version string, err error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return m, nil, "", err
+	}
+	raw, err := io.ReadAll(io.LimitReader(zr, maxTransferDecoded+1))
+	if err != nil {
+		return m, nil, "", err
+	}
+	if len(raw) > maxTransferDecoded {
+		return m, nil, "", fmt.Errorf("decoded envelope exceeds %d bytes", maxTransferDecoded)
+	}
+
+	r := cborReader{data: raw}
+	n, err := r.expect(cborMap)
+	if err != nil {
+		return m, nil, "", err
+	}
+	for range n {
+		key, err := r.expect(cborUint)
+		if err != nil {
+			return m, nil, "", err
+		}
+		switch key {
+		case transferCircuit:
+			m.Circuit, err = r.text()
+		case transferInputs:
+			var inputs string
+			inputs, err = r.text()
+			m.Inputs = json.RawMessage(inputs)
+		case transferProof:
+			binary, err = r.bytes()
+		case transferGnarkVersion:
+			version, err = r.text()
+		case transferPublicWitness:
+			m.PublicWitness, err = r.bytes()
+		case transferCurve:
+			m.Curve, err = r.text()
+		default:
+			err = fmt.Errorf("unknown field %d", key)
+		}
+		if err != nil {
+			return m, nil, "", err
+		}
+	}
+	if r.pos != len(raw) {
+		return m, nil, "", errors.New("trailing data after the envelope")
+	}
+	if m.Circuit == "" || binary == nil {
+		return m, nil, "", errors.New("circuit and proof are required")
+	}
+	if len(m.Inputs) > 0 && !json.Valid(m.Inputs) {
+		return m, nil, "", errors.New("inputs are not JSON")
+	}
+	return m, binary, version, nil
+}
+
+// chunkTransfer splits base45 text into prefixed chunks "ZK1:<index>/<total>:<text>" of at most size characters
+func chunkTransfer(text string, size int) ([]string, error) {
+	// The header grows with the number of chunks, so find a count whose headers leave enough room
+	for digits := 1; ; digits++ {
+		room := size - len(transferPrefix) - 2*digits - 2
+		if room <= 0 {
+			return nil, fmt.Errorf("chunkSize %d leaves no room for data", size)
+		}
+		parts := (len(text) + room - 1) / room
+		if len(strconv.Itoa(parts)) > digits {
+			continue
+		}
+		if parts > maxTransferChunks {
+			return nil, fmt.Errorf("the envelope needs %d chunks of %d characters, at most %d are allowed", parts, size, maxTransferChunks)
+		}
+		chunks := make([]string, parts)
+		for i := range chunks {
+			chunks[i] = fmt.Sprintf("%s%d/%d:%s", transferPrefix, i+1, parts, text[i*room:min(len(text), (i+1)*room)])
+		}
+		return chunks, nil
+	}
+}
+
+// joinTransfer reassembles chunks scanned in any order into base45 text
+func joinTransfer(chunks []string) (string, error) {
+	if len(chunks) == 0 || len(chunks) > maxTransferChunks {
+		return "", fmt.Errorf("expected 1 to %d chunks", maxTransferChunks)
+	}
+	parts := make([]string, len(chunks))
+	for _, chunk := range chunks {
+		rest, ok := strings.CutPrefix(chunk, transferPrefix) // spaces are base45 digits, so chunks are not trimmed
+		if !ok {
+			return "", fmt.Errorf("chunk does not start with %s", transferPrefix)
+		}
+		header, text, ok := strings.Cut(rest, ":")
+		index, total, ok2 := strings.Cut(header, "/")
+		i, err := strconv.Atoi(index)
+		n, err2 := strconv.Atoi(total)
+		if !ok || !ok2 || err != nil || err2 != nil {
+			return "", errors.New("chunk header must be <index>/<total>")
+		}
+		if n != len(chunks) {
+			return "", fmt.Errorf("chunk %d belongs to a transfer of %d chunks, got %d", i, n, len(chunks))
+		}
+		if i < 1 || i > n || parts[i-1] != "" {
+			return "", fmt.Errorf("chunk %d is out of range or repeated", i)
+		}
+		if text == "" {
+			return "", fmt.Errorf("chunk %d is empty", i)
+		}
+		parts[i-1] = text
+	}
+	return strings.Join(parts, ""), nil
+}
+
+// encodeTransferProof encodes a proof envelope for QR presentation. ?chunkSize= bounds the
+// characters per chunk; without it, the whole envelope is one chunk.
+func encodeTransferProof(w http.ResponseWriter, r *http.Request) {
+	size, err := queryInt(r, "chunkSize")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if size == 0 {
+		size = maxTransferChunk
+	}
+	if size < minTransferChunk || size > maxTransferChunk {
+		writeError(w, errs.Errorf(errs.Invalid, "chunkSize must be between %d and %d", minTransferChunk, maxTransferChunk))
+		return
+	}
+	var m ProofEnvelope
+	if err := decodeJSON(w, r, &m); err != nil {
+		writeError(w, err)
+		return
+	}
+	if m.Circuit == "" {
+		writeError(w, errs.Errorf(errs.Invalid, "circuit is required"))
+		return
+	}
+
+	data, err := encodeTransfer(m)
+	if err != nil {
+		writeError(w, errs.Wrap(errs.Invalid, err))
+		return
+	}
+	chunks, err := chunkTransfer(base45Encode(data), size)
+	if err != nil {
+		writeError(w, errs.Wrap(errs.Invalid, err))
+		return
+	}
+	resp := TransferEncoding{Chunks: chunks}
+	for _, c := range chunks {
+		resp.Size += len(c)
+	}
+	writeJSON(w, resp)
+}
+
+// decodeTransferProof turns scanned chunks back into a proof envelope, ready for /validate/bundle
+func decodeTransferProof(w http.ResponseWriter, r *http.Request) {
+	var req TransferDecodeRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	text, err := joinTransfer(req.Chunks)
+	if err != nil {
+		writeError(w, fmt.Errorf("%w: %v", errTransferMalformed, err))
+		return
+	}
+	data, err := base45Decode(text)
+	if err != nil {
+		writeError(w, fmt.Errorf("%w: %v", errTransferMalformed, err))
+		return
+	}
+	m, err := decodeTransfer(data)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, m)
+}
+
+// base45Alphabet is the RFC 9285 alphabet, which QR codes encode compactly in alphanumeric mode
+const base45Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
+
+// base45Encode encodes data as in RFC 9285: two bytes become three characters
+func base45Encode(data []byte) string {
+	var b strings.Builder
+	b.Grow((len(data)*3 + 1) / 2)
+	for i := 0; i+1 < len(data); i += 2 {
+		n := int(data[i])<<8 | int(data[i+1])
+		b.WriteByte(base45Alphabet[n%45])
+		b.WriteByte(base45Alphabet[n/45%45])
+		b.WriteByte(base45Alphabet[n/2025])
+	}
+	if len(data)%2 == 1 {
+		n := int(data[len(data)-1])
+		b.WriteByte(base45Alphabet[n%45])
+		b.WriteByte(base45Alphabet[n/45])
+	}
+	return b.String()
+}
+
+// base45Decode reverses base45Encode, rejecting characters outside the alphabet and values that overflow
+func base45Decode(text string) ([]byte, error) {
+	if len(text)%3 == 1 {
+		return nil, errors.New("invalid base45 length")
+	}
+	digits := make([]int, len(text))
+	for i := range len(text) {
+		d := strings.IndexByte(base45Alphabet, text[i])
+		if d < 0 {
+			return nil, fmt.Errorf("invalid base45 character %q", text[i])
+		}
+		digits[i] = d
+	}
+	out := make([]byte, 0, len(text)*2/3)
+	for i := 0; i < len(digits); i += 3 {
+		if i+2 < len(digits) {
+			n := digits[i] + digits[i+1]*45 + digits[i+2]*2025
+			if n > 0xffff {
+				return nil, errors.New("invalid base45 triplet")
+			}
+			out = append(out, byte(n>>8), byte(n))
+			continue
+		}
+		n := digits[i] + digits[i+1]*45
+		if n > 0xff {
+			return nil, errors.New("invalid base45 pair")
+		}
+		out = append(out, byte(n))
+	}
+	return out, nil
+}
+
+// CBOR major types used by the transfer format (RFC 8949)
+const (
+	cborUint  = 0
+	cborBytes = 2
+	cborText  = 3
+	cborMap   = 5
+)
+
+// cborWriter writes the definite-length subset of CBOR the transfer format needs
+type cborWriter struct {
+	bytes.Buffer
+}
+
+func (w *cborWriter) head(major byte, n uint64) {
+	switch {
+	case n < 24:
+		w.WriteByte(major<<5 | byte(n))
+	case n <= 0xff:
+		w.WriteByte(major<<5 | 24)
+		w.WriteByte(byte(n))
+	case n <= 0xffff:
+		w.WriteByte(major<<5 | 25)
+		w.Write([]byte{byte(n >> 8), byte(n)})
+	case n <= 0xffffffff:
+		w.WriteByte(major<<5 | 26)
+		w.Write([]byte{byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)})
+	default:
+		w.WriteByte(major<<5 | 27)
+		for shift := 56; shift >= 0; shift -= 8 {
+			w.WriteByte(byte(n >> shift))
+		}
+	}
+}
+
+func (w *cborWriter) uint(n uint64) { w.head(cborUint, n) }
+
+func (w *cborWriter) text(s string) {
+	w.head(cborText, uint64(len(s)))
+	w.WriteString(s)
+}
+
+func (w *cborWriter) bytes(b []byte) {
+	w.head(cborBytes, uint64(len(b)))
+	w.Write(b)
+}
+
+// cborReader reads what cborWriter writes; indefinite lengths and other major types are rejected
+type cborReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *cborReader) expect(major byte) (uint64, error) {
+	if r.pos >= len(r.data) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	b := r.data[r.pos]
+	r.pos++
+	if b>>5 != major {
+		return 0, fmt.Errorf("expected CBOR major type %d, got %d", major, b>>5)
+	}
+	info := b & 0x1f
+	if info < 24 {
+		return uint64(info), nil
+	}
+	if info > 27 {
+		return 0, errors.New("indefinite or reserved CBOR length")
+	}
+	size := 1 << (info - 24)
+	if r.pos+size > len(r.data) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	var n uint64
+	for _, c := range r.data[r.pos : r.pos+size] {
+		n = n<<8 | uint64(c)
+	}
+	r.pos += size
+	return n, nil
+}
+
+func (r *cborReader) payload(major byte) ([]byte, error) {
+	n, err := r.expect(major)
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(r.data)-r.pos) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := r.data[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
+
+func (r *cborReader) text() (string, error) {
+	b, err := r.payload(cborText)
+	return string(b), err
+}
+
+func (r *cborReader) bytes() ([]byte, error) {
+	b, err := r.payload(cborBytes)
+	return slices.Clone(b), err
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/korjavin/zkTest1/circuits"
+)
+
+func TestBase45(t *testing.T) {
+	// Test vectors from RFC 9285
+	tests := []struct {
+		data, text string
+	}{
+		{"AB", "BB8"},
+		{"Hello!!", "%69 VD92EX0"},
+		{"base-45", "UJCLQE7W581"},
+		{"ietf!", "QED8WEX0"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := base45Encode([]byte(tt.data)); got != tt.text {
+				t.Errorf("base45Encode(%q) = %q, want %q", tt.data, got, tt.text)
+			}
+			got, err := base45Decode(tt.text)
+			if err != nil || string(got) != tt.data {
+				t.Errorf("base45Decode(%q) = %q, %v", tt.text, got, err)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"GGW", "A", "ab", "BB8A"} {
+		if _, err := base45Decode(invalid); err == nil {
+			t.Errorf("Expected base45Decode(%q) to fail", invalid)
+		}
+	}
+}
+
+func TestChunkTransfer(t *testing.T) {
+	text := strings.Repeat("0123456789ABCDEF:/ ", 100)
+	for _, size := range []int{64, 100, 500, 4000} {
+		chunks, err := chunkTransfer(text, size)
+		if err != nil {
+			t.Fatalf("chunkTransfer(%d): %v", size, err)
+		}
+		for _, c := range chunks {
+			if len(c) > size {
+				t.Errorf("Chunk of %d characters exceeds %d", len(c), size)
+			}
+		}
+		slices.Reverse(chunks)
+		if joined, err := joinTransfer(chunks); err != nil || joined != text {
+			t.Errorf("Expected chunks of %d to join in any order, got %v", size, err)
+		}
+	}
+
+	if _, err := chunkTransfer(strings.Repeat("A", 10000), 64); err == nil {
+		t.Error("Expected too many chunks to be refused")
+	}
+}
+
+func TestJoinTransferRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+	}{
+		{"No chunks", nil},
+		{"Other prefix", []string{"HC1:1/1:ABC"}},
+		{"Missing header", []string{"ZK1:ABC"}},
+		{"Missing chunk", []string{"ZK1:1/2:ABC"}},
+		{"Repeated chunk", []string{"ZK1:1/2:ABC", "ZK1:1/2:DEF"}},
+		{"Out of range", []string{"ZK1:0/1:ABC"}},
+		{"Empty chunk", []string{"ZK1:1/1:"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := joinTransfer(tt.chunks); err == nil {
+				t.Error("Expected chunks to be rejected")
+			}
+		})
+	}
+}
+
+func TestTransferRoundTrip(t *testing.T) {
+	setup, err := loadSetup(balanceCircuitName, &circuits.BalanceCircuit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := setup.prove(context.Background(), &circuits.BalanceCircuit{Balance: 150, NeededAmount: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proofJSON, _ := json.Marshal(proof)
+	envelope := ProofEnvelope{Circuit: balanceCircuitName, Inputs: json.RawMessage(`{ "neededAmount": 100 }`), Proof: proofJSON}
+	body, _ := json.Marshal(envelope)
+
+	req := httptest.NewRequest("POST", "/transfer/encode?chunkSize=200", bytes.NewReader(body))
+	rr := httptest.NewRecorder()
+	encodeTransferProof(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var encoded TransferEncoding
+	if err := json.Unmarshal(rr.Body.Bytes(), &encoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(encoded.Chunks) < 2 || encoded.Size >= len(body) {
+		t.Errorf("Expected several chunks, smaller than the %d byte envelope, got %d in %d characters", len(body), len(encoded.Chunks), encoded.Size)
+	}
+	for _, c := range encoded.Chunks {
+		if strings.Trim(c, base45Alphabet) != "" {
+			t.Errorf("Expected chunks in the QR alphanumeric alphabet, got %q", c)
+		}
+	}
+
+	slices.Reverse(encoded.Chunks)
+	body, _ = json.Marshal(TransferDecodeRequest{Chunks: encoded.Chunks})
+	rr = httptest.NewRecorder()
+	decodeTransferProof(rr, httptest.NewRequest("POST", "/transfer/decode", bytes.NewReader(body)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var decoded ProofEnvelope
+	if err := json.Unmarshal(rr.Body.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Circuit != balanceCircuitName || string(decoded.Inputs) != `{"neededAmount":100}` || decoded.Backend != proofBackend {
+		t.Errorf("Unexpected envelope %+v", decoded)
+	}
+	decodedProof, err := decodeProof(defaultCurve, decoded.GnarkVersion, decoded.Proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := setup.verify(context.Background(), decodedProof, &circuits.BalanceCircuit{NeededAmount: 100}); err != nil {
+		t.Errorf("Expected the decoded proof to verify, got %v", err)
+	}
+}
+
+func TestTransferRefused(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		target  string
+		body    string
+	}{
+		{"Chunk size too small", encodeTransferProof, "/transfer/encode?chunkSize=10", `{"circuit": "balance", "proof": {}}`},
+		{"Missing circuit", encodeTransferProof, "/transfer/encode", `{"proof": {}}`},
+		{"Malformed proof", encodeTransferProof, "/transfer/encode", `{"circuit": "balance", "proof": {"Ar": 1}}`},
+		{"Other backend", encodeTransferProof, "/transfer/encode", `{"circuit": "balance", "proof": {}, "backend": "plonk"}`},
+		{"Not base45", decodeTransferProof, "/transfer/decode", `{"chunks": ["ZK1:1/1:abc"]}`},
+		{"Not compressed", decodeTransferProof, "/transfer/decode", `{"chunks": ["ZK1:1/1:BB8"]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			tt.handler(rr, httptest.NewRequest("POST", tt.target, strings.NewReader(tt.body)))
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("Expected 400, got %d: %s", rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
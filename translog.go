@@ -0,0 +1,264 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/bits"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// transparencyLog is an append-only Merkle tree over the digests of issued proofs, hashed as in
+// RFC 9162 so auditors can check inclusion and consistency with standard tooling
+type transparencyLog struct {
+	mu     sync.RWMutex
+	leaves [][sha256.Size]byte // leaf hashes in order of issuance
+	index  map[string]int      // leaf index by proof digest
+}
+
+var proofLog = newTransparencyLog()
+
+func newTransparencyLog() *transparencyLog {
+	return &transparencyLog{index: make(map[string]int)}
+}
+
+var errLogEntryNotFound = errs.New(errs.NotFound, "log_entry_not_found", "proof is not in the log at this tree size")
+
+func leafHash(data []byte) [sha256.Size]byte {
+	return sha256.Sum256(append([]byte{0}, data...))
+}
+
+func nodeHash(left, right [sha256.Size]byte) [sha256.Size]byte {
+	buf := make([]byte, 0, 1+2*sha256.Size)
+	buf = append(append(append(buf, 1), left[:]...), right[:]...)
+	return sha256.Sum256(buf)
+}
+
+// append adds the digest of a newly issued proof; the leaf is the digest's raw bytes
+func (l *transparencyLog) append(digest string) {
+	raw, err := hex.DecodeString(digest)
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.index[digest]; ok {
+		return
+	}
+	l.index[digest] = len(l.leaves)
+	l.leaves = append(l.leaves, leafHash(raw))
+}
+
+// tombstone re-keys the entry of an erased proof by its tombstone. The leaf is kept, so tree heads
+// stay consistent, but the digest of the proof no longer finds it.
+func (l *transparencyLog) tombstone(digest, tombstone string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if i, ok := l.index[digest]; ok {
+		delete(l.index, digest)
+		l.index[tombstone] = i
+	}
+}
+
+// splitPoint is the largest power of two smaller than n, for n > 1
+func splitPoint(n int) int {
+	return 1 << (bits.Len(uint(n-1)) - 1)
+}
+
+// rootOf is MTH over leaves
+func rootOf(leaves [][sha256.Size]byte) [sha256.Size]byte {
+	switch len(leaves) {
+	case 0:
+		return sha256.Sum256(nil)
+	case 1:
+		return leaves[0]
+	}
+	k := splitPoint(len(leaves))
+	return nodeHash(rootOf(leaves[:k]), rootOf(leaves[k:]))
+}
+
+// inclusionPath is PATH(m, leaves) of RFC 9162 2.1.3.1
+func inclusionPath(m int, leaves [][sha256.Size]byte) [][sha256.Size]byte {
+	if len(leaves) <= 1 {
+		return nil
+	}
+	k := splitPoint(len(leaves))
+	if m < k {
+		return append(inclusionPath(m, leaves[:k]), rootOf(leaves[k:]))
+	}
+	return append(inclusionPath(m-k, leaves[k:]), rootOf(leaves[:k]))
+}
+
+// consistencyPath is SUBPROOF(m, leaves, complete) of RFC 9162 2.1.4.1
+func consistencyPath(m int, leaves [][sha256.Size]byte, complete bool) [][sha256.Size]byte {
+	n := len(leaves)
+	if m == n {
+		if complete {
+			return nil
+		}
+		return [][sha256.Size]byte{rootOf(leaves)}
+	}
+	k := splitPoint(n)
+	if m <= k {
+		return append(consistencyPath(m, leaves[:k], complete), rootOf(leaves[k:]))
+	}
+	return append(consistencyPath(m-k, leaves[k:], false), rootOf(leaves[:k]))
+}
+
+func hexHashes(hashes [][sha256.Size]byte) []string {
+	out := make([]string, len(hashes))
+	for i := range hashes {
+		out[i] = hex.EncodeToString(hashes[i][:])
+	}
+	return out
+}
+
+// TreeHead is the state of the log at one size, signed by the server when it can sign
+type TreeHead struct {
+	TreeSize  int       `json:"treeSize"`
+	RootHash  string    `json:"rootHash"` // hex
+	Timestamp time.Time `json:"timestamp"`
+	Issuer    string    `json:"issuer,omitempty"` // DID of the server; kid names its key
+	KeyID     string    `json:"kid,omitempty"`
+	Signature []byte    `json:"signature,omitempty"` // ES256 over the tree head without kid and signature
+}
+
+func (l *transparencyLog) treeHead(now time.Time) (TreeHead, error) {
+	l.mu.RLock()
+	head := TreeHead{TreeSize: len(l.leaves), Timestamp: now.UTC()}
+	root := rootOf(l.leaves)
+	l.mu.RUnlock()
+	head.RootHash = hex.EncodeToString(root[:])
+
+	if signer == nil {
+		return head, nil
+	}
+	head.Issuer = issuerDID
+	payload, err := json.Marshal(head)
+	if err != nil {
+		return TreeHead{}, err
+	}
+	if head.Signature, err = signMessage(signer, payload); err != nil {
+		return TreeHead{}, err
+	}
+	head.KeyID = signer.KeyID()
+	return head, nil
+}
+
+// InclusionProof shows that a proof's digest is the leaf at LeafIndex of the tree of TreeSize
+type InclusionProof struct {
+	Digest    string   `json:"digest"`
+	LeafIndex int      `json:"leafIndex"`
+	LeafHash  string   `json:"leafHash"` // hex; lets the path of an erased proof's tombstone be checked
+	TreeSize  int      `json:"treeSize"`
+	AuditPath []string `json:"auditPath"`
+}
+
+func (l *transparencyLog) inclusion(digest string, treeSize int) (InclusionProof, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if treeSize == 0 {
+		treeSize = len(l.leaves)
+	}
+	if treeSize < 0 || treeSize > len(l.leaves) {
+		return InclusionProof{}, errs.Errorf(errs.Invalid, "treeSize must be at most %d", len(l.leaves))
+	}
+	index, ok := l.index[digest]
+	if !ok || index >= treeSize {
+		return InclusionProof{}, errLogEntryNotFound
+	}
+	return InclusionProof{
+		Digest:    digest,
+		LeafIndex: index,
+		LeafHash:  hex.EncodeToString(l.leaves[index][:]),
+		TreeSize:  treeSize,
+		AuditPath: hexHashes(inclusionPath(index, l.leaves[:treeSize])),
+	}, nil
+}
+
+// ConsistencyProof shows that the tree of size First is a prefix of the tree of size Second
+type ConsistencyProof struct {
+	First  int      `json:"first"`
+	Second int      `json:"second"`
+	Proof  []string `json:"proof"`
+}
+
+func (l *transparencyLog) consistency(first, second int) (ConsistencyProof, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if second == 0 {
+		second = len(l.leaves)
+	}
+	if first < 1 || first > second || second > len(l.leaves) {
+		return ConsistencyProof{}, errs.Errorf(errs.Invalid, "need 0 < first <= second <= %d", len(l.leaves))
+	}
+	return ConsistencyProof{First: first, Second: second, Proof: hexHashes(consistencyPath(first, l.leaves[:second], true))}, nil
+}
+
+// queryInt reads an optional non-negative integer query parameter, 0 when absent
+func queryInt(r *http.Request, name string) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, errs.Errorf(errs.Invalid, "%s must be a non-negative integer", name)
+	}
+	return n, nil
+}
+
+// getTreeHead publishes the current, signed tree head of the proof log
+func getTreeHead(w http.ResponseWriter, r *http.Request) {
+	head, err := proofLog.treeHead(time.Now())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, head)
+}
+
+// getInclusionProof proves that an issued proof is in the log, at the current size unless
+// ?treeSize= names an earlier tree head
+func getInclusionProof(w http.ResponseWriter, r *http.Request) {
+	treeSize, err := queryInt(r, "treeSize")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	proof, err := proofLog.inclusion(r.PathValue("digest"), treeSize)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, proof)
+}
+
+// getConsistencyProof proves that the log at ?first= is a prefix of the log at ?second=,
+// the current size when omitted, so no entry was removed or rewritten in between
+func getConsistencyProof(w http.ResponseWriter, r *http.Request) {
+	first, err := queryInt(r, "first")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	second, err := queryInt(r, "second")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	proof, err := proofLog.consistency(first, second)
+	if err != nil {
+		writeError(w, fmt.Errorf("consistency proof: %w", err))
+		return
+	}
+	writeJSON(w, proof)
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func decodeHashes(t *testing.T, hexes []string) [][sha256.Size]byte {
+	t.Helper()
+	out := make([][sha256.Size]byte, len(hexes))
+	for i, h := range hexes {
+		b, err := hex.DecodeString(h)
+		if err != nil || len(b) != sha256.Size {
+			t.Fatalf("Malformed hash %q", h)
+		}
+		copy(out[i][:], b)
+	}
+	return out
+}
+
+// verifyInclusion follows RFC 9162 2.1.3.2
+func verifyInclusion(leaf [sha256.Size]byte, index, size int, path [][sha256.Size]byte, root [sha256.Size]byte) bool {
+	if index >= size {
+		return false
+	}
+	fn, sn, r := index, size-1, leaf
+	for _, p := range path {
+		if sn == 0 {
+			return false
+		}
+		if fn&1 == 1 || fn == sn {
+			r = nodeHash(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = nodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	return sn == 0 && r == root
+}
+
+// verifyConsistency follows RFC 9162 2.1.4.2
+func verifyConsistency(first, second int, firstRoot, secondRoot [sha256.Size]byte, path [][sha256.Size]byte) bool {
+	if first == second {
+		return len(path) == 0 && firstRoot == secondRoot
+	}
+	if first&(first-1) == 0 {
+		path = append([][sha256.Size]byte{firstRoot}, path...)
+	}
+	if len(path) == 0 {
+		return false
+	}
+	fn, sn := first-1, second-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+	fr, sr := path[0], path[0]
+	for _, c := range path[1:] {
+		if sn == 0 {
+			return false
+		}
+		if fn&1 == 1 || fn == sn {
+			fr = nodeHash(c, fr)
+			sr = nodeHash(c, sr)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			sr = nodeHash(sr, c)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	return fr == firstRoot && sr == secondRoot && sn == 0
+}
+
+func testDigest(i int) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("proof %d", i)))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestTransparencyLogProofs(t *testing.T) {
+	l := newTransparencyLog()
+	roots := make([][sha256.Size]byte, 0, 13)
+	for i := 0; i < 13; i++ {
+		l.append(testDigest(i))
+		roots = append(roots, rootOf(l.leaves))
+	}
+	l.append(testDigest(3)) // already logged
+	if len(l.leaves) != 13 {
+		t.Fatalf("Expected a repeated digest to be logged once, got %d leaves", len(l.leaves))
+	}
+
+	for size := 1; size <= 13; size++ {
+		for i := 0; i < size; i++ {
+			proof, err := l.inclusion(testDigest(i), size)
+			if err != nil {
+				t.Fatalf("inclusion(%d, %d): %v", i, size, err)
+			}
+			raw, _ := hex.DecodeString(testDigest(i))
+			if !verifyInclusion(leafHash(raw), proof.LeafIndex, size, decodeHashes(t, proof.AuditPath), roots[size-1]) {
+				t.Errorf("Inclusion proof of leaf %d in tree %d does not verify", i, size)
+			}
+		}
+		for first := 1; first <= size; first++ {
+			proof, err := l.consistency(first, size)
+			if err != nil {
+				t.Fatalf("consistency(%d, %d): %v", first, size, err)
+			}
+			if !verifyConsistency(first, size, roots[first-1], roots[size-1], decodeHashes(t, proof.Proof)) {
+				t.Errorf("Consistency proof from %d to %d does not verify", first, size)
+			}
+		}
+	}
+
+	// A rewritten leaf breaks consistency with the earlier head
+	proof, _ := l.consistency(5, 13)
+	forged := newTransparencyLog()
+	for i := 0; i < 13; i++ {
+		if i == 2 {
+			forged.append(testDigest(100))
+			continue
+		}
+		forged.append(testDigest(i))
+	}
+	if verifyConsistency(5, 13, roots[4], rootOf(forged.leaves), decodeHashes(t, proof.Proof)) {
+		t.Error("Expected a rewritten log to fail the consistency check")
+	}
+}
+
+func TestTransparencyLogErrors(t *testing.T) {
+	l := newTransparencyLog()
+	for i := 0; i < 4; i++ {
+		l.append(testDigest(i))
+	}
+	tests := []struct {
+		name  string
+		check func() error
+	}{
+		{"Unknown digest", func() error { _, err := l.inclusion(testDigest(9), 0); return err }},
+		{"Leaf after tree size", func() error { _, err := l.inclusion(testDigest(3), 2); return err }},
+		{"Tree size too large", func() error { _, err := l.inclusion(testDigest(0), 5); return err }},
+		{"Empty first tree", func() error { _, err := l.consistency(0, 4); return err }},
+		{"First after second", func() error { _, err := l.consistency(3, 2); return err }},
+		{"Second too large", func() error { _, err := l.consistency(1, 9); return err }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.check(); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestTransparencyLogEndpoints(t *testing.T) {
+	saved := proofLog
+	proofLog = newTransparencyLog()
+	t.Cleanup(func() { proofLog = saved })
+	for i := 0; i < 5; i++ {
+		proofLog.append(testDigest(i))
+	}
+
+	rr := httptest.NewRecorder()
+	getTreeHead(rr, httptest.NewRequest("GET", "/log/tree-head", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for the tree head, got %d", rr.Code)
+	}
+	var head TreeHead
+	if err := json.Unmarshal(rr.Body.Bytes(), &head); err != nil {
+		t.Fatalf("Failed to decode tree head: %v", err)
+	}
+	if head.TreeSize != 5 || head.Timestamp.After(time.Now()) {
+		t.Errorf("Unexpected tree head %+v", head)
+	}
+	root := decodeHashes(t, []string{head.RootHash})[0]
+
+	req := httptest.NewRequest("GET", "/log/inclusion/"+testDigest(3), nil)
+	req.SetPathValue("digest", testDigest(3))
+	rr = httptest.NewRecorder()
+	getInclusionProof(rr, req)
+	var inclusion InclusionProof
+	if err := json.Unmarshal(rr.Body.Bytes(), &inclusion); err != nil {
+		t.Fatalf("Failed to decode inclusion proof: %v", err)
+	}
+	raw, _ := hex.DecodeString(testDigest(3))
+	if !verifyInclusion(leafHash(raw), inclusion.LeafIndex, inclusion.TreeSize, decodeHashes(t, inclusion.AuditPath), root) {
+		t.Error("Inclusion proof does not verify against the published tree head")
+	}
+
+	tests := []struct {
+		name   string
+		url    string
+		digest string
+		status int
+	}{
+		{"Unknown digest", "/log/inclusion/", testDigest(7), http.StatusNotFound},
+		{"Bad tree size", "/log/inclusion/?treeSize=x", testDigest(1), http.StatusBadRequest},
+		{"Consistency", "/log/consistency?first=2", "", http.StatusOK},
+		{"Consistency without first", "/log/consistency", "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.url, nil)
+			rr := httptest.NewRecorder()
+			if tt.digest != "" {
+				req.SetPathValue("digest", tt.digest)
+				getInclusionProof(rr, req)
+			} else {
+				getConsistencyProof(rr, req)
+			}
+			if rr.Code != tt.status {
+				t.Errorf("Expected %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,281 @@
+// Package verifier verifies proof envelopes issued by the server without calling it, for relying
+// parties that embed verification in their own Go services. It depends only on gnark and the
+// shared circuit definitions: verifying keys are pinned by the caller, for example from
+// GET /keys/verifying/{name} of a server it trusts, and envelopes are parsed from the JSON the
+// server issues and accepts in bundles.
+//
+// Envelope signatures are not checked; trust comes from the pinned keys.
+package verifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/blang/semver/v4"
+	"github.com/consensys/gnark"
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/frontend"
+	"github.com/korjavin/zkTest1/circuits"
+)
+
+var (
+	// ErrInvalidProof is returned when a proof does not verify against its public inputs
+	ErrInvalidProof = errors.New("invalid proof")
+	// ErrUnknownKey is returned for envelopes of a circuit and curve without a pinned key
+	ErrUnknownKey = errors.New("no verifying key for circuit")
+	// ErrWitnessMismatch is returned when the public witness of an envelope disagrees with its inputs
+	ErrWitnessMismatch = errors.New("public witness does not match the inputs")
+	// ErrNotYetValid is returned for time-locked proofs before their notBefore time
+	ErrNotYetValid = errors.New("proof is not valid yet")
+)
+
+// Envelope is one proof with what it proves, as issued by the server and carried in bundles
+type Envelope struct {
+	Circuit       string          `json:"circuit"`
+	Inputs        json.RawMessage `json:"inputs"`
+	Proof         json.RawMessage `json:"proof"`
+	GnarkVersion  string          `json:"gnarkVersion,omitempty"`  // release the proof was serialized with
+	PublicWitness []byte          `json:"publicWitness,omitempty"` // gnark binary encoding
+	Curve         string          `json:"curve,omitempty"`         // bn254 when empty
+	Backend       string          `json:"backend,omitempty"`       // groth16 when empty
+	Issuer        string          `json:"issuer,omitempty"`
+	KeyID         string          `json:"kid,omitempty"`
+	Signature     []byte          `json:"signature,omitempty"`
+}
+
+// ParseEnvelope decodes an envelope from its JSON encoding
+func ParseEnvelope(data []byte) (Envelope, error) {
+	var e Envelope
+	if err := json.Unmarshal(data, &e); err != nil {
+		return Envelope{}, fmt.Errorf("envelope: %w", err)
+	}
+	if e.Circuit == "" || len(e.Proof) == 0 {
+		return Envelope{}, errors.New("envelope: circuit and proof are required")
+	}
+	return e, nil
+}
+
+// Result describes a verified envelope
+type Result struct {
+	Circuit string
+	Curve   ecc.ID
+	// InputsChecked is true when the proof was verified against the envelope's inputs. Proofs of
+	// other circuits are verified against their public witness alone, which the caller interprets.
+	InputsChecked bool
+	PublicWitness witness.Witness
+}
+
+// Verifier verifies envelopes with pinned verifying keys. It is safe for concurrent use.
+type Verifier struct {
+	// Now is the clock time-locked proofs are checked against; time.Now when nil
+	Now func() time.Time
+
+	mu   sync.RWMutex
+	keys map[keyName]groth16.VerifyingKey
+}
+
+type keyName struct {
+	circuit string
+	curve   ecc.ID
+}
+
+// New returns a verifier without pinned keys
+func New() *Verifier {
+	return &Verifier{keys: make(map[keyName]groth16.VerifyingKey)}
+}
+
+// AddKey pins the verifying key of a circuit on a curve
+func (v *Verifier) AddKey(circuit string, curve ecc.ID, vk groth16.VerifyingKey) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.keys[keyName{circuit, curve}] = vk
+}
+
+// AddKeyBytes pins a verifying key in gnark's binary encoding, as served by GET /keys/verifying/{name}
+func (v *Verifier) AddKeyBytes(circuit string, curve ecc.ID, data []byte) error {
+	vk := groth16.NewVerifyingKey(curve)
+	if _, err := vk.ReadFrom(bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("verifying key of %s: %w", circuit, err)
+	}
+	v.AddKey(circuit, curve, vk)
+	return nil
+}
+
+func (v *Verifier) key(circuit string, curve ecc.ID) (groth16.VerifyingKey, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	vk, ok := v.keys[keyName{circuit, curve}]
+	if !ok {
+		return nil, fmt.Errorf("%w %s on %s", ErrUnknownKey, circuit, curve)
+	}
+	return vk, nil
+}
+
+// Verify checks an envelope. Circuits whose inputs the package knows are verified against their
+// inputs, and a public witness the envelope also carries must encode the same inputs. Other
+// circuits need a public witness.
+func (v *Verifier) Verify(e Envelope) (*Result, error) {
+	if e.Backend != "" && e.Backend != "groth16" {
+		return nil, fmt.Errorf("unsupported backend %q", e.Backend)
+	}
+	curve := ecc.BN254
+	if e.Curve != "" {
+		var err error
+		if curve, err = ecc.IDFromString(e.Curve); err != nil {
+			return nil, fmt.Errorf("unsupported curve %q", e.Curve)
+		}
+	}
+	vk, err := v.key(e.Circuit, curve)
+	if err != nil {
+		return nil, err
+	}
+	proof, err := decodeProof(curve, e.GnarkVersion, e.Proof)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now
+	if v.Now != nil {
+		now = v.Now
+	}
+	assignment, err := inputsAssignment(e.Circuit, e.Inputs, now())
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Circuit: e.Circuit, Curve: curve, InputsChecked: assignment != nil}
+	var given witness.Witness
+	if len(e.PublicWitness) > 0 {
+		if given, err = witness.New(curve.ScalarField()); err != nil {
+			return nil, err
+		}
+		if err := given.UnmarshalBinary(e.PublicWitness); err != nil {
+			return nil, fmt.Errorf("public witness: %w", err)
+		}
+	}
+	switch {
+	case assignment != nil:
+		want, err := frontend.NewWitness(assignment, curve.ScalarField(), frontend.PublicOnly())
+		if err != nil {
+			return nil, fmt.Errorf("inputs: %w", err)
+		}
+		if given != nil && !sameWitness(given, want) {
+			return nil, ErrWitnessMismatch
+		}
+		result.PublicWitness = want
+	case given != nil:
+		result.PublicWitness = given
+	default:
+		return nil, fmt.Errorf("circuit %s needs a public witness", e.Circuit)
+	}
+
+	if err := groth16.Verify(proof, vk, result.PublicWitness); err != nil {
+		return nil, ErrInvalidProof
+	}
+	return result, nil
+}
+
+// sameWitness compares two witnesses by encoding, which is normalized
+func sameWitness(a, b witness.Witness) bool {
+	da, errA := a.MarshalBinary()
+	db, errB := b.MarshalBinary()
+	return errA == nil && errB == nil && bytes.Equal(da, db)
+}
+
+// decodeProof parses a proof serialized by a gnark release with the same encoding as this one.
+// Proofs from older releases are converted by the server when validated there.
+func decodeProof(curve ecc.ID, version string, data []byte) (groth16.Proof, error) {
+	if version != "" {
+		v, err := semver.ParseTolerant(version)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gnark version %q", version)
+		}
+		if v.Major != gnark.Version.Major || v.Minor != gnark.Version.Minor {
+			return nil, fmt.Errorf("proofs from gnark %s are not supported, only %d.%d.x", v, gnark.Version.Major, gnark.Version.Minor)
+		}
+	}
+	proof := groth16.NewProof(curve)
+	if err := json.Unmarshal(data, proof); err != nil {
+		return nil, fmt.Errorf("malformed proof: %w", err)
+	}
+	return proof, nil
+}
+
+// unboundedUpper is the exclusive upper bound the server proves for the topmost bucket
+var unboundedUpper = uint64(math.MaxInt64) + 1
+
+// inputsAssignment returns the public assignment of the envelope inputs of a circuit the
+// package knows, nil for other circuits
+func inputsAssignment(circuit string, data json.RawMessage, now time.Time) (frontend.Circuit, error) {
+	decode := func(v any) error {
+		d := json.NewDecoder(bytes.NewReader(data))
+		d.DisallowUnknownFields()
+		if err := d.Decode(v); err != nil {
+			return fmt.Errorf("inputs of %s: %w", circuit, err)
+		}
+		return nil
+	}
+
+	switch circuit {
+	case circuits.BalanceName, circuits.StrictName:
+		var in struct {
+			NeededAmount int64 `json:"neededAmount"`
+		}
+		if err := decode(&in); err != nil {
+			return nil, err
+		}
+		if circuit == circuits.StrictName {
+			return &circuits.StrictBalanceCircuit{NeededAmount: in.NeededAmount}, nil
+		}
+		return &circuits.BalanceCircuit{NeededAmount: in.NeededAmount}, nil
+
+	case circuits.CommittedName:
+		var in struct {
+			Commitment string `json:"commitment"`
+		}
+		if err := decode(&in); err != nil {
+			return nil, err
+		}
+		commitment, ok := new(big.Int).SetString(in.Commitment, 10)
+		if !ok || commitment.Sign() < 0 {
+			return nil, fmt.Errorf("inputs of %s: invalid commitment", circuit)
+		}
+		return &circuits.CommittedBalanceCircuit{Commitment: commitment}, nil
+
+	case circuits.BucketName:
+		var in struct {
+			Lower int64  `json:"lower"`
+			Upper *int64 `json:"upper"`
+		}
+		if err := decode(&in); err != nil {
+			return nil, err
+		}
+		var upper any = unboundedUpper
+		if in.Upper != nil {
+			upper = *in.Upper
+		}
+		return &circuits.BucketCircuit{Lower: in.Lower, Upper: upper}, nil
+
+	case circuits.TimeLockName:
+		var in struct {
+			NeededAmount int64     `json:"neededAmount"`
+			NotBefore    time.Time `json:"notBefore"`
+		}
+		if err := decode(&in); err != nil {
+			return nil, err
+		}
+		if now.Before(in.NotBefore) {
+			return nil, fmt.Errorf("%w: valid from %s", ErrNotYetValid, in.NotBefore.UTC().Format(time.RFC3339))
+		}
+		return &circuits.TimeLockedBalanceCircuit{NeededAmount: in.NeededAmount, NotBefore: in.NotBefore.Unix()}, nil
+	}
+	return nil, nil
+}
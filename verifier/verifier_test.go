@@ -0,0 +1,120 @@
+package verifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/korjavin/zkTest1/circuits"
+)
+
+// balanceEnvelope proves balance ≥ neededAmount with fresh keys and returns its envelope
+func balanceEnvelope(t *testing.T, balance, neededAmount int) (Envelope, groth16.VerifyingKey) {
+	t.Helper()
+	ccs, err := circuits.Compile(&circuits.BalanceCircuit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, vk, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	full, err := frontend.NewWitness(&circuits.BalanceCircuit{Balance: balance, NeededAmount: neededAmount}, ecc.BN254.ScalarField())
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := groth16.Prove(ccs, pk, full)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, _ := full.Public()
+	encoded, _ := public.MarshalBinary()
+	data, _ := json.Marshal(proof)
+	inputs, _ := json.Marshal(map[string]int{"neededAmount": neededAmount})
+	return Envelope{Circuit: circuits.BalanceName, Inputs: inputs, Proof: data, PublicWitness: encoded}, vk
+}
+
+func TestVerify(t *testing.T) {
+	e, vk := balanceEnvelope(t, 100, 50)
+	var key bytes.Buffer
+	if _, err := vk.WriteTo(&key); err != nil {
+		t.Fatal(err)
+	}
+	v := New()
+	if _, err := v.Verify(e); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Expected %v without a pinned key, got %v", ErrUnknownKey, err)
+	}
+	if err := v.AddKeyBytes(circuits.BalanceName, ecc.BN254, key.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := json.Marshal(e)
+	parsed, err := ParseEnvelope(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := v.Verify(parsed)
+	if err != nil || !result.InputsChecked {
+		t.Fatalf("Expected the envelope to verify against its inputs, got %+v, %v", result, err)
+	}
+
+	// Without a public witness the inputs alone are enough
+	bare := e
+	bare.PublicWitness = nil
+	if _, err := v.Verify(bare); err != nil {
+		t.Errorf("Expected an envelope without a public witness to verify, got %v", err)
+	}
+
+	other := e
+	other.Inputs = json.RawMessage(`{"neededAmount": 60}`)
+	if _, err := v.Verify(other); !errors.Is(err, ErrWitnessMismatch) {
+		t.Errorf("Expected %v, got %v", ErrWitnessMismatch, err)
+	}
+	other.PublicWitness = nil
+	if _, err := v.Verify(other); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("Expected %v, got %v", ErrInvalidProof, err)
+	}
+
+	// Circuits of unknown inputs are verified against the public witness alone
+	v.AddKey("external", ecc.BN254, vk)
+	external := e
+	external.Circuit, external.Inputs = "external", nil
+	if result, err := v.Verify(external); err != nil || result.InputsChecked {
+		t.Errorf("Expected the witness alone to be checked, got %+v, %v", result, err)
+	}
+	external.PublicWitness = nil
+	if _, err := v.Verify(external); err == nil {
+		t.Error("Expected an unknown circuit without a public witness to be rejected")
+	}
+
+	for name, tweak := range map[string]func(*Envelope){
+		"Unknown field":     func(e *Envelope) { e.Inputs = json.RawMessage(`{"neededAmount": 50, "balance": 1}`) },
+		"Newer gnark":       func(e *Envelope) { e.GnarkVersion = "v9.0.0" },
+		"Other backend":     func(e *Envelope) { e.Backend = "plonk" },
+		"Unsupported curve": func(e *Envelope) { e.Curve = "secp256k1" },
+	} {
+		broken := e
+		tweak(&broken)
+		if _, err := v.Verify(broken); err == nil {
+			t.Errorf("%s: expected the envelope to be rejected", name)
+		}
+	}
+}
+
+func TestVerifyTimeLocked(t *testing.T) {
+	e, vk := balanceEnvelope(t, 100, 50)
+	v := New()
+	v.AddKey(circuits.TimeLockName, ecc.BN254, vk)
+	v.Now = func() time.Time { return time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC) }
+
+	e.Circuit, e.PublicWitness = circuits.TimeLockName, nil
+	e.Inputs = json.RawMessage(`{"neededAmount": 50, "notBefore": "2026-06-01T00:00:00Z"}`)
+	if _, err := v.Verify(e); !errors.Is(err, ErrNotYetValid) {
+		t.Errorf("Expected %v, got %v", ErrNotYetValid, err)
+	}
+}
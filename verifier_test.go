@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/korjavin/zkTest1/verifier"
+)
+
+// TestVerifierConformance checks that the verifier package accepts the envelopes of proofs this
+// server issues, with the keys it publishes, exactly as the server's own bundle validation does
+func TestVerifierConformance(t *testing.T) {
+	SkipIfShort(t, "proof generation")
+	withBuckets(t, []int64{0, 1000, 10000})
+	h := NewTestHelper(t)
+	h.SetupCleanBalances()
+	t.Cleanup(h.SetupCleanBalances)
+	h.AssertStatusCode(h.StoreBalance("conformance_user", 4200), http.StatusOK, "storing a balance")
+
+	notBefore := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	issued := []struct {
+		circuit string
+		issue   func() *httptest.ResponseRecorder
+		inputs  any
+		proof   func(body []byte) json.RawMessage
+	}{
+		{
+			strictBalanceCircuitName,
+			func() *httptest.ResponseRecorder {
+				return postJSON(t, generateProof, "/get/proof/neededAmount", ProofRequest{ID: "conformance_user", NeededAmount: 4000, Comparison: comparisonAbove})
+			},
+			map[string]any{"neededAmount": 4000},
+			func(body []byte) json.RawMessage { return body },
+		},
+		{
+			bucketCircuitName,
+			func() *httptest.ResponseRecorder {
+				return postJSON(t, generateBucketProof, "/get/proof/bucket", BucketProofRequest{ID: "conformance_user"})
+			},
+			map[string]any{"lower": 1000, "upper": 10000},
+			func(body []byte) json.RawMessage {
+				var resp struct{ Proof json.RawMessage }
+				_ = json.Unmarshal(body, &resp)
+				return resp.Proof
+			},
+		},
+		{
+			timeLockCircuitName,
+			func() *httptest.ResponseRecorder {
+				return postJSON(t, generateTimeLockedProof, "/get/proof/timelocked", TimeLockedProofRequest{ID: "conformance_user", NeededAmount: 1000, NotBefore: notBefore})
+			},
+			map[string]any{"neededAmount": 1000, "notBefore": notBefore},
+			func(body []byte) json.RawMessage { return body },
+		},
+	}
+
+	v := verifier.New()
+	for _, tt := range issued {
+		t.Run(tt.circuit, func(t *testing.T) {
+			// Pin the key the server publishes
+			req := httptest.NewRequest("GET", "/keys/verifying/"+tt.circuit, nil)
+			req.SetPathValue("name", tt.circuit)
+			rr := httptest.NewRecorder()
+			getVerifyingKey(rr, req)
+			h.AssertStatusCode(rr, http.StatusOK, "fetching the verifying key")
+			if err := v.AddKeyBytes(tt.circuit, ecc.BN254, rr.Body.Bytes()); err != nil {
+				t.Fatal(err)
+			}
+
+			rr = tt.issue()
+			h.AssertStatusCode(rr, http.StatusOK, "issuing a proof")
+			publicWitness, err := base64.StdEncoding.DecodeString(rr.Header().Get(publicWitnessHeader))
+			if err != nil {
+				t.Fatalf("Malformed public witness: %v", err)
+			}
+			inputs, _ := json.Marshal(tt.inputs)
+			m := ProofEnvelope{
+				Circuit:       tt.circuit,
+				Inputs:        inputs,
+				Proof:         tt.proof(rr.Body.Bytes()),
+				GnarkVersion:  rr.Header().Get(gnarkVersionHeader),
+				PublicWitness: publicWitness,
+			}
+			if err := verifyEnvelope(context.Background(), m); err != nil {
+				t.Fatalf("Expected the server to accept its envelope, got %v", err)
+			}
+
+			data, _ := json.Marshal(m)
+			e, err := verifier.ParseEnvelope(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := v.Verify(e)
+			if err != nil || !result.InputsChecked {
+				t.Fatalf("Expected the verifier to accept the envelope, got %+v, %v", result, err)
+			}
+
+			e.Inputs = json.RawMessage(`{"neededAmount": 1}`)
+			e.PublicWitness = nil
+			if _, err := v.Verify(e); err == nil {
+				t.Error("Expected other inputs to be rejected")
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/consensys/gnark"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/frontend"
+	"github.com/korjavin/zkTest1/circuits"
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+const (
+	defaultVerifyBenchIterations = 100
+	maxVerifyBenchIterations     = 10_000
+	// maxVerifyBenchDuration ends a run in time to answer within the server's write timeout
+	maxVerifyBenchDuration = 10 * time.Second
+)
+
+// VerifyBench is returned by GET /admin/verifybench
+type VerifyBench struct {
+	Circuit      string  `json:"circuit"`
+	Curve        string  `json:"curve"`
+	KeyID        string  `json:"keyId"`
+	Iterations   int     `json:"iterations"`          // verifications done
+	Truncated    bool    `json:"truncated,omitempty"` // the run ended on time before n verifications
+	Workers      int     `json:"workers"`
+	TotalMs      float64 `json:"totalMs"`
+	MeanMs       float64 `json:"meanMs"` // wall time per verification of a single worker
+	OpsPerSec    float64 `json:"opsPerSec"`
+	GOOS         string  `json:"goos"`
+	GOARCH       string  `json:"goarch"`
+	CPUs         int     `json:"cpus"`
+	GOMAXPROCS   int     `json:"gomaxprocs"`
+	GnarkVersion string  `json:"gnarkVersion"`
+}
+
+// benchReference is a proof of a circuit's sample assignment made with the keys identified by keyID
+type benchReference struct {
+	keyID  string
+	proof  groth16.Proof
+	public witness.Witness
+}
+
+var (
+	benchReferences   = make(map[string]benchReference)
+	benchReferencesMu sync.Mutex
+)
+
+// referenceProof returns the stored reference proof of a setup, proving its sample the first
+// time and again after its keys are rotated. The proof waits for a proving worker and memory
+// like any other.
+func referenceProof(ctx context.Context, setup *circuitSetup) (benchReference, error) {
+	benchReferencesMu.Lock()
+	ref, ok := benchReferences[setup.name]
+	benchReferencesMu.Unlock()
+	if ok && ref.keyID == setup.keyID {
+		return ref, nil
+	}
+
+	sampler, ok := setup.circuit.(circuits.Sampler)
+	var sample frontend.Circuit
+	if ok {
+		sample = sampler.Sample(setup.curve)
+	}
+	if sample == nil {
+		return benchReference{}, errs.Errorf(errs.Unprocessable, "%s has no sample assignment on %s", setup.name, setup.curve)
+	}
+	if setup.pk == nil {
+		return benchReference{}, fmt.Errorf("%w: %s", errProvingUnavailable, setup.verifyOnly)
+	}
+	full, err := frontend.NewWitness(sample, setup.curve.ScalarField())
+	if err != nil {
+		return benchReference{}, err
+	}
+	public, err := full.Public()
+	if err != nil {
+		return benchReference{}, err
+	}
+	var proof groth16.Proof
+	err = provers.run(ctx, setup.name, shapeOfSystem(setup.ccs).memory(setup.curve), func() error {
+		var err error
+		proof, err = groth16.Prove(setup.ccs, setup.pk, full)
+		return err
+	})
+	if err != nil {
+		if isContextError(err) {
+			return benchReference{}, err
+		}
+		return benchReference{}, fmt.Errorf("proving the reference proof of %s: %w", setup.name, err)
+	}
+
+	// Concurrent first runs may each prove one; any of them will do
+	ref = benchReference{keyID: setup.keyID, proof: proof, public: public}
+	benchReferencesMu.Lock()
+	benchReferences[setup.name] = ref
+	benchReferencesMu.Unlock()
+	return ref, nil
+}
+
+// benchVerify verifies the reference proof of setup iterations times split across workers,
+// stopping early when maxVerifyBenchDuration or half the time left to ctx has passed. The
+// verification cache is bypassed and nothing is counted or audited, so only the pairing checks
+// of this host are measured.
+func benchVerify(ctx context.Context, setup *circuitSetup, iterations, workers int) (VerifyBench, error) {
+	ref, err := referenceProof(ctx, setup)
+	if err != nil {
+		return VerifyBench{}, err
+	}
+	// A reference proof that does not verify would time the rejection path instead
+	if err := verifyGroth16(ref.proof, setup.vk, ref.public); err != nil {
+		return VerifyBench{}, errs.Errorf(errs.Internal, "reference proof of %s does not verify", setup.name)
+	}
+
+	start := time.Now()
+	budget := maxVerifyBenchDuration
+	if deadline, ok := ctx.Deadline(); ok {
+		budget = min(budget, time.Until(deadline)/2)
+	}
+	stop := start.Add(budget)
+
+	var remaining, done atomic.Int64
+	remaining.Store(int64(iterations))
+	var wg sync.WaitGroup
+	failed := make(chan error, workers)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for remaining.Add(-1) >= 0 && time.Now().Before(stop) {
+				if err := ctx.Err(); err != nil {
+					failed <- err
+					return
+				}
+				if err := verifyGroth16(ref.proof, setup.vk, ref.public); err != nil {
+					failed <- err
+					return
+				}
+				done.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	close(failed)
+	if err := <-failed; err != nil {
+		return VerifyBench{}, err
+	}
+	verified := int(done.Load())
+	if verified == 0 {
+		return VerifyBench{}, errs.Errorf(errs.Unavailable, "no time left to verify the reference proof of %s", setup.name)
+	}
+
+	return VerifyBench{
+		Curve:        setup.curve.String(),
+		KeyID:        setup.keyID,
+		Iterations:   verified,
+		Truncated:    verified < iterations,
+		Workers:      workers,
+		TotalMs:      milliseconds(elapsed),
+		MeanMs:       milliseconds(elapsed) * float64(workers) / float64(verified),
+		OpsPerSec:    float64(verified) / elapsed.Seconds(),
+		GOOS:         runtime.GOOS,
+		GOARCH:       runtime.GOARCH,
+		CPUs:         runtime.NumCPU(),
+		GOMAXPROCS:   runtime.GOMAXPROCS(0),
+		GnarkVersion: gnark.Version.String(),
+	}, nil
+}
+
+// benchParam reads a query parameter of at most limit, def when it is absent or 0
+func benchParam(r *http.Request, name string, def, limit int) (int, error) {
+	n, err := queryInt(r, name)
+	if err != nil || n > limit {
+		return 0, errs.Errorf(errs.Invalid, "%s must be between 1 and %d", name, limit)
+	}
+	if n == 0 {
+		return def, nil
+	}
+	return n, nil
+}
+
+// getVerifyBench verifies a stored reference proof of ?circuit= on ?curve= ?n= times with
+// ?workers= goroutines and reports the verifications per second of this host
+func getVerifyBench(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("circuit")
+	if name == "" {
+		name = balanceCircuitName
+	}
+	circuit, err := circuits.New(name)
+	if err != nil {
+		writeError(w, errs.Wrap(errs.NotFound, err))
+		return
+	}
+	curve, err := verifyCurve(r.URL.Query().Get("curve"), name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	iterations, err := benchParam(r, "n", defaultVerifyBenchIterations, maxVerifyBenchIterations)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	workers, err := benchParam(r, "workers", 1, runtime.GOMAXPROCS(0))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	workers = min(workers, iterations)
+
+	setup, err := loadCurveSetup(curve, name, circuit)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	bench, err := benchVerify(r.Context(), setup, iterations, workers)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	bench.Circuit = name
+	writeJSON(w, bench)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/korjavin/zkTest1/circuits"
+)
+
+func getBench(t *testing.T, query string) *httptest.ResponseRecorder {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	getVerifyBench(rr, httptest.NewRequest("GET", "/admin/verifybench"+query, nil))
+	return rr
+}
+
+func TestVerifyBenchRejectsBadInput(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		status int
+	}{
+		{"Unknown circuit", "?circuit=teleport", http.StatusNotFound},
+		{"Unsupported curve", "?curve=bw6_761", http.StatusBadRequest},
+		{"Too many iterations", "?n=10001", http.StatusBadRequest},
+		{"Negative iterations", "?n=-1", http.StatusBadRequest},
+		{"Too many workers", "?workers=100000", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := getBench(t, tt.query)
+			NewTestHelper(t).AssertStatusCode(rr, tt.status, tt.query)
+		})
+	}
+}
+
+func TestVerifyBench(t *testing.T) {
+	workers := min(2, runtime.GOMAXPROCS(0))
+	rr := getBench(t, fmt.Sprintf("?n=5&workers=%d", workers))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var bench VerifyBench
+	if err := json.Unmarshal(rr.Body.Bytes(), &bench); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if bench.Circuit != balanceCircuitName || bench.Iterations != 5 || bench.Workers != workers || bench.OpsPerSec <= 0 || bench.KeyID == "" {
+		t.Errorf("Expected 5 verifications of the balance circuit on %d workers, got %+v", workers, bench)
+	}
+
+	setup, err := loadCurveSetup(defaultCurve, balanceCircuitName, &circuits.BalanceCircuit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := referenceProof(context.Background(), setup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := referenceProof(context.Background(), setup)
+	if again.proof != first.proof {
+		t.Error("Expected the reference proof to be proved once and reused")
+	}
+}
+
+func TestVerifyBenchStopsOnTime(t *testing.T) {
+	setup, err := loadCurveSetup(defaultCurve, balanceCircuitName, &circuits.BalanceCircuit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := referenceProof(context.Background(), setup); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	bench, err := benchVerify(ctx, setup, maxVerifyBenchIterations, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bench.Truncated || bench.Iterations == 0 || bench.Iterations >= maxVerifyBenchIterations {
+		t.Errorf("Expected the run to stop within the time left to the request, got %+v", bench)
+	}
+}
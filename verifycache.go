@@ -0,0 +1,134 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/backend/witness"
+)
+
+// VerifyCacheConfig bounds the verification outcomes kept in memory; a TTL of 0 disables the cache
+type VerifyCacheConfig struct {
+	TTL      time.Duration
+	Capacity int
+}
+
+// verificationCache remembers recent verification outcomes by proof, public inputs and verifying
+// key, so relying parties that re-check the same proof do not pay for the pairings again
+type verificationCache struct {
+	ttl      time.Duration
+	capacity int
+	now      func() time.Time
+
+	mu      sync.Mutex
+	order   *list.List // front is the most recently stored
+	entries map[string]*list.Element
+	hits    atomic.Int64
+	misses  atomic.Int64
+}
+
+type cachedVerification struct {
+	key     string
+	valid   bool
+	expires time.Time
+}
+
+func newVerificationCache(cfg VerifyCacheConfig, now func() time.Time) *verificationCache {
+	return &verificationCache{ttl: cfg.TTL, capacity: cfg.Capacity, now: now, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// verifications caches the outcomes of verifications against loaded setups
+var verifications = newVerificationCache(VerifyCacheConfig{}, time.Now)
+
+func (c *verificationCache) enabled() bool {
+	return c.ttl > 0 && c.capacity > 0
+}
+
+// verificationKey identifies a verification by the verifying key and the binary encodings of
+// the proof and public witness
+func verificationKey(keyID string, proof groth16.Proof, public witness.Witness) (string, error) {
+	h := sha256.New()
+	h.Write([]byte(keyID))
+	h.Write([]byte{0})
+	if _, err := proof.WriteRawTo(h); err != nil {
+		return "", err
+	}
+	data, err := public.MarshalBinary()
+	if err != nil {
+		return "", err
+	}
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// get returns the cached outcome of a verification, if there is one that has not expired
+func (c *verificationCache) get(key string) (valid, ok bool) {
+	if !c.enabled() {
+		return false, false
+	}
+	now := c.now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok || !now.Before(el.Value.(*cachedVerification).expires) {
+		c.misses.Add(1)
+		return false, false
+	}
+	c.hits.Add(1)
+	return el.Value.(*cachedVerification).valid, true
+}
+
+// put caches the outcome of a verification, evicting the oldest outcomes beyond the capacity
+func (c *verificationCache) put(key string, valid bool) {
+	if !c.enabled() {
+		return
+	}
+	now := c.now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.order.Remove(el)
+		delete(c.entries, key)
+	}
+	for len(c.entries) >= c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedVerification).key)
+	}
+	c.entries[key] = c.order.PushFront(&cachedVerification{key: key, valid: valid, expires: now.Add(c.ttl)})
+}
+
+// sweep drops expired outcomes and returns how many
+func (c *verificationCache) sweep(now time.Time) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	removed := 0
+	for key, el := range c.entries {
+		if !now.Before(el.Value.(*cachedVerification).expires) {
+			c.order.Remove(el)
+			delete(c.entries, key)
+			removed++
+		}
+	}
+	return removed
+}
+
+// VerifyCacheStats counts the lookups of the verification cache
+type VerifyCacheStats struct {
+	Entries int   `json:"entries"`
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+}
+
+func (c *verificationCache) snapshot() VerifyCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return VerifyCacheStats{Entries: len(c.entries), Hits: c.hits.Load(), Misses: c.misses.Load()}
+}
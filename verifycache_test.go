@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/korjavin/zkTest1/circuits"
+)
+
+func TestVerificationCache(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := newVerificationCache(VerifyCacheConfig{TTL: time.Minute, Capacity: 2}, func() time.Time { return now })
+
+	c.put("a", true)
+	c.put("b", false)
+	if valid, ok := c.get("a"); !ok || !valid {
+		t.Errorf("Expected a cached valid outcome, got %t %t", valid, ok)
+	}
+	if valid, ok := c.get("b"); !ok || valid {
+		t.Errorf("Expected a cached invalid outcome, got %t %t", valid, ok)
+	}
+
+	// The oldest outcome makes room for a new one
+	c.put("c", true)
+	if _, ok := c.get("a"); ok {
+		t.Error("Expected the oldest outcome to be evicted")
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := c.get("c"); ok {
+		t.Error("Expected an expired outcome to be ignored")
+	}
+	if n := c.sweep(now); n != 2 {
+		t.Errorf("Expected 2 expired outcomes swept, got %d", n)
+	}
+	if s := c.snapshot(); s.Entries != 0 || s.Hits != 2 || s.Misses != 2 {
+		t.Errorf("Unexpected stats %+v", s)
+	}
+
+	disabled := newVerificationCache(VerifyCacheConfig{}, time.Now)
+	disabled.put("a", true)
+	if _, ok := disabled.get("a"); ok {
+		t.Error("Expected a disabled cache to keep nothing")
+	}
+}
+
+func TestCachedVerification(t *testing.T) {
+	SkipIfShort(t, "bucket proof generation")
+
+	previous := verifications
+	verifications = newVerificationCache(VerifyCacheConfig{TTL: time.Minute, Capacity: 10}, time.Now)
+	t.Cleanup(func() { verifications = previous })
+
+	setup, err := loadSetup(bucketCircuitName, &circuits.BucketCircuit{})
+	if err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+	assignment := &circuits.BucketCircuit{Balance: 1500, Lower: 1000, Upper: 10000}
+	proof, err := setup.prove(context.Background(), assignment)
+	if err != nil {
+		t.Fatalf("Prove failed: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := setup.verify(context.Background(), proof, assignment); err != nil {
+			t.Fatalf("Verification %d failed: %v", i, err)
+		}
+	}
+	wrong := &circuits.BucketCircuit{Lower: 2000, Upper: 10000}
+	for i := 0; i < 2; i++ {
+		if err := setup.verify(context.Background(), proof, wrong); !errors.Is(err, errInvalidProof) {
+			t.Fatalf("Expected the proof not to verify other bounds, got %v", err)
+		}
+	}
+	if s := verifications.snapshot(); s.Entries != 2 || s.Hits != 2 || s.Misses != 2 {
+		t.Errorf("Expected each outcome computed once and then served from the cache, got %+v", s)
+	}
+
+	// Another verifying key does not share outcomes
+	public, _ := frontend.NewWitness(assignment, setup.curve.ScalarField(), frontend.PublicOnly())
+	other, _ := verificationKey("other-key", proof, public)
+	if _, ok := verifications.get(other); ok {
+		t.Error("Expected outcomes to be keyed by verifying key")
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"io/fs"
+	"net/http"
+	"strconv"
+
+	"github.com/korjavin/zkTest1/circuits"
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// wasmProverPath is the prover built by make wasm, relative to the frontend assets
+const wasmProverPath = "wasm/prover.wasm"
+
+// wasmHandler serves the WASM prover and its wasm_exec.js glue from the frontend assets.
+// Servers built without make wasm answer 501 so the frontend can fall back to server proving.
+func wasmHandler(assets fs.FS) http.HandlerFunc {
+	static := staticHandler(assets)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, err := fs.Stat(assets, wasmProverPath); err != nil {
+			writeError(w, errs.Errorf(errs.NotImplemented, "this server was built without the WASM prover, run make wasm"))
+			return
+		}
+		static(w, r)
+	}
+}
+
+// getProvingKey serves the binary BN254 proving key of a circuit for the WASM prover. The
+// key is the one this server verifies with, so browser proofs validate at /validate.
+func getProvingKey(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	circuit, err := circuits.New(name)
+	if err != nil {
+		writeError(w, errs.Wrap(errs.NotFound, err))
+		return
+	}
+	setup, err := loadSetup(name, circuit)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var buf bytes.Buffer
+	if _, err := setup.pk.WriteTo(&buf); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Header().Set(proofCurveHeader, setup.curve.String())
+	_, _ = w.Write(buf.Bytes())
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/korjavin/zkTest1/circuits"
+)
+
+func TestWasmHandler(t *testing.T) {
+	built := fstest.MapFS{
+		wasmProverPath:      {Data: []byte("\x00asm")},
+		"wasm/wasm_exec.js": {Data: []byte("// glue")},
+	}
+
+	tests := []struct {
+		name   string
+		assets fstest.MapFS
+		path   string
+		status int
+	}{
+		{"Prover", built, "/wasm/prover.wasm", http.StatusOK},
+		{"Glue", built, "/wasm/wasm_exec.js", http.StatusOK},
+		{"Unknown asset", built, "/wasm/teleport.wasm", http.StatusNotFound},
+		{"Built without the prover", fstest.MapFS{}, "/wasm/prover.wasm", http.StatusNotImplemented},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			wasmHandler(tt.assets)(rr, httptest.NewRequest("GET", tt.path, nil))
+			if rr.Code != tt.status {
+				t.Errorf("Expected status %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestGetProvingKey(t *testing.T) {
+	h := NewTestHelper(t)
+
+	req := httptest.NewRequest("GET", "/wasm/keys/teleport", nil)
+	req.SetPathValue("name", "teleport")
+	rr := httptest.NewRecorder()
+	getProvingKey(rr, req)
+	h.AssertStatusCode(rr, http.StatusNotFound, "fetching the key of an unknown circuit")
+
+	SkipIfShort(t, "balance circuit setup")
+	req = httptest.NewRequest("GET", "/wasm/keys/balance", nil)
+	req.SetPathValue("name", balanceCircuitName)
+	rr = httptest.NewRecorder()
+	getProvingKey(rr, req)
+	h.AssertStatusCode(rr, http.StatusOK, "fetching the balance proving key")
+
+	pk := groth16.NewProvingKey(ecc.BN254)
+	if _, err := pk.ReadFrom(bytes.NewReader(rr.Body.Bytes())); err != nil {
+		t.Fatalf("Expected a binary proving key, got %v", err)
+	}
+
+	setup, err := loadSetup(balanceCircuitName, &circuits.BalanceCircuit{})
+	if err != nil {
+		t.Fatalf("Failed to load balance setup: %v", err)
+	}
+	var want bytes.Buffer
+	if _, err := setup.pk.WriteTo(&want); err != nil {
+		t.Fatalf("Failed to serialize proving key: %v", err)
+	}
+	if !bytes.Equal(rr.Body.Bytes(), want.Bytes()) {
+		t.Error("Expected the served key to be the one the server verifies with")
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/korjavin/zkTest1/internal/errs"
+)
+
+// webDir is the demo frontend on disk, served instead of the embedded copy in development mode
+const webDir = "web"
+
+//go:embed web
+var embeddedWeb embed.FS
+
+// webAssets returns the demo frontend: embedded in the binary, or read from ./web on every
+// request in development mode so edits show up on reload
+func webAssets(dev bool) (fs.FS, error) {
+	if dev {
+		return os.DirFS(webDir), nil
+	}
+	return fs.Sub(embeddedWeb, webDir)
+}
+
+// staticHandler serves the demo frontend to requests no API route matches. Other methods
+// than GET, such as a POST to a GET-only API route, answer 405, and paths without an asset
+// answer with the error envelope rather than a page.
+func staticHandler(assets fs.FS) http.HandlerFunc {
+	files := http.FileServerFS(assets)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeError(w, errs.Errorf(errs.MethodNotAllowed, "method not allowed"))
+			return
+		}
+		name := strings.TrimPrefix(path.Clean(r.URL.Path), "/")
+		if name == "" {
+			name = "index.html"
+		}
+		if info, err := fs.Stat(assets, name); err != nil || info.IsDir() {
+			writeError(w, errs.Errorf(errs.NotFound, "not found"))
+			return
+		}
+		files.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,82 @@
+// zkTest1 browser prover
+// Proves with the circuit compiled to WebAssembly, so the secret witness never leaves the
+// browser, and verifies through the server's /validate endpoint.
+
+class BrowserProver {
+    constructor(apiBase) {
+        this.apiBase = apiBase;
+        this.loading = null;
+        this.keys = {};
+    }
+
+    // Whether the server offers the WASM prover: the wasm-proving feature is enabled and
+    // the server was built with make wasm
+    async available() {
+        if (typeof WebAssembly !== 'object') {
+            return false;
+        }
+        try {
+            const response = await fetch(`${this.apiBase}/wasm/prover.wasm`, { method: 'HEAD' });
+            return response.ok;
+        } catch (error) {
+            return false;
+        }
+    }
+
+    // Loads the Go runtime glue and starts the prover once; zkProve is global afterwards
+    load() {
+        if (!this.loading) {
+            this.loading = (async () => {
+                await this.loadScript(`${this.apiBase}/wasm/wasm_exec.js`);
+                const go = new Go();
+                const { instance } = await WebAssembly.instantiateStreaming(
+                    fetch(`${this.apiBase}/wasm/prover.wasm`), go.importObject);
+                go.run(instance);
+            })();
+            this.loading.catch(() => { this.loading = null; });
+        }
+        return this.loading;
+    }
+
+    loadScript(src) {
+        return new Promise((resolve, reject) => {
+            const script = document.createElement('script');
+            script.src = src;
+            script.onload = resolve;
+            script.onerror = () => reject(new Error(`Failed to load ${src}`));
+            document.head.appendChild(script);
+        });
+    }
+
+    // The server's proving key of a circuit, fetched once per page
+    async provingKey(circuit) {
+        if (!this.keys[circuit]) {
+            const response = await fetch(`${this.apiBase}/wasm/keys/${encodeURIComponent(circuit)}`);
+            if (!response.ok) {
+                throw new Error(`HTTP ${response.status}: failed to fetch the ${circuit} proving key`);
+            }
+            this.keys[circuit] = new Uint8Array(await response.arrayBuffer());
+        }
+        return this.keys[circuit];
+    }
+
+    // Proves witness, keyed by the circuit's field names, and returns the JSON proof and
+    // the base64 public witness
+    async prove(circuit, witness) {
+        const [, provingKey] = await Promise.all([this.load(), this.provingKey(circuit)]);
+        const result = await zkProve(circuit, provingKey, JSON.stringify(witness));
+        return { proof: JSON.parse(result.proof), publicWitness: result.publicWitness };
+    }
+
+    // Verifies a browser proof against its public witness on the server
+    async verify(circuit, proof, publicWitness) {
+        const response = await fetch(`${this.apiBase}/validate`, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({ circuit, proof, publicWitness })
+        });
+        return response.ok;
+    }
+}
@@ -3,9 +3,12 @@
 
 class ZKDemoApp {
     constructor() {
-        this.apiBase = 'http://localhost:8080';
+        this.apiBase = window.location.origin;
+        this.csrfToken = null;
+        this.identity = null; // balance id of a user the identity provider signed in
         this.currentUser = null;
         this.currentProof = null;
+        this.browserProver = new BrowserProver(this.apiBase);
         this.demoState = {
             step1: false,
             step2: false,
@@ -20,6 +23,33 @@ class ZKDemoApp {
         this.setupSmoothScrolling();
         this.setupInputValidation();
         this.resetDemo();
+        this.offerBrowserProving();
+        this.restoreSession();
+    }
+
+    // Picks up a session the identity provider signed in, after its redirect back here
+    async restoreSession() {
+        const response = await fetch(`${this.apiBase}/session`);
+        if (!response.ok) {
+            return;
+        }
+        const session = await response.json();
+        if (session.provider !== 'oidc') {
+            return;
+        }
+        this.csrfToken = session.csrfToken;
+        this.identity = session.id;
+        const nameInput = document.getElementById('userName');
+        nameInput.value = session.id;
+        nameInput.readOnly = true;
+        this.validateStep1();
+    }
+
+    // Shows the browser proving option when the server offers the WASM prover
+    async offerBrowserProving() {
+        if (await this.browserProver.available()) {
+            document.getElementById('browserProvingOption').style.display = 'block';
+        }
     }
 
     setupEventListeners() {
@@ -106,14 +136,21 @@ class ZKDemoApp {
 
         this.showStatus('step1', 'loading', 'Setting up your balance...');
 
+        const id = this.identity || name.toLowerCase().replace(/\s+/g, '');
+
         try {
+            if (!this.identity) {
+                await this.signIn(id);
+            }
+
             const response = await fetch(`${this.apiBase}/store/sum`, {
                 method: 'POST',
                 headers: {
                     'Content-Type': 'application/json',
+                    'X-CSRF-Token': this.csrfToken,
                 },
                 body: JSON.stringify({
-                    id: name.toLowerCase().replace(/\s+/g, ''),
+                    id,
                     amount: balance
                 })
             });
@@ -123,7 +160,7 @@ class ZKDemoApp {
             }
 
             this.currentUser = {
-                id: name.toLowerCase().replace(/\s+/g, ''),
+                id,
                 name: name,
                 balance: balance
             };
@@ -182,26 +219,40 @@ class ZKDemoApp {
             // Add realistic delay to show the complexity
             await this.delay(2000);
 
-            const response = await fetch(`${this.apiBase}/get/proof/neededAmount`, {
-                method: 'POST',
-                headers: {
-                    'Content-Type': 'application/json',
-                },
-                body: JSON.stringify({
-                    id: this.currentUser.id,
-                    neededAmount: proofAmount
-                })
-            });
+            let proofData;
+            let publicWitness = null;
+            if (document.getElementById('proveInBrowser').checked) {
+                // The balance stays on this device; only the proof and public witness leave it
+                ({ proof: proofData, publicWitness } = await this.browserProver.prove('balance', {
+                    Balance: this.currentUser.balance,
+                    NeededAmount: proofAmount
+                }));
+            } else {
+                const gateHeaders = await this.proofGateHeaders();
+                const response = await fetch(`${this.apiBase}/get/proof/neededAmount`, {
+                    method: 'POST',
+                    headers: {
+                        'Content-Type': 'application/json',
+                        'X-CSRF-Token': this.csrfToken,
+                        ...gateHeaders,
+                    },
+                    body: JSON.stringify({
+                        id: this.currentUser.id,
+                        neededAmount: proofAmount
+                    })
+                });
 
-            if (!response.ok) {
-                throw new Error(`HTTP ${response.status}: ${response.statusText}`);
-            }
+                if (!response.ok) {
+                    throw new Error(`HTTP ${response.status}: ${response.statusText}`);
+                }
 
-            const proofData = await response.json();
+                proofData = await response.json();
+            }
             this.currentProof = {
                 data: proofData,
                 amount: proofAmount,
-                userId: this.currentUser.id
+                userId: this.currentUser.id,
+                publicWitness
             };
 
             this.showLoadingModal(false);
@@ -266,20 +317,28 @@ class ZKDemoApp {
             // Add delay to show verification process
             await this.delay(1500);
 
-            const response = await fetch(`${this.apiBase}/validate`, {
-                method: 'POST',
-                headers: {
-                    'Content-Type': 'application/json',
-                },
-                body: JSON.stringify({
-                    id: this.currentProof.userId,
-                    neededAmount: this.currentProof.amount,
-                    proof: this.currentProof.data
-                })
-            });
+            if (this.currentProof.publicWitness) {
+                // Browser proofs carry their public witness, which holds the proven amount
+                const verified = await this.browserProver.verify('balance', this.currentProof.data, this.currentProof.publicWitness);
+                if (!verified) {
+                    throw new Error('Proof verification failed');
+                }
+            } else {
+                const response = await fetch(`${this.apiBase}/validate`, {
+                    method: 'POST',
+                    headers: {
+                        'Content-Type': 'application/json',
+                    },
+                    body: JSON.stringify({
+                        id: this.currentProof.userId,
+                        neededAmount: this.currentProof.amount,
+                        proof: this.currentProof.data
+                    })
+                });
 
-            if (!response.ok) {
-                throw new Error(`HTTP ${response.status}: Proof verification failed`);
+                if (!response.ok) {
+                    throw new Error(`HTTP ${response.status}: Proof verification failed`);
+                }
             }
 
             this.demoState.step3 = true;
@@ -312,6 +371,7 @@ class ZKDemoApp {
 
     resetDemo() {
         // Reset all state
+        this.signOut();
         this.currentUser = null;
         this.currentProof = null;
         this.demoState = {
@@ -433,6 +493,80 @@ class ZKDemoApp {
         return new Promise(resolve => setTimeout(resolve, ms));
     }
 
+    // Signs in as the demo user, so other visitors cannot act for them while the session lasts
+    async signIn(id) {
+        const response = await fetch(`${this.apiBase}/session`, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({ id })
+        });
+        if (response.status === 409) {
+            throw new Error(`${id} is in use in another session, please pick another name`);
+        }
+        if (response.status === 403 && (await response.json()).code === 'oidc_required') {
+            // This server signs users in through its identity provider, which sends them back here
+            window.location.href = `${this.apiBase}/oidc/login`;
+            throw new Error('Redirecting to sign in');
+        }
+        if (!response.ok) {
+            throw new Error(`HTTP ${response.status}: ${response.statusText}`);
+        }
+        const session = await response.json();
+        this.csrfToken = session.csrfToken;
+    }
+
+    async signOut() {
+        if (!this.csrfToken) {
+            return;
+        }
+        const token = this.csrfToken;
+        this.csrfToken = null;
+        this.identity = null;
+        document.getElementById('userName').readOnly = false;
+        try {
+            await fetch(`${this.apiBase}/session`, {
+                method: 'DELETE',
+                headers: { 'X-CSRF-Token': token }
+            });
+        } catch (error) {
+            console.error('Error signing out:', error);
+        }
+    }
+
+    // Solves the server's proof-of-work challenge when the anti-abuse gate is enabled
+    async proofGateHeaders() {
+        const response = await fetch(`${this.apiBase}/challenge`);
+        if (!response.ok) {
+            return {};
+        }
+        const gate = await response.json();
+        if (gate.mode !== 'pow') {
+            return {};
+        }
+
+        const encoder = new TextEncoder();
+        for (let nonce = 0; ; nonce++) {
+            const solution = `${gate.challenge}:${nonce}`;
+            const digest = new Uint8Array(await crypto.subtle.digest('SHA-256', encoder.encode(solution)));
+            if (this.leadingZeroBits(digest) >= gate.difficulty) {
+                return { 'X-PoW-Solution': solution };
+            }
+        }
+    }
+
+    leadingZeroBits(bytes) {
+        let count = 0;
+        for (const b of bytes) {
+            if (b !== 0) {
+                return count + Math.clz32(b) - 24;
+            }
+            count += 8;
+        }
+        return count;
+    }
+
     // Utility function to check if API is available
     async checkAPIHealth() {
         try {
@@ -540,6 +674,7 @@ You can:
 3. Verify the proof without revealing your actual balance
 
 API Endpoints:
+- POST ${window.zkDemo.apiBase}/session
 - POST ${window.zkDemo.apiBase}/store/sum
 - POST ${window.zkDemo.apiBase}/get/proof/neededAmount  
 - POST ${window.zkDemo.apiBase}/validate
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestStaticHandler(t *testing.T) {
+	assets, err := webAssets(false)
+	if err != nil {
+		t.Fatalf("Failed to load embedded assets: %v", err)
+	}
+	handler := staticHandler(assets)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		status int
+		body   string // expected in the response
+	}{
+		{"Index", "GET", "/", http.StatusOK, "<html"},
+		{"Stylesheet", "GET", "/styles.css", http.StatusOK, ""},
+		{"Head", "HEAD", "/script.js", http.StatusOK, ""},
+		{"Unknown path", "GET", "/get/proof/teleport", http.StatusNotFound, `"code":"not_found"`},
+		{"Escaping the root", "GET", "/../main.go", http.StatusNotFound, `"code":"not_found"`},
+		{"Other method on a GET-only route", "POST", "/buckets", http.StatusMethodNotAllowed, `"code":"method_not_allowed"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler(rr, httptest.NewRequest(tt.method, tt.path, nil))
+
+			if rr.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+			if !strings.Contains(strings.ToLower(rr.Body.String()), strings.ToLower(tt.body)) {
+				t.Errorf("Expected the body to contain %q, got %.80q", tt.body, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestWebAssetsMatchDisk(t *testing.T) {
+	embedded, _ := webAssets(false)
+	dev, _ := webAssets(true)
+
+	for _, name := range []string{"index.html", "script.js", "prover.js", "styles.css"} {
+		want, err := os.ReadFile("web/" + name)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", name, err)
+		}
+		if got, err := fs.ReadFile(embedded, name); err != nil || string(got) != string(want) {
+			t.Errorf("Expected the embedded %s to match the file on disk, got %v", name, err)
+		}
+		if got, err := fs.ReadFile(dev, name); err != nil || string(got) != string(want) {
+			t.Errorf("Expected development mode to serve %s from disk, got %v", name, err)
+		}
+	}
+}